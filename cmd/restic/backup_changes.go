@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+
+	"github.com/restic/restic/internal/diff"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+)
+
+// backupChange is a record in the file written by backup --changes-file.
+type backupChange struct {
+	Path    string  `json:"path"`
+	Action  string  `json:"action"`
+	Type    string  `json:"type"`
+	Size    uint64  `json:"size"`
+	OldSize *uint64 `json:"old_size,omitempty"`
+	Reason  string  `json:"reason,omitempty"`
+}
+
+// changeReason returns why the item of the modification c differs.
+func changeReason(c diff.Change) string {
+	switch {
+	case c.TypeChanged():
+		return "type"
+	case c.ContentChanged():
+		switch c.New.Type {
+		case "symlink":
+			return "link target"
+		case "dev", "chardev":
+			return "device"
+		}
+		return "content"
+	}
+
+	return "metadata"
+}
+
+// writeChanges writes the change c as newline-delimited JSON to enc.
+func writeChanges(enc *json.Encoder, c diff.Change) error {
+	node := c.Node()
+	change := backupChange{
+		Path: c.Path,
+		Type: node.Type,
+		Size: node.Size,
+	}
+
+	switch {
+	case c.Added():
+		change.Action = "added"
+	case c.Removed():
+		change.Action = "removed"
+	default:
+		oldSize := c.Old.Size
+		change.Action = "modified"
+		change.OldSize = &oldSize
+		change.Reason = changeReason(c)
+	}
+
+	return enc.Encode(change)
+}
+
+// writeChangesFile writes the changes from the parent snapshot to sn to the
+// file filename. Without a parent, all items are reported as added.
+func writeChangesFile(ctx context.Context, repo restic.Repository, filename string, parentID *restic.ID, sn *restic.Snapshot) error {
+	var parentTree *restic.ID
+	if parentID != nil {
+		parent, err := restic.LoadSnapshot(ctx, repo, *parentID)
+		if err != nil {
+			return err
+		}
+		parentTree = parent.Tree
+	}
+
+	f, err := os.Create(filename)
+	if err != nil {
+		return errors.Fatalf("unable to create changes file: %v", err)
+	}
+
+	enc := json.NewEncoder(f)
+	err = diff.Trees(ctx, repo, parentTree, sn.Tree, func(c diff.Change) error {
+		return writeChanges(enc, c)
+	})
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	return errors.Wrap(f.Close(), "Close")
+}
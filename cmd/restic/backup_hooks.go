@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+
+	"github.com/restic/restic/internal/backend"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+)
+
+// backupHooks runs the commands given with --pre-command and the
+// --post-*-command options around a backup. The fields are set while the
+// backup runs, the post commands receive them as environment variables.
+type backupHooks struct {
+	opts  BackupOptions
+	gopts GlobalOptions
+
+	repo       *repository.Repository
+	snapshotID *restic.ID
+	summary    *backupSummary
+}
+
+func newBackupHooks(opts BackupOptions, gopts GlobalOptions) *backupHooks {
+	return &backupHooks{opts: opts, gopts: gopts}
+}
+
+// pre runs the command given with --pre-command, the backup is aborted if it
+// fails.
+func (h *backupHooks) pre() error {
+	if h.opts.PreCommand == "" {
+		return nil
+	}
+
+	err := h.run("--pre-command", h.opts.PreCommand, nil)
+	if err != nil {
+		return errors.Fatalf("%v, backup aborted", err)
+	}
+	return nil
+}
+
+// post runs the commands given with --post-command and, depending on err,
+// --post-success-command or --post-failure-command. A failed command is
+// reported, but does not change the result of the backup.
+func (h *backupHooks) post(err error) {
+	env := h.env(err)
+
+	flag, command := "--post-success-command", h.opts.PostSuccessCommand
+	if err != nil {
+		flag, command = "--post-failure-command", h.opts.PostFailureCommand
+	}
+
+	for _, c := range []struct {
+		flag    string
+		command string
+	}{
+		{flag, command},
+		{"--post-command", h.opts.PostCommand},
+	} {
+		if c.command == "" {
+			continue
+		}
+
+		if err := h.run(c.flag, c.command, env); err != nil {
+			Warnf("%v\n", err)
+		}
+	}
+}
+
+// env returns the environment variables which describe the result of the
+// backup.
+func (h *backupHooks) env(err error) []string {
+	env := []string{"RESTIC_BACKUP_STATUS=success"}
+	if err != nil {
+		env = []string{
+			"RESTIC_BACKUP_STATUS=failure",
+			"RESTIC_BACKUP_ERROR=" + err.Error(),
+		}
+	}
+
+	if h.snapshotID != nil {
+		env = append(env, "RESTIC_SNAPSHOT_ID="+h.snapshotID.String())
+	}
+
+	if h.summary != nil {
+		env = append(env,
+			"RESTIC_FILES_PROCESSED="+strconv.FormatUint(h.summary.FilesProcessed, 10),
+			"RESTIC_DIRS_PROCESSED="+strconv.FormatUint(h.summary.DirsProcessed, 10),
+			"RESTIC_BYTES_PROCESSED="+strconv.FormatUint(h.summary.BytesProcessed, 10),
+			"RESTIC_ERROR_COUNT="+strconv.FormatUint(h.summary.ErrorCount, 10),
+			fmt.Sprintf("RESTIC_DURATION=%.3f", h.summary.TotalDuration),
+		)
+	}
+
+	if h.repo != nil {
+		env = append(env, "RESTIC_DATA_ADDED="+strconv.FormatUint(h.repo.UploadedBytes(), 10))
+	}
+
+	return env
+}
+
+// run runs command with the additional environment variables in env. The
+// command is split like a shell would do, but not run by a shell.
+func (h *backupHooks) run(flag, command string, env []string) error {
+	args, err := backend.SplitShellStrings(command)
+	if err != nil {
+		return errors.Fatalf("invalid %v: %v", flag, err)
+	}
+
+	if len(args) == 0 {
+		return errors.Fatalf("%v is empty", flag)
+	}
+
+	debug.Log("running %v: %v", flag, args)
+
+	// the output of restic is parsed in JSON mode
+	var stdout io.Writer = os.Stdout
+	if h.gopts.JSON {
+		stdout = os.Stderr
+	}
+
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdout = stdout
+	cmd.Stderr = os.Stderr
+
+	if err = cmd.Run(); err != nil {
+		return errors.Fatalf("running %v failed: %v", flag, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+// envCommand returns a command which writes the environment to filename.
+func envCommand(t testing.TB, filename string) string {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not found")
+	}
+	return "sh -c 'env > \"" + filename + "\"'"
+}
+
+// readEnv returns the environment variables written by the command returned
+// by envCommand, nil is returned if the command was not run.
+func readEnv(t testing.TB, filename string) map[string]string {
+	buf, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	rtest.OK(t, err)
+	rtest.OK(t, os.Remove(filename))
+
+	env := make(map[string]string)
+	for _, line := range strings.Split(string(buf), "\n") {
+		if pos := strings.Index(line, "="); pos > 0 {
+			env[line[:pos]] = line[pos+1:]
+		}
+	}
+	return env
+}
+
+func TestBackupHooks(t *testing.T) {
+	dir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+
+	pre := filepath.Join(dir, "pre")
+	post := filepath.Join(dir, "post")
+	success := filepath.Join(dir, "success")
+	failure := filepath.Join(dir, "failure")
+
+	opts := BackupOptions{
+		PreCommand:         envCommand(t, pre),
+		PostCommand:        envCommand(t, post),
+		PostSuccessCommand: envCommand(t, success),
+		PostFailureCommand: envCommand(t, failure),
+	}
+
+	h := newBackupHooks(opts, GlobalOptions{})
+	rtest.OK(t, h.pre())
+	rtest.Assert(t, readEnv(t, pre) != nil, "pre command not run")
+
+	id := restic.NewRandomID()
+	h.snapshotID = &id
+	h.summary = &backupSummary{FilesProcessed: 23, BytesProcessed: 42}
+	h.post(nil)
+
+	env := readEnv(t, success)
+	rtest.Equals(t, "success", env["RESTIC_BACKUP_STATUS"])
+	rtest.Equals(t, id.String(), env["RESTIC_SNAPSHOT_ID"])
+	rtest.Equals(t, "23", env["RESTIC_FILES_PROCESSED"])
+	rtest.Equals(t, "42", env["RESTIC_BYTES_PROCESSED"])
+	rtest.Assert(t, readEnv(t, post) != nil, "post command not run")
+	rtest.Assert(t, readEnv(t, failure) == nil, "failure command run after success")
+
+	h = newBackupHooks(opts, GlobalOptions{})
+	h.post(errors.New("repository not found"))
+
+	env = readEnv(t, failure)
+	rtest.Equals(t, "failure", env["RESTIC_BACKUP_STATUS"])
+	rtest.Equals(t, "repository not found", env["RESTIC_BACKUP_ERROR"])
+	_, ok := env["RESTIC_SNAPSHOT_ID"]
+	rtest.Assert(t, !ok, "snapshot ID set for failed backup")
+	rtest.Assert(t, readEnv(t, post) != nil, "post command not run")
+	rtest.Assert(t, readEnv(t, success) == nil, "success command run after failure")
+}
+
+func TestBackupPreCommandFails(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+	rtest.SetupTarTestFixture(t, env.testdata, filepath.Join("testdata", "backup-data.tar.gz"))
+
+	failure := filepath.Join(env.base, "failure")
+	opts := BackupOptions{
+		PreCommand:         "sh -c 'exit 1'",
+		PostFailureCommand: envCommand(t, failure),
+	}
+
+	err := runBackup(opts, env.gopts, []string{env.testdata})
+	rtest.Assert(t, err != nil, "backup did not fail")
+	rtest.Equals(t, 0, len(testRunList(t, "snapshots", env.gopts)))
+
+	rtest.Equals(t, "failure", readEnv(t, failure)["RESTIC_BACKUP_STATUS"])
+}
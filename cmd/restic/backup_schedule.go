@@ -0,0 +1,297 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/restic/restic/internal/cache"
+	"github.com/restic/restic/internal/cron"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/restic"
+)
+
+// scheduleStatus is the state of the scheduled backups, it is served as JSON
+// with --status-listen.
+type scheduleStatus struct {
+	m sync.Mutex
+
+	Schedule       string     `json:"schedule"`
+	Running        bool       `json:"running"`
+	NextRun        *time.Time `json:"next_run,omitempty"`
+	Runs           uint       `json:"runs"`
+	Failures       uint       `json:"failures"`
+	LastStart      *time.Time `json:"last_start,omitempty"`
+	LastEnd        *time.Time `json:"last_end,omitempty"`
+	LastError      string     `json:"last_error,omitempty"`
+	LastSnapshotID *restic.ID `json:"last_snapshot_id,omitempty"`
+}
+
+// setNext records the time of the next backup.
+func (s *scheduleStatus) setNext(next time.Time) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	s.NextRun = &next
+}
+
+// start records that a backup has been started.
+func (s *scheduleStatus) start() {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	now := time.Now()
+	s.Running = true
+	s.NextRun = nil
+	s.LastStart = &now
+}
+
+// finish records that the backup has finished with err, id is the last
+// snapshot saved.
+func (s *scheduleStatus) finish(id *restic.ID, err error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	now := time.Now()
+	s.Running = false
+	s.LastEnd = &now
+	s.Runs++
+	s.LastError = ""
+	if err != nil {
+		s.Failures++
+		s.LastError = err.Error()
+	}
+	s.LastSnapshotID = id
+}
+
+func (s *scheduleStatus) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	s.m.Lock()
+	buf, err := json.Marshal(s)
+	s.m.Unlock()
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(append(buf, '\n'))
+}
+
+// serveStatus serves status as JSON at addr until the returned function is
+// called. Nothing is done when addr is empty.
+func serveStatus(addr string, status *scheduleStatus) (stop func(), err error) {
+	if addr == "" {
+		return func() {}, nil
+	}
+
+	l, err := listen(addr)
+	if err != nil {
+		return nil, errors.Fatalf("unable to listen on %v for the status: %v", addr, err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/status", status)
+	srv := &http.Server{Handler: mux}
+
+	go func() {
+		err := srv.Serve(l)
+		if err != nil && err != http.ErrServerClosed {
+			Warnf("serving the status failed: %v\n", err)
+		}
+	}()
+
+	Verbosef("serving the status at http://%v/status\n", l.Addr())
+
+	return func() {
+		_ = srv.Close()
+	}, nil
+}
+
+// lockSchedule makes sure that only one process runs scheduled backups to the
+// repository on this host, the lock file is stored in the cache directory.
+func lockSchedule(gopts GlobalOptions) (unlock func(), err error) {
+	dir := gopts.CacheDir
+	if dir == "" {
+		dir, err = cache.DefaultDir()
+		if err != nil {
+			return nil, errors.Fatalf("unable to find the cache directory: %v", err)
+		}
+	}
+
+	// the location may contain credentials, only a hash is used
+	h := sha256.Sum256([]byte(gopts.Repo))
+	name := filepath.Join(dir, "schedule-"+hex.EncodeToString(h[:8])+".lock")
+
+	unlock, err = cache.TryLock(name)
+	if cache.IsLocked(err) {
+		return nil, errors.Fatal("scheduled backups to this repository are already run by another process")
+	}
+	if err != nil {
+		return nil, errors.Fatalf("unable to lock %v: %v", name, err)
+	}
+
+	return unlock, nil
+}
+
+// waitUntil blocks until the wall clock reaches t. The clock is checked at
+// least once a minute, so that a backup is not delayed further when the
+// machine has been suspended.
+func waitUntil(ctx context.Context, t time.Time) error {
+	for {
+		d := time.Until(t)
+		if d <= 0 {
+			return nil
+		}
+		if d > time.Minute {
+			d = time.Minute
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(d):
+		}
+	}
+}
+
+// forgetScheduled applies the policy given with the --keep-* options to the
+// snapshots of the host and the paths of the backup.
+func forgetScheduled(opts BackupOptions, gopts GlobalOptions, args []string) error {
+	if opts.Forget.policy().Empty() {
+		return nil
+	}
+
+	target, err := backupTargets(opts, args)
+	if err != nil {
+		return err
+	}
+
+	fopts := opts.Forget
+	fopts.Host = opts.Hostname
+	fopts.Paths = target
+	fopts.GroupBy = "host,paths"
+
+	return runForget(fopts, gopts, nil)
+}
+
+// patternFiles records the modification times of the exclude files and the
+// file lists of scheduled backups. The files are read again for each backup,
+// so changes are used without restarting restic.
+type patternFiles map[string]time.Time
+
+// changed returns the files of opts which were modified since the last call,
+// the first call only records the modification times.
+func (p patternFiles) changed(opts BackupOptions) (changed []string) {
+	files := append(append([]string(nil), opts.ExcludeFiles...), opts.InsensitiveExcludeFiles...)
+	for _, name := range []string{opts.FilesFrom, opts.FilesFromVerbatim, opts.FilesFromRaw} {
+		if name != "" {
+			files = append(files, name)
+		}
+	}
+
+	for _, name := range files {
+		fi, err := fs.Stat(name)
+		if err != nil {
+			// the error is reported when the file is read
+			continue
+		}
+
+		last, ok := p[name]
+		p[name] = fi.ModTime()
+		if ok && !last.Equal(fi.ModTime()) {
+			changed = append(changed, name)
+		}
+	}
+
+	return changed
+}
+
+// runBackupSchedule runs the backups at the times given by opts.Schedule until
+// restic is interrupted. A failed backup is reported, the next one is run as
+// scheduled.
+func runBackupSchedule(opts BackupOptions, gopts GlobalOptions, args []string) (err error) {
+	sched, err := cron.Parse(opts.Schedule)
+	if err != nil {
+		return errors.Fatalf("invalid value for --schedule: %v", err)
+	}
+
+	if gopts.Repo == "" {
+		return errors.Fatal("Please specify repository location (-r)")
+	}
+
+	if opts.Forget.Prune {
+		if err = verifyPruneOptions(&opts.Forget.PruneOptions); err != nil {
+			return err
+		}
+	}
+
+	// nobody is there to enter the password for each backup
+	gopts.password, err = ReadPassword(gopts, "enter password for repository: ")
+	if err != nil {
+		return err
+	}
+
+	unlock, err := lockSchedule(gopts)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	// the metrics are served for all backups, not only while one is running
+	stopMetrics, err := serveMetrics(opts.MetricsListen)
+	if err != nil {
+		return err
+	}
+	defer stopMetrics()
+	opts.MetricsListen = ""
+
+	status := &scheduleStatus{Schedule: sched.String()}
+	stopStatus, err := serveStatus(opts.StatusListen, status)
+	if err != nil {
+		return err
+	}
+	defer stopStatus()
+
+	files := patternFiles{}
+	files.changed(opts)
+
+	for {
+		next := sched.Next(time.Now())
+		if next.IsZero() {
+			return errors.Fatalf("the schedule %q never runs a backup", sched)
+		}
+
+		status.setNext(next)
+		Verbosef("next backup at %v\n", next.Format(TimeFormat))
+
+		if err = waitUntil(gopts.ctx, next); err != nil {
+			return err
+		}
+
+		debug.Log("starting scheduled backup")
+		status.start()
+		jobMetrics.reset()
+
+		for _, name := range files.changed(opts) {
+			Verbosef("%v has changed, reloading\n", name)
+		}
+
+		err = runBackup(opts, gopts, args)
+		if err == nil {
+			err = forgetScheduled(opts, gopts, args)
+		}
+
+		status.finish(jobMetrics.snapshot(), err)
+		if err != nil {
+			Warnf("scheduled backup failed: %v\n", err)
+		}
+	}
+}
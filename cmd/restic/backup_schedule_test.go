@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestLockSchedule(t *testing.T) {
+	dir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+
+	gopts := GlobalOptions{Repo: "/srv/restic-repo", CacheDir: dir}
+
+	unlock, err := lockSchedule(gopts)
+	rtest.OK(t, err)
+
+	_, err = lockSchedule(gopts)
+	rtest.Assert(t, err != nil, "expected error for a second process")
+
+	// another repository can be used at the same time
+	unlockOther, err := lockSchedule(GlobalOptions{Repo: "/srv/other-repo", CacheDir: dir})
+	rtest.OK(t, err)
+	unlockOther()
+
+	unlock()
+
+	unlock, err = lockSchedule(gopts)
+	rtest.OK(t, err)
+	unlock()
+}
+
+func TestScheduleStatus(t *testing.T) {
+	status := &scheduleStatus{Schedule: "0 3 * * *"}
+	srv := httptest.NewServer(status)
+	defer srv.Close()
+
+	get := func() *scheduleStatus {
+		res := &scheduleStatus{}
+		resp, err := http.Get(srv.URL)
+		rtest.OK(t, err)
+		rtest.OK(t, json.NewDecoder(resp.Body).Decode(res))
+		rtest.OK(t, resp.Body.Close())
+		return res
+	}
+
+	status.setNext(time.Now().Add(time.Hour))
+	res := get()
+	rtest.Equals(t, "0 3 * * *", res.Schedule)
+	rtest.Assert(t, res.NextRun != nil, "next run not set")
+
+	status.start()
+	res = get()
+	rtest.Assert(t, res.Running, "backup not reported as running")
+	rtest.Assert(t, res.NextRun == nil, "next run set while running")
+
+	id := restic.NewRandomID()
+	status.finish(&id, nil)
+	status.start()
+	status.finish(&id, errors.New("repository not found"))
+
+	res = get()
+	rtest.Assert(t, !res.Running, "backup still reported as running")
+	rtest.Equals(t, uint(2), res.Runs)
+	rtest.Equals(t, uint(1), res.Failures)
+	rtest.Equals(t, "repository not found", res.LastError)
+	rtest.Equals(t, id, *res.LastSnapshotID)
+}
+
+func TestPatternFilesChanged(t *testing.T) {
+	dir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+
+	excludes := filepath.Join(dir, "excludes")
+	list := filepath.Join(dir, "files")
+	rtest.OK(t, ioutil.WriteFile(excludes, []byte("*.go\n"), 0600))
+	rtest.OK(t, ioutil.WriteFile(list, []byte("/home\n"), 0600))
+
+	opts := BackupOptions{ExcludeFiles: []string{excludes}, FilesFrom: list}
+	files := patternFiles{}
+	rtest.Equals(t, []string(nil), files.changed(opts))
+	rtest.Equals(t, []string(nil), files.changed(opts))
+
+	later := time.Now().Add(time.Minute)
+	rtest.OK(t, os.Chtimes(excludes, later, later))
+	rtest.Equals(t, []string{excludes}, files.changed(opts))
+	rtest.Equals(t, []string(nil), files.changed(opts))
+
+	// the changed patterns are used for the next backup
+	rtest.OK(t, ioutil.WriteFile(excludes, []byte("*.c\n"), 0600))
+	rules, _, err := collectRejectRules(opts, nil)
+	rtest.OK(t, err)
+	rtest.Equals(t, `--exclude "*.c"`, rules[0].String())
+}
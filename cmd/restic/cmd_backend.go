@@ -0,0 +1,317 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+
+	"github.com/spf13/cobra"
+)
+
+var cmdBackend = &cobra.Command{
+	Use:   "backend",
+	Short: "Diagnose the backend of the repository",
+	Long: `
+The "backend" command contains subcommands to diagnose the storage service a
+repository is stored in. "backend test" checks that the backend works as
+restic expects it to.
+`,
+	DisableAutoGenTag: true,
+}
+
+var cmdBackendTest = &cobra.Command{
+	Use:   "test [flags]",
+	Short: "Test the backend and print a report",
+	Long: `
+The "backend test" command saves a probe file in the location given with
+--repo (and --cold-repo), reads it back completely and partially, lists and
+removes it. It prints the latency and the throughput of the backend and
+whether all operations worked as expected. The repository itself is neither
+opened nor changed, it does not even have to be initialized, so the command
+can be used to validate the settings for a backend before trusting it with
+backups.
+
+The probe file is stored as a data file with a random name. If the command is
+interrupted before the file is removed, "prune" removes it later.
+`,
+	DisableAutoGenTag: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runBackendTest(backendTestOptions, globalOptions)
+	},
+}
+
+// BackendTestOptions collects all options for the backend test command.
+type BackendTestOptions struct {
+	Size     string
+	Requests int
+}
+
+var backendTestOptions BackendTestOptions
+
+func init() {
+	cmdRoot.AddCommand(cmdBackend)
+	cmdBackend.AddCommand(cmdBackendTest)
+
+	f := cmdBackendTest.Flags()
+	f.StringVar(&backendTestOptions.Size, "size", "4M", "`size` of the probe file")
+	f.IntVar(&backendTestOptions.Requests, "requests", 5, "`number` of requests used to measure the latency")
+}
+
+// backendTestResult is the result of a single step of the backend test.
+type backendTestResult struct {
+	Step     string
+	Info     string
+	Bytes    uint64
+	Duration time.Duration
+	Err      error
+}
+
+func (res backendTestResult) String() string {
+	if res.Err != nil {
+		return fmt.Sprintf("FAILED: %v", res.Err)
+	}
+
+	s := "ok"
+	if res.Bytes > 0 {
+		s += fmt.Sprintf(", %v in %v (%v)", formatBytes(res.Bytes),
+			res.Duration/time.Millisecond*time.Millisecond, formatRate(res.Bytes, res.Duration))
+	}
+	if res.Info != "" {
+		s += ", " + res.Info
+	}
+	return s
+}
+
+// errProbeFound stops listing the files once the probe file has been found.
+var errProbeFound = errors.New("probe file found")
+
+// testBackend runs the steps of the backend test with a probe file containing
+// data. It stops after the first step which is required by the following ones
+// has failed. The latency is measured with requests requests.
+func testBackend(ctx context.Context, be restic.Backend, data []byte, requests int) (results []backendTestResult) {
+	h := restic.Handle{Type: restic.DataFile, Name: restic.Hash(data).String()}
+
+	step := func(name string, fn func(res *backendTestResult) error) bool {
+		res := backendTestResult{Step: name}
+		start := time.Now()
+		res.Err = fn(&res)
+		res.Duration = time.Since(start)
+		debug.Log("step %v: %v", name, res)
+
+		results = append(results, res)
+		return res.Err == nil
+	}
+
+	ok := step("save", func(res *backendTestResult) error {
+		res.Bytes = uint64(len(data))
+		return be.Save(ctx, h, restic.NewByteReader(data))
+	})
+	if !ok {
+		return results
+	}
+
+	removed := false
+	defer func() {
+		if !removed {
+			if err := be.Remove(ctx, h); err != nil {
+				Warnf("unable to remove probe file %v: %v\n", h, err)
+			}
+		}
+	}()
+
+	step("stat", func(res *backendTestResult) error {
+		var min, max, sum time.Duration
+		for i := 0; i < requests; i++ {
+			start := time.Now()
+			fi, err := be.Stat(ctx, h)
+			if err != nil {
+				return err
+			}
+			latency := time.Since(start)
+
+			if fi.Size != int64(len(data)) {
+				return errors.Errorf("wrong size %d reported, want %d", fi.Size, len(data))
+			}
+
+			if i == 0 || latency < min {
+				min = latency
+			}
+			if latency > max {
+				max = latency
+			}
+			sum += latency
+		}
+
+		if requests > 0 {
+			res.Info = fmt.Sprintf("latency %v (min %v, max %v)",
+				sum/time.Duration(requests)/time.Microsecond*time.Microsecond,
+				min/time.Microsecond*time.Microsecond, max/time.Microsecond*time.Microsecond)
+		}
+		return nil
+	})
+
+	step("list", func(res *backendTestResult) error {
+		files := 0
+		err := be.List(ctx, restic.DataFile, func(fi restic.FileInfo) error {
+			files++
+			if fi.Name == h.Name {
+				return errProbeFound
+			}
+			return nil
+		})
+
+		switch {
+		case err == errProbeFound:
+			res.Info = fmt.Sprintf("probe file found after %d files", files)
+			return nil
+		case err != nil:
+			return err
+		default:
+			return errors.Errorf("probe file not found in %d files", files)
+		}
+	})
+
+	step("load", func(res *backendTestResult) error {
+		buf, err := loadProbe(ctx, be, h, 0, 0)
+		if err != nil {
+			return err
+		}
+
+		res.Bytes = uint64(len(buf))
+		if !bytes.Equal(buf, data) {
+			return errors.New("returned data does not match the probe file")
+		}
+		return nil
+	})
+
+	step("range", func(res *backendTestResult) error {
+		length := 4096
+		if length > len(data)/2 {
+			length = len(data) / 2
+		}
+		offset := len(data) / 3
+
+		buf, err := loadProbe(ctx, be, h, length, int64(offset))
+		if err != nil {
+			return err
+		}
+
+		if !bytes.Equal(buf, data[offset:offset+length]) {
+			return errors.Errorf("returned %d bytes do not match the requested %d bytes at offset %d", len(buf), length, offset)
+		}
+
+		res.Info = fmt.Sprintf("read %d bytes at offset %d", length, offset)
+		return nil
+	})
+
+	removed = step("remove", func(res *backendTestResult) error {
+		if err := be.Remove(ctx, h); err != nil {
+			return err
+		}
+
+		found, err := be.Test(ctx, h)
+		if err != nil {
+			return err
+		}
+		if found {
+			return errors.New("probe file still exists after removing it")
+		}
+		return nil
+	})
+
+	if lc, ok := lifecycleChecker(be); ok {
+		step("lifecycle", func(res *backendTestResult) error {
+			problems, err := lc.CheckLifecycle(ctx)
+			if err != nil {
+				return err
+			}
+
+			if len(problems) > 0 {
+				return errors.Errorf("rules which delete or hide files found:\n    %v", strings.Join(problems, "\n    "))
+			}
+
+			res.Info = "no rules delete or hide files"
+			return nil
+		})
+	}
+
+	return results
+}
+
+// loadProbe reads length bytes at offset from the file h.
+func loadProbe(ctx context.Context, be restic.Backend, h restic.Handle, length int, offset int64) ([]byte, error) {
+	rd, err := be.Load(ctx, h, length, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	buf, err := ioutil.ReadAll(rd)
+	if err != nil {
+		_ = rd.Close()
+		return nil, errors.Wrap(err, "ReadAll")
+	}
+
+	return buf, rd.Close()
+}
+
+func runBackendTest(opts BackendTestOptions, gopts GlobalOptions) error {
+	if gopts.Repo == "" {
+		return errors.Fatal("Please specify repository location (-r)")
+	}
+
+	size, err := parseSize(opts.Size)
+	if err != nil {
+		return errors.Fatalf("invalid value for --size: %v", err)
+	}
+	if size < 2 {
+		return errors.Fatal("the probe file must be at least 2 bytes large")
+	}
+
+	if opts.Requests < 1 {
+		return errors.Fatal("--requests must be positive")
+	}
+
+	locations := []string{gopts.Repo}
+	if gopts.ColdRepo != "" {
+		locations = append(locations, gopts.ColdRepo)
+	}
+
+	data := make([]byte, size)
+	if _, err = rand.Read(data); err != nil {
+		return errors.Wrap(err, "rand.Read")
+	}
+
+	failed := false
+	for _, loc := range locations {
+		be, err := openBackend(loc, gopts, gopts.extended, nil)
+		if err != nil {
+			return err
+		}
+
+		Printf("testing backend %v\n", be.Location())
+		for _, res := range testBackend(gopts.ctx, be, data, opts.Requests) {
+			Printf("  %-10s %v\n", res.Step, res)
+			if res.Err != nil {
+				failed = true
+			}
+		}
+
+		if err = be.Close(); err != nil {
+			Warnf("unable to close backend: %v\n", err)
+		}
+	}
+
+	if failed {
+		return errors.Fatal("the backend does not work as expected")
+	}
+
+	return nil
+}
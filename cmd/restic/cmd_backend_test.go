@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/backend/mem"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+// noRangeBackend ignores the length and offset when loading files, like an
+// HTTP server which does not support range requests.
+type noRangeBackend struct {
+	restic.Backend
+}
+
+func (be noRangeBackend) Load(ctx context.Context, h restic.Handle, length int, offset int64) (io.ReadCloser, error) {
+	return be.Backend.Load(ctx, h, 0, 0)
+}
+
+func countFiles(t testing.TB, be restic.Backend) (n int) {
+	rtest.OK(t, be.List(context.TODO(), restic.DataFile, func(restic.FileInfo) error {
+		n++
+		return nil
+	}))
+	return n
+}
+
+func TestTestBackend(t *testing.T) {
+	data := rtest.Random(23, 100*1024)
+
+	be := mem.New()
+	rtest.OK(t, be.Save(context.TODO(), restic.Handle{Type: restic.DataFile, Name: restic.NewRandomID().String()},
+		restic.NewByteReader([]byte("foo"))))
+
+	var steps []string
+	for _, res := range testBackend(context.TODO(), be, data, 3) {
+		rtest.OK(t, res.Err)
+		steps = append(steps, res.Step)
+	}
+	rtest.Equals(t, []string{"save", "stat", "list", "load", "range", "remove"}, steps)
+	rtest.Equals(t, 1, countFiles(t, be))
+
+	// the probe file is removed even if a step fails
+	failed := map[string]bool{}
+	for _, res := range testBackend(context.TODO(), noRangeBackend{be}, data, 1) {
+		failed[res.Step] = res.Err != nil
+	}
+	rtest.Equals(t, map[string]bool{"save": false, "stat": false, "list": false, "load": false, "range": true, "remove": false}, failed)
+	rtest.Equals(t, 1, countFiles(t, be))
+}
+
+// failingSaveBackend cannot save any files.
+type failingSaveBackend struct {
+	restic.Backend
+}
+
+func (be failingSaveBackend) Save(ctx context.Context, h restic.Handle, rd restic.RewindReader) error {
+	return errors.New("save failed")
+}
+
+func TestTestBackendSaveError(t *testing.T) {
+	results := testBackend(context.TODO(), failingSaveBackend{mem.New()}, []byte("probe data"), 1)
+	rtest.Equals(t, 1, len(results))
+	rtest.Equals(t, "save", results[0].Step)
+	rtest.Assert(t, results[0].Err != nil, "expected error for failed save")
+}
+
+func TestTestBackendLifecycle(t *testing.T) {
+	data := []byte("probe data")
+
+	// openBackend wraps the backend for the timeout, the lifecycle rules are
+	// checked on the wrapped backend
+	be := newTimeoutBackend(lifecycleBackend{Backend: mem.New()}, time.Minute)
+	results := testBackend(context.TODO(), be, data, 1)
+	last := results[len(results)-1]
+	rtest.Equals(t, "lifecycle", last.Step)
+	rtest.OK(t, last.Err)
+
+	be = newTimeoutBackend(lifecycleBackend{
+		Backend:  mem.New(),
+		problems: []string{`lifecycle rule "expire" for prefix "" deletes expired files`},
+	}, time.Minute)
+	results = testBackend(context.TODO(), be, data, 1)
+	last = results[len(results)-1]
+	rtest.Equals(t, "lifecycle", last.Step)
+	rtest.Assert(t, last.Err != nil, "expected error for a lifecycle rule")
+}
@@ -1,21 +1,30 @@
 package main
 
 import (
-	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"os"
 	"path"
 	"path/filepath"
+	"runtime"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 
 	"github.com/restic/restic/internal/archiver"
 	"github.com/restic/restic/internal/debug"
 	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/filter"
 	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/progress"
+	"github.com/restic/restic/internal/repository"
 	"github.com/restic/restic/internal/restic"
 )
 
@@ -38,10 +47,49 @@ given as the arguments.
 	},
 	DisableAutoGenTag: true,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		if backupOptions.Stdin && backupOptions.FilesFrom == "-" {
+		if backupOptions.Stdin && backupOptions.filesFromStdin() {
 			return errors.Fatal("cannot use both `--stdin` and `--files-from -`")
 		}
 
+		if backupOptions.Stdin && backupOptions.SkipIfUnchanged {
+			return errors.Fatal("cannot use both `--stdin` and `--skip-if-unchanged`")
+		}
+
+		if backupOptions.Stdin && backupOptions.ChangesFile != "" {
+			return errors.Fatal("cannot use both `--stdin` and `--changes-file`")
+		}
+
+		if backupOptions.Stdin && backupOptions.UseFsSnapshot {
+			return errors.Fatal("cannot use both `--stdin` and `--use-fs-snapshot`")
+		}
+
+		if backupOptions.UseFsSnapshot && runtime.GOOS != "windows" {
+			return errors.Fatal("`--use-fs-snapshot` is only supported on Windows")
+		}
+
+		switch backupOptions.Concurrent {
+		case "wait", "abort", "allow":
+		default:
+			return errors.Fatalf("invalid value %q for --concurrent, must be \"wait\", \"abort\" or \"allow\"", backupOptions.Concurrent)
+		}
+
+		if backupOptions.Schedule == "" {
+			if !backupOptions.Forget.policy().Empty() || backupOptions.Forget.Prune {
+				return errors.Fatal("the --keep-* options and --prune require --schedule, use forget after the backup instead")
+			}
+			if backupOptions.StatusListen != "" {
+				return errors.Fatal("--status-listen requires --schedule")
+			}
+		}
+
+		if backupOptions.Schedule != "" {
+			if backupOptions.Stdin || backupOptions.filesFromStdin() {
+				return errors.Fatal("cannot read from stdin with `--schedule`")
+			}
+
+			return runBackupSchedule(backupOptions, globalOptions, args)
+		}
+
 		if backupOptions.Stdin {
 			return readBackupFromStdin(backupOptions, globalOptions, args)
 		}
@@ -52,164 +100,260 @@ given as the arguments.
 
 // BackupOptions bundles all options for the backup command.
 type BackupOptions struct {
-	Parent           string
-	Force            bool
-	Excludes         []string
-	ExcludeFiles     []string
-	ExcludeOtherFS   bool
-	ExcludeIfPresent []string
-	ExcludeCaches    bool
-	Stdin            bool
-	StdinFilename    string
-	Tags             []string
-	Hostname         string
-	FilesFrom        string
-	TimeStamp        string
-	WithAtime        bool
+	Parent                  string
+	Force                   bool
+	IgnoreInode             bool
+	IgnoreCtime             bool
+	Excludes                []string
+	ExcludeFiles            []string
+	InsensitiveExcludes     []string
+	InsensitiveExcludeFiles []string
+	ExcludeOtherFS          bool
+	ExcludeIfPresent        []string
+	ExcludeCaches           bool
+	NoAutoExclude           bool
+	IncludeOwner            []string
+	ExcludeOwner            []string
+	IncludeXattr            []string
+	ExcludeXattr            []string
+	NewerThan               string
+	OlderThan               string
+	ExcludeLargerThan       string
+	Stdin                   bool
+	StdinFilename           string
+	Tags                    []string
+	Labels                  restic.Labels
+	Hostname                string
+	FilesFrom               string
+	FilesFromVerbatim       string
+	FilesFromRaw            string
+	TimeStamp               string
+	WithAtime               bool
+	RetryChanged            int
+
+	CheckpointInterval time.Duration
+	CheckpointSize     uint
+	SkipIfUnchanged    bool
+	NoResume           bool
+	Concurrent         string
+	ChangesFile        string
+	ProfileReport      bool
+	UseFsSnapshot      bool
+
+	IgnoreLifecycleRules bool
+	MetricsListen        string
+
+	Schedule     string
+	StatusListen string
+	Forget       ForgetOptions
+
+	PreCommand         string
+	PostCommand        string
+	PostSuccessCommand string
+	PostFailureCommand string
 }
 
 var backupOptions BackupOptions
 
+// filesFromStdin returns true if one of the files-from options reads from
+// stdin.
+func (opts BackupOptions) filesFromStdin() bool {
+	return opts.FilesFrom == "-" || opts.FilesFromVerbatim == "-" || opts.FilesFromRaw == "-"
+}
+
 func init() {
 	cmdRoot.AddCommand(cmdBackup)
 
 	f := cmdBackup.Flags()
 	f.StringVar(&backupOptions.Parent, "parent", "", "use this parent snapshot (default: last snapshot in the repo that has the same target files/directories)")
 	f.BoolVarP(&backupOptions.Force, "force", "f", false, `force re-reading the target files/directories (overrides the "parent" flag)`)
-	f.StringArrayVarP(&backupOptions.Excludes, "exclude", "e", nil, "exclude a `pattern` (can be specified multiple times)")
-	f.StringArrayVar(&backupOptions.ExcludeFiles, "exclude-file", nil, "read exclude patterns from a `file` (can be specified multiple times)")
-	f.BoolVarP(&backupOptions.ExcludeOtherFS, "one-file-system", "x", false, "exclude other file systems")
-	f.StringArrayVar(&backupOptions.ExcludeIfPresent, "exclude-if-present", nil, "takes filename[:header], exclude contents of directories containing filename (except filename itself) if header of that file is as provided (can be specified multiple times)")
-	f.BoolVar(&backupOptions.ExcludeCaches, "exclude-caches", false, `excludes cache directories that are marked with a CACHEDIR.TAG file`)
+	f.BoolVar(&backupOptions.IgnoreInode, "ignore-inode", false, "ignore inode number changes when checking for modified files")
+	f.BoolVar(&backupOptions.IgnoreCtime, "ignore-ctime", false, "ignore ctime changes when checking for modified files")
+	addExcludeFlags(f, &backupOptions)
+	f.StringArrayVar(&backupOptions.IncludeXattr, "include-xattr", nil, "only save extended attributes whose name matches `pattern` (can be specified multiple times)")
+	f.StringArrayVar(&backupOptions.ExcludeXattr, "exclude-xattr", nil, "do not save extended attributes whose name matches `pattern` (can be specified multiple times)")
 	f.BoolVar(&backupOptions.Stdin, "stdin", false, "read backup from stdin")
 	f.StringVar(&backupOptions.StdinFilename, "stdin-filename", "stdin", "file name to use when reading from stdin")
 	f.StringArrayVar(&backupOptions.Tags, "tag", nil, "add a `tag` for the new snapshot (can be specified multiple times)")
+	f.Var(&backupOptions.Labels, "label", "add a label in the format `key=value` to the new snapshot (can be specified multiple times)")
 	f.StringVar(&backupOptions.Hostname, "hostname", "", "set the `hostname` for the snapshot manually. To prevent an expensive rescan use the \"parent\" flag")
 	f.StringVar(&backupOptions.FilesFrom, "files-from", "", "read the files to backup from file (can be combined with file args)")
+	f.StringVar(&backupOptions.FilesFromVerbatim, "files-from-verbatim", "", "read the files to backup from `file`, one per line, without skipping comments (can be combined with file args)")
+	f.StringVar(&backupOptions.FilesFromRaw, "files-from-raw", "", "read the files to backup from `file`, separated by null bytes (can be combined with file args)")
 	f.StringVar(&backupOptions.TimeStamp, "time", "", "time of the backup (ex. '2012-11-01 22:08:41') (default: now)")
 	f.BoolVar(&backupOptions.WithAtime, "with-atime", false, "store the atime for all files and directories")
+	f.IntVar(&backupOptions.RetryChanged, "retry-changed", 0, "read files which are modified during the backup again up to `n` times")
+	f.DurationVar(&backupOptions.CheckpointInterval, "checkpoint-interval", archiver.DefaultCheckpointInterval, "upload open packs and save the index every `duration`, so an interrupted backup can reuse the data (0 disables)")
+	f.UintVar(&backupOptions.CheckpointSize, "checkpoint-size", archiver.DefaultCheckpointSize>>20, "upload open packs and save the index after `MiB` of new data (0 disables)")
+	f.BoolVar(&backupOptions.SkipIfUnchanged, "skip-if-unchanged", false, "do not save a new snapshot if nothing has changed since the parent snapshot")
+	f.BoolVar(&backupOptions.NoResume, "no-resume", false, "do not reuse the files saved by an interrupted backup of the same paths")
+	f.StringVar(&backupOptions.Concurrent, "concurrent", "wait", "what to do when a backup of the same paths is already running on this host: `mode` \"wait\", \"abort\" or \"allow\"")
+	f.StringVar(&backupOptions.ChangesFile, "changes-file", "", "write the items added, modified and removed since the parent snapshot to `file`, one JSON object per line")
+	f.BoolVar(&backupOptions.ProfileReport, "profile-report", false, "print the time spent scanning, reading, chunking, hashing, encrypting, uploading and indexing at the end")
+	f.BoolVar(&backupOptions.UseFsSnapshot, "use-fs-snapshot", false, "read the files from a shadow copy of their volumes, so that files which are in use are saved consistently (Windows only, requires administrator privileges)")
+	f.BoolVar(&backupOptions.IgnoreLifecycleRules, "ignore-lifecycle-rules", false, "back up even if the bucket has lifecycle rules which delete or hide files of the repository")
+	f.StringVar(&backupOptions.MetricsListen, "metrics-listen", "", "serve metrics for Prometheus at `address`/metrics while the backup is running, use unix:/path for a unix socket")
+
+	f.StringVar(&backupOptions.Schedule, "schedule", "", "keep running and back up at the times given by the cron `expression`, e.g. \"0 3 * * *\"")
+	f.StringVar(&backupOptions.StatusListen, "status-listen", "", "for --schedule, serve the status as JSON at `address`/status, use unix:/path for a unix socket")
+	f.IntVar(&backupOptions.Forget.Last, "keep-last", 0, "for --schedule, keep the last `n` snapshots of the paths after each backup")
+	f.IntVar(&backupOptions.Forget.Hourly, "keep-hourly", 0, "for --schedule, keep the last `n` hourly snapshots of the paths after each backup")
+	f.IntVar(&backupOptions.Forget.Daily, "keep-daily", 0, "for --schedule, keep the last `n` daily snapshots of the paths after each backup")
+	f.IntVar(&backupOptions.Forget.Weekly, "keep-weekly", 0, "for --schedule, keep the last `n` weekly snapshots of the paths after each backup")
+	f.IntVar(&backupOptions.Forget.Monthly, "keep-monthly", 0, "for --schedule, keep the last `n` monthly snapshots of the paths after each backup")
+	f.IntVar(&backupOptions.Forget.Yearly, "keep-yearly", 0, "for --schedule, keep the last `n` yearly snapshots of the paths after each backup")
+	f.Var(&backupOptions.Forget.Within, "keep-within", "for --schedule, keep the snapshots of the paths that are newer than `duration` (eg. 1y5m7d2h) after each backup")
+	f.BoolVar(&backupOptions.Forget.Prune, "prune", false, "for --schedule, run prune after snapshots have been removed")
+
+	f.StringVar(&backupOptions.PreCommand, "pre-command", "", "run `command` before the backup, the backup is aborted if it fails")
+	f.StringVar(&backupOptions.PostCommand, "post-command", "", "run `command` after the backup, whether it succeeded or not")
+	f.StringVar(&backupOptions.PostSuccessCommand, "post-success-command", "", "run `command` after a successful backup")
+	f.StringVar(&backupOptions.PostFailureCommand, "post-failure-command", "", "run `command` after a failed backup")
 }
 
-func newScanProgress(gopts GlobalOptions) *restic.Progress {
-	if gopts.Quiet {
-		return nil
-	}
-
-	p := restic.NewProgress()
-	p.OnUpdate = func(s restic.Stat, d time.Duration, ticker bool) {
-		if IsProcessBackground() {
-			return
-		}
-
-		PrintProgress("[%s] %d directories, %d files, %s", formatDuration(d), s.Dirs, s.Files, formatBytes(s.Bytes))
-	}
-
-	p.OnDone = func(s restic.Stat, d time.Duration, ticker bool) {
-		PrintProgress("scanned %d directories, %d files in %s\n", s.Dirs, s.Files, formatDuration(d))
-	}
-
-	return p
+// addExcludeFlags adds the options which select the files of a backup to f,
+// they are shared with the filter-test command.
+func addExcludeFlags(f *pflag.FlagSet, opts *BackupOptions) {
+	f.StringArrayVarP(&opts.Excludes, "exclude", "e", nil, "exclude a `pattern` (can be specified multiple times)")
+	f.StringArrayVar(&opts.ExcludeFiles, "exclude-file", nil, "read exclude patterns from a `file` (can be specified multiple times)")
+	f.StringArrayVar(&opts.InsensitiveExcludes, "iexclude", nil, "same as --exclude but ignores the case of file names in `pattern`")
+	f.StringArrayVar(&opts.InsensitiveExcludeFiles, "iexclude-file", nil, "same as --exclude-file but ignores the case of file names in the patterns read from `file`")
+	f.BoolVarP(&opts.ExcludeOtherFS, "one-file-system", "x", false, "exclude other file systems")
+	f.StringArrayVar(&opts.ExcludeIfPresent, "exclude-if-present", nil, "takes filename[:header], exclude contents of directories containing filename (except filename itself) if header of that file is as provided (can be specified multiple times)")
+	f.BoolVar(&opts.ExcludeCaches, "exclude-caches", false, `excludes cache directories that are marked with a CACHEDIR.TAG file`)
+	f.BoolVar(&opts.NoAutoExclude, "no-auto-exclude", false, "do not exclude restic repositories and the restic cache directory")
+	f.StringArrayVar(&opts.IncludeOwner, "include-owner", nil, "only include files owned by `user[:group]` (can be specified multiple times)")
+	f.StringArrayVar(&opts.ExcludeOwner, "exclude-owner", nil, "exclude files owned by `user[:group]` (can be specified multiple times)")
+	f.StringVar(&opts.NewerThan, "newer-than", "", "only include files modified after `time` (e.g. '2012-11-01', '7d' or '36h')")
+	f.StringVar(&opts.OlderThan, "older-than", "", "only include files modified before `time` (e.g. '2012-11-01', '7d' or '36h')")
+	f.StringVar(&opts.ExcludeLargerThan, "exclude-larger-than", "", "exclude files larger than `size` (e.g. '500M' or '2G')")
 }
 
-func newArchiveProgress(gopts GlobalOptions, todo restic.Stat) *restic.Progress {
-	if gopts.Quiet {
-		return nil
-	}
-
-	archiveProgress := restic.NewProgress()
+// concurrentBackupCheckInterval is the interval in which the locks of other
+// backups are checked while waiting for them to finish.
+var concurrentBackupCheckInterval = 10 * time.Second
 
-	var bps, eta uint64
-	itemsTodo := todo.Files + todo.Dirs
+// waitForConcurrentBackups looks for backups of the same paths on this host
+// which were started before this one, using the locks in the repository.
+// Depending on mode, an error is returned ("abort") or it waits until they
+// have finished ("wait"). It returns true if it has waited.
+func waitForConcurrentBackups(gopts GlobalOptions, lock *restic.Lock, mode string) (bool, error) {
+	if mode == "allow" {
+		return false, nil
+	}
 
-	archiveProgress.OnUpdate = func(s restic.Stat, d time.Duration, ticker bool) {
-		if IsProcessBackground() {
-			return
+	waited := false
+	for {
+		locks, err := lock.Concurrent(gopts.ctx)
+		if err != nil {
+			return waited, err
 		}
 
-		sec := uint64(d / time.Second)
-		if todo.Bytes > 0 && sec > 0 && ticker {
-			bps = s.Bytes / sec
-			if s.Bytes >= todo.Bytes {
-				eta = 0
-			} else if bps > 0 {
-				eta = (todo.Bytes - s.Bytes) / bps
-			}
+		if len(locks) == 0 {
+			return waited, nil
 		}
 
-		itemsDone := s.Files + s.Dirs
-
-		status1 := fmt.Sprintf("[%s] %s  %s/s  %s / %s  %d / %d items  %d errors  ",
-			formatDuration(d),
-			formatPercent(s.Bytes, todo.Bytes),
-			formatBytes(bps),
-			formatBytes(s.Bytes), formatBytes(todo.Bytes),
-			itemsDone, itemsTodo,
-			s.Errors)
-		status2 := fmt.Sprintf("ETA %s ", formatSeconds(eta))
-
-		if w := stdoutTerminalWidth(); w > 0 {
-			maxlen := w - len(status2) - 1
+		if mode == "abort" {
+			return false, errors.Fatalf("a backup of the same paths is already running, lock held by %v", locks[0])
+		}
 
-			if maxlen < 4 {
-				status1 = ""
-			} else if len(status1) > maxlen {
-				status1 = status1[:maxlen-4]
-				status1 += "... "
-			}
+		if !waited {
+			Verbosef("a backup of the same paths is already running (PID %d), waiting for it to finish\n", locks[0].PID)
 		}
+		waited = true
 
-		PrintProgress("%s%s", status1, status2)
+		select {
+		case <-gopts.ctx.Done():
+			return waited, gopts.ctx.Err()
+		case <-time.After(concurrentBackupCheckInterval):
+		}
 	}
+}
 
-	archiveProgress.OnDone = func(s restic.Stat, d time.Duration, ticker bool) {
-		fmt.Printf("\nduration: %s, %s\n", formatDuration(d), formatRate(todo.Bytes, d))
+// resumeFilename returns the name of the file in the cache in which the
+// progress of a backup of target from hostname is recorded.
+func resumeFilename(repo *repository.Repository, hostname string, target []string) string {
+	paths := make([]string, len(target))
+	copy(paths, target)
+	sort.Strings(paths)
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n", hostname)
+	for _, p := range paths {
+		fmt.Fprintf(h, "%s\n", p)
 	}
 
-	return archiveProgress
+	return filepath.Join(repo.Cache.BaseDir(), repo.Config().ID, "resume", hex.EncodeToString(h.Sum(nil)))
 }
 
-func newArchiveStdinProgress(gopts GlobalOptions) *restic.Progress {
-	if gopts.Quiet {
+func newScanProgress(gopts GlobalOptions) *restic.Progress {
+	if gopts.Quiet || gopts.JSON {
 		return nil
 	}
 
-	archiveProgress := restic.NewProgress()
-
-	var bps uint64
-
-	archiveProgress.OnUpdate = func(s restic.Stat, d time.Duration, ticker bool) {
-		if IsProcessBackground() {
-			return
-		}
-
-		sec := uint64(d / time.Second)
-		if s.Bytes > 0 && sec > 0 && ticker {
-			bps = s.Bytes / sec
-		}
-
-		status1 := fmt.Sprintf("[%s] %s  %s/s", formatDuration(d),
-			formatBytes(s.Bytes),
-			formatBytes(bps))
-
-		if w := stdoutTerminalWidth(); w > 0 {
-			maxlen := w - len(status1)
-
-			if maxlen < 4 {
-				status1 = ""
-			} else if len(status1) > maxlen {
-				status1 = status1[:maxlen-4]
-				status1 += "... "
-			}
-		}
+	return newProgress(gopts, restic.Stat{}, progressOptions{
+		Format: func(s progress.Status) string {
+			return fmt.Sprintf("[%s] %d directories, %d files, %s", formatDuration(s.Elapsed), s.Done.Dirs, s.Done.Files, formatBytes(s.Done.Bytes))
+		},
+		Summary: func(s progress.Status) string {
+			return fmt.Sprintf("scanned %d directories, %d files in %s", s.Done.Dirs, s.Done.Files, formatDuration(s.Elapsed))
+		},
+	})
+}
 
-		PrintProgress("%s", status1)
-	}
+// backupSummary is the JSON message printed when a backup has finished.
+type backupSummary struct {
+	MessageType         string  `json:"message_type"`
+	SnapshotID          string  `json:"snapshot_id"`
+	Unchanged           bool    `json:"unchanged,omitempty"`
+	FilesProcessed      uint64  `json:"total_files_processed"`
+	DirsProcessed       uint64  `json:"total_dirs_processed"`
+	BytesProcessed      uint64  `json:"total_bytes_processed"`
+	DataAdded           uint64  `json:"data_added"`
+	ErrorCount          uint64  `json:"error_count"`
+	ChangedWhileReading int     `json:"changed_while_reading,omitempty"`
+	BackendTimeouts     uint64  `json:"backend_timeouts,omitempty"`
+	LargeFilesSkipped   uint64  `json:"large_files_skipped,omitempty"`
+	LargeBytesSkipped   uint64  `json:"large_bytes_skipped,omitempty"`
+	TotalDuration       float64 `json:"total_duration"`
+
+	Profile []restic.PhaseStat `json:"profile,omitempty"`
+}
 
-	archiveProgress.OnDone = func(s restic.Stat, d time.Duration, ticker bool) {
-		fmt.Printf("\nduration: %s, %s\n", formatDuration(d), formatRate(s.Bytes, d))
-	}
+// newArchiveProgress returns the progress for a backup of todo. When the
+// backup is done, the totals are stored in summary.
+func newArchiveProgress(gopts GlobalOptions, todo restic.Stat, summary *backupSummary) *restic.Progress {
+	return newProgress(gopts, todo, progressOptions{
+		Summary: func(s progress.Status) string {
+			return fmt.Sprintf("duration: %s, %s", formatDuration(s.Elapsed), formatRate(todo.Bytes, s.Elapsed))
+		},
+		Done: func(s progress.Status) {
+			summary.FilesProcessed = s.Done.Files
+			summary.DirsProcessed = s.Done.Dirs
+			summary.BytesProcessed = s.Done.Bytes
+			summary.ErrorCount = s.Done.Errors
+			summary.TotalDuration = s.Elapsed.Seconds()
+		},
+	})
+}
 
-	return archiveProgress
+// newArchiveStdinProgress returns the progress for a backup of data read from
+// stdin, for which the total is unknown.
+func newArchiveStdinProgress(gopts GlobalOptions, summary *backupSummary) *restic.Progress {
+	return newProgress(gopts, restic.Stat{}, progressOptions{
+		Format: func(s progress.Status) string {
+			return fmt.Sprintf("[%s] %s  %s/s", formatDuration(s.Elapsed), formatBytes(s.Done.Bytes), formatBytes(s.BytesPerSecond))
+		},
+		Summary: func(s progress.Status) string {
+			return fmt.Sprintf("duration: %s, %s", formatDuration(s.Elapsed), formatRate(s.Done.Bytes, s.Elapsed))
+		},
+		Done: func(s progress.Status) {
+			summary.FilesProcessed = s.Done.Files
+			summary.BytesProcessed = s.Done.Bytes
+			summary.ErrorCount = s.Done.Errors
+			summary.TotalDuration = s.Elapsed.Seconds()
+		},
+	})
 }
 
 // filterExisting returns a slice of all existing items, or an error if no
@@ -232,7 +376,35 @@ func filterExisting(items []string) (result []string, err error) {
 	return
 }
 
-func readBackupFromStdin(opts BackupOptions, gopts GlobalOptions, args []string) error {
+// findParentSnapshot returns the ID of the snapshot given with --parent, or
+// of the latest snapshot of the targets. It returns nil if there is no such
+// snapshot or --force was given.
+func findParentSnapshot(ctx context.Context, repo *repository.Repository, opts BackupOptions, targets []string) (*restic.ID, error) {
+	if opts.Force {
+		return nil, nil
+	}
+
+	if opts.Parent != "" {
+		id, err := restic.FindSnapshot(repo, opts.Parent)
+		if err != nil {
+			return nil, errors.Fatalf("invalid id %q: %v", opts.Parent, err)
+		}
+
+		return &id, nil
+	}
+
+	id, err := restic.FindLatestSnapshot(ctx, repo, targets, []restic.TagList{}, opts.Hostname)
+	if err == restic.ErrNoSnapshotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &id, nil
+}
+
+func readBackupFromStdin(opts BackupOptions, gopts GlobalOptions, args []string) (err error) {
 	if len(args) != 0 {
 		return errors.Fatal("when reading from stdin, no additional files can be specified")
 	}
@@ -247,14 +419,37 @@ func readBackupFromStdin(opts BackupOptions, gopts GlobalOptions, args []string)
 		return errors.Fatal("filename is invalid (may not contain a directory, slash or backslash)")
 	}
 
-	if gopts.password == "" {
+	if gopts.password == "" && !gopts.InsecureNoPassword {
 		return errors.Fatal("unable to read password from stdin when data is to be read from stdin, use --password-file or $RESTIC_PASSWORD")
 	}
 
+	var timeStamp time.Time
+	if opts.TimeStamp != "" {
+		timeStamp, err = time.Parse(TimeFormat, opts.TimeStamp)
+		if err != nil {
+			return errors.Fatalf("error in time option: %v\n", err)
+		}
+	}
+
+	hooks := newBackupHooks(opts, gopts)
+	defer func() { hooks.post(err) }()
+
+	if err = hooks.pre(); err != nil {
+		return err
+	}
+
+	stopMetrics, err := serveMetrics(opts.MetricsListen)
+	if err != nil {
+		return err
+	}
+	defer stopMetrics()
+
+	gopts.checkLifecycle = !opts.IgnoreLifecycleRules
 	repo, err := OpenRepository(gopts)
 	if err != nil {
 		return err
 	}
+	hooks.repo = repo
 
 	lock, err := lockRepo(repo)
 	defer unlockRepo(lock)
@@ -262,31 +457,65 @@ func readBackupFromStdin(opts BackupOptions, gopts GlobalOptions, args []string)
 		return err
 	}
 
-	err = repo.LoadIndex(gopts.ctx)
+	finish := recordOperation(gopts, repo, "backup")
+	defer func() { finish(err) }()
+
+	err = loadIndex(gopts.ctx, repo)
+	if err != nil {
+		return err
+	}
+
+	if opts.ProfileReport {
+		repo.Profile = restic.NewProfile()
+	}
+	start := time.Now()
+
+	parentSnapshotID, err := findParentSnapshot(gopts.ctx, repo, opts, []string{fn})
 	if err != nil {
 		return err
 	}
 
 	r := &archiver.Reader{
-		Repository: repo,
-		Tags:       opts.Tags,
-		Hostname:   opts.Hostname,
+		Repository:     repo,
+		Tags:           opts.Tags,
+		Labels:         opts.Labels,
+		Hostname:       opts.Hostname,
+		Time:           timeStamp,
+		ProgramVersion: programVersion(),
+		Parent:         parentSnapshotID,
+
+		CheckpointInterval: opts.CheckpointInterval,
+		CheckpointSize:     uint64(opts.CheckpointSize) << 20,
 	}
 
-	_, id, err := r.Archive(gopts.ctx, fn, os.Stdin, newArchiveStdinProgress(gopts))
+	p := newPrinter(gopts)
+	summary := &backupSummary{MessageType: msgSummary}
+
+	_, id, err := r.Archive(gopts.ctx, fn, os.Stdin, newArchiveStdinProgress(gopts, summary))
 	if err != nil {
 		return err
 	}
 
+	jobMetrics.setSnapshot(id)
+	hooks.snapshotID, hooks.summary = &id, summary
 	Verbosef("archived as %v\n", id.Str())
-	return nil
+
+	if gopts.JSON {
+		summary.SnapshotID = id.String()
+		summary.DataAdded = repo.UploadedBytes()
+		summary.BackendTimeouts = jobMetrics.backendTimeouts()
+		summary.Profile = repo.Profile.Phases()
+		p.Message(summary)
+		return nil
+	}
+
+	reportBackendTimeouts()
+	return printProfileReport(gopts.stdout, repo.Profile.Phases(), time.Since(start))
 }
 
-// readFromFile will read all lines from the given filename and write them to a
-// string array, if filename is empty readFromFile returns and empty string
-// array. If filename is a dash (-), readFromFile will read the lines from
-// the standard input.
-func readLinesFromFile(filename string) ([]string, error) {
+// readFilenamesFromFile reads the file names to back up from filename with
+// read, or from stdin if filename is "-". It returns nil if filename is empty.
+func readFilenamesFromFile(filename string, read func(io.Reader) ([]string, error)) ([]string, error) {
 	if filename == "" {
 		return nil, nil
 	}
@@ -301,45 +530,91 @@ func readLinesFromFile(filename string) ([]string, error) {
 		r = f
 	}
 
-	var lines []string
+	return read(r)
+}
 
-	scanner := bufio.NewScanner(r)
-	for scanner.Scan() {
-		line := scanner.Text()
-		// ignore empty lines
-		if line == "" {
-			continue
-		}
-		// strip comments
+// readLinesSkipComments returns the lines read from rd, except empty lines and
+// lines starting with "#".
+func readLinesSkipComments(rd io.Reader) ([]string, error) {
+	lines, err := filter.ReadLines(rd)
+	if err != nil {
+		return nil, err
+	}
+
+	var res []string
+	for _, line := range lines {
 		if strings.HasPrefix(line, "#") {
 			continue
 		}
-		lines = append(lines, line)
-	}
-
-	if err := scanner.Err(); err != nil {
-		return nil, err
+		res = append(res, line)
 	}
 
-	return lines, nil
+	return res, nil
 }
 
-func runBackup(opts BackupOptions, gopts GlobalOptions, args []string) error {
-	if opts.FilesFrom == "-" && gopts.password == "" {
-		return errors.Fatal("unable to read password from stdin when data is to be read from stdin, use --password-file or $RESTIC_PASSWORD")
+// createShadowCopies creates a shadow copy of each volume which contains
+// one of the targets, the files are read from them during the backup.
+// Volumes for which no shadow copy can be created are read directly. The
+// returned function deletes the shadow copies, it is also run when restic is
+// interrupted.
+func createShadowCopies(targets []string) func() {
+	var list []*fs.ShadowCopy
+	seen := make(map[string]bool)
+	for _, target := range targets {
+		volume := strings.ToUpper(filepath.VolumeName(target))
+		if seen[volume] {
+			continue
+		}
+		seen[volume] = true
+
+		Verbosef("creating shadow copy of %v\n", volume)
+		s, err := fs.CreateShadowCopy(volume)
+		if err != nil {
+			Warnf("unable to create shadow copy of %v, reading files directly: %v\n", volume, err)
+			continue
+		}
+		list = append(list, s)
 	}
 
-	fromfile, err := readLinesFromFile(opts.FilesFrom)
-	if err != nil {
-		return err
+	var once sync.Once
+	deleteAll := func() error {
+		once.Do(func() {
+			for _, s := range list {
+				if err := s.Delete(); err != nil {
+					Warnf("%v\n", err)
+				}
+			}
+		})
+		return nil
 	}
+	AddCleanupHandler(deleteAll)
 
+	return func() { _ = deleteAll() }
+}
+
+// backupTargets returns the absolute paths of the files and directories to
+// back up, given as args and in the files-from files. Paths which do not exist
+// are skipped.
+func backupTargets(opts BackupOptions, args []string) ([]string, error) {
 	// merge files from files-from into normal args so we can reuse the normal
 	// args checks and have the ability to use both files-from and args at the
 	// same time
-	args = append(args, fromfile...)
+	for _, from := range []struct {
+		filename string
+		read     func(io.Reader) ([]string, error)
+	}{
+		{opts.FilesFrom, readLinesSkipComments},
+		{opts.FilesFromVerbatim, filter.ReadLines},
+		{opts.FilesFromRaw, filter.ReadNullSeparated},
+	} {
+		fromfile, err := readFilenamesFromFile(from.filename, from.read)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, fromfile...)
+	}
 	if len(args) == 0 {
-		return errors.Fatal("nothing to backup, please specify target files/dirs")
+		return nil, errors.Fatal("nothing to backup, please specify target files/dirs")
 	}
 
 	target := make([]string, 0, len(args))
@@ -350,91 +625,219 @@ func runBackup(opts BackupOptions, gopts GlobalOptions, args []string) error {
 		target = append(target, d)
 	}
 
-	target, err = filterExisting(target)
-	if err != nil {
-		return err
-	}
+	return filterExisting(target)
+}
 
-	// rejectFuncs collect functions that can reject items from the backup
-	var rejectFuncs []RejectFunc
+// rejectRule is a RejectFunc together with the option and its argument
+// (if any) which added it.
+type rejectRule struct {
+	name   string
+	arg    string
+	reject RejectFunc
+}
 
+func (r rejectRule) String() string {
+	if r.arg == "" {
+		return r.name
+	}
+	return fmt.Sprintf("%v %q", r.name, r.arg)
+}
+
+// collectRejectRules returns the rules which reject items from a backup of
+// the targets, it is used by the backup and filter-test commands. Regular
+// files larger than maxSize (if not zero) are rejected by the archiver. The
+// restic cache is not included, its location is only known once the
+// repository has been opened.
+func collectRejectRules(opts BackupOptions, targets []string) (rules []rejectRule, maxSize uint64, err error) {
 	// allowed devices
 	if opts.ExcludeOtherFS {
-		f, err := rejectByDevice(target)
+		f, err := rejectByDevice(targets)
 		if err != nil {
-			return err
+			return nil, 0, err
 		}
-		rejectFuncs = append(rejectFuncs, f)
+		rules = append(rules, rejectRule{name: "--one-file-system", reject: f})
 	}
 
 	// add patterns from file
+	excludes := opts.Excludes
 	if len(opts.ExcludeFiles) > 0 {
-		opts.Excludes = append(opts.Excludes, readExcludePatternsFromFiles(opts.ExcludeFiles)...)
+		excludes = append(excludes, readExcludePatternsFromFiles(opts.ExcludeFiles)...)
+	}
+
+	for _, pattern := range excludes {
+		if pattern == "" {
+			continue
+		}
+
+		rules = append(rules, rejectRule{name: "--exclude", arg: pattern, reject: rejectByPattern([]string{pattern})})
 	}
 
-	if len(opts.Excludes) > 0 {
-		rejectFuncs = append(rejectFuncs, rejectByPattern(opts.Excludes))
+	iexcludes := opts.InsensitiveExcludes
+	if len(opts.InsensitiveExcludeFiles) > 0 {
+		iexcludes = append(iexcludes, readExcludePatternsFromFiles(opts.InsensitiveExcludeFiles)...)
 	}
 
+	for _, pattern := range iexcludes {
+		if pattern == "" {
+			continue
+		}
+
+		rules = append(rules, rejectRule{name: "--iexclude", arg: pattern, reject: rejectByInsensitivePattern([]string{pattern})})
+	}
+
+	excludeIfPresent := opts.ExcludeIfPresent
 	if opts.ExcludeCaches {
-		opts.ExcludeIfPresent = append(opts.ExcludeIfPresent, "CACHEDIR.TAG:Signature: 8a477f597d28d172789f06886806bc55")
+		excludeIfPresent = append(excludeIfPresent, "CACHEDIR.TAG:Signature: 8a477f597d28d172789f06886806bc55")
 	}
 
-	for _, spec := range opts.ExcludeIfPresent {
+	for _, spec := range excludeIfPresent {
 		f, err := rejectIfPresent(spec)
 		if err != nil {
-			return err
+			return nil, 0, err
 		}
 
-		rejectFuncs = append(rejectFuncs, f)
+		rules = append(rules, rejectRule{name: "--exclude-if-present", arg: spec, reject: f})
 	}
 
-	repo, err := OpenRepository(gopts)
+	// exclude other restic repositories (and the one we're saving to)
+	if !opts.NoAutoExclude {
+		rules = append(rules, rejectRule{name: "restic repository", reject: rejectResticRepos()})
+	}
+
+	if len(opts.IncludeOwner) > 0 || len(opts.ExcludeOwner) > 0 {
+		f, err := rejectByOwner(opts.IncludeOwner, opts.ExcludeOwner)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		rules = append(rules, rejectRule{name: "--include-owner/--exclude-owner", reject: f})
+	}
+
+	if opts.NewerThan != "" || opts.OlderThan != "" {
+		var newer, older time.Time
+		now := time.Now()
+
+		if opts.NewerThan != "" {
+			newer, err = parseFileAge(opts.NewerThan, now)
+			if err != nil {
+				return nil, 0, errors.Fatalf("invalid value for --newer-than: %v", err)
+			}
+		}
+
+		if opts.OlderThan != "" {
+			older, err = parseFileAge(opts.OlderThan, now)
+			if err != nil {
+				return nil, 0, errors.Fatalf("invalid value for --older-than: %v", err)
+			}
+		}
+
+		rules = append(rules, rejectRule{name: "--newer-than/--older-than", reject: rejectByAge(newer, older)})
+	}
+
+	if opts.ExcludeLargerThan != "" {
+		maxSize, err = parseSize(opts.ExcludeLargerThan)
+		if err != nil {
+			return nil, 0, errors.Fatalf("invalid value for --exclude-larger-than: %v", err)
+		}
+	}
+
+	return rules, maxSize, nil
+}
+
+func runBackup(opts BackupOptions, gopts GlobalOptions, args []string) (err error) {
+	if opts.filesFromStdin() && gopts.password == "" && !gopts.InsecureNoPassword {
+		return errors.Fatal("unable to read password from stdin when data is to be read from stdin, use --password-file or $RESTIC_PASSWORD")
+	}
+
+	target, err := backupTargets(opts, args)
 	if err != nil {
 		return err
 	}
 
-	lock, err := lockRepo(repo)
-	defer unlockRepo(lock)
+	hooks := newBackupHooks(opts, gopts)
+	defer func() { hooks.post(err) }()
+
+	if err = hooks.pre(); err != nil {
+		return err
+	}
+
+	rules, maxSize, err := collectRejectRules(opts, target)
 	if err != nil {
 		return err
 	}
 
-	// exclude restic cache
-	if repo.Cache != nil {
-		f, err := rejectResticCache(repo)
+	// rejectFuncs collect functions that can reject items from the backup,
+	// the exclude patterns are saved in the snapshot
+	var (
+		rejectFuncs []RejectFunc
+		excludes    []string
+	)
+	for _, rule := range rules {
+		rejectFuncs = append(rejectFuncs, rule.reject)
+		if rule.name == "--exclude" {
+			excludes = append(excludes, rule.arg)
+		}
+	}
+
+	var xattrFilter func(string) bool
+	if len(opts.IncludeXattr) > 0 || len(opts.ExcludeXattr) > 0 {
+		xattrFilter, err = selectXattrs(opts.IncludeXattr, opts.ExcludeXattr)
 		if err != nil {
 			return err
 		}
+	}
 
-		rejectFuncs = append(rejectFuncs, f)
+	stopMetrics, err := serveMetrics(opts.MetricsListen)
+	if err != nil {
+		return err
 	}
+	defer stopMetrics()
 
-	err = repo.LoadIndex(gopts.ctx)
+	gopts.checkLifecycle = !opts.IgnoreLifecycleRules
+	repo, err := OpenRepository(gopts)
 	if err != nil {
 		return err
 	}
+	hooks.repo = repo
 
-	var parentSnapshotID *restic.ID
+	lock, err := lockRepoOperation(repo, "backup", target)
+	defer unlockRepo(lock)
+	if err != nil {
+		return err
+	}
 
-	// Force using a parent
-	if !opts.Force && opts.Parent != "" {
-		id, err := restic.FindSnapshot(repo, opts.Parent)
-		if err != nil {
-			return errors.Fatalf("invalid id %q: %v", opts.Parent, err)
-		}
+	// another backup of the same paths has just finished, only save a new
+	// snapshot if something has changed since
+	waited, err := waitForConcurrentBackups(gopts, lock, opts.Concurrent)
+	if err != nil {
+		return err
+	}
 
-		parentSnapshotID = &id
+	if waited {
+		opts.SkipIfUnchanged = true
 	}
 
-	// Find last snapshot to set it as parent, if not already set
-	if !opts.Force && parentSnapshotID == nil {
-		id, err := restic.FindLatestSnapshot(gopts.ctx, repo, target, []restic.TagList{}, opts.Hostname)
-		if err == nil {
-			parentSnapshotID = &id
-		} else if err != restic.ErrNoSnapshotFound {
+	finish := recordOperation(gopts, repo, "backup")
+	defer func() { finish(err) }()
+
+	// exclude restic cache
+	if repo.Cache != nil && !opts.NoAutoExclude {
+		f, err := rejectResticCache(repo)
+		if err != nil {
 			return err
 		}
+
+		rejectFuncs = append(rejectFuncs, f)
+	}
+
+	err = loadIndex(gopts.ctx, repo)
+	if err != nil {
+		return err
+	}
+
+	parentSnapshotID, err := findParentSnapshot(gopts.ctx, repo, opts, target)
+	if err != nil {
+		return err
 	}
 
 	if parentSnapshotID != nil {
@@ -452,19 +855,48 @@ func runBackup(opts BackupOptions, gopts GlobalOptions, args []string) error {
 		return true
 	}
 
-	stat, err := archiver.Scan(target, selectFilter, newScanProgress(gopts))
-	if err != nil {
-		return err
+	var profile *restic.Profile
+	if opts.ProfileReport {
+		profile = restic.NewProfile()
+		repo.Profile = profile
 	}
 
 	arch := archiver.New(repo)
-	arch.Excludes = opts.Excludes
+	arch.Excludes = excludes
+	arch.Labels = opts.Labels
+	arch.ProgramVersion = programVersion()
 	arch.SelectFilter = selectFilter
+	arch.ExcludeLargerThan = maxSize
+	arch.XattrFilter = xattrFilter
+	if opts.IgnoreInode {
+		arch.ChangeIgnoreFlags |= restic.ChangeIgnoreInode
+	}
+	if opts.IgnoreCtime {
+		arch.ChangeIgnoreFlags |= restic.ChangeIgnoreCtime
+	}
 	arch.WithAccessTime = opts.WithAtime
+	arch.ChangedFileRetries = opts.RetryChanged
+	arch.CheckpointInterval = opts.CheckpointInterval
+	arch.CheckpointSize = uint64(opts.CheckpointSize) << 20
+	arch.SkipIfUnchanged = opts.SkipIfUnchanged
+	arch.Profile = profile
+
+	start := time.Now()
+	stat, err := archiver.Scan(target, arch.Select, newScanProgress(gopts))
+	if err != nil {
+		return err
+	}
+	profile.Add(restic.PhaseScan, time.Since(start), 0)
 
+	if repo.Cache != nil && !opts.NoResume {
+		arch.ResumeFile = resumeFilename(repo, opts.Hostname, target)
+		debug.Log("using resume file %v", arch.ResumeFile)
+	}
+
+	p := newPrinter(gopts)
 	arch.Warn = func(dir string, fi os.FileInfo, err error) {
 		// TODO: make ignoring errors configurable
-		Warnf("%s\rwarning for %s: %v\n", ClearLine(), dir, err)
+		p.Error("archival", dir, err, "%s\rwarning for %s: %v\n", ClearLine(), dir, err)
 	}
 
 	timeStamp := time.Now()
@@ -475,12 +907,65 @@ func runBackup(opts BackupOptions, gopts GlobalOptions, args []string) error {
 		}
 	}
 
-	_, id, err := arch.Snapshot(gopts.ctx, newArchiveProgress(gopts, stat), target, opts.Tags, opts.Hostname, parentSnapshotID, timeStamp)
+	summary := &backupSummary{MessageType: msgSummary}
+
+	if opts.UseFsSnapshot {
+		deleteShadowCopies := createShadowCopies(target)
+		defer deleteShadowCopies()
+	}
+
+	sn, id, err := arch.Snapshot(gopts.ctx, newArchiveProgress(gopts, stat, summary), target, opts.Tags, opts.Hostname, parentSnapshotID, timeStamp)
 	if err != nil {
 		return err
 	}
 
+	if gopts.JSON {
+		// the summary is printed when the function returns without an error
+		summary.SnapshotID = id.String()
+		summary.ChangedWhileReading = len(sn.ChangedFiles)
+		defer func() {
+			if err != nil {
+				return
+			}
+			summary.DataAdded = repo.UploadedBytes()
+			summary.BackendTimeouts = jobMetrics.backendTimeouts()
+			summary.Profile = profile.Phases()
+			large := arch.LargeFiles()
+			summary.LargeFilesSkipped = large.Files
+			summary.LargeBytesSkipped = large.Bytes
+			p.Message(summary)
+		}()
+	}
+
+	jobMetrics.setSnapshot(id)
+	hooks.snapshotID, hooks.summary = &id, summary
+
+	if opts.ChangesFile != "" {
+		err = writeChangesFile(gopts.ctx, repo, opts.ChangesFile, parentSnapshotID, sn)
+		if err != nil {
+			return err
+		}
+	}
+
+	if opts.SkipIfUnchanged && parentSnapshotID != nil && id.Equal(*parentSnapshotID) {
+		Verbosef("nothing changed since snapshot %s, no new snapshot saved\n", id.Str())
+		summary.Unchanged = true
+		return nil
+	}
+
+	if large := arch.LargeFiles(); large.Files > 0 {
+		Verbosef("skipped %d files larger than %s (%s in total)\n", large.Files, formatBytes(maxSize), formatBytes(large.Bytes))
+	}
+
+	if len(sn.ChangedFiles) > 0 {
+		Warnf("%d files were modified while they were read, their content in the snapshot may be inconsistent\n", len(sn.ChangedFiles))
+	}
+
 	Verbosef("snapshot %s saved\n", id.Str())
+	if !gopts.JSON {
+		reportBackendTimeouts()
+		return printProfileReport(gopts.stdout, profile.Phases(), time.Since(start))
+	}
 
 	return nil
 }
@@ -500,24 +985,9 @@ func readExcludePatternsFromFiles(excludeFiles []string) []string {
 				}
 			}()
 
-			scanner := bufio.NewScanner(file)
-			for scanner.Scan() {
-				line := strings.TrimSpace(scanner.Text())
-
-				// ignore empty lines
-				if line == "" {
-					continue
-				}
-
-				// strip comments
-				if strings.HasPrefix(line, "#") {
-					continue
-				}
-
-				line = os.ExpandEnv(line)
-				excludes = append(excludes, line)
-			}
-			return scanner.Err()
+			patterns, err := filter.ReadPatterns(file)
+			excludes = append(excludes, patterns...)
+			return err
 		}()
 		if err != nil {
 			Warnf("error reading exclude patterns: %v:", err)
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/restic/restic/internal/cache"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+	"github.com/spf13/cobra"
+)
+
+var cmdCache = &cobra.Command{
+	Use:   "cache [flags]",
+	Short: "Show information about the local cache",
+	Long: `
+The "cache" command shows where the local cache for the repository is stored
+and how much data it contains.
+
+For each pack file, restic records how often it was read and how often it was
+found in the cache. With --top, the pack files which were read most often are
+listed. This helps to estimate how much data needs to be kept in the cache.
+`,
+	DisableAutoGenTag: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runCache(cacheOptions, globalOptions, args)
+	},
+}
+
+// CacheOptions bundles all options for the cache command.
+type CacheOptions struct {
+	Top int
+}
+
+var cacheOptions CacheOptions
+
+func init() {
+	cmdRoot.AddCommand(cmdCache)
+
+	f := cmdCache.Flags()
+	f.IntVar(&cacheOptions.Top, "top", 0, "list the `n` pack files which were read most often")
+}
+
+// packReads is the read statistics of a single pack file.
+type packReads struct {
+	ID     restic.ID `json:"id"`
+	Cached bool      `json:"cached"`
+	cache.PackStats
+}
+
+func runCache(opts CacheOptions, gopts GlobalOptions, args []string) error {
+	if len(args) > 0 {
+		return errors.Fatal("the cache command has no arguments")
+	}
+
+	if gopts.NoCache {
+		return errors.Fatal("the cache is disabled (--no-cache)")
+	}
+
+	repo, err := OpenRepository(gopts)
+	if err != nil {
+		return err
+	}
+
+	c, ok := repo.Cache.(*cache.Cache)
+	if !ok {
+		return errors.Fatal("no cache available for this repository")
+	}
+
+	stats, err := c.Stats()
+	if err != nil {
+		return err
+	}
+
+	var (
+		list        []packReads
+		reads, hits uint64
+	)
+
+	for id, ps := range stats {
+		h := restic.Handle{Type: restic.DataFile, Name: id.String()}
+		list = append(list, packReads{ID: id, Cached: c.Has(h), PackStats: ps})
+		reads += ps.Reads
+		hits += ps.CacheHits
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Reads != list[j].Reads {
+			return list[i].Reads > list[j].Reads
+		}
+		return list[i].BytesRead > list[j].BytesRead
+	})
+
+	if opts.Top > 0 && len(list) > opts.Top {
+		list = list[:opts.Top]
+	}
+
+	if gopts.JSON {
+		return json.NewEncoder(gopts.stdout).Encode(list)
+	}
+
+	Printf("cache directory: %v\n", c.Path)
+	for _, t := range []restic.FileType{restic.DataFile, restic.IndexFile, restic.SnapshotFile} {
+		files, size, err := c.Usage(t)
+		if err != nil {
+			return err
+		}
+		Printf("cached %-9v %6d files, %v\n", string(t)+":", files, formatBytes(uint64(size)))
+	}
+	Printf("pack reads:      %d, %d from the cache\n", reads, hits)
+
+	if opts.Top <= 0 {
+		return nil
+	}
+
+	Printf("\n")
+
+	var topReads, topBytes uint64
+	tab := NewTable()
+	tab.Header = fmt.Sprintf("%-8s  %8s  %8s  %-12s  %-6s  %s", "ID", "Reads", "Hits", "Read", "Cached", "Last Read")
+	tab.RowFormat = "%-8s  %8d  %8d  %-12s  %-6s  %s"
+	for _, pack := range list {
+		cached := "no"
+		if pack.Cached {
+			cached = "yes"
+		}
+
+		tab.Rows = append(tab.Rows, []interface{}{
+			pack.ID.Str(), pack.Reads, pack.CacheHits, formatBytes(pack.BytesRead),
+			cached, pack.LastRead.Format(TimeFormat),
+		})
+
+		topReads += pack.Reads
+		topBytes += pack.BytesRead
+	}
+
+	tab.Footer = fmt.Sprintf("%d packs account for %d of %d reads (%v), %v read",
+		len(list), topReads, reads, formatPercent(topReads, reads), formatBytes(topBytes))
+
+	return tab.Write(gopts.stdout)
+}
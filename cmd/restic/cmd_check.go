@@ -1,14 +1,20 @@
 package main
 
 import (
+	"crypto/sha256"
+	"encoding/binary"
 	"fmt"
 	"os"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/spf13/cobra"
 
 	"github.com/restic/restic/internal/checker"
 	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/progress"
 	"github.com/restic/restic/internal/restic"
 )
 
@@ -21,6 +27,15 @@ finds. It can also be used to read all data and therefore simulate a restore.
 
 By default, the "check" command will always load all data directly from the
 repository and not use a local cache.
+
+With --snapshot, only the trees and blobs reachable from the given snapshots
+are checked, and --read-data only reads the packs they are stored in. This
+allows a quick check of a single snapshot before restoring it.
+
+With --read-data-subset, only a part of the packs is read. "n/t" splits the
+packs into t groups and reads the n-th one, so running check with 1/t to t/t
+reads all data. A percentage like "10%" reads a random selection of packs,
+which is different for each run unless the same --read-data-seed is given.
 `,
 	DisableAutoGenTag: true,
 	RunE: func(cmd *cobra.Command, args []string) error {
@@ -30,9 +45,12 @@ repository and not use a local cache.
 
 // CheckOptions bundles all options for the 'check' command.
 type CheckOptions struct {
-	ReadData    bool
-	CheckUnused bool
-	WithCache   bool
+	ReadData       bool
+	ReadDataSubset string
+	ReadDataSeed   int64
+	CheckUnused    bool
+	WithCache      bool
+	Snapshots      []string
 }
 
 var checkOptions CheckOptions
@@ -42,38 +60,143 @@ func init() {
 
 	f := cmdCheck.Flags()
 	f.BoolVar(&checkOptions.ReadData, "read-data", false, "read all data blobs")
+	f.StringVar(&checkOptions.ReadDataSubset, "read-data-subset", "", "read a `subset` of the packs, either the n-th of t groups (n/t) or a random percentage (x%)")
+	f.Int64Var(&checkOptions.ReadDataSeed, "read-data-seed", 0, "select the random packs for --read-data-subset x% with `seed` (default: random)")
 	f.BoolVar(&checkOptions.CheckUnused, "check-unused", false, "find unused blobs")
 	f.BoolVar(&checkOptions.WithCache, "with-cache", false, "use the cache")
+	f.StringArrayVar(&checkOptions.Snapshots, "snapshot", nil, "only check the snapshot `ID` (can be specified multiple times)")
 }
 
 func newReadProgress(gopts GlobalOptions, todo restic.Stat) *restic.Progress {
-	if gopts.Quiet {
-		return nil
+	return newProgress(gopts, todo, progressOptions{
+		Action: "packs",
+		Summary: func(s progress.Status) string {
+			return fmt.Sprintf("duration: %s", formatDuration(s.Elapsed))
+		},
+	})
+}
+
+// findCheckSnapshots resolves the snapshot IDs given with --snapshot, the
+// special ID "latest" selects the most recent snapshot.
+func findCheckSnapshots(gopts GlobalOptions, repo restic.Repository, args []string) (restic.IDs, error) {
+	ids := make(restic.IDs, 0, len(args))
+	for _, s := range args {
+		var (
+			id  restic.ID
+			err error
+		)
+
+		if s == "latest" {
+			id, err = restic.FindLatestSnapshot(gopts.ctx, repo, nil, nil, "")
+		} else {
+			id, err = restic.FindSnapshot(repo, s)
+		}
+
+		if err != nil {
+			return nil, errors.Fatalf("invalid snapshot %q: %v", s, err)
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
+
+// readDataSubset selects a part of the packs to read, either the group n of
+// total groups, or a percentage of the packs.
+type readDataSubset struct {
+	n, total uint32
+	percent  float64
+}
+
+// parseReadDataSubset parses the argument of --read-data-subset.
+func parseReadDataSubset(s string) (readDataSubset, error) {
+	if strings.HasSuffix(s, "%") {
+		p, err := strconv.ParseFloat(strings.TrimSuffix(s, "%"), 64)
+		if err != nil || p <= 0 || p > 100 {
+			return readDataSubset{}, errors.Fatalf("invalid percentage %q for --read-data-subset, must be larger than 0%% and at most 100%%", s)
+		}
+		return readDataSubset{percent: p}, nil
+	}
+
+	parts := strings.Split(s, "/")
+	if len(parts) != 2 {
+		return readDataSubset{}, errors.Fatalf("invalid subset %q for --read-data-subset, use n/t or x%%", s)
+	}
+
+	n, err1 := strconv.ParseUint(parts[0], 10, 32)
+	total, err2 := strconv.ParseUint(parts[1], 10, 32)
+	if err1 != nil || err2 != nil || n < 1 || n > total {
+		return readDataSubset{}, errors.Fatalf("invalid subset %q for --read-data-subset, n must be between 1 and t", s)
 	}
 
-	readProgress := restic.NewProgress()
+	return readDataSubset{n: uint32(n), total: uint32(total)}, nil
+}
 
-	readProgress.OnUpdate = func(s restic.Stat, d time.Duration, ticker bool) {
-		status := fmt.Sprintf("[%s] %s  %d / %d items",
-			formatDuration(d),
-			formatPercent(s.Blobs, todo.Blobs),
-			s.Blobs, todo.Blobs)
+func (s readDataSubset) String() string {
+	if s.total > 0 {
+		return fmt.Sprintf("%d/%d", s.n, s.total)
+	}
+	return fmt.Sprintf("%v%%", s.percent)
+}
 
-		if w := stdoutTerminalWidth(); w > 0 {
-			if len(status) > w {
-				max := w - len(status) - 4
-				status = status[:max] + "... "
+// selectPacks returns the packs in the subset. For a group, the first bytes
+// of the pack ID decide which group a pack belongs to, so the groups do not
+// change between runs. For a percentage, the packs are ordered by a hash of
+// seed and the pack ID, and the first ones are selected.
+func (s readDataSubset) selectPacks(packs restic.IDSet, seed int64) restic.IDSet {
+	selected := restic.NewIDSet()
+
+	if s.total > 0 {
+		for id := range packs {
+			if binary.BigEndian.Uint32(id[:4])%s.total == s.n-1 {
+				selected.Insert(id)
 			}
 		}
+		return selected
+	}
+
+	key := func(id restic.ID) [sha256.Size]byte {
+		var buf [8 + len(id)]byte
+		binary.BigEndian.PutUint64(buf[:8], uint64(seed))
+		copy(buf[8:], id[:])
+		return sha256.Sum256(buf[:])
+	}
+
+	type packKey struct {
+		id  restic.ID
+		key [sha256.Size]byte
+	}
+
+	list := make([]packKey, 0, len(packs))
+	for id := range packs {
+		list = append(list, packKey{id: id, key: key(id)})
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return string(list[i].key[:]) < string(list[j].key[:])
+	})
 
-		PrintProgress("%s", status)
+	// read at least one pack
+	count := int(float64(len(list))*s.percent/100 + 0.5)
+	if count == 0 && len(list) > 0 {
+		count = 1
 	}
 
-	readProgress.OnDone = func(s restic.Stat, d time.Duration, ticker bool) {
-		fmt.Printf("\nduration: %s\n", formatDuration(d))
+	for _, p := range list[:count] {
+		selected.Insert(p.id)
 	}
 
-	return readProgress
+	return selected
+}
+
+// checkSummary is the JSON message printed at the end of check.
+type checkSummary struct {
+	MessageType         string      `json:"message_type"`
+	NumErrors           int         `json:"num_errors"`
+	Hints               []string    `json:"hints,omitempty"`
+	SuggestRebuildIndex bool        `json:"suggest_rebuild_index,omitempty"`
+	UnusedBlobs         []restic.ID `json:"unused_blobs,omitempty"`
 }
 
 func runCheck(opts CheckOptions, gopts GlobalOptions, args []string) error {
@@ -81,6 +204,23 @@ func runCheck(opts CheckOptions, gopts GlobalOptions, args []string) error {
 		return errors.Fatal("check has no arguments")
 	}
 
+	if opts.CheckUnused && len(opts.Snapshots) > 0 {
+		return errors.Fatal("--check-unused cannot be used together with --snapshot")
+	}
+
+	var subset *readDataSubset
+	if opts.ReadDataSubset != "" {
+		if opts.ReadData {
+			return errors.Fatal("--read-data and --read-data-subset cannot be used together")
+		}
+
+		s, err := parseReadDataSubset(opts.ReadDataSubset)
+		if err != nil {
+			return err
+		}
+		subset = &s
+	}
+
 	if !opts.WithCache {
 		// do not use a cache for the checker
 		gopts.NoCache = true
@@ -101,20 +241,35 @@ func runCheck(opts CheckOptions, gopts GlobalOptions, args []string) error {
 	}
 
 	chkr := checker.New(repo)
+	p := newPrinter(gopts)
+	summary := checkSummary{MessageType: msgSummary}
+
+	// reportError prints an error found in the repository, text is the
+	// message printed in text mode
+	reportError := func(during, item string, err error, text string) {
+		summary.NumErrors++
+		if gopts.JSON {
+			p.jsonError(during, item, err)
+			return
+		}
+		fmt.Fprint(os.Stderr, text)
+	}
 
 	Verbosef("load indexes\n")
 	hints, errs := chkr.LoadIndex(gopts.ctx)
 
 	dupFound := false
 	for _, hint := range hints {
-		Printf("%v\n", hint)
+		p.Textf("%v\n", hint)
+		summary.Hints = append(summary.Hints, hint.Error())
 		if _, ok := hint.(checker.ErrDuplicatePacks); ok {
 			dupFound = true
 		}
 	}
 
 	if dupFound {
-		Printf("\nrun `restic rebuild-index' to correct this\n")
+		p.Textf("\nrun `restic rebuild-index' to correct this\n")
+		summary.SuggestRebuildIndex = true
 	}
 
 	if len(errs) > 0 {
@@ -132,46 +287,96 @@ func runCheck(opts CheckOptions, gopts GlobalOptions, args []string) error {
 
 	for err := range errChan {
 		errorsFound = true
-		fmt.Fprintf(os.Stderr, "%v\n", err)
+		reportError("packs", "", err, fmt.Sprintf("%v\n", err))
 	}
 
-	Verbosef("check snapshots, trees and blobs\n")
 	errChan = make(chan error)
-	go chkr.Structure(gopts.ctx, errChan)
+	if len(opts.Snapshots) > 0 {
+		snapshotIDs, err := findCheckSnapshots(gopts, repo, opts.Snapshots)
+		if err != nil {
+			return err
+		}
+
+		Verbosef("check trees and blobs of %d snapshots\n", len(snapshotIDs))
+		go chkr.SnapshotStructure(gopts.ctx, snapshotIDs, errChan)
+	} else {
+		Verbosef("check snapshots, trees and blobs\n")
+		go chkr.Structure(gopts.ctx, errChan)
+	}
 
 	for err := range errChan {
 		errorsFound = true
 		if e, ok := err.(checker.TreeError); ok {
+			if gopts.JSON {
+				for _, treeErr := range e.Errors {
+					reportError("structure", e.ID.String(), treeErr, "")
+				}
+				continue
+			}
+
 			fmt.Fprintf(os.Stderr, "error for tree %v:\n", e.ID.Str())
 			for _, treeErr := range e.Errors {
 				fmt.Fprintf(os.Stderr, "  %v\n", treeErr)
 			}
+			summary.NumErrors += len(e.Errors)
 		} else {
-			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			reportError("structure", "", err, fmt.Sprintf("error: %v\n", err))
 		}
 	}
 
 	if opts.CheckUnused {
 		for _, id := range chkr.UnusedBlobs() {
 			Verbosef("unused blob %v\n", id.Str())
+			summary.UnusedBlobs = append(summary.UnusedBlobs, id)
 			errorsFound = true
 		}
 	}
 
-	if opts.ReadData {
-		Verbosef("read all data\n")
-
-		p := newReadProgress(gopts, restic.Stat{Blobs: chkr.CountPacks()})
+	if opts.ReadData || subset != nil {
 		errChan := make(chan error)
 
-		go chkr.ReadData(gopts.ctx, p, errChan)
+		if subset != nil {
+			packs := chkr.GetPacks()
+			if len(opts.Snapshots) > 0 {
+				packs = chkr.ReferencedPacks()
+			}
+
+			seed := opts.ReadDataSeed
+			if subset.total == 0 && seed == 0 {
+				seed = time.Now().UnixNano()
+			}
+
+			total := len(packs)
+			packs = subset.selectPacks(packs, seed)
+			if subset.total == 0 {
+				Verbosef("read %v of the data (%d of %d packs), repeat with --read-data-seed %d\n", subset, len(packs), total, seed)
+			} else {
+				Verbosef("read group %v of the data (%d of %d packs)\n", subset, len(packs), total)
+			}
+
+			p := newReadProgress(gopts, restic.Stat{Blobs: uint64(len(packs))})
+			go chkr.ReadPacks(gopts.ctx, packs, p, errChan)
+		} else if len(opts.Snapshots) > 0 {
+			packs := chkr.ReferencedPacks()
+			Verbosef("read data of %d packs\n", len(packs))
+
+			p := newReadProgress(gopts, restic.Stat{Blobs: uint64(len(packs))})
+			go chkr.ReadPacks(gopts.ctx, packs, p, errChan)
+		} else {
+			Verbosef("read all data\n")
+
+			p := newReadProgress(gopts, restic.Stat{Blobs: chkr.CountPacks()})
+			go chkr.ReadData(gopts.ctx, p, errChan)
+		}
 
 		for err := range errChan {
 			errorsFound = true
-			fmt.Fprintf(os.Stderr, "%v\n", err)
+			reportError("read data", "", err, fmt.Sprintf("%v\n", err))
 		}
 	}
 
+	p.Message(summary)
+
 	if errorsFound {
 		return errors.Fatal("repository contains errors")
 	}
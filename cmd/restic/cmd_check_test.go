@@ -0,0 +1,62 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestParseReadDataSubset(t *testing.T) {
+	var tests = []struct {
+		input string
+		want  readDataSubset
+	}{
+		{"1/5", readDataSubset{n: 1, total: 5}},
+		{"5/5", readDataSubset{n: 5, total: 5}},
+		{"10%", readDataSubset{percent: 10}},
+		{"0.5%", readDataSubset{percent: 0.5}},
+		{"100%", readDataSubset{percent: 100}},
+	}
+
+	for _, test := range tests {
+		subset, err := parseReadDataSubset(test.input)
+		rtest.OK(t, err)
+		rtest.Equals(t, test.want, subset)
+		rtest.Equals(t, test.input, subset.String())
+	}
+
+	for _, input := range []string{"", "0/5", "6/5", "1/0", "1/2/3", "a/b", "0%", "101%", "x%", "5"} {
+		_, err := parseReadDataSubset(input)
+		rtest.Assert(t, err != nil, "invalid subset %q was accepted", input)
+	}
+}
+
+func TestReadDataSubsetSelectPacks(t *testing.T) {
+	packs := restic.NewIDSet()
+	for i := 0; i < 100; i++ {
+		packs.Insert(restic.NewRandomID())
+	}
+
+	// the groups cover all packs exactly once
+	seen := restic.NewIDSet()
+	for n := uint32(1); n <= 3; n++ {
+		selected := readDataSubset{n: n, total: 3}.selectPacks(packs, 0)
+		for id := range selected {
+			rtest.Assert(t, packs.Has(id), "unknown pack %v selected", id.Str())
+			rtest.Assert(t, !seen.Has(id), "pack %v selected for several groups", id.Str())
+			seen.Insert(id)
+		}
+	}
+	rtest.Equals(t, packs, seen)
+
+	subset := readDataSubset{percent: 10}
+	selected := subset.selectPacks(packs, 42)
+	rtest.Equals(t, 10, len(selected))
+	rtest.Equals(t, selected, subset.selectPacks(packs, 42))
+	rtest.Assert(t, !selected.Equals(subset.selectPacks(packs, 23)), "different seeds selected the same packs")
+
+	rtest.Equals(t, 1, len(readDataSubset{percent: 0.1}.selectPacks(packs, 1)))
+	rtest.Equals(t, packs, readDataSubset{percent: 100}.selectPacks(packs, 1))
+	rtest.Equals(t, 0, len(subset.selectPacks(restic.NewIDSet(), 1)))
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"context"
+	"os"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+
+	"github.com/spf13/cobra"
+)
+
+var cmdCopy = &cobra.Command{
+	Use:   "copy [flags] [snapshotID ...]",
+	Short: "Copy snapshots from one repository to another",
+	Long: `
+The "copy" command copies one or more snapshots from the repository given with
+--repo to the destination repository given with --repo2. If no snapshot IDs
+are given, all snapshots matching the filters are copied.
+
+The data is decrypted and encrypted again with the key of the destination
+repository, data which is already present in the destination is not copied
+again. Snapshots which have been copied before are skipped, so the command
+can be run repeatedly, e.g. to keep a second repository in sync.
+
+The password for the destination repository is read from the file given with
+--password-file2, the environment variable $RESTIC_PASSWORD2 or the terminal.
+`,
+	DisableAutoGenTag: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runCopy(copyOptions, globalOptions, args)
+	},
+}
+
+// CopyOptions bundles all options for the copy command.
+type CopyOptions struct {
+	Repo2         string
+	PasswordFile2 string
+	Host          string
+	Tags          restic.TagLists
+	Paths         []string
+}
+
+var copyOptions CopyOptions
+
+func init() {
+	cmdRoot.AddCommand(cmdCopy)
+
+	f := cmdCopy.Flags()
+	f.StringVar(&copyOptions.Repo2, "repo2", os.Getenv("RESTIC_REPOSITORY2"), "destination repository to copy snapshots to (default: $RESTIC_REPOSITORY2)")
+	f.StringVar(&copyOptions.PasswordFile2, "password-file2", os.Getenv("RESTIC_PASSWORD_FILE2"), "read the destination repository password from a file (default: $RESTIC_PASSWORD_FILE2)")
+	f.StringVarP(&copyOptions.Host, "host", "H", "", "only consider snapshots for this `host`")
+	f.Var(&copyOptions.Tags, "tag", "only consider snapshots which include this `taglist`")
+	f.StringArrayVar(&copyOptions.Paths, "path", nil, "only consider snapshots which include this (absolute) `path`")
+}
+
+func runCopy(opts CopyOptions, gopts GlobalOptions, args []string) error {
+	if opts.Repo2 == "" {
+		return errors.Fatal("Please specify the destination repository location (--repo2)")
+	}
+
+	dstGopts := gopts
+	dstGopts.Repo = opts.Repo2
+	dstGopts.ColdRepo = ""
+	dstGopts.PasswordFile = opts.PasswordFile2
+	// --password-command and --insecure-no-password only apply to the source
+	// repository
+	dstGopts.PasswordCommand = ""
+	dstGopts.InsecureNoPassword = false
+
+	var err error
+	dstGopts.password, err = resolvePassword(dstGopts, "RESTIC_PASSWORD2")
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(gopts.ctx)
+	defer cancel()
+
+	srcRepo, err := OpenRepository(gopts)
+	if err != nil {
+		return err
+	}
+
+	if dstGopts.password == "" {
+		dstGopts.password, err = ReadPassword(dstGopts, "enter password for destination repository: ")
+		if err != nil {
+			return err
+		}
+	}
+
+	dstRepo, err := OpenRepository(dstGopts)
+	if err != nil {
+		return err
+	}
+
+	if !gopts.NoLock {
+		srcLock, err := lockRepo(srcRepo)
+		defer unlockRepo(srcLock)
+		if err != nil {
+			return err
+		}
+	}
+
+	dstLock, err := lockRepo(dstRepo)
+	defer unlockRepo(dstLock)
+	if err != nil {
+		return err
+	}
+
+	Verbosef("load indexes\n")
+	if err = loadIndex(ctx, srcRepo); err != nil {
+		return err
+	}
+
+	if err = loadIndex(ctx, dstRepo); err != nil {
+		return err
+	}
+
+	// snapshots copied before are identified by the ID of the original
+	dstSnapshots, err := restic.LoadAllSnapshots(ctx, dstRepo)
+	if err != nil {
+		return err
+	}
+
+	copied := restic.NewIDSet()
+	for _, sn := range dstSnapshots {
+		if sn.Original != nil {
+			copied.Insert(*sn.Original)
+		}
+		copied.Insert(*sn.ID())
+	}
+
+	c := &blobCopier{
+		src:  srcRepo,
+		dst:  dstRepo,
+		seen: restic.NewBlobSet(),
+	}
+
+	var count int
+	for sn := range FindFilteredSnapshots(ctx, srcRepo, opts.Host, opts.Tags, opts.Paths, args) {
+		id := *sn.ID()
+		original := id
+		if sn.Original != nil {
+			original = *sn.Original
+		}
+
+		if copied.Has(id) || copied.Has(original) {
+			Verbosef("skipping snapshot %v, it has already been copied\n", id.Str())
+			continue
+		}
+
+		Verbosef("copy snapshot %v of %v at %v\n", id.Str(), sn.Paths, sn.Time.Format(TimeFormat))
+
+		if err = c.copyTree(ctx, *sn.Tree); err != nil {
+			return err
+		}
+
+		// the index must be saved before the snapshot, so that the snapshot
+		// never references data which the destination does not know about
+		if err = dstRepo.Flush(ctx); err != nil {
+			return err
+		}
+
+		if err = dstRepo.SaveIndex(ctx); err != nil {
+			return err
+		}
+
+		newSn := *sn
+		newSn.Original = &original
+		newID, err := dstRepo.SaveJSONUnpacked(ctx, restic.SnapshotFile, newSn)
+		if err != nil {
+			return err
+		}
+
+		debug.Log("snapshot %v saved as %v", id.Str(), newID.Str())
+		Verbosef("  saved as %v\n", newID.Str())
+		copied.Insert(original)
+		count++
+	}
+
+	Verbosef("copied %d snapshots, %d blobs (%v)\n", count, c.blobs, formatBytes(c.bytes))
+	return nil
+}
+
+// blobCopier copies blobs from one repository to another, skipping blobs
+// which are already present in the destination.
+type blobCopier struct {
+	src, dst restic.Repository
+
+	// seen contains the blobs which have been checked or copied before, the
+	// destination index only knows about blobs after a pack is finished
+	seen restic.BlobSet
+
+	blobs uint64
+	bytes uint64
+}
+
+// needsCopy returns true if the blob h has to be copied.
+func (c *blobCopier) needsCopy(h restic.BlobHandle) bool {
+	if c.seen.Has(h) {
+		return false
+	}
+	c.seen.Insert(h)
+
+	return !c.dst.Index().Has(h.ID, h.Type)
+}
+
+// copyBlob loads the blob h from the source and saves it in the
+// destination.
+func (c *blobCopier) copyBlob(ctx context.Context, h restic.BlobHandle) error {
+	size, found := c.src.LookupBlobSize(h.ID, h.Type)
+	if !found {
+		return errors.Errorf("%v blob %v not found in the source repository", h.Type, h.ID.Str())
+	}
+
+	buf := restic.NewBlobBuffer(int(size))
+	n, err := c.src.LoadBlob(ctx, h.Type, h.ID, buf)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.dst.SaveBlob(ctx, h.Type, buf[:n], h.ID)
+	if err != nil {
+		return err
+	}
+
+	c.blobs++
+	c.bytes += uint64(n)
+	return nil
+}
+
+// copyTree copies the tree with the given id and all data referenced by it.
+// Trees which are present in the destination are skipped, together with all
+// their subtrees.
+func (c *blobCopier) copyTree(ctx context.Context, id restic.ID) error {
+	h := restic.BlobHandle{ID: id, Type: restic.TreeBlob}
+	if !c.needsCopy(h) {
+		return nil
+	}
+
+	tree, err := c.src.LoadTree(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	for _, node := range tree.Nodes {
+		switch node.Type {
+		case "file":
+			for _, blobID := range node.Content {
+				bh := restic.BlobHandle{ID: blobID, Type: restic.DataBlob}
+				if !c.needsCopy(bh) {
+					continue
+				}
+
+				if err = c.copyBlob(ctx, bh); err != nil {
+					return err
+				}
+			}
+		case "dir":
+			if node.Subtree == nil {
+				return errors.Errorf("dir %v has no subtree", node.Name)
+			}
+
+			if err = c.copyTree(ctx, *node.Subtree); err != nil {
+				return err
+			}
+		}
+	}
+
+	return c.copyBlob(ctx, h)
+}
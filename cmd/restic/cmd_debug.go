@@ -138,7 +138,7 @@ func runDebugDump(gopts GlobalOptions, args []string) error {
 		}
 	}
 
-	err = repo.LoadIndex(gopts.ctx)
+	err = loadIndex(gopts.ctx, repo)
 	if err != nil {
 		return err
 	}
@@ -2,11 +2,9 @@ package main
 
 import (
 	"context"
-	"path"
-	"reflect"
-	"sort"
+	"encoding/json"
 
-	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/diff"
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/repository"
 	"github.com/restic/restic/internal/restic"
@@ -26,6 +24,11 @@ directory:
  U  The metadata (access mode, timestamps, ...) for the item was updated
  M  The file's content was modified
  T  The type was changed, e.g. a file was made a symlink
+
+The content of added and removed directories is listed as well. With --json,
+the changes and statistics are printed as a JSON document, which contains the
+size of each item, the difference to the previous size and the names of the
+changed metadata fields ("mode", "mtime", "owner" and "xattrs").
 `,
 	DisableAutoGenTag: true,
 	RunE: func(cmd *cobra.Command, args []string) error {
@@ -56,17 +59,14 @@ func loadSnapshot(ctx context.Context, repo *repository.Repository, desc string)
 	return restic.LoadSnapshot(ctx, repo, id)
 }
 
-// Comparer collects all things needed to compare two snapshots.
-type Comparer struct {
-	repo restic.Repository
-	opts DiffOptions
-}
-
 // DiffStat collects stats for all types of items.
 type DiffStat struct {
-	Files, Dirs, Others  int
-	DataBlobs, TreeBlobs int
-	Bytes                int
+	Files     int `json:"files"`
+	Dirs      int `json:"dirs"`
+	Others    int `json:"others"`
+	DataBlobs int `json:"data_blobs"`
+	TreeBlobs int `json:"tree_blobs"`
+	Bytes     int `json:"bytes"`
 }
 
 // Add adds stats information for node to s.
@@ -85,44 +85,11 @@ func (s *DiffStat) Add(node *restic.Node) {
 	}
 }
 
-// addBlobs adds the blobs of node to s.
-func addBlobs(bs restic.BlobSet, node *restic.Node) {
-	if node == nil {
-		return
-	}
-
-	switch node.Type {
-	case "file":
-		for _, blob := range node.Content {
-			h := restic.BlobHandle{
-				ID:   blob,
-				Type: restic.DataBlob,
-			}
-			bs.Insert(h)
-		}
-	case "dir":
-		h := restic.BlobHandle{
-			ID:   *node.Subtree,
-			Type: restic.TreeBlob,
-		}
-		bs.Insert(h)
-	}
-}
-
 // DiffStats collects the differences between two snapshots.
 type DiffStats struct {
-	ChangedFiles            int
-	Added                   DiffStat
-	Removed                 DiffStat
-	BlobsBefore, BlobsAfter restic.BlobSet
-}
-
-// NewDiffStats creates new stats for a diff run.
-func NewDiffStats() *DiffStats {
-	return &DiffStats{
-		BlobsBefore: restic.NewBlobSet(),
-		BlobsAfter:  restic.NewBlobSet(),
-	}
+	ChangedFiles int      `json:"changed_files"`
+	Added        DiffStat `json:"added"`
+	Removed      DiffStat `json:"removed"`
 }
 
 // updateBlobs updates the blob counters in the stats struct.
@@ -145,141 +112,46 @@ func updateBlobs(repo restic.Repository, blobs restic.BlobSet, stats *DiffStat)
 	}
 }
 
-func (c *Comparer) printDir(ctx context.Context, mode string, stats *DiffStat, blobs restic.BlobSet, prefix string, id restic.ID) error {
-	debug.Log("print %v tree %v", mode, id)
-	tree, err := c.repo.LoadTree(ctx, id)
-	if err != nil {
-		return err
-	}
-
-	for _, node := range tree.Nodes {
-		name := path.Join(prefix, node.Name)
-		if node.Type == "dir" {
-			name += "/"
-		}
-		Printf("%-5s%v\n", mode, name)
-		stats.Add(node)
-		addBlobs(blobs, node)
-
-		if node.Type == "dir" {
-			err := c.printDir(ctx, mode, stats, blobs, name, *node.Subtree)
-			if err != nil {
-				Warnf("error: %v\n", err)
-			}
-		}
-	}
-
-	return nil
-}
-
-func uniqueNodeNames(tree1, tree2 *restic.Tree) (tree1Nodes, tree2Nodes map[string]*restic.Node, uniqueNames []string) {
-	names := make(map[string]struct{})
-	tree1Nodes = make(map[string]*restic.Node)
-	for _, node := range tree1.Nodes {
-		tree1Nodes[node.Name] = node
-		names[node.Name] = struct{}{}
+// diffModifier returns the characters printed in front of the path of c.
+func diffModifier(c diff.Change, showMetadata bool) string {
+	switch {
+	case c.Added():
+		return "+"
+	case c.Removed():
+		return "-"
 	}
 
-	tree2Nodes = make(map[string]*restic.Node)
-	for _, node := range tree2.Nodes {
-		tree2Nodes[node.Name] = node
-		names[node.Name] = struct{}{}
+	mod := ""
+	if c.TypeChanged() {
+		mod += "T"
 	}
 
-	uniqueNames = make([]string, 0, len(names))
-	for name := range names {
-		uniqueNames = append(uniqueNames, name)
+	if c.ContentChanged() {
+		mod += "M"
+	} else if showMetadata && c.MetadataChanged() {
+		mod += "U"
 	}
 
-	sort.Sort(sort.StringSlice(uniqueNames))
-	return tree1Nodes, tree2Nodes, uniqueNames
+	return mod
 }
 
-func (c *Comparer) diffTree(ctx context.Context, stats *DiffStats, prefix string, id1, id2 restic.ID) error {
-	debug.Log("diffing %v to %v", id1, id2)
-	tree1, err := c.repo.LoadTree(ctx, id1)
-	if err != nil {
-		return err
-	}
-
-	tree2, err := c.repo.LoadTree(ctx, id2)
-	if err != nil {
-		return err
-	}
-
-	tree1Nodes, tree2Nodes, names := uniqueNodeNames(tree1, tree2)
-
-	for _, name := range names {
-		node1, t1 := tree1Nodes[name]
-		node2, t2 := tree2Nodes[name]
-
-		addBlobs(stats.BlobsBefore, node1)
-		addBlobs(stats.BlobsAfter, node2)
-
-		switch {
-		case t1 && t2:
-			name := path.Join(prefix, name)
-			mod := ""
-
-			if node1.Type != node2.Type {
-				mod += "T"
-			}
-
-			if node2.Type == "dir" {
-				name += "/"
-			}
-
-			if node1.Type == "file" &&
-				node2.Type == "file" &&
-				!reflect.DeepEqual(node1.Content, node2.Content) {
-				mod += "M"
-				stats.ChangedFiles++
-			} else if c.opts.ShowMetadata && !node1.Equals(*node2) {
-				mod += "U"
-			}
-
-			if mod != "" {
-				Printf("%-5s%v\n", mod, name)
-			}
-
-			if node1.Type == "dir" && node2.Type == "dir" {
-				err := c.diffTree(ctx, stats, name, *node1.Subtree, *node2.Subtree)
-				if err != nil {
-					Warnf("error: %v\n", err)
-				}
-			}
-		case t1 && !t2:
-			prefix := path.Join(prefix, name)
-			if node1.Type == "dir" {
-				prefix += "/"
-			}
-			Printf("%-5s%v\n", "-", prefix)
-			stats.Removed.Add(node1)
-
-			if node1.Type == "dir" {
-				err := c.printDir(ctx, "-", &stats.Removed, stats.BlobsBefore, prefix, *node1.Subtree)
-				if err != nil {
-					Warnf("error: %v\n", err)
-				}
-			}
-		case !t1 && t2:
-			prefix := path.Join(prefix, name)
-			if node2.Type == "dir" {
-				prefix += "/"
-			}
-			Printf("%-5s%v\n", "+", prefix)
-			stats.Added.Add(node2)
-
-			if node2.Type == "dir" {
-				err := c.printDir(ctx, "+", &stats.Added, stats.BlobsAfter, prefix, *node2.Subtree)
-				if err != nil {
-					Warnf("error: %v\n", err)
-				}
-			}
-		}
-	}
+// diffChange is an item in the JSON output of the diff command.
+type diffChange struct {
+	Path      string   `json:"path"`
+	Modifier  string   `json:"modifier"`
+	Type      string   `json:"type"`
+	Size      uint64   `json:"size"`
+	OldSize   *uint64  `json:"old_size,omitempty"`
+	SizeDelta int64    `json:"size_delta"`
+	Metadata  []string `json:"metadata,omitempty"`
+}
 
-	return nil
+// diffResult is the JSON output of the diff command.
+type diffResult struct {
+	SourceSnapshot string       `json:"source_snapshot"`
+	TargetSnapshot string       `json:"target_snapshot"`
+	Changes        []diffChange `json:"changes"`
+	Stats          DiffStats    `json:"stats"`
 }
 
 func runDiff(opts DiffOptions, gopts GlobalOptions, args []string) error {
@@ -295,7 +167,7 @@ func runDiff(opts DiffOptions, gopts GlobalOptions, args []string) error {
 		return err
 	}
 
-	if err = repo.LoadIndex(ctx); err != nil {
+	if err = loadIndex(ctx, repo); err != nil {
 		return err
 	}
 
@@ -317,7 +189,9 @@ func runDiff(opts DiffOptions, gopts GlobalOptions, args []string) error {
 		return err
 	}
 
-	Verbosef("comparing snapshot %v to %v:\n\n", sn1.ID().Str(), sn2.ID().Str())
+	if !gopts.JSON {
+		Verbosef("comparing snapshot %v to %v:\n\n", sn1.ID().Str(), sn2.ID().Str())
+	}
 
 	if sn1.Tree == nil {
 		return errors.Errorf("snapshot %v has nil tree", sn1.ID().Str())
@@ -327,21 +201,74 @@ func runDiff(opts DiffOptions, gopts GlobalOptions, args []string) error {
 		return errors.Errorf("snapshot %v has nil tree", sn2.ID().Str())
 	}
 
-	c := &Comparer{
-		repo: repo,
-		opts: diffOptions,
+	res := diffResult{
+		SourceSnapshot: sn1.ID().String(),
+		TargetSnapshot: sn2.ID().String(),
+		Changes:        []diffChange{},
 	}
+	stats := &res.Stats
+
+	err = diff.Trees(ctx, repo, sn1.Tree, sn2.Tree, func(c diff.Change) error {
+		switch {
+		case c.Added():
+			stats.Added.Add(c.New)
+		case c.Removed():
+			stats.Removed.Add(c.Old)
+		case c.New.Type == "file" && c.ContentChanged():
+			stats.ChangedFiles++
+		}
 
-	stats := NewDiffStats()
+		mod := diffModifier(c, opts.ShowMetadata)
+		if mod == "" {
+			return nil
+		}
+
+		node := c.Node()
+		if gopts.JSON {
+			change := diffChange{
+				Path:      c.Path,
+				Modifier:  mod,
+				Type:      node.Type,
+				Size:      node.Size,
+				SizeDelta: c.SizeDelta(),
+				Metadata:  c.MetadataChanges(),
+			}
+			if !c.Added() && !c.Removed() {
+				oldSize := c.Old.Size
+				change.OldSize = &oldSize
+			}
+			res.Changes = append(res.Changes, change)
+			return nil
+		}
 
-	err = c.diffTree(ctx, stats, "/", *sn1.Tree, *sn2.Tree)
+		name := c.Path
+		if node.Type == "dir" {
+			name += "/"
+		}
+		Printf("%-5s%v\n", mod, name)
+		return nil
+	})
 	if err != nil {
 		return err
 	}
 
-	both := stats.BlobsBefore.Intersect(stats.BlobsAfter)
-	updateBlobs(repo, stats.BlobsBefore.Sub(both), &stats.Removed)
-	updateBlobs(repo, stats.BlobsAfter.Sub(both), &stats.Added)
+	// the blobs which are only referenced by one of the snapshots were added
+	// or removed
+	blobsBefore, blobsAfter := restic.NewBlobSet(), restic.NewBlobSet()
+	if err = restic.FindUsedBlobs(ctx, repo, *sn1.Tree, blobsBefore, restic.NewBlobSet()); err != nil {
+		return err
+	}
+	if err = restic.FindUsedBlobs(ctx, repo, *sn2.Tree, blobsAfter, restic.NewBlobSet()); err != nil {
+		return err
+	}
+
+	both := blobsBefore.Intersect(blobsAfter)
+	updateBlobs(repo, blobsBefore.Sub(both), &stats.Removed)
+	updateBlobs(repo, blobsAfter.Sub(both), &stats.Added)
+
+	if gopts.JSON {
+		return json.NewEncoder(gopts.stdout).Encode(res)
+	}
 
 	Printf("\n")
 	Printf("Files:       %5d new, %5d removed, %5d changed\n", stats.Added.Files, stats.Removed.Files, stats.ChangedFiles)
@@ -3,7 +3,8 @@ package main
 import (
 	"context"
 	"fmt"
-	"os"
+	"io"
+	"path"
 	"path/filepath"
 
 	"github.com/restic/restic/internal/debug"
@@ -14,11 +15,13 @@ import (
 )
 
 var cmdDump = &cobra.Command{
-	Use:   "dump [flags] snapshotID file",
-	Short: "Print a backed-up file to stdout",
+	Use:   "dump [flags] snapshotID path",
+	Short: "Print a backed-up file or directory to stdout",
 	Long: `
 The "dump" command extracts a single file from a snapshot from the repository and
-prints its contents to stdout.
+prints its contents to stdout. If the path is a directory, its contents are
+written as a tar archive, or a zip archive with --archive zip. Pass "/" to dump
+the whole snapshot.
 
 The special snapshot "latest" can be used to use the latest snapshot in the
 repository.
@@ -31,9 +34,10 @@ repository.
 
 // DumpOptions collects all options for the dump command.
 type DumpOptions struct {
-	Host  string
-	Paths []string
-	Tags  restic.TagLists
+	Host    string
+	Paths   []string
+	Tags    restic.TagLists
+	Archive string
 }
 
 var dumpOptions DumpOptions
@@ -45,6 +49,7 @@ func init() {
 	flags.StringVarP(&dumpOptions.Host, "host", "H", "", `only consider snapshots for this host when the snapshot ID is "latest"`)
 	flags.Var(&dumpOptions.Tags, "tag", "only consider snapshots which include this `taglist` for snapshot ID \"latest\"")
 	flags.StringArrayVar(&dumpOptions.Paths, "path", nil, "only consider snapshots which include this (absolute) `path` for snapshot ID \"latest\"")
+	flags.StringVar(&dumpOptions.Archive, "archive", "tar", "set the archive `format` for directories, \"tar\" or \"zip\"")
 }
 
 func splitPath(path string) []string {
@@ -56,64 +61,105 @@ func splitPath(path string) []string {
 	return append(s, f)
 }
 
-func dumpNode(ctx context.Context, repo restic.Repository, node *restic.Node) error {
-	var buf []byte
-	for _, id := range node.Content {
-		size, found := repo.LookupBlobSize(id, restic.DataBlob)
-		if !found {
-			return errors.Errorf("id %v not found in repository", id)
-		}
+func dumpNode(ctx context.Context, repo restic.Repository, node *restic.Node, w io.Writer) error {
+	return restic.LoadDataBlobs(ctx, repo, node.Content, func(data []byte) error {
+		_, err := w.Write(data)
+		return errors.Wrap(err, "Write")
+	})
+}
 
-		buf = buf[:cap(buf)]
-		if len(buf) < restic.CiphertextLength(int(size)) {
-			buf = restic.NewBlobBuffer(int(size))
-		}
+// dumpTree writes the items below the tree with the given id to w as an
+// archive. The names in the archive start with prefix, root is added as the
+// first item if it is not nil.
+func dumpTree(ctx context.Context, repo restic.Repository, format, location, prefix string, root *restic.Node, id restic.ID, w io.Writer) error {
+	items, err := collectArchiveItems(ctx, repo, format, location, prefix, id, func(string, string, *restic.Node) (bool, bool) {
+		return true, true
+	})
+	if err != nil {
+		return err
+	}
 
-		n, err := repo.LoadBlob(ctx, restic.DataBlob, id, buf)
-		if err != nil {
-			return err
-		}
-		buf = buf[:n]
+	if root != nil {
+		items = append([]exportItem{{name: prefix, node: root}}, items...)
+	}
 
-		_, err = os.Stdout.Write(buf)
-		if err != nil {
-			return errors.Wrap(err, "Write")
+	return writeArchive(format, w, items, func(node *restic.Node, w io.Writer) error {
+		return dumpNode(ctx, repo, node, w)
+	})
+}
+
+// printFromTree writes the file at the path made of pathComponents to w, or
+// an archive if it is a directory. An empty path dumps the whole tree, which
+// has the given id.
+func printFromTree(ctx context.Context, tree *restic.Tree, id restic.ID, repo restic.Repository, format string, pathComponents []string, w io.Writer) error {
+	if len(pathComponents) == 0 {
+		return dumpTree(ctx, repo, format, "/", "", nil, id, w)
+	}
+
+	node, err := lookupNodeInTree(ctx, tree, repo, "", pathComponents)
+	if err != nil {
+		return err
+	}
+
+	switch node.Type {
+	case "file":
+		return dumpNode(ctx, repo, node, w)
+	case "dir":
+		if node.Subtree == nil {
+			return errors.Errorf("dir %v has no subtree", node.Name)
 		}
+		return dumpTree(ctx, repo, format, "/"+path.Join(pathComponents...), node.Name, node, *node.Subtree, w)
 	}
-	return nil
+
+	return errors.Errorf("%q is a %v, only files and directories can be dumped", node.Name, node.Type)
 }
 
-func printFromTree(ctx context.Context, tree *restic.Tree, repo restic.Repository, prefix string, pathComponents []string) error {
+// findNodeInTree returns the file node at the path made of pathComponents,
+// starting at tree.
+func findNodeInTree(ctx context.Context, tree *restic.Tree, repo restic.Repository, prefix string, pathComponents []string) (*restic.Node, error) {
+	node, err := lookupNodeInTree(ctx, tree, repo, prefix, pathComponents)
+	if err != nil {
+		return nil, err
+	}
+
+	if node.Type != "file" {
+		return nil, fmt.Errorf("%q should be a file, but is a %q", filepath.Join(prefix, filepath.Join(pathComponents...)), node.Type)
+	}
+
+	return node, nil
+}
+
+// lookupNodeInTree returns the node of any type at the path made of
+// pathComponents, starting at tree.
+func lookupNodeInTree(ctx context.Context, tree *restic.Tree, repo restic.Repository, prefix string, pathComponents []string) (*restic.Node, error) {
 	if tree == nil {
-		return fmt.Errorf("called with a nil tree")
+		return nil, fmt.Errorf("called with a nil tree")
 	}
 	if repo == nil {
-		return fmt.Errorf("called with a nil repository")
+		return nil, fmt.Errorf("called with a nil repository")
 	}
 	l := len(pathComponents)
 	if l == 0 {
-		return fmt.Errorf("empty path components")
+		return nil, fmt.Errorf("empty path components")
 	}
 	item := filepath.Join(prefix, pathComponents[0])
 	for _, node := range tree.Nodes {
 		if node.Name == pathComponents[0] {
 			switch {
-			case l == 1 && node.Type == "file":
-				return dumpNode(ctx, repo, node)
-			case l > 1 && node.Type == "dir":
+			case l == 1:
+				return node, nil
+			case node.Type == "dir":
 				subtree, err := repo.LoadTree(ctx, *node.Subtree)
 				if err != nil {
-					return errors.Wrapf(err, "cannot load subtree for %q", item)
+					return nil, errors.Wrapf(err, "cannot load subtree for %q", item)
 				}
-				return printFromTree(ctx, subtree, repo, item, pathComponents[1:])
-			case l > 1:
-				return fmt.Errorf("%q should be a dir, but s a %q", item, node.Type)
-			case node.Type != "file":
-				return fmt.Errorf("%q should be a file, but is a %q", item, node.Type)
+				return lookupNodeInTree(ctx, subtree, repo, item, pathComponents[1:])
+			default:
+				return nil, fmt.Errorf("%q should be a dir, but is a %q", item, node.Type)
 			}
 		}
 	}
-	return fmt.Errorf("path %q not found in snapshot", item)
+	return nil, fmt.Errorf("path %q not found in snapshot", item)
 }
 
 func runDump(opts DumpOptions, gopts GlobalOptions, args []string) error {
@@ -123,12 +169,21 @@ func runDump(opts DumpOptions, gopts GlobalOptions, args []string) error {
 		return errors.Fatal("no file and no snapshot ID specified")
 	}
 
+	switch opts.Archive {
+	case "tar", "zip":
+	default:
+		return errors.Fatalf("unknown archive format %q, use \"tar\" or \"zip\"", opts.Archive)
+	}
+
 	snapshotIDString := args[0]
 	pathToPrint := args[1]
 
 	debug.Log("dump file %q from %q", pathToPrint, snapshotIDString)
 
-	splittedPath := splitPath(pathToPrint)
+	var splittedPath []string
+	if p := filepath.Clean(pathToPrint); p != "/" && p != "." {
+		splittedPath = splitPath(p)
+	}
 
 	repo, err := OpenRepository(gopts)
 	if err != nil {
@@ -143,7 +198,7 @@ func runDump(opts DumpOptions, gopts GlobalOptions, args []string) error {
 		}
 	}
 
-	err = repo.LoadIndex(ctx)
+	err = loadIndex(ctx, repo)
 	if err != nil {
 		return err
 	}
@@ -172,7 +227,7 @@ func runDump(opts DumpOptions, gopts GlobalOptions, args []string) error {
 		Exitf(2, "loading tree for snapshot %q failed: %v", snapshotIDString, err)
 	}
 
-	err = printFromTree(ctx, tree, repo, "", splittedPath)
+	err = printFromTree(ctx, tree, *sn.Tree, repo, opts.Archive, splittedPath, gopts.stdout)
 	if err != nil {
 		Exitf(2, "cannot dump file: %v", err)
 	}
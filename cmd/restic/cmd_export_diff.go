@@ -0,0 +1,283 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"os"
+	"strings"
+
+	"github.com/restic/restic/internal/diff"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+	"github.com/spf13/cobra"
+)
+
+var cmdExportDiff = &cobra.Command{
+	Use:   "export-diff [flags] snapshot-ID snapshot-ID",
+	Short: "Export the changes between two snapshots as a tar archive",
+	Long: `
+The "export-diff" command writes a tar archive which contains all items that
+were added or modified from the first to the second snapshot. Files whose
+content is unchanged are not included, unless --metadata is given and their
+metadata (mode, owner, timestamps) was updated.
+
+The first entry in the archive is a file (named ".restic-deleted" by default)
+which lists the paths of all items present in the first snapshot that need to
+be removed before the archive is extracted, one per line. Removed directories
+are listed once, their content is implied. Items whose type has changed (e.g. a
+directory was replaced by a file) are listed there as well.
+
+Applying the archive to a restored copy of the first snapshot yields the
+content of the second snapshot:
+
+    $ restic export-diff 79766175 ba02d7c5 --output changes.tar
+    $ tar -xOf changes.tar .restic-deleted | (cd /target && xargs -d '\n' rm -rf --)
+    $ tar -xf changes.tar -C /target --exclude .restic-deleted
+
+The archive is written to stdout unless --output is specified.
+`,
+	DisableAutoGenTag: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runExportDiff(exportDiffOptions, globalOptions, args)
+	},
+}
+
+// ExportDiffOptions collects all options for the export-diff command.
+type ExportDiffOptions struct {
+	Output      string
+	DeletedList string
+	Metadata    bool
+}
+
+var exportDiffOptions ExportDiffOptions
+
+func init() {
+	cmdRoot.AddCommand(cmdExportDiff)
+
+	f := cmdExportDiff.Flags()
+	f.StringVar(&exportDiffOptions.Output, "output", "", "write the archive to `file` instead of stdout")
+	f.StringVar(&exportDiffOptions.DeletedList, "deleted-list", ".restic-deleted", "store the list of removed paths as `name` in the archive")
+	f.BoolVar(&exportDiffOptions.Metadata, "metadata", false, "also export items where only the metadata was updated")
+}
+
+// exportItem is an item of the second snapshot that is written to the archive.
+type exportItem struct {
+	name string
+	node *restic.Node
+}
+
+// diffExporter collects the changes between two snapshots.
+type diffExporter struct {
+	repo restic.Repository
+	opts ExportDiffOptions
+
+	items       []exportItem
+	deleted     []string
+	lastDeleted string
+}
+
+// add records the change c, paths in the archive are relative.
+func (e *diffExporter) add(c diff.Change) error {
+	name := strings.TrimPrefix(c.Path, "/")
+
+	switch {
+	case c.Removed():
+		// the content of removed directories (also when the type changed) is
+		// implied by the directory
+		if e.lastDeleted != "" && strings.HasPrefix(name, e.lastDeleted+"/") {
+			return diff.SkipSubtree
+		}
+		e.deleted = append(e.deleted, name)
+		e.lastDeleted = name
+		return diff.SkipSubtree
+	case c.TypeChanged():
+		e.deleted = append(e.deleted, name)
+		e.lastDeleted = name
+	case !c.Added() && !c.ContentChanged() && !(e.opts.Metadata && c.MetadataChanged()):
+		return nil
+	}
+
+	e.items = append(e.items, exportItem{name: name, node: c.New})
+	return nil
+}
+
+// tarHeader returns the tar header for node.
+func tarHeader(name string, node *restic.Node) (*tar.Header, bool) {
+	mode := int64(node.Mode.Perm())
+	if node.Mode&os.ModeSetuid != 0 {
+		mode |= 04000
+	}
+	if node.Mode&os.ModeSetgid != 0 {
+		mode |= 02000
+	}
+	if node.Mode&os.ModeSticky != 0 {
+		mode |= 01000
+	}
+
+	hdr := &tar.Header{
+		Name:    name,
+		Mode:    mode,
+		Uid:     int(node.UID),
+		Gid:     int(node.GID),
+		Uname:   node.User,
+		Gname:   node.Group,
+		ModTime: node.ModTime,
+	}
+
+	if len(node.ExtendedAttributes) > 0 {
+		hdr.Xattrs = make(map[string]string, len(node.ExtendedAttributes))
+		for _, attr := range node.ExtendedAttributes {
+			hdr.Xattrs[attr.Name] = string(attr.Value)
+		}
+	}
+
+	switch node.Type {
+	case "file":
+		hdr.Typeflag = tar.TypeReg
+		hdr.Size = int64(node.Size)
+	case "dir":
+		hdr.Typeflag = tar.TypeDir
+		hdr.Name += "/"
+	case "symlink":
+		hdr.Typeflag = tar.TypeSymlink
+		hdr.Linkname = node.LinkTarget
+	case "fifo":
+		hdr.Typeflag = tar.TypeFifo
+	default:
+		return nil, false
+	}
+
+	return hdr, true
+}
+
+// write writes the list of removed paths and all collected items to tw.
+func (e *diffExporter) write(ctx context.Context, tw *tar.Writer) error {
+	if e.opts.DeletedList != "" {
+		buf := bytes.NewBuffer(nil)
+		for _, name := range e.deleted {
+			buf.WriteString(name + "\n")
+		}
+
+		hdr := &tar.Header{
+			Name:     e.opts.DeletedList,
+			Mode:     0644,
+			Typeflag: tar.TypeReg,
+			Size:     int64(buf.Len()),
+		}
+
+		if err := tw.WriteHeader(hdr); err != nil {
+			return errors.Wrap(err, "WriteHeader")
+		}
+
+		if _, err := tw.Write(buf.Bytes()); err != nil {
+			return errors.Wrap(err, "Write")
+		}
+	}
+
+	for _, item := range e.items {
+		hdr, ok := tarHeader(item.name, item.node)
+		if !ok {
+			Warnf("unable to export %v: type %v is not supported, skipping\n", item.name, item.node.Type)
+			continue
+		}
+
+		if err := tw.WriteHeader(hdr); err != nil {
+			return errors.Wrapf(err, "WriteHeader for %v", item.name)
+		}
+
+		if item.node.Type == "file" {
+			if err := dumpNode(ctx, e.repo, item.node, tw); err != nil {
+				return errors.Wrapf(err, "unable to export %v", item.name)
+			}
+		}
+	}
+
+	return errors.Wrap(tw.Close(), "Close")
+}
+
+func runExportDiff(opts ExportDiffOptions, gopts GlobalOptions, args []string) error {
+	if len(args) != 2 {
+		return errors.Fatalf("specify two snapshot IDs")
+	}
+
+	if strings.Contains(opts.DeletedList, "/") {
+		return errors.Fatal("the name for --deleted-list must not contain a slash")
+	}
+
+	if opts.Output == "" && stdoutIsTerminal() {
+		return errors.Fatal("refusing to write a tar archive to a terminal, use --output or redirect stdout")
+	}
+
+	ctx, cancel := context.WithCancel(gopts.ctx)
+	defer cancel()
+
+	repo, err := OpenRepository(gopts)
+	if err != nil {
+		return err
+	}
+
+	if !gopts.NoLock {
+		lock, err := lockRepo(repo)
+		defer unlockRepo(lock)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err = loadIndex(ctx, repo); err != nil {
+		return err
+	}
+
+	sn1, err := loadSnapshot(ctx, repo, args[0])
+	if err != nil {
+		return err
+	}
+
+	sn2, err := loadSnapshot(ctx, repo, args[1])
+	if err != nil {
+		return err
+	}
+
+	if sn1.Tree == nil {
+		return errors.Errorf("snapshot %v has nil tree", sn1.ID().Str())
+	}
+
+	if sn2.Tree == nil {
+		return errors.Errorf("snapshot %v has nil tree", sn2.ID().Str())
+	}
+
+	e := &diffExporter{
+		repo: repo,
+		opts: opts,
+	}
+
+	err = diff.Trees(ctx, repo, sn1.Tree, sn2.Tree, e.add)
+	if err != nil {
+		return err
+	}
+
+	if opts.Output == "" {
+		return e.write(ctx, tar.NewWriter(gopts.stdout))
+	}
+
+	f, err := os.Create(opts.Output)
+	if err != nil {
+		return errors.Fatalf("unable to create output file: %v", err)
+	}
+
+	err = e.write(ctx, tar.NewWriter(f))
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	if err = f.Close(); err != nil {
+		return errors.Wrap(err, "Close")
+	}
+
+	Verbosef("exported %d changed and %d removed items from snapshot %v to %v\n",
+		len(e.items), len(e.deleted), sn1.ID().Str(), sn2.ID().Str())
+
+	return nil
+}
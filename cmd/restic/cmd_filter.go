@@ -0,0 +1,294 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/restic/restic/internal/cache"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/filter"
+	"github.com/restic/restic/internal/fs"
+
+	"github.com/spf13/cobra"
+)
+
+var cmdFilterTest = &cobra.Command{
+	Use:   "filter-test [flags] [path ...]",
+	Short: "Show which include and exclude rules match paths",
+	Long: `
+The "filter-test" command checks paths against the include and exclude rules
+given with the same options as for "backup" (and --include as for "restore")
+and prints for each path whether it is included and which rule matched. This
+helps with debugging complex filters without running a backup.
+
+The paths are taken from the arguments, or read from stdin (one per line) if
+no arguments are given. With --walk, the arguments are directories which are
+traversed like during a backup, the contents of excluded directories are not
+listed. Paths are converted to absolute paths before they are matched, like
+during a backup. The paths do not need to exist unless --walk is used.
+
+Like during a backup, restic repositories and the cache directory are
+excluded unless --no-auto-exclude is given. The --one-file-system option
+needs --walk, the file systems of the directories given as arguments are
+allowed.
+`,
+	DisableAutoGenTag: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runFilterTest(filterTestOptions, globalOptions, args)
+	},
+}
+
+// FilterTestOptions collects all options for the filter-test command.
+type FilterTestOptions struct {
+	BackupOptions
+	Includes     []string
+	Walk         bool
+	ExcludedOnly bool
+}
+
+var filterTestOptions FilterTestOptions
+
+func init() {
+	cmdRoot.AddCommand(cmdFilterTest)
+
+	f := cmdFilterTest.Flags()
+	addExcludeFlags(f, &filterTestOptions.BackupOptions)
+	f.StringArrayVarP(&filterTestOptions.Includes, "include", "i", nil, "include a `pattern`, exclude everything else (can be specified multiple times)")
+	f.BoolVar(&filterTestOptions.Walk, "walk", false, "traverse the directories given as arguments")
+	f.BoolVar(&filterTestOptions.ExcludedOnly, "excluded-only", false, "only print excluded paths")
+}
+
+// filterResult is the result of testing a single path.
+type filterResult struct {
+	Path     string `json:"path"`
+	Included bool   `json:"included"`
+	Rule     string `json:"rule,omitempty"`
+}
+
+// filterTester checks paths against exclude rules and include patterns.
+type filterTester struct {
+	rules    []rejectRule
+	includes []string
+
+	// maxSize is the size limit of --exclude-larger-than, described by sizeRule
+	maxSize  uint64
+	sizeRule string
+}
+
+// newFilterTester builds the rules with the same helper as the backup
+// command, targets are the directories which would be saved. The restic cache
+// is excluded like during a backup unless --no-cache or --no-auto-exclude is
+// given.
+func newFilterTester(opts FilterTestOptions, gopts GlobalOptions, targets []string) (*filterTester, error) {
+	rules, maxSize, err := collectRejectRules(opts.BackupOptions, targets)
+	if err != nil {
+		return nil, err
+	}
+
+	// check the patterns once, so errors are not reported for each path
+	for _, rule := range rules {
+		if rule.name != "--exclude" && rule.name != "--iexclude" {
+			continue
+		}
+
+		if _, err := filter.Match(rule.arg, "/"); err != nil {
+			return nil, errors.Fatalf("invalid exclude pattern %q: %v", rule.arg, err)
+		}
+	}
+
+	for _, pattern := range opts.Includes {
+		if _, err := filter.Match(pattern, "/"); err != nil {
+			return nil, errors.Fatalf("invalid include pattern %q: %v", pattern, err)
+		}
+	}
+
+	if !opts.NoAutoExclude && !gopts.NoCache {
+		cacheDir := gopts.CacheDir
+		if cacheDir == "" {
+			cacheDir, err = cache.DefaultDir()
+			if err != nil {
+				Warnf("unable to locate the cache directory: %v\n", err)
+			}
+		}
+
+		if cacheDir != "" {
+			rules = append(rules, rejectRule{name: "restic cache", reject: rejectResticCacheDir(cacheDir)})
+		}
+	}
+
+	return &filterTester{
+		rules:    rules,
+		includes: opts.Includes,
+		maxSize:  maxSize,
+		sizeRule: fmt.Sprintf("--exclude-larger-than %q", opts.ExcludeLargerThan),
+	}, nil
+}
+
+// test returns whether the item is included and which rule decided this. fi
+// may be nil for paths which do not exist.
+func (t *filterTester) test(item string, fi os.FileInfo) filterResult {
+	res := filterResult{Path: item, Included: true}
+
+	for _, rule := range t.rules {
+		if rule.reject(item, fi) {
+			res.Included = false
+			res.Rule = rule.String()
+			return res
+		}
+	}
+
+	// the archiver skips large files after all other rules
+	if t.maxSize > 0 && fi != nil && fi.Mode().IsRegular() && uint64(fi.Size()) > t.maxSize {
+		res.Included = false
+		res.Rule = t.sizeRule
+		return res
+	}
+
+	if len(t.includes) == 0 {
+		return res
+	}
+
+	for _, pattern := range t.includes {
+		matched, childMayMatch, err := filter.List([]string{pattern}, item)
+		if err != nil {
+			Warnf("error for include pattern: %v\n", err)
+			continue
+		}
+
+		if matched {
+			res.Rule = fmt.Sprintf("--include %q", pattern)
+			return res
+		}
+
+		if childMayMatch && fi != nil && fi.IsDir() {
+			res.Rule = fmt.Sprintf("--include %q may match below this directory", pattern)
+			return res
+		}
+	}
+
+	res.Included = false
+	res.Rule = "no --include pattern matches"
+	return res
+}
+
+func runFilterTest(opts FilterTestOptions, gopts GlobalOptions, args []string) error {
+	if opts.Walk && len(args) == 0 {
+		return errors.Fatal("--walk needs at least one directory")
+	}
+
+	if opts.ExcludeOtherFS && !opts.Walk {
+		return errors.Fatal("--one-file-system needs --walk")
+	}
+
+	var targets []string
+	if opts.Walk {
+		for _, dir := range args {
+			if a, err := filepath.Abs(dir); err == nil {
+				dir = a
+			}
+			targets = append(targets, dir)
+		}
+	}
+
+	tester, err := newFilterTester(opts, gopts, targets)
+	if err != nil {
+		return err
+	}
+
+	var (
+		results  []filterResult
+		excluded int
+		tested   int
+	)
+
+	report := func(res filterResult) {
+		tested++
+		if !res.Included {
+			excluded++
+		}
+
+		if opts.ExcludedOnly && res.Included {
+			return
+		}
+
+		if gopts.JSON {
+			results = append(results, res)
+			return
+		}
+
+		status := "included"
+		if !res.Included {
+			status = "excluded"
+		}
+
+		if res.Rule == "" {
+			Printf("%v  %v\n", status, res.Path)
+		} else {
+			Printf("%v  %v  (%v)\n", status, res.Path, res.Rule)
+		}
+	}
+
+	testPath := func(item string) {
+		if a, err := filepath.Abs(item); err == nil {
+			item = a
+		}
+
+		fi, err := fs.Lstat(item)
+		if err != nil {
+			fi = nil
+		}
+
+		report(tester.test(item, fi))
+	}
+
+	switch {
+	case opts.Walk:
+		for _, dir := range targets {
+			err := filepath.Walk(dir, func(item string, fi os.FileInfo, err error) error {
+				if err != nil {
+					Warnf("%v\n", err)
+					return nil
+				}
+
+				res := tester.test(item, fi)
+				report(res)
+
+				if !res.Included && fi.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+	case len(args) > 0:
+		for _, item := range args {
+			testPath(item)
+		}
+
+	default:
+		sc := bufio.NewScanner(os.Stdin)
+		for sc.Scan() {
+			if sc.Text() == "" {
+				continue
+			}
+			testPath(sc.Text())
+		}
+
+		if err := sc.Err(); err != nil {
+			return errors.Wrap(err, "read paths")
+		}
+	}
+
+	if gopts.JSON {
+		return json.NewEncoder(gopts.stdout).Encode(results)
+	}
+
+	Verbosef("%d paths tested, %d excluded\n", tested, excluded)
+	return nil
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
@@ -15,11 +16,24 @@ import (
 )
 
 var cmdFind = &cobra.Command{
-	Use:   "find [flags] PATTERN",
-	Short: "Find a file or directory",
+	Use:   "find [flags] PATTERN...",
+	Short: "Find a file, a directory or restic IDs",
 	Long: `
 The "find" command searches for files or directories in snapshots stored in the
-repo. `,
+repo.
+
+With --history, the snapshots are searched ordered by time and for each
+matching path it is printed in which snapshot it was first and last seen, and
+in which snapshots it was modified, removed or added again. A path is reported
+as removed in the first snapshot after the last one containing it, so use
+--host, --path or --tag to only consider the snapshots of a single backup.
+
+With --blob, --tree or --pack, the arguments are IDs of data blobs, trees or
+pack files (which may be abbreviated) instead of a pattern, and the paths which
+reference them are printed for each snapshot. For packs, all blobs and trees
+stored in the pack are searched for. This helps to find the files affected by
+an error reported by "check".
+`,
 	DisableAutoGenTag: true,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		return runFind(findOptions, globalOptions, args)
@@ -33,9 +47,13 @@ type FindOptions struct {
 	Snapshots       []string
 	CaseInsensitive bool
 	ListLong        bool
+	History         bool
+	BlobID, TreeID  bool
+	PackID          bool
 	Host            string
 	Paths           []string
 	Tags            restic.TagLists
+	Labels          restic.Labels
 }
 
 var findOptions FindOptions
@@ -49,10 +67,15 @@ func init() {
 	f.StringArrayVarP(&findOptions.Snapshots, "snapshot", "s", nil, "snapshot `id` to search in (can be given multiple times)")
 	f.BoolVarP(&findOptions.CaseInsensitive, "ignore-case", "i", false, "ignore case for pattern")
 	f.BoolVarP(&findOptions.ListLong, "long", "l", false, "use a long listing format showing size and mode")
+	f.BoolVar(&findOptions.History, "history", false, "print when the matching paths were first and last seen, modified and removed")
+	f.BoolVar(&findOptions.BlobID, "blob", false, "pattern is a blob-ID")
+	f.BoolVar(&findOptions.TreeID, "tree", false, "pattern is a tree-ID")
+	f.BoolVar(&findOptions.PackID, "pack", false, "pattern is a pack-ID")
 
 	f.StringVarP(&findOptions.Host, "host", "H", "", "only consider snapshots for this `host`, when no snapshot ID is given")
 	f.Var(&findOptions.Tags, "tag", "only consider snapshots which include this `taglist`, when no snapshot-ID is given")
 	f.StringArrayVar(&findOptions.Paths, "path", nil, "only consider snapshots which include this (absolute) `path`, when no snapshot-ID is given")
+	f.Var(&findOptions.Labels, "label", "only consider snapshots which have the label `key=value`, when no snapshot-ID is given")
 }
 
 type findPattern struct {
@@ -178,6 +201,10 @@ type Finder struct {
 	pat      findPattern
 	out      statefulOutput
 	notfound restic.IDSet
+
+	// history collects the snapshots containing the matches instead of
+	// printing them, if set
+	history *findHistory
 }
 
 func (f *Finder) findInTree(ctx context.Context, treeID restic.ID, prefix string) error {
@@ -220,7 +247,11 @@ func (f *Finder) findInTree(ctx context.Context, treeID restic.ID, prefix string
 
 			debug.Log("    found match\n")
 			found = true
-			f.out.Print(prefix, node)
+			if f.history != nil {
+				f.history.add(filepath.Join(prefix, node.Name), node)
+			} else {
+				f.out.Print(prefix, node)
+			}
 		}
 
 		if node.Type == "dir" {
@@ -244,12 +275,48 @@ func (f *Finder) findInSnapshot(ctx context.Context, sn *restic.Snapshot) error
 	return f.findInTree(ctx, *sn.Tree, string(filepath.Separator))
 }
 
+// objectType returns the type of the IDs to search for, or "" for a pattern.
+func (opts FindOptions) objectType() (string, error) {
+	var types []string
+	if opts.BlobID {
+		types = append(types, "blob")
+	}
+	if opts.TreeID {
+		types = append(types, "tree")
+	}
+	if opts.PackID {
+		types = append(types, "pack")
+	}
+
+	switch {
+	case len(types) == 0:
+		return "", nil
+	case len(types) > 1:
+		return "", errors.Fatal("only one of --blob, --tree and --pack can be given")
+	case opts.History:
+		return "", errors.Fatalf("--history cannot be used with --%s", types[0])
+	}
+
+	return types[0], nil
+}
+
 func runFind(opts FindOptions, gopts GlobalOptions, args []string) error {
+	objectType, err := opts.objectType()
+	if err != nil {
+		return err
+	}
+
+	if objectType != "" {
+		if len(args) == 0 {
+			return errors.Fatalf("no %v ID given", objectType)
+		}
+		return findObjects(opts, gopts, objectType, args)
+	}
+
 	if len(args) != 1 {
 		return errors.Fatal("wrong number of arguments")
 	}
 
-	var err error
 	pat := findPattern{pattern: args[0]}
 	if opts.CaseInsensitive {
 		pat.pattern = strings.ToLower(pat.pattern)
@@ -281,7 +348,7 @@ func runFind(opts FindOptions, gopts GlobalOptions, args []string) error {
 		}
 	}
 
-	if err = repo.LoadIndex(gopts.ctx); err != nil {
+	if err = loadTreeIndex(gopts.ctx, repo); err != nil {
 		return err
 	}
 
@@ -294,7 +361,16 @@ func runFind(opts FindOptions, gopts GlobalOptions, args []string) error {
 		out:      statefulOutput{ListLong: opts.ListLong, JSON: globalOptions.JSON},
 		notfound: restic.NewIDSet(),
 	}
-	for sn := range FindFilteredSnapshots(ctx, repo, opts.Host, opts.Tags, opts.Paths, opts.Snapshots) {
+
+	if opts.History {
+		var snapshots restic.Snapshots
+		for sn := range FindLabeledSnapshots(ctx, repo, opts.Host, opts.Tags, opts.Paths, opts.Labels, opts.Snapshots) {
+			snapshots = append(snapshots, sn)
+		}
+		return findHistoryOf(ctx, f, snapshots, gopts)
+	}
+
+	for sn := range FindLabeledSnapshots(ctx, repo, opts.Host, opts.Tags, opts.Paths, opts.Labels, opts.Snapshots) {
 		if err = f.findInSnapshot(ctx, sn); err != nil {
 			return err
 		}
@@ -303,3 +379,58 @@ func runFind(opts FindOptions, gopts GlobalOptions, args []string) error {
 
 	return nil
 }
+
+// findObjects searches the snapshots for the paths which reference the
+// objects of the given type.
+func findObjects(opts FindOptions, gopts GlobalOptions, objectType string, ids []string) error {
+	repo, err := OpenRepository(gopts)
+	if err != nil {
+		return err
+	}
+
+	if !gopts.NoLock {
+		lock, err := lockRepo(repo)
+		defer unlockRepo(lock)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err = loadIndex(gopts.ctx, repo); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(gopts.ctx)
+	defer cancel()
+
+	f, err := newObjectFinder(ctx, repo, objectType, ids)
+	if err != nil {
+		return err
+	}
+
+	for sn := range FindLabeledSnapshots(ctx, repo, opts.Host, opts.Tags, opts.Paths, opts.Labels, opts.Snapshots) {
+		if err = f.findInSnapshot(ctx, sn); err != nil {
+			return err
+		}
+	}
+
+	return f.print(gopts)
+}
+
+// findHistoryOf searches the snapshots ordered by time and prints the history
+// of the matching paths.
+func findHistoryOf(ctx context.Context, f *Finder, snapshots restic.Snapshots, gopts GlobalOptions) error {
+	// restic.Snapshots sorts the newest snapshot first
+	sort.Sort(sort.Reverse(snapshots))
+
+	f.history = newFindHistory()
+	for _, sn := range snapshots {
+		f.history.startSnapshot(sn)
+		if err := f.findInSnapshot(ctx, sn); err != nil {
+			return err
+		}
+		f.history.finishSnapshot()
+	}
+
+	return f.history.print(gopts)
+}
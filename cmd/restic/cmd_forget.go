@@ -2,11 +2,7 @@ package main
 
 import (
 	"context"
-	"encoding/json"
-	"sort"
-	"strings"
 
-	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/restic"
 	"github.com/spf13/cobra"
 )
@@ -35,15 +31,26 @@ type ForgetOptions struct {
 	Yearly   int
 	KeepTags restic.TagLists
 
+	Within        restic.Duration
+	WithinHourly  restic.Duration
+	WithinDaily   restic.Duration
+	WithinWeekly  restic.Duration
+	WithinMonthly restic.Duration
+	WithinYearly  restic.Duration
+
 	Host    string
 	Tags    restic.TagLists
 	Paths   []string
+	Labels  restic.Labels
 	Compact bool
 
 	// Grouping
 	GroupBy string
 	DryRun  bool
 	Prune   bool
+
+	// used for --prune
+	PruneOptions PruneOptions
 }
 
 var forgetOptions ForgetOptions
@@ -58,6 +65,12 @@ func init() {
 	f.IntVarP(&forgetOptions.Weekly, "keep-weekly", "w", 0, "keep the last `n` weekly snapshots")
 	f.IntVarP(&forgetOptions.Monthly, "keep-monthly", "m", 0, "keep the last `n` monthly snapshots")
 	f.IntVarP(&forgetOptions.Yearly, "keep-yearly", "y", 0, "keep the last `n` yearly snapshots")
+	f.Var(&forgetOptions.Within, "keep-within", "keep snapshots that are newer than `duration` (eg. 1y5m7d2h) relative to the latest snapshot")
+	f.Var(&forgetOptions.WithinHourly, "keep-within-hourly", "keep hourly snapshots that are newer than `duration` (eg. 1y5m7d2h) relative to the latest snapshot")
+	f.Var(&forgetOptions.WithinDaily, "keep-within-daily", "keep daily snapshots that are newer than `duration` (eg. 1y5m7d2h) relative to the latest snapshot")
+	f.Var(&forgetOptions.WithinWeekly, "keep-within-weekly", "keep weekly snapshots that are newer than `duration` (eg. 1y5m7d2h) relative to the latest snapshot")
+	f.Var(&forgetOptions.WithinMonthly, "keep-within-monthly", "keep monthly snapshots that are newer than `duration` (eg. 1y5m7d2h) relative to the latest snapshot")
+	f.Var(&forgetOptions.WithinYearly, "keep-within-yearly", "keep yearly snapshots that are newer than `duration` (eg. 1y5m7d2h) relative to the latest snapshot")
 
 	f.Var(&forgetOptions.KeepTags, "keep-tag", "keep snapshots with this `taglist` (can be specified multiple times)")
 	// Sadly the commonly used shortcut `H` is already used.
@@ -66,156 +79,179 @@ func init() {
 	f.StringVar(&forgetOptions.Host, "hostname", "", "only consider snapshots with the given `hostname` (deprecated)")
 	f.Var(&forgetOptions.Tags, "tag", "only consider snapshots which include this `taglist` in the format `tag[,tag,...]` (can be specified multiple times)")
 	f.StringArrayVar(&forgetOptions.Paths, "path", nil, "only consider snapshots which include this (absolute) `path` (can be specified multiple times)")
+	f.Var(&forgetOptions.Labels, "label", "only consider snapshots which have the label `key=value` (can be specified multiple times)")
 	f.BoolVarP(&forgetOptions.Compact, "compact", "c", false, "use compact format")
 
 	f.StringVarP(&forgetOptions.GroupBy, "group-by", "g", "host,paths", "string for grouping snapshots by host,paths,tags")
 	f.BoolVarP(&forgetOptions.DryRun, "dry-run", "n", false, "do not delete anything, just print what would be done")
 	f.BoolVar(&forgetOptions.Prune, "prune", false, "automatically run the 'prune' command if snapshots have been removed")
+	addPruneOptions(cmdForget, &forgetOptions.PruneOptions)
 
 	f.SortFlags = false
 }
 
-func runForget(opts ForgetOptions, gopts GlobalOptions, args []string) error {
+// policy returns the policy given by the --keep-* options.
+func (opts ForgetOptions) policy() restic.ExpirePolicy {
+	return restic.ExpirePolicy{
+		Last:    opts.Last,
+		Hourly:  opts.Hourly,
+		Daily:   opts.Daily,
+		Weekly:  opts.Weekly,
+		Monthly: opts.Monthly,
+		Yearly:  opts.Yearly,
+		Tags:    opts.KeepTags,
+
+		Within:        opts.Within,
+		WithinHourly:  opts.WithinHourly,
+		WithinDaily:   opts.WithinDaily,
+		WithinWeekly:  opts.WithinWeekly,
+		WithinMonthly: opts.WithinMonthly,
+		WithinYearly:  opts.WithinYearly,
+	}
+}
+
+// forgetRemoveMessage is the JSON message for a snapshot removed by ID.
+type forgetRemoveMessage struct {
+	MessageType string     `json:"message_type"`
+	SnapshotID  *restic.ID `json:"snapshot_id"`
+	DryRun      bool       `json:"dry_run,omitempty"`
+}
+
+// forgetGroupMessage is the JSON message for a group of snapshots to which
+// the policy was applied.
+type forgetGroupMessage struct {
+	MessageType string                  `json:"message_type"`
+	GroupKey    restic.SnapshotGroupKey `json:"group_key"`
+	Keep        []Snapshot              `json:"keep"`
+	Remove      []Snapshot              `json:"remove"`
+}
+
+// forgetSummary is the JSON message printed at the end of forget.
+type forgetSummary struct {
+	MessageType      string `json:"message_type"`
+	RemovedSnapshots int    `json:"removed_snapshots"`
+	DryRun           bool   `json:"dry_run,omitempty"`
+}
+
+func runForget(opts ForgetOptions, gopts GlobalOptions, args []string) (err error) {
+	if opts.Prune {
+		if err = verifyPruneOptions(&opts.PruneOptions); err != nil {
+			return err
+		}
+	}
+
 	repo, err := OpenRepository(gopts)
 	if err != nil {
 		return err
 	}
 
+	if !opts.DryRun {
+		if err = checkDeleteAllowed(gopts, repo, "forget"); err != nil {
+			return err
+		}
+	}
+
 	lock, err := lockRepoExclusive(repo)
 	defer unlockRepo(lock)
 	if err != nil {
 		return err
 	}
 
-	// group by hostname and dirs
-	type key struct {
-		Hostname string
-		Paths    []string
-		Tags     []string
-	}
-	snapshotGroups := make(map[string]restic.Snapshots)
-
-	var GroupByTag bool
-	var GroupByHost bool
-	var GroupByPath bool
-	var GroupOptionList []string
-
-	GroupOptionList = strings.Split(opts.GroupBy, ",")
-
-	for _, option := range GroupOptionList {
-		switch option {
-		case "host":
-			GroupByHost = true
-		case "paths":
-			GroupByPath = true
-		case "tags":
-			GroupByTag = true
-		case "":
-		default:
-			return errors.Fatal("unknown grouping option: '" + option + "'")
-		}
+	finish := recordOperation(gopts, repo, "forget")
+	defer func() { finish(err) }()
+
+	groupBy, err := restic.ParseSnapshotGroupByOptions(opts.GroupBy)
+	if err != nil {
+		return err
 	}
 
+	var (
+		snapshots restic.Snapshots
+		// all snapshots in the repository, only loaded for --prune
+		all     restic.Snapshots
+		removed = restic.NewIDSet()
+	)
+
 	removeSnapshots := 0
+	p := newPrinter(gopts)
+	summary := forgetSummary{MessageType: msgSummary, DryRun: opts.DryRun}
 
 	ctx, cancel := context.WithCancel(gopts.ctx)
 	defer cancel()
-	for sn := range FindFilteredSnapshots(ctx, repo, opts.Host, opts.Tags, opts.Paths, args) {
-		if len(args) > 0 {
-			// When explicit snapshots args are given, remove them immediately.
-			if !opts.DryRun {
-				h := restic.Handle{Type: restic.SnapshotFile, Name: sn.ID().String()}
-				if err = repo.Backend().Remove(gopts.ctx, h); err != nil {
-					return err
+
+	// the snapshots are only loaded once for --prune, prune reuses the
+	// remaining ones
+	shareSnapshots := len(args) == 0 && opts.Prune
+	if shareSnapshots {
+		all, err = restic.LoadAllSnapshots(ctx, repo)
+		if err != nil {
+			return err
+		}
+		for _, sn := range restic.FilterSnapshots(all, opts.Host, opts.Tags, opts.Paths) {
+			if sn.HasLabels(opts.Labels) {
+				snapshots = append(snapshots, sn)
+			}
+		}
+	} else {
+		for sn := range FindLabeledSnapshots(ctx, repo, opts.Host, opts.Tags, opts.Paths, opts.Labels, args) {
+			if len(args) > 0 {
+				// When explicit snapshots args are given, remove them immediately.
+				if !opts.DryRun {
+					h := restic.Handle{Type: restic.SnapshotFile, Name: sn.ID().String()}
+					if err = repo.Backend().Remove(gopts.ctx, h); err != nil {
+						return err
+					}
+					Verbosef("removed snapshot %v\n", sn.ID().Str())
+					removeSnapshots++
+				} else {
+					Verbosef("would have removed snapshot %v\n", sn.ID().Str())
 				}
-				Verbosef("removed snapshot %v\n", sn.ID().Str())
-				removeSnapshots++
+				p.Message(forgetRemoveMessage{MessageType: msgRemove, SnapshotID: sn.ID(), DryRun: opts.DryRun})
+				summary.RemovedSnapshots++
 			} else {
-				Verbosef("would have removed snapshot %v\n", sn.ID().Str())
-			}
-		} else {
-			// Determining grouping-keys
-			var tags []string
-			var hostname string
-			var paths []string
-
-			if GroupByTag {
-				tags = sn.Tags
-				sort.StringSlice(tags).Sort()
-			}
-			if GroupByHost {
-				hostname = sn.Hostname
+				snapshots = append(snapshots, sn)
 			}
-			if GroupByPath {
-				paths = sn.Paths
-			}
-
-			sort.StringSlice(sn.Paths).Sort()
-			var k []byte
-			var err error
-
-			k, err = json.Marshal(key{Tags: tags, Hostname: hostname, Paths: paths})
-
-			if err != nil {
-				return err
-			}
-			snapshotGroups[string(k)] = append(snapshotGroups[string(k)], sn)
 		}
 	}
 
-	policy := restic.ExpirePolicy{
-		Last:    opts.Last,
-		Hourly:  opts.Hourly,
-		Daily:   opts.Daily,
-		Weekly:  opts.Weekly,
-		Monthly: opts.Monthly,
-		Yearly:  opts.Yearly,
-		Tags:    opts.KeepTags,
-	}
+	policy := opts.policy()
 
 	if policy.Empty() && len(args) == 0 {
 		Verbosef("no policy was specified, no snapshots will be removed\n")
 	}
 
 	if !policy.Empty() {
-		for k, snapshotGroup := range snapshotGroups {
-			var key key
-			if json.Unmarshal([]byte(k), &key) != nil {
-				return err
-			}
-
+		for _, group := range restic.GroupSnapshots(snapshots, groupBy) {
 			// Info
 			Verbosef("snapshots")
-			var infoStrings []string
-			if GroupByTag {
-				infoStrings = append(infoStrings, "tags ["+strings.Join(key.Tags, ", ")+"]")
-			}
-			if GroupByHost {
-				infoStrings = append(infoStrings, "host ["+key.Hostname+"]")
-			}
-			if GroupByPath {
-				infoStrings = append(infoStrings, "paths ["+strings.Join(key.Paths, ", ")+"]")
-			}
-			if infoStrings != nil {
-				Verbosef(" for (" + strings.Join(infoStrings, ", ") + ")")
+			if !groupBy.Empty() {
+				Verbosef(" for (" + group.Key.String(groupBy) + ")")
 			}
 			Verbosef(":\n\n")
 
-			keep, remove := restic.ApplyPolicy(snapshotGroup, policy)
+			keep, remove := restic.ApplyPolicy(group.Snapshots, policy)
 
-			if len(keep) != 0 && !gopts.Quiet {
+			if len(keep) != 0 && !gopts.Quiet && !gopts.JSON {
 				Printf("keep %d snapshots:\n", len(keep))
 				PrintSnapshots(globalOptions.stdout, keep, opts.Compact)
 				Printf("\n")
 			}
 
-			if len(remove) != 0 && !gopts.Quiet {
+			if len(remove) != 0 && !gopts.Quiet && !gopts.JSON {
 				Printf("remove %d snapshots:\n", len(remove))
 				PrintSnapshots(globalOptions.stdout, remove, opts.Compact)
 				Printf("\n")
 			}
 
+			p.Message(forgetGroupMessage{
+				MessageType: msgGroup,
+				GroupKey:    group.Key,
+				Keep:        newSnapshotsJSON(keep),
+				Remove:      newSnapshotsJSON(remove),
+			})
+
 			removeSnapshots += len(remove)
+			summary.RemovedSnapshots += len(remove)
 
 			if !opts.DryRun {
 				for _, sn := range remove {
@@ -224,15 +260,28 @@ func runForget(opts ForgetOptions, gopts GlobalOptions, args []string) error {
 					if err != nil {
 						return err
 					}
+					removed.Insert(*sn.ID())
 				}
 			}
 		}
 	}
 
+	p.Message(summary)
+
 	if removeSnapshots > 0 && opts.Prune {
 		Verbosef("%d snapshots have been removed, running prune\n", removeSnapshots)
 		if !opts.DryRun {
-			return pruneRepository(gopts, repo)
+			if !shareSnapshots {
+				return pruneRepository(gopts, opts.PruneOptions, repo)
+			}
+
+			var keep restic.Snapshots
+			for _, sn := range all {
+				if !removed.Has(*sn.ID()) {
+					keep = append(keep, sn)
+				}
+			}
+			return pruneKeeping(gopts, opts.PruneOptions, repo, keep)
 		}
 	}
 
@@ -1,8 +1,14 @@
 package main
 
 import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/restic/restic/internal/backend/tiered"
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
 
 	"github.com/spf13/cobra"
 )
@@ -12,27 +18,237 @@ var cmdInit = &cobra.Command{
 	Short: "Initialize a new repository",
 	Long: `
 The "init" command initializes a new repository.
+
+With --preset, the parameters for the new repository are chosen for a
+specific use case:
+
+ * paranoid: a much stronger key derivation for the password
+ * fast: a faster key derivation and larger pack files, which reduces the
+   number of requests to the backend
+ * archive: large pack files and chunks, which reduces the number of files
+   and the size of the index for data which rarely changes
+
+The chunk sizes can also be set with --chunk-min-size, --chunk-max-size and
+--chunk-avg-size. Larger chunks reduce the size of the index of huge
+repositories, but find fewer duplicates. The average size must be a power of
+two, chunks can be between 64 KiB and 128 MiB large.
+
+The global option --pack-size is saved in the config of the new repository,
+all clients then create pack files of at least this size. Larger pack files
+reduce the number of files and requests on backends with a high latency.
+
+With --append-only, clients refuse to remove or overwrite the snapshots, data
+and keys of the repository, which guards the history against being deleted by
+accident. Commands which remove data, like forget, prune and unlock, then
+require the global option --allow-delete. The check is done by the client
+only, it does not protect against a client which is controlled by an attacker.
 `,
 	DisableAutoGenTag: true,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		return runInit(globalOptions, args)
+		return runInit(initOptions, globalOptions, args)
 	},
 }
 
+// InitOptions bundles all options for the init command.
+type InitOptions struct {
+	Preset               string
+	RepositoryVersion    uint
+	IgnoreLifecycleRules bool
+	AppendOnly           bool
+
+	ChunkMinSize string
+	ChunkMaxSize string
+	ChunkAvgSize string
+}
+
+var initOptions InitOptions
+
 func init() {
 	cmdRoot.AddCommand(cmdInit)
+
+	f := cmdInit.Flags()
+	f.StringVar(&initOptions.Preset, "preset", "", "choose the parameters for the new repository from `preset` (paranoid, fast, archive)")
+	f.UintVar(&initOptions.RepositoryVersion, "repository-version", restic.RepoVersion, "create a repository with format `version`, version 2 cannot be read by older restic versions")
+	f.BoolVar(&initOptions.AppendOnly, "append-only", false, "protect snapshots, data and keys from being removed or overwritten, see --allow-delete")
+	f.StringVar(&initOptions.ChunkMinSize, "chunk-min-size", "", "minimal `size` of chunks (e.g. '1M', default 512K)")
+	f.StringVar(&initOptions.ChunkMaxSize, "chunk-max-size", "", "maximal `size` of chunks (e.g. '16M', default 8M)")
+	f.StringVar(&initOptions.ChunkAvgSize, "chunk-avg-size", "", "average `size` of chunks, a power of two (e.g. '4M', default 1M)")
+	f.BoolVar(&initOptions.IgnoreLifecycleRules, "ignore-lifecycle-rules", false, "create the repository even if the bucket has lifecycle rules which delete or hide its files")
+}
+
+// initPreset contains the parameters set by a preset for a new repository.
+// Zero values keep the defaults.
+type initPreset struct {
+	KDFTimeout     time.Duration
+	KDFMemory      int
+	MinPackSize    uint
+	ChunkerMinSize uint
+	ChunkerMaxSize uint
 }
 
-func runInit(gopts GlobalOptions, args []string) error {
+var initPresets = map[string]initPreset{
+	"paranoid": {
+		KDFTimeout: 3 * time.Second,
+		KDFMemory:  512,
+	},
+	"fast": {
+		KDFTimeout:  100 * time.Millisecond,
+		MinPackSize: 16 * 1024 * 1024,
+	},
+	"archive": {
+		MinPackSize:    64 * 1024 * 1024,
+		ChunkerMinSize: 1024 * 1024,
+		ChunkerMaxSize: 16 * 1024 * 1024,
+	},
+}
+
+// apply sets the parameters of the preset for the key derivation and in cfg.
+func (p initPreset) apply(cfg *restic.Config) {
+	if p.KDFTimeout != 0 {
+		repository.KDFTimeout = p.KDFTimeout
+	}
+	if p.KDFMemory != 0 {
+		repository.KDFMemory = p.KDFMemory
+	}
+
+	cfg.MinPackSize = p.MinPackSize
+	cfg.ChunkerMinSize = p.ChunkerMinSize
+	cfg.ChunkerMaxSize = p.ChunkerMaxSize
+}
+
+func initPresetNames() string {
+	var names []string
+	for name := range initPresets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// applyChunkSizes sets the chunk sizes given in opts in cfg and checks the
+// result.
+func applyChunkSizes(opts InitOptions, cfg *restic.Config) error {
+	for _, o := range []struct {
+		name  string
+		value string
+		set   func(uint64) error
+	}{
+		{"--chunk-min-size", opts.ChunkMinSize, func(size uint64) error {
+			cfg.ChunkerMinSize = uint(size)
+			return nil
+		}},
+		{"--chunk-max-size", opts.ChunkMaxSize, func(size uint64) error {
+			cfg.ChunkerMaxSize = uint(size)
+			return nil
+		}},
+		{"--chunk-avg-size", opts.ChunkAvgSize, func(size uint64) error {
+			if size == 0 || size&(size-1) != 0 {
+				return errors.New("not a power of two")
+			}
+			var n uint
+			for ; size > 1; size >>= 1 {
+				n++
+			}
+			cfg.ChunkerAverageBits = n
+			return nil
+		}},
+	} {
+		if o.value == "" {
+			continue
+		}
+
+		size, err := parseSize(o.value)
+		if err == nil && size > restic.MaxChunkSize {
+			err = errors.New("too large")
+		}
+		if err == nil {
+			err = o.set(size)
+		}
+		if err != nil {
+			return errors.Fatalf("invalid value for %v: %v", o.name, err)
+		}
+	}
+
+	if err := cfg.Valid(); err != nil {
+		return errors.Fatal(err.Error())
+	}
+
+	return nil
+}
+
+func runInit(opts InitOptions, gopts GlobalOptions, args []string) error {
 	if gopts.Repo == "" {
 		return errors.Fatal("Please specify repository location (-r)")
 	}
 
+	version := opts.RepositoryVersion
+	if version == 0 {
+		version = restic.RepoVersion
+	}
+
+	if version < restic.MinRepoVersion || version > restic.MaxRepoVersion {
+		return errors.Fatalf("unsupported repository version %d, valid versions are %d to %d",
+			version, restic.MinRepoVersion, restic.MaxRepoVersion)
+	}
+
+	cfg, err := restic.CreateConfig()
+	if err != nil {
+		return err
+	}
+	cfg.Version = version
+	cfg.AppendOnly = opts.AppendOnly
+
+	if opts.Preset != "" {
+		preset, ok := initPresets[opts.Preset]
+		if !ok {
+			return errors.Fatalf("unknown preset %q, valid presets are: %v", opts.Preset, initPresetNames())
+		}
+		preset.apply(&cfg)
+	}
+
+	// the global option --pack-size is saved in the config of a new
+	// repository
+	size, err := packSize(gopts)
+	if err != nil {
+		return err
+	}
+	if size != 0 {
+		cfg.MinPackSize = size
+	}
+
+	if err = applyChunkSizes(opts, &cfg); err != nil {
+		return err
+	}
+
 	be, err := create(gopts.Repo, gopts.extended)
 	if err != nil {
 		return errors.Fatalf("create repository at %s failed: %v\n", gopts.Repo, err)
 	}
 
+	if !opts.IgnoreLifecycleRules {
+		if err = checkLifecycle(gopts.ctx, be); err != nil {
+			return err
+		}
+	}
+	be = newTimeoutBackend(be, backendTimeout(gopts.Repo, gopts.extended))
+
+	if gopts.ColdRepo != "" {
+		cold, err := create(gopts.ColdRepo, gopts.extended)
+		if err != nil {
+			return errors.Fatalf("create cold repository at %s failed: %v\n", gopts.ColdRepo, err)
+		}
+
+		if !opts.IgnoreLifecycleRules {
+			if err = checkLifecycle(gopts.ctx, cold); err != nil {
+				return err
+			}
+		}
+
+		cold = newTimeoutBackend(cold, backendTimeout(gopts.ColdRepo, gopts.extended))
+		be = tiered.New(be, cold)
+	}
+	be = newRetryBackend(be)
+
 	gopts.password, err = ReadPasswordTwice(gopts,
 		"enter password for new repository: ",
 		"enter password again: ")
@@ -42,12 +258,25 @@ func runInit(gopts GlobalOptions, args []string) error {
 
 	s := repository.New(be)
 
-	err = s.Init(gopts.ctx, gopts.password)
+	err = s.InitWithConfig(gopts.ctx, gopts.password, cfg)
 	if err != nil {
 		return errors.Fatalf("create key in repository at %s failed: %v\n", gopts.Repo, err)
 	}
 
 	Verbosef("created restic repository %v at %s\n", s.Config().ID[:10], gopts.Repo)
+	if opts.Preset != "" {
+		chunkMin, chunkMax := cfg.ChunkerBoundaries()
+		Verbosef("using preset %v: pack size %v, chunk size %v to %v\n", opts.Preset,
+			formatBytes(uint64(cfg.PackSize())), formatBytes(uint64(chunkMin)), formatBytes(uint64(chunkMax)))
+	}
+	if size != 0 {
+		Verbosef("pack size %v\n", formatBytes(uint64(cfg.PackSize())))
+	}
+	if opts.ChunkMinSize != "" || opts.ChunkMaxSize != "" || opts.ChunkAvgSize != "" {
+		chunkMin, chunkMax := cfg.ChunkerBoundaries()
+		Verbosef("chunk size %v to %v, %v on average\n",
+			formatBytes(uint64(chunkMin)), formatBytes(uint64(chunkMax)), formatBytes(cfg.ChunkerAverageSize()))
+	}
 	Verbosef("\n")
 	Verbosef("Please note that knowledge of your password is required to access\n")
 	Verbosef("the repository. Losing your password means that your data is\n")
@@ -16,15 +16,34 @@ var cmdKey = &cobra.Command{
 	Short: "Manage keys (passwords)",
 	Long: `
 The "key" command manages keys (passwords) for accessing the repository.
+
+For "add" and "passwd", the new password is read from the file given with
+--new-password-file, otherwise it is prompted for. The parameters of the key
+derivation function (scrypt) are calibrated to take about 500ms on this
+machine and are stored in the new key. They can be tuned with the extended
+options "kdf.timeout" and "kdf.memory", or set directly with "kdf.n", "kdf.r"
+and "kdf.p".
 `,
 	DisableAutoGenTag: true,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		return runKey(globalOptions, args)
+		return runKey(keyOptions, globalOptions, args)
 	},
 }
 
+// KeyOptions collects all options for the key command.
+type KeyOptions struct {
+	NewPasswordFile       string
+	NewInsecureNoPassword bool
+}
+
+var keyOptions KeyOptions
+
 func init() {
 	cmdRoot.AddCommand(cmdKey)
+
+	f := cmdKey.Flags()
+	f.StringVar(&keyOptions.NewPasswordFile, "new-password-file", "", "read the new password from `file` for add and passwd")
+	f.BoolVar(&keyOptions.NewInsecureNoPassword, "new-insecure-no-password", false, "use an empty password for the new key for add and passwd (insecure)")
 }
 
 func listKeys(ctx context.Context, s *repository.Repository) error {
@@ -59,23 +78,44 @@ func listKeys(ctx context.Context, s *repository.Repository) error {
 // testKeyNewPassword is used to set a new password during integration testing.
 var testKeyNewPassword string
 
-func getNewPassword(gopts GlobalOptions) (string, error) {
+func getNewPassword(opts KeyOptions, gopts GlobalOptions) (string, error) {
+	if opts.NewInsecureNoPassword {
+		if opts.NewPasswordFile != "" {
+			return "", errors.Fatal("--new-insecure-no-password must not be used together with --new-password-file")
+		}
+		return "", nil
+	}
+
 	if testKeyNewPassword != "" {
 		return testKeyNewPassword, nil
 	}
 
+	if opts.NewPasswordFile != "" {
+		pw, err := loadPasswordFromFile(opts.NewPasswordFile)
+		if err != nil {
+			return "", err
+		}
+
+		if pw == "" {
+			return "", errors.Fatalf("password file %v is empty, use --new-insecure-no-password for an empty password", opts.NewPasswordFile)
+		}
+
+		return pw, nil
+	}
+
 	// Since we already have an open repository, temporary remove the password
 	// to prompt the user for the passwd.
 	newopts := gopts
 	newopts.password = ""
+	newopts.InsecureNoPassword = false
 
 	return ReadPasswordTwice(newopts,
 		"enter password for new key: ",
 		"enter password again: ")
 }
 
-func addKey(gopts GlobalOptions, repo *repository.Repository) error {
-	pw, err := getNewPassword(gopts)
+func addKey(opts KeyOptions, gopts GlobalOptions, repo *repository.Repository) error {
+	pw, err := getNewPassword(opts, gopts)
 	if err != nil {
 		return err
 	}
@@ -105,8 +145,8 @@ func deleteKey(ctx context.Context, repo *repository.Repository, name string) er
 	return nil
 }
 
-func changePassword(gopts GlobalOptions, repo *repository.Repository) error {
-	pw, err := getNewPassword(gopts)
+func changePassword(opts KeyOptions, gopts GlobalOptions, repo *repository.Repository) error {
+	pw, err := getNewPassword(opts, gopts)
 	if err != nil {
 		return err
 	}
@@ -127,7 +167,7 @@ func changePassword(gopts GlobalOptions, repo *repository.Repository) error {
 	return nil
 }
 
-func runKey(gopts GlobalOptions, args []string) error {
+func runKey(opts KeyOptions, gopts GlobalOptions, args []string) error {
 	if len(args) < 1 || (args[0] == "remove" && len(args) != 2) || (args[0] != "remove" && len(args) != 1) {
 		return errors.Fatal("wrong number of arguments")
 	}
@@ -142,12 +182,7 @@ func runKey(gopts GlobalOptions, args []string) error {
 
 	switch args[0] {
 	case "list":
-		lock, err := lockRepo(repo)
-		defer unlockRepo(lock)
-		if err != nil {
-			return err
-		}
-
+		// reading the keys needs no lock, see lock.go
 		return listKeys(ctx, repo)
 	case "add":
 		lock, err := lockRepo(repo)
@@ -156,8 +191,12 @@ func runKey(gopts GlobalOptions, args []string) error {
 			return err
 		}
 
-		return addKey(gopts, repo)
+		return addKey(opts, gopts, repo)
 	case "remove":
+		if err = checkDeleteAllowed(gopts, repo, "key remove"); err != nil {
+			return err
+		}
+
 		lock, err := lockRepoExclusive(repo)
 		defer unlockRepo(lock)
 		if err != nil {
@@ -171,13 +210,17 @@ func runKey(gopts GlobalOptions, args []string) error {
 
 		return deleteKey(gopts.ctx, repo, id)
 	case "passwd":
+		if err = checkDeleteAllowed(gopts, repo, "key passwd"); err != nil {
+			return err
+		}
+
 		lock, err := lockRepoExclusive(repo)
 		defer unlockRepo(lock)
 		if err != nil {
 			return err
 		}
 
-		return changePassword(gopts, repo)
+		return changePassword(opts, gopts, repo)
 	}
 
 	return nil
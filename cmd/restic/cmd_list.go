@@ -36,14 +36,7 @@ func runList(opts GlobalOptions, args []string) error {
 		return err
 	}
 
-	if !opts.NoLock {
-		lock, err := lockRepo(repo)
-		defer unlockRepo(lock)
-		if err != nil {
-			return err
-		}
-	}
-
+	// listing files needs no lock, see lock.go
 	var t restic.FileType
 	switch args[0] {
 	case "packs":
@@ -2,7 +2,12 @@ package main
 
 import (
 	"context"
+	"os"
+	"path"
 	"path/filepath"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 
@@ -12,12 +17,28 @@ import (
 )
 
 var cmdLs = &cobra.Command{
-	Use:   "ls [flags] [snapshot-ID ...]",
+	Use:   "ls [flags] [snapshot-ID ...] [dir ...]",
 	Short: "List files in a snapshot",
 	Long: `
 The "ls" command allows listing files and directories in a snapshot.
 
 The special snapshot-ID "latest" can be used to list files and directories of the latest snapshot in the repository.
+
+Arguments starting with a slash are directories within the snapshots. If
+directories are given, only their contents are listed, and the contents of
+subdirectories only with --recursive. Without directories, all files and
+directories of the snapshots are listed.
+
+With --json, each file and directory is printed as a JSON object on a line of
+its own, including all metadata stored in the snapshot (e.g. the extended
+attributes and the IDs of the data blobs), so the contents of snapshots can be
+indexed by other programs.
+
+The entries of each directory can be sorted by name, size or modification time
+with --sort. Sorting by size or time lists the largest or newest entries first.
+With --dir-size (implied by --sort size), the size shown for a directory in
+the long listing is the cumulative size of all files below it, so the largest
+subtrees of a snapshot can be found easily.
 `,
 	DisableAutoGenTag: true,
 	RunE: func(cmd *cobra.Command, args []string) error {
@@ -27,10 +48,13 @@ The special snapshot-ID "latest" can be used to list files and directories of th
 
 // LsOptions collects all options for the ls command.
 type LsOptions struct {
-	ListLong bool
-	Host     string
-	Tags     restic.TagLists
-	Paths    []string
+	ListLong  bool
+	Host      string
+	Tags      restic.TagLists
+	Paths     []string
+	Sort      string
+	DirSize   bool
+	Recursive bool
 }
 
 var lsOptions LsOptions
@@ -44,19 +68,260 @@ func init() {
 	flags.StringVarP(&lsOptions.Host, "host", "H", "", "only consider snapshots for this `host`, when no snapshot ID is given")
 	flags.Var(&lsOptions.Tags, "tag", "only consider snapshots which include this `taglist`, when no snapshot ID is given")
 	flags.StringArrayVar(&lsOptions.Paths, "path", nil, "only consider snapshots which include this (absolute) `path`, when no snapshot ID is given")
+	flags.StringVar(&lsOptions.Sort, "sort", "", "sort the entries of each directory by `field` (name, size, mtime)")
+	flags.BoolVar(&lsOptions.DirSize, "dir-size", false, "show the cumulative size of all files below a directory")
+	flags.BoolVar(&lsOptions.Recursive, "recursive", false, "include the contents of subdirectories of the given directories")
+}
+
+// lsFilter selects the nodes which are listed. Paths are slash separated and
+// absolute within the snapshot.
+type lsFilter struct {
+	dirs      []string
+	recursive bool
+}
+
+// newLsFilter returns a filter for the directories dirs. All nodes are
+// listed if dirs is empty.
+func newLsFilter(dirs []string, recursive bool) *lsFilter {
+	f := &lsFilter{recursive: recursive}
+	for _, dir := range dirs {
+		f.dirs = append(f.dirs, path.Clean("/"+filepath.ToSlash(dir)))
+	}
+	return f
+}
+
+// within returns true if nodePath is dir or below it.
+func within(nodePath, dir string) bool {
+	return nodePath == dir || strings.HasPrefix(nodePath, strings.TrimSuffix(dir, "/")+"/")
+}
+
+// list returns true if the node at nodePath is listed.
+func (f *lsFilter) list(nodePath string) bool {
+	if len(f.dirs) == 0 {
+		return true
+	}
+
+	for _, dir := range f.dirs {
+		if nodePath == dir || !within(nodePath, dir) {
+			continue
+		}
+		if f.recursive || path.Dir(nodePath) == dir {
+			return true
+		}
+	}
+	return false
+}
+
+// descend returns true if the directory at nodePath may contain nodes which
+// are listed.
+func (f *lsFilter) descend(nodePath string) bool {
+	if len(f.dirs) == 0 {
+		return true
+	}
+
+	for _, dir := range f.dirs {
+		// the directory is on the way to dir
+		if within(dir, nodePath) {
+			return true
+		}
+		if f.recursive && within(nodePath, dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// lsEntry is a node of a snapshot loaded into memory, so that the entries
+// can be sorted and the size of directories can be computed.
+type lsEntry struct {
+	node     *restic.Node
+	size     uint64
+	children []*lsEntry
 }
 
-func printTree(ctx context.Context, repo *repository.Repository, id *restic.ID, prefix string) error {
+// loadLsTree loads the tree id and all subtrees. The size of each directory
+// entry is the sum of the sizes of all files below it.
+func loadLsTree(ctx context.Context, repo *repository.Repository, id restic.ID) (entries []*lsEntry, size uint64, err error) {
+	tree, err := repo.LoadTree(ctx, id)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	entries = make([]*lsEntry, 0, len(tree.Nodes))
+	for _, node := range tree.Nodes {
+		entry := &lsEntry{node: node}
+
+		switch {
+		case node.Type == "dir" && node.Subtree != nil:
+			entry.children, entry.size, err = loadLsTree(ctx, repo, *node.Subtree)
+			if err != nil {
+				return nil, 0, err
+			}
+		case node.Type == "file":
+			entry.size = node.Size
+		}
+
+		size += entry.size
+		entries = append(entries, entry)
+	}
+
+	return entries, size, nil
+}
+
+// sortLsEntries sorts entries and all children by field.
+func sortLsEntries(entries []*lsEntry, field string) {
+	var less func(a, b *lsEntry) bool
+
+	switch field {
+	case "name":
+		less = func(a, b *lsEntry) bool {
+			return a.node.Name < b.node.Name
+		}
+	case "size":
+		less = func(a, b *lsEntry) bool {
+			if a.size != b.size {
+				return a.size > b.size
+			}
+			return a.node.Name < b.node.Name
+		}
+	case "mtime":
+		less = func(a, b *lsEntry) bool {
+			if !a.node.ModTime.Equal(b.node.ModTime) {
+				return a.node.ModTime.After(b.node.ModTime)
+			}
+			return a.node.Name < b.node.Name
+		}
+	default:
+		return
+	}
+
+	var sortAll func([]*lsEntry)
+	sortAll = func(entries []*lsEntry) {
+		sort.SliceStable(entries, func(i, j int) bool {
+			return less(entries[i], entries[j])
+		})
+
+		for _, entry := range entries {
+			sortAll(entry.children)
+		}
+	}
+
+	sortAll(entries)
+}
+
+// lsNodeMessage is the JSON message for a node printed by ls, it contains
+// all metadata of the node.
+type lsNodeMessage struct {
+	MessageType string      `json:"message_type"`
+	Path        string      `json:"path"`
+	Name        string      `json:"name"`
+	Type        string      `json:"type"`
+	Size        uint64      `json:"size"`
+	Mode        os.FileMode `json:"mode"`
+	ModTime     time.Time   `json:"mtime"`
+	AccessTime  time.Time   `json:"atime"`
+	ChangeTime  time.Time   `json:"ctime"`
+	UID         uint32      `json:"uid"`
+	GID         uint32      `json:"gid"`
+	User        string      `json:"user,omitempty"`
+	Group       string      `json:"group,omitempty"`
+	Inode       uint64      `json:"inode,omitempty"`
+	DeviceID    uint64      `json:"device_id,omitempty"`
+	Links       uint64      `json:"links,omitempty"`
+	LinkTarget  string      `json:"link_target,omitempty"`
+	Device      uint64      `json:"device,omitempty"`
+
+	ExtendedAttributes []restic.ExtendedAttribute `json:"extended_attributes,omitempty"`
+	SecurityDescriptor []byte                     `json:"security_descriptor,omitempty"`
+
+	Content restic.IDs `json:"content,omitempty"`
+	Subtree *restic.ID `json:"subtree,omitempty"`
+}
+
+// lsSnapshotMessage is the JSON message printed by ls before the nodes of a
+// snapshot.
+type lsSnapshotMessage struct {
+	MessageType string `json:"message_type"`
+	Snapshot
+}
+
+// lsPrintFunc prints node, which is located in the directory prefix.
+type lsPrintFunc func(prefix string, node *restic.Node)
+
+// newLsPrintFunc returns the function which prints the nodes, either as text
+// or as JSON messages.
+func newLsPrintFunc(p *printer, long bool) lsPrintFunc {
+	if !p.json {
+		return func(prefix string, node *restic.Node) {
+			Printf("%s\n", formatNode(prefix, node, long))
+		}
+	}
+
+	return func(prefix string, node *restic.Node) {
+		p.Message(lsNodeMessage{
+			MessageType: msgNode,
+			Path:        filepath.Join(prefix, node.Name),
+			Name:        node.Name,
+			Type:        node.Type,
+			Size:        node.Size,
+			Mode:        node.Mode,
+			ModTime:     node.ModTime,
+			AccessTime:  node.AccessTime,
+			ChangeTime:  node.ChangeTime,
+			UID:         node.UID,
+			GID:         node.GID,
+			User:        node.User,
+			Group:       node.Group,
+			Inode:       node.Inode,
+			DeviceID:    node.DeviceID,
+			Links:       node.Links,
+			LinkTarget:  node.LinkTarget,
+			Device:      node.Device,
+
+			ExtendedAttributes: node.ExtendedAttributes,
+			SecurityDescriptor: node.SecurityDescriptor,
+
+			Content: node.Content,
+			Subtree: node.Subtree,
+		})
+	}
+}
+
+func printLsEntries(entries []*lsEntry, prefix string, filter *lsFilter, printNode lsPrintFunc) {
+	for _, entry := range entries {
+		nodePath := filepath.Join(prefix, entry.node.Name)
+
+		node := entry.node
+		if node.Type == "dir" {
+			// show the cumulative size instead of the size of the directory itself
+			n := *node
+			n.Size = entry.size
+			node = &n
+		}
+
+		if filter.list(filepath.ToSlash(nodePath)) {
+			printNode(prefix, node)
+		}
+		if filter.descend(filepath.ToSlash(nodePath)) {
+			printLsEntries(entry.children, nodePath, filter, printNode)
+		}
+	}
+}
+
+func printTree(ctx context.Context, repo *repository.Repository, id *restic.ID, prefix string, filter *lsFilter, printNode lsPrintFunc) error {
 	tree, err := repo.LoadTree(ctx, *id)
 	if err != nil {
 		return err
 	}
 
 	for _, entry := range tree.Nodes {
-		Printf("%s\n", formatNode(prefix, entry, lsOptions.ListLong))
+		nodePath := filepath.Join(prefix, entry.Name)
+		if filter.list(filepath.ToSlash(nodePath)) {
+			printNode(prefix, entry)
+		}
 
-		if entry.Type == "dir" && entry.Subtree != nil {
-			if err = printTree(ctx, repo, entry.Subtree, filepath.Join(prefix, entry.Name)); err != nil {
+		if entry.Type == "dir" && entry.Subtree != nil && filter.descend(filepath.ToSlash(nodePath)) {
+			if err = printTree(ctx, repo, entry.Subtree, nodePath, filter, printNode); err != nil {
 				return err
 			}
 		}
@@ -65,28 +330,77 @@ func printTree(ctx context.Context, repo *repository.Repository, id *restic.ID,
 	return nil
 }
 
+// splitLsArgs splits the arguments of ls into snapshot IDs and directories,
+// which start with a slash.
+func splitLsArgs(args []string) (snapshotIDs, dirs []string) {
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "/") || strings.HasPrefix(arg, string(filepath.Separator)) {
+			dirs = append(dirs, arg)
+			continue
+		}
+		snapshotIDs = append(snapshotIDs, arg)
+	}
+	return snapshotIDs, dirs
+}
+
 func runLs(opts LsOptions, gopts GlobalOptions, args []string) error {
+	args, dirs := splitLsArgs(args)
 	if len(args) == 0 && opts.Host == "" && len(opts.Tags) == 0 && len(opts.Paths) == 0 {
 		return errors.Fatal("Invalid arguments, either give one or more snapshot IDs or set filters.")
 	}
 
+	switch opts.Sort {
+	case "", "name", "mtime":
+	case "size":
+		opts.DirSize = true
+	default:
+		return errors.Fatalf("invalid sort field %q, must be one of name, size, mtime", opts.Sort)
+	}
+
 	repo, err := OpenRepository(gopts)
 	if err != nil {
 		return err
 	}
 
-	if err = repo.LoadIndex(gopts.ctx); err != nil {
+	if !gopts.NoLock {
+		lock, err := lockRepo(repo)
+		defer unlockRepo(lock)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err = loadTreeIndex(gopts.ctx, repo); err != nil {
 		return err
 	}
 
+	p := newPrinter(gopts)
+	printNode := newLsPrintFunc(p, opts.ListLong)
+	filter := newLsFilter(dirs, opts.Recursive || len(dirs) == 0)
+
 	ctx, cancel := context.WithCancel(gopts.ctx)
 	defer cancel()
 	for sn := range FindFilteredSnapshots(ctx, repo, opts.Host, opts.Tags, opts.Paths, args) {
 		Verbosef("snapshot %s of %v at %s):\n", sn.ID().Str(), sn.Paths, sn.Time)
+		p.Message(lsSnapshotMessage{
+			MessageType: msgSnapshot,
+			Snapshot:    Snapshot{Snapshot: sn, ID: sn.ID(), ShortID: sn.ID().Str()},
+		})
 
-		if err = printTree(gopts.ctx, repo, sn.Tree, string(filepath.Separator)); err != nil {
+		if opts.Sort == "" && !opts.DirSize {
+			if err = printTree(gopts.ctx, repo, sn.Tree, string(filepath.Separator), filter, printNode); err != nil {
+				return err
+			}
+			continue
+		}
+
+		entries, _, err := loadLsTree(ctx, repo, *sn.Tree)
+		if err != nil {
 			return err
 		}
+
+		sortLsEntries(entries, opts.Sort)
+		printLsEntries(entries, string(filepath.Separator), filter, printNode)
 	}
 	return nil
 }
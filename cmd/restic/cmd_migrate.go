@@ -1,6 +1,10 @@
 package main
 
 import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/migrations"
 	"github.com/restic/restic/internal/restic"
 
@@ -13,6 +17,14 @@ var cmdMigrate = &cobra.Command{
 	Long: `
 The "migrate" command applies migrations to a repository. When no migration
 name is explicitly given, a list of migrations that can be applied is printed.
+
+With --dry-run, the checks for the given migrations are run and it is printed
+which migrations would be applied, but the repository is not modified.
+
+Each migration that is applied is recorded in the repository, together with
+the information needed to undo it. Migrations which have already been applied
+are skipped unless --force is given, so the command can safely be run again,
+e.g. when a migration is rolled out to many repositories.
 `,
 	DisableAutoGenTag: true,
 	RunE: func(cmd *cobra.Command, args []string) error {
@@ -20,30 +32,98 @@ name is explicitly given, a list of migrations that can be applied is printed.
 	},
 }
 
-// MigrateOptions bundles all options for the 'check' command.
+var cmdMigrateList = &cobra.Command{
+	Use:   "list",
+	Short: "List migrations and whether they were applied",
+	Long: `
+The "migrate list" command prints all migrations known to this version of
+restic, whether they can be applied to the repository and when they were
+applied.
+`,
+	DisableAutoGenTag: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runMigrateList(globalOptions)
+	},
+}
+
+var cmdMigrateApply = &cobra.Command{
+	Use:   "apply name [name...]",
+	Short: "Apply migrations to the repository",
+	Long: `
+The "migrate apply" command applies the given migrations, it is the same as
+calling "migrate" with the names of the migrations.
+`,
+	DisableAutoGenTag: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) == 0 {
+			return errors.Fatal("no migration given")
+		}
+		return runMigrate(migrateOptions, globalOptions, args)
+	},
+}
+
+// MigrateOptions bundles all options for the 'migrate' command.
 type MigrateOptions struct {
-	Force bool
+	Force  bool
+	DryRun bool
 }
 
 var migrateOptions MigrateOptions
 
 func init() {
 	cmdRoot.AddCommand(cmdMigrate)
-	f := cmdMigrate.Flags()
+	cmdMigrate.AddCommand(cmdMigrateList)
+	cmdMigrate.AddCommand(cmdMigrateApply)
+
+	f := cmdMigrate.PersistentFlags()
 	f.BoolVarP(&migrateOptions.Force, "force", "f", false, `apply a migration a second time`)
+	f.BoolVarP(&migrateOptions.DryRun, "dry-run", "n", false, "do not modify the repository, just print which migrations would be applied")
 }
 
-func checkMigrations(opts MigrateOptions, gopts GlobalOptions, repo restic.Repository) error {
+// migrationStatus is used to print a migration as JSON.
+type migrationStatus struct {
+	Name       string             `json:"name"`
+	Desc       string             `json:"description"`
+	Applicable bool               `json:"applicable"`
+	Applied    *migrations.Record `json:"applied,omitempty"`
+}
+
+func listMigrations(gopts GlobalOptions, repo restic.Repository) ([]migrationStatus, error) {
 	ctx := gopts.ctx
-	Printf("available migrations:\n")
+
+	records, err := migrations.LoadRecords(ctx, repo)
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]migrationStatus, 0, len(migrations.All))
 	for _, m := range migrations.All {
 		ok, err := m.Check(ctx, repo)
 		if err != nil {
-			return err
+			return nil, err
 		}
 
-		if ok {
-			Printf("  %v: %v\n", m.Name(), m.Desc())
+		list = append(list, migrationStatus{
+			Name:       m.Name(),
+			Desc:       m.Desc(),
+			Applicable: ok,
+			Applied:    migrations.Applied(records, m.Name()),
+		})
+	}
+
+	return list, nil
+}
+
+func checkMigrations(opts MigrateOptions, gopts GlobalOptions, repo restic.Repository) error {
+	list, err := listMigrations(gopts, repo)
+	if err != nil {
+		return err
+	}
+
+	Printf("available migrations:\n")
+	for _, m := range list {
+		if m.Applicable && m.Applied == nil {
+			Printf("  %v: %v\n", m.Name, m.Desc)
 		}
 	}
 
@@ -53,10 +133,23 @@ func checkMigrations(opts MigrateOptions, gopts GlobalOptions, repo restic.Repos
 func applyMigrations(opts MigrateOptions, gopts GlobalOptions, repo restic.Repository, args []string) error {
 	ctx := gopts.ctx
 
+	records, err := migrations.LoadRecords(ctx, repo)
+	if err != nil {
+		return err
+	}
+
 	var firsterr error
 	for _, name := range args {
+		found := false
 		for _, m := range migrations.All {
 			if m.Name() == name {
+				found = true
+
+				if r := migrations.Applied(records, m.Name()); r != nil && !opts.Force {
+					Printf("migration %v was already applied at %v by %v, skipping\n", m.Name(), r.Time.Format(TimeFormat), r.Hostname)
+					continue
+				}
+
 				ok, err := m.Check(ctx, repo)
 				if err != nil {
 					return err
@@ -71,8 +164,13 @@ func applyMigrations(opts MigrateOptions, gopts GlobalOptions, repo restic.Repos
 					Warnf("check for migration %v failed, continuing anyway\n", m.Name())
 				}
 
+				if opts.DryRun {
+					Printf("would apply migration %v: %v\n", m.Name(), m.Desc())
+					continue
+				}
+
 				Printf("applying migration %v...\n", m.Name())
-				if err = m.Apply(ctx, repo); err != nil {
+				if _, err = migrations.Run(ctx, repo, m, version); err != nil {
 					Warnf("migration %v failed: %v\n", m.Name(), err)
 					if firsterr == nil {
 						firsterr = err
@@ -83,26 +181,86 @@ func applyMigrations(opts MigrateOptions, gopts GlobalOptions, repo restic.Repos
 				Printf("migration %v: success\n", m.Name())
 			}
 		}
+
+		if !found {
+			Warnf("unknown migration %v\n", name)
+		}
 	}
 
 	return firsterr
 }
 
-func runMigrate(opts MigrateOptions, gopts GlobalOptions, args []string) error {
+func runMigrate(opts MigrateOptions, gopts GlobalOptions, args []string) (err error) {
 	repo, err := OpenRepository(gopts)
 	if err != nil {
 		return err
 	}
 
+	if len(args) == 0 || opts.DryRun {
+		lock, err := lockRepo(repo)
+		defer unlockRepo(lock)
+		if err != nil {
+			return err
+		}
+
+		if len(args) == 0 {
+			return checkMigrations(opts, gopts, repo)
+		}
+
+		return applyMigrations(opts, gopts, repo, args)
+	}
+
 	lock, err := lockRepoExclusive(repo)
 	defer unlockRepo(lock)
 	if err != nil {
 		return err
 	}
 
-	if len(args) == 0 {
-		return checkMigrations(opts, gopts, repo)
-	}
+	finish := recordOperation(gopts, repo, "migrate")
+	defer func() { finish(err) }()
 
 	return applyMigrations(opts, gopts, repo, args)
 }
+
+func runMigrateList(gopts GlobalOptions) error {
+	repo, err := OpenRepository(gopts)
+	if err != nil {
+		return err
+	}
+
+	if !gopts.NoLock {
+		lock, err := lockRepo(repo)
+		defer unlockRepo(lock)
+		if err != nil {
+			return err
+		}
+	}
+
+	list, err := listMigrations(gopts, repo)
+	if err != nil {
+		return err
+	}
+
+	if gopts.JSON {
+		return json.NewEncoder(gopts.stdout).Encode(list)
+	}
+
+	tab := NewTable()
+	tab.Header = fmt.Sprintf("%-20s  %-19s  %-15s  %s", "Name", "Applied", "Host", "Description")
+	tab.RowFormat = "%-20s  %-19s  %-15s  %s"
+
+	for _, m := range list {
+		applied, host := "not applicable", ""
+		switch {
+		case m.Applied != nil:
+			applied = m.Applied.Time.Format(TimeFormat)
+			host = m.Applied.Hostname
+		case m.Applicable:
+			applied = "available"
+		}
+
+		tab.Rows = append(tab.Rows, []interface{}{m.Name, applied, host, m.Desc})
+	}
+
+	return tab.Write(gopts.stdout)
+}
@@ -31,6 +31,16 @@ read-only mount.
 Snapshot Directories
 ====================
 
+The snapshots can be found in several virtual directories:
+
+    snapshots/<time>         all snapshots, named by the time they were taken
+    tags/<tag>/<time>        the snapshots which have the tag
+    hosts/<host>/<time>      the snapshots which were taken on the host
+    ids/<id>                 all snapshots, named by their short ID
+
+The directories named by time contain a symlink "latest" to the most recent
+snapshot.
+
 If you need a different template for all directories that contain snapshots,
 you can pass a template via --snapshot-template. Example without colons:
 
@@ -42,6 +52,20 @@ You need to specify a sample format for exactly the following timestamp:
 
 For details please see the documentation for time.Format() at:
   https://godoc.org/time#Time.Format
+
+Access Rights
+=============
+
+By default, only the user who mounted the repository can access the mounted
+directory. With --allow-other, all users can access it, the kernel then checks
+the permissions of the files and directories against their original owner,
+group and mode, unless --no-default-permissions is given. Using --allow-other
+as a user other than root requires the line "user_allow_other" in
+/etc/fuse.conf.
+
+With --owner, all files and directories are shown as owned by the given user
+and group instead of their original owner, e.g. "--owner 1000:1000" in a
+container whose user IDs do not match the ones of the backed up system.
 `,
 	DisableAutoGenTag: true,
 	RunE: func(cmd *cobra.Command, args []string) error {
@@ -51,13 +75,16 @@ For details please see the documentation for time.Format() at:
 
 // MountOptions collects all options for the mount command.
 type MountOptions struct {
-	OwnerRoot        bool
-	AllowRoot        bool
-	AllowOther       bool
-	Host             string
-	Tags             restic.TagLists
-	Paths            []string
-	SnapshotTemplate string
+	OwnerRoot            bool
+	Owner                string
+	AllowRoot            bool
+	AllowOther           bool
+	NoDefaultPermissions bool
+	Host                 string
+	Tags                 restic.TagLists
+	Paths                []string
+	SnapshotTemplate     string
+	MetricsListen        string
 }
 
 var mountOptions MountOptions
@@ -69,30 +96,73 @@ func init() {
 	mountFlags.BoolVar(&mountOptions.OwnerRoot, "owner-root", false, "use 'root' as the owner of files and dirs")
 	mountFlags.BoolVar(&mountOptions.AllowRoot, "allow-root", false, "allow root user to access the data in the mounted directory")
 	mountFlags.BoolVar(&mountOptions.AllowOther, "allow-other", false, "allow other users to access the data in the mounted directory")
+	mountFlags.BoolVar(&mountOptions.NoDefaultPermissions, "no-default-permissions", false, "for --allow-other, ignore the permissions of the files and allow all users to read them")
+	mountFlags.StringVar(&mountOptions.Owner, "owner", "", "show all files and dirs as owned by `user[:group]` (names or numeric IDs)")
 
 	mountFlags.StringVarP(&mountOptions.Host, "host", "H", "", `only consider snapshots for this host`)
 	mountFlags.Var(&mountOptions.Tags, "tag", "only consider snapshots which include this `taglist`")
 	mountFlags.StringArrayVar(&mountOptions.Paths, "path", nil, "only consider snapshots which include this (absolute) `path`")
 
 	mountFlags.StringVar(&mountOptions.SnapshotTemplate, "snapshot-template", time.RFC3339, "set `template` to use for snapshot dirs")
+	mountFlags.StringVar(&mountOptions.MetricsListen, "metrics-listen", "", "serve metrics for Prometheus at `address`/metrics while the repository is mounted, use unix:/path for a unix socket")
+}
+
+// mountOwner returns the owner and group given with --owner, nil means the
+// original owner or group is shown.
+func mountOwner(owner string) (uid, gid *uint32, err error) {
+	if owner == "" {
+		return nil, nil, nil
+	}
+
+	spec, err := parseOwnerSpec(owner)
+	if err != nil {
+		return nil, nil, errors.Fatalf("invalid value for --owner: %v", err)
+	}
+
+	if spec.uid >= 0 {
+		id := uint32(spec.uid)
+		uid = &id
+	}
+	if spec.gid >= 0 {
+		id := uint32(spec.gid)
+		gid = &id
+	}
+	return uid, gid, nil
 }
 
 func mount(opts MountOptions, gopts GlobalOptions, mountpoint string) error {
 	debug.Log("start mount")
 	defer debug.Log("finish mount")
 
-	repo, err := OpenRepository(gopts)
+	uid, gid, err := mountOwner(opts.Owner)
 	if err != nil {
 		return err
 	}
 
-	lock, err := lockRepo(repo)
-	defer unlockRepo(lock)
+	if opts.OwnerRoot && opts.Owner != "" {
+		return errors.Fatal("--owner-root and --owner cannot be specified at the same time")
+	}
+
+	stopMetrics, err := serveMetrics(opts.MetricsListen)
 	if err != nil {
 		return err
 	}
+	defer stopMetrics()
 
-	err = repo.LoadIndex(gopts.ctx)
+	repo, err := OpenRepository(gopts)
+	if err != nil {
+		return err
+	}
+
+	if !gopts.NoLock {
+		lock, err := lockRepo(repo)
+		defer unlockRepo(lock)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = loadTreeIndex(gopts.ctx, repo)
 	if err != nil {
 		return err
 	}
@@ -116,10 +186,18 @@ func mount(opts MountOptions, gopts GlobalOptions, mountpoint string) error {
 
 	if opts.AllowOther {
 		mountOptions = append(mountOptions, systemFuse.AllowOther())
+
+		// let the kernel check the permissions of the files
+		if !opts.NoDefaultPermissions {
+			mountOptions = append(mountOptions, systemFuse.DefaultPermissions())
+		}
 	}
 
 	c, err := systemFuse.Mount(mountpoint, mountOptions...)
 	if err != nil {
+		if opts.AllowOther && os.Getuid() != 0 {
+			return errors.Fatalf("unable to mount: %v (is user_allow_other set in /etc/fuse.conf?)", err)
+		}
 		return err
 	}
 
@@ -129,6 +207,8 @@ func mount(opts MountOptions, gopts GlobalOptions, mountpoint string) error {
 
 	cfg := fuse.Config{
 		OwnerIsRoot:      opts.OwnerRoot,
+		UID:              uid,
+		GID:              gid,
 		Host:             opts.Host,
 		Tags:             opts.Tags,
 		Paths:            opts.Paths,
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"fmt"
 	"time"
 
 	"github.com/restic/restic/internal/debug"
@@ -19,70 +18,95 @@ var cmdPrune = &cobra.Command{
 	Long: `
 The "prune" command checks the repository and removes data that is not
 referenced and therefore not needed any more.
+
+Packs which only contain unused data are deleted. Packs which contain both used
+and unused data need to be downloaded and rewritten, which is expensive for
+remote repositories. They are only rewritten until the unused data left in the
+repository is below the limit given with "--max-unused", either as a size (e.g.
+"100M"), a percentage of the repository size (e.g. "5%") or "unlimited". The
+total size of the packs rewritten can be limited with "--max-repack-size". With
+"--dry-run", prune only prints what it would do.
+
+When a time budget is given with "--time-budget", packs are rewritten in order
+of decreasing unused space until the budget is exhausted. The repository is
+left in a consistent state and the remaining packs are processed by the next
+run of "prune".
 `,
 	DisableAutoGenTag: true,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		return runPrune(globalOptions)
+		return runPrune(pruneOptions, globalOptions)
 	},
 }
 
-func init() {
-	cmdRoot.AddCommand(cmdPrune)
+// PruneOptions collects all options for the prune command.
+type PruneOptions struct {
+	TimeBudget    time.Duration
+	MaxUnused     string
+	MaxRepackSize string
+	DryRun        bool
+	MetricsListen string
+
+	// set by verifyPruneOptions
+	maxUnusedBytes func(used uint64) uint64
+	maxRepackBytes uint64
 }
 
-func shortenStatus(maxLength int, s string) string {
-	if len(s) <= maxLength {
-		return s
-	}
+var pruneOptions PruneOptions
 
-	if maxLength < 3 {
-		return s[:maxLength]
-	}
+func init() {
+	cmdRoot.AddCommand(cmdPrune)
 
-	return s[:maxLength-3] + "..."
+	addPruneOptions(cmdPrune, &pruneOptions)
+	cmdPrune.Flags().BoolVarP(&pruneOptions.DryRun, "dry-run", "n", false, "do not modify the repository, just print what would be done")
+	cmdPrune.Flags().StringVar(&pruneOptions.MetricsListen, "metrics-listen", "", "serve metrics for Prometheus at `address`/metrics while prune is running, use unix:/path for a unix socket")
 }
 
-// newProgressMax returns a progress that counts blobs.
-func newProgressMax(show bool, max uint64, description string) *restic.Progress {
-	if !show {
-		return nil
-	}
-
-	p := restic.NewProgress()
-
-	p.OnUpdate = func(s restic.Stat, d time.Duration, ticker bool) {
-		status := fmt.Sprintf("[%s] %s  %d / %d %s",
-			formatDuration(d),
-			formatPercent(s.Blobs, max),
-			s.Blobs, max, description)
+// addPruneOptions adds the options which control how much data is rewritten
+// to c, they are shared by prune and forget.
+func addPruneOptions(c *cobra.Command, opts *PruneOptions) {
+	f := c.Flags()
+	f.DurationVar(&opts.TimeBudget, "time-budget", 0, "stop rewriting packs after `duration` (e.g. 2h), the next run continues (default: unlimited)")
+	f.StringVar(&opts.MaxUnused, "max-unused", defaultMaxUnused, "tolerate given `limit` of unused data (absolute value in bytes with suffixes k/K, m/M, g/G, t/T, a value in % or the word 'unlimited')")
+	f.StringVar(&opts.MaxRepackSize, "max-repack-size", "", "maximum `size` of the packs to rewrite (allowed suffixes: k/K, m/M, g/G, t/T)")
+}
 
-		if w := stdoutTerminalWidth(); w > 0 {
-			status = shortenStatus(w, status)
-		}
+// newProgressMax returns a progress that counts blobs.
+func newProgressMax(gopts GlobalOptions, max uint64, description string) *restic.Progress {
+	return newProgress(gopts, restic.Stat{Blobs: max}, progressOptions{Action: description})
+}
 
-		PrintProgress("%s", status)
+func runPrune(opts PruneOptions, gopts GlobalOptions) (err error) {
+	if err = verifyPruneOptions(&opts); err != nil {
+		return err
 	}
 
-	p.OnDone = func(s restic.Stat, d time.Duration, ticker bool) {
-		fmt.Printf("\n")
+	stopMetrics, err := serveMetrics(opts.MetricsListen)
+	if err != nil {
+		return err
 	}
+	defer stopMetrics()
 
-	return p
-}
-
-func runPrune(gopts GlobalOptions) error {
 	repo, err := OpenRepository(gopts)
 	if err != nil {
 		return err
 	}
 
+	if !opts.DryRun {
+		if err = checkDeleteAllowed(gopts, repo, "prune"); err != nil {
+			return err
+		}
+	}
+
 	lock, err := lockRepoExclusive(repo)
 	defer unlockRepo(lock)
 	if err != nil {
 		return err
 	}
 
-	return pruneRepository(gopts, repo)
+	finish := recordOperation(gopts, repo, "prune")
+	defer func() { finish(err) }()
+
+	return pruneRepository(gopts, opts, repo)
 }
 
 func mixedBlobs(list []restic.Blob) bool {
@@ -104,10 +128,52 @@ func mixedBlobs(list []restic.Blob) bool {
 	return false
 }
 
-func pruneRepository(gopts GlobalOptions, repo restic.Repository) error {
+// pruneSummary is the JSON message printed at the end of prune.
+type pruneSummary struct {
+	MessageType        string `json:"message_type"`
+	Snapshots          int    `json:"snapshots"`
+	Packs              int    `json:"packs"`
+	Blobs              int    `json:"blobs"`
+	TotalBytes         int64  `json:"total_bytes"`
+	DuplicateBlobs     int    `json:"duplicate_blobs"`
+	DuplicateBytes     uint64 `json:"duplicate_bytes"`
+	UsedBlobs          int    `json:"used_blobs"`
+	UnusedBytes        uint64 `json:"unused_bytes"`
+	RemovedPacks       int    `json:"removed_packs"`
+	RewrittenPacks     int    `json:"rewritten_packs"`
+	PacksLeftToRewrite int    `json:"packs_left_to_rewrite,omitempty"`
+	FreedBytes         uint64 `json:"freed_bytes"`
+	UnusedBytesAfter   uint64 `json:"unused_bytes_after"`
+	DryRun             bool   `json:"dry_run,omitempty"`
+}
+
+// pruneRepository removes the data which is not referenced by any snapshot
+// from the repository, opts must have been checked by verifyPruneOptions.
+func pruneRepository(gopts GlobalOptions, opts PruneOptions, repo restic.Repository) error {
+	Verbosef("load all snapshots\n")
+	snapshots, err := restic.LoadAllSnapshots(gopts.ctx, repo)
+	if err != nil {
+		return err
+	}
+
+	return pruneKeeping(gopts, opts, repo, snapshots)
+}
+
+// pruneKeeping works like pruneRepository, but keeps the data referenced by
+// snapshots instead of loading the snapshots from the repository again. The
+// caller must hold an exclusive lock and pass all snapshots which remain in
+// the repository, all other data is removed.
+func pruneKeeping(gopts GlobalOptions, opts PruneOptions, repo restic.Repository, snapshots restic.Snapshots) error {
 	ctx := gopts.ctx
 
-	err := repo.LoadIndex(ctx)
+	var deadline time.Time
+	if opts.TimeBudget > 0 {
+		deadline = time.Now().Add(opts.TimeBudget)
+		Verbosef("time budget is %v, prune stops rewriting packs at %v\n",
+			opts.TimeBudget, deadline.Format(TimeFormat))
+	}
+
+	err := loadIndex(ctx, repo)
 	if err != nil {
 		return err
 	}
@@ -130,7 +196,7 @@ func pruneRepository(gopts GlobalOptions, repo restic.Repository) error {
 
 	Verbosef("building new index for repo\n")
 
-	bar := newProgressMax(!gopts.Quiet, uint64(stats.packs), "packs")
+	bar := newProgressMax(gopts, uint64(stats.packs), "packs")
 	idx, invalidFiles, err := index.New(ctx, repo, restic.NewIDSet(), bar)
 	if err != nil {
 		return err
@@ -140,41 +206,12 @@ func pruneRepository(gopts GlobalOptions, repo restic.Repository) error {
 		Warnf("incomplete pack file (will be removed): %v\n", id)
 	}
 
-	blobs := 0
 	for _, pack := range idx.Packs {
 		stats.bytes += pack.Size
-		blobs += len(pack.Entries)
+		stats.blobs += len(pack.Entries)
 	}
 	Verbosef("repository contains %v packs (%v blobs) with %v\n",
-		len(idx.Packs), blobs, formatBytes(uint64(stats.bytes)))
-
-	blobCount := make(map[restic.BlobHandle]int)
-	duplicateBlobs := 0
-	duplicateBytes := 0
-
-	// find duplicate blobs
-	for _, p := range idx.Packs {
-		for _, entry := range p.Entries {
-			stats.blobs++
-			h := restic.BlobHandle{ID: entry.ID, Type: entry.Type}
-			blobCount[h]++
-
-			if blobCount[h] > 1 {
-				duplicateBlobs++
-				duplicateBytes += int(entry.Length)
-			}
-		}
-	}
-
-	Verbosef("processed %d blobs: %d duplicate blobs, %v duplicate\n",
-		stats.blobs, duplicateBlobs, formatBytes(uint64(duplicateBytes)))
-	Verbosef("load all snapshots\n")
-
-	// find referenced blobs
-	snapshots, err := restic.LoadAllSnapshots(ctx, repo)
-	if err != nil {
-		return err
-	}
+		len(idx.Packs), stats.blobs, formatBytes(uint64(stats.bytes)))
 
 	stats.snapshots = len(snapshots)
 
@@ -183,7 +220,7 @@ func pruneRepository(gopts GlobalOptions, repo restic.Repository) error {
 	usedBlobs := restic.NewBlobSet()
 	seenBlobs := restic.NewBlobSet()
 
-	bar = newProgressMax(!gopts.Quiet, uint64(len(snapshots)), "snapshots")
+	bar = newProgressMax(gopts, uint64(len(snapshots)), "snapshots")
 	bar.Start()
 	for _, sn := range snapshots {
 		debug.Log("process snapshot %v", sn.ID().Str())
@@ -208,78 +245,56 @@ func pruneRepository(gopts GlobalOptions, repo restic.Repository) error {
 			"https://github.com/restic/restic/issues/new")
 	}
 
-	Verbosef("found %d of %d data blobs still in use, removing %d blobs\n",
-		len(usedBlobs), stats.blobs, stats.blobs-len(usedBlobs))
-
-	// find packs that need a rewrite
-	rewritePacks := restic.NewIDSet()
-	for _, pack := range idx.Packs {
-		if mixedBlobs(pack.Entries) {
-			rewritePacks.Insert(pack.ID)
-			continue
-		}
-
-		for _, blob := range pack.Entries {
-			h := restic.BlobHandle{ID: blob.ID, Type: blob.Type}
-			if !usedBlobs.Has(h) {
-				rewritePacks.Insert(pack.ID)
-				continue
-			}
-
-			if blobCount[h] > 1 {
-				rewritePacks.Insert(pack.ID)
-			}
-		}
+	plan := planPrune(idx.Packs, usedBlobs, opts)
+
+	Verbosef("found %d of %d data blobs still in use\n", len(usedBlobs), stats.blobs)
+	plan.print()
+
+	summary := pruneSummary{
+		MessageType:      msgSummary,
+		Snapshots:        stats.snapshots,
+		Packs:            len(idx.Packs),
+		Blobs:            stats.blobs,
+		TotalBytes:       stats.bytes,
+		DuplicateBlobs:   plan.duplicateBlobs,
+		DuplicateBytes:   plan.duplicateSize,
+		UsedBlobs:        len(usedBlobs),
+		UnusedBytes:      plan.unusedSize,
+		RemovedPacks:     len(plan.removePacks) + len(invalidFiles),
+		RewrittenPacks:   len(plan.repackPacks),
+		FreedBytes:       plan.freeSize,
+		UnusedBytesAfter: plan.unusedAfter,
+		DryRun:           opts.DryRun,
 	}
 
-	removeBytes := duplicateBytes
-
-	// find packs that are unneeded
-	removePacks := restic.NewIDSet()
+	if opts.DryRun {
+		Verbosef("dry run, the repository was not modified\n")
+		newPrinter(gopts).Message(summary)
+		return nil
+	}
 
-	Verbosef("will remove %d invalid files\n", len(invalidFiles))
+	removePacks := plan.removePacks
+	if len(invalidFiles) > 0 {
+		Verbosef("will remove %d invalid files\n", len(invalidFiles))
+	}
 	for _, id := range invalidFiles {
 		removePacks.Insert(id)
 	}
 
-	for packID, p := range idx.Packs {
-
-		hasActiveBlob := false
-		for _, blob := range p.Entries {
-			h := restic.BlobHandle{ID: blob.ID, Type: blob.Type}
-			if usedBlobs.Has(h) {
-				hasActiveBlob = true
-				continue
-			}
-
-			removeBytes += int(blob.Length)
-		}
-
-		if hasActiveBlob {
-			continue
-		}
-
-		removePacks.Insert(packID)
-
-		if !rewritePacks.Has(packID) {
-			return errors.Fatalf("pack %v is unneeded, but not contained in rewritePacks", packID.Str())
-		}
-
-		rewritePacks.Delete(packID)
-	}
-
-	Verbosef("will delete %d packs and rewrite %d packs, this frees %s\n",
-		len(removePacks), len(rewritePacks), formatBytes(uint64(removeBytes)))
-
 	var obsoletePacks restic.IDSet
-	if len(rewritePacks) != 0 {
-		bar = newProgressMax(!gopts.Quiet, uint64(len(rewritePacks)), "packs rewritten")
+	if len(plan.repackPacks) != 0 {
+		bar = newProgressMax(gopts, uint64(len(plan.repackPacks)), "packs rewritten")
 		bar.Start()
-		obsoletePacks, err = repository.Repack(ctx, repo, rewritePacks, usedBlobs, bar)
+		obsoletePacks, err = repository.RepackUntil(ctx, repo, plan.repackPacks, plan.repackBlobs, bar, deadline)
 		if err != nil {
 			return err
 		}
 		bar.Done()
+
+		if len(obsoletePacks) < len(plan.repackPacks) {
+			Verbosef("time budget exhausted, %d packs are left to be rewritten by the next run\n",
+				len(plan.repackPacks)-len(obsoletePacks))
+		}
 	}
 
 	removePacks.Merge(obsoletePacks)
@@ -289,7 +304,7 @@ func pruneRepository(gopts GlobalOptions, repo restic.Repository) error {
 	}
 
 	if len(removePacks) != 0 {
-		bar = newProgressMax(!gopts.Quiet, uint64(len(removePacks)), "packs deleted")
+		bar = newProgressMax(gopts, uint64(len(removePacks)), "packs deleted")
 		bar.Start()
 		for packID := range removePacks {
 			h := restic.Handle{Type: restic.DataFile, Name: packID.String()}
@@ -303,5 +318,10 @@ func pruneRepository(gopts GlobalOptions, repo restic.Repository) error {
 	}
 
 	Verbosef("done\n")
+
+	summary.RewrittenPacks = len(obsoletePacks)
+	summary.PacksLeftToRewrite = len(plan.repackPacks) - len(obsoletePacks)
+	newPrinter(gopts).Message(summary)
+
 	return nil
 }
@@ -27,7 +27,7 @@ func init() {
 	cmdRoot.AddCommand(cmdRebuildIndex)
 }
 
-func runRebuildIndex(gopts GlobalOptions) error {
+func runRebuildIndex(gopts GlobalOptions) (err error) {
 	repo, err := OpenRepository(gopts)
 	if err != nil {
 		return err
@@ -39,6 +39,9 @@ func runRebuildIndex(gopts GlobalOptions) error {
 		return err
 	}
 
+	finish := recordOperation(gopts, repo, "rebuild-index")
+	defer func() { finish(err) }()
+
 	ctx, cancel := context.WithCancel(gopts.ctx)
 	defer cancel()
 	return rebuildIndex(ctx, repo, restic.NewIDSet())
@@ -56,7 +59,7 @@ func rebuildIndex(ctx context.Context, repo restic.Repository, ignorePacks resti
 		return err
 	}
 
-	bar := newProgressMax(!globalOptions.Quiet, packs-uint64(len(ignorePacks)), "packs")
+	bar := newProgressMax(globalOptions, packs-uint64(len(ignorePacks)), "packs")
 	idx, _, err := index.New(ctx, repo, ignorePacks, bar)
 	if err != nil {
 		return err
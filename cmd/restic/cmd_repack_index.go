@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"sort"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/index"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+
+	"github.com/spf13/cobra"
+)
+
+var cmdRepackIndex = &cobra.Command{
+	Use:   "repack-index [flags]",
+	Short: "Merge small index files into larger ones",
+	Long: `
+The "repack-index" command merges the index files in the repository into as
+few files as possible, each of which lists at most "--max-blobs" blobs.
+Interrupted backups can leave hundreds of small index files behind, which
+slows down every command that loads the index, especially on remote backends
+where each file needs a separate request.
+
+In contrast to "rebuild-index", the pack files are not read, the new index is
+built from the existing index files only.
+`,
+	DisableAutoGenTag: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runRepackIndex(repackIndexOptions, globalOptions)
+	},
+}
+
+// RepackIndexOptions collects all options for the repack-index command.
+type RepackIndexOptions struct {
+	MaxBlobs int
+}
+
+var repackIndexOptions RepackIndexOptions
+
+// defaultRepackIndexMaxBlobs is the number of blobs listed in each index
+// file written by repack-index if --max-blobs is not given.
+const defaultRepackIndexMaxBlobs = 100000
+
+func init() {
+	cmdRoot.AddCommand(cmdRepackIndex)
+
+	f := cmdRepackIndex.Flags()
+	f.IntVar(&repackIndexOptions.MaxBlobs, "max-blobs", defaultRepackIndexMaxBlobs, "maximum `number` of blobs listed in each new index file")
+}
+
+func runRepackIndex(opts RepackIndexOptions, gopts GlobalOptions) (err error) {
+	if opts.MaxBlobs <= 0 {
+		return errors.Fatal("--max-blobs must be positive")
+	}
+
+	repo, err := OpenRepository(gopts)
+	if err != nil {
+		return err
+	}
+
+	if err = checkDeleteAllowed(gopts, repo, "repack-index"); err != nil {
+		return err
+	}
+
+	lock, err := lockRepoExclusive(repo)
+	defer unlockRepo(lock)
+	if err != nil {
+		return err
+	}
+
+	finish := recordOperation(gopts, repo, "repack-index")
+	defer func() { finish(err) }()
+
+	ctx, cancel := context.WithCancel(gopts.ctx)
+	defer cancel()
+
+	return repackIndex(ctx, repo, opts.MaxBlobs)
+}
+
+// repackIndex replaces all index files in the repository by new ones which
+// list at most maxBlobs blobs each.
+func repackIndex(ctx context.Context, repo restic.Repository, maxBlobs int) error {
+	var oldIndexes restic.IDs
+	err := repo.List(ctx, restic.IndexFile, func(id restic.ID, size int64) error {
+		oldIndexes = append(oldIndexes, id)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	Verbosef("loading %d index files\n", len(oldIndexes))
+
+	// a pack may be listed in several index files, the entries of the first
+	// one are used
+	packs := make(map[restic.ID][]restic.Blob)
+	blobs := 0
+	for _, id := range oldIndexes {
+		idx, err := repository.LoadIndex(ctx, repo, id)
+		if err != nil {
+			return errors.Fatalf("unable to load index %v: %v", id.Str(), err)
+		}
+
+		seen := restic.NewIDSet()
+		for pb := range idx.Each(ctx) {
+			if _, ok := packs[pb.PackID]; ok && !seen.Has(pb.PackID) {
+				continue
+			}
+
+			seen.Insert(pb.PackID)
+			packs[pb.PackID] = append(packs[pb.PackID], pb.Blob)
+			blobs++
+		}
+	}
+
+	groups := groupPacks(packs, maxBlobs)
+	if len(groups) >= len(oldIndexes) {
+		Verbosef("the repository has %d index files, nothing to do\n", len(oldIndexes))
+		return nil
+	}
+
+	Verbosef("writing %d blobs in %d packs to %d new index files\n", blobs, len(packs), len(groups))
+
+	for i, group := range groups {
+		// the last index supersedes the old ones, the old index files are
+		// still complete if writing one of the new ones fails
+		var supersedes restic.IDs
+		if i == len(groups)-1 {
+			supersedes = oldIndexes
+		}
+
+		id, err := index.Save(ctx, repo, group, supersedes)
+		if err != nil {
+			return errors.Fatalf("unable to save index, last error was: %v", err)
+		}
+
+		debug.Log("saved new index %v with %d packs", id.Str(), len(group))
+		Verbosef("saved new index as %v\n", id.Str())
+	}
+
+	Verbosef("remove %d old index files\n", len(oldIndexes))
+
+	for _, id := range oldIndexes {
+		if err := repo.Backend().Remove(ctx, restic.Handle{
+			Type: restic.IndexFile,
+			Name: id.String(),
+		}); err != nil {
+			Warnf("error removing old index %v: %v\n", id.Str(), err)
+		}
+	}
+
+	return nil
+}
+
+// groupPacks splits packs into groups with at most maxBlobs blobs each. A
+// pack which contains more blobs forms a group of its own.
+func groupPacks(packs map[restic.ID][]restic.Blob, maxBlobs int) (groups []map[restic.ID][]restic.Blob) {
+	ids := make(restic.IDs, 0, len(packs))
+	for id := range packs {
+		ids = append(ids, id)
+	}
+	sort.Sort(ids)
+
+	var (
+		group map[restic.ID][]restic.Blob
+		n     int
+	)
+
+	for _, id := range ids {
+		if group == nil || n+len(packs[id]) > maxBlobs {
+			group = make(map[restic.ID][]restic.Blob)
+			groups = append(groups, group)
+			n = 0
+		}
+
+		group[id] = packs[id]
+		n += len(packs[id])
+	}
+
+	return groups
+}
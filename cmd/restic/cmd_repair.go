@@ -0,0 +1,23 @@
+package main
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var cmdRepair = &cobra.Command{
+	Use:   "repair",
+	Short: "Repair the repository",
+	Long: `
+The "repair" command contains subcommands to recover from a damaged
+repository. "repair index" builds a new index from the pack files, "repair
+snapshots" rewrites snapshots which reference missing data.
+
+It is advisable to run "check" first and to create a copy of the repository
+before repairing it.
+`,
+	DisableAutoGenTag: true,
+}
+
+func init() {
+	cmdRoot.AddCommand(cmdRepair)
+}
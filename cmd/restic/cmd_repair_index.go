@@ -0,0 +1,23 @@
+package main
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var cmdRepairIndex = &cobra.Command{
+	Use:   "index [flags]",
+	Short: "Build a new index from the pack files",
+	Long: `
+The "repair index" command reads the headers of all pack files in the
+repository and creates a new index from them, which replaces all existing
+index files. It is the same as the "rebuild-index" command.
+`,
+	DisableAutoGenTag: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runRebuildIndex(globalOptions)
+	},
+}
+
+func init() {
+	cmdRepair.AddCommand(cmdRepairIndex)
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"context"
+	"path"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+
+	"github.com/spf13/cobra"
+)
+
+var cmdRepairSnapshots = &cobra.Command{
+	Use:   "snapshots [flags] [snapshot ID] [...]",
+	Short: "Repair snapshots which reference missing data",
+	Long: `
+The "repair snapshots" command rewrites snapshots which reference data that is
+missing from the repository, so that the rest of the snapshot can still be
+restored. If no snapshot IDs are given, all snapshots matching the filters are
+checked.
+
+Files which reference missing data blobs are truncated to the blobs which are
+still available. Directories which cannot be loaded are replaced by an empty
+directory. The repaired snapshots get the tag "repaired", the original
+snapshots are kept unless --forget is given.
+
+Run "repair index" first if the index is damaged, otherwise data which is
+still present in the repository may be considered missing.
+`,
+	DisableAutoGenTag: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runRepairSnapshots(repairSnapshotsOptions, globalOptions, args)
+	},
+}
+
+// RepairSnapshotsOptions collects all options for the repair snapshots
+// command.
+type RepairSnapshotsOptions struct {
+	DryRun bool
+	Forget bool
+
+	Host  string
+	Tags  restic.TagLists
+	Paths []string
+}
+
+var repairSnapshotsOptions RepairSnapshotsOptions
+
+func init() {
+	cmdRepair.AddCommand(cmdRepairSnapshots)
+
+	f := cmdRepairSnapshots.Flags()
+	f.BoolVarP(&repairSnapshotsOptions.DryRun, "dry-run", "n", false, "do not modify the repository, just print what would be done")
+	f.BoolVar(&repairSnapshotsOptions.Forget, "forget", false, "remove the original snapshots after they have been repaired")
+	f.StringVarP(&repairSnapshotsOptions.Host, "host", "H", "", "only consider snapshots for this `host`")
+	f.Var(&repairSnapshotsOptions.Tags, "tag", "only consider snapshots which include this `taglist`")
+	f.StringArrayVar(&repairSnapshotsOptions.Paths, "path", nil, "only consider snapshots which include this (absolute) `path`")
+}
+
+// snapshotRepairer rewrites trees which reference missing data.
+type snapshotRepairer struct {
+	repo   restic.Repository
+	dryRun bool
+
+	// repaired contains the result for the trees processed so far
+	repaired  map[restic.ID]repairedTree
+	emptyTree *restic.ID
+}
+
+// repairedTree is the ID of a tree after the repair, and whether it was
+// changed.
+type repairedTree struct {
+	id      restic.ID
+	changed bool
+}
+
+// emptyTreeID returns the ID of an empty tree, which is saved on first use.
+func (r *snapshotRepairer) emptyTreeID(ctx context.Context) (restic.ID, error) {
+	if r.emptyTree != nil {
+		return *r.emptyTree, nil
+	}
+
+	var id restic.ID
+	if !r.dryRun {
+		var err error
+		id, err = r.repo.SaveTree(ctx, restic.NewTree())
+		if err != nil {
+			return restic.ID{}, err
+		}
+	}
+
+	r.emptyTree = &id
+	return id, nil
+}
+
+// repairFile removes the missing blobs from the content of the file node and
+// returns true if the file was damaged.
+func (r *snapshotRepairer) repairFile(node *restic.Node, nodePath string) bool {
+	var (
+		// the content of a file must not be nil
+		content = restic.IDs{}
+		size    uint64
+		missing int
+	)
+
+	for _, id := range node.Content {
+		blobSize, found := r.repo.LookupBlobSize(id, restic.DataBlob)
+		if !found {
+			missing++
+			continue
+		}
+
+		content = append(content, id)
+		size += uint64(blobSize)
+	}
+
+	if missing == 0 {
+		return false
+	}
+
+	Warnf("file %v: %d of %d blobs are missing, truncated to %v\n",
+		nodePath, missing, len(node.Content), formatBytes(size))
+
+	node.Content = content
+	node.Size = size
+	return true
+}
+
+// repairTree returns the ID of the repaired tree for id, and whether it was
+// changed. In a dry run, no trees are saved and the original ID is returned.
+func (r *snapshotRepairer) repairTree(ctx context.Context, id restic.ID, treePath string) (restic.ID, bool, error) {
+	if res, ok := r.repaired[id]; ok {
+		return res.id, res.changed, nil
+	}
+
+	newID, changed, err := r.rewriteTree(ctx, id, treePath)
+	if err != nil {
+		return restic.ID{}, false, err
+	}
+
+	if r.dryRun {
+		newID = id
+	}
+
+	r.repaired[id] = repairedTree{id: newID, changed: changed}
+	return newID, changed, nil
+}
+
+// rewriteTree loads the tree id, repairs the files and subtrees it
+// references and saves it again if anything was changed.
+func (r *snapshotRepairer) rewriteTree(ctx context.Context, id restic.ID, treePath string) (restic.ID, bool, error) {
+	tree, err := r.repo.LoadTree(ctx, id)
+	if err != nil {
+		Warnf("dir %v: tree %v cannot be loaded, replaced with an empty directory: %v\n", treePath, id.Str(), err)
+
+		newID, err := r.emptyTreeID(ctx)
+		return newID, true, err
+	}
+
+	changed := false
+	for _, node := range tree.Nodes {
+		nodePath := path.Join(treePath, node.Name)
+
+		switch node.Type {
+		case "file":
+			if r.repairFile(node, nodePath) {
+				changed = true
+			}
+		case "dir":
+			var (
+				subtree    restic.ID
+				subChanged bool
+			)
+
+			if node.Subtree == nil {
+				Warnf("dir %v has no subtree, replaced with an empty directory\n", nodePath)
+				subtree, err = r.emptyTreeID(ctx)
+				subChanged = true
+			} else {
+				subtree, subChanged, err = r.repairTree(ctx, *node.Subtree, nodePath)
+			}
+
+			if err != nil {
+				return restic.ID{}, false, err
+			}
+
+			if subChanged {
+				node.Subtree = &subtree
+				changed = true
+			}
+		}
+	}
+
+	if !changed || r.dryRun {
+		return id, changed, nil
+	}
+
+	newID, err := r.repo.SaveTree(ctx, tree)
+	if err != nil {
+		return restic.ID{}, false, err
+	}
+
+	debug.Log("tree %v repaired as %v", id.Str(), newID.Str())
+	return newID, true, nil
+}
+
+func runRepairSnapshots(opts RepairSnapshotsOptions, gopts GlobalOptions, args []string) (err error) {
+	repo, err := OpenRepository(gopts)
+	if err != nil {
+		return err
+	}
+
+	if opts.Forget && !opts.DryRun {
+		if err = checkDeleteAllowed(gopts, repo, "repair snapshots --forget"); err != nil {
+			return err
+		}
+	}
+
+	lock, err := lockRepoExclusive(repo)
+	defer unlockRepo(lock)
+	if err != nil {
+		return err
+	}
+
+	finish := recordOperation(gopts, repo, "repair snapshots")
+	defer func() { finish(err) }()
+
+	ctx, cancel := context.WithCancel(gopts.ctx)
+	defer cancel()
+
+	if err = loadIndex(ctx, repo); err != nil {
+		return err
+	}
+
+	r := &snapshotRepairer{
+		repo:     repo,
+		dryRun:   opts.DryRun,
+		repaired: make(map[restic.ID]repairedTree),
+	}
+
+	var damaged []*restic.Snapshot
+	for sn := range FindFilteredSnapshots(ctx, repo, opts.Host, opts.Tags, opts.Paths, args) {
+		Verbosef("snapshot %v of %v at %v\n", sn.ID().Str(), sn.Paths, sn.Time.Format(TimeFormat))
+		if sn.Tree == nil {
+			Warnf("snapshot %v has no tree, ignoring\n", sn.ID().Str())
+			continue
+		}
+
+		newTree, changed, err := r.repairTree(ctx, *sn.Tree, "/")
+		if err != nil {
+			return err
+		}
+
+		if !changed {
+			continue
+		}
+
+		newSn := *sn
+		newSn.Tree = &newTree
+		damaged = append(damaged, &newSn)
+	}
+
+	if len(damaged) == 0 {
+		Verbosef("no snapshots were damaged\n")
+		return nil
+	}
+
+	if opts.DryRun {
+		for _, sn := range damaged {
+			Printf("would repair snapshot %v\n", sn.ID().Str())
+		}
+		return nil
+	}
+
+	// the repaired trees must be saved before the snapshots which reference
+	// them
+	if err = repo.Flush(ctx); err != nil {
+		return err
+	}
+
+	if err = repo.SaveIndex(ctx); err != nil {
+		return err
+	}
+
+	for _, sn := range damaged {
+		oldID := *sn.ID()
+		if sn.Original == nil {
+			sn.Original = &oldID
+		}
+		sn.AddTags([]string{"repaired"})
+
+		newID, err := repo.SaveJSONUnpacked(ctx, restic.SnapshotFile, sn)
+		if err != nil {
+			return err
+		}
+
+		Printf("snapshot %v repaired as %v\n", oldID.Str(), newID.Str())
+
+		if opts.Forget {
+			h := restic.Handle{Type: restic.SnapshotFile, Name: oldID.String()}
+			if err = repo.Backend().Remove(ctx, h); err != nil {
+				return errors.Wrap(err, "Remove")
+			}
+			Verbosef("removed snapshot %v\n", oldID.Str())
+		}
+	}
+
+	return nil
+}
@@ -1,9 +1,16 @@
 package main
 
 import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
 	"github.com/restic/restic/internal/debug"
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/filter"
+	"github.com/restic/restic/internal/progress"
 	"github.com/restic/restic/internal/restic"
 
 	"github.com/spf13/cobra"
@@ -18,6 +25,24 @@ a directory.
 
 The special snapshot "latest" can be used to restore the latest snapshot in the
 repository.
+
+When data cannot be loaded from a damaged repository, restoring the affected
+file is aborted by default. With --replace-damaged, the damaged parts of the
+file are filled with zeros instead, so that as much data as possible is
+recovered. The affected files and byte ranges can be written to a file in JSON
+format with --damaged-report. If any data was replaced, restic exits with
+status code 3.
+
+With --as-archive, the data is not written to a local directory but to a tar
+or zip archive with the given name. The archive is stored in the base
+directory of the backend given with --target, e.g. "rest:https://host/exports/"
+or "sftp:user@host:/srv/exports", so that no local disk space is needed. The
+files in zip archives are stored without compression.
+
+With --target -, the archive is written to stdout instead, in the format given
+with --format ("tar" or "zip"), so that it can be piped into other programs.
+Tar archives contain the permissions, owners, symlinks and extended attributes
+of the files, zip archives contain the permissions and symlinks.
 `,
 	DisableAutoGenTag: true,
 	RunE: func(cmd *cobra.Command, args []string) error {
@@ -33,21 +58,80 @@ type RestoreOptions struct {
 	Host    string
 	Paths   []string
 	Tags    restic.TagLists
+
+	ReplaceDamaged bool
+	DamagedReport  string
+
+	AsArchive string
+	Format    string
+
+	Workers int
+	Verify  bool
+	Sparse  bool
+
+	IncludeXattr []string
+	ExcludeXattr []string
 }
 
 var restoreOptions RestoreOptions
 
+// exitCodeDamagedData is returned by the restore command when damaged data was
+// replaced with zeros.
+const exitCodeDamagedData = 3
+
+// errDamagedData is returned by runRestore when damaged data was replaced
+// with zeros.
+var errDamagedData = errors.Fatal("the restored data is incomplete, damaged data was replaced with zeros")
+
 func init() {
 	cmdRoot.AddCommand(cmdRestore)
 
 	flags := cmdRestore.Flags()
 	flags.StringArrayVarP(&restoreOptions.Exclude, "exclude", "e", nil, "exclude a `pattern` (can be specified multiple times)")
 	flags.StringArrayVarP(&restoreOptions.Include, "include", "i", nil, "include a `pattern`, exclude everything else (can be specified multiple times)")
-	flags.StringVarP(&restoreOptions.Target, "target", "t", "", "directory to extract data to")
+	flags.StringVarP(&restoreOptions.Target, "target", "t", "", "directory to extract data to, or \"-\" to write an archive to stdout")
 
 	flags.StringVarP(&restoreOptions.Host, "host", "H", "", `only consider snapshots for this host when the snapshot ID is "latest"`)
 	flags.Var(&restoreOptions.Tags, "tag", "only consider snapshots which include this `taglist` for snapshot ID \"latest\"")
 	flags.StringArrayVar(&restoreOptions.Paths, "path", nil, "only consider snapshots which include this (absolute) `path` for snapshot ID \"latest\"")
+
+	flags.BoolVar(&restoreOptions.ReplaceDamaged, "replace-damaged", false, "replace data which cannot be loaded from the repository with zeros and continue")
+	flags.StringVar(&restoreOptions.DamagedReport, "damaged-report", "", "write the list of replaced data to `file` in JSON format (requires --replace-damaged)")
+	flags.StringVar(&restoreOptions.AsArchive, "as-archive", "", "write the data to the tar or zip archive `name` in the backend given by --target")
+	flags.StringVar(&restoreOptions.Format, "format", "tar", "archive `format` for --target -, \"tar\" or \"zip\"")
+	flags.IntVar(&restoreOptions.Workers, "workers", restic.DefaultRestoreWorkers, "download `n` pack files concurrently")
+	flags.BoolVar(&restoreOptions.Verify, "verify", false, "read the restored files again and check their content")
+	flags.BoolVar(&restoreOptions.Sparse, "sparse", false, "restore files as sparse files, leaving holes instead of writing data which only contains zeros")
+	flags.StringArrayVar(&restoreOptions.IncludeXattr, "include-xattr", nil, "only restore extended attributes whose name matches `pattern` (can be specified multiple times)")
+	flags.StringArrayVar(&restoreOptions.ExcludeXattr, "exclude-xattr", nil, "do not restore extended attributes whose name matches `pattern` (can be specified multiple times)")
+}
+
+// damagedReportEntry describes a range of a restored file which was replaced
+// with zeros.
+type damagedReportEntry struct {
+	Path   string    `json:"path"`
+	Offset uint64    `json:"offset"`
+	Length uint64    `json:"length"`
+	Blob   restic.ID `json:"blob"`
+	Error  string    `json:"error"`
+}
+
+// newRestoreProgress returns the progress for a restore. The total is set by
+// the restorer when all files have been created.
+func newRestoreProgress(gopts GlobalOptions) *restic.Progress {
+	return newProgress(gopts, restic.Stat{}, progressOptions{
+		Format: func(s progress.Status) string {
+			return fmt.Sprintf("[%s] %s  %s / %s  %d files  ETA %s",
+				formatDuration(s.Elapsed),
+				formatPercent(s.Done.Bytes, s.Total.Bytes),
+				formatBytes(s.Done.Bytes), formatBytes(s.Total.Bytes),
+				s.Total.Files,
+				formatSeconds(uint64(s.Remaining/time.Second)))
+		},
+		Summary: func(s progress.Status) string {
+			return fmt.Sprintf("restored %d files, %s in %s", s.Done.Files, formatBytes(s.Done.Bytes), formatDuration(s.Elapsed))
+		},
+	})
 }
 
 func runRestore(opts RestoreOptions, gopts GlobalOptions, args []string) error {
@@ -64,10 +148,62 @@ func runRestore(opts RestoreOptions, gopts GlobalOptions, args []string) error {
 		return errors.Fatal("please specify a directory to restore to (--target)")
 	}
 
+	if opts.Workers < 0 {
+		return errors.Fatal("--workers must not be negative")
+	}
+
 	if len(opts.Exclude) > 0 && len(opts.Include) > 0 {
 		return errors.Fatal("exclude and include patterns are mutually exclusive")
 	}
 
+	if opts.DamagedReport != "" && !opts.ReplaceDamaged {
+		return errors.Fatal("--damaged-report requires --replace-damaged")
+	}
+
+	var xattrFilter func(string) bool
+	if len(opts.IncludeXattr) > 0 || len(opts.ExcludeXattr) > 0 {
+		var err error
+		xattrFilter, err = selectXattrs(opts.IncludeXattr, opts.ExcludeXattr)
+		if err != nil {
+			return err
+		}
+	}
+
+	if opts.Target == "-" {
+		switch {
+		case opts.Format != "tar" && opts.Format != "zip":
+			return errors.Fatalf("unknown archive format %q, use \"tar\" or \"zip\"", opts.Format)
+		case opts.AsArchive != "":
+			return errors.Fatal("--as-archive cannot be used with --target -")
+		case opts.ReplaceDamaged:
+			return errors.Fatal("--replace-damaged cannot be used with --target -")
+		case opts.Sparse:
+			return errors.Fatal("--sparse cannot be used with --target -")
+		case opts.Verify:
+			return errors.Fatal("--verify cannot be used with --target -")
+		case gopts.stdout == os.Stdout && stdoutIsTerminal():
+			return errors.Fatal("refusing to write the archive to a terminal, redirect stdout to a file or a program")
+		}
+	}
+
+	if opts.AsArchive != "" {
+		if opts.ReplaceDamaged {
+			return errors.Fatal("--replace-damaged cannot be used with --as-archive")
+		}
+
+		if opts.Sparse {
+			return errors.Fatal("--sparse cannot be used with --as-archive")
+		}
+
+		if strings.ContainsAny(opts.AsArchive, `/\`) {
+			return errors.Fatal("the name for --as-archive must not contain a path")
+		}
+
+		if _, err := archiveFormat(opts.AsArchive); err != nil {
+			return err
+		}
+	}
+
 	snapshotIDString := args[0]
 
 	debug.Log("restore %v to %v", snapshotIDString, opts.Target)
@@ -85,7 +221,7 @@ func runRestore(opts RestoreOptions, gopts GlobalOptions, args []string) error {
 		}
 	}
 
-	err = repo.LoadIndex(ctx)
+	err = loadIndex(ctx, repo)
 	if err != nil {
 		return err
 	}
@@ -108,6 +244,10 @@ func runRestore(opts RestoreOptions, gopts GlobalOptions, args []string) error {
 	if err != nil {
 		Exitf(2, "creating restorer failed: %v\n", err)
 	}
+	res.Workers = opts.Workers
+	res.Verify = opts.Verify
+	res.Sparse = opts.Sparse
+	res.XattrFilter = xattrFilter
 
 	totalErrors := 0
 	res.Error = func(dir string, node *restic.Node, err error) error {
@@ -116,6 +256,48 @@ func runRestore(opts RestoreOptions, gopts GlobalOptions, args []string) error {
 		return nil
 	}
 
+	var (
+		damagedFiles  = make(map[string]struct{})
+		damagedBlobs  int
+		damagedReport *json.Encoder
+	)
+
+	if opts.DamagedReport != "" {
+		f, err := os.Create(opts.DamagedReport)
+		if err != nil {
+			return errors.Fatalf("unable to create report file: %v", err)
+		}
+		defer func() {
+			if err := f.Close(); err != nil {
+				Warnf("unable to close report file: %v\n", err)
+			}
+		}()
+
+		damagedReport = json.NewEncoder(f)
+	}
+
+	if opts.ReplaceDamaged {
+		res.BlobError = func(location string, node *restic.Node, blob restic.DamagedBlob) error {
+			Warnf("replacing damaged data in %s at offset %d (%d bytes) with zeros: %v\n",
+				location, blob.Offset, blob.Length, blob.Err)
+
+			damagedFiles[location] = struct{}{}
+			damagedBlobs++
+
+			if damagedReport == nil {
+				return nil
+			}
+
+			return damagedReport.Encode(damagedReportEntry{
+				Path:   location,
+				Offset: blob.Offset,
+				Length: blob.Length,
+				Blob:   blob.ID,
+				Error:  blob.Err.Error(),
+			})
+		}
+	}
+
 	selectExcludeFilter := func(item string, dstpath string, node *restic.Node) (selectedForRestore bool, childMayBeSelected bool) {
 		matched, _, err := filter.List(opts.Exclude, item)
 		if err != nil {
@@ -150,11 +332,26 @@ func runRestore(opts RestoreOptions, gopts GlobalOptions, args []string) error {
 		res.SelectFilter = selectIncludeFilter
 	}
 
+	if opts.AsArchive != "" {
+		return restoreToArchive(ctx, opts, gopts, repo, res)
+	}
+
+	if opts.Target == "-" {
+		return restoreToStream(ctx, opts, gopts, repo, res)
+	}
+
 	Verbosef("restoring %s to %s\n", res.Snapshot(), opts.Target)
 
+	res.Progress = newRestoreProgress(gopts)
 	err = res.RestoreTo(ctx, opts.Target)
 	if totalErrors > 0 {
 		Printf("There were %d errors\n", totalErrors)
 	}
+
+	if err == nil && damagedBlobs > 0 {
+		Warnf("replaced %d damaged blobs in %d files with zeros\n", damagedBlobs, len(damagedFiles))
+		return errDamagedData
+	}
+
 	return err
 }
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var cmdServe = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve data from the repository to other programs",
+	Long: `
+The "serve" command makes data stored in the repository available to other
+programs via a network protocol, without restoring it first. The protocol is
+selected by a subcommand.
+`,
+	DisableAutoGenTag: true,
+}
+
+func init() {
+	cmdRoot.AddCommand(cmdServe)
+}
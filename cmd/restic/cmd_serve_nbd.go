@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"net"
+	"strings"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/nbd"
+	"github.com/restic/restic/internal/restic"
+
+	"github.com/spf13/cobra"
+)
+
+var cmdServeNBD = &cobra.Command{
+	Use:   "nbd [flags] snapshotID:file",
+	Short: "Serve a file from a snapshot as a network block device",
+	Long: `
+The "serve nbd" command exports a single file from a snapshot, for example a
+disk image, as a read-only network block device (NBD). The device can be
+connected with nbd-client or used directly by qemu, so the image can be
+mounted or booted without restoring it first. Only the parts of the image
+which are read are loaded from the repository.
+
+The special snapshot "latest" can be used to use the latest snapshot in the
+repository.
+
+Example:
+
+    restic serve nbd latest:/images/vm.img
+    nbd-client -N vm.img localhost /dev/nbd0
+
+The server runs until it is interrupted with Ctrl-C.
+`,
+	DisableAutoGenTag: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runServeNBD(serveNBDOptions, globalOptions, args)
+	},
+}
+
+// ServeNBDOptions collects all options for the serve nbd command.
+type ServeNBDOptions struct {
+	Listen string
+	Host   string
+	Paths  []string
+	Tags   restic.TagLists
+}
+
+var serveNBDOptions ServeNBDOptions
+
+func init() {
+	cmdServe.AddCommand(cmdServeNBD)
+
+	flags := cmdServeNBD.Flags()
+	flags.StringVar(&serveNBDOptions.Listen, "listen", "localhost:10809", "listen on this `address`, use unix:/path for a unix socket")
+	flags.StringVarP(&serveNBDOptions.Host, "host", "H", "", `only consider snapshots for this host when the snapshot ID is "latest"`)
+	flags.Var(&serveNBDOptions.Tags, "tag", "only consider snapshots which include this `taglist` for snapshot ID \"latest\"")
+	flags.StringArrayVar(&serveNBDOptions.Paths, "path", nil, "only consider snapshots which include this (absolute) `path` for snapshot ID \"latest\"")
+}
+
+// listen opens a listener for addr, which is either a TCP address or the path
+// to a unix socket prefixed with "unix:".
+func listen(addr string) (net.Listener, error) {
+	if strings.HasPrefix(addr, "unix:") {
+		l, err := net.Listen("unix", strings.TrimPrefix(addr, "unix:"))
+		return l, errors.Wrap(err, "Listen")
+	}
+
+	l, err := net.Listen("tcp", addr)
+	return l, errors.Wrap(err, "Listen")
+}
+
+func runServeNBD(opts ServeNBDOptions, gopts GlobalOptions, args []string) error {
+	if len(args) != 1 {
+		return errors.Fatal("specify the file to serve as snapshotID:file")
+	}
+
+	pos := strings.Index(args[0], ":")
+	if pos <= 0 || pos == len(args[0])-1 {
+		return errors.Fatalf("invalid argument %q, use snapshotID:file", args[0])
+	}
+
+	snapshotIDString := args[0][:pos]
+	filename := args[0][pos+1:]
+
+	debug.Log("serve file %q from %q", filename, snapshotIDString)
+
+	ctx, cancel := context.WithCancel(gopts.ctx)
+	defer cancel()
+
+	repo, err := OpenRepository(gopts)
+	if err != nil {
+		return err
+	}
+
+	if !gopts.NoLock {
+		lock, err := lockRepo(repo)
+		defer unlockRepo(lock)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = loadIndex(ctx, repo)
+	if err != nil {
+		return err
+	}
+
+	var id restic.ID
+	if snapshotIDString == "latest" {
+		id, err = restic.FindLatestSnapshot(ctx, repo, opts.Paths, opts.Tags, opts.Host)
+		if err != nil {
+			Exitf(1, "latest snapshot for criteria not found: %v Paths:%v Host:%v", err, opts.Paths, opts.Host)
+		}
+	} else {
+		id, err = restic.FindSnapshot(repo, snapshotIDString)
+		if err != nil {
+			Exitf(1, "invalid id %q: %v", snapshotIDString, err)
+		}
+	}
+
+	sn, err := restic.LoadSnapshot(ctx, repo, id)
+	if err != nil {
+		Exitf(2, "loading snapshot %q failed: %v", snapshotIDString, err)
+	}
+
+	tree, err := repo.LoadTree(ctx, *sn.Tree)
+	if err != nil {
+		Exitf(2, "loading tree for snapshot %q failed: %v", snapshotIDString, err)
+	}
+
+	node, err := findNodeInTree(ctx, tree, repo, "", splitPath(filename))
+	if err != nil {
+		Exitf(2, "cannot serve file: %v", err)
+	}
+
+	rd, err := restic.NewContentReader(ctx, repo, node)
+	if err != nil {
+		return err
+	}
+
+	l, err := listen(opts.Listen)
+	if err != nil {
+		return err
+	}
+
+	AddCleanupHandler(func() error {
+		cancel()
+		return nil
+	})
+
+	exp := nbd.Export{
+		Name:     node.Name,
+		Size:     rd.Size(),
+		ReaderAt: rd,
+	}
+
+	Verbosef("serving %v (%v) from snapshot %v as export %q on %v\n",
+		filename, formatBytes(uint64(exp.Size)), sn.ID().Str(), exp.Name, l.Addr())
+
+	return nbd.Serve(ctx, l, exp)
+}
@@ -6,7 +6,6 @@ import (
 	"fmt"
 	"io"
 	"sort"
-	"strings"
 
 	"github.com/restic/restic/internal/restic"
 	"github.com/spf13/cobra"
@@ -17,6 +16,9 @@ var cmdSnapshots = &cobra.Command{
 	Short: "List all snapshots",
 	Long: `
 The "snapshots" command lists all snapshots stored in the repository.
+
+With --group-by, the snapshots are grouped by host, paths and/or tags in the
+same way as for the "forget" command.
 `,
 	DisableAutoGenTag: true,
 	RunE: func(cmd *cobra.Command, args []string) error {
@@ -29,8 +31,10 @@ type SnapshotOptions struct {
 	Host    string
 	Tags    restic.TagLists
 	Paths   []string
+	Labels  restic.Labels
 	Compact bool
 	Last    bool
+	GroupBy string
 }
 
 var snapshotOptions SnapshotOptions
@@ -42,82 +46,88 @@ func init() {
 	f.StringVarP(&snapshotOptions.Host, "host", "H", "", "only consider snapshots for this `host`")
 	f.Var(&snapshotOptions.Tags, "tag", "only consider snapshots which include this `taglist` (can be specified multiple times)")
 	f.StringArrayVar(&snapshotOptions.Paths, "path", nil, "only consider snapshots for this `path` (can be specified multiple times)")
+	f.Var(&snapshotOptions.Labels, "label", "only consider snapshots which have the label `key=value` (can be specified multiple times)")
 	f.BoolVarP(&snapshotOptions.Compact, "compact", "c", false, "use compact format")
-	f.BoolVar(&snapshotOptions.Last, "last", false, "only show the last snapshot for each host and path")
+	f.BoolVar(&snapshotOptions.Last, "last", false, "only show the last snapshot for each group (default: for each host and path)")
+	f.StringVarP(&snapshotOptions.GroupBy, "group-by", "g", "", "string for grouping snapshots by host,paths,tags")
 }
 
 func runSnapshots(opts SnapshotOptions, gopts GlobalOptions, args []string) error {
-	repo, err := OpenRepository(gopts)
+	groupBy, err := restic.ParseSnapshotGroupByOptions(opts.GroupBy)
 	if err != nil {
 		return err
 	}
 
-	if !gopts.NoLock {
-		lock, err := lockRepo(repo)
-		defer unlockRepo(lock)
-		if err != nil {
-			return err
-		}
+	repo, err := OpenRepository(gopts)
+	if err != nil {
+		return err
 	}
 
+	// reading the snapshots needs no lock, see lock.go
 	ctx, cancel := context.WithCancel(gopts.ctx)
 	defer cancel()
 
 	var list restic.Snapshots
-	for sn := range FindFilteredSnapshots(ctx, repo, opts.Host, opts.Tags, opts.Paths, args) {
+	for sn := range FindLabeledSnapshots(ctx, repo, opts.Host, opts.Tags, opts.Paths, opts.Labels, args) {
 		list = append(list, sn)
 	}
 
 	if opts.Last {
-		list = FilterLastSnapshots(list)
+		lastGroupBy := groupBy
+		if lastGroupBy.Empty() {
+			lastGroupBy = restic.SnapshotGroupByOptions{Host: true, Path: true}
+		}
+		list = FilterLastSnapshots(list, lastGroupBy)
 	}
 
 	sort.Sort(sort.Reverse(list))
 
+	if groupBy.Empty() {
+		if gopts.JSON {
+			err := printSnapshotsJSON(gopts.stdout, list)
+			if err != nil {
+				Warnf("error printing snapshot: %v\n", err)
+			}
+			return nil
+		}
+		PrintSnapshots(gopts.stdout, list, opts.Compact)
+
+		return nil
+	}
+
+	groups := restic.GroupSnapshots(list, groupBy)
+
 	if gopts.JSON {
-		err := printSnapshotsJSON(gopts.stdout, list)
+		err := printSnapshotGroupsJSON(gopts.stdout, groups)
 		if err != nil {
-			Warnf("error printing snapshot: %v\n", err)
+			Warnf("error printing snapshots: %v\n", err)
 		}
 		return nil
 	}
-	PrintSnapshots(gopts.stdout, list, opts.Compact)
 
-	return nil
-}
-
-// filterLastSnapshotsKey is used by FilterLastSnapshots.
-type filterLastSnapshotsKey struct {
-	Hostname    string
-	JoinedPaths string
-}
+	for i, group := range groups {
+		if i > 0 {
+			Printf("\n")
+		}
+		Printf("snapshots for (%s):\n", group.Key.String(groupBy))
+		PrintSnapshots(gopts.stdout, group.Snapshots, opts.Compact)
+	}
 
-// newFilterLastSnapshotsKey initializes a filterLastSnapshotsKey from a Snapshot
-func newFilterLastSnapshotsKey(sn *restic.Snapshot) filterLastSnapshotsKey {
-	// Shallow slice copy
-	var paths = make([]string, len(sn.Paths))
-	copy(paths, sn.Paths)
-	sort.Strings(paths)
-	return filterLastSnapshotsKey{sn.Hostname, strings.Join(paths, "|")}
+	return nil
 }
 
 // FilterLastSnapshots filters a list of snapshots to only return the last
-// entry for each hostname and path. If the snapshot contains multiple paths,
-// they will be joined and treated as one item.
-func FilterLastSnapshots(list restic.Snapshots) restic.Snapshots {
+// entry for each group, e.g. for each hostname and path. If the snapshot
+// contains multiple paths, they are treated as one item.
+func FilterLastSnapshots(list restic.Snapshots, groupBy restic.SnapshotGroupByOptions) restic.Snapshots {
 	// Sort the snapshots so that the newer ones are listed first
 	sort.SliceStable(list, func(i, j int) bool {
 		return list[i].Time.After(list[j].Time)
 	})
 
 	var results restic.Snapshots
-	seen := make(map[filterLastSnapshotsKey]bool)
-	for _, sn := range list {
-		key := newFilterLastSnapshotsKey(sn)
-		if !seen[key] {
-			seen[key] = true
-			results = append(results, sn)
-		}
+	for _, group := range restic.GroupSnapshots(list, groupBy) {
+		results = append(results, group.Snapshots[0])
 	}
 	return results
 }
@@ -220,6 +230,40 @@ type Snapshot struct {
 	ShortID string     `json:"short_id"`
 }
 
+// SnapshotGroup helps to print a group of snapshots as JSON.
+type SnapshotGroup struct {
+	GroupKey  restic.SnapshotGroupKey `json:"group_key"`
+	Snapshots []Snapshot              `json:"snapshots"`
+}
+
+func newSnapshotsJSON(list restic.Snapshots) []Snapshot {
+	snapshots := make([]Snapshot, 0, len(list))
+
+	for _, sn := range list {
+		snapshots = append(snapshots, Snapshot{
+			Snapshot: sn,
+			ID:       sn.ID(),
+			ShortID:  sn.ID().Str(),
+		})
+	}
+
+	return snapshots
+}
+
+// printSnapshotGroupsJSON writes the JSON representation of groups to stdout.
+func printSnapshotGroupsJSON(stdout io.Writer, groups []restic.SnapshotGroup) error {
+	list := make([]SnapshotGroup, 0, len(groups))
+
+	for _, group := range groups {
+		list = append(list, SnapshotGroup{
+			GroupKey:  group.Key,
+			Snapshots: newSnapshotsJSON(group.Snapshots),
+		})
+	}
+
+	return json.NewEncoder(stdout).Encode(list)
+}
+
 // printSnapshotsJSON writes the JSON representation of list to stdout.
 func printSnapshotsJSON(stdout io.Writer, list restic.Snapshots) error {
 
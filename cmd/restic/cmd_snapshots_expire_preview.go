@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+
+	"github.com/spf13/cobra"
+)
+
+var cmdSnapshotsExpirePreview = &cobra.Command{
+	Use:   "expire-preview [flags]",
+	Short: "Show when snapshots will be removed by a policy",
+	Long: `
+The "snapshots expire-preview" command shows for each snapshot the date at
+which it will be removed by the "forget" command with the given policy. The
+policy options are the same as for "forget".
+
+The prediction assumes that a new backup is made every --interval and that
+"forget" is run with the policy after each backup. Snapshots which are removed
+by the policy right away are marked with "now", snapshots which are still kept
+at the end of the --horizon are marked with "after" and the end of the
+horizon, this includes snapshots which are kept because of their tags.
+
+Nothing is removed from the repository.
+`,
+	DisableAutoGenTag: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runSnapshotsExpirePreview(expirePreviewOptions, globalOptions, args)
+	},
+}
+
+// ExpirePreviewOptions collects all options for the snapshots expire-preview
+// command.
+type ExpirePreviewOptions struct {
+	Last     int
+	Hourly   int
+	Daily    int
+	Weekly   int
+	Monthly  int
+	Yearly   int
+	KeepTags restic.TagLists
+
+	Within        restic.Duration
+	WithinHourly  restic.Duration
+	WithinDaily   restic.Duration
+	WithinWeekly  restic.Duration
+	WithinMonthly restic.Duration
+	WithinYearly  restic.Duration
+
+	Host  string
+	Tags  restic.TagLists
+	Paths []string
+
+	GroupBy  string
+	Interval time.Duration
+	Horizon  time.Duration
+}
+
+var expirePreviewOptions ExpirePreviewOptions
+
+func init() {
+	cmdSnapshots.AddCommand(cmdSnapshotsExpirePreview)
+
+	f := cmdSnapshotsExpirePreview.Flags()
+	f.IntVarP(&expirePreviewOptions.Last, "keep-last", "l", 0, "keep the last `n` snapshots")
+	f.IntVarP(&expirePreviewOptions.Hourly, "keep-hourly", "H", 0, "keep the last `n` hourly snapshots")
+	f.IntVarP(&expirePreviewOptions.Daily, "keep-daily", "d", 0, "keep the last `n` daily snapshots")
+	f.IntVarP(&expirePreviewOptions.Weekly, "keep-weekly", "w", 0, "keep the last `n` weekly snapshots")
+	f.IntVarP(&expirePreviewOptions.Monthly, "keep-monthly", "m", 0, "keep the last `n` monthly snapshots")
+	f.IntVarP(&expirePreviewOptions.Yearly, "keep-yearly", "y", 0, "keep the last `n` yearly snapshots")
+	f.Var(&expirePreviewOptions.Within, "keep-within", "keep snapshots that are newer than `duration` (eg. 1y5m7d2h) relative to the latest snapshot")
+	f.Var(&expirePreviewOptions.WithinHourly, "keep-within-hourly", "keep hourly snapshots that are newer than `duration` (eg. 1y5m7d2h) relative to the latest snapshot")
+	f.Var(&expirePreviewOptions.WithinDaily, "keep-within-daily", "keep daily snapshots that are newer than `duration` (eg. 1y5m7d2h) relative to the latest snapshot")
+	f.Var(&expirePreviewOptions.WithinWeekly, "keep-within-weekly", "keep weekly snapshots that are newer than `duration` (eg. 1y5m7d2h) relative to the latest snapshot")
+	f.Var(&expirePreviewOptions.WithinMonthly, "keep-within-monthly", "keep monthly snapshots that are newer than `duration` (eg. 1y5m7d2h) relative to the latest snapshot")
+	f.Var(&expirePreviewOptions.WithinYearly, "keep-within-yearly", "keep yearly snapshots that are newer than `duration` (eg. 1y5m7d2h) relative to the latest snapshot")
+	f.Var(&expirePreviewOptions.KeepTags, "keep-tag", "keep snapshots with this `taglist` (can be specified multiple times)")
+
+	f.StringVar(&expirePreviewOptions.Host, "host", "", "only consider snapshots with the given `host`")
+	f.Var(&expirePreviewOptions.Tags, "tag", "only consider snapshots which include this `taglist` in the format `tag[,tag,...]` (can be specified multiple times)")
+	f.StringArrayVar(&expirePreviewOptions.Paths, "path", nil, "only consider snapshots which include this (absolute) `path` (can be specified multiple times)")
+
+	f.StringVarP(&expirePreviewOptions.GroupBy, "group-by", "g", "host,paths", "string for grouping snapshots by host,paths,tags")
+	f.DurationVar(&expirePreviewOptions.Interval, "interval", 24*time.Hour, "assume a new backup is made every `duration`")
+	f.DurationVar(&expirePreviewOptions.Horizon, "horizon", 10*365*24*time.Hour, "predict the removal up to `duration` into the future")
+
+	f.SortFlags = false
+}
+
+// expirePreview is the predicted removal time of a snapshot, a nil Expires
+// means the snapshot is kept until the end of the horizon.
+type expirePreview struct {
+	ID      *restic.ID `json:"id"`
+	ShortID string     `json:"short_id"`
+	Time    time.Time  `json:"time"`
+	Expires *time.Time `json:"expires"`
+}
+
+type expirePreviewGroup struct {
+	GroupKey  restic.SnapshotGroupKey `json:"group_key"`
+	Snapshots []expirePreview         `json:"snapshots"`
+}
+
+func runSnapshotsExpirePreview(opts ExpirePreviewOptions, gopts GlobalOptions, args []string) error {
+	if len(args) != 0 {
+		return errors.Fatal("the expire-preview command expects no arguments, only options - please see `restic help snapshots expire-preview` for usage and flags")
+	}
+
+	if opts.Interval <= 0 {
+		return errors.Fatal("--interval must be larger than zero")
+	}
+
+	policy := restic.ExpirePolicy{
+		Last:    opts.Last,
+		Hourly:  opts.Hourly,
+		Daily:   opts.Daily,
+		Weekly:  opts.Weekly,
+		Monthly: opts.Monthly,
+		Yearly:  opts.Yearly,
+		Tags:    opts.KeepTags,
+
+		Within:        opts.Within,
+		WithinHourly:  opts.WithinHourly,
+		WithinDaily:   opts.WithinDaily,
+		WithinWeekly:  opts.WithinWeekly,
+		WithinMonthly: opts.WithinMonthly,
+		WithinYearly:  opts.WithinYearly,
+	}
+
+	if policy.Empty() {
+		return errors.Fatal("no policy was specified")
+	}
+
+	groupBy, err := restic.ParseSnapshotGroupByOptions(opts.GroupBy)
+	if err != nil {
+		return err
+	}
+
+	repo, err := OpenRepository(gopts)
+	if err != nil {
+		return err
+	}
+
+	// reading the snapshots needs no lock, see lock.go
+	ctx, cancel := context.WithCancel(gopts.ctx)
+	defer cancel()
+
+	var list restic.Snapshots
+	for sn := range FindFilteredSnapshots(ctx, repo, opts.Host, opts.Tags, opts.Paths, nil) {
+		list = append(list, sn)
+	}
+
+	now := time.Now()
+	until := now.Add(opts.Horizon)
+
+	var groups []expirePreviewGroup
+	for _, group := range restic.GroupSnapshots(list, groupBy) {
+		expires := restic.ExpireTimes(group.Snapshots, policy, now, opts.Interval, until)
+
+		sort.Sort(sort.Reverse(group.Snapshots))
+
+		res := expirePreviewGroup{GroupKey: group.Key}
+		for _, sn := range group.Snapshots {
+			p := expirePreview{
+				ID:      sn.ID(),
+				ShortID: sn.ID().Str(),
+				Time:    sn.Time,
+			}
+
+			if t, ok := expires[sn]; ok {
+				p.Expires = &t
+			}
+
+			res.Snapshots = append(res.Snapshots, p)
+		}
+
+		groups = append(groups, res)
+	}
+
+	if gopts.JSON {
+		return json.NewEncoder(gopts.stdout).Encode(groups)
+	}
+
+	for i, group := range groups {
+		if i > 0 {
+			Printf("\n")
+		}
+		if !groupBy.Empty() {
+			Printf("snapshots for (%s):\n", group.GroupKey.String(groupBy))
+		}
+		printExpirePreview(gopts.stdout, group.Snapshots, now, until)
+	}
+
+	return nil
+}
+
+// printExpirePreview prints a table with the snapshots and the dates at which
+// they are removed.
+func printExpirePreview(stdout io.Writer, list []expirePreview, now, until time.Time) {
+	tab := NewTable()
+	tab.Header = fmt.Sprintf("%-8s  %-19s  %s", "ID", "Date", "Removed")
+	tab.RowFormat = "%-8s  %-19s  %s"
+
+	var expiring int
+	for _, p := range list {
+		var removed string
+		switch {
+		case p.Expires == nil:
+			removed = "after " + until.Format("2006-01-02")
+		case p.Expires.Equal(now):
+			removed = "now"
+		default:
+			removed = p.Expires.Format("2006-01-02")
+		}
+
+		if p.Expires != nil {
+			expiring++
+		}
+
+		tab.Rows = append(tab.Rows, []interface{}{p.ShortID, p.Time.Format(TimeFormat), removed})
+	}
+
+	tab.Footer = fmt.Sprintf("%d snapshots, %d removed until %v", len(list), expiring, until.Format("2006-01-02"))
+	tab.Write(stdout)
+}
@@ -0,0 +1,638 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+
+	"github.com/spf13/cobra"
+)
+
+var cmdStats = &cobra.Command{
+	Use:   "stats [flags] [snapshotID ...]",
+	Short: "Show statistics and estimate storage costs",
+	Long: `
+The "stats" command shows how much data the repository contains and how much
+data needs to be downloaded to restore the snapshots given as arguments (by
+default the latest snapshot).
+
+With "--pricing", the monthly storage cost and the cost of a restore are
+estimated from the prices of a storage provider. The prices can also be set
+(or the ones from the preset overridden) with the "--price-*" options, all
+prices are in US dollars. With "--prune", the data "prune" would need to
+download and upload is estimated as well, this needs to read all snapshots.
+
+The prices of the presets are list prices at the time of writing and may
+differ from what the provider charges, the results are only an estimate.
+
+With "--mode", the data of the snapshots is counted in one of these ways:
+
+ restore-size       the number and size of the files which would be restored
+ files-by-contents  the number and size of files with distinct contents
+ raw-data           the number and size of the distinct blobs (file data and
+                    trees), i.e. the deduplicated size of the snapshots
+ blobs-per-file     the number and size of the distinct blobs of each file
+                    with distinct contents
+
+Pass "--all" to count all snapshots in the repository.
+
+With "--history", the statistics which the backup stored in each snapshot are
+printed as well, e.g. the number of new and changed files and the amount of
+data added. Snapshots created by older versions of restic have no statistics.
+`,
+	DisableAutoGenTag: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runStats(statsOptions, globalOptions, args)
+	},
+}
+
+// StatsOptions collects all options for the stats command.
+type StatsOptions struct {
+	Pricing string
+	Prices  pricing
+	Prune   bool
+	Mode    string
+	All     bool
+	History bool
+}
+
+var statsOptions StatsOptions
+
+func init() {
+	cmdRoot.AddCommand(cmdStats)
+
+	f := cmdStats.Flags()
+	f.StringVar(&statsOptions.Pricing, "pricing", "", "estimate costs with the prices of `provider` (b2, s3, s3-ia, pcloud-500g, pcloud-2t)")
+	f.Float64Var(&statsOptions.Prices.StoragePerGB, "price-storage", 0, "price per GB stored for a month")
+	f.Float64Var(&statsOptions.Prices.DownloadPerGB, "price-download", 0, "price per GB downloaded")
+	f.Float64Var(&statsOptions.Prices.ReadRequests, "price-read", 0, "price per 1000 read requests")
+	f.Float64Var(&statsOptions.Prices.WriteRequests, "price-write", 0, "price per 1000 write requests")
+	f.BoolVar(&statsOptions.Prune, "prune", false, "estimate the data transferred by prune")
+	f.StringVar(&statsOptions.Mode, "mode", "", "count the data of the snapshots in `mode` (restore-size, files-by-contents, raw-data, blobs-per-file)")
+	f.BoolVar(&statsOptions.All, "all", false, "use all snapshots instead of the latest one")
+	f.BoolVar(&statsOptions.History, "history", false, "show the statistics of the backups which created the snapshots")
+}
+
+// Modes for counting the data of snapshots.
+const (
+	countModeRestoreSize     = "restore-size"
+	countModeFilesByContents = "files-by-contents"
+	countModeRawData         = "raw-data"
+	countModeBlobsPerFile    = "blobs-per-file"
+)
+
+var countModes = []string{countModeRestoreSize, countModeFilesByContents, countModeRawData, countModeBlobsPerFile}
+
+// restoreStats contains the amount of data needed to restore snapshots.
+type restoreStats struct {
+	Snapshots   int    `json:"snapshots"`
+	Files       uint64 `json:"files"`
+	RestoreSize uint64 `json:"restore_size"`
+
+	// Blobs is the number of blobs loaded during the restore, each one is
+	// loaded with a separate request.
+	Blobs     uint64 `json:"blobs"`
+	BlobBytes uint64 `json:"blob_bytes"`
+
+	UniqueBlobs uint64 `json:"unique_blobs"`
+	UniqueBytes uint64 `json:"unique_bytes"`
+}
+
+// pruneStats contains the amount of data prune needs to transfer.
+type pruneStats struct {
+	UnusedBytes   uint64 `json:"unused_bytes"`
+	RemovePacks   int    `json:"remove_packs"`
+	RewritePacks  int    `json:"rewrite_packs"`
+	DownloadBytes uint64 `json:"download_bytes"`
+	UploadBytes   uint64 `json:"upload_bytes"`
+	Reads         uint64 `json:"reads"`
+	Writes        uint64 `json:"writes"`
+}
+
+// costStats contains the estimated costs.
+type costStats struct {
+	StorageMonthly float64  `json:"storage_monthly"`
+	Restore        float64  `json:"restore"`
+	Prune          *float64 `json:"prune,omitempty"`
+}
+
+// countStats contains the data of the snapshots counted with a mode.
+type countStats struct {
+	Mode           string `json:"mode"`
+	Snapshots      int    `json:"snapshots"`
+	TotalSize      uint64 `json:"total_size"`
+	TotalFileCount uint64 `json:"total_file_count,omitempty"`
+	TotalBlobCount uint64 `json:"total_blob_count,omitempty"`
+}
+
+// backupStats contains the summary of the backup which created a snapshot.
+type backupStats struct {
+	SnapshotID restic.ID               `json:"snapshot_id"`
+	Time       time.Time               `json:"time"`
+	Summary    *restic.SnapshotSummary `json:"summary"`
+}
+
+type statsResult struct {
+	Snapshots  int           `json:"snapshots"`
+	Packs      int           `json:"packs"`
+	StoredSize uint64        `json:"stored_size"`
+	Restore    restoreStats  `json:"restore"`
+	Counts     *countStats   `json:"counts,omitempty"`
+	History    []backupStats `json:"history,omitempty"`
+	Prune      *pruneStats   `json:"prune,omitempty"`
+	Pricing    *pricing      `json:"pricing,omitempty"`
+	Cost       *costStats    `json:"cost,omitempty"`
+}
+
+// treeStats contains the number of files and blobs within a tree, including
+// all subtrees.
+type treeStats struct {
+	files, size, blobs, blobBytes uint64
+}
+
+// statsWalker collects the data needed to restore trees. Trees which occur
+// more than once are only loaded once.
+type statsWalker struct {
+	repo  restic.Repository
+	trees map[restic.ID]treeStats
+	blobs restic.IDSet
+	stats *restoreStats
+}
+
+func (w *statsWalker) walk(ctx context.Context, id restic.ID) (ts treeStats, err error) {
+	if ts, ok := w.trees[id]; ok {
+		return ts, nil
+	}
+
+	tree, err := w.repo.LoadTree(ctx, id)
+	if err != nil {
+		return ts, err
+	}
+
+	for _, node := range tree.Nodes {
+		switch node.Type {
+		case "file":
+			ts.files++
+			ts.size += node.Size
+			for _, blob := range node.Content {
+				size, ok := w.repo.LookupBlobSize(blob, restic.DataBlob)
+				if !ok {
+					return ts, errors.Errorf("blob %v of file %v not found in the index", blob.Str(), node.Name)
+				}
+
+				ts.blobs++
+				ts.blobBytes += uint64(size)
+
+				if !w.blobs.Has(blob) {
+					w.blobs.Insert(blob)
+					w.stats.UniqueBlobs++
+					w.stats.UniqueBytes += uint64(size)
+				}
+			}
+		case "dir":
+			if node.Subtree == nil {
+				return ts, errors.Errorf("dir %v has no subtree", node.Name)
+			}
+
+			sub, err := w.walk(ctx, *node.Subtree)
+			if err != nil {
+				return ts, err
+			}
+
+			ts.files += sub.files
+			ts.size += sub.size
+			ts.blobs += sub.blobs
+			ts.blobBytes += sub.blobBytes
+		}
+	}
+
+	w.trees[id] = ts
+	return ts, nil
+}
+
+// countWalker counts the data of trees for all modes except restore-size,
+// which uses the statsWalker. Everything is only counted once, so trees which
+// were already visited are skipped.
+type countWalker struct {
+	repo  restic.Repository
+	mode  string
+	trees restic.IDSet
+	blobs restic.BlobSet
+	files restic.IDSet
+	stats *countStats
+}
+
+func newCountWalker(repo restic.Repository, stats *countStats) *countWalker {
+	return &countWalker{
+		repo:  repo,
+		mode:  stats.Mode,
+		trees: restic.NewIDSet(),
+		blobs: restic.NewBlobSet(),
+		files: restic.NewIDSet(),
+		stats: stats,
+	}
+}
+
+// blobSize returns the size of the blob h.
+func (w *countWalker) blobSize(h restic.BlobHandle) (uint64, error) {
+	size, ok := w.repo.LookupBlobSize(h.ID, h.Type)
+	if !ok {
+		return 0, errors.Errorf("%v blob %v not found in the index", h.Type, h.ID.Str())
+	}
+	return uint64(size), nil
+}
+
+// addBlob counts the blob h unless it was counted before.
+func (w *countWalker) addBlob(h restic.BlobHandle) error {
+	if w.blobs.Has(h) {
+		return nil
+	}
+	w.blobs.Insert(h)
+
+	size, err := w.blobSize(h)
+	if err != nil {
+		return err
+	}
+
+	w.stats.TotalBlobCount++
+	w.stats.TotalSize += size
+	return nil
+}
+
+// addFile counts the file node according to the mode.
+func (w *countWalker) addFile(node *restic.Node) error {
+	if w.mode == countModeRawData {
+		for _, id := range node.Content {
+			err := w.addBlob(restic.BlobHandle{ID: id, Type: restic.DataBlob})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// files are identified by the list of their blobs
+	buf := make([]byte, 0, len(node.Content)*len(restic.ID{}))
+	for _, id := range node.Content {
+		buf = append(buf, id[:]...)
+	}
+	key := restic.Hash(buf)
+	if w.files.Has(key) {
+		return nil
+	}
+	w.files.Insert(key)
+	w.stats.TotalFileCount++
+
+	if w.mode == countModeFilesByContents {
+		w.stats.TotalSize += node.Size
+		return nil
+	}
+
+	seen := restic.NewIDSet()
+	for _, id := range node.Content {
+		if seen.Has(id) {
+			continue
+		}
+		seen.Insert(id)
+
+		size, err := w.blobSize(restic.BlobHandle{ID: id, Type: restic.DataBlob})
+		if err != nil {
+			return err
+		}
+
+		w.stats.TotalBlobCount++
+		w.stats.TotalSize += size
+	}
+
+	return nil
+}
+
+func (w *countWalker) walk(ctx context.Context, id restic.ID) error {
+	if w.trees.Has(id) {
+		return nil
+	}
+	w.trees.Insert(id)
+
+	if w.mode == countModeRawData {
+		err := w.addBlob(restic.BlobHandle{ID: id, Type: restic.TreeBlob})
+		if err != nil {
+			return err
+		}
+	}
+
+	tree, err := w.repo.LoadTree(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	for _, node := range tree.Nodes {
+		switch node.Type {
+		case "file":
+			err = w.addFile(node)
+		case "dir":
+			if node.Subtree == nil {
+				return errors.Errorf("dir %v has no subtree", node.Name)
+			}
+			err = w.walk(ctx, *node.Subtree)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// estimatePrune computes which packs prune would remove and rewrite, using
+// the same criteria as prune.
+func estimatePrune(ctx context.Context, repo restic.Repository, packSizes map[restic.ID]int64) (*pruneStats, error) {
+	snapshots, err := restic.LoadAllSnapshots(ctx, repo)
+	if err != nil {
+		return nil, err
+	}
+
+	usedBlobs := restic.NewBlobSet()
+	seenBlobs := restic.NewBlobSet()
+	for _, sn := range snapshots {
+		err = restic.FindUsedBlobs(ctx, repo, *sn.Tree, usedBlobs, seenBlobs)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	packs := make(map[restic.ID][]restic.Blob)
+	blobCount := make(map[restic.BlobHandle]int)
+	for pb := range repo.Index().Each(ctx) {
+		packs[pb.PackID] = append(packs[pb.PackID], pb.Blob)
+		blobCount[restic.BlobHandle{ID: pb.ID, Type: pb.Type}]++
+	}
+
+	stats := &pruneStats{}
+	var keepBytes uint64
+	for id, blobs := range packs {
+		var used, rewrite bool
+		var usedBytes uint64
+		for _, blob := range blobs {
+			h := restic.BlobHandle{ID: blob.ID, Type: blob.Type}
+			if !usedBlobs.Has(h) {
+				stats.UnusedBytes += uint64(blob.Length)
+				rewrite = true
+				continue
+			}
+
+			used = true
+			usedBytes += uint64(blob.Length)
+			if blobCount[h] > 1 {
+				rewrite = true
+			}
+		}
+
+		switch {
+		case !used:
+			stats.RemovePacks++
+		case rewrite || mixedBlobs(blobs):
+			stats.RewritePacks++
+			stats.DownloadBytes += uint64(packSizes[id])
+			keepBytes += usedBytes
+		}
+	}
+
+	// prune reads the header of each pack, then downloads the packs to
+	// rewrite and uploads the blobs which are still needed in new packs
+	stats.Reads = uint64(len(packSizes) + stats.RewritePacks)
+	stats.UploadBytes = keepBytes
+	if keepBytes > 0 {
+		packSize := uint64(repo.PackSize())
+		stats.Writes = (keepBytes + packSize - 1) / packSize
+	}
+
+	// the new index is written as well
+	stats.Writes++
+
+	return stats, nil
+}
+
+func runStats(opts StatsOptions, gopts GlobalOptions, args []string) error {
+	if opts.Mode != "" && !isCountMode(opts.Mode) {
+		return errors.Fatalf("unknown mode %q, valid modes are: %v", opts.Mode, countModes)
+	}
+
+	if opts.All && len(args) > 0 {
+		return errors.Fatal("--all and snapshot IDs cannot be specified at the same time")
+	}
+
+	var prices *pricing
+	if opts.Pricing != "" {
+		preset, ok := pricingPresets[opts.Pricing]
+		if !ok {
+			return errors.Fatalf("unknown pricing %q, valid values are: %v", opts.Pricing, pricingPresetNames())
+		}
+		preset.Name = opts.Pricing
+		prices = &preset
+	}
+
+	if opts.Prices != (pricing{}) {
+		if prices == nil {
+			prices = &pricing{Name: "custom"}
+		}
+		prices.override(opts.Prices)
+	}
+
+	ctx := gopts.ctx
+
+	repo, err := OpenRepository(gopts)
+	if err != nil {
+		return err
+	}
+
+	if !gopts.NoLock {
+		lock, err := lockRepo(repo)
+		defer unlockRepo(lock)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = loadIndex(ctx, repo)
+	if err != nil {
+		return err
+	}
+
+	var res statsResult
+
+	packSizes := make(map[restic.ID]int64)
+	err = repo.List(ctx, restic.DataFile, func(id restic.ID, size int64) error {
+		packSizes[id] = size
+		res.StoredSize += uint64(size)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	res.Packs = len(packSizes)
+
+	err = repo.List(ctx, restic.SnapshotFile, func(restic.ID, int64) error {
+		res.Snapshots++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(args) == 0 && res.Snapshots > 0 && !opts.All {
+		args = []string{"latest"}
+	}
+
+	w := &statsWalker{
+		repo:  repo,
+		trees: make(map[restic.ID]treeStats),
+		blobs: restic.NewIDSet(),
+		stats: &res.Restore,
+	}
+
+	var cw *countWalker
+	if opts.Mode != "" {
+		res.Counts = &countStats{Mode: opts.Mode}
+		cw = newCountWalker(repo, res.Counts)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	for sn := range FindFilteredSnapshots(ctx, repo, "", nil, nil, args) {
+		ts, err := w.walk(ctx, *sn.Tree)
+		if err != nil {
+			return err
+		}
+
+		res.Restore.Snapshots++
+		res.Restore.Files += ts.files
+		res.Restore.RestoreSize += ts.size
+		res.Restore.Blobs += ts.blobs
+		res.Restore.BlobBytes += ts.blobBytes
+
+		if opts.History && sn.Summary != nil {
+			res.History = append(res.History, backupStats{
+				SnapshotID: *sn.ID(),
+				Time:       sn.Time,
+				Summary:    sn.Summary,
+			})
+		}
+
+		if cw == nil {
+			continue
+		}
+
+		res.Counts.Snapshots++
+		if opts.Mode == countModeRestoreSize {
+			res.Counts.TotalFileCount += ts.files
+			res.Counts.TotalSize += ts.size
+			continue
+		}
+
+		if err = cw.walk(ctx, *sn.Tree); err != nil {
+			return err
+		}
+	}
+
+	sort.Slice(res.History, func(i, j int) bool {
+		return res.History[i].Time.Before(res.History[j].Time)
+	})
+
+	if opts.Prune {
+		res.Prune, err = estimatePrune(ctx, repo, packSizes)
+		if err != nil {
+			return err
+		}
+	}
+
+	if prices != nil {
+		res.Pricing = prices
+		res.Cost = &costStats{
+			StorageMonthly: prices.storageCost(res.StoredSize),
+			Restore:        prices.transferCost(res.Restore.BlobBytes, res.Restore.Blobs, 0),
+		}
+
+		if res.Prune != nil {
+			cost := prices.transferCost(res.Prune.DownloadBytes, res.Prune.Reads, res.Prune.Writes)
+			res.Cost.Prune = &cost
+		}
+	}
+
+	if gopts.JSON {
+		return json.NewEncoder(gopts.stdout).Encode(res)
+	}
+
+	printStats(res)
+	return nil
+}
+
+// isCountMode returns true if mode is a valid value for --mode.
+func isCountMode(mode string) bool {
+	for _, m := range countModes {
+		if m == mode {
+			return true
+		}
+	}
+	return false
+}
+
+func printStats(res statsResult) {
+	Printf("snapshots:          %d\n", res.Snapshots)
+	Printf("pack files:         %d\n", res.Packs)
+	Printf("stored size:        %v\n", formatBytes(res.StoredSize))
+
+	r := res.Restore
+	if c := res.Counts; c != nil {
+		Printf("\ncounting %d snapshot(s) by %v:\n", c.Snapshots, c.Mode)
+		if c.Mode != countModeRawData {
+			Printf("  files:            %d\n", c.TotalFileCount)
+		}
+		if c.TotalBlobCount > 0 {
+			Printf("  blobs:            %d\n", c.TotalBlobCount)
+		}
+		Printf("  total size:       %v\n", formatBytes(c.TotalSize))
+	} else if r.Snapshots > 0 {
+		Printf("\nrestoring %d snapshot(s):\n", r.Snapshots)
+		Printf("  files:            %d\n", r.Files)
+		Printf("  restore size:     %v\n", formatBytes(r.RestoreSize))
+		Printf("  download:         %v in %d blobs\n", formatBytes(r.BlobBytes), r.Blobs)
+		Printf("  unique data:      %v in %d blobs\n", formatBytes(r.UniqueBytes), r.UniqueBlobs)
+	}
+
+	if len(res.History) > 0 {
+		Printf("\nbackups:\n")
+		for _, b := range res.History {
+			s := b.Summary
+			Printf("  %v %v  %d new, %d changed, %d unmodified files, %v added, %v transferred in %v\n",
+				b.SnapshotID.Str(), b.Time.Format(TimeFormat), s.FilesNew, s.FilesChanged, s.FilesUnmodified,
+				formatBytes(s.DataAdded), formatBytes(s.DataTransferred), formatDuration(s.Duration()))
+		}
+	}
+
+	if p := res.Prune; p != nil {
+		Printf("\nprune:\n")
+		Printf("  unused data:      %v\n", formatBytes(p.UnusedBytes))
+		Printf("  packs:            %d to remove, %d to rewrite\n", p.RemovePacks, p.RewritePacks)
+		Printf("  download:         %v\n", formatBytes(p.DownloadBytes))
+		Printf("  upload:           %v\n", formatBytes(p.UploadBytes))
+		Printf("  requests:         %d reads, %d writes\n", p.Reads, p.Writes)
+	}
+
+	if res.Pricing == nil {
+		return
+	}
+
+	Printf("\nestimated costs (%v: %v):\n", res.Pricing.Name, res.Pricing)
+	Printf("  storage:          %v per month\n", formatDollars(res.Cost.StorageMonthly))
+	if r.Snapshots > 0 {
+		Printf("  restore:          %v\n", formatDollars(res.Cost.Restore))
+	}
+	if res.Cost.Prune != nil {
+		Printf("  prune:            %v\n", formatDollars(*res.Cost.Prune))
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/restic/restic/internal/restic"
+
+	"github.com/spf13/cobra"
+)
+
+var cmdStatus = &cobra.Command{
+	Use:   "status",
+	Short: "Show which clients recently accessed the repository",
+	Long: `
+The "status" command prints the repository manifest, which records for each
+host the restic version and the result of the last run of every operation that
+modified the repository. An operation that is still listed as "running" while no
+lock for it exists has been interrupted.
+`,
+	DisableAutoGenTag: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runStatus(globalOptions)
+	},
+}
+
+func init() {
+	cmdRoot.AddCommand(cmdStatus)
+}
+
+// statusEntry is used to print a manifest entry as JSON.
+type statusEntry struct {
+	*restic.ManifestEntry
+	Interrupted bool `json:"interrupted"`
+}
+
+func runStatus(gopts GlobalOptions) error {
+	repo, err := OpenRepository(gopts)
+	if err != nil {
+		return err
+	}
+
+	// reading the manifest needs no lock, see lock.go
+	ctx, cancel := context.WithCancel(gopts.ctx)
+	defer cancel()
+
+	entries, err := restic.LoadManifest(ctx, repo)
+	if err != nil {
+		return err
+	}
+
+	// find the processes which currently hold a lock, a running operation
+	// without a lock has been interrupted
+	type process struct {
+		hostname string
+		pid      int
+	}
+	locked := make(map[process]struct{})
+	err = repo.List(ctx, restic.LockFile, func(id restic.ID, size int64) error {
+		lock, err := restic.LoadLock(ctx, repo, id)
+		if err != nil {
+			// ignore locks that cannot be loaded
+			return nil
+		}
+		locked[process{lock.Hostname, lock.PID}] = struct{}{}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].Hostname != entries[j].Hostname {
+			return entries[i].Hostname < entries[j].Hostname
+		}
+		return entries[i].Time.Before(entries[j].Time)
+	})
+
+	list := make([]statusEntry, 0, len(entries))
+	for _, e := range entries {
+		_, ok := locked[process{e.Hostname, e.PID}]
+		list = append(list, statusEntry{
+			ManifestEntry: e,
+			Interrupted:   e.Status == restic.ManifestRunning && !ok,
+		})
+	}
+
+	if gopts.JSON {
+		return json.NewEncoder(gopts.stdout).Encode(list)
+	}
+
+	Printf("repository %v at %v\n\n", repo.Config().ID[:10], repo.Backend().Location())
+
+	tab := NewTable()
+	tab.Header = fmt.Sprintf("%-19s  %-15s  %-10s  %-15s  %-13s  %s", "Date", "Host", "User", "Operation", "Status", "Version")
+	tab.RowFormat = "%-19s  %-15s  %-10s  %-15s  %-13s  %s"
+
+	for _, e := range list {
+		status := e.Status
+		if e.Interrupted {
+			status = "interrupted"
+		}
+
+		tab.Rows = append(tab.Rows, []interface{}{e.Time.Format(TimeFormat), e.Hostname, e.Username, e.Operation, status, e.Version})
+	}
+
+	tab.Footer = fmt.Sprintf("%d entries", len(list))
+
+	return tab.Write(gopts.stdout)
+}
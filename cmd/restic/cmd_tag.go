@@ -99,7 +99,7 @@ func changeTags(ctx context.Context, repo *repository.Repository, sn *restic.Sna
 	return changed, nil
 }
 
-func runTag(opts TagOptions, gopts GlobalOptions, args []string) error {
+func runTag(opts TagOptions, gopts GlobalOptions, args []string) (err error) {
 	if len(opts.SetTags) == 0 && len(opts.AddTags) == 0 && len(opts.RemoveTags) == 0 {
 		return errors.Fatal("nothing to do!")
 	}
@@ -112,6 +112,12 @@ func runTag(opts TagOptions, gopts GlobalOptions, args []string) error {
 		return err
 	}
 
+	// the snapshots are saved again with the new tags, the originals are
+	// removed
+	if err = checkDeleteAllowed(gopts, repo, "tag"); err != nil {
+		return err
+	}
+
 	if !gopts.NoLock {
 		Verbosef("create exclusive lock for repository\n")
 		lock, err := lockRepoExclusive(repo)
@@ -121,6 +127,9 @@ func runTag(opts TagOptions, gopts GlobalOptions, args []string) error {
 		}
 	}
 
+	finish := recordOperation(gopts, repo, "tag")
+	defer func() { finish(err) }()
+
 	changeCnt := 0
 	ctx, cancel := context.WithCancel(gopts.ctx)
 	defer cancel()
@@ -1,6 +1,10 @@
 package main
 
 import (
+	"context"
+	"time"
+
+	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/restic"
 	"github.com/spf13/cobra"
 )
@@ -10,6 +14,13 @@ var unlockCmd = &cobra.Command{
 	Short: "Remove locks other processes created",
 	Long: `
 The "unlock" command removes stale locks that have been created by other restic processes.
+
+A lock is stale if it has not been refreshed for 30 minutes, or if it was
+created on this host by a process which does not exist any more. With
+--remove-all, all locks are removed, also those of running processes. Adding
+--older-than only removes the locks which were created or refreshed more than
+the given duration ago, regardless of the host which created them. Note that
+the lock times are set by the clocks of the hosts which created the locks.
 `,
 	DisableAutoGenTag: true,
 	RunE: func(cmd *cobra.Command, args []string) error {
@@ -20,6 +31,7 @@ The "unlock" command removes stale locks that have been created by other restic
 // UnlockOptions collects all options for the unlock command.
 type UnlockOptions struct {
 	RemoveAll bool
+	OlderThan time.Duration
 }
 
 var unlockOptions UnlockOptions
@@ -28,19 +40,38 @@ func init() {
 	cmdRoot.AddCommand(unlockCmd)
 
 	unlockCmd.Flags().BoolVar(&unlockOptions.RemoveAll, "remove-all", false, "remove all locks, even non-stale ones")
+	unlockCmd.Flags().DurationVar(&unlockOptions.OlderThan, "older-than", 0, "with --remove-all, only remove locks older than `duration` (e.g. 2h)")
 }
 
 func runUnlock(opts UnlockOptions, gopts GlobalOptions) error {
+	if opts.OlderThan != 0 && !opts.RemoveAll {
+		return errors.Fatal("--older-than can only be used together with --remove-all")
+	}
+
+	if opts.OlderThan < 0 {
+		return errors.Fatalf("invalid duration %v for --older-than", opts.OlderThan)
+	}
+
 	repo, err := OpenRepository(gopts)
 	if err != nil {
 		return err
 	}
 
+	if err = checkDeleteAllowed(gopts, repo, "unlock"); err != nil {
+		return err
+	}
+
 	fn := restic.RemoveStaleLocks
 	if opts.RemoveAll {
 		fn = restic.RemoveAllLocks
 	}
 
+	if opts.OlderThan > 0 {
+		fn = func(ctx context.Context, repo restic.Repository) error {
+			return restic.RemoveLocksOlderThan(ctx, repo, opts.OlderThan)
+		}
+	}
+
 	err = fn(gopts.ctx, repo)
 	if err != nil {
 		return err
@@ -24,3 +24,8 @@ and the version of this software.
 func init() {
 	cmdRoot.AddCommand(versionCmd)
 }
+
+// programVersion returns the version which is stored in new snapshots.
+func programVersion() string {
+	return "restic " + version
+}
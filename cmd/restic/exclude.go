@@ -5,9 +5,14 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"os/user"
+	"path"
 	"path/filepath"
+	"runtime"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/restic/restic/internal/debug"
 	"github.com/restic/restic/internal/errors"
@@ -83,6 +88,15 @@ func rejectByPattern(patterns []string) RejectFunc {
 	}
 }
 
+// rejectByInsensitivePattern is like rejectByPattern but ignores the case of
+// the patterns and the file names.
+func rejectByInsensitivePattern(patterns []string) RejectFunc {
+	reject := rejectByPattern(filter.Lower(patterns))
+	return func(item string, fi os.FileInfo) bool {
+		return reject(strings.ToLower(item), fi)
+	}
+}
+
 // rejectIfPresent returns a RejectFunc which itself returns whether a path
 // should be excluded. The RejectFunc considers a file to be excluded when
 // it resides in a directory with an exclusion file, that is specified by
@@ -189,7 +203,7 @@ func gatherDevices(items []string) (deviceMap map[string]uint64, err error) {
 		if err != nil {
 			return nil, err
 		}
-		id, err := fs.DeviceID(fi)
+		id, err := fs.DeviceID(item, fi)
 		if err != nil {
 			return nil, err
 		}
@@ -202,7 +216,8 @@ func gatherDevices(items []string) (deviceMap map[string]uint64, err error) {
 }
 
 // rejectByDevice returns a RejectFunc that rejects files which are on a
-// different file systems than the files/dirs in samples.
+// different file systems than the files/dirs in samples. On Windows, only
+// directories are checked, other volumes can only be mounted there.
 func rejectByDevice(samples []string) (RejectFunc, error) {
 	allowed, err := gatherDevices(samples)
 	if err != nil {
@@ -215,27 +230,32 @@ func rejectByDevice(samples []string) (RejectFunc, error) {
 			return false
 		}
 
-		id, err := fs.DeviceID(fi)
+		if runtime.GOOS == "windows" && fi.Mode().IsRegular() {
+			return false
+		}
+
+		id, err := fs.DeviceID(item, fi)
 		if err != nil {
-			// This should never happen because gatherDevices() would have
-			// errored out earlier. If it still does that's a reason to panic.
-			panic(err)
+			debug.Log("unable to determine device of %v: %v", item, err)
+			return false
 		}
 
-		for dir := item; dir != ""; dir = filepath.Dir(dir) {
+		for dir := item; ; dir = filepath.Dir(dir) {
 			debug.Log("item %v, test dir %v", item, dir)
 
 			allowedID, ok := allowed[dir]
-			if !ok {
-				continue
-			}
+			if ok {
+				if allowedID != id {
+					debug.Log("path %q on disallowed device %d", item, id)
+					return true
+				}
 
-			if allowedID != id {
-				debug.Log("path %q on disallowed device %d", item, id)
-				return true
+				return false
 			}
 
-			return false
+			if filepath.Dir(dir) == dir {
+				break
+			}
 		}
 
 		panic(fmt.Sprintf("item %v, device id %v not found, allowedDevs: %v", item, id, allowed))
@@ -256,6 +276,12 @@ func rejectResticCache(repo *repository.Repository) (RejectFunc, error) {
 		return nil, errors.New("cacheBase is empty string")
 	}
 
+	return rejectResticCacheDir(cacheBase), nil
+}
+
+// rejectResticCacheDir returns a RejectFunc that rejects the restic cache
+// directory cacheBase and all items below it.
+func rejectResticCacheDir(cacheBase string) RejectFunc {
 	return func(item string, _ os.FileInfo) bool {
 		if fs.HasPathPrefix(cacheBase, item) {
 			debug.Log("rejecting restic cache directory %v", item)
@@ -263,5 +289,309 @@ func rejectResticCache(repo *repository.Repository) (RejectFunc, error) {
 		}
 
 		return false
+	}
+}
+
+// isResticRepo returns true if dir looks like a restic repository, which
+// means it contains the file "config" and the directories "data", "index",
+// "keys" and "snapshots".
+func isResticRepo(dir string) bool {
+	fi, err := fs.Lstat(filepath.Join(dir, "config"))
+	if err != nil || !fi.Mode().IsRegular() {
+		return false
+	}
+
+	for _, name := range []string{"data", "index", "keys", "snapshots"} {
+		fi, err := fs.Lstat(filepath.Join(dir, name))
+		if err != nil || !fi.IsDir() {
+			return false
+		}
+	}
+
+	return true
+}
+
+// rejectResticRepos returns a RejectFunc that rejects directories which
+// contain a restic repository.
+func rejectResticRepos() RejectFunc {
+	return func(item string, fi os.FileInfo) bool {
+		if fi == nil || !fi.IsDir() {
+			return false
+		}
+
+		if isResticRepo(item) {
+			debug.Log("rejecting restic repository %v", item)
+			return true
+		}
+
+		return false
+	}
+}
+
+// ownerSpec describes the owner of a file by user and group ID, a negative
+// value matches any ID.
+type ownerSpec struct {
+	uid, gid int64
+}
+
+// lookupID returns the numeric ID for name, which is either a number or a name
+// resolved with lookup.
+func lookupID(name string, lookup func(string) (string, error)) (int64, error) {
+	if id, err := strconv.ParseUint(name, 10, 32); err == nil {
+		return int64(id), nil
+	}
+
+	s, err := lookup(name)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := strconv.ParseUint(s, 10, 32)
+	if err != nil {
+		return 0, errors.Errorf("invalid ID %q for %q", s, name)
+	}
+
+	return int64(id), nil
+}
+
+// parseOwnerSpec parses s in the form "user", "user:group" or ":group", user
+// and group are either names or numeric IDs.
+func parseOwnerSpec(s string) (ownerSpec, error) {
+	spec := ownerSpec{uid: -1, gid: -1}
+
+	usr, grp := s, ""
+	if colon := strings.Index(s, ":"); colon >= 0 {
+		usr, grp = s[:colon], s[colon+1:]
+	}
+
+	if usr == "" && grp == "" {
+		return spec, errors.Errorf("invalid owner %q", s)
+	}
+
+	var err error
+	if usr != "" {
+		spec.uid, err = lookupID(usr, func(name string) (string, error) {
+			u, err := user.Lookup(name)
+			if err != nil {
+				return "", err
+			}
+			return u.Uid, nil
+		})
+		if err != nil {
+			return spec, errors.Errorf("unknown user %q: %v", usr, err)
+		}
+	}
+
+	if grp != "" {
+		spec.gid, err = lookupID(grp, func(name string) (string, error) {
+			g, err := user.LookupGroup(name)
+			if err != nil {
+				return "", err
+			}
+			return g.Gid, nil
+		})
+		if err != nil {
+			return spec, errors.Errorf("unknown group %q: %v", grp, err)
+		}
+	}
+
+	return spec, nil
+}
+
+// match returns true if uid and gid match the spec.
+func (o ownerSpec) match(uid, gid uint32) bool {
+	if o.uid >= 0 && int64(uid) != o.uid {
+		return false
+	}
+
+	if o.gid >= 0 && int64(gid) != o.gid {
+		return false
+	}
+
+	return true
+}
+
+// rejectByOwner returns a RejectFunc which rejects files whose owner does not
+// match one of the specs in include (if any) or matches one of the specs in
+// exclude. Directories are never rejected so that files below them can still
+// be selected.
+func rejectByOwner(include, exclude []string) (RejectFunc, error) {
+	if runtime.GOOS == "windows" {
+		return nil, errors.Fatal("filtering by owner is not supported on Windows")
+	}
+
+	parse := func(list []string) ([]ownerSpec, error) {
+		specs := make([]ownerSpec, 0, len(list))
+		for _, s := range list {
+			spec, err := parseOwnerSpec(s)
+			if err != nil {
+				return nil, errors.Fatal(err.Error())
+			}
+			specs = append(specs, spec)
+		}
+		return specs, nil
+	}
+
+	inc, err := parse(include)
+	if err != nil {
+		return nil, err
+	}
+
+	exc, err := parse(exclude)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(item string, fi os.FileInfo) bool {
+		if fi == nil || fi.IsDir() {
+			return false
+		}
+
+		uid, gid, err := fs.Owner(fi)
+		if err != nil {
+			debug.Log("unable to determine owner of %v: %v", item, err)
+			return false
+		}
+
+		for _, spec := range exc {
+			if spec.match(uid, gid) {
+				debug.Log("path %q excluded by owner %d:%d", item, uid, gid)
+				return true
+			}
+		}
+
+		if len(inc) == 0 {
+			return false
+		}
+
+		for _, spec := range inc {
+			if spec.match(uid, gid) {
+				return false
+			}
+		}
+
+		debug.Log("path %q not included by owner %d:%d", item, uid, gid)
+		return true
+	}, nil
+}
+
+// selectXattrs returns a function which selects the extended attributes
+// whose name matches one of the patterns in include (if any) and none of the
+// patterns in exclude. Patterns use the syntax of path.Match, e.g. "user.*".
+func selectXattrs(include, exclude []string) (func(name string) bool, error) {
+	for _, list := range [][]string{include, exclude} {
+		for _, pattern := range list {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, errors.Fatalf("invalid extended attribute pattern %q: %v", pattern, err)
+			}
+		}
+	}
+
+	match := func(patterns []string, name string) bool {
+		for _, pattern := range patterns {
+			if ok, _ := path.Match(pattern, name); ok {
+				return true
+			}
+		}
+		return false
+	}
+
+	return func(name string) bool {
+		if match(exclude, name) {
+			debug.Log("extended attribute %q excluded", name)
+			return false
+		}
+
+		return len(include) == 0 || match(include, name)
 	}, nil
 }
+
+// parseFileAge parses s as either a point in time ("2006-01-02" or
+// "2006-01-02 15:04:05", in local time) or an age relative to now, e.g. "36h",
+// "7d" or "2w".
+func parseFileAge(s string, now time.Time) (time.Time, error) {
+	for _, layout := range []string{"2006-01-02 15:04:05", "2006-01-02"} {
+		t, err := time.ParseInLocation(layout, s, time.Local)
+		if err == nil {
+			return t, nil
+		}
+	}
+
+	var unit time.Duration
+	switch {
+	case strings.HasSuffix(s, "d"):
+		unit = 24 * time.Hour
+	case strings.HasSuffix(s, "w"):
+		unit = 7 * 24 * time.Hour
+	}
+
+	if unit != 0 {
+		n, err := strconv.ParseUint(s[:len(s)-1], 10, 32)
+		if err != nil {
+			return time.Time{}, errors.Errorf("invalid age %q", s)
+		}
+		return now.Add(-time.Duration(n) * unit), nil
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return time.Time{}, errors.Errorf("invalid age %q", s)
+	}
+
+	return now.Add(-d), nil
+}
+
+// parseSize parses s as a size in bytes with an optional binary suffix, e.g.
+// "500M", "2G" or "100k".
+func parseSize(s string) (uint64, error) {
+	var unit uint64 = 1
+	num := s
+	if len(s) > 0 {
+		switch s[len(s)-1] {
+		case 'k', 'K':
+			unit = 1 << 10
+		case 'm', 'M':
+			unit = 1 << 20
+		case 'g', 'G':
+			unit = 1 << 30
+		case 't', 'T':
+			unit = 1 << 40
+		}
+
+		if unit != 1 {
+			num = s[:len(s)-1]
+		}
+	}
+
+	n, err := strconv.ParseUint(num, 10, 64)
+	if err != nil || n > (1<<64-1)/unit {
+		return 0, errors.Errorf("invalid size %q", s)
+	}
+
+	return n * unit, nil
+}
+
+// rejectByAge returns a RejectFunc which rejects files that were not modified
+// after newer or not modified before older, zero values are ignored.
+// Directories are never rejected so that files below them can still be
+// selected.
+func rejectByAge(newer, older time.Time) RejectFunc {
+	return func(item string, fi os.FileInfo) bool {
+		if fi == nil || fi.IsDir() {
+			return false
+		}
+
+		mtime := fi.ModTime()
+		if !newer.IsZero() && !mtime.After(newer) {
+			debug.Log("path %q excluded, not modified after %v", item, newer)
+			return true
+		}
+
+		if !older.IsZero() && !mtime.Before(older) {
+			debug.Log("path %q excluded, not modified before %v", item, older)
+			return true
+		}
+
+		return false
+	}
+}
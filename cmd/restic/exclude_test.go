@@ -4,8 +4,12 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strconv"
 	"testing"
+	"time"
 
+	"github.com/restic/restic/internal/fs"
 	"github.com/restic/restic/internal/test"
 )
 
@@ -36,6 +40,33 @@ func TestRejectByPattern(t *testing.T) {
 	}
 }
 
+func TestRejectByInsensitivePattern(t *testing.T) {
+	var tests = []struct {
+		filename string
+		reject   bool
+	}{
+		{filename: "/home/user/foo.GO", reject: true},
+		{filename: "/home/user/foo.c", reject: false},
+		{filename: "/home/user/foobar", reject: false},
+		{filename: "/home/user/FOObar/x", reject: true},
+		{filename: "/home/user/README", reject: false},
+		{filename: "/home/user/readme.md", reject: true},
+	}
+
+	patterns := []string{"*.go", "README.md", "/home/user/foobar/*"}
+
+	for _, tc := range tests {
+		t.Run("", func(t *testing.T) {
+			reject := rejectByInsensitivePattern(patterns)
+			res := reject(tc.filename, nil)
+			if res != tc.reject {
+				t.Fatalf("wrong result for filename %v: want %v, got %v",
+					tc.filename, tc.reject, res)
+			}
+		})
+	}
+}
+
 func TestIsExcludedByFile(t *testing.T) {
 	const (
 		tagFilename = "CACHEDIR.TAG"
@@ -162,3 +193,356 @@ func TestMultipleIsExcludedByFile(t *testing.T) {
 		}
 	}
 }
+
+func TestParseFileAge(t *testing.T) {
+	now := time.Date(2018, 3, 10, 12, 0, 0, 0, time.Local)
+
+	var tests = []struct {
+		input string
+		want  time.Time
+		err   bool
+	}{
+		{input: "2018-02-01", want: time.Date(2018, 2, 1, 0, 0, 0, 0, time.Local)},
+		{input: "2018-02-01 10:20:30", want: time.Date(2018, 2, 1, 10, 20, 30, 0, time.Local)},
+		{input: "36h", want: now.Add(-36 * time.Hour)},
+		{input: "7d", want: now.Add(-7 * 24 * time.Hour)},
+		{input: "2w", want: now.Add(-14 * 24 * time.Hour)},
+		{input: "", err: true},
+		{input: "d", err: true},
+		{input: "-5h", err: true},
+		{input: "foo", err: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.input, func(t *testing.T) {
+			res, err := parseFileAge(tc.input, now)
+			if tc.err {
+				if err == nil {
+					t.Fatalf("expected error for %q not returned", tc.input)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !res.Equal(tc.want) {
+				t.Fatalf("wrong result for %q: want %v, got %v", tc.input, tc.want, res)
+			}
+		})
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	var tests = []struct {
+		input string
+		want  uint64
+		err   bool
+	}{
+		{input: "1024", want: 1024},
+		{input: "100k", want: 100 << 10},
+		{input: "500M", want: 500 << 20},
+		{input: "2G", want: 2 << 30},
+		{input: "1t", want: 1 << 40},
+		{input: "", err: true},
+		{input: "M", err: true},
+		{input: "-5M", err: true},
+		{input: "5MB", err: true},
+		{input: "20000000T", err: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.input, func(t *testing.T) {
+			res, err := parseSize(tc.input)
+			if tc.err {
+				if err == nil {
+					t.Fatalf("expected error for %q not returned", tc.input)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if res != tc.want {
+				t.Fatalf("wrong result for %q: want %v, got %v", tc.input, tc.want, res)
+			}
+		})
+	}
+}
+
+func TestRejectByAge(t *testing.T) {
+	tempDir, cleanup := test.TempDir(t)
+	defer cleanup()
+
+	filename := filepath.Join(tempDir, "file")
+	test.OK(t, ioutil.WriteFile(filename, []byte("foo"), 0644))
+
+	mtime := time.Date(2018, 3, 10, 12, 0, 0, 0, time.Local)
+	test.OK(t, os.Chtimes(filename, mtime, mtime))
+	test.OK(t, os.Chtimes(tempDir, mtime, mtime))
+
+	fi, err := os.Lstat(filename)
+	test.OK(t, err)
+
+	dirfi, err := os.Lstat(tempDir)
+	test.OK(t, err)
+
+	var tests = []struct {
+		newer, older time.Time
+		reject       bool
+	}{
+		{reject: false},
+		{newer: mtime.Add(-time.Hour), reject: false},
+		{newer: mtime.Add(time.Hour), reject: true},
+		{older: mtime.Add(time.Hour), reject: false},
+		{older: mtime.Add(-time.Hour), reject: true},
+		{newer: mtime.Add(-time.Hour), older: mtime.Add(time.Hour), reject: false},
+		{newer: mtime, older: mtime.Add(time.Hour), reject: true},
+	}
+
+	for _, tc := range tests {
+		reject := rejectByAge(tc.newer, tc.older)
+		if res := reject(filename, fi); res != tc.reject {
+			t.Errorf("newer %v, older %v: want %v, got %v", tc.newer, tc.older, tc.reject, res)
+		}
+
+		// directories are never rejected
+		if reject(tempDir, dirfi) {
+			t.Errorf("newer %v, older %v: directory was rejected", tc.newer, tc.older)
+		}
+	}
+}
+
+func TestRejectByOwner(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("owner filters are not supported on Windows")
+	}
+
+	tempDir, cleanup := test.TempDir(t)
+	defer cleanup()
+
+	filename := filepath.Join(tempDir, "file")
+	test.OK(t, ioutil.WriteFile(filename, []byte("foo"), 0644))
+
+	fi, err := os.Lstat(filename)
+	test.OK(t, err)
+
+	uid := strconv.Itoa(os.Getuid())
+	gid := strconv.Itoa(os.Getgid())
+	other := strconv.Itoa(os.Getuid() + 1)
+
+	var tests = []struct {
+		include, exclude []string
+		reject           bool
+	}{
+		{include: []string{uid}, reject: false},
+		{include: []string{other}, reject: true},
+		{include: []string{other, uid + ":" + gid}, reject: false},
+		{include: []string{":" + gid}, reject: false},
+		{exclude: []string{uid}, reject: true},
+		{exclude: []string{other}, reject: false},
+		{exclude: []string{uid + ":" + other}, reject: false},
+		{include: []string{uid}, exclude: []string{":" + gid}, reject: true},
+	}
+
+	for _, tc := range tests {
+		reject, err := rejectByOwner(tc.include, tc.exclude)
+		test.OK(t, err)
+
+		if res := reject(filename, fi); res != tc.reject {
+			t.Errorf("include %v, exclude %v: want %v, got %v", tc.include, tc.exclude, tc.reject, res)
+		}
+	}
+
+	for _, spec := range []string{"", ":", "user-does-not-exist-for-restic"} {
+		_, err := rejectByOwner([]string{spec}, nil)
+		if err == nil {
+			t.Errorf("expected error for owner %q not returned", spec)
+		}
+	}
+}
+
+func TestRejectByDevice(t *testing.T) {
+	tempDir, cleanup := test.TempDir(t)
+	defer cleanup()
+
+	dir := filepath.Join(tempDir, "dir")
+	test.OK(t, os.Mkdir(dir, 0755))
+	filename := filepath.Join(dir, "file")
+	test.OK(t, ioutil.WriteFile(filename, []byte("foo"), 0644))
+
+	reject, err := rejectByDevice([]string{tempDir})
+	test.OK(t, err)
+
+	for _, item := range []string{dir, filename} {
+		fi, err := os.Lstat(item)
+		test.OK(t, err)
+		test.Assert(t, !reject(item, fi), "item %v on the same device was rejected", item)
+	}
+
+	if runtime.GOOS != "linux" {
+		return
+	}
+
+	// /proc is a different file system than the root directory
+	root, err := os.Lstat("/")
+	test.OK(t, err)
+	proc, err := os.Lstat("/proc/self")
+	if err != nil {
+		t.Skipf("unable to stat /proc/self: %v", err)
+	}
+
+	rootID, err := fs.DeviceID("/", root)
+	test.OK(t, err)
+	procID, err := fs.DeviceID("/proc/self", proc)
+	test.OK(t, err)
+	if rootID == procID {
+		t.Skip("/proc is on the same device as /")
+	}
+
+	reject, err = rejectByDevice([]string{"/"})
+	test.OK(t, err)
+	test.Assert(t, reject("/proc/self", proc), "/proc/self was not rejected")
+}
+
+func TestSelectXattrs(t *testing.T) {
+	var tests = []struct {
+		include, exclude []string
+		name             string
+		selected         bool
+	}{
+		{name: "user.foo", selected: true},
+		{include: []string{"user.*"}, name: "user.foo", selected: true},
+		{include: []string{"user.*"}, name: "security.selinux", selected: false},
+		{exclude: []string{"security.*"}, name: "security.selinux", selected: false},
+		{exclude: []string{"security.*"}, name: "system.posix_acl_access", selected: true},
+		{include: []string{"user.*", "system.posix_acl_*"}, name: "system.posix_acl_default", selected: true},
+		{include: []string{"user.*"}, exclude: []string{"user.xdg.*"}, name: "user.xdg.origin.url", selected: false},
+	}
+
+	for _, tc := range tests {
+		sel, err := selectXattrs(tc.include, tc.exclude)
+		test.OK(t, err)
+
+		if res := sel(tc.name); res != tc.selected {
+			t.Errorf("include %v, exclude %v, name %v: want %v, got %v", tc.include, tc.exclude, tc.name, tc.selected, res)
+		}
+	}
+
+	_, err := selectXattrs([]string{"user.["}, nil)
+	if err == nil {
+		t.Errorf("expected error for invalid pattern not returned")
+	}
+}
+
+func TestRejectResticRepos(t *testing.T) {
+	tempDir, cleanup := test.TempDir(t)
+	defer cleanup()
+
+	repo := filepath.Join(tempDir, "repo")
+	for _, dir := range []string{"data", "index", "keys", "snapshots"} {
+		test.OK(t, os.MkdirAll(filepath.Join(repo, dir), 0700))
+	}
+	test.OK(t, ioutil.WriteFile(filepath.Join(repo, "config"), []byte("foo"), 0600))
+
+	// a directory which lacks some of the subdirs is not a repository
+	other := filepath.Join(tempDir, "other")
+	test.OK(t, os.MkdirAll(filepath.Join(other, "data"), 0700))
+	test.OK(t, ioutil.WriteFile(filepath.Join(other, "config"), []byte("foo"), 0600))
+
+	reject := rejectResticRepos()
+
+	var tests = []struct {
+		path   string
+		reject bool
+	}{
+		{tempDir, false},
+		{repo, true},
+		{filepath.Join(repo, "config"), false},
+		{filepath.Join(repo, "data"), false},
+		{other, false},
+	}
+
+	for _, tc := range tests {
+		fi, err := os.Lstat(tc.path)
+		test.OK(t, err)
+
+		if res := reject(tc.path, fi); res != tc.reject {
+			t.Errorf("wrong result for %v: want %v, got %v", tc.path, tc.reject, res)
+		}
+	}
+}
+
+func TestFilterTester(t *testing.T) {
+	tester, err := newFilterTester(FilterTestOptions{
+		BackupOptions: BackupOptions{
+			Excludes:            []string{"*.go", "/home/user/tmp"},
+			InsensitiveExcludes: []string{"*.jpg"},
+		},
+		Includes: []string{"/home/user"},
+	}, GlobalOptions{CacheDir: "/home/user/.cache/restic"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		filename string
+		included bool
+		rule     string
+	}{
+		{"/home/user/foo.go", false, `--exclude "*.go"`},
+		{"/home/user/tmp/x", false, `--exclude "/home/user/tmp"`},
+		{"/home/user/IMG.JPG", false, `--iexclude "*.jpg"`},
+		{"/home/user/.cache/restic/abcd/data", false, "restic cache"},
+		{"/home/user/foo.c", true, `--include "/home/user"`},
+		{"/home/other/foo.c", false, "no --include pattern matches"},
+	}
+
+	for _, tc := range tests {
+		res := tester.test(tc.filename, nil)
+		if res.Included != tc.included || res.Rule != tc.rule {
+			t.Errorf("wrong result for %v: want %v (%v), got %v (%v)",
+				tc.filename, tc.included, tc.rule, res.Included, res.Rule)
+		}
+	}
+
+	_, err = newFilterTester(FilterTestOptions{BackupOptions: BackupOptions{Excludes: []string{"[x"}}}, GlobalOptions{}, nil)
+	if err == nil {
+		t.Fatal("invalid pattern was accepted")
+	}
+
+	_, err = newFilterTester(FilterTestOptions{BackupOptions: BackupOptions{NewerThan: "yesterday"}}, GlobalOptions{}, nil)
+	if err == nil {
+		t.Fatal("invalid --newer-than was accepted")
+	}
+}
+
+func TestFilterTesterLargerThan(t *testing.T) {
+	tempdir, cleanup := test.TempDir(t)
+	defer cleanup()
+
+	small := filepath.Join(tempdir, "small")
+	large := filepath.Join(tempdir, "large")
+	test.OK(t, ioutil.WriteFile(small, make([]byte, 10), 0600))
+	test.OK(t, ioutil.WriteFile(large, make([]byte, 2048), 0600))
+
+	tester, err := newFilterTester(FilterTestOptions{
+		BackupOptions: BackupOptions{ExcludeLargerThan: "1K"},
+	}, GlobalOptions{NoCache: true}, nil)
+	test.OK(t, err)
+
+	for _, item := range []string{small, large} {
+		fi, err := os.Lstat(item)
+		test.OK(t, err)
+
+		res := tester.test(item, fi)
+		if item == large {
+			test.Equals(t, filterResult{Path: large, Rule: `--exclude-larger-than "1K"`}, res)
+		} else {
+			test.Equals(t, filterResult{Path: small, Included: true}, res)
+		}
+	}
+}
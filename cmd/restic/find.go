@@ -74,3 +74,29 @@ func FindFilteredSnapshots(ctx context.Context, repo *repository.Repository, hos
 	}()
 	return out
 }
+
+// FindLabeledSnapshots is like FindFilteredSnapshots, but if no snapshot IDs
+// are given, it only yields the snapshots which have all labels.
+func FindLabeledSnapshots(ctx context.Context, repo *repository.Repository, host string, tags []restic.TagList, paths []string, labels restic.Labels, snapshotIDs []string) <-chan *restic.Snapshot {
+	in := FindFilteredSnapshots(ctx, repo, host, tags, paths, snapshotIDs)
+	if len(labels) == 0 || len(snapshotIDs) != 0 {
+		return in
+	}
+
+	out := make(chan *restic.Snapshot)
+	go func() {
+		defer close(out)
+		for sn := range in {
+			if !sn.HasLabels(labels) {
+				continue
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case out <- sn:
+			}
+		}
+	}()
+	return out
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/restic/restic/internal/diff"
+	"github.com/restic/restic/internal/restic"
+)
+
+// Actions for the events in the history of a path.
+const (
+	historyAdded    = "added"
+	historyModified = "modified"
+	historyRemoved  = "removed"
+)
+
+// historySnapshot identifies a snapshot in the history of a path.
+type historySnapshot struct {
+	Snapshot string    `json:"snapshot"`
+	Time     time.Time `json:"time"`
+}
+
+func newHistorySnapshot(sn *restic.Snapshot) *historySnapshot {
+	return &historySnapshot{Snapshot: sn.ID().String(), Time: sn.Time}
+}
+
+// historyEvent records that a path was added, modified or removed in a
+// snapshot.
+type historyEvent struct {
+	Action string `json:"action"`
+	historySnapshot
+}
+
+func newHistoryEvent(action string, sn *restic.Snapshot) historyEvent {
+	return historyEvent{Action: action, historySnapshot: *newHistorySnapshot(sn)}
+}
+
+// pathHistory describes in which snapshots a path was found.
+type pathHistory struct {
+	Path      string           `json:"path"`
+	FirstSeen *historySnapshot `json:"first_seen"`
+	LastSeen  *historySnapshot `json:"last_seen"`
+	Removed   *historySnapshot `json:"removed,omitempty"`
+	Events    []historyEvent   `json:"events"`
+
+	node *restic.Node
+	last int
+}
+
+// findHistory collects the history of all paths matching the pattern. The
+// snapshots must be searched ordered by time.
+type findHistory struct {
+	snapshots []*restic.Snapshot
+	paths     map[string]*pathHistory
+}
+
+func newFindHistory() *findHistory {
+	return &findHistory{paths: make(map[string]*pathHistory)}
+}
+
+// startSnapshot must be called before the matches in sn are added.
+func (h *findHistory) startSnapshot(sn *restic.Snapshot) {
+	h.snapshots = append(h.snapshots, sn)
+}
+
+// add records that path was found in the current snapshot.
+func (h *findHistory) add(path string, node *restic.Node) {
+	cur := len(h.snapshots) - 1
+	sn := h.snapshots[cur]
+
+	ph, ok := h.paths[path]
+	if !ok {
+		ph = &pathHistory{Path: path, FirstSeen: newHistorySnapshot(sn)}
+		h.paths[path] = ph
+		ph.Events = append(ph.Events, newHistoryEvent(historyAdded, sn))
+	} else {
+		c := diff.Change{Old: ph.node, New: node}
+		switch {
+		case ph.last < cur-1:
+			// the path was removed in between
+			ph.Events = append(ph.Events, newHistoryEvent(historyAdded, sn))
+		case c.TypeChanged() || c.ContentChanged():
+			ph.Events = append(ph.Events, newHistoryEvent(historyModified, sn))
+		}
+	}
+
+	ph.node = node
+	ph.last = cur
+	ph.LastSeen = newHistorySnapshot(sn)
+}
+
+// finishSnapshot records that all paths which were found in the previous
+// snapshot but not in the current one have been removed.
+func (h *findHistory) finishSnapshot() {
+	cur := len(h.snapshots) - 1
+	for _, ph := range h.paths {
+		if ph.last == cur-1 {
+			ph.Events = append(ph.Events, newHistoryEvent(historyRemoved, h.snapshots[cur]))
+		}
+	}
+}
+
+// list returns the histories sorted by path. For paths which are not
+// contained in the newest snapshot, Removed is set to the snapshot in which
+// they disappeared.
+func (h *findHistory) list() []*pathHistory {
+	list := make([]*pathHistory, 0, len(h.paths))
+	for _, ph := range h.paths {
+		if last := ph.Events[len(ph.Events)-1]; last.Action == historyRemoved {
+			ph.Removed = &last.historySnapshot
+		}
+		list = append(list, ph)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Path < list[j].Path
+	})
+
+	return list
+}
+
+func (h *findHistory) print(gopts GlobalOptions) error {
+	list := h.list()
+
+	if gopts.JSON {
+		return json.NewEncoder(gopts.stdout).Encode(list)
+	}
+
+	for i, ph := range list {
+		if i > 0 {
+			Printf("\n")
+		}
+
+		Printf("%s\n", ph.Path)
+		Printf("  first seen  %s  in snapshot %s\n", ph.FirstSeen.Time.Format(TimeFormat), ph.FirstSeen.Snapshot[:8])
+		for _, ev := range ph.Events[1:] {
+			Printf("  %-10s  %s  in snapshot %s\n", ev.Action, ev.Time.Format(TimeFormat), ev.Snapshot[:8])
+		}
+		Printf("  last seen   %s  in snapshot %s\n", ph.LastSeen.Time.Format(TimeFormat), ph.LastSeen.Snapshot[:8])
+	}
+
+	return nil
+}
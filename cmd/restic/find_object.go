@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+)
+
+// objectMatch records that a blob or tree is referenced by a path in a
+// snapshot.
+type objectMatch struct {
+	ObjectType string    `json:"object_type"`
+	ID         string    `json:"id"`
+	PackID     string    `json:"pack_id"`
+	Path       string    `json:"path"`
+	Snapshot   string    `json:"snapshot"`
+	Time       time.Time `json:"time"`
+}
+
+// objectFinder searches the snapshots for the paths which reference a set of
+// blobs and trees.
+type objectFinder struct {
+	repo restic.Repository
+
+	// wanted maps the objects to search for to the pack which contains them
+	wanted   map[restic.BlobHandle]restic.ID
+	found    map[restic.BlobHandle]bool
+	notfound restic.IDSet
+
+	matches []objectMatch
+}
+
+// newObjectFinder looks up the objects to search for in the index. With
+// tpe "pack", all blobs and trees stored in the packs are searched for,
+// otherwise the blobs (tpe "blob") or trees (tpe "tree") with the given IDs.
+// IDs may be abbreviated.
+func newObjectFinder(ctx context.Context, repo restic.Repository, tpe string, ids []string) (*objectFinder, error) {
+	f := &objectFinder{
+		repo:     repo,
+		wanted:   make(map[restic.BlobHandle]restic.ID),
+		found:    make(map[restic.BlobHandle]bool),
+		notfound: restic.NewIDSet(),
+	}
+
+	prefixes := make([]string, 0, len(ids))
+	for _, id := range ids {
+		id = strings.ToLower(id)
+		if len(id) == 0 || strings.Trim(id, "0123456789abcdef") != "" {
+			return nil, errors.Fatalf("invalid ID %q", id)
+		}
+		prefixes = append(prefixes, id)
+	}
+
+	matched := make(map[string]bool)
+	for pb := range repo.Index().Each(ctx) {
+		id := pb.ID.String()
+		switch tpe {
+		case "pack":
+			id = pb.PackID.String()
+		case "blob":
+			if pb.Type != restic.DataBlob {
+				continue
+			}
+		case "tree":
+			if pb.Type != restic.TreeBlob {
+				continue
+			}
+		}
+
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(id, prefix) {
+				f.wanted[restic.BlobHandle{ID: pb.ID, Type: pb.Type}] = pb.PackID
+				matched[prefix] = true
+			}
+		}
+	}
+
+	for _, prefix := range prefixes {
+		if !matched[prefix] {
+			Warnf("no %v with ID %v found in the index\n", tpe, prefix)
+		}
+	}
+
+	return f, nil
+}
+
+// objectType returns "tree" for trees and "blob" for data blobs.
+func objectType(h restic.BlobHandle) string {
+	if h.Type == restic.TreeBlob {
+		return "tree"
+	}
+	return "blob"
+}
+
+// add records a match for the object h at path.
+func (f *objectFinder) add(h restic.BlobHandle, path string, sn *restic.Snapshot) {
+	f.found[h] = true
+	f.matches = append(f.matches, objectMatch{
+		ObjectType: objectType(h),
+		ID:         h.ID.String(),
+		PackID:     f.wanted[h].String(),
+		Path:       path,
+		Snapshot:   sn.ID().String(),
+		Time:       sn.Time,
+	})
+}
+
+// findInTree searches the tree with the given id for the wanted objects.
+// Trees which do not reference any of them are remembered and skipped in
+// the following snapshots. It returns true if an object was found.
+func (f *objectFinder) findInTree(ctx context.Context, sn *restic.Snapshot, id restic.ID, path string) (bool, error) {
+	if f.notfound.Has(id) {
+		return false, nil
+	}
+
+	found := false
+	h := restic.BlobHandle{ID: id, Type: restic.TreeBlob}
+	if _, ok := f.wanted[h]; ok {
+		f.add(h, path, sn)
+		found = true
+	}
+
+	tree, err := f.repo.LoadTree(ctx, id)
+	if err != nil {
+		return false, err
+	}
+
+	for _, node := range tree.Nodes {
+		nodePath := filepath.Join(path, node.Name)
+
+		switch node.Type {
+		case "file":
+			// a file can contain the same blob several times
+			seen := restic.NewIDSet()
+			for _, blob := range node.Content {
+				h := restic.BlobHandle{ID: blob, Type: restic.DataBlob}
+				if _, ok := f.wanted[h]; ok && !seen.Has(blob) {
+					seen.Insert(blob)
+					f.add(h, nodePath, sn)
+					found = true
+				}
+			}
+		case "dir":
+			if node.Subtree == nil {
+				return false, errors.Errorf("dir %v has no subtree", nodePath)
+			}
+
+			subFound, err := f.findInTree(ctx, sn, *node.Subtree, nodePath)
+			if err != nil {
+				return false, err
+			}
+			found = found || subFound
+		}
+	}
+
+	if !found {
+		f.notfound.Insert(id)
+	}
+
+	return found, nil
+}
+
+func (f *objectFinder) findInSnapshot(ctx context.Context, sn *restic.Snapshot) error {
+	debug.Log("searching for %d objects in snapshot %v", len(f.wanted), sn.ID().Str())
+	_, err := f.findInTree(ctx, sn, *sn.Tree, string(filepath.Separator))
+	return err
+}
+
+// unreferenced returns the wanted objects which were not found in any of the
+// snapshots, sorted by ID.
+func (f *objectFinder) unreferenced() []restic.BlobHandle {
+	var list []restic.BlobHandle
+	for h := range f.wanted {
+		if !f.found[h] {
+			list = append(list, h)
+		}
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].ID.String() < list[j].ID.String()
+	})
+
+	return list
+}
+
+func (f *objectFinder) print(gopts GlobalOptions) error {
+	for _, h := range f.unreferenced() {
+		pack := f.wanted[h]
+		Warnf("%v %v in pack %v is not referenced by any of the snapshots\n", objectType(h), h.ID.Str(), pack.Str())
+	}
+
+	if gopts.JSON {
+		if f.matches == nil {
+			f.matches = []objectMatch{}
+		}
+		return json.NewEncoder(gopts.stdout).Encode(f.matches)
+	}
+
+	for _, m := range f.matches {
+		Printf("%s %s (pack %s) in snapshot %s (%s): %s\n",
+			m.ObjectType, m.ID[:8], m.PackID[:8], m.Snapshot[:8], m.Time.Format(TimeFormat), m.Path)
+	}
+
+	return nil
+}
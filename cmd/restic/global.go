@@ -5,10 +5,13 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net/http"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"runtime"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
@@ -18,14 +21,17 @@ import (
 	"github.com/restic/restic/internal/backend/gs"
 	"github.com/restic/restic/internal/backend/local"
 	"github.com/restic/restic/internal/backend/location"
+	"github.com/restic/restic/internal/backend/rclone"
 	"github.com/restic/restic/internal/backend/rest"
 	"github.com/restic/restic/internal/backend/s3"
 	"github.com/restic/restic/internal/backend/sftp"
 	"github.com/restic/restic/internal/backend/swift"
+	"github.com/restic/restic/internal/backend/tiered"
 	"github.com/restic/restic/internal/cache"
 	"github.com/restic/restic/internal/debug"
 	"github.com/restic/restic/internal/fs"
 	"github.com/restic/restic/internal/limiter"
+	"github.com/restic/restic/internal/metrics"
 	"github.com/restic/restic/internal/options"
 	"github.com/restic/restic/internal/repository"
 	"github.com/restic/restic/internal/restic"
@@ -39,19 +45,37 @@ var version = "compiled manually"
 
 // GlobalOptions hold all global options for restic.
 type GlobalOptions struct {
-	Repo         string
-	PasswordFile string
-	Quiet        bool
-	NoLock       bool
-	JSON         bool
-	CacheDir     string
-	NoCache      bool
-	CACerts      []string
-	CleanupCache bool
+	Repo            string
+	ColdRepo        string
+	PasswordFile    string
+	PasswordCommand string
+	Quiet           bool
+	NoLock          bool
+	JSON            bool
+	CacheDir        string
+	NoCache         bool
+	CACerts         []string
+	TLSClientCert   string
+	Proxy           string
+	CleanupCache    bool
+
+	InsecureNoPassword bool
+
+	// AllowDelete permits removing files from an append-only repository.
+	AllowDelete bool
 
 	LimitUploadKb   int
 	LimitDownloadKb int
 
+	OpenTimeout time.Duration
+
+	// PackSize overrides the minimal size of new pack files.
+	PackSize string
+
+	MetricsPush   string
+	MetricsFormat string
+	MetricsJob    string
+
 	ctx      context.Context
 	password string
 	stdout   io.Writer
@@ -60,6 +84,10 @@ type GlobalOptions struct {
 	Options []string
 
 	extended options.Options
+
+	// checkLifecycle enables refusing to open backends whose storage
+	// service has rules which delete or hide files of the repository.
+	checkLifecycle bool
 }
 
 var globalOptions = GlobalOptions{
@@ -67,31 +95,63 @@ var globalOptions = GlobalOptions{
 	stderr: os.Stderr,
 }
 
+// cancelGlobalContext aborts all operations which use the context in
+// globalOptions.
+var cancelGlobalContext context.CancelFunc
+
 func init() {
-	var cancel context.CancelFunc
-	globalOptions.ctx, cancel = context.WithCancel(context.Background())
+	globalOptions.ctx, cancelGlobalContext = context.WithCancel(context.Background())
 	AddCleanupHandler(func() error {
-		cancel()
+		cancelGlobalContext()
 		return nil
 	})
 
 	f := cmdRoot.PersistentFlags()
 	f.StringVarP(&globalOptions.Repo, "repo", "r", os.Getenv("RESTIC_REPOSITORY"), "repository to backup to or restore from (default: $RESTIC_REPOSITORY)")
+	f.StringVar(&globalOptions.ColdRepo, "cold-repo", os.Getenv("RESTIC_COLD_REPOSITORY"), "store pack files with file data in this repository `location`, everything else in --repo (default: $RESTIC_COLD_REPOSITORY)")
 	f.StringVarP(&globalOptions.PasswordFile, "password-file", "p", os.Getenv("RESTIC_PASSWORD_FILE"), "read the repository password from a file (default: $RESTIC_PASSWORD_FILE)")
+	f.StringVar(&globalOptions.PasswordCommand, "password-command", os.Getenv("RESTIC_PASSWORD_COMMAND"), "run `command` and use its output as the repository password (default: $RESTIC_PASSWORD_COMMAND)")
+	f.BoolVar(&globalOptions.InsecureNoPassword, "insecure-no-password", false, "use an empty password for the repository, must be passed to every restic command (insecure)")
+	f.BoolVar(&globalOptions.AllowDelete, "allow-delete", false, "allow removing and overwriting snapshots and data in an append-only repository")
 	f.BoolVarP(&globalOptions.Quiet, "quiet", "q", false, "do not output comprehensive progress report")
 	f.BoolVar(&globalOptions.NoLock, "no-lock", false, "do not lock the repo, this allows some operations on read-only repos")
 	f.BoolVarP(&globalOptions.JSON, "json", "", false, "set output mode to JSON for commands that support it")
 	f.StringVar(&globalOptions.CacheDir, "cache-dir", "", "set the cache directory")
 	f.BoolVar(&globalOptions.NoCache, "no-cache", false, "do not use a local cache")
 	f.StringSliceVar(&globalOptions.CACerts, "cacert", nil, "path to load root certificates from (default: use system certificates)")
+	f.StringVar(&globalOptions.TLSClientCert, "tls-client-cert", os.Getenv("RESTIC_TLS_CLIENT_CERT"), "path to a `file` containing the PEM encoded TLS client certificate and private key (default: $RESTIC_TLS_CLIENT_CERT)")
+	f.StringVar(&globalOptions.Proxy, "proxy", "", "send all HTTP requests via the proxy at `url` (default: from $HTTPS_PROXY and $HTTP_PROXY)")
 	f.BoolVar(&globalOptions.CleanupCache, "cleanup-cache", false, "auto remove old cache directories")
 	f.IntVar(&globalOptions.LimitUploadKb, "limit-upload", 0, "limits uploads to a maximum rate in KiB/s. (default: unlimited)")
 	f.IntVar(&globalOptions.LimitDownloadKb, "limit-download", 0, "limits downloads to a maximum rate in KiB/s. (default: unlimited)")
+	f.StringVar(&globalOptions.PackSize, "pack-size", os.Getenv("RESTIC_PACK_SIZE"), "create pack files of at least `size` (e.g. '16M', between 4M and 128M) (default: $RESTIC_PACK_SIZE)")
+	f.DurationVar(&globalOptions.OpenTimeout, "open-timeout", 0, "abort when opening the repository takes longer than `duration` (default: no timeout)")
 	f.StringSliceVarP(&globalOptions.Options, "option", "o", []string{}, "set extended option (`key=value`, can be specified multiple times)")
+	f.StringVar(&globalOptions.MetricsPush, "metrics-push", os.Getenv("RESTIC_METRICS_PUSH"), "push a summary of the command to the Pushgateway or OTLP endpoint at `url` (default: $RESTIC_METRICS_PUSH)")
+	f.StringVar(&globalOptions.MetricsFormat, "metrics-format", metricsFormatPushgateway, "`format` for --metrics-push, \"pushgateway\" or \"otlp\"")
+	f.StringVar(&globalOptions.MetricsJob, "metrics-job", "restic", "job name for --metrics-push")
 
 	restoreTerminal()
 }
 
+// packSize returns the pack size given with --pack-size, or zero if it is not
+// set.
+func packSize(gopts GlobalOptions) (uint, error) {
+	if gopts.PackSize == "" {
+		return 0, nil
+	}
+
+	size, err := parseSize(gopts.PackSize)
+	if err == nil {
+		err = restic.ValidPackSize(size)
+	}
+	if err != nil {
+		return 0, errors.Fatalf("invalid value for --pack-size: %v", err)
+	}
+
+	return uint(size), nil
+}
+
 // checkErrno returns nil when err is set to syscall.Errno(0), since this is no
 // error condition.
 func checkErrno(err error) error {
@@ -169,42 +229,26 @@ func Printf(format string, args ...interface{}) {
 }
 
 // Verbosef calls Printf to write the message when the verbose flag is set.
+// Nothing is printed in JSON mode, so that the output can be parsed.
 func Verbosef(format string, args ...interface{}) {
-	if globalOptions.Quiet {
+	if globalOptions.Quiet || globalOptions.JSON {
 		return
 	}
 
 	Printf(format, args...)
 }
 
-// PrintProgress wraps fmt.Printf to handle the difference in writing progress
-// information to terminals and non-terminal stdout
-func PrintProgress(format string, args ...interface{}) {
-	var (
-		message         string
-		carriageControl string
-	)
-	message = fmt.Sprintf(format, args...)
-
-	if !(strings.HasSuffix(message, "\r") || strings.HasSuffix(message, "\n")) {
-		if stdoutIsTerminal() {
-			carriageControl = "\r"
-		} else {
-			carriageControl = "\n"
-		}
-		message = fmt.Sprintf("%s%s", message, carriageControl)
-	}
+// Warnf writes the message to the configured stderr stream. In JSON mode,
+// the message is written as a JSON error message.
+func Warnf(format string, args ...interface{}) {
+	jobMetrics.addWarning()
 
-	if stdoutIsTerminal() {
-		message = fmt.Sprintf("%s%s", ClearLine(), message)
+	var err error
+	if globalOptions.JSON {
+		err = jsonWarnf(globalOptions.stderr, format, args...)
+	} else {
+		_, err = fmt.Fprintf(globalOptions.stderr, format, args...)
 	}
-
-	fmt.Print(message)
-}
-
-// Warnf writes the message to the configured stderr stream.
-func Warnf(format string, args ...interface{}) {
-	_, err := fmt.Fprintf(globalOptions.stderr, format, args...)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "unable to write to stderr: %v\n", err)
 		Exit(100)
@@ -224,12 +268,16 @@ func Exitf(exitcode int, format string, args ...interface{}) {
 
 // resolvePassword determines the password to be used for opening the repository.
 func resolvePassword(opts GlobalOptions, env string) (string, error) {
+	if opts.PasswordFile != "" && opts.PasswordCommand != "" {
+		return "", errors.Fatal("--password-file and --password-command are mutually exclusive")
+	}
+
 	if opts.PasswordFile != "" {
-		s, err := ioutil.ReadFile(opts.PasswordFile)
-		if os.IsNotExist(err) {
-			return "", errors.Fatalf("%s does not exist", opts.PasswordFile)
-		}
-		return strings.TrimSpace(string(s)), errors.Wrap(err, "Readfile")
+		return loadPasswordFromFile(opts.PasswordFile)
+	}
+
+	if opts.PasswordCommand != "" {
+		return runPasswordCommand(opts.PasswordCommand)
 	}
 
 	if pwd := os.Getenv(env); pwd != "" {
@@ -239,6 +287,44 @@ func resolvePassword(opts GlobalOptions, env string) (string, error) {
 	return "", nil
 }
 
+// loadPasswordFromFile reads the password from the file pwdFile, surrounding
+// whitespace is removed.
+func loadPasswordFromFile(pwdFile string) (string, error) {
+	s, err := ioutil.ReadFile(pwdFile)
+	if os.IsNotExist(err) {
+		return "", errors.Fatalf("%s does not exist", pwdFile)
+	}
+	return strings.TrimSpace(string(s)), errors.Wrap(err, "Readfile")
+}
+
+// runPasswordCommand runs the command and returns its output with
+// surrounding whitespace removed as the password. The command is split like
+// a shell would do, but not run by a shell.
+func runPasswordCommand(command string) (string, error) {
+	args, err := backend.SplitShellStrings(command)
+	if err != nil {
+		return "", errors.Fatalf("invalid --password-command: %v", err)
+	}
+
+	if len(args) == 0 {
+		return "", errors.Fatal("--password-command is empty")
+	}
+
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stderr = os.Stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return "", errors.Fatalf("running --password-command failed: %v", err)
+	}
+
+	password := strings.TrimSpace(string(output))
+	if password == "" {
+		return "", errors.Fatal("--password-command returned an empty password")
+	}
+
+	return password, nil
+}
+
 // readPassword reads the password from the given reader directly.
 func readPassword(in io.Reader) (password string, err error) {
 	buf := make([]byte, 1000)
@@ -268,8 +354,16 @@ func readPasswordTerminal(in *os.File, out io.Writer, prompt string) (password s
 }
 
 // ReadPassword reads the password from a password file, the environment
-// variable RESTIC_PASSWORD or prompts the user.
+// variable RESTIC_PASSWORD or prompts the user. With --insecure-no-password,
+// the empty password is returned.
 func ReadPassword(opts GlobalOptions, prompt string) (string, error) {
+	if opts.InsecureNoPassword {
+		if opts.password != "" {
+			return "", errors.Fatal("--insecure-no-password must not be used together with a password from --password-file or $RESTIC_PASSWORD")
+		}
+		return "", nil
+	}
+
 	if opts.password != "" {
 		return opts.password, nil
 	}
@@ -315,39 +409,215 @@ func ReadPasswordTwice(gopts GlobalOptions, prompt1, prompt2 string) (string, er
 	return pw1, nil
 }
 
+// checkDeleteAllowed returns an error if the repository is append-only and
+// --allow-delete was not given. op describes the operation which removes
+// files.
+func checkDeleteAllowed(gopts GlobalOptions, repo *repository.Repository, op string) error {
+	if repo.Config().AppendOnly && !gopts.AllowDelete {
+		return errors.Fatalf("the repository is append-only, %v requires --allow-delete", op)
+	}
+
+	return nil
+}
+
 const maxKeys = 20
 
+// maxPasswordTries is the number of times the password is prompted for when
+// it is typed in on the terminal.
+const maxPasswordTries = 3
+
+// errOpenTimeout is returned by runWithTimeout when the timeout has passed.
+var errOpenTimeout = errors.Fatal("opening the repository timed out")
+
+// runWithTimeout runs fn and returns its error. If timeout is positive and fn
+// does not return within timeout, the context passed to fn is cancelled and
+// errOpenTimeout is returned right away. fn must stop when its context is
+// cancelled. If it returns after the timeout, abandon is called in its
+// goroutine to release whatever fn has opened, the caller must not use the
+// results of fn in this case.
+func runWithTimeout(ctx context.Context, timeout time.Duration, fn func(context.Context) error, abandon func()) error {
+	if timeout <= 0 {
+		return fn(ctx)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var (
+		mu        sync.Mutex
+		abandoned bool
+	)
+
+	errCh := make(chan error, 1)
+	go func() {
+		err := fn(ctx)
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		if abandoned {
+			debug.Log("call returned after the timeout: %v", err)
+			if abandon != nil {
+				abandon()
+			}
+			return
+		}
+		errCh <- err
+	}()
+
+	// result reports the timeout as the cause when fn gave up because of it
+	result := func(err error) error {
+		if err != nil && ctx.Err() == context.DeadlineExceeded {
+			return errOpenTimeout
+		}
+		return err
+	}
+
+	select {
+	case err := <-errCh:
+		return result(err)
+	case <-ctx.Done():
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	// fn may have returned while the timeout passed
+	select {
+	case err := <-errCh:
+		return result(err)
+	default:
+	}
+
+	abandoned = true
+	return errOpenTimeout
+}
+
 // OpenRepository reads the password and opens the repository.
 func OpenRepository(opts GlobalOptions) (*repository.Repository, error) {
 	if opts.Repo == "" {
 		return nil, errors.Fatal("Please specify repository location (-r)")
 	}
 
-	be, err := open(opts.Repo, opts, opts.extended)
+	size, err := packSize(opts)
 	if err != nil {
 		return nil, err
 	}
 
-	be = backend.NewRetryBackend(be, 10, func(msg string, err error, d time.Duration) {
-		Warnf("%v returned error, retrying after %v: %v\n", msg, d, err)
-	})
+	// time spent contacting the repository, waiting for the password is not
+	// counted
+	var elapsed time.Duration
+	remaining := func() time.Duration {
+		if opts.OpenTimeout <= 0 {
+			return 0
+		}
+		if elapsed >= opts.OpenTimeout {
+			return time.Nanosecond
+		}
+		return opts.OpenTimeout - elapsed
+	}
 
-	s := repository.New(be)
+	// print the steps when contacting the repository failed or was slow
+	trace := newOpenTrace()
+	failed := false
+	defer func() {
+		trace.Stop()
+		if failed || elapsed > slowOpenThreshold {
+			trace.Report()
+		}
+	}()
+
+	var be restic.Backend
+	start := time.Now()
+	err = runWithTimeout(opts.ctx, remaining(), func(ctx context.Context) error {
+		gopts := opts
+		gopts.ctx = ctx
 
-	opts.password, err = ReadPassword(opts, "enter password for repository: ")
+		var err error
+		be, err = open(opts.Repo, gopts, opts.extended, trace)
+		return err
+	}, func() {
+		if be != nil {
+			_ = be.Close()
+		}
+	})
+	elapsed += time.Since(start)
 	if err != nil {
+		failed = true
 		return nil, err
 	}
 
-	err = s.SearchKey(opts.ctx, opts.password, maxKeys)
+	// count every attempt of a request which is retried
+	be = newRetryBackend(metrics.Backend(be))
+
+	s := repository.New(be)
+	jobMetrics.addRepository(s)
+
+	// the data packs are uploaded concurrently, the cold repository receives
+	// most of them
+	packRepo := opts.Repo
+	if opts.ColdRepo != "" {
+		packRepo = opts.ColdRepo
+	}
+	if n := backendConnections(packRepo, opts.extended); n > 0 {
+		s.SetUploadConcurrency(int(n))
+	}
+	if size != 0 {
+		s.SetPackSize(size)
+	}
+
+	// a password typed in on the terminal can be retried
+	tries := 1
+	if opts.password == "" && !opts.InsecureNoPassword && stdinIsTerminal() {
+		tries = maxPasswordTries
+	}
+
+	for ; tries > 0; tries-- {
+		opts.password, err = ReadPassword(opts, "enter password for repository: ")
+		if err != nil {
+			_ = be.Close()
+			return nil, err
+		}
+
+		start = time.Now()
+		err = runWithTimeout(opts.ctx, remaining(), func(ctx context.Context) error {
+			done := trace.Start("search key and load config")
+			err := s.SearchKey(ctx, opts.password, maxKeys)
+			done(err)
+			return err
+		}, func() {
+			// the backend is still used until SearchKey returns
+			_ = be.Close()
+		})
+		elapsed += time.Since(start)
+
+		if err != repository.ErrNoKeyFound || tries == 1 {
+			break
+		}
+
+		Warnf("%v, try again\n", err)
+		opts.password = ""
+	}
+
 	if err != nil {
+		// a wrong password is no reason to print the steps
+		failed = err != repository.ErrNoKeyFound
+		if err != errOpenTimeout {
+			_ = be.Close()
+		}
 		return nil, err
 	}
 
+	trace.Stop()
+
 	if stdoutIsTerminal() {
 		Verbosef("password is correct\n")
 	}
 
+	if s.Config().AppendOnly && !opts.AllowDelete {
+		s.UseAppendOnly()
+	}
+
 	if opts.NoCache {
 		return s, nil
 	}
@@ -361,6 +631,9 @@ func OpenRepository(opts GlobalOptions) (*repository.Repository, error) {
 	// start using the cache
 	s.UseCache(c)
 
+	// save the read statistics when restic exits
+	AddCleanupHandler(c.SaveStats)
+
 	oldCacheDirs, err := cache.Old(c.Base)
 	if err != nil {
 		Warnf("unable to find old cache directories: %v", err)
@@ -521,13 +794,168 @@ func parseConfig(loc location.Location, opts options.Options) (interface{}, erro
 
 		debug.Log("opening rest repository at %#v", cfg)
 		return cfg, nil
+	case "rclone":
+		cfg := loc.Config.(rclone.Config)
+		if err := opts.Apply(loc.Scheme, &cfg); err != nil {
+			return nil, err
+		}
+
+		debug.Log("opening rclone repository at %#v", cfg)
+		return cfg, nil
 	}
 
 	return nil, errors.Fatalf("invalid backend: %q", loc.Scheme)
 }
 
-// Open the backend specified by a location config.
-func open(s string, gopts GlobalOptions, opts options.Options) (restic.Backend, error) {
+// backendConnections returns the number of concurrent connections configured
+// for the backend at location s, zero is returned for backends without the
+// option.
+func backendConnections(s string, opts options.Options) uint {
+	loc, err := location.Parse(s)
+	if err != nil {
+		return 0
+	}
+
+	cfg, err := parseConfig(loc, opts)
+	if err != nil {
+		return 0
+	}
+
+	switch cfg := cfg.(type) {
+	case s3.Config:
+		return cfg.Connections
+	case gs.Config:
+		return cfg.Connections
+	case azure.Config:
+		return cfg.Connections
+	case swift.Config:
+		return cfg.Connections
+	case b2.Config:
+		return cfg.Connections
+	case rest.Config:
+		return cfg.Connections
+	case rclone.Config:
+		return cfg.Connections
+	}
+
+	return 0
+}
+
+// backendTimeout returns the timeout configured for requests to the backend at
+// location s, zero is returned for backends without the option.
+func backendTimeout(s string, opts options.Options) time.Duration {
+	loc, err := location.Parse(s)
+	if err != nil {
+		return 0
+	}
+
+	cfg, err := parseConfig(loc, opts)
+	if err != nil {
+		return 0
+	}
+
+	switch cfg := cfg.(type) {
+	case s3.Config:
+		return cfg.Timeout
+	case gs.Config:
+		return cfg.Timeout
+	case azure.Config:
+		return cfg.Timeout
+	case swift.Config:
+		return cfg.Timeout
+	case b2.Config:
+		return cfg.Timeout
+	case rest.Config:
+		return cfg.Timeout
+	case rclone.Config:
+		return cfg.Timeout
+	}
+
+	return 0
+}
+
+// newTimeoutBackend wraps be so that requests which make no progress within
+// timeout are aborted and can be retried. be is returned unchanged when
+// timeout is not positive.
+func newTimeoutBackend(be restic.Backend, timeout time.Duration) restic.Backend {
+	if timeout <= 0 {
+		return be
+	}
+
+	return backend.NewTimeoutBackend(be, timeout, func(msg string, d time.Duration) {
+		debug.Log("%v made no progress for %v", msg, d)
+		jobMetrics.addTimeout()
+	})
+}
+
+// reportBackendTimeouts prints how many backend requests timed out, if any.
+func reportBackendTimeouts() {
+	if n := jobMetrics.backendTimeouts(); n > 0 {
+		Warnf("%d backend requests made no progress and were aborted, see the -o <backend>.timeout option\n", n)
+	}
+}
+
+// newRetryBackend wraps be so that failed operations are retried, unless the
+// error is permanent.
+func newRetryBackend(be restic.Backend) restic.Backend {
+	return backend.NewRetryBackend(be, 10, func(msg string, err error, d time.Duration) {
+		Warnf("%v returned error, retrying after %v: %v\n", msg, d, err)
+		metrics.BackendRetries.Inc()
+	})
+}
+
+// Open the backend specified by a location config. The steps needed are
+// recorded in trace, which may be nil.
+func open(s string, gopts GlobalOptions, opts options.Options, trace *openTrace) (restic.Backend, error) {
+	be, err := openBackend(s, gopts, opts, trace)
+	if err != nil {
+		return nil, err
+	}
+
+	// check if config is there
+	done := trace.Start("check config file")
+	fi, err := be.Stat(gopts.ctx, restic.Handle{Type: restic.ConfigFile})
+	done(err)
+	if err != nil {
+		return nil, errors.Fatalf("unable to open config file: %v\nIs there a repository at the following location?\n%v", err, s)
+	}
+
+	if fi.Size == 0 {
+		return nil, errors.New("config file has zero size, invalid repository?")
+	}
+
+	if gopts.ColdRepo != "" {
+		cold, err := openBackend(gopts.ColdRepo, gopts, opts, trace)
+		if err != nil {
+			return nil, err
+		}
+
+		// store the data packs in the cold repository
+		be = tiered.New(be, cold)
+	}
+
+	return be, nil
+}
+
+// transport returns the HTTP transport for the backends, configured with the
+// global options and the extended options in the namespace "http".
+func transport(opts options.Options) (http.RoundTripper, error) {
+	tropts := backend.TransportOptions{
+		RootCertFilenames:        globalOptions.CACerts,
+		TLSClientCertKeyFilename: globalOptions.TLSClientCert,
+		ProxyURL:                 globalOptions.Proxy,
+	}
+
+	if err := opts.Extract("http").Apply("http", &tropts); err != nil {
+		return nil, err
+	}
+
+	return backend.Transport(tropts)
+}
+
+// openBackend opens the backend for the location s without checking that it
+// contains a repository.
+func openBackend(s string, gopts GlobalOptions, opts options.Options, trace *openTrace) (restic.Backend, error) {
 	debug.Log("parsing location %v", s)
 	loc, err := location.Parse(s)
 	if err != nil {
@@ -541,14 +969,24 @@ func open(s string, gopts GlobalOptions, opts options.Options) (restic.Backend,
 		return nil, err
 	}
 
-	rt, err := backend.Transport(globalOptions.CACerts)
+	rt, err := transport(opts)
 	if err != nil {
 		return nil, err
 	}
 
+	// record the steps needed to contact the server
+	rt = trace.Transport(rt)
+
+	// wrap the transport so that servers ignoring the Range header are detected
+	rt = backend.RangeRoundTripper(rt, func(host string) {
+		Warnf("server %v does not support range requests, discarding unneeded data\n", host)
+	})
+
 	// wrap the transport so that the throughput via HTTP is limited
 	rt = limiter.NewStaticLimiter(gopts.LimitUploadKb, gopts.LimitDownloadKb).Transport(rt)
 
+	done := trace.Start("open " + loc.Scheme + " backend")
+
 	switch loc.Scheme {
 	case "local":
 		be, err = local.Open(cfg.(local.Config))
@@ -561,35 +999,36 @@ func open(s string, gopts GlobalOptions, opts options.Options) (restic.Backend,
 	case "s3":
 		be, err = s3.Open(cfg.(s3.Config), rt)
 	case "gs":
-		be, err = gs.Open(cfg.(gs.Config))
+		be, err = gs.Open(cfg.(gs.Config), rt)
 	case "azure":
 		be, err = azure.Open(cfg.(azure.Config), rt)
 	case "swift":
 		be, err = swift.Open(cfg.(swift.Config), rt)
 	case "b2":
-		be, err = b2.Open(globalOptions.ctx, cfg.(b2.Config), rt)
+		be, err = b2.Open(gopts.ctx, cfg.(b2.Config), rt)
 	case "rest":
 		be, err = rest.Open(cfg.(rest.Config), rt)
+	case "rclone":
+		be, err = rclone.Open(cfg.(rclone.Config))
+		// wrap the backend in a LimitBackend so that the throughput is limited
+		be = limiter.LimitBackend(be, limiter.NewStaticLimiter(gopts.LimitUploadKb, gopts.LimitDownloadKb))
 
 	default:
 		return nil, errors.Fatalf("invalid backend: %q", loc.Scheme)
 	}
 
+	done(err)
 	if err != nil {
 		return nil, errors.Fatalf("unable to open repo at %v: %v", s, err)
 	}
 
-	// check if config is there
-	fi, err := be.Stat(globalOptions.ctx, restic.Handle{Type: restic.ConfigFile})
-	if err != nil {
-		return nil, errors.Fatalf("unable to open config file: %v\nIs there a repository at the following location?\n%v", err, s)
-	}
-
-	if fi.Size == 0 {
-		return nil, errors.New("config file has zero size, invalid repository?")
+	if gopts.checkLifecycle {
+		if err = checkLifecycle(gopts.ctx, be); err != nil {
+			return nil, err
+		}
 	}
 
-	return be, nil
+	return newTimeoutBackend(be, backendTimeout(s, opts)), nil
 }
 
 // Create the backend specified by URI.
@@ -605,7 +1044,7 @@ func create(s string, opts options.Options) (restic.Backend, error) {
 		return nil, err
 	}
 
-	rt, err := backend.Transport(globalOptions.CACerts)
+	rt, err := transport(opts)
 	if err != nil {
 		return nil, err
 	}
@@ -618,7 +1057,7 @@ func create(s string, opts options.Options) (restic.Backend, error) {
 	case "s3":
 		return s3.Create(cfg.(s3.Config), rt)
 	case "gs":
-		return gs.Create(cfg.(gs.Config))
+		return gs.Create(cfg.(gs.Config), rt)
 	case "azure":
 		return azure.Create(cfg.(azure.Config), rt)
 	case "swift":
@@ -627,6 +1066,8 @@ func create(s string, opts options.Options) (restic.Backend, error) {
 		return b2.Create(globalOptions.ctx, cfg.(b2.Config), rt)
 	case "rest":
 		return rest.Create(cfg.(rest.Config), rt)
+	case "rclone":
+		return rclone.Create(cfg.(rclone.Config))
 	}
 
 	debug.Log("invalid repository scheme: %v", s)
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestResolvePasswordCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test uses unix commands")
+	}
+
+	pw, err := resolvePassword(GlobalOptions{PasswordCommand: "echo '  secret  '"}, "RESTIC_TEST_UNSET")
+	rtest.OK(t, err)
+	rtest.Equals(t, "secret", pw)
+
+	for _, opts := range []GlobalOptions{
+		{PasswordCommand: "echo secret", PasswordFile: filepath.Join("testdata", "password")},
+		{PasswordCommand: "true"},
+		{PasswordCommand: "false"},
+		{PasswordCommand: "echo 'unterminated"},
+	} {
+		if _, err := resolvePassword(opts, "RESTIC_TEST_UNSET"); err == nil {
+			t.Errorf("options %+v: expected error not found", opts)
+		}
+	}
+}
+
+func TestRunWithTimeout(t *testing.T) {
+	errTest := errors.New("test error")
+	err := runWithTimeout(context.TODO(), time.Minute, func(ctx context.Context) error {
+		return errTest
+	}, func() {
+		t.Error("abandon called for a call which returned in time")
+	})
+	rtest.Equals(t, errTest, err)
+
+	// fn stops when the context is cancelled
+	err = runWithTimeout(context.TODO(), 10*time.Millisecond, func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}, nil)
+	rtest.Equals(t, errOpenTimeout, err)
+
+	// fn returns after runWithTimeout has given up
+	release := make(chan struct{})
+	abandoned := make(chan struct{})
+	err = runWithTimeout(context.TODO(), 10*time.Millisecond, func(ctx context.Context) error {
+		<-release
+		return nil
+	}, func() {
+		close(abandoned)
+	})
+	rtest.Equals(t, errOpenTimeout, err)
+	close(release)
+
+	select {
+	case <-abandoned:
+	case <-time.After(10 * time.Second):
+		t.Fatal("abandon was not called for a call which returned after the timeout")
+	}
+}
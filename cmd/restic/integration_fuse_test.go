@@ -84,6 +84,15 @@ func listSnapshots(t testing.TB, dir string) []string {
 	return names
 }
 
+func listDir(t testing.TB, dir string) []string {
+	d, err := os.Open(dir)
+	rtest.OK(t, err)
+	names, err := d.Readdirnames(-1)
+	rtest.OK(t, err)
+	rtest.OK(t, d.Close())
+	return names
+}
+
 func checkSnapshots(t testing.TB, global GlobalOptions, repo *repository.Repository, mountpoint, repodir string, snapshotIDs restic.IDs, expectedSnapshotsInFuseDir int) {
 	t.Logf("checking for %d snapshots: %v", len(snapshotIDs), snapshotIDs)
 
@@ -147,6 +156,18 @@ func checkSnapshots(t testing.TB, global GlobalOptions, repo *repository.Reposit
 	for name, present := range namesMap {
 		rtest.Assert(t, present, "Directory %s is present in fuse dir but is not a snapshot", name)
 	}
+
+	namesInIDs := listDir(t, filepath.Join(mountpoint, "ids"))
+	rtest.Equals(t, len(snapshotIDs), len(namesInIDs))
+
+	idsMap := make(map[string]bool)
+	for _, name := range namesInIDs {
+		idsMap[name] = true
+	}
+
+	for _, id := range snapshotIDs {
+		rtest.Assert(t, idsMap[id.Str()], "Snapshot %v isn't present in ids dir", id.Str())
+	}
 }
 
 func TestMount(t *testing.T) {
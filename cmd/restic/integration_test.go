@@ -1,8 +1,11 @@
 package main
 
 import (
+	"archive/tar"
+	"archive/zip"
 	"bufio"
 	"bytes"
+	"context"
 	"crypto/rand"
 	"encoding/json"
 	"fmt"
@@ -12,14 +15,17 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
 	"syscall"
 	"testing"
 	"time"
 
+	"github.com/restic/restic/internal/backend"
 	"github.com/restic/restic/internal/debug"
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/filter"
+	"github.com/restic/restic/internal/migrations"
 	"github.com/restic/restic/internal/repository"
 	"github.com/restic/restic/internal/restic"
 	rtest "github.com/restic/restic/internal/test"
@@ -46,7 +52,7 @@ func testRunInit(t testing.TB, opts GlobalOptions) {
 	repository.TestUseLowSecurityKDFParameters(t)
 	restic.TestSetLockTimeout(t, 0)
 
-	rtest.OK(t, runInit(opts, nil))
+	rtest.OK(t, runInit(InitOptions{}, opts, nil))
 	t.Logf("repository initialized at %v", opts.Repo)
 }
 
@@ -132,6 +138,10 @@ func testRunRebuildIndex(t testing.TB, gopts GlobalOptions) {
 }
 
 func testRunLs(t testing.TB, gopts GlobalOptions, snapshotID string) []string {
+	return testRunLsOptions(t, gopts, LsOptions{}, snapshotID)
+}
+
+func testRunLsOptions(t testing.TB, gopts GlobalOptions, opts LsOptions, snapshotID string, dirs ...string) []string {
 	buf := bytes.NewBuffer(nil)
 	globalOptions.stdout = buf
 	quiet := globalOptions.Quiet
@@ -141,9 +151,7 @@ func testRunLs(t testing.TB, gopts GlobalOptions, snapshotID string) []string {
 		globalOptions.Quiet = quiet
 	}()
 
-	opts := LsOptions{}
-
-	rtest.OK(t, runLs(opts, gopts, []string{snapshotID}))
+	rtest.OK(t, runLs(opts, gopts, append([]string{snapshotID}, dirs...)))
 
 	return strings.Split(string(buf.Bytes()), "\n")
 }
@@ -196,7 +204,203 @@ func testRunForget(t testing.TB, gopts GlobalOptions, args ...string) {
 }
 
 func testRunPrune(t testing.TB, gopts GlobalOptions) {
-	rtest.OK(t, runPrune(gopts))
+	rtest.OK(t, runPrune(PruneOptions{}, gopts))
+}
+
+func TestInitPreset(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	repository.TestUseLowSecurityKDFParameters(t)
+
+	err := runInit(InitOptions{Preset: "foo"}, env.gopts, nil)
+	rtest.Assert(t, err != nil, "expected error for unknown preset, got nil")
+
+	rtest.OK(t, runInit(InitOptions{Preset: "archive"}, env.gopts, nil))
+
+	repo, err := OpenRepository(env.gopts)
+	rtest.OK(t, err)
+
+	cfg := repo.Config()
+	rtest.Equals(t, uint(64*1024*1024), cfg.PackSize())
+
+	min, max := cfg.ChunkerBoundaries()
+	rtest.Equals(t, uint(1024*1024), min)
+	rtest.Equals(t, uint(16*1024*1024), max)
+
+	datafile := filepath.Join("testdata", "backup-data.tar.gz")
+	rtest.SetupTarTestFixture(t, env.testdata, datafile)
+	testRunBackup(t, []string{env.testdata}, BackupOptions{}, env.gopts)
+	testRunCheck(t, env.gopts)
+}
+
+func TestPackSize(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	repository.TestUseLowSecurityKDFParameters(t)
+
+	gopts := env.gopts
+	gopts.PackSize = "1M"
+	err := runInit(InitOptions{}, gopts, nil)
+	rtest.Assert(t, err != nil, "expected error for too small pack size, got nil")
+
+	// the pack size given to init is saved in the config
+	gopts.PackSize = "16M"
+	rtest.OK(t, runInit(InitOptions{Preset: "archive"}, gopts, nil))
+
+	repo, err := OpenRepository(env.gopts)
+	rtest.OK(t, err)
+	rtest.Equals(t, uint(16*1024*1024), repo.Config().PackSize())
+	rtest.Equals(t, uint(16*1024*1024), repo.PackSize())
+
+	// when opening the repository, it only overrides the config
+	gopts.PackSize = "32M"
+	repo, err = OpenRepository(gopts)
+	rtest.OK(t, err)
+	rtest.Equals(t, uint(16*1024*1024), repo.Config().PackSize())
+	rtest.Equals(t, uint(32*1024*1024), repo.PackSize())
+
+	gopts.PackSize = "256M"
+	_, err = OpenRepository(gopts)
+	rtest.Assert(t, err != nil, "expected error for too large pack size, got nil")
+}
+
+func TestInitChunkSizes(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	repository.TestUseLowSecurityKDFParameters(t)
+
+	for _, opts := range []InitOptions{
+		{ChunkAvgSize: "3M"},
+		{ChunkAvgSize: "16M"},
+		{ChunkMinSize: "2M", ChunkMaxSize: "1M"},
+		{ChunkMinSize: "foo"},
+		{ChunkMinSize: "32"},
+		{ChunkMaxSize: "5G"},
+	} {
+		err := runInit(opts, env.gopts, nil)
+		rtest.Assert(t, err != nil, "expected error for %+v, got nil", opts)
+	}
+
+	opts := InitOptions{Preset: "archive", ChunkMinSize: "256K", ChunkAvgSize: "512K"}
+	rtest.OK(t, runInit(opts, env.gopts, nil))
+
+	repo, err := OpenRepository(env.gopts)
+	rtest.OK(t, err)
+
+	cfg := repo.Config()
+	min, max := cfg.ChunkerBoundaries()
+	rtest.Equals(t, uint(256*1024), min)
+	rtest.Equals(t, uint(16*1024*1024), max)
+	rtest.Equals(t, uint64(512*1024), cfg.ChunkerAverageSize())
+
+	datafile := filepath.Join("testdata", "backup-data.tar.gz")
+	rtest.SetupTarTestFixture(t, env.testdata, datafile)
+	testRunBackup(t, []string{env.testdata}, BackupOptions{}, env.gopts)
+	testRunCheck(t, env.gopts)
+}
+
+func TestMigrateRepoV2(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	repository.TestUseLowSecurityKDFParameters(t)
+	restic.TestSetLockTimeout(t, 0)
+
+	err := runInit(InitOptions{RepositoryVersion: 42}, env.gopts, nil)
+	rtest.Assert(t, err != nil, "expected error for unsupported version, got nil")
+
+	// new repositories use version 1 unless version 2 is requested
+	rtest.OK(t, runInit(InitOptions{}, env.gopts, nil))
+
+	datafile := filepath.Join("testdata", "backup-data.tar.gz")
+	rtest.SetupTarTestFixture(t, env.testdata, datafile)
+	testRunBackup(t, []string{filepath.Join(env.testdata, "0", "0")}, BackupOptions{}, env.gopts)
+
+	repoVersion := func() uint {
+		repo, err := OpenRepository(env.gopts)
+		rtest.OK(t, err)
+		return repo.Config().Version
+	}
+	rtest.Equals(t, uint(1), repoVersion())
+
+	// a dry run does not change anything
+	rtest.OK(t, runMigrate(MigrateOptions{DryRun: true}, env.gopts, []string{"upgrade_repo_v2"}))
+	rtest.Equals(t, uint(1), repoVersion())
+
+	rtest.OK(t, runMigrate(MigrateOptions{}, env.gopts, []string{"upgrade_repo_v2"}))
+	rtest.Equals(t, uint(2), repoVersion())
+
+	// the migration is recorded together with the old config and skipped when
+	// it is applied again
+	repo, err := OpenRepository(env.gopts)
+	rtest.OK(t, err)
+	records, err := migrations.LoadRecords(context.TODO(), repo)
+	rtest.OK(t, err)
+	rtest.Equals(t, 1, len(records))
+	rtest.Equals(t, migrations.StatusCompleted, records[0].Status)
+	rtest.Equals(t, "1", records[0].Rollback["version"])
+	rtest.Assert(t, records[0].Rollback["config"] != "", "old config not recorded")
+
+	rtest.OK(t, runMigrate(MigrateOptions{}, env.gopts, []string{"upgrade_repo_v2"}))
+
+	env.gopts.JSON = true
+	out := bytes.NewBuffer(nil)
+	env.gopts.stdout = out
+	rtest.OK(t, runMigrateList(env.gopts))
+	env.gopts.JSON = false
+	env.gopts.stdout = os.Stdout
+
+	var list []migrationStatus
+	rtest.OK(t, json.Unmarshal(out.Bytes(), &list))
+	for _, m := range list {
+		if m.Name == "upgrade_repo_v2" {
+			rtest.Assert(t, m.Applied != nil, "migration is not listed as applied")
+		}
+	}
+
+	// the repository contains packs with and without header checksums now
+	testRunBackup(t, []string{env.testdata}, BackupOptions{}, env.gopts)
+	testRunCheck(t, env.gopts)
+
+	restoredir := filepath.Join(env.base, "restore")
+	testRunRestoreLatest(t, env.gopts, restoredir, []string{env.testdata}, "")
+	rtest.Assert(t, directoriesEqualContents(env.testdata, filepath.Join(restoredir, "testdata")),
+		"directories are not equal")
+}
+
+func TestColdRepository(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	env.gopts.ColdRepo = filepath.Join(env.base, "cold")
+	testRunInit(t, env.gopts)
+
+	datafile := filepath.Join("testdata", "backup-data.tar.gz")
+	rtest.SetupTarTestFixture(t, env.testdata, datafile)
+	testRunBackup(t, []string{env.testdata}, BackupOptions{}, env.gopts)
+	testRunCheck(t, env.gopts)
+
+	// only the packs with trees are stored in the hot repository
+	hotOpts := env.gopts
+	hotOpts.ColdRepo = ""
+	hotPacks := testRunList(t, "packs", hotOpts)
+	allPacks := testRunList(t, "packs", env.gopts)
+	rtest.Assert(t, len(hotPacks) > 0 && len(hotPacks) < len(allPacks),
+		"expected some of the %d packs in the hot repository, found %d", len(allPacks), len(hotPacks))
+
+	_, err := os.Stat(filepath.Join(env.gopts.ColdRepo, "config"))
+	rtest.Assert(t, os.IsNotExist(err), "cold repository contains a config file: %v", err)
+
+	snapshotIDs := testRunList(t, "snapshots", env.gopts)
+	rtest.Assert(t, len(snapshotIDs) == 1, "expected one snapshot, got %v", snapshotIDs)
+
+	restoredir := filepath.Join(env.base, "restore")
+	testRunRestore(t, env.gopts, restoredir, snapshotIDs[0])
+	rtest.Assert(t, directoriesEqualContents(env.testdata, filepath.Join(restoredir, "testdata")),
+		"directories are not equal")
 }
 
 func TestBackup(t *testing.T) {
@@ -572,6 +776,135 @@ func TestBackupExclude(t *testing.T) {
 		"expected file %q not in first snapshot, but it's included", "foo.tar.gz")
 	rtest.Assert(t, !includes(files, filepath.Join(string(filepath.Separator), "testdata", "private", "secret", "passwords.txt")),
 		"expected file %q not in first snapshot, but it's included", "passwords.txt")
+
+	opts.Excludes = nil
+	opts.InsensitiveExcludes = []string{"*.TAR.GZ", "PRIVATE/secret"}
+	testRunBackup(t, []string{datadir}, opts, env.gopts)
+	_, snapshotID = lastSnapshot(snapshots, loadSnapshotMap(t, env.gopts))
+	files = testRunLs(t, env.gopts, snapshotID)
+	rtest.Assert(t, !includes(files, filepath.Join(string(filepath.Separator), "testdata", "foo.tar.gz")),
+		"expected file %q not in snapshot with --iexclude, but it's included", "foo.tar.gz")
+	rtest.Assert(t, !includes(files, filepath.Join(string(filepath.Separator), "testdata", "private", "secret", "passwords.txt")),
+		"expected file %q not in snapshot with --iexclude, but it's included", "passwords.txt")
+	rtest.Assert(t, includes(files, filepath.Join(string(filepath.Separator), "testdata", "testfile1")),
+		"expected file %q in snapshot with --iexclude, but it's not included", "testfile1")
+}
+
+func TestBackupFilesFromRaw(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+
+	datadir := filepath.Join(env.base, "testdata")
+	names := []string{"# not a comment", " leading space", "other"}
+	for _, name := range names {
+		rtest.OK(t, os.MkdirAll(datadir, 0755))
+		rtest.OK(t, ioutil.WriteFile(filepath.Join(datadir, name), []byte(name), 0644))
+	}
+
+	list := filepath.Join(env.base, "files-from-raw")
+	rtest.OK(t, ioutil.WriteFile(list, []byte(filepath.Join(datadir, names[0])+"\x00"+filepath.Join(datadir, names[1])+"\x00"), 0644))
+
+	testRunBackup(t, nil, BackupOptions{FilesFromRaw: list}, env.gopts)
+	snapshotIDs := testRunList(t, "snapshots", env.gopts)
+	rtest.Assert(t, len(snapshotIDs) == 1, "expected one snapshot, got %v", snapshotIDs)
+
+	files := testRunLs(t, env.gopts, snapshotIDs[0].String())
+	for _, name := range names[:2] {
+		rtest.Assert(t, includes(files, filepath.Join(string(filepath.Separator), name)),
+			"expected file %q in snapshot, but it's not included: %v", name, files)
+	}
+	rtest.Assert(t, !includes(files, filepath.Join(string(filepath.Separator), "other")),
+		"file %q not listed in the file was included in the snapshot", "other")
+}
+
+func TestLsSort(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+
+	datadir := filepath.Join(env.base, "testdata")
+	files := map[string]int{
+		"small":  10,
+		"medium": 150,
+		"big/a":  100,
+		"big/b":  200,
+	}
+
+	for filename, size := range files {
+		fp := filepath.Join(datadir, filename)
+		rtest.OK(t, os.MkdirAll(filepath.Dir(fp), 0755))
+		rtest.OK(t, ioutil.WriteFile(fp, bytes.Repeat([]byte("x"), size), 0644))
+	}
+
+	testRunBackup(t, []string{datadir}, BackupOptions{}, env.gopts)
+	snapshotIDs := testRunList(t, "snapshots", env.gopts)
+	rtest.Assert(t, len(snapshotIDs) == 1, "expected one snapshot, got %v", snapshotIDs)
+
+	sep := string(filepath.Separator)
+	p := func(names ...string) string {
+		return sep + filepath.Join(append([]string{"testdata"}, names...)...)
+	}
+
+	lines := testRunLsOptions(t, env.gopts, LsOptions{Sort: "size"}, snapshotIDs[0].String())
+	want := []string{p(), p("big"), p("big", "b"), p("big", "a"), p("medium"), p("small"), ""}
+	rtest.Equals(t, want, lines)
+
+	lines = testRunLsOptions(t, env.gopts, LsOptions{Sort: "name"}, snapshotIDs[0].String())
+	want = []string{p(), p("big"), p("big", "a"), p("big", "b"), p("medium"), p("small"), ""}
+	rtest.Equals(t, want, lines)
+
+	lines = testRunLsOptions(t, env.gopts, LsOptions{ListLong: true, DirSize: true}, snapshotIDs[0].String())
+	sizes := make(map[string]string)
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		sizes[fields[len(fields)-1]] = fields[3]
+	}
+
+	rtest.Equals(t, "460", sizes[p()])
+	rtest.Equals(t, "300", sizes[p("big")])
+	rtest.Equals(t, "150", sizes[p("medium")])
+
+	err := runLs(LsOptions{Sort: "foo"}, env.gopts, []string{snapshotIDs[0].String()})
+	rtest.Assert(t, err != nil, "expected error for invalid sort field")
+
+	// only the contents of the given directories are listed
+	lines = testRunLsOptions(t, env.gopts, LsOptions{Sort: "name"}, snapshotIDs[0].String(), "/testdata")
+	rtest.Equals(t, []string{p("big"), p("medium"), p("small"), ""}, lines)
+
+	lines = testRunLsOptions(t, env.gopts, LsOptions{Sort: "name", Recursive: true}, snapshotIDs[0].String(), "/testdata")
+	rtest.Equals(t, []string{p("big"), p("big", "a"), p("big", "b"), p("medium"), p("small"), ""}, lines)
+
+	lines = testRunLsOptions(t, env.gopts, LsOptions{}, snapshotIDs[0].String(), "/testdata/big/")
+	sort.Strings(lines)
+	rtest.Equals(t, []string{"", p("big", "a"), p("big", "b")}, lines)
+
+	// the JSON output contains the IDs of the data blobs
+	buf := bytes.NewBuffer(nil)
+	gopts := env.gopts
+	gopts.stdout = buf
+	gopts.JSON = true
+	rtest.OK(t, runLs(LsOptions{}, gopts, []string{snapshotIDs[0].String(), "/testdata/big"}))
+
+	var nodes []lsNodeMessage
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var msg lsNodeMessage
+		rtest.OK(t, json.Unmarshal([]byte(line), &msg))
+		if msg.MessageType == msgNode {
+			nodes = append(nodes, msg)
+		}
+	}
+
+	rtest.Equals(t, 2, len(nodes))
+	for _, node := range nodes {
+		rtest.Equals(t, 1, len(node.Content))
+		rtest.Assert(t, !node.ChangeTime.IsZero(), "no ctime for %v", node.Path)
+	}
 }
 
 const (
@@ -670,6 +1003,187 @@ func TestBackupTags(t *testing.T) {
 		"expected parent to be %v, got %v", parent.ID, newest.Parent)
 }
 
+func testRunSnapshotsLabeled(t testing.TB, gopts GlobalOptions, labels restic.Labels) []Snapshot {
+	buf := bytes.NewBuffer(nil)
+	gopts.stdout = buf
+	gopts.JSON = true
+
+	rtest.OK(t, runSnapshots(SnapshotOptions{Labels: labels}, gopts, nil))
+
+	var snapshots []Snapshot
+	rtest.OK(t, json.Unmarshal(buf.Bytes(), &snapshots))
+	return snapshots
+}
+
+func TestBackupLabels(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	datafile := filepath.Join("testdata", "backup-data.tar.gz")
+	testRunInit(t, env.gopts)
+	rtest.SetupTarTestFixture(t, env.testdata, datafile)
+
+	prod := restic.Labels{"env": "prod"}
+	testRunBackup(t, []string{env.testdata}, BackupOptions{}, env.gopts)
+	testRunBackup(t, []string{env.testdata}, BackupOptions{Labels: prod}, env.gopts)
+	testRunBackup(t, []string{env.testdata}, BackupOptions{Labels: restic.Labels{"env": "prod", "job": "nightly"}}, env.gopts)
+	testRunBackup(t, []string{env.testdata}, BackupOptions{Labels: restic.Labels{"env": "test"}}, env.gopts)
+
+	all := testRunSnapshotsLabeled(t, env.gopts, nil)
+	rtest.Equals(t, 4, len(all))
+	for _, sn := range all {
+		rtest.Equals(t, programVersion(), sn.ProgramVersion)
+	}
+
+	labeled := testRunSnapshotsLabeled(t, env.gopts, prod)
+	rtest.Equals(t, 2, len(labeled))
+	for _, sn := range labeled {
+		rtest.Equals(t, "prod", sn.Labels["env"])
+	}
+
+	// only the snapshots with the label are considered by forget
+	rtest.OK(t, runForget(ForgetOptions{Last: 1, Labels: prod}, env.gopts, nil))
+	rtest.Equals(t, 3, len(testRunSnapshotsLabeled(t, env.gopts, nil)))
+
+	labeled = testRunSnapshotsLabeled(t, env.gopts, prod)
+	rtest.Equals(t, 1, len(labeled))
+	rtest.Equals(t, "nightly", labeled[0].Labels["job"])
+}
+
+func TestBackupScheduleForget(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	datafile := filepath.Join("testdata", "backup-data.tar.gz")
+	testRunInit(t, env.gopts)
+	rtest.SetupTarTestFixture(t, env.testdata, datafile)
+
+	opts := BackupOptions{Hostname: "example"}
+	subdir := filepath.Join(env.testdata, "0", "0")
+	testRunBackup(t, []string{env.testdata}, opts, env.gopts)
+	testRunBackup(t, []string{env.testdata}, opts, env.gopts)
+	testRunBackup(t, []string{subdir}, opts, env.gopts)
+
+	// without a policy, nothing is removed
+	rtest.OK(t, forgetScheduled(opts, env.gopts, []string{env.testdata}))
+	rtest.Equals(t, 3, len(testRunList(t, "snapshots", env.gopts)))
+
+	// only the snapshots of the paths of the backup are considered
+	opts.Forget.Last = 1
+	rtest.OK(t, forgetScheduled(opts, env.gopts, []string{env.testdata}))
+	rtest.Equals(t, 2, len(testRunList(t, "snapshots", env.gopts)))
+
+	rtest.OK(t, forgetScheduled(opts, env.gopts, []string{subdir}))
+	rtest.Equals(t, 2, len(testRunList(t, "snapshots", env.gopts)))
+}
+
+func TestBackupSkipIfUnchanged(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	datafile := filepath.Join("testdata", "backup-data.tar.gz")
+	testRunInit(t, env.gopts)
+	rtest.SetupTarTestFixture(t, env.testdata, datafile)
+
+	opts := BackupOptions{SkipIfUnchanged: true}
+
+	testRunBackup(t, []string{env.testdata}, opts, env.gopts)
+	testRunBackup(t, []string{env.testdata}, opts, env.gopts)
+	snapshotIDs := testRunList(t, "snapshots", env.gopts)
+	rtest.Assert(t, len(snapshotIDs) == 1,
+		"expected one snapshot for an unchanged backup, got %v", snapshotIDs)
+
+	// a snapshot with different tags is saved
+	opts.Tags = []string{"foo"}
+	testRunBackup(t, []string{env.testdata}, opts, env.gopts)
+	snapshotIDs = testRunList(t, "snapshots", env.gopts)
+	rtest.Assert(t, len(snapshotIDs) == 2,
+		"expected a new snapshot with different tags, got %v", snapshotIDs)
+
+	rtest.OK(t, appendRandomData(filepath.Join(env.testdata, "new-file"), 1024))
+	testRunBackup(t, []string{env.testdata}, opts, env.gopts)
+	snapshotIDs = testRunList(t, "snapshots", env.gopts)
+	rtest.Assert(t, len(snapshotIDs) == 3,
+		"expected a new snapshot after a change, got %v", snapshotIDs)
+
+	testRunCheck(t, env.gopts)
+}
+
+func TestBackupProfileReport(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	datafile := filepath.Join("testdata", "backup-data.tar.gz")
+	testRunInit(t, env.gopts)
+	rtest.SetupTarTestFixture(t, env.testdata, datafile)
+
+	buf := bytes.NewBuffer(nil)
+	env.gopts.stdout = buf
+	testRunBackup(t, []string{env.testdata}, BackupOptions{ProfileReport: true}, env.gopts)
+	env.gopts.stdout = os.Stdout
+
+	for _, phase := range []string{restic.PhaseScan, restic.PhaseRead, restic.PhaseChunk, restic.PhaseHash, restic.PhaseEncrypt, restic.PhaseUpload, restic.PhaseIndex} {
+		rtest.Assert(t, strings.Contains(buf.String(), phase+" "),
+			"phase %q missing from profile report:\n%s", phase, buf.String())
+	}
+	rtest.Assert(t, strings.Contains(buf.String(), "most time was spent in"),
+		"slowest phase missing from profile report:\n%s", buf.String())
+}
+
+func readChangesFile(t testing.TB, filename string) map[string]backupChange {
+	data, err := ioutil.ReadFile(filename)
+	rtest.OK(t, err)
+
+	changes := make(map[string]backupChange)
+	dec := json.NewDecoder(bytes.NewReader(data))
+	for dec.More() {
+		var c backupChange
+		rtest.OK(t, dec.Decode(&c))
+		changes[c.Path] = c
+	}
+	return changes
+}
+
+func TestBackupChangesFile(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+	rtest.OK(t, os.MkdirAll(filepath.Join(env.testdata, "dir"), 0755))
+	rtest.OK(t, appendRandomData(filepath.Join(env.testdata, "modified"), 1024))
+	rtest.OK(t, appendRandomData(filepath.Join(env.testdata, "dir", "removed"), 1024))
+
+	opts := BackupOptions{ChangesFile: filepath.Join(env.base, "changes1.json")}
+	testRunBackup(t, []string{env.testdata}, opts, env.gopts)
+
+	// without a parent, everything is added
+	changes := readChangesFile(t, opts.ChangesFile)
+	rtest.Equals(t, 4, len(changes))
+	for _, c := range changes {
+		rtest.Equals(t, "added", c.Action)
+	}
+	rtest.Equals(t, uint64(1024), changes["/testdata/modified"].Size)
+
+	rtest.OK(t, appendRandomData(filepath.Join(env.testdata, "modified"), 512))
+	rtest.OK(t, os.Remove(filepath.Join(env.testdata, "dir", "removed")))
+	rtest.OK(t, appendRandomData(filepath.Join(env.testdata, "dir", "added"), 100))
+
+	opts.ChangesFile = filepath.Join(env.base, "changes2.json")
+	testRunBackup(t, []string{env.testdata}, opts, env.gopts)
+
+	changes = readChangesFile(t, opts.ChangesFile)
+
+	c := changes["/testdata/modified"]
+	rtest.Equals(t, "modified", c.Action)
+	rtest.Equals(t, "content", c.Reason)
+	rtest.Equals(t, uint64(1536), c.Size)
+	rtest.Assert(t, c.OldSize != nil && *c.OldSize == 1024, "wrong old size %v", c.OldSize)
+
+	rtest.Equals(t, "removed", changes["/testdata/dir/removed"].Action)
+	rtest.Equals(t, "added", changes["/testdata/dir/added"].Action)
+	rtest.Equals(t, uint64(100), changes["/testdata/dir/added"].Size)
+}
+
 func testRunTag(t testing.TB, opts TagOptions, gopts GlobalOptions) {
 	rtest.OK(t, runTag(opts, gopts, []string{}))
 }
@@ -753,7 +1267,7 @@ func testRunKeyListOtherIDs(t testing.TB, gopts GlobalOptions) []string {
 		globalOptions.stdout = os.Stdout
 	}()
 
-	rtest.OK(t, runKey(gopts, []string{"list"}))
+	rtest.OK(t, runKey(KeyOptions{}, gopts, []string{"list"}))
 
 	scanner := bufio.NewScanner(buf)
 	exp := regexp.MustCompile(`^ ([a-f0-9]+) `)
@@ -774,7 +1288,7 @@ func testRunKeyAddNewKey(t testing.TB, newPassword string, gopts GlobalOptions)
 		testKeyNewPassword = ""
 	}()
 
-	rtest.OK(t, runKey(gopts, []string{"add"}))
+	rtest.OK(t, runKey(KeyOptions{}, gopts, []string{"add"}))
 }
 
 func testRunKeyPasswd(t testing.TB, newPassword string, gopts GlobalOptions) {
@@ -783,13 +1297,13 @@ func testRunKeyPasswd(t testing.TB, newPassword string, gopts GlobalOptions) {
 		testKeyNewPassword = ""
 	}()
 
-	rtest.OK(t, runKey(gopts, []string{"passwd"}))
+	rtest.OK(t, runKey(KeyOptions{}, gopts, []string{"passwd"}))
 }
 
 func testRunKeyRemove(t testing.TB, gopts GlobalOptions, IDs []string) {
 	t.Logf("remove %d keys: %q\n", len(IDs), IDs)
 	for _, id := range IDs {
-		rtest.OK(t, runKey(gopts, []string{"remove", id}))
+		rtest.OK(t, runKey(KeyOptions{}, gopts, []string{"remove", id}))
 	}
 }
 
@@ -817,22 +1331,195 @@ func TestKeyAddRemove(t *testing.T) {
 
 	env.gopts.password = passwordList[len(passwordList)-1]
 	t.Logf("testing access with last password %q\n", env.gopts.password)
-	rtest.OK(t, runKey(env.gopts, []string{"list"}))
+	rtest.OK(t, runKey(KeyOptions{}, env.gopts, []string{"list"}))
 	testRunCheck(t, env.gopts)
 }
 
-func testFileSize(filename string, size int64) error {
-	fi, err := os.Stat(filename)
-	if err != nil {
-		return err
-	}
+func TestKeyNewPassword(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
 
-	if fi.Size() != size {
-		return errors.Fatalf("wrong file size for %v: expected %v, got %v", filename, size, fi.Size())
-	}
+	testRunInit(t, env.gopts)
 
-	return nil
-}
+	pwfile := filepath.Join(env.base, "new-password")
+	rtest.OK(t, ioutil.WriteFile(pwfile, []byte("  geheim2\n"), 0600))
+
+	rtest.OK(t, runKey(KeyOptions{NewPasswordFile: pwfile}, env.gopts, []string{"passwd"}))
+	env.gopts.password = "geheim2"
+	rtest.OK(t, runKey(KeyOptions{}, env.gopts, []string{"list"}))
+
+	opts := KeyOptions{NewPasswordFile: pwfile, NewInsecureNoPassword: true}
+	rtest.Assert(t, runKey(opts, env.gopts, []string{"add"}) != nil,
+		"expected an error for --new-password-file together with --new-insecure-no-password")
+
+	rtest.OK(t, ioutil.WriteFile(pwfile, nil, 0600))
+	rtest.Assert(t, runKey(KeyOptions{NewPasswordFile: pwfile}, env.gopts, []string{"add"}) != nil,
+		"expected an error for an empty password file")
+
+	rtest.OK(t, runKey(KeyOptions{NewInsecureNoPassword: true}, env.gopts, []string{"passwd"}))
+
+	// the password must not be used together with --insecure-no-password
+	env.gopts.InsecureNoPassword = true
+	rtest.Assert(t, runKey(KeyOptions{}, env.gopts, []string{"list"}) != nil,
+		"expected an error for a password together with --insecure-no-password")
+
+	env.gopts.password = ""
+	rtest.OK(t, runKey(KeyOptions{}, env.gopts, []string{"list"}))
+	testRunCheck(t, env.gopts)
+}
+
+func testFileSize(filename string, size int64) error {
+	fi, err := os.Stat(filename)
+	if err != nil {
+		return err
+	}
+
+	if fi.Size() != size {
+		return errors.Fatalf("wrong file size for %v: expected %v, got %v", filename, size, fi.Size())
+	}
+
+	return nil
+}
+
+// checkArchiveFile compares the content of a file in an archive with the
+// original below dir.
+func checkArchiveFile(t testing.TB, dir, name string, rd io.Reader) {
+	want, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+	rtest.OK(t, err)
+
+	got, err := ioutil.ReadAll(rd)
+	rtest.OK(t, err)
+
+	if !bytes.Equal(want, got) {
+		t.Errorf("content of %v in archive differs from the original", name)
+	}
+}
+
+func TestRestoreAsArchive(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	datafile := filepath.Join("testdata", "backup-data.tar.gz")
+	testRunInit(t, env.gopts)
+	rtest.SetupTarTestFixture(t, env.testdata, datafile)
+	testRunBackup(t, []string{env.testdata}, BackupOptions{}, env.gopts)
+
+	var files int
+	rtest.OK(t, filepath.Walk(env.testdata, func(p string, fi os.FileInfo, err error) error {
+		if err == nil && fi.Mode().IsRegular() {
+			files++
+		}
+		return err
+	}))
+
+	target := filepath.Join(env.base, "archives")
+	base := filepath.Dir(env.testdata)
+
+	for _, name := range []string{"restore.tar", "restore.zip"} {
+		opts := RestoreOptions{Target: target, AsArchive: name}
+		rtest.OK(t, runRestore(opts, env.gopts, []string{"latest"}))
+
+		// an existing archive is not overwritten
+		rtest.Assert(t, runRestore(opts, env.gopts, []string{"latest"}) != nil,
+			"existing archive %v was overwritten", name)
+	}
+
+	f, err := os.Open(filepath.Join(target, "restore.tar"))
+	rtest.OK(t, err)
+	defer f.Close()
+
+	var tarFiles int
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		rtest.OK(t, err)
+
+		if hdr.Typeflag == tar.TypeReg {
+			tarFiles++
+			checkArchiveFile(t, base, hdr.Name, tr)
+		}
+	}
+	rtest.Equals(t, files, tarFiles)
+
+	zr, err := zip.OpenReader(filepath.Join(target, "restore.zip"))
+	rtest.OK(t, err)
+	defer zr.Close()
+
+	var zipFiles int
+	for _, zf := range zr.File {
+		if !zf.Mode().IsRegular() {
+			continue
+		}
+
+		zipFiles++
+		rd, err := zf.Open()
+		rtest.OK(t, err)
+		checkArchiveFile(t, base, zf.Name, rd)
+		rtest.OK(t, rd.Close())
+	}
+	rtest.Equals(t, files, zipFiles)
+}
+
+func TestRestoreToStdout(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	datafile := filepath.Join("testdata", "backup-data.tar.gz")
+	testRunInit(t, env.gopts)
+	rtest.SetupTarTestFixture(t, env.testdata, datafile)
+	testRunBackup(t, []string{env.testdata}, BackupOptions{}, env.gopts)
+
+	var files int
+	rtest.OK(t, filepath.Walk(env.testdata, func(p string, fi os.FileInfo, err error) error {
+		if err == nil && fi.Mode().IsRegular() {
+			files++
+		}
+		return err
+	}))
+
+	base := filepath.Dir(env.testdata)
+	buf := bytes.NewBuffer(nil)
+	gopts := env.gopts
+	gopts.stdout = buf
+
+	rtest.OK(t, runRestore(RestoreOptions{Target: "-", Format: "tar"}, gopts, []string{"latest"}))
+
+	var tarFiles int
+	tr := tar.NewReader(bytes.NewReader(buf.Bytes()))
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		rtest.OK(t, err)
+
+		if hdr.Typeflag == tar.TypeReg {
+			tarFiles++
+			checkArchiveFile(t, base, hdr.Name, tr)
+		}
+	}
+	rtest.Equals(t, files, tarFiles)
+
+	buf.Reset()
+	rtest.OK(t, runRestore(RestoreOptions{Target: "-", Format: "zip"}, gopts, []string{"latest"}))
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	rtest.OK(t, err)
+
+	var zipFiles int
+	for _, zf := range zr.File {
+		if zf.Mode().IsRegular() {
+			zipFiles++
+		}
+	}
+	rtest.Equals(t, files, zipFiles)
+
+	err = runRestore(RestoreOptions{Target: "-", Format: "rar"}, gopts, []string{"latest"})
+	rtest.Assert(t, err != nil, "unknown archive format was accepted")
+}
 
 func TestRestoreFilter(t *testing.T) {
 	testfiles := []struct {
@@ -1115,6 +1802,115 @@ func TestFindJSON(t *testing.T) {
 	rtest.Assert(t, matches[0].Hits == 3, "expected hits to show 3 matches (%v)", datafile)
 }
 
+func testRunFindObjects(t testing.TB, gopts GlobalOptions, opts FindOptions, ids ...string) []objectMatch {
+	buf := bytes.NewBuffer(nil)
+	gopts.stdout = buf
+	gopts.JSON = true
+	rtest.OK(t, runFind(opts, gopts, ids))
+
+	var matches []objectMatch
+	rtest.OK(t, json.Unmarshal(buf.Bytes(), &matches))
+	return matches
+}
+
+func TestFindObjects(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+
+	dir := filepath.Join(env.testdata, "dir")
+	rtest.OK(t, os.MkdirAll(dir, 0700))
+	rtest.OK(t, appendRandomData(filepath.Join(dir, "testfile"), 1024))
+	testRunBackup(t, []string{env.testdata}, BackupOptions{}, env.gopts)
+
+	newest, _ := testRunSnapshots(t, env.gopts)
+	rtest.Assert(t, newest != nil, "no snapshot found")
+
+	// the root tree of the snapshot is found at the root
+	matches := testRunFindObjects(t, env.gopts, FindOptions{TreeID: true}, newest.Tree.String()[:10])
+	rtest.Equals(t, 1, len(matches))
+	rtest.Equals(t, "tree", matches[0].ObjectType)
+	rtest.Equals(t, string(filepath.Separator), matches[0].Path)
+	rtest.Equals(t, newest.ID.String(), matches[0].Snapshot)
+
+	// the packs contain all trees and the data of the file
+	var blobs []objectMatch
+	for _, pack := range testRunList(t, "packs", env.gopts) {
+		for _, m := range testRunFindObjects(t, env.gopts, FindOptions{PackID: true}, pack.String()) {
+			rtest.Equals(t, pack.String(), m.PackID)
+			if m.ObjectType == "blob" {
+				blobs = append(blobs, m)
+			}
+		}
+	}
+	rtest.Equals(t, 1, len(blobs))
+	rtest.Equals(t, filepath.Join(string(filepath.Separator), "testdata", "dir", "testfile"), blobs[0].Path)
+
+	matches = testRunFindObjects(t, env.gopts, FindOptions{BlobID: true}, blobs[0].ID)
+	rtest.Equals(t, blobs, matches)
+
+	// a tree ID is not found as a blob
+	matches = testRunFindObjects(t, env.gopts, FindOptions{BlobID: true}, newest.Tree.String())
+	rtest.Equals(t, 0, len(matches))
+
+	err := runFind(FindOptions{BlobID: true, TreeID: true}, env.gopts, []string{"abcd"})
+	rtest.Assert(t, err != nil, "--blob and --tree were accepted at the same time")
+}
+
+func TestFindHistory(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+
+	dir := filepath.Join(env.testdata, "dir")
+	rtest.OK(t, os.MkdirAll(dir, 0700))
+	file := filepath.Join(dir, "testfile")
+	other := filepath.Join(dir, "other")
+
+	backup := func(mtime time.Time) {
+		rtest.OK(t, os.Chtimes(file, mtime, mtime))
+		testRunBackup(t, []string{env.testdata}, BackupOptions{}, env.gopts)
+	}
+
+	rtest.OK(t, ioutil.WriteFile(file, []byte("foo"), 0600))
+	rtest.OK(t, ioutil.WriteFile(other, []byte("other"), 0600))
+	backup(time.Now().Add(-3 * time.Hour))
+
+	rtest.OK(t, ioutil.WriteFile(file, []byte("bar"), 0600))
+	backup(time.Now().Add(-2 * time.Hour))
+
+	// metadata changes are not reported
+	backup(time.Now().Add(-1 * time.Hour))
+
+	rtest.OK(t, os.Remove(file))
+	testRunBackup(t, []string{env.testdata}, BackupOptions{}, env.gopts)
+
+	buf := bytes.NewBuffer(nil)
+	env.gopts.stdout = buf
+	env.gopts.JSON = true
+	rtest.OK(t, runFind(FindOptions{History: true}, env.gopts, []string{"testfile"}))
+	env.gopts.stdout = os.Stdout
+	env.gopts.JSON = false
+
+	var list []pathHistory
+	rtest.OK(t, json.Unmarshal(buf.Bytes(), &list))
+	rtest.Equals(t, 1, len(list))
+
+	h := list[0]
+	rtest.Equals(t, filepath.Join(string(filepath.Separator), "testdata", "dir", "testfile"), h.Path)
+	rtest.Assert(t, h.Removed != nil, "file not reported as removed")
+
+	var actions []string
+	for _, ev := range h.Events {
+		actions = append(actions, ev.Action)
+	}
+	rtest.Equals(t, []string{historyAdded, historyModified, historyRemoved}, actions)
+	rtest.Equals(t, h.Events[2].Snapshot, h.Removed.Snapshot)
+	rtest.Assert(t, h.LastSeen.Time.Before(h.Removed.Time), "last seen %v is not before removal %v", h.LastSeen.Time, h.Removed.Time)
+}
+
 func TestRebuildIndex(t *testing.T) {
 	env, cleanup := withTestEnvironment(t)
 	defer cleanup()
@@ -1152,6 +1948,40 @@ func TestRebuildIndexAlwaysFull(t *testing.T) {
 	TestRebuildIndex(t)
 }
 
+func testRunRepackIndex(t testing.TB, opts RepackIndexOptions, gopts GlobalOptions) {
+	globalOptions.stdout = ioutil.Discard
+	defer func() {
+		globalOptions.stdout = os.Stdout
+	}()
+
+	rtest.OK(t, runRepackIndex(opts, gopts))
+}
+
+func TestRepackIndex(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	datafile := filepath.Join("..", "..", "internal", "checker", "testdata", "duplicate-packs-in-index-test-repo.tar.gz")
+	rtest.SetupTarTestFixture(t, env.base, datafile)
+
+	indexes := testRunList(t, "index", env.gopts)
+	rtest.Assert(t, len(indexes) > 1, "expected several index files, got %v", len(indexes))
+
+	testRunRepackIndex(t, RepackIndexOptions{MaxBlobs: defaultRepackIndexMaxBlobs}, env.gopts)
+
+	indexes = testRunList(t, "index", env.gopts)
+	rtest.Equals(t, 1, len(indexes))
+
+	out, err := testRunCheckOutput(env.gopts)
+	if len(out) != 0 {
+		t.Fatalf("expected no output from the checker, got: %v", out)
+	}
+
+	if err != nil {
+		t.Fatalf("expected no error from checker after repack-index, got: %v", err)
+	}
+}
+
 func TestCheckRestoreNoLock(t *testing.T) {
 	env, cleanup := withTestEnvironment(t)
 	defer cleanup()
@@ -1210,8 +2040,443 @@ func TestPrune(t *testing.T) {
 		"expected 3 snapshot, got %v", snapshotIDs)
 
 	testRunForget(t, env.gopts, firstSnapshot[0].String())
+
+	packs := testRunList(t, "packs", env.gopts)
+	rtest.OK(t, runPrune(PruneOptions{DryRun: true}, env.gopts))
+	rtest.Equals(t, packs, testRunList(t, "packs", env.gopts))
+
 	testRunPrune(t, env.gopts)
 	testRunCheck(t, env.gopts)
+
+	// remove all unused data
+	rtest.OK(t, runPrune(PruneOptions{MaxUnused: "0"}, env.gopts))
+	testRunCheck(t, env.gopts)
+	res := testRunStats(t, StatsOptions{Prune: true}, env.gopts)
+	rtest.Equals(t, uint64(0), res.Prune.UnusedBytes)
+
+	err = runPrune(PruneOptions{MaxUnused: "foo"}, env.gopts)
+	rtest.Assert(t, err != nil, "invalid --max-unused was accepted")
+}
+
+func TestForgetPrune(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+
+	datafile := filepath.Join("testdata", "backup-data.tar.gz")
+	rtest.SetupTarTestFixture(t, env.testdata, datafile)
+
+	opts := BackupOptions{}
+	testRunBackup(t, []string{filepath.Join(env.testdata, "0", "0")}, opts, env.gopts)
+	testRunBackup(t, []string{filepath.Join(env.testdata, "0", "0", "2")}, opts, env.gopts)
+
+	err := runForget(ForgetOptions{Last: 1, GroupBy: "host", Prune: true, PruneOptions: PruneOptions{MaxUnused: "foo"}}, env.gopts, nil)
+	rtest.Assert(t, err != nil, "invalid --max-unused was accepted")
+	rtest.Equals(t, 2, len(testRunList(t, "snapshots", env.gopts)))
+
+	rtest.OK(t, runForget(ForgetOptions{Last: 1, GroupBy: "host", Prune: true, PruneOptions: PruneOptions{MaxUnused: "0"}}, env.gopts, nil))
+	snapshotIDs := testRunList(t, "snapshots", env.gopts)
+	rtest.Equals(t, 1, len(snapshotIDs))
+	testRunCheck(t, env.gopts)
+
+	res := testRunStats(t, StatsOptions{Prune: true}, env.gopts)
+	rtest.Equals(t, uint64(0), res.Prune.UnusedBytes)
+
+	testRunRestore(t, env.gopts, filepath.Join(env.base, "restore"), snapshotIDs[0])
+}
+
+func testRunStats(t testing.TB, opts StatsOptions, gopts GlobalOptions, args ...string) statsResult {
+	buf := bytes.NewBuffer(nil)
+	gopts.stdout = buf
+	gopts.JSON = true
+
+	rtest.OK(t, runStats(opts, gopts, args))
+
+	var res statsResult
+	rtest.OK(t, json.Unmarshal(buf.Bytes(), &res))
+	return res
+}
+
+func TestStats(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+
+	datafile := filepath.Join("testdata", "backup-data.tar.gz")
+	rtest.SetupTarTestFixture(t, env.testdata, datafile)
+
+	opts := BackupOptions{}
+	testRunBackup(t, []string{filepath.Join(env.testdata, "0", "0")}, opts, env.gopts)
+	firstSnapshot := testRunList(t, "snapshots", env.gopts)
+	testRunBackup(t, []string{filepath.Join(env.testdata, "0", "0", "2")}, opts, env.gopts)
+
+	res := testRunStats(t, StatsOptions{Pricing: "b2", Prune: true}, env.gopts)
+	rtest.Equals(t, 2, res.Snapshots)
+	rtest.Assert(t, res.StoredSize > 0, "stored size is zero")
+	rtest.Equals(t, 1, res.Restore.Snapshots)
+	rtest.Assert(t, res.Restore.Files > 0 && res.Restore.BlobBytes > 0,
+		"no data to restore found: %+v", res.Restore)
+	rtest.Equals(t, uint64(0), res.Prune.UnusedBytes)
+	rtest.Assert(t, res.Cost != nil && res.Cost.StorageMonthly > 0, "no storage cost estimated: %+v", res.Cost)
+
+	// the data of the first snapshot is larger than the second one
+	first := testRunStats(t, StatsOptions{}, env.gopts, firstSnapshot[0].String())
+	rtest.Assert(t, first.Restore.RestoreSize > res.Restore.RestoreSize,
+		"expected the first snapshot to be larger, %v <= %v", first.Restore.RestoreSize, res.Restore.RestoreSize)
+	rtest.Assert(t, first.Cost == nil, "costs estimated without prices")
+
+	counts := make(map[string]*countStats)
+	for _, mode := range countModes {
+		stats := testRunStats(t, StatsOptions{Mode: mode, All: true}, env.gopts)
+		rtest.Assert(t, stats.Counts != nil, "no counts for mode %v", mode)
+		rtest.Equals(t, mode, stats.Counts.Mode)
+		rtest.Equals(t, 2, stats.Counts.Snapshots)
+		rtest.Assert(t, stats.Counts.TotalSize > 0, "total size for mode %v is zero", mode)
+		counts[mode] = stats.Counts
+	}
+
+	// the second snapshot is contained in the first one
+	rtest.Equals(t, first.Restore.Files+res.Restore.Files, counts[countModeRestoreSize].TotalFileCount)
+	rtest.Equals(t, first.Restore.RestoreSize+res.Restore.RestoreSize, counts[countModeRestoreSize].TotalSize)
+	rtest.Assert(t, counts[countModeFilesByContents].TotalFileCount <= first.Restore.Files,
+		"more distinct files than files in the first snapshot: %+v", counts[countModeFilesByContents])
+	rtest.Equals(t, counts[countModeFilesByContents].TotalFileCount, counts[countModeBlobsPerFile].TotalFileCount)
+	rtest.Assert(t, counts[countModeRawData].TotalBlobCount > first.Restore.UniqueBlobs,
+		"raw data does not include the trees: %+v", counts[countModeRawData])
+
+	// the backups stored their summaries in the snapshots
+	history := testRunStats(t, StatsOptions{All: true, History: true}, env.gopts).History
+	rtest.Equals(t, 2, len(history))
+	rtest.Equals(t, firstSnapshot[0], history[0].SnapshotID)
+	rtest.Equals(t, first.Restore.Files, history[0].Summary.FilesNew)
+	rtest.Assert(t, history[0].Summary.DataAdded > 0, "no data added in the first backup: %+v", history[0].Summary)
+
+	err := runStats(StatsOptions{Mode: "foo"}, env.gopts, nil)
+	rtest.Assert(t, err != nil, "invalid mode was accepted")
+
+	testRunForget(t, env.gopts, firstSnapshot[0].String())
+	res = testRunStats(t, StatsOptions{Prune: true, Prices: pricing{DownloadPerGB: 0.01}}, env.gopts)
+	rtest.Assert(t, res.Prune.UnusedBytes > 0, "no unused data found after forget")
+	rtest.Equals(t, "custom", res.Pricing.Name)
+}
+
+// readJSONMessages decodes the line-delimited JSON messages in buf, indexed
+// by their message type.
+func readJSONMessages(t testing.TB, buf *bytes.Buffer) map[string][]map[string]interface{} {
+	msgs := make(map[string][]map[string]interface{})
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var msg map[string]interface{}
+		rtest.OK(t, json.Unmarshal([]byte(line), &msg))
+
+		typ, ok := msg["message_type"].(string)
+		rtest.Assert(t, ok, "message without type: %v", line)
+		msgs[typ] = append(msgs[typ], msg)
+	}
+	buf.Reset()
+	return msgs
+}
+
+func TestJSONOutput(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+	rtest.OK(t, appendRandomData(filepath.Join(env.testdata, "file"), 1024))
+
+	buf := bytes.NewBuffer(nil)
+	gopts := env.gopts
+	gopts.JSON = true
+	gopts.stdout = buf
+
+	rtest.OK(t, runBackup(BackupOptions{}, gopts, []string{env.testdata}))
+	msgs := readJSONMessages(t, buf)
+	rtest.Equals(t, 1, len(msgs[msgSummary]))
+	summary := msgs[msgSummary][0]
+	rtest.Equals(t, float64(1), summary["total_files_processed"])
+	rtest.Assert(t, summary["data_added"].(float64) > 0, "no data added: %v", summary)
+
+	snapshotIDs := testRunList(t, "snapshots", env.gopts)
+	rtest.Assert(t, len(snapshotIDs) == 1, "expected one snapshot, got %v", snapshotIDs)
+	rtest.Equals(t, snapshotIDs[0].String(), summary["snapshot_id"])
+
+	rtest.OK(t, runLs(LsOptions{}, gopts, []string{snapshotIDs[0].String()}))
+	msgs = readJSONMessages(t, buf)
+	rtest.Equals(t, 1, len(msgs[msgSnapshot]))
+	rtest.Equals(t, snapshotIDs[0].String(), msgs[msgSnapshot][0]["id"])
+	var found bool
+	for _, node := range msgs[msgNode] {
+		if node["name"] == "file" {
+			found = true
+			rtest.Equals(t, float64(1024), node["size"])
+		}
+	}
+	rtest.Assert(t, found, "file not found in ls output: %v", msgs[msgNode])
+
+	rtest.OK(t, runCheck(CheckOptions{ReadData: true}, gopts, nil))
+	msgs = readJSONMessages(t, buf)
+	rtest.Equals(t, float64(0), msgs[msgSummary][0]["num_errors"])
+
+	for _, subset := range []string{"1/2", "2/2", "50%"} {
+		rtest.OK(t, runCheck(CheckOptions{ReadDataSubset: subset}, gopts, nil))
+		msgs = readJSONMessages(t, buf)
+		rtest.Equals(t, float64(0), msgs[msgSummary][0]["num_errors"])
+	}
+	err := runCheck(CheckOptions{ReadData: true, ReadDataSubset: "1/2"}, gopts, nil)
+	rtest.Assert(t, err != nil, "--read-data and --read-data-subset were accepted together")
+
+	rtest.OK(t, runForget(ForgetOptions{Last: 1}, gopts, nil))
+	msgs = readJSONMessages(t, buf)
+	rtest.Equals(t, 1, len(msgs[msgGroup]))
+	rtest.Equals(t, float64(0), msgs[msgSummary][0]["removed_snapshots"])
+
+	rtest.OK(t, runPrune(PruneOptions{}, gopts))
+	msgs = readJSONMessages(t, buf)
+	rtest.Equals(t, float64(1), msgs[msgSummary][0]["snapshots"])
+}
+
+func testRunCopy(t testing.TB, srcGopts, dstGopts GlobalOptions, args ...string) {
+	passwordFile := filepath.Join(filepath.Dir(dstGopts.Repo), "password2")
+	rtest.OK(t, ioutil.WriteFile(passwordFile, []byte(dstGopts.password), 0600))
+
+	opts := CopyOptions{
+		Repo2:         dstGopts.Repo,
+		PasswordFile2: passwordFile,
+	}
+	rtest.OK(t, runCopy(opts, srcGopts, args))
+}
+
+func TestCopy(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+
+	dstGopts := env.gopts
+	dstGopts.Repo = filepath.Join(env.base, "repo2")
+	testRunInit(t, dstGopts)
+
+	datafile := filepath.Join("testdata", "backup-data.tar.gz")
+	rtest.SetupTarTestFixture(t, env.testdata, datafile)
+
+	testRunBackup(t, []string{filepath.Join(env.testdata, "0", "0")}, BackupOptions{}, env.gopts)
+	testRunBackup(t, []string{env.testdata}, BackupOptions{}, env.gopts)
+	snapshotIDs := testRunList(t, "snapshots", env.gopts)
+
+	testRunCopy(t, env.gopts, dstGopts)
+	testRunCheck(t, dstGopts)
+
+	copiedIDs := testRunList(t, "snapshots", dstGopts)
+	rtest.Assert(t, len(copiedIDs) == len(snapshotIDs),
+		"expected %d snapshots in the destination, got %v", len(snapshotIDs), copiedIDs)
+
+	restoredir := filepath.Join(env.base, "restore")
+	testRunRestoreLatest(t, dstGopts, restoredir, []string{env.testdata}, "")
+	rtest.Assert(t, directoriesEqualContents(env.testdata, filepath.Join(restoredir, "testdata")),
+		"directories are not equal")
+
+	// snapshots which have been copied before are skipped
+	testRunCopy(t, env.gopts, dstGopts)
+	copiedIDs = testRunList(t, "snapshots", dstGopts)
+	rtest.Assert(t, len(copiedIDs) == len(snapshotIDs),
+		"snapshots have been copied again, got %v", copiedIDs)
+	testRunCheck(t, dstGopts)
+}
+
+func testRunSnapshotsExpirePreview(t testing.TB, opts ExpirePreviewOptions, gopts GlobalOptions) []expirePreviewGroup {
+	buf := bytes.NewBuffer(nil)
+	gopts.stdout = buf
+	gopts.JSON = true
+
+	rtest.OK(t, runSnapshotsExpirePreview(opts, gopts, nil))
+
+	var groups []expirePreviewGroup
+	rtest.OK(t, json.Unmarshal(buf.Bytes(), &groups))
+	return groups
+}
+
+func TestSnapshotsExpirePreview(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+
+	datafile := filepath.Join("testdata", "backup-data.tar.gz")
+	rtest.SetupTarTestFixture(t, env.testdata, datafile)
+
+	for i := 0; i < 3; i++ {
+		testRunBackup(t, []string{env.testdata}, BackupOptions{}, env.gopts)
+	}
+	snapshotIDs := testRunList(t, "snapshots", env.gopts)
+
+	opts := ExpirePreviewOptions{
+		Last:     1,
+		GroupBy:  "host,paths",
+		Interval: time.Hour,
+		Horizon:  24 * time.Hour,
+	}
+	start := time.Now()
+	groups := testRunSnapshotsExpirePreview(t, opts, env.gopts)
+	rtest.Equals(t, 1, len(groups))
+	rtest.Equals(t, 3, len(groups[0].Snapshots))
+
+	// the snapshots are sorted by time, the two older snapshots are removed
+	// right away, the latest one after the next backup
+	older, latest := groups[0].Snapshots[:2], groups[0].Snapshots[2]
+	rtest.Assert(t, latest.Expires != nil && latest.Expires.After(start.Add(time.Hour-time.Minute)),
+		"wrong expire time for the latest snapshot: %v", latest.Expires)
+	for _, p := range older {
+		rtest.Assert(t, p.Expires != nil && p.Expires.Before(start.Add(time.Minute)),
+			"snapshot %v is not removed right away: %v", p.ShortID, p.Expires)
+	}
+
+	// nothing has been removed
+	rtest.Equals(t, len(snapshotIDs), len(testRunList(t, "snapshots", env.gopts)))
+}
+
+func testRunExportDiff(t testing.TB, gopts GlobalOptions, filename string, snapshotID1, snapshotID2 restic.ID) map[string]string {
+	opts := ExportDiffOptions{
+		Output:      filename,
+		DeletedList: ".restic-deleted",
+	}
+	rtest.OK(t, runExportDiff(opts, gopts, []string{snapshotID1.String(), snapshotID2.String()}))
+
+	f, err := os.Open(filename)
+	rtest.OK(t, err)
+	defer f.Close()
+
+	// map the names below "testdata/" to the content of the entries
+	entries := make(map[string]string)
+	rd := tar.NewReader(f)
+	for {
+		hdr, err := rd.Next()
+		if err == io.EOF {
+			break
+		}
+		rtest.OK(t, err)
+
+		buf, err := ioutil.ReadAll(rd)
+		rtest.OK(t, err)
+
+		name := hdr.Name
+		if i := strings.Index(name, "testdata/"); i >= 0 {
+			name = name[i+len("testdata/"):]
+		}
+		entries[name] = string(buf)
+	}
+
+	return entries
+}
+
+func TestExportDiff(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+
+	for _, dir := range []string{"a", "b"} {
+		rtest.OK(t, os.MkdirAll(filepath.Join(env.testdata, dir), 0755))
+	}
+	rtest.OK(t, ioutil.WriteFile(filepath.Join(env.testdata, "a", "changed"), []byte("before"), 0644))
+	rtest.OK(t, ioutil.WriteFile(filepath.Join(env.testdata, "a", "removed"), []byte("foo"), 0644))
+	rtest.OK(t, ioutil.WriteFile(filepath.Join(env.testdata, "a", "unchanged"), []byte("bar"), 0644))
+	rtest.OK(t, ioutil.WriteFile(filepath.Join(env.testdata, "b", "file"), []byte("baz"), 0644))
+
+	testRunBackup(t, []string{env.testdata}, BackupOptions{}, env.gopts)
+	snapshotIDs := testRunList(t, "snapshots", env.gopts)
+	rtest.Assert(t, len(snapshotIDs) == 1, "expected one snapshot, got %v", snapshotIDs)
+	first := snapshotIDs[0]
+
+	rtest.OK(t, ioutil.WriteFile(filepath.Join(env.testdata, "a", "changed"), []byte("after"), 0644))
+	rtest.OK(t, os.Remove(filepath.Join(env.testdata, "a", "removed")))
+	rtest.OK(t, os.RemoveAll(filepath.Join(env.testdata, "b")))
+	rtest.OK(t, os.MkdirAll(filepath.Join(env.testdata, "c"), 0755))
+	rtest.OK(t, ioutil.WriteFile(filepath.Join(env.testdata, "c", "added"), []byte("new"), 0644))
+
+	testRunBackup(t, []string{env.testdata}, BackupOptions{}, env.gopts)
+	snapshotIDs = testRunList(t, "snapshots", env.gopts)
+	rtest.Assert(t, len(snapshotIDs) == 2, "expected two snapshots, got %v", snapshotIDs)
+	second := snapshotIDs[0]
+	if second.Equal(first) {
+		second = snapshotIDs[1]
+	}
+
+	entries := testRunExportDiff(t, env.gopts, filepath.Join(env.base, "export.tar"), first, second)
+
+	deleted, ok := entries[".restic-deleted"]
+	rtest.Assert(t, ok, "list of deleted items not found in archive")
+	delete(entries, ".restic-deleted")
+
+	var deletedNames []string
+	for _, line := range strings.Split(strings.TrimSpace(deleted), "\n") {
+		deletedNames = append(deletedNames, line[strings.Index(line, "testdata/")+len("testdata/"):])
+	}
+	rtest.Equals(t, []string{"a/removed", "b"}, deletedNames)
+
+	want := map[string]string{
+		"a/changed": "after",
+		"c/":        "",
+		"c/added":   "new",
+	}
+	rtest.Equals(t, want, entries)
+}
+
+func TestDiffJSON(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+	rtest.OK(t, os.MkdirAll(filepath.Join(env.testdata, "dir"), 0755))
+	rtest.OK(t, ioutil.WriteFile(filepath.Join(env.testdata, "changed"), []byte("before"), 0644))
+	rtest.OK(t, ioutil.WriteFile(filepath.Join(env.testdata, "dir", "removed"), []byte("foo"), 0644))
+
+	testRunBackup(t, []string{env.testdata}, BackupOptions{}, env.gopts)
+	snapshotIDs := testRunList(t, "snapshots", env.gopts)
+	rtest.Assert(t, len(snapshotIDs) == 1, "expected one snapshot, got %v", snapshotIDs)
+	first := snapshotIDs[0]
+
+	rtest.OK(t, ioutil.WriteFile(filepath.Join(env.testdata, "changed"), []byte("after, longer"), 0644))
+	rtest.OK(t, os.Remove(filepath.Join(env.testdata, "dir", "removed")))
+	rtest.OK(t, ioutil.WriteFile(filepath.Join(env.testdata, "dir", "added"), []byte("new"), 0644))
+
+	testRunBackup(t, []string{env.testdata}, BackupOptions{}, env.gopts)
+	snapshotIDs = testRunList(t, "snapshots", env.gopts)
+	rtest.Assert(t, len(snapshotIDs) == 2, "expected two snapshots, got %v", snapshotIDs)
+	second := snapshotIDs[0]
+	if second.Equal(first) {
+		second = snapshotIDs[1]
+	}
+
+	buf := bytes.NewBuffer(nil)
+	gopts := env.gopts
+	gopts.JSON = true
+	gopts.stdout = buf
+	rtest.OK(t, runDiff(DiffOptions{}, gopts, []string{first.String(), second.String()}))
+
+	var res diffResult
+	rtest.OK(t, json.Unmarshal(buf.Bytes(), &res))
+	rtest.Equals(t, first.String(), res.SourceSnapshot)
+	rtest.Equals(t, second.String(), res.TargetSnapshot)
+
+	changes := make(map[string]diffChange)
+	for _, c := range res.Changes {
+		changes[c.Path[strings.Index(c.Path, "testdata/")+len("testdata/"):]] = c
+	}
+
+	c := changes["changed"]
+	rtest.Equals(t, "M", c.Modifier)
+	rtest.Equals(t, uint64(13), c.Size)
+	rtest.Assert(t, c.OldSize != nil && *c.OldSize == 6, "wrong old size %v", c.OldSize)
+	rtest.Equals(t, int64(7), c.SizeDelta)
+
+	rtest.Equals(t, "-", changes["dir/removed"].Modifier)
+	rtest.Equals(t, int64(-3), changes["dir/removed"].SizeDelta)
+	rtest.Equals(t, "+", changes["dir/added"].Modifier)
+
+	rtest.Equals(t, 1, res.Stats.ChangedFiles)
+	rtest.Equals(t, 1, res.Stats.Added.Files)
+	rtest.Equals(t, 1, res.Stats.Removed.Files)
 }
 
 func TestHardLink(t *testing.T) {
@@ -1311,3 +2576,165 @@ func linkEqual(source, dest []string) bool {
 
 	return true
 }
+
+func testRunDump(t testing.TB, gopts GlobalOptions, opts DumpOptions, snapshotID, path string) []byte {
+	buf := bytes.NewBuffer(nil)
+	gopts.stdout = buf
+	rtest.OK(t, runDump(opts, gopts, []string{snapshotID, path}))
+	return buf.Bytes()
+}
+
+func TestDump(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+
+	files := map[string]string{
+		"testdata/file":        "content of file",
+		"testdata/dir/a":       "content of a",
+		"testdata/dir/sub/b":   "content of b",
+		"testdata/other/c.txt": "content of c",
+	}
+	for name, content := range files {
+		fp := filepath.Join(env.base, filepath.FromSlash(name))
+		rtest.OK(t, os.MkdirAll(filepath.Dir(fp), 0755))
+		rtest.OK(t, ioutil.WriteFile(fp, []byte(content), 0644))
+	}
+
+	testRunBackup(t, []string{filepath.Join(env.base, "testdata")}, BackupOptions{}, env.gopts)
+	snapshotIDs := testRunList(t, "snapshots", env.gopts)
+	rtest.Assert(t, len(snapshotIDs) == 1, "expected one snapshot, got %v", snapshotIDs)
+
+	opts := DumpOptions{Archive: "tar"}
+	data := testRunDump(t, env.gopts, opts, "latest", "/testdata/file")
+	rtest.Equals(t, "content of file", string(data))
+
+	data = testRunDump(t, env.gopts, opts, "latest", "/testdata/dir")
+	contents := make(map[string]string)
+	tr := tar.NewReader(bytes.NewReader(data))
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		rtest.OK(t, err)
+
+		buf, err := ioutil.ReadAll(tr)
+		rtest.OK(t, err)
+		contents[hdr.Name] = string(buf)
+	}
+	rtest.Equals(t, map[string]string{
+		"dir/":      "",
+		"dir/a":     "content of a",
+		"dir/sub/":  "",
+		"dir/sub/b": "content of b",
+	}, contents)
+
+	opts.Archive = "zip"
+	data = testRunDump(t, env.gopts, opts, "latest", "/")
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	rtest.OK(t, err)
+
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	rtest.Assert(t, includes(names, "testdata/other/c.txt"), "file missing in zip archive: %v", names)
+}
+
+func TestRepairSnapshots(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+
+	rtest.OK(t, appendRandomData(filepath.Join(env.testdata, "a"), 256*1024))
+	testRunBackup(t, []string{env.testdata}, BackupOptions{}, env.gopts)
+	packs := restic.NewIDSet(testRunList(t, "packs", env.gopts)...)
+
+	// the data of the second file is stored in a new pack
+	rtest.OK(t, appendRandomData(filepath.Join(env.testdata, "b"), 256*1024))
+	testRunBackup(t, []string{env.testdata}, BackupOptions{}, env.gopts)
+
+	repo, err := OpenRepository(env.gopts)
+	rtest.OK(t, err)
+	rtest.OK(t, repo.LoadIndex(env.gopts.ctx))
+
+	var damaged restic.ID
+	for pb := range repo.Index().Each(env.gopts.ctx) {
+		if pb.Type == restic.DataBlob && !packs.Has(pb.PackID) {
+			damaged = pb.PackID
+		}
+	}
+	rtest.Assert(t, !damaged.IsNull(), "no new data pack found")
+	rtest.OK(t, os.Remove(filepath.Join(env.repo, "data", damaged.String()[:2], damaged.String())))
+	testRunRebuildIndex(t, env.gopts)
+
+	rtest.OK(t, runRepairSnapshots(RepairSnapshotsOptions{DryRun: true}, env.gopts, nil))
+	rtest.Equals(t, 2, len(testRunList(t, "snapshots", env.gopts)))
+
+	rtest.OK(t, runRepairSnapshots(RepairSnapshotsOptions{Forget: true}, env.gopts, nil))
+	snapshotIDs := testRunList(t, "snapshots", env.gopts)
+	rtest.Equals(t, 2, len(snapshotIDs))
+	rtest.OK(t, runCheck(CheckOptions{ReadData: true}, env.gopts, nil))
+
+	newest, _ := testRunSnapshots(t, env.gopts)
+	rtest.Equals(t, restic.TagList{"repaired"}, restic.TagList(newest.Tags))
+
+	// the undamaged file is restored completely, the damaged one is empty
+	target := filepath.Join(env.base, "restore")
+	testRunRestore(t, env.gopts, target, *newest.ID)
+	restored := filepath.Join(target, filepath.Base(env.testdata))
+	want, err := ioutil.ReadFile(filepath.Join(env.testdata, "a"))
+	rtest.OK(t, err)
+	got, err := ioutil.ReadFile(filepath.Join(restored, "a"))
+	rtest.OK(t, err)
+	rtest.Assert(t, bytes.Equal(want, got), "undamaged file was not restored correctly")
+	fi, err := os.Stat(filepath.Join(restored, "b"))
+	rtest.OK(t, err)
+	rtest.Equals(t, int64(0), fi.Size())
+
+	// a second run finds nothing to repair
+	rtest.OK(t, runRepairSnapshots(RepairSnapshotsOptions{}, env.gopts, nil))
+	rtest.Equals(t, 2, len(testRunList(t, "snapshots", env.gopts)))
+}
+
+func TestAppendOnly(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	repository.TestUseLowSecurityKDFParameters(t)
+	restic.TestSetLockTimeout(t, 0)
+	rtest.OK(t, runInit(InitOptions{AppendOnly: true}, env.gopts, nil))
+
+	datafile := filepath.Join("testdata", "backup-data.tar.gz")
+	rtest.SetupTarTestFixture(t, env.testdata, datafile)
+
+	opts := BackupOptions{}
+	testRunBackup(t, []string{filepath.Join(env.testdata, "0", "0")}, opts, env.gopts)
+	testRunBackup(t, []string{filepath.Join(env.testdata, "0", "0", "2")}, opts, env.gopts)
+	testRunCheck(t, env.gopts)
+
+	forget := ForgetOptions{Last: 1, GroupBy: "host", Prune: true}
+	rtest.Assert(t, runForget(forget, env.gopts, nil) != nil, "forget was allowed in an append-only repository")
+	rtest.Assert(t, runPrune(PruneOptions{}, env.gopts) != nil, "prune was allowed in an append-only repository")
+	rtest.Assert(t, runUnlock(UnlockOptions{}, env.gopts) != nil, "unlock was allowed in an append-only repository")
+	rtest.Equals(t, 2, len(testRunList(t, "snapshots", env.gopts)))
+
+	// removing files directly through the backend is refused as well
+	repo, err := OpenRepository(env.gopts)
+	rtest.OK(t, err)
+	id := testRunList(t, "snapshots", env.gopts)[0]
+	err = repo.Backend().Remove(env.gopts.ctx, restic.Handle{Type: restic.SnapshotFile, Name: id.String()})
+	rtest.Assert(t, backend.IsAppendOnly(err), "expected append-only error, got %v", err)
+
+	forget.DryRun = true
+	rtest.OK(t, runForget(forget, env.gopts, nil))
+
+	env.gopts.AllowDelete = true
+	forget.DryRun = false
+	rtest.OK(t, runForget(forget, env.gopts, nil))
+	rtest.Equals(t, 1, len(testRunList(t, "snapshots", env.gopts)))
+	testRunCheck(t, env.gopts)
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"strings"
+
+	"github.com/restic/restic/internal/backend"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+)
+
+// checkLifecycle returns an error if the storage service of be has rules
+// which delete or hide files of the repository, e.g. lifecycle rules of a
+// bucket. If the rules cannot be checked, e.g. due to missing permissions, a
+// warning is printed.
+func checkLifecycle(ctx context.Context, be restic.Backend) error {
+	lc, ok := lifecycleChecker(be)
+	if !ok {
+		return nil
+	}
+
+	problems, err := lc.CheckLifecycle(ctx)
+	if err != nil {
+		Warnf("unable to check the lifecycle rules of %v: %v\n", be.Location(), err)
+		return nil
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+
+	return errors.Fatalf("the bucket at %v has rules which delete or hide files of the repository:\n  %v\n"+
+		"the repository would be damaged silently, use --ignore-lifecycle-rules to continue anyway",
+		be.Location(), strings.Join(problems, "\n  "))
+}
+
+// lifecycleChecker returns the lifecycle checker of be. The timeout wrapper
+// added by openBackend only embeds restic.Backend, so the backend it wraps is
+// checked instead.
+func lifecycleChecker(be restic.Backend) (restic.LifecycleChecker, bool) {
+	if tb, ok := be.(*backend.TimeoutBackend); ok {
+		be = tb.Backend
+	}
+
+	lc, ok := be.(restic.LifecycleChecker)
+	return lc, ok
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/restic/restic/internal/backend/mem"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+type lifecycleBackend struct {
+	restic.Backend
+	problems []string
+	err      error
+}
+
+func (be lifecycleBackend) CheckLifecycle(ctx context.Context) ([]string, error) {
+	return be.problems, be.err
+}
+
+func TestCheckLifecycle(t *testing.T) {
+	ctx := context.TODO()
+
+	// backends without lifecycle rules are not checked
+	rtest.OK(t, checkLifecycle(ctx, mem.New()))
+	rtest.OK(t, checkLifecycle(ctx, lifecycleBackend{Backend: mem.New()}))
+
+	be := lifecycleBackend{
+		Backend:  mem.New(),
+		problems: []string{`lifecycle rule "expire" for prefix "" deletes expired files`},
+	}
+	err := checkLifecycle(ctx, be)
+	rtest.Assert(t, err != nil, "expected an error for a lifecycle rule")
+	rtest.Assert(t, strings.Contains(err.Error(), `rule "expire"`), "rule missing in error %q", err)
+
+	// when the rules cannot be read, only a warning is printed
+	buf := bytes.NewBuffer(nil)
+	globalOptions.stderr = buf
+	defer func() {
+		globalOptions.stderr = os.Stderr
+	}()
+
+	be = lifecycleBackend{Backend: mem.New(), err: errors.New("access denied")}
+	rtest.OK(t, checkLifecycle(ctx, be))
+	rtest.Assert(t, strings.Contains(buf.String(), "access denied"), "warning missing, output %q", buf.String())
+}
@@ -13,6 +13,25 @@ import (
 	"github.com/restic/restic/internal/restic"
 )
 
+// Commands lock the repository according to the following consistency model.
+//
+// Files in the repository are never modified, they are only added and
+// removed. A backup saves the data packs first, then the index files which
+// reference them and the snapshot last. Files are only removed by commands
+// which hold an exclusive lock, like forget and prune.
+//
+//   - Commands which remove files take an exclusive lock, so no other command
+//     which holds a lock runs concurrently.
+//   - Commands which add files, like backup, take a non-exclusive lock. They
+//     do not block each other.
+//   - Commands which read the data referenced by snapshots, like ls, find,
+//     restore and stats, take a non-exclusive lock by default, so that the
+//     data is not removed while they run. With --no-lock they run without a
+//     lock, they may then fail if files are removed concurrently, but they
+//     never damage the repository.
+//   - Commands which only list files or read snapshot, key or lock files,
+//     like snapshots, list, key list and status, run without a lock. A
+//     snapshot which is removed concurrently is skipped.
 var globalLocks struct {
 	locks         []*restic.Lock
 	cancelRefresh chan struct{}
@@ -28,12 +47,24 @@ func lockRepoExclusive(repo *repository.Repository) (*restic.Lock, error) {
 	return lockRepository(repo, true)
 }
 
+// lockRepoOperation creates a non-exclusive lock which records that the
+// operation op is run on paths, see restic.NewOperationLock.
+func lockRepoOperation(repo *repository.Repository, op string, paths []string) (*restic.Lock, error) {
+	return acquireLock(repo, false, func(ctx context.Context, repo restic.Repository) (*restic.Lock, error) {
+		return restic.NewOperationLock(ctx, repo, op, paths)
+	})
+}
+
 func lockRepository(repo *repository.Repository, exclusive bool) (*restic.Lock, error) {
 	lockFn := restic.NewLock
 	if exclusive {
 		lockFn = restic.NewExclusiveLock
 	}
 
+	return acquireLock(repo, exclusive, lockFn)
+}
+
+func acquireLock(repo *repository.Repository, exclusive bool, lockFn func(context.Context, restic.Repository) (*restic.Lock, error)) (*restic.Lock, error) {
 	lock, err := lockFn(context.TODO(), repo)
 	if err != nil {
 		return nil, errors.Fatalf("unable to create lock in backend: %v", err)
@@ -57,6 +88,19 @@ func lockRepository(repo *repository.Repository, exclusive bool) (*restic.Lock,
 
 var refreshInterval = 5 * time.Minute
 
+// refreshabilityTimeout is the time since the last successful refresh after
+// which the locks are given up. It leaves a margin before other processes
+// consider them stale.
+var refreshabilityTimeout = restic.StaleLockTimeout - refreshInterval*3/2
+
+// lockLost is called when the locks could not be refreshed. Since other
+// processes may remove the locks and modify the repository, it aborts the
+// running operation by cancelling the global context.
+var lockLost = func(err error) {
+	Warnf("%v, aborting the operation\n", err)
+	cancelGlobalContext()
+}
+
 func refreshLocks(wg *sync.WaitGroup, done <-chan struct{}) {
 	debug.Log("start")
 	defer func() {
@@ -67,6 +111,9 @@ func refreshLocks(wg *sync.WaitGroup, done <-chan struct{}) {
 	}()
 
 	ticker := time.NewTicker(refreshInterval)
+	defer ticker.Stop()
+
+	lastRefresh := time.Now()
 
 	for {
 		select {
@@ -76,15 +123,37 @@ func refreshLocks(wg *sync.WaitGroup, done <-chan struct{}) {
 		case <-ticker.C:
 			debug.Log("refreshing locks")
 			globalLocks.Lock()
-			for _, lock := range globalLocks.locks {
-				err := lock.Refresh(context.TODO())
-				if err != nil {
-					fmt.Fprintf(os.Stderr, "unable to refresh lock: %v\n", err)
-				}
-			}
+			err := refreshAllLocks()
 			globalLocks.Unlock()
+
+			switch {
+			case err == nil:
+				lastRefresh = time.Now()
+			case err == restic.ErrLockRemoved:
+				lockLost(errors.Fatalf("unable to refresh lock: %v", err))
+				return
+			case time.Since(lastRefresh) > refreshabilityTimeout:
+				lockLost(errors.Fatalf("unable to refresh lock for %v: %v", time.Since(lastRefresh)/time.Second*time.Second, err))
+				return
+			default:
+				fmt.Fprintf(os.Stderr, "unable to refresh lock: %v\n", err)
+			}
+		}
+	}
+}
+
+// refreshAllLocks refreshes all locks held by this process and returns the
+// first error. globalLocks must be locked by the caller.
+func refreshAllLocks() error {
+	var firstErr error
+	for _, lock := range globalLocks.locks {
+		err := lock.Refresh(context.TODO())
+		if err != nil && firstErr == nil {
+			firstErr = err
 		}
 	}
+
+	return firstErr
 }
 
 func unlockRepo(lock *restic.Lock) error {
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+// stopLockRefresh stops the goroutine which refreshes the locks, so that it
+// is started again with the current settings.
+func stopLockRefresh() {
+	globalLocks.Lock()
+	if globalLocks.cancelRefresh != nil {
+		close(globalLocks.cancelRefresh)
+	}
+	globalLocks.Unlock()
+
+	globalLocks.refreshWG.Wait()
+}
+
+func TestLockLost(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+
+	repo, err := OpenRepository(env.gopts)
+	rtest.OK(t, err)
+
+	oldInterval, oldLockLost := refreshInterval, lockLost
+	defer func() {
+		stopLockRefresh()
+		refreshInterval, lockLost = oldInterval, oldLockLost
+	}()
+
+	lost := make(chan error, 1)
+	stopLockRefresh()
+	refreshInterval = 20 * time.Millisecond
+	lockLost = func(err error) {
+		lost <- err
+	}
+
+	lock, err := lockRepo(repo)
+	rtest.OK(t, err)
+	defer unlockRepo(lock)
+
+	// the lock is refreshed while it exists
+	time.Sleep(5 * refreshInterval)
+	select {
+	case err := <-lost:
+		t.Fatalf("lock was lost unexpectedly: %v", err)
+	default:
+	}
+
+	// another process removes the lock
+	rtest.OK(t, restic.RemoveAllLocks(env.gopts.ctx, repo))
+
+	select {
+	case err := <-lost:
+		rtest.Assert(t, err != nil, "lockLost was called without an error")
+	case <-time.After(10 * time.Second):
+		t.Fatal("removing the lock was not detected")
+	}
+}
+
+func TestReadWithoutLock(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+
+	datafile := filepath.Join("testdata", "backup-data.tar.gz")
+	rtest.SetupTarTestFixture(t, env.testdata, datafile)
+	testRunBackup(t, []string{filepath.Join(env.testdata, "0", "0")}, BackupOptions{}, env.gopts)
+	snapshotIDs := testRunList(t, "snapshots", env.gopts)
+	rtest.Equals(t, 1, len(snapshotIDs))
+
+	repo, err := OpenRepository(env.gopts)
+	rtest.OK(t, err)
+
+	// another process holds an exclusive lock, e.g. prune
+	lock, err := restic.NewExclusiveLock(env.gopts.ctx, repo)
+	rtest.OK(t, err)
+	defer lock.Unlock()
+
+	// commands which only read snapshots and keys do not need a lock
+	rtest.Equals(t, snapshotIDs, testRunList(t, "snapshots", env.gopts))
+	newest, _ := testRunSnapshots(t, env.gopts)
+	rtest.Assert(t, newest != nil, "no snapshot found")
+	rtest.Equals(t, 1, len(testRunKeyListOtherIDs(t, env.gopts))+1)
+
+	// commands which read the data referenced by snapshots need a lock,
+	// unless --no-lock is given
+	err = runLs(LsOptions{}, env.gopts, []string{snapshotIDs[0].String()})
+	rtest.Assert(t, err != nil, "ls did not fail while the repository is locked exclusively")
+
+	env.gopts.NoLock = true
+	testRunLs(t, env.gopts, snapshotIDs[0].String())
+}
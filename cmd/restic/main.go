@@ -7,9 +7,11 @@ import (
 	"log"
 	"os"
 	"runtime"
+	"time"
 
 	"github.com/restic/restic/internal/debug"
 	"github.com/restic/restic/internal/options"
+	"github.com/restic/restic/internal/repository"
 	"github.com/restic/restic/internal/restic"
 
 	"github.com/spf13/cobra"
@@ -37,6 +39,17 @@ directories in an encrypted repository stored on different backends.
 		}
 		globalOptions.extended = opts
 
+		if err := repository.ApplyKDFOptions(opts); err != nil {
+			return err
+		}
+
+		switch globalOptions.MetricsFormat {
+		case metricsFormatPushgateway, metricsFormatOTLP:
+		default:
+			return errors.Fatalf("invalid metrics format %q, must be %q or %q",
+				globalOptions.MetricsFormat, metricsFormatPushgateway, metricsFormatOTLP)
+		}
+
 		pwd, err := resolvePassword(globalOptions, "RESTIC_PASSWORD")
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Resolving password failed: %v\n", err)
@@ -66,9 +79,19 @@ func main() {
 	debug.Log("main %#v", os.Args)
 	debug.Log("restic %s, compiled with %v on %v/%v",
 		version, runtime.Version(), runtime.GOOS, runtime.GOARCH)
-	err := cmdRoot.Execute()
+	start := time.Now()
+	cmd, err := cmdRoot.ExecuteC()
+
+	if cmd != nil && cmd != cmdRoot {
+		if perr := pushMetrics(globalOptions, commandPath(cmd.CommandPath()), time.Since(start), err); perr != nil {
+			Warnf("unable to push metrics: %v\n", perr)
+		}
+	}
 
 	switch {
+	case err != nil && globalOptions.JSON:
+		// print the error as the last JSON message, without a stack trace
+		_ = jsonWarnf(os.Stderr, "%v", err)
 	case restic.IsAlreadyLocked(errors.Cause(err)):
 		fmt.Fprintf(os.Stderr, "%v\nthe `unlock` command can be used to remove stale locks\n", err)
 	case errors.IsFatal(errors.Cause(err)):
@@ -86,7 +109,10 @@ func main() {
 	}
 
 	var exitCode int
-	if err != nil {
+	switch {
+	case errors.Cause(err) == errDamagedData:
+		exitCode = exitCodeDamagedData
+	case err != nil:
 		exitCode = 1
 	}
 
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/restic"
+)
+
+// recordOperation adds an entry for the operation op to the repository
+// manifest. The returned function must be called with the result of the
+// operation when it has finished. Failures to update the manifest are
+// reported, but do not abort the operation.
+func recordOperation(gopts GlobalOptions, repo restic.Repository, op string) func(error) {
+	entry, err := restic.StartOperation(gopts.ctx, repo, op, version)
+	if err != nil {
+		Warnf("unable to update repository manifest: %v\n", err)
+		return func(error) {}
+	}
+
+	return func(opErr error) {
+		debug.Log("operation %v finished, err %v", op, opErr)
+		if err := entry.Finish(gopts.ctx, opErr); err != nil {
+			Warnf("unable to update repository manifest: %v\n", err)
+		}
+	}
+}
@@ -0,0 +1,364 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/metrics"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+)
+
+// Formats for pushing the metrics of a command.
+const (
+	metricsFormatPushgateway = "pushgateway"
+	metricsFormatOTLP        = "otlp"
+)
+
+// metricsPushTimeout is the time after which pushing the metrics is aborted.
+const metricsPushTimeout = 30 * time.Second
+
+// jobMetrics collects the results of the command which is run, they are
+// pushed to the metrics endpoint when the command has finished.
+var jobMetrics = &jobResult{}
+
+// jobResult is the summary of a single command.
+type jobResult struct {
+	m          sync.Mutex
+	repos      []*repository.Repository
+	warnings   uint64
+	timeouts   uint64
+	snapshotID *restic.ID
+}
+
+// addRepository records that repo is used by the command, the data uploaded
+// to it is counted as added bytes.
+func (j *jobResult) addRepository(repo *repository.Repository) {
+	j.m.Lock()
+	defer j.m.Unlock()
+
+	j.repos = append(j.repos, repo)
+}
+
+// reset forgets the results collected so far, this is done before each run
+// of a scheduled backup. The repositories of earlier runs are released.
+func (j *jobResult) reset() {
+	j.m.Lock()
+	defer j.m.Unlock()
+
+	j.repos = nil
+	j.warnings = 0
+	j.timeouts = 0
+	j.snapshotID = nil
+}
+
+// addWarning counts a warning printed by the command.
+func (j *jobResult) addWarning() {
+	j.m.Lock()
+	defer j.m.Unlock()
+
+	j.warnings++
+}
+
+// addTimeout counts a backend request which was aborted because it made no
+// progress.
+func (j *jobResult) addTimeout() {
+	j.m.Lock()
+	defer j.m.Unlock()
+
+	j.timeouts++
+}
+
+// backendTimeouts returns the number of backend requests which timed out.
+func (j *jobResult) backendTimeouts() uint64 {
+	j.m.Lock()
+	defer j.m.Unlock()
+
+	return j.timeouts
+}
+
+// setSnapshot records the snapshot saved by the command.
+func (j *jobResult) setSnapshot(id restic.ID) {
+	j.m.Lock()
+	defer j.m.Unlock()
+
+	j.snapshotID = &id
+}
+
+// snapshot returns the ID of the last snapshot saved by the command, or nil.
+func (j *jobResult) snapshot() *restic.ID {
+	j.m.Lock()
+	defer j.m.Unlock()
+
+	return j.snapshotID
+}
+
+// metricsSample is a single value of the summary.
+type metricsSample struct {
+	name  string
+	help  string
+	unit  string
+	value float64
+}
+
+// metricsSummary is the summary of a command in a form which is independent
+// of the format in which it is pushed.
+type metricsSummary struct {
+	command    string
+	hostname   string
+	finished   time.Time
+	snapshotID string
+	samples    []metricsSample
+}
+
+// summary returns the metrics for command, which ran for duration and
+// returned err.
+func (j *jobResult) summary(command string, duration time.Duration, err error) metricsSummary {
+	j.m.Lock()
+	defer j.m.Unlock()
+
+	var added uint64
+	for _, repo := range j.repos {
+		added += repo.UploadedBytes()
+	}
+
+	success := 1.0
+	if err != nil {
+		success = 0
+	}
+
+	s := metricsSummary{
+		command:  command,
+		finished: time.Now(),
+		samples: []metricsSample{
+			{"duration_seconds", "Duration of the command.", "s", duration.Seconds()},
+			{"success", "Whether the command completed successfully (1) or failed (0).", "1", success},
+			{"bytes_added", "Bytes of pack files uploaded to the repository.", "By", float64(added)},
+			{"errors", "Number of warnings and errors printed by the command.", "1", float64(j.warnings)},
+			{"backend_timeouts", "Number of backend requests aborted because they made no progress.", "1", float64(j.timeouts)},
+		},
+	}
+
+	s.hostname, _ = os.Hostname()
+
+	if j.snapshotID != nil {
+		s.snapshotID = j.snapshotID.String()
+	}
+
+	// the time of the last run allows alerting on jobs which stopped running
+	s.samples = append(s.samples, metricsSample{
+		"last_run_timestamp_seconds", "Time at which the command finished.", "s",
+		float64(s.finished.UnixNano()) / 1e9,
+	})
+
+	return s
+}
+
+// pushgatewayURL returns the URL to which the metrics are pushed, the group
+// consists of the job, the host and the command, so results of different
+// commands do not replace each other.
+func pushgatewayURL(base, job string, s metricsSummary) string {
+	u := strings.TrimSuffix(base, "/") + "/metrics/job/" + url.PathEscape(job)
+	if s.hostname != "" {
+		u += "/instance/" + url.PathEscape(s.hostname)
+	}
+	return u + "/command/" + url.PathEscape(s.command)
+}
+
+// writePushgateway writes s in the Prometheus text format.
+func writePushgateway(wr io.Writer, s metricsSummary) error {
+	var buf bytes.Buffer
+	for _, sample := range s.samples {
+		name := "restic_job_" + sample.name
+		fmt.Fprintf(&buf, "# HELP %s %s\n", name, sample.help)
+		fmt.Fprintf(&buf, "# TYPE %s gauge\n", name)
+		fmt.Fprintf(&buf, "%s %s\n", name, strconv.FormatFloat(sample.value, 'g', -1, 64))
+	}
+
+	if s.snapshotID != "" {
+		fmt.Fprintf(&buf, "# HELP restic_job_snapshot_info Snapshot saved by the command.\n")
+		fmt.Fprintf(&buf, "# TYPE restic_job_snapshot_info gauge\n")
+		fmt.Fprintf(&buf, "restic_job_snapshot_info{snapshot_id=%q} 1\n", s.snapshotID)
+	}
+
+	_, err := wr.Write(buf.Bytes())
+	return err
+}
+
+type otlpValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpDataPoint struct {
+	Attributes   []otlpAttribute `json:"attributes"`
+	TimeUnixNano string          `json:"timeUnixNano"`
+	AsDouble     float64         `json:"asDouble"`
+}
+
+type otlpMetric struct {
+	Name  string `json:"name"`
+	Unit  string `json:"unit"`
+	Gauge struct {
+		DataPoints []otlpDataPoint `json:"dataPoints"`
+	} `json:"gauge"`
+}
+
+// writeOTLP writes s as an OTLP metrics request in the JSON encoding.
+func writeOTLP(wr io.Writer, job string, s metricsSummary) error {
+	attrs := []otlpAttribute{{Key: "command", Value: otlpValue{s.command}}}
+	if s.snapshotID != "" {
+		attrs = append(attrs, otlpAttribute{Key: "snapshot_id", Value: otlpValue{s.snapshotID}})
+	}
+
+	var metrics []otlpMetric
+	for _, sample := range s.samples {
+		m := otlpMetric{Name: "restic.job." + sample.name, Unit: sample.unit}
+		m.Gauge.DataPoints = []otlpDataPoint{{
+			Attributes:   attrs,
+			TimeUnixNano: strconv.FormatInt(s.finished.UnixNano(), 10),
+			AsDouble:     sample.value,
+		}}
+		metrics = append(metrics, m)
+	}
+
+	resource := []otlpAttribute{{Key: "service.name", Value: otlpValue{job}}}
+	if s.hostname != "" {
+		resource = append(resource, otlpAttribute{Key: "host.name", Value: otlpValue{s.hostname}})
+	}
+
+	req := map[string]interface{}{
+		"resourceMetrics": []interface{}{
+			map[string]interface{}{
+				"resource": map[string]interface{}{"attributes": resource},
+				"scopeMetrics": []interface{}{
+					map[string]interface{}{
+						"scope":   map[string]string{"name": "restic", "version": version},
+						"metrics": metrics,
+					},
+				},
+			},
+		},
+	}
+
+	return json.NewEncoder(wr).Encode(req)
+}
+
+// pushMetrics sends the summary of the command to the endpoint configured in
+// gopts. Nothing is done when no endpoint is configured.
+func pushMetrics(gopts GlobalOptions, command string, duration time.Duration, cmdErr error) error {
+	if gopts.MetricsPush == "" {
+		return nil
+	}
+
+	s := jobMetrics.summary(command, duration, cmdErr)
+
+	var (
+		buf         bytes.Buffer
+		target      string
+		method      string
+		contentType string
+		err         error
+	)
+
+	switch gopts.MetricsFormat {
+	case metricsFormatPushgateway:
+		target = pushgatewayURL(gopts.MetricsPush, gopts.MetricsJob, s)
+		method = "PUT"
+		contentType = "text/plain; version=0.0.4"
+		err = writePushgateway(&buf, s)
+	case metricsFormatOTLP:
+		target = gopts.MetricsPush
+		method = "POST"
+		contentType = "application/json"
+		err = writeOTLP(&buf, gopts.MetricsJob, s)
+	default:
+		return errors.Fatalf("invalid metrics format %q, must be %q or %q",
+			gopts.MetricsFormat, metricsFormatPushgateway, metricsFormatOTLP)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(method, target, &buf)
+	if err != nil {
+		return errors.Wrap(err, "NewRequest")
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	debug.Log("pushing metrics for %v to %v", command, target)
+
+	client := &http.Client{Timeout: metricsPushTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "push metrics")
+	}
+
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+	_ = resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return errors.Errorf("push metrics to %v: unexpected status %v: %s", target, resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	return nil
+}
+
+// serveMetrics serves the counters of the metrics package at addr for
+// scraping by Prometheus, until the returned function is called. Nothing is
+// done when addr is empty.
+func serveMetrics(addr string) (stop func(), err error) {
+	if addr == "" {
+		return func() {}, nil
+	}
+
+	l, err := listen(addr)
+	if err != nil {
+		return nil, errors.Fatalf("unable to listen on %v for metrics: %v", addr, err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Default)
+	srv := &http.Server{Handler: mux}
+
+	go func() {
+		err := srv.Serve(l)
+		if err != nil && err != http.ErrServerClosed {
+			Warnf("serving metrics failed: %v\n", err)
+		}
+	}()
+
+	Verbosef("serving metrics at http://%v/metrics\n", l.Addr())
+	debug.Log("serving metrics on %v", l.Addr())
+
+	return func() {
+		_ = srv.Close()
+	}, nil
+}
+
+// commandPath returns the command path without the name of the program, e.g.
+// "backup" for "restic backup".
+func commandPath(path string) string {
+	fields := strings.Fields(path)
+	if len(fields) > 1 {
+		fields = fields[1:]
+	}
+	return strings.Join(fields, " ")
+}
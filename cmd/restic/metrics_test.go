@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/restic"
+)
+
+type pushedMetrics struct {
+	method      string
+	path        string
+	contentType string
+	body        string
+}
+
+func testMetricsServer(t testing.TB) (*httptest.Server, <-chan pushedMetrics) {
+	ch := make(chan pushedMetrics, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		buf, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			t.Error(err)
+		}
+
+		ch <- pushedMetrics{
+			method:      req.Method,
+			path:        req.URL.Path,
+			contentType: req.Header.Get("Content-Type"),
+			body:        string(buf),
+		}
+	}))
+
+	return srv, ch
+}
+
+func TestPushMetrics(t *testing.T) {
+	jobMetrics = &jobResult{}
+	defer func() {
+		jobMetrics = &jobResult{}
+	}()
+
+	id := restic.NewRandomID()
+	jobMetrics.setSnapshot(id)
+	jobMetrics.addWarning()
+
+	t.Run("pushgateway", func(t *testing.T) {
+		srv, ch := testMetricsServer(t)
+		defer srv.Close()
+
+		gopts := GlobalOptions{MetricsPush: srv.URL + "/", MetricsFormat: metricsFormatPushgateway, MetricsJob: "nightly"}
+		err := pushMetrics(gopts, "backup", 3*time.Second, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		res := <-ch
+		if res.method != "PUT" {
+			t.Errorf("wrong method %v", res.method)
+		}
+
+		if !strings.HasPrefix(res.path, "/metrics/job/nightly/") || !strings.HasSuffix(res.path, "/command/backup") {
+			t.Errorf("wrong path %v", res.path)
+		}
+
+		for _, line := range []string{
+			"restic_job_duration_seconds 3\n",
+			"restic_job_success 1\n",
+			"restic_job_errors 1\n",
+			"restic_job_snapshot_info{snapshot_id=\"" + id.String() + "\"} 1\n",
+		} {
+			if !strings.Contains(res.body, line) {
+				t.Errorf("line %q not found in body:\n%s", line, res.body)
+			}
+		}
+	})
+
+	t.Run("otlp", func(t *testing.T) {
+		srv, ch := testMetricsServer(t)
+		defer srv.Close()
+
+		gopts := GlobalOptions{MetricsPush: srv.URL + "/v1/metrics", MetricsFormat: metricsFormatOTLP, MetricsJob: "restic"}
+		err := pushMetrics(gopts, "backup", time.Second, errors.New("failed"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		res := <-ch
+		if res.method != "POST" || res.path != "/v1/metrics" || res.contentType != "application/json" {
+			t.Errorf("wrong request %v %v (%v)", res.method, res.path, res.contentType)
+		}
+
+		var req struct {
+			ResourceMetrics []struct {
+				ScopeMetrics []struct {
+					Metrics []otlpMetric `json:"metrics"`
+				} `json:"scopeMetrics"`
+			} `json:"resourceMetrics"`
+		}
+
+		err = json.Unmarshal([]byte(res.body), &req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		values := make(map[string]float64)
+		for _, m := range req.ResourceMetrics[0].ScopeMetrics[0].Metrics {
+			values[m.Name] = m.Gauge.DataPoints[0].AsDouble
+		}
+
+		if v, ok := values["restic.job.success"]; !ok || v != 0 {
+			t.Errorf("wrong value for success: %v (found %v)", v, ok)
+		}
+
+		if v, ok := values["restic.job.duration_seconds"]; !ok || v != 1 {
+			t.Errorf("wrong value for duration: %v (found %v)", v, ok)
+		}
+	})
+}
+
+func TestPushMetricsDisabled(t *testing.T) {
+	err := pushMetrics(GlobalOptions{}, "backup", time.Second, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestJobResultReset(t *testing.T) {
+	var j jobResult
+	j.setSnapshot(restic.NewRandomID())
+	j.addWarning()
+	j.addTimeout()
+
+	j.reset()
+
+	if j.snapshot() != nil {
+		t.Errorf("snapshot %v not cleared", j.snapshot())
+	}
+	if j.backendTimeouts() != 0 {
+		t.Errorf("timeouts not cleared")
+	}
+
+	s := j.summary("backup", time.Second, nil)
+	if s.snapshotID != "" {
+		t.Errorf("snapshot %v still in summary", s.snapshotID)
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+)
+
+// slowOpenThreshold is the duration after which the steps needed to open a
+// repository are printed even when opening succeeded.
+const slowOpenThreshold = 15 * time.Second
+
+// openStep is a single step needed to open a repository.
+type openStep struct {
+	name     string
+	start    time.Time
+	duration time.Duration
+	err      error
+	done     bool
+}
+
+// openTrace records how long the steps needed to open a repository take, so
+// that users can see which step failed or hangs. All methods can be called on
+// a nil *openTrace, in which case nothing is recorded.
+type openTrace struct {
+	mu      sync.Mutex
+	start   time.Time
+	steps   []*openStep
+	stopped bool
+}
+
+func newOpenTrace() *openTrace {
+	return &openTrace{start: time.Now()}
+}
+
+// Start records the beginning of the step name. The returned function must be
+// called with the result of the step when it has finished.
+func (t *openTrace) Start(name string) func(error) {
+	if t == nil {
+		return func(error) {}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.stopped {
+		return func(error) {}
+	}
+
+	step := &openStep{name: name, start: time.Now()}
+	t.steps = append(t.steps, step)
+
+	return func(err error) {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+
+		step.duration = time.Since(step.start)
+		step.err = err
+		step.done = true
+	}
+}
+
+// Stop ends recording new steps.
+func (t *openTrace) Stop() {
+	if t == nil {
+		return
+	}
+
+	t.mu.Lock()
+	t.stopped = true
+	t.mu.Unlock()
+}
+
+// Report prints all steps recorded so far to stderr.
+func (t *openTrace) Report() {
+	if t == nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	Warnf("steps needed to open the repository:\n")
+	for _, step := range t.steps {
+		offset := step.start.Sub(t.start)
+		switch {
+		case !step.done:
+			Warnf("  %8v  %v: still running after %v\n", formatTraceDuration(offset), step.name, formatTraceDuration(time.Since(step.start)))
+		case step.err != nil:
+			Warnf("  %8v  %v: failed after %v: %v\n", formatTraceDuration(offset), step.name, formatTraceDuration(step.duration), step.err)
+		default:
+			Warnf("  %8v  %v: %v\n", formatTraceDuration(offset), step.name, formatTraceDuration(step.duration))
+		}
+	}
+}
+
+// traceIndexLoad runs load, which loads the index of a repository, and
+// prints how long it took when it failed or was slow, like the steps needed to
+// open the repository.
+func traceIndexLoad(load func() error) error {
+	trace := newOpenTrace()
+	done := trace.Start("load index")
+	err := load()
+	done(err)
+	trace.Stop()
+
+	if err != nil || time.Since(trace.start) > slowOpenThreshold {
+		trace.Report()
+	}
+
+	return err
+}
+
+// loadIndex loads the index of repo and reports the time needed for it.
+func loadIndex(ctx context.Context, repo restic.Repository) error {
+	return traceIndexLoad(func() error {
+		return repo.LoadIndex(ctx)
+	})
+}
+
+// loadTreeIndex loads the tree blobs of the index of repo and reports the
+// time needed for it.
+func loadTreeIndex(ctx context.Context, repo *repository.Repository) error {
+	return traceIndexLoad(func() error {
+		return repo.LoadTreeIndex(ctx)
+	})
+}
+
+func formatTraceDuration(d time.Duration) string {
+	return (d / time.Millisecond * time.Millisecond).String()
+}
+
+// Transport wraps rt so that the DNS lookup, connection setup, TLS handshake
+// and the status of all HTTP requests are recorded while the trace is
+// running.
+func (t *openTrace) Transport(rt http.RoundTripper) http.RoundTripper {
+	if t == nil {
+		return rt
+	}
+
+	return traceRoundTripper{rt: rt, trace: t}
+}
+
+type traceRoundTripper struct {
+	rt    http.RoundTripper
+	trace *openTrace
+}
+
+func (tr traceRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	tr.trace.mu.Lock()
+	stopped := tr.trace.stopped
+	tr.trace.mu.Unlock()
+
+	if stopped {
+		return tr.rt.RoundTrip(req)
+	}
+
+	host := req.URL.Host
+
+	var (
+		mu               sync.Mutex
+		dnsDone, tlsDone func(error)
+		connectDone      = make(map[string]func(error))
+	)
+
+	ct := &httptrace.ClientTrace{
+		DNSStart: func(info httptrace.DNSStartInfo) {
+			mu.Lock()
+			dnsDone = tr.trace.Start("DNS lookup for " + info.Host)
+			mu.Unlock()
+		},
+		DNSDone: func(info httptrace.DNSDoneInfo) {
+			mu.Lock()
+			if dnsDone != nil {
+				dnsDone(info.Err)
+			}
+			mu.Unlock()
+		},
+		ConnectStart: func(network, addr string) {
+			mu.Lock()
+			connectDone[addr] = tr.trace.Start("connect to " + addr)
+			mu.Unlock()
+		},
+		ConnectDone: func(network, addr string, err error) {
+			mu.Lock()
+			if done, ok := connectDone[addr]; ok {
+				done(err)
+			}
+			mu.Unlock()
+		},
+		TLSHandshakeStart: func() {
+			mu.Lock()
+			tlsDone = tr.trace.Start("TLS handshake with " + host)
+			mu.Unlock()
+		},
+		TLSHandshakeDone: func(_ tls.ConnectionState, err error) {
+			mu.Lock()
+			if tlsDone != nil {
+				tlsDone(err)
+			}
+			mu.Unlock()
+		},
+	}
+
+	done := tr.trace.Start(fmt.Sprintf("HTTP %v %v%v", req.Method, host, req.URL.Path))
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), ct))
+
+	res, err := tr.rt.RoundTrip(req)
+	if err == nil && res.StatusCode >= 400 {
+		done(fmt.Errorf("server responded with status %v", res.Status))
+	} else {
+		done(err)
+	}
+
+	return res, err
+}
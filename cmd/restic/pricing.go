@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// bytesPerGB is the size of a gigabyte as used by storage providers for
+// billing.
+const bytesPerGB = 1000 * 1000 * 1000
+
+// pricing describes the prices a storage provider charges, in US dollars.
+type pricing struct {
+	Name string `json:"name,omitempty"`
+
+	// StoragePerGB is the price per GB stored for a month.
+	StoragePerGB float64 `json:"storage_per_gb"`
+
+	// DownloadPerGB is the price per GB downloaded.
+	DownloadPerGB float64 `json:"download_per_gb"`
+
+	// ReadRequests and WriteRequests are the prices per 1000 requests to
+	// read and write files.
+	ReadRequests  float64 `json:"read_requests"`
+	WriteRequests float64 `json:"write_requests"`
+
+	// PlanPrice is the monthly price for a plan with a fixed capacity of
+	// PlanCapacity bytes. If set, StoragePerGB is ignored.
+	PlanPrice    float64 `json:"plan_price,omitempty"`
+	PlanCapacity uint64  `json:"plan_capacity,omitempty"`
+}
+
+// pricingPresets contains the list prices of some providers. Prices change
+// over time and may differ by region, so the results are only an estimate.
+var pricingPresets = map[string]pricing{
+	"b2": {
+		StoragePerGB:  0.005,
+		DownloadPerGB: 0.01,
+		ReadRequests:  0.0004,
+	},
+	"s3": {
+		StoragePerGB:  0.023,
+		DownloadPerGB: 0.09,
+		ReadRequests:  0.0004,
+		WriteRequests: 0.005,
+	},
+	"s3-ia": {
+		StoragePerGB:  0.0125,
+		DownloadPerGB: 0.10,
+		ReadRequests:  0.001,
+		WriteRequests: 0.01,
+	},
+	"pcloud-500g": {
+		PlanPrice:    4.99,
+		PlanCapacity: 500 * bytesPerGB,
+	},
+	"pcloud-2t": {
+		PlanPrice:    9.99,
+		PlanCapacity: 2000 * bytesPerGB,
+	},
+}
+
+// pricingPresetNames returns the sorted names of all presets.
+func pricingPresetNames() []string {
+	names := make([]string, 0, len(pricingPresets))
+	for name := range pricingPresets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// override sets the prices in other which are larger than zero.
+func (p *pricing) override(other pricing) {
+	if other.StoragePerGB > 0 {
+		p.StoragePerGB = other.StoragePerGB
+		p.PlanPrice, p.PlanCapacity = 0, 0
+	}
+	if other.DownloadPerGB > 0 {
+		p.DownloadPerGB = other.DownloadPerGB
+	}
+	if other.ReadRequests > 0 {
+		p.ReadRequests = other.ReadRequests
+	}
+	if other.WriteRequests > 0 {
+		p.WriteRequests = other.WriteRequests
+	}
+}
+
+// storageCost returns the monthly price for storing size bytes. For plans,
+// the number of plans needed to store the data is used.
+func (p pricing) storageCost(size uint64) float64 {
+	if p.PlanPrice > 0 && p.PlanCapacity > 0 {
+		plans := math.Ceil(float64(size) / float64(p.PlanCapacity))
+		if plans < 1 {
+			plans = 1
+		}
+		return plans * p.PlanPrice
+	}
+
+	return float64(size) / bytesPerGB * p.StoragePerGB
+}
+
+// transferCost returns the price for downloading download bytes with reads
+// requests and for writes requests which upload data.
+func (p pricing) transferCost(download, reads, writes uint64) float64 {
+	return float64(download)/bytesPerGB*p.DownloadPerGB +
+		float64(reads)/1000*p.ReadRequests +
+		float64(writes)/1000*p.WriteRequests
+}
+
+func (p pricing) String() string {
+	var storage string
+	if p.PlanPrice > 0 {
+		storage = fmt.Sprintf("%v for %d GB per month", formatDollars(p.PlanPrice), p.PlanCapacity/bytesPerGB)
+	} else {
+		storage = fmt.Sprintf("%v/GB per month", formatDollars(p.StoragePerGB))
+	}
+
+	return fmt.Sprintf("%v, %v/GB download, %v/1000 reads, %v/1000 writes", storage,
+		formatDollars(p.DownloadPerGB), formatDollars(p.ReadRequests), formatDollars(p.WriteRequests))
+}
+
+// formatDollars formats an amount in US dollars, small amounts are printed
+// with more digits.
+func formatDollars(v float64) string {
+	if v != 0 && v < 0.01 {
+		return fmt.Sprintf("$%.4f", v)
+	}
+	return fmt.Sprintf("$%.2f", v)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func equalPrice(t testing.TB, want, got float64) {
+	if math.Abs(want-got) > 1e-9 {
+		t.Errorf("wrong price, want %v, got %v", want, got)
+	}
+}
+
+func TestPricingStorageCost(t *testing.T) {
+	var tests = []struct {
+		p    pricing
+		size uint64
+		cost float64
+	}{
+		{pricing{StoragePerGB: 0.005}, 0, 0},
+		{pricing{StoragePerGB: 0.005}, 200 * bytesPerGB, 1},
+		{pricing{StoragePerGB: 0.023}, bytesPerGB / 2, 0.0115},
+		{pricing{PlanPrice: 4.99, PlanCapacity: 500 * bytesPerGB}, 0, 4.99},
+		{pricing{PlanPrice: 4.99, PlanCapacity: 500 * bytesPerGB}, 500 * bytesPerGB, 4.99},
+		{pricing{PlanPrice: 4.99, PlanCapacity: 500 * bytesPerGB}, 500*bytesPerGB + 1, 9.98},
+	}
+
+	for _, test := range tests {
+		equalPrice(t, test.cost, test.p.storageCost(test.size))
+	}
+}
+
+func TestPricingTransferCost(t *testing.T) {
+	p := pricing{DownloadPerGB: 0.01, ReadRequests: 0.0004, WriteRequests: 0.005}
+	equalPrice(t, 0, p.transferCost(0, 0, 0))
+	equalPrice(t, 0.02, p.transferCost(2*bytesPerGB, 0, 0))
+	equalPrice(t, 0.004, p.transferCost(0, 10000, 0))
+	equalPrice(t, 0.005, p.transferCost(0, 0, 1000))
+}
+
+func TestPricingOverride(t *testing.T) {
+	p := pricingPresets["pcloud-500g"]
+	p.override(pricing{DownloadPerGB: 0.02})
+	equalPrice(t, 0.02, p.DownloadPerGB)
+	equalPrice(t, 4.99, p.storageCost(bytesPerGB))
+
+	// setting a storage price replaces the plan
+	p.override(pricing{StoragePerGB: 0.01})
+	equalPrice(t, 0.01, p.storageCost(bytesPerGB))
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Types of the messages printed with --json. Commands which support the
+// option print one JSON object per line, the field "message_type" contains
+// the type of the message.
+const (
+	msgStatus   = "status"
+	msgSummary  = "summary"
+	msgError    = "error"
+	msgSnapshot = "snapshot"
+	msgNode     = "node"
+	msgGroup    = "group"
+	msgRemove   = "remove"
+)
+
+// errorMessage is the JSON representation of an error or warning, it is
+// written to stderr.
+type errorMessage struct {
+	MessageType string `json:"message_type"`
+	Error       string `json:"error"`
+	During      string `json:"during,omitempty"`
+	Item        string `json:"item,omitempty"`
+}
+
+// printer writes the messages of a command, either as text or, with --json,
+// as line-delimited JSON. Messages can be printed concurrently.
+type printer struct {
+	json   bool
+	quiet  bool
+	stdout io.Writer
+	stderr io.Writer
+
+	m sync.Mutex
+}
+
+func newPrinter(gopts GlobalOptions) *printer {
+	return &printer{
+		json:   gopts.JSON,
+		quiet:  gopts.Quiet,
+		stdout: gopts.stdout,
+		stderr: gopts.stderr,
+	}
+}
+
+// encode writes msg as a single line to wr.
+func (p *printer) encode(wr io.Writer, msg interface{}) {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	err := json.NewEncoder(wr).Encode(msg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to write JSON message: %v\n", err)
+		Exit(100)
+	}
+}
+
+// Message writes msg to stdout in JSON mode, msg must have a field
+// "message_type". Nothing is printed in text mode.
+func (p *printer) Message(msg interface{}) {
+	if !p.json {
+		return
+	}
+	p.encode(p.stdout, msg)
+}
+
+// Textf prints the text message in text mode. Nothing is printed in JSON
+// mode.
+func (p *printer) Textf(format string, args ...interface{}) {
+	if p.json {
+		return
+	}
+	Printf(format, args...)
+}
+
+// Error reports err, which occurred during the step during for item (both
+// may be empty). In text mode, the message format is printed to stderr.
+func (p *printer) Error(during, item string, err error, format string, args ...interface{}) {
+	if !p.json {
+		Warnf(format, args...)
+		return
+	}
+
+	jobMetrics.addWarning()
+	p.jsonError(during, item, err)
+}
+
+// jsonError writes err as a JSON error message to stderr.
+func (p *printer) jsonError(during, item string, err error) {
+	p.encode(p.stderr, errorMessage{
+		MessageType: msgError,
+		Error:       err.Error(),
+		During:      during,
+		Item:        item,
+	})
+}
+
+// jsonWarnf writes the message as a JSON error message to stderr, it is used
+// by Warnf in JSON mode.
+func jsonWarnf(wr io.Writer, format string, args ...interface{}) error {
+	msg := strings.TrimSpace(fmt.Sprintf(format, args...))
+	return json.NewEncoder(wr).Encode(errorMessage{MessageType: msgError, Error: msg})
+}
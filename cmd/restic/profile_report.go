@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/restic/restic/internal/restic"
+)
+
+// phaseResources names the resource which limits the throughput of a phase.
+var phaseResources = map[string]string{
+	restic.PhaseScan:    "disk",
+	restic.PhaseRead:    "disk",
+	restic.PhaseChunk:   "cpu",
+	restic.PhaseHash:    "cpu",
+	restic.PhaseEncrypt: "cpu",
+	restic.PhaseUpload:  "backend",
+	restic.PhaseIndex:   "backend",
+}
+
+// printProfileReport prints the time spent in the phases of an operation
+// which took total, and names the phase in which most of the time was spent.
+func printProfileReport(w io.Writer, phases []restic.PhaseStat, total time.Duration) error {
+	if len(phases) == 0 {
+		return nil
+	}
+
+	var slowest restic.PhaseStat
+	tab := NewTable()
+	tab.Header = fmt.Sprintf("%-8s  %8s  %11s  %15s  %s", "Phase", "Time", "Data", "Throughput", "Resource")
+	tab.RowFormat = "%-8s  %8s  %11s  %15s  %s"
+
+	for _, s := range phases {
+		throughput := ""
+		if s.Bytes > 0 {
+			throughput = formatBytes(uint64(s.BytesPerSecond())) + "/s"
+		}
+
+		tab.Rows = append(tab.Rows, []interface{}{
+			s.Phase, fmt.Sprintf("%.2fs", s.Duration.Seconds()), formatBytes(s.Bytes), throughput, phaseResources[s.Phase],
+		})
+
+		if s.Duration > slowest.Duration {
+			slowest = s
+		}
+	}
+
+	tab.Footer = fmt.Sprintf("total %.2fs, times are summed over all concurrent workers\n"+
+		"most time was spent in %q (%s)", total.Seconds(), slowest.Phase, phaseResources[slowest.Phase])
+
+	return tab.Write(w)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/restic/restic/internal/progress"
+	"github.com/restic/restic/internal/restic"
+)
+
+// quietPrinter does not print anything.
+type quietPrinter struct{}
+
+func (quietPrinter) Update(progress.Status) {}
+func (quietPrinter) Done(progress.Status)   {}
+
+// donePrinter calls done with the final status of an operation.
+type donePrinter struct {
+	progress.Printer
+	done func(progress.Status)
+}
+
+func (p donePrinter) Done(s progress.Status) {
+	p.Printer.Done(s)
+	p.done(s)
+}
+
+// progressOptions describes how the progress of an operation is printed.
+type progressOptions struct {
+	// Action names what is counted for operations which count blobs (e.g.
+	// "packs"), it is empty for operations which count files and bytes.
+	Action string
+	// Format returns the status line in text mode, the default prints the
+	// percentage and the counts.
+	Format func(progress.Status) string
+	// Summary returns the text printed in text mode when the operation has
+	// finished, it may be nil.
+	Summary func(progress.Status) string
+	// Done is called with the final status in all modes, it may be nil.
+	Done func(progress.Status)
+}
+
+// newProgress returns a progress for an operation which counts up to total.
+// The status is printed as text, with --json as status messages, and not at
+// all with --quiet. It returns nil when nothing needs to be reported.
+func newProgress(gopts GlobalOptions, total restic.Stat, opts progressOptions) *restic.Progress {
+	var pr progress.Printer
+	var interval time.Duration
+
+	switch {
+	case gopts.Quiet:
+		if opts.Done == nil {
+			return nil
+		}
+		pr = quietPrinter{}
+	case gopts.JSON:
+		pr = &progress.JSON{Message: newPrinter(gopts).Message, Action: opts.Action}
+		interval = time.Second
+	default:
+		format := opts.Format
+		if format == nil {
+			format = func(s progress.Status) string {
+				return formatStatus(s, opts.Action)
+			}
+		}
+
+		pr = &progress.Text{
+			Writer:    gopts.stdout,
+			Terminal:  stdoutIsTerminal(),
+			Width:     stdoutTerminalWidth,
+			ClearLine: ClearLine(),
+			Hidden:    IsProcessBackground,
+			Format:    format,
+			Summary:   opts.Summary,
+		}
+	}
+
+	if opts.Done != nil {
+		pr = donePrinter{Printer: pr, done: opts.Done}
+	}
+
+	p := progress.New(pr, interval)
+	p.SetTotal(total)
+	return p
+}
+
+// formatStatus returns the default status line for an operation which counts
+// action (e.g. "packs"), or files and bytes if action is empty.
+func formatStatus(s progress.Status, action string) string {
+	if action != "" {
+		return fmt.Sprintf("[%s] %s  %d / %d %s",
+			formatDuration(s.Elapsed),
+			formatPercent(s.Done.Blobs, s.Total.Blobs),
+			s.Done.Blobs, s.Total.Blobs, action)
+	}
+
+	return fmt.Sprintf("[%s] %s  %s/s  %s / %s  %d / %d items  %d errors  ETA %s",
+		formatDuration(s.Elapsed),
+		formatPercent(s.Done.Bytes, s.Total.Bytes),
+		formatBytes(s.BytesPerSecond),
+		formatBytes(s.Done.Bytes), formatBytes(s.Total.Bytes),
+		s.Done.Files+s.Done.Dirs, s.Total.Files+s.Total.Dirs,
+		s.Done.Errors,
+		formatSeconds(uint64(s.Remaining/time.Second)))
+}
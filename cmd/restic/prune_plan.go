@@ -0,0 +1,251 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/index"
+	"github.com/restic/restic/internal/restic"
+)
+
+// defaultMaxUnused is the unused space tolerated by prune if --max-unused is
+// not given.
+const defaultMaxUnused = "5%"
+
+// verifyPruneOptions parses the limits given as strings in opts.
+func verifyPruneOptions(opts *PruneOptions) error {
+	if opts.MaxRepackSize != "" {
+		size, err := parseSize(opts.MaxRepackSize)
+		if err != nil {
+			return errors.Fatalf("invalid --max-repack-size: %v", err)
+		}
+		opts.maxRepackBytes = size
+	}
+
+	maxUnused := strings.TrimSpace(opts.MaxUnused)
+	if maxUnused == "" {
+		maxUnused = defaultMaxUnused
+	}
+
+	switch {
+	case maxUnused == "unlimited":
+		opts.maxUnusedBytes = func(used uint64) uint64 {
+			return math.MaxUint64
+		}
+
+	case strings.HasSuffix(maxUnused, "%"):
+		p, err := strconv.ParseFloat(strings.TrimSuffix(maxUnused, "%"), 64)
+		if err != nil {
+			return errors.Fatalf("invalid percentage %q passed for --max-unused: %v", opts.MaxUnused, err)
+		}
+
+		if p < 0 || p >= 100 {
+			return errors.Fatalf("percentage %q passed for --max-unused must be between 0%% and 100%% (exclusive)", opts.MaxUnused)
+		}
+
+		// the unused data must be at most p percent of the repository
+		// size after prune, which is the used data plus the unused data
+		opts.maxUnusedBytes = func(used uint64) uint64 {
+			return uint64(float64(used) / (100 - p) * p)
+		}
+
+	default:
+		size, err := parseSize(maxUnused)
+		if err != nil {
+			return errors.Fatalf("invalid --max-unused: %v", err)
+		}
+
+		opts.maxUnusedBytes = func(used uint64) uint64 {
+			return size
+		}
+	}
+
+	return nil
+}
+
+// packInfo is the amount of used and unused data in a pack.
+type packInfo struct {
+	id          restic.ID
+	size        uint64
+	usedBlobs   int
+	usedSize    uint64
+	unusedBlobs int
+	unusedSize  uint64
+	mixed       bool
+}
+
+// prunePlan describes which packs are removed and repacked by prune, and the
+// amount of data affected.
+type prunePlan struct {
+	removePacks restic.IDSet   // packs which contain no used blobs
+	repackPacks restic.IDs     // packs to repack, in the order in which they are processed
+	repackBlobs restic.BlobSet // used blobs which are copied from the repacked packs
+	keepPacks   int            // number of packs which are left untouched
+
+	usedBlobs      int
+	usedSize       uint64
+	unusedBlobs    int
+	unusedSize     uint64
+	duplicateBlobs int
+	duplicateSize  uint64
+
+	totalSize  uint64 // size of all packs
+	removeSize uint64 // size of the packs to remove
+	repackSize uint64 // size of the packs to repack
+	freeSize   uint64 // space freed by removing and repacking packs
+
+	unusedAfter uint64 // unused data left in the repository after prune
+}
+
+// planPrune decides which packs prune removes and repacks. Packs without any
+// used blobs are removed, packs which contain both data and tree blobs are
+// always repacked. Of the remaining packs which contain unused data, those
+// with the largest share of unused data are repacked until the unused data
+// left in the repository is within the limit of opts.MaxUnused, as long as
+// the size of all repacked packs does not exceed opts.MaxRepackSize. opts
+// must have been checked by verifyPruneOptions.
+//
+// Of each used blob stored several times, only one copy is kept. Copies in
+// packs which are not going to be repacked are preferred.
+func planPrune(packs map[restic.ID]index.Pack, usedBlobs restic.BlobSet, opts PruneOptions) *prunePlan {
+	plan := &prunePlan{
+		removePacks: restic.NewIDSet(),
+		repackBlobs: restic.NewBlobSet(),
+	}
+
+	// packs which do not contain unused blobs (apart from duplicates) are
+	// likely to be kept, so they claim the duplicate blobs first
+	var clean, dirty restic.IDs
+	for id, pack := range packs {
+		plan.totalSize += uint64(pack.Size)
+
+		unused := false
+		for _, blob := range pack.Entries {
+			if !usedBlobs.Has(restic.BlobHandle{ID: blob.ID, Type: blob.Type}) {
+				unused = true
+				break
+			}
+		}
+
+		if unused || mixedBlobs(pack.Entries) {
+			dirty = append(dirty, id)
+		} else {
+			clean = append(clean, id)
+		}
+	}
+	sort.Sort(clean)
+	sort.Sort(dirty)
+
+	owner := make(map[restic.BlobHandle]restic.ID)
+	infos := make(map[restic.ID]*packInfo, len(packs))
+	for _, id := range append(clean, dirty...) {
+		pack := packs[id]
+		info := &packInfo{id: id, size: uint64(pack.Size), mixed: mixedBlobs(pack.Entries)}
+		infos[id] = info
+
+		for _, blob := range pack.Entries {
+			h := restic.BlobHandle{ID: blob.ID, Type: blob.Type}
+			_, claimed := owner[h]
+
+			switch {
+			case !usedBlobs.Has(h):
+				info.unusedBlobs++
+				info.unusedSize += uint64(blob.Length)
+				plan.unusedBlobs++
+				plan.unusedSize += uint64(blob.Length)
+			case claimed:
+				info.unusedBlobs++
+				info.unusedSize += uint64(blob.Length)
+				plan.duplicateBlobs++
+				plan.duplicateSize += uint64(blob.Length)
+			default:
+				owner[h] = id
+				info.usedBlobs++
+				info.usedSize += uint64(blob.Length)
+				plan.usedBlobs++
+				plan.usedSize += uint64(blob.Length)
+			}
+		}
+	}
+
+	var forced, candidates []*packInfo
+	for _, id := range append(clean, dirty...) {
+		info := infos[id]
+		switch {
+		case info.usedBlobs == 0:
+			plan.removePacks.Insert(id)
+			plan.removeSize += info.size
+			plan.freeSize += info.size
+			continue
+		case info.mixed:
+			forced = append(forced, info)
+		case info.unusedBlobs > 0:
+			candidates = append(candidates, info)
+		}
+
+		plan.unusedAfter += info.unusedSize
+	}
+
+	// repack the packs with the largest share of unused data first
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].unusedSize*candidates[j].size > candidates[j].unusedSize*candidates[i].size
+	})
+
+	repack := func(info *packInfo) {
+		plan.repackPacks = append(plan.repackPacks, info.id)
+		plan.repackSize += info.size
+		plan.freeSize += info.unusedSize
+		plan.unusedAfter -= info.unusedSize
+	}
+
+	for _, info := range forced {
+		repack(info)
+	}
+
+	maxUnused := opts.maxUnusedBytes(plan.usedSize)
+	for _, info := range candidates {
+		if plan.unusedAfter <= maxUnused {
+			break
+		}
+
+		if opts.maxRepackBytes > 0 && plan.repackSize+info.size > opts.maxRepackBytes {
+			continue
+		}
+
+		repack(info)
+	}
+
+	repacked := restic.NewIDSet(plan.repackPacks...)
+	for h, id := range owner {
+		if repacked.Has(id) {
+			plan.repackBlobs.Insert(h)
+		}
+	}
+
+	plan.keepPacks = len(packs) - len(plan.removePacks) - len(plan.repackPacks)
+
+	return plan
+}
+
+// print prints the statistics of the plan.
+func (plan *prunePlan) print() {
+	Verbosef("\n")
+	Verbosef("used:         %10d blobs / %s\n", plan.usedBlobs, formatBytes(plan.usedSize))
+	Verbosef("duplicates:   %10d blobs / %s\n", plan.duplicateBlobs, formatBytes(plan.duplicateSize))
+	Verbosef("unused:       %10d blobs / %s\n", plan.unusedBlobs, formatBytes(plan.unusedSize))
+	Verbosef("\n")
+	Verbosef("to repack:    %10d packs / %s\n", len(plan.repackPacks), formatBytes(plan.repackSize))
+	Verbosef("to delete:    %10d packs / %s\n", len(plan.removePacks), formatBytes(plan.removeSize))
+	Verbosef("to keep:      %10d packs\n", plan.keepPacks)
+	Verbosef("\n")
+
+	var share float64
+	if remaining := plan.totalSize - plan.freeSize; remaining > 0 {
+		share = float64(plan.unusedAfter) / float64(remaining) * 100
+	}
+	Verbosef("frees %s, %s of unused data remain (%.2f%% of the repository)\n",
+		formatBytes(plan.freeSize), formatBytes(plan.unusedAfter), share)
+}
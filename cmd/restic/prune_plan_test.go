@@ -0,0 +1,120 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/restic/restic/internal/index"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestVerifyPruneOptions(t *testing.T) {
+	var tests = []struct {
+		maxUnused string
+		used      uint64
+		want      uint64
+	}{
+		{"", 95, 5},
+		{"0%", 1000, 0},
+		{"50%", 100, 100},
+		{"1k", 0, 1024},
+		{"2M", 1 << 30, 2 << 20},
+		{"unlimited", 100, 1<<64 - 1},
+	}
+
+	for _, test := range tests {
+		opts := PruneOptions{MaxUnused: test.maxUnused, MaxRepackSize: "1G"}
+		rtest.OK(t, verifyPruneOptions(&opts))
+		rtest.Equals(t, test.want, opts.maxUnusedBytes(test.used))
+		rtest.Equals(t, uint64(1<<30), opts.maxRepackBytes)
+	}
+
+	for _, maxUnused := range []string{"100%", "-1%", "x%", "foo", "10X"} {
+		opts := PruneOptions{MaxUnused: maxUnused}
+		rtest.Assert(t, verifyPruneOptions(&opts) != nil, "invalid --max-unused %q was accepted", maxUnused)
+	}
+
+	opts := PruneOptions{MaxRepackSize: "foo"}
+	rtest.Assert(t, verifyPruneOptions(&opts) != nil, "invalid --max-repack-size was accepted")
+}
+
+func TestPlanPrune(t *testing.T) {
+	id := func(name string) restic.ID {
+		return restic.Hash([]byte(name))
+	}
+
+	data := func(name string) restic.Blob {
+		return restic.Blob{ID: id(name), Type: restic.DataBlob, Length: 100}
+	}
+
+	tree := func(name string) restic.Blob {
+		return restic.Blob{ID: id(name), Type: restic.TreeBlob, Length: 100}
+	}
+
+	// each pack has a header of 10 bytes
+	packs := make(map[restic.ID]index.Pack)
+	addPack := func(name string, blobs ...restic.Blob) {
+		packs[id(name)] = index.Pack{ID: id(name), Size: int64(len(blobs)*100 + 10), Entries: blobs}
+	}
+
+	addPack("keep", data("a"), data("b"))
+	addPack("unused", data("x"), data("y"))
+	addPack("half", data("c"), data("z"))
+	addPack("mostly", data("d"), data("u1"), data("u2"), data("u3"))
+	addPack("mixed", tree("t"), data("e"))
+	addPack("dup", data("a"), data("f"), data("w"))
+
+	usedBlobs := restic.NewBlobSet()
+	for _, name := range []string{"a", "b", "c", "d", "e", "f"} {
+		usedBlobs.Insert(restic.BlobHandle{ID: id(name), Type: restic.DataBlob})
+	}
+	usedBlobs.Insert(restic.BlobHandle{ID: id("t"), Type: restic.TreeBlob})
+
+	var tests = []struct {
+		maxUnused     string
+		maxRepackSize string
+		repack        []string
+		unusedAfter   uint64
+	}{
+		{"unlimited", "", []string{"mixed"}, 600},
+		{"0%", "", []string{"mixed", "mostly", "dup", "half"}, 0},
+		{"350", "", []string{"mixed", "mostly"}, 300},
+		{"0", "500", []string{"mixed", "half"}, 500},
+	}
+
+	for _, test := range tests {
+		t.Run("", func(t *testing.T) {
+			opts := PruneOptions{MaxUnused: test.maxUnused, MaxRepackSize: test.maxRepackSize}
+			rtest.OK(t, verifyPruneOptions(&opts))
+
+			plan := planPrune(packs, usedBlobs, opts)
+
+			rtest.Equals(t, restic.NewIDSet(id("unused")), plan.removePacks)
+			rtest.Equals(t, uint64(210), plan.removeSize)
+			rtest.Equals(t, 7, plan.usedBlobs)
+			rtest.Equals(t, 1, plan.duplicateBlobs)
+			rtest.Equals(t, 7, plan.unusedBlobs)
+
+			var repack restic.IDs
+			for _, name := range test.repack {
+				repack = append(repack, id(name))
+			}
+			rtest.Equals(t, repack, plan.repackPacks)
+			rtest.Equals(t, len(packs)-1-len(repack), plan.keepPacks)
+			rtest.Equals(t, test.unusedAfter, plan.unusedAfter)
+
+			// only the used blobs from the repacked packs are copied, the
+			// duplicate of "a" in "dup" is dropped as "keep" is not repacked
+			for _, pack := range test.repack {
+				for _, blob := range packs[id(pack)].Entries {
+					h := restic.BlobHandle{ID: blob.ID, Type: blob.Type}
+					want := usedBlobs.Has(h) && blob.ID != id("a")
+					rtest.Assert(t, plan.repackBlobs.Has(h) == want,
+						"blob %v in pack %v: want repack %v", h, pack, want)
+				}
+			}
+			rtest.Assert(t, !plan.repackBlobs.Has(restic.BlobHandle{ID: id("a"), Type: restic.DataBlob}),
+				"duplicate blob is repacked")
+		})
+	}
+}
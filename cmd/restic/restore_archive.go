@@ -0,0 +1,365 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"context"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+)
+
+// archiveFormat returns the archive format for the file name, based on the
+// extension.
+func archiveFormat(name string) (string, error) {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".tar":
+		return "tar", nil
+	case ".zip":
+		return "zip", nil
+	}
+
+	return "", errors.Fatalf("unknown archive format for %q, the name must end with .tar or .zip", name)
+}
+
+// archiveSupports returns true if nodes of type tpe can be stored in an
+// archive of the given format.
+func archiveSupports(format, tpe string) bool {
+	switch tpe {
+	case "file", "dir", "symlink":
+		return true
+	case "fifo":
+		return format == "tar"
+	}
+
+	return false
+}
+
+// archiveWriter writes the items of a snapshot to an archive.
+type archiveWriter interface {
+	// WriteItem adds item to the archive, the content of files is written
+	// by content.
+	WriteItem(item exportItem, content func(io.Writer) error) error
+	Close() error
+}
+
+type tarArchiveWriter struct {
+	tw *tar.Writer
+}
+
+func (w *tarArchiveWriter) WriteItem(item exportItem, content func(io.Writer) error) error {
+	hdr, ok := tarHeader(item.name, item.node)
+	if !ok {
+		return errors.Errorf("type %v of %v is not supported", item.node.Type, item.name)
+	}
+
+	if err := w.tw.WriteHeader(hdr); err != nil {
+		return errors.Wrapf(err, "WriteHeader for %v", item.name)
+	}
+
+	if item.node.Type == "file" {
+		return content(w.tw)
+	}
+
+	return nil
+}
+
+func (w *tarArchiveWriter) Close() error {
+	return errors.Wrap(w.tw.Close(), "Close")
+}
+
+// zipArchiveWriter stores the files without compression, so that the size of
+// the archive is known before the data is loaded.
+type zipArchiveWriter struct {
+	zw *zip.Writer
+}
+
+func (w *zipArchiveWriter) WriteItem(item exportItem, content func(io.Writer) error) error {
+	hdr := &zip.FileHeader{
+		Name:   item.name,
+		Method: zip.Store,
+	}
+	hdr.SetModTime(item.node.ModTime)
+
+	switch item.node.Type {
+	case "dir":
+		hdr.Name += "/"
+		hdr.SetMode(os.ModeDir | item.node.Mode.Perm())
+	case "symlink":
+		hdr.SetMode(os.ModeSymlink | 0777)
+	default:
+		hdr.SetMode(item.node.Mode.Perm())
+	}
+
+	wr, err := w.zw.CreateHeader(hdr)
+	if err != nil {
+		return errors.Wrapf(err, "CreateHeader for %v", item.name)
+	}
+
+	switch item.node.Type {
+	case "file":
+		return content(wr)
+	case "symlink":
+		_, err = io.WriteString(wr, item.node.LinkTarget)
+		return errors.Wrap(err, "Write")
+	}
+
+	return nil
+}
+
+func (w *zipArchiveWriter) Close() error {
+	return errors.Wrap(w.zw.Close(), "Close")
+}
+
+func newArchiveWriter(format string, wr io.Writer) archiveWriter {
+	if format == "zip" {
+		return &zipArchiveWriter{zw: zip.NewWriter(wr)}
+	}
+
+	return &tarArchiveWriter{tw: tar.NewWriter(wr)}
+}
+
+// writeArchive writes items as an archive to wr, the content of files is
+// written by content.
+func writeArchive(format string, wr io.Writer, items []exportItem, content func(*restic.Node, io.Writer) error) error {
+	aw := newArchiveWriter(format, wr)
+
+	for _, item := range items {
+		err := aw.WriteItem(item, func(w io.Writer) error {
+			return content(item.node, w)
+		})
+		if err != nil {
+			return errors.Wrapf(err, "unable to archive %v", item.name)
+		}
+	}
+
+	return aw.Close()
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
+
+// archiveLength returns the size of the archive for items. Backends need the
+// size before the data is uploaded, so the archive is written once with zeros
+// as the content of the files, which results in an archive of the same size.
+func archiveLength(format string, items []exportItem) (int64, error) {
+	wr := &countingWriter{}
+	err := writeArchive(format, wr, items, func(node *restic.Node, w io.Writer) error {
+		_, err := io.CopyN(w, zeroReader{}, int64(node.Size))
+		return err
+	})
+
+	return wr.n, err
+}
+
+// collectArchiveItems returns the items below the tree with the given id which
+// are selected by selectFilter, in the order in which they are archived.
+func collectArchiveItems(ctx context.Context, repo restic.Repository, format, location, prefix string, id restic.ID,
+	selectFilter func(string, string, *restic.Node) (bool, bool)) ([]exportItem, error) {
+
+	tree, err := repo.LoadTree(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	var items []exportItem
+	for _, node := range tree.Nodes {
+		if node.Name == "" || node.Name == "." || node.Name == ".." || strings.Contains(node.Name, "/") {
+			Warnf("skipping %v: node has invalid name %q\n", location, node.Name)
+			continue
+		}
+
+		nodeLocation := path.Join(location, node.Name)
+		name := path.Join(prefix, node.Name)
+
+		selected, childMayBeSelected := selectFilter(nodeLocation, name, node)
+
+		if selected {
+			if archiveSupports(format, node.Type) {
+				items = append(items, exportItem{name: name, node: node})
+			} else {
+				Warnf("skipping %v: type %v is not supported in %v archives\n", nodeLocation, node.Type, format)
+			}
+		}
+
+		if node.Type != "dir" || !childMayBeSelected {
+			continue
+		}
+
+		if node.Subtree == nil {
+			return nil, errors.Errorf("dir %v has no subtree", nodeLocation)
+		}
+
+		sub, err := collectArchiveItems(ctx, repo, format, nodeLocation, name, *node.Subtree, selectFilter)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, sub...)
+	}
+
+	return items, nil
+}
+
+// archiveReader is a RewindReader which generates an archive on the fly. On
+// Rewind, the archive is generated again from the start.
+type archiveReader struct {
+	generate func(io.Writer) error
+	length   int64
+
+	m  sync.Mutex
+	rd *io.PipeReader
+}
+
+func newArchiveReader(generate func(io.Writer) error, length int64) *archiveReader {
+	r := &archiveReader{
+		generate: generate,
+		length:   length,
+	}
+	r.start()
+	return r
+}
+
+func (r *archiveReader) start() {
+	rd, wr := io.Pipe()
+	go func() {
+		_ = wr.CloseWithError(r.generate(wr))
+	}()
+	r.rd = rd
+}
+
+func (r *archiveReader) Read(p []byte) (int, error) {
+	r.m.Lock()
+	rd := r.rd
+	r.m.Unlock()
+
+	return rd.Read(p)
+}
+
+// Rewind stops the current generator and starts a new one.
+func (r *archiveReader) Rewind() error {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	debug.Log("restarting archive")
+	_ = r.rd.Close()
+	r.start()
+	return nil
+}
+
+func (r *archiveReader) Length() int64 {
+	return r.length
+}
+
+// Close stops the generator.
+func (r *archiveReader) Close() error {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	return r.rd.Close()
+}
+
+// restoreToArchive writes the items of the snapshot which are selected by the
+// restorer's filter to an archive stored in the backend given by
+// opts.Target.
+func restoreToArchive(ctx context.Context, opts RestoreOptions, gopts GlobalOptions, repo restic.Repository, res *restic.Restorer) error {
+	format, err := archiveFormat(opts.AsArchive)
+	if err != nil {
+		return err
+	}
+
+	be, err := openBackend(opts.Target, gopts, gopts.extended, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = be.Close()
+	}()
+	be = newRetryBackend(be)
+
+	h := restic.Handle{Type: restic.ArchiveFile, Name: opts.AsArchive}
+	exists, err := be.Test(ctx, h)
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		return errors.Fatalf("archive %v already exists in %v", opts.AsArchive, opts.Target)
+	}
+
+	sn := res.Snapshot()
+	if sn.Tree == nil {
+		return errors.Errorf("snapshot %v has nil tree", sn.ID().Str())
+	}
+
+	items, err := collectArchiveItems(ctx, repo, format, "/", "", *sn.Tree, res.SelectFilter)
+	if err != nil {
+		return err
+	}
+
+	length, err := archiveLength(format, items)
+	if err != nil {
+		return err
+	}
+
+	debug.Log("archive %v has %d items, %d bytes", opts.AsArchive, len(items), length)
+	Verbosef("restoring %s to %s in %s (%v)\n", res.Snapshot(), opts.AsArchive, opts.Target, formatBytes(uint64(length)))
+
+	rd := newArchiveReader(func(wr io.Writer) error {
+		return writeArchive(format, wr, items, func(node *restic.Node, w io.Writer) error {
+			return dumpNode(ctx, repo, node, w)
+		})
+	}, length)
+	defer func() {
+		_ = rd.Close()
+	}()
+
+	err = be.Save(ctx, h, rd)
+	if err != nil {
+		return err
+	}
+
+	Verbosef("archived %d items\n", len(items))
+	return nil
+}
+
+// restoreToStream writes the items of the snapshot which are selected by the
+// restorer's filter as an archive in opts.Format to stdout.
+func restoreToStream(ctx context.Context, opts RestoreOptions, gopts GlobalOptions, repo restic.Repository, res *restic.Restorer) error {
+	sn := res.Snapshot()
+	if sn.Tree == nil {
+		return errors.Errorf("snapshot %v has nil tree", sn.ID().Str())
+	}
+
+	items, err := collectArchiveItems(ctx, repo, opts.Format, "/", "", *sn.Tree, res.SelectFilter)
+	if err != nil {
+		return err
+	}
+
+	debug.Log("writing %d items of %v as %v archive to stdout", len(items), sn.ID().Str(), opts.Format)
+
+	return writeArchive(opts.Format, gopts.stdout, items, func(node *restic.Node, w io.Writer) error {
+		return dumpNode(ctx, repo, node, w)
+	})
+}
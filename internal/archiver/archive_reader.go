@@ -9,8 +9,6 @@ import (
 	"github.com/restic/restic/internal/restic"
 
 	"github.com/restic/restic/internal/errors"
-
-	"github.com/restic/chunker"
 )
 
 // Reader allows saving a stream of data to the repository.
@@ -19,6 +17,22 @@ type Reader struct {
 
 	Tags     []string
 	Hostname string
+
+	// Labels and ProgramVersion are stored in the snapshot, Parent is the ID
+	// of the previous snapshot of the same data, if any.
+	Labels         restic.Labels
+	ProgramVersion string
+	Parent         *restic.ID
+
+	// Time is used as the time of the snapshot and the modification time of
+	// the file, the current time is used if it is zero.
+	Time time.Time
+
+	// CheckpointInterval and CheckpointSize configure how often the open
+	// packs are uploaded and the index is saved, zero disables the
+	// respective condition.
+	CheckpointInterval time.Duration
+	CheckpointSize     uint64
 }
 
 // Archive reads data from the reader and saves it to the repo.
@@ -27,21 +41,33 @@ func (r *Reader) Archive(ctx context.Context, name string, rd io.Reader, p *rest
 		return nil, restic.ID{}, errors.New("no filename given")
 	}
 
+	timestamp := r.Time
+	if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
+
 	debug.Log("start archiving %s", name)
-	sn, err := restic.NewSnapshot([]string{name}, r.Tags, r.Hostname, time.Now())
+	sn, err := restic.NewSnapshot([]string{name}, r.Tags, r.Hostname, timestamp)
 	if err != nil {
 		return nil, restic.ID{}, err
 	}
+	sn.Labels = r.Labels
+	sn.ProgramVersion = r.ProgramVersion
+	sn.Parent = r.Parent
 
 	p.Start()
 	defer p.Done()
 
 	repo := r.Repository
-	chnker := chunker.New(rd, repo.Config().ChunkerPolynomial)
+	summary := &restic.SnapshotSummary{BackupStart: time.Now()}
+	uploadedBefore := uploadedBytes(repo)
+	chnker := repo.Config().NewChunker(rd)
 
 	ids := restic.IDs{}
 	var fileSize uint64
 
+	checkpoint := newCheckpointer(repo, r.CheckpointInterval, r.CheckpointSize)
+
 	for {
 		chunk, err := chnker.Next(getBuf())
 		if errors.Cause(err) == io.EOF {
@@ -60,6 +86,15 @@ func (r *Reader) Archive(ctx context.Context, name string, rd io.Reader, p *rest
 				return nil, restic.ID{}, err
 			}
 			debug.Log("saved blob %v (%d bytes)\n", id.Str(), chunk.Length)
+			summary.DataBlobs++
+			summary.DataAdded += uint64(chunk.Length)
+
+			checkpoint.Add(uint64(chunk.Length))
+			if checkpoint.Due() {
+				if err = checkpoint.Checkpoint(ctx); err != nil {
+					return nil, restic.ID{}, err
+				}
+			}
 		} else {
 			debug.Log("blob %v already saved in the repo\n", id.Str())
 		}
@@ -72,12 +107,15 @@ func (r *Reader) Archive(ctx context.Context, name string, rd io.Reader, p *rest
 		fileSize += uint64(chunk.Length)
 	}
 
+	p.Report(restic.Stat{Files: 1})
+
 	tree := &restic.Tree{
 		Nodes: []*restic.Node{
 			{
 				Name:       name,
-				AccessTime: time.Now(),
-				ModTime:    time.Now(),
+				AccessTime: timestamp,
+				ModTime:    timestamp,
+				ChangeTime: timestamp,
 				Type:       "file",
 				Mode:       0644,
 				Size:       fileSize,
@@ -96,22 +134,31 @@ func (r *Reader) Archive(ctx context.Context, name string, rd io.Reader, p *rest
 	sn.Tree = &treeID
 	debug.Log("tree saved as %v", treeID.Str())
 
-	id, err := repo.SaveJSONUnpacked(ctx, restic.SnapshotFile, sn)
+	// the data is saved before the snapshot which references it, and the
+	// summary includes all uploaded packs
+	err = repo.Flush(ctx)
 	if err != nil {
 		return nil, restic.ID{}, err
 	}
 
-	debug.Log("snapshot saved as %v", id.Str())
-
-	err = repo.Flush(ctx)
+	err = repo.SaveIndex(ctx)
 	if err != nil {
 		return nil, restic.ID{}, err
 	}
 
-	err = repo.SaveIndex(ctx)
+	summary.FilesNew = 1
+	summary.TotalFilesProcessed = 1
+	summary.TotalBytesProcessed = fileSize
+	summary.BackupEnd = time.Now()
+	summary.DataTransferred = uploadedBytes(repo) - uploadedBefore
+	sn.Summary = summary
+
+	id, err := repo.SaveJSONUnpacked(ctx, restic.SnapshotFile, sn)
 	if err != nil {
 		return nil, restic.ID{}, err
 	}
 
+	debug.Log("snapshot saved as %v", id.Str())
+
 	return sn, id, nil
 }
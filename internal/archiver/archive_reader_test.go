@@ -7,6 +7,7 @@ import (
 	"io"
 	"math/rand"
 	"testing"
+	"time"
 
 	"github.com/restic/restic/internal/checker"
 	"github.com/restic/restic/internal/repository"
@@ -100,9 +101,47 @@ func TestArchiveReader(t *testing.T) {
 
 	checkSavedFile(t, repo, *sn.Tree, "fakefile", fakeFile(t, seed, size))
 
+	if sn.Summary == nil {
+		t.Fatalf("snapshot has no summary")
+	}
+	if sn.Summary.TotalBytesProcessed != uint64(size) || sn.Summary.DataAdded != uint64(size) {
+		t.Errorf("wrong summary, want %d bytes processed and added: %+v", size, sn.Summary)
+	}
+
 	checker.TestCheckRepo(t, repo)
 }
 
+func TestArchiveReaderTime(t *testing.T) {
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+
+	timestamp := time.Date(2018, 3, 10, 12, 0, 0, 0, time.UTC)
+	r := &Reader{
+		Repository: repo,
+		Hostname:   "dbserver",
+		Time:       timestamp,
+	}
+
+	sn, _, err := r.Archive(context.TODO(), "dump.sql", fakeFile(t, 23, 1024), nil)
+	if err != nil {
+		t.Fatalf("ArchiveReader() returned error %v", err)
+	}
+
+	if !sn.Time.Equal(timestamp) || sn.Hostname != "dbserver" {
+		t.Fatalf("wrong snapshot time or hostname: %v, %v", sn.Time, sn.Hostname)
+	}
+
+	tree, err := repo.LoadTree(context.TODO(), *sn.Tree)
+	if err != nil {
+		t.Fatalf("LoadTree() returned error %v", err)
+	}
+
+	node := tree.Nodes[0]
+	if node.Name != "dump.sql" || node.Size != 1024 || !node.ModTime.Equal(timestamp) {
+		t.Fatalf("wrong node: name %v, size %v, mtime %v", node.Name, node.Size, node.ModTime)
+	}
+}
+
 func TestArchiveReaderNull(t *testing.T) {
 	repo, cleanup := repository.TestRepository(t)
 	defer cleanup()
@@ -176,6 +215,44 @@ func TestArchiveReaderError(t *testing.T) {
 	checker.TestCheckRepo(t, repo)
 }
 
+func TestArchiveReaderCheckpoint(t *testing.T) {
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+
+	r := &Reader{
+		Repository:     repo,
+		Hostname:       "localhost",
+		CheckpointSize: 2 * 1024 * 1024,
+	}
+
+	// the backup is interrupted after 20MiB of data
+	rd := io.MultiReader(fakeFile(t, 23, 20*1024*1024), errReader("interrupted"))
+	_, _, err := r.Archive(context.TODO(), "fakefile", rd, nil)
+	if err == nil {
+		t.Fatal("expected error not returned")
+	}
+
+	// the data saved up to the last checkpoint must be in the index files
+	var blobs uint
+	err = repo.List(context.TODO(), restic.IndexFile, func(id restic.ID, size int64) error {
+		idx, err := repository.LoadIndex(context.TODO(), repo, id)
+		if err != nil {
+			return err
+		}
+		blobs += idx.Count(restic.DataBlob)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if blobs == 0 {
+		t.Fatal("no data blobs found in the saved index files")
+	}
+
+	t.Logf("%d blobs saved in index files", blobs)
+}
+
 func BenchmarkArchiveReader(t *testing.B) {
 	repo, cleanup := repository.TestRepository(t)
 	defer cleanup()
@@ -46,7 +46,81 @@ type Archiver struct {
 	SelectFilter pipe.SelectFunc
 	Excludes     []string
 
+	// Labels and ProgramVersion are stored in the snapshot.
+	Labels         restic.Labels
+	ProgramVersion string
+
 	WithAccessTime bool
+
+	// ChangedFileRetries is the number of times a file which was modified
+	// while it was read is read again.
+	ChangedFileRetries int
+
+	// changedFiles contains the paths of the files which were still modified
+	// while they were read after all retries.
+	changedFiles struct {
+		list []string
+		sync.Mutex
+	}
+
+	// CheckpointInterval and CheckpointSize configure how often the open
+	// packs are uploaded and the index is saved during a backup, so that an
+	// interrupted backup does not need to upload the data again. Zero
+	// disables the respective condition.
+	CheckpointInterval time.Duration
+	CheckpointSize     uint64
+
+	// SkipIfUnchanged prevents saving a new snapshot if it has the same tree,
+	// tags and labels as the parent snapshot.
+	SkipIfUnchanged bool
+
+	// Profile records the time spent reading, chunking and hashing the
+	// files, if set.
+	Profile *restic.Profile
+
+	// ChangeIgnoreFlags selects the metadata which is not considered when
+	// deciding whether a file has changed since the parent snapshot or the
+	// interrupted backup, and needs to be read again.
+	ChangeIgnoreFlags restic.ChangeIgnoreFlags
+
+	// XattrFilter selects the extended attributes which are saved, by
+	// name. All are saved if it is nil.
+	XattrFilter func(name string) bool
+
+	// ExcludeLargerThan skips regular files larger than this many bytes,
+	// zero disables the limit.
+	ExcludeLargerThan uint64
+
+	// largeFiles contains the files which were skipped because of
+	// ExcludeLargerThan, with their sizes.
+	largeFiles struct {
+		m map[string]uint64
+		sync.Mutex
+	}
+
+	// summary collects the statistics of the current backup, which are
+	// stored in the snapshot.
+	summary struct {
+		restic.SnapshotSummary
+		sync.Mutex
+	}
+
+	// ResumeFile is the name of a file in which the files saved so far are
+	// recorded at each checkpoint. When a backup is interrupted, the next
+	// backup uses it to skip files which were already saved. The file is
+	// removed when the snapshot has been saved. Empty disables this.
+	ResumeFile string
+
+	// hardlinks contains the files with more than one hard link which were
+	// saved in this backup, so that the other links to the same inode are
+	// not read again.
+	hardlinks struct {
+		m map[restic.HardlinkKey]*hardlink
+		sync.Mutex
+	}
+
+	checkpoint *checkpointer
+	resume     *resumeState
 }
 
 // New returns a new archiver.
@@ -68,6 +142,8 @@ func New(repo restic.Repository) *Archiver {
 
 	arch.Warn = archiverPrintWarnings
 	arch.SelectFilter = archiverAllowAllFiles
+	arch.CheckpointInterval = DefaultCheckpointInterval
+	arch.CheckpointSize = DefaultCheckpointSize
 
 	return arch
 }
@@ -107,6 +183,11 @@ func (arch *Archiver) Save(ctx context.Context, t restic.BlobType, data []byte,
 		debug.Log("Save(%v, %v): error %v\n", t, id.Str(), err)
 		return err
 	}
+	arch.addBlob(t, len(data))
+
+	if arch.checkpoint != nil {
+		arch.checkpoint.Add(uint64(len(data)))
+	}
 
 	debug.Log("Save(%v, %v): new blob\n", t, id.Str())
 	return nil
@@ -126,7 +207,60 @@ func (arch *Archiver) SaveTreeJSON(ctx context.Context, tree *restic.Tree) (rest
 		return id, nil
 	}
 
-	return arch.repo.SaveBlob(ctx, restic.TreeBlob, data, id)
+	id, err = arch.repo.SaveBlob(ctx, restic.TreeBlob, data, id)
+	if err != nil {
+		return restic.ID{}, err
+	}
+	arch.addBlob(restic.TreeBlob, len(data))
+
+	return id, nil
+}
+
+// addBlob counts a blob of size bytes added to the repository in the summary.
+func (arch *Archiver) addBlob(t restic.BlobType, size int) {
+	arch.summary.Lock()
+	defer arch.summary.Unlock()
+
+	if t == restic.TreeBlob {
+		arch.summary.TreeBlobs++
+	} else {
+		arch.summary.DataBlobs++
+	}
+	arch.summary.DataAdded += uint64(size)
+}
+
+// addFile counts a processed file in the summary. A file with an old node
+// is either unmodified, if its content was taken over, or changed.
+func (arch *Archiver) addFile(node *restic.Node, hasOld, unmodified bool) {
+	arch.summary.Lock()
+	defer arch.summary.Unlock()
+
+	switch {
+	case !hasOld:
+		arch.summary.FilesNew++
+	case unmodified:
+		arch.summary.FilesUnmodified++
+	default:
+		arch.summary.FilesChanged++
+	}
+
+	arch.summary.TotalFilesProcessed++
+	arch.summary.TotalBytesProcessed += node.Size
+}
+
+// uploadCounter is implemented by repositories which count the bytes of the
+// pack files saved in the backend.
+type uploadCounter interface {
+	UploadedBytes() uint64
+}
+
+// uploadedBytes returns the number of bytes saved in the backend by repo, or
+// zero if the repository does not count them.
+func uploadedBytes(repo restic.Repository) uint64 {
+	if uc, ok := repo.(uploadCounter); ok {
+		return uc.UploadedBytes()
+	}
+	return 0
 }
 
 func (arch *Archiver) reloadFileIfChanged(node *restic.Node, file fs.File) (*restic.Node, error) {
@@ -145,7 +279,7 @@ func (arch *Archiver) reloadFileIfChanged(node *restic.Node, file fs.File) (*res
 
 	arch.Warn(node.Path, fi, errors.New("file has changed"))
 
-	node, err = restic.NodeFromFileInfo(node.Path, fi)
+	node, err = arch.nodeFromFileInfo(node.Path, fi)
 	if err != nil {
 		debug.Log("restic.NodeFromFileInfo returned error for %v: %v", node.Path, err)
 		arch.Warn(node.Path, fi, err)
@@ -166,7 +300,10 @@ type saveResult struct {
 func (arch *Archiver) saveChunk(ctx context.Context, chunk chunker.Chunk, p *restic.Progress, token struct{}, file fs.File, resultChannel chan<- saveResult) {
 	defer freeBuf(chunk.Data)
 
+	start := time.Now()
 	id := restic.Hash(chunk.Data)
+	arch.Profile.Since(restic.PhaseHash, start, uint64(chunk.Length))
+
 	err := arch.Save(ctx, restic.DataBlob, chunk.Data, id)
 	// TODO handle error
 	if err != nil {
@@ -216,33 +353,51 @@ func updateNodeContent(node *restic.Node, results []saveResult) error {
 	return nil
 }
 
-// SaveFile stores the content of the file on the backend as a Blob by calling
-// Save for each chunk.
-func (arch *Archiver) SaveFile(ctx context.Context, p *restic.Progress, node *restic.Node) (*restic.Node, error) {
-	file, err := fs.Open(node.Path)
-	if err != nil {
-		return node, errors.Wrap(err, "Open")
-	}
-	defer file.Close()
+// timedReader records the time spent reading from rd.
+type timedReader struct {
+	rd io.Reader
+	d  time.Duration
+	n  uint64
+}
 
-	debug.RunHook("archiver.SaveFile", node.Path)
+func (rd *timedReader) Read(p []byte) (int, error) {
+	start := time.Now()
+	n, err := rd.rd.Read(p)
+	rd.d += time.Since(start)
+	rd.n += uint64(n)
+	return n, err
+}
 
-	node, err = arch.reloadFileIfChanged(node, file)
-	if err != nil {
-		return node, err
+// saveFileContent splits the file into chunks and saves them.
+func (arch *Archiver) saveFileContent(ctx context.Context, p *restic.Progress, file fs.File) ([]saveResult, error) {
+	var rd io.Reader = file
+	var chunkTime time.Duration
+	if arch.Profile != nil {
+		// the chunker reads the file, the time spent reading is subtracted
+		// from the time spent in the chunker
+		trd := &timedReader{rd: file}
+		rd = trd
+		defer func() {
+			arch.Profile.Add(restic.PhaseRead, trd.d, trd.n)
+			arch.Profile.Add(restic.PhaseChunk, chunkTime-trd.d, trd.n)
+		}()
 	}
 
-	chnker := chunker.New(file, arch.repo.Config().ChunkerPolynomial)
+	chnker := arch.repo.Config().NewChunker(rd)
 	resultChannels := [](<-chan saveResult){}
 
 	for {
+		start := time.Now()
 		chunk, err := chnker.Next(getBuf())
+		chunkTime += time.Since(start)
 		if errors.Cause(err) == io.EOF {
 			break
 		}
 
 		if err != nil {
-			return node, errors.Wrap(err, "chunker.Next")
+			// wait for the chunks which are already being saved
+			_, _ = waitForResults(resultChannels)
+			return nil, errors.Wrap(err, "chunker.Next")
 		}
 
 		resCh := make(chan saveResult, 1)
@@ -250,15 +405,210 @@ func (arch *Archiver) SaveFile(ctx context.Context, p *restic.Progress, node *re
 		resultChannels = append(resultChannels, resCh)
 	}
 
-	results, err := waitForResults(resultChannels)
+	return waitForResults(resultChannels)
+}
+
+// fileChanged returns true if the size or modification time of the open file
+// differ from node.
+func fileChanged(node *restic.Node, fi os.FileInfo) bool {
+	return uint64(fi.Size()) != node.Size || !fi.ModTime().Equal(node.ModTime)
+}
+
+// Select returns true if item should be saved, i.e. it is selected by
+// SelectFilter and is not larger than ExcludeLargerThan. Files which are
+// skipped because of their size are recorded and can be queried with
+// LargeFiles, so Select can be passed to Scan as well.
+func (arch *Archiver) Select(item string, fi os.FileInfo) bool {
+	if !arch.SelectFilter(item, fi) {
+		return false
+	}
+
+	if arch.ExcludeLargerThan == 0 || !isRegularFile(fi) || uint64(fi.Size()) <= arch.ExcludeLargerThan {
+		return true
+	}
+
+	debug.Log("path %v excluded, size %d is larger than %d", item, fi.Size(), arch.ExcludeLargerThan)
+
+	arch.largeFiles.Lock()
+	if arch.largeFiles.m == nil {
+		arch.largeFiles.m = make(map[string]uint64)
+	}
+	arch.largeFiles.m[item] = uint64(fi.Size())
+	arch.largeFiles.Unlock()
+
+	return false
+}
+
+// LargeFiles returns the number and the total size of the files which were
+// skipped because they are larger than ExcludeLargerThan.
+func (arch *Archiver) LargeFiles() restic.Stat {
+	arch.largeFiles.Lock()
+	defer arch.largeFiles.Unlock()
+
+	var stat restic.Stat
+	for _, size := range arch.largeFiles.m {
+		stat.Files++
+		stat.Bytes += size
+	}
+
+	return stat
+}
+
+// addChangedFile records that the file at path was modified while it was read.
+func (arch *Archiver) addChangedFile(path string) {
+	arch.changedFiles.Lock()
+	arch.changedFiles.list = append(arch.changedFiles.list, path)
+	arch.changedFiles.Unlock()
+}
+
+// SaveFile stores the content of the file on the backend as a Blob by calling
+// Save for each chunk. If the file is modified while it is read, it is read
+// again up to ChangedFileRetries times. When it still changes, a warning is
+// printed and the file is recorded in the snapshot.
+func (arch *Archiver) SaveFile(ctx context.Context, p *restic.Progress, node *restic.Node) (*restic.Node, error) {
+	file, err := fs.Open(fs.SourcePath(node.Path))
+	if err != nil {
+		return node, errors.Wrap(err, "Open")
+	}
+	defer file.Close()
+
+	debug.RunHook("archiver.SaveFile", node.Path)
+
+	node, err = arch.reloadFileIfChanged(node, file)
 	if err != nil {
 		return node, err
 	}
+
+	var results []saveResult
+	for attempt := 0; ; attempt++ {
+		results, err = arch.saveFileContent(ctx, p, file)
+		if err != nil {
+			return node, err
+		}
+
+		fi, err := file.Stat()
+		if err != nil {
+			return node, errors.Wrap(err, "Stat")
+		}
+
+		if !fileChanged(node, fi) {
+			break
+		}
+
+		if attempt >= arch.ChangedFileRetries {
+			arch.Warn(node.Path, fi, errors.New("file was modified while it was read, the saved content may be inconsistent"))
+			arch.addChangedFile(node.Path)
+
+			// the size must match the content which was saved
+			node.Size = 0
+			for _, res := range results {
+				node.Size += res.bytes
+			}
+			break
+		}
+
+		debug.Log("%v was modified while it was read, reading it again", node.Path)
+
+		if _, err = file.Seek(0, io.SeekStart); err != nil {
+			return node, errors.Wrap(err, "Seek")
+		}
+
+		node, err = arch.nodeFromFileInfo(node.Path, fi)
+		if err != nil {
+			debug.Log("restic.NodeFromFileInfo returned error for %v: %v", node.Path, err)
+			arch.Warn(node.Path, fi, err)
+		}
+
+		if !arch.WithAccessTime {
+			node.AccessTime = node.ModTime
+		}
+	}
+
 	err = updateNodeContent(node, results)
 
 	return node, err
 }
 
+// nodeFromFileInfo returns the node for the item at path, with the extended
+// attributes selected by XattrFilter.
+func (arch *Archiver) nodeFromFileInfo(path string, fi os.FileInfo) (*restic.Node, error) {
+	node, err := restic.NodeFromFileInfo(path, fi)
+	node.FilterExtendedAttributes(arch.XattrFilter)
+	return node, err
+}
+
+// contentComplete returns true if all data blobs of node are available in
+// the repository.
+func (arch *Archiver) contentComplete(node *restic.Node) bool {
+	for _, blob := range node.Content {
+		if !arch.repo.Index().Has(blob, restic.DataBlob) {
+			debug.Log("   %v not using old data, %v is missing", node.Name, blob.Str())
+			return false
+		}
+	}
+
+	return true
+}
+
+// hardlink is a file with more than one hard link which is saved in this
+// backup. done is closed when the file has been saved, node is nil if that
+// failed.
+type hardlink struct {
+	done chan struct{}
+	node *restic.Node
+}
+
+// lookupHardlink returns the node of a file saved before in this backup which
+// is a hard link to the same inode as node. If such a file is being saved
+// right now, it waits until that is done. Otherwise nil is returned, and if
+// owner is true the caller must save the file and pass the result to
+// finishHardlink.
+func (arch *Archiver) lookupHardlink(ctx context.Context, node *restic.Node) (other *restic.Node, owner bool) {
+	if node.Links <= 1 {
+		return nil, false
+	}
+
+	key := restic.HardlinkKey{Inode: node.Inode, Device: node.DeviceID}
+
+	arch.hardlinks.Lock()
+	if arch.hardlinks.m == nil {
+		arch.hardlinks.m = make(map[restic.HardlinkKey]*hardlink)
+	}
+	link, ok := arch.hardlinks.m[key]
+	if !ok {
+		arch.hardlinks.m[key] = &hardlink{done: make(chan struct{})}
+	}
+	arch.hardlinks.Unlock()
+
+	if !ok {
+		return nil, true
+	}
+
+	select {
+	case <-link.done:
+	case <-ctx.Done():
+		return nil, false
+	}
+
+	other = link.node
+	if other == nil || other.Size != node.Size || !other.ModTime.Equal(node.ModTime) {
+		return nil, false
+	}
+
+	return other, false
+}
+
+// finishHardlink records the result of saving node, for which
+// lookupHardlink returned owner. saved is nil if the file could not be saved.
+func (arch *Archiver) finishHardlink(node, saved *restic.Node) {
+	arch.hardlinks.Lock()
+	link := arch.hardlinks.m[restic.HardlinkKey{Inode: node.Inode, Device: node.DeviceID}]
+	arch.hardlinks.Unlock()
+
+	link.node = saved
+	close(link.done)
+}
+
 func (arch *Archiver) fileWorker(ctx context.Context, wg *sync.WaitGroup, p *restic.Progress, entCh <-chan pipe.Entry) {
 	defer func() {
 		debug.Log("done")
@@ -285,7 +635,7 @@ func (arch *Archiver) fileWorker(ctx context.Context, wg *sync.WaitGroup, p *res
 				continue
 			}
 
-			node, err := restic.NodeFromFileInfo(e.Fullpath(), e.Info())
+			node, err := arch.nodeFromFileInfo(e.Fullpath(), e.Info())
 			if err != nil {
 				debug.Log("restic.NodeFromFileInfo returned error for %v: %v", node.Path, err)
 				arch.Warn(e.Fullpath(), e.Info(), err)
@@ -296,32 +646,53 @@ func (arch *Archiver) fileWorker(ctx context.Context, wg *sync.WaitGroup, p *res
 			}
 
 			// try to use old node, if present
+			unmodified := false
 			if e.Node != nil {
 				debug.Log("   %v use old data", e.Path())
 
 				oldNode := e.Node.(*restic.Node)
-				// check if all content is still available in the repository
-				contentMissing := false
-				for _, blob := range oldNode.Content {
-					if !arch.repo.Index().Has(blob, restic.DataBlob) {
-						debug.Log("   %v not using old data, %v is missing", e.Path(), blob.Str())
-						contentMissing = true
-						break
-					}
-				}
-
-				if !contentMissing {
+				if arch.contentComplete(oldNode) {
 					node.Content = oldNode.Content
+					unmodified = true
 					debug.Log("   %v content is complete", e.Path())
 				}
 			} else {
 				debug.Log("   %v no old data", e.Path())
 			}
 
+			// try to use the data saved by an interrupted backup
+			if node.Type == "file" && len(node.Content) == 0 && arch.resume != nil {
+				resumeNode := arch.resume.Lookup(e.Fullpath(), e.Info(), arch.ChangeIgnoreFlags)
+				if resumeNode != nil && arch.contentComplete(resumeNode) {
+					node.Content = resumeNode.Content
+					debug.Log("   %v use data from interrupted backup", e.Path())
+				}
+			}
+
+			// hard links to a file which was already saved share its content
+			linkOwner := false
+			if node.Type == "file" && len(node.Content) == 0 {
+				var other *restic.Node
+				other, linkOwner = arch.lookupHardlink(ctx, node)
+				if other != nil {
+					node.Content = other.Content
+					debug.Log("   %v is a hard link to %v", e.Path(), other.Path)
+				}
+			}
+
 			// otherwise read file normally
 			if node.Type == "file" && len(node.Content) == 0 {
 				debug.Log("   read and save %v", e.Path())
+				p.StartItem(e.Fullpath())
 				node, err = arch.SaveFile(ctx, p, node)
+				p.FinishItem(e.Fullpath())
+				if linkOwner {
+					saved := node
+					if err != nil {
+						saved = nil
+					}
+					arch.finishHardlink(node, saved)
+				}
 				if err != nil {
 					fmt.Fprintf(os.Stderr, "error for %v: %v\n", node.Path, err)
 					arch.Warn(e.Path(), nil, err)
@@ -330,11 +701,19 @@ func (arch *Archiver) fileWorker(ctx context.Context, wg *sync.WaitGroup, p *res
 					p.Report(restic.Stat{Errors: 1})
 					continue
 				}
+
+				if arch.resume != nil {
+					arch.resume.Add(e.Fullpath(), node)
+				}
 			} else {
 				// report old data size
 				p.Report(restic.Stat{Bytes: node.Size})
 			}
 
+			if node.Type == "file" {
+				arch.addFile(node, e.Node != nil || e.Changed, unmodified)
+			}
+
 			debug.Log("   processed %v, %d blobs", e.Path(), len(node.Content))
 			e.Result() <- node
 			p.Report(restic.Stat{Files: 1})
@@ -418,7 +797,7 @@ func (arch *Archiver) dirWorker(ctx context.Context, wg *sync.WaitGroup, p *rest
 			node := &restic.Node{}
 
 			if dir.Path() != "" && dir.Info() != nil {
-				n, err := restic.NodeFromFileInfo(dir.Fullpath(), dir.Info())
+				n, err := arch.nodeFromFileInfo(dir.Fullpath(), dir.Info())
 				if err != nil {
 					arch.Warn(dir.Path(), dir.Info(), err)
 				}
@@ -460,6 +839,10 @@ func (arch *Archiver) dirWorker(ctx context.Context, wg *sync.WaitGroup, p *rest
 type archivePipe struct {
 	Old <-chan walk.TreeJob
 	New <-chan pipe.Job
+
+	// ignore selects the metadata which is not considered when deciding
+	// whether a file has changed since the parent snapshot.
+	ignore restic.ChangeIgnoreFlags
 }
 
 func copyJobs(ctx context.Context, in <-chan pipe.Job, out chan<- pipe.Job) {
@@ -495,6 +878,7 @@ type archiveJob struct {
 	hasOld bool
 	old    walk.TreeJob
 	new    pipe.Job
+	ignore restic.ChangeIgnoreFlags
 }
 
 func (a *archivePipe) compare(ctx context.Context, out chan<- pipe.Job) {
@@ -555,7 +939,7 @@ func (a *archivePipe) compare(ctx context.Context, out chan<- pipe.Job) {
 			debug.Log("    same filename %q", file1)
 
 			// send job
-			out <- archiveJob{hasOld: true, old: oldJob, new: newJob}.Copy()
+			out <- archiveJob{hasOld: true, old: oldJob, new: newJob, ignore: a.ignore}.Copy()
 			loadOld = true
 			loadNew = true
 			continue
@@ -601,9 +985,11 @@ func (j archiveJob) Copy() pipe.Job {
 		}
 
 		// if file is newer, return the new job
-		if j.old.Node.IsNewer(j.new.Fullpath(), j.new.Info()) {
+		if j.old.Node.IsNewerIgnoring(j.new.Fullpath(), j.new.Info(), j.ignore) {
 			debug.Log("   job %v is newer", j.new.Path())
-			return j.new
+			e := j.new.(pipe.Entry)
+			e.Changed = true
+			return e
 		}
 
 		debug.Log("   job %v add old data", j.new.Path())
@@ -619,17 +1005,28 @@ func (j archiveJob) Copy() pipe.Job {
 
 const saveIndexTime = 30 * time.Second
 
-// saveIndexes regularly queries the master index for full indexes and saves them.
-func (arch *Archiver) saveIndexes(ctx context.Context, wg *sync.WaitGroup) {
+// checkpointCheckTime is the interval in which the checkpoint conditions are
+// checked.
+const checkpointCheckTime = time.Second
+
+// saveIndexes regularly queries the master index for full indexes and saves
+// them until done is closed. When a checkpoint is due, all open packs are
+// uploaded and the complete index is saved.
+func (arch *Archiver) saveIndexes(ctx context.Context, done <-chan struct{}, wg *sync.WaitGroup) {
 	defer wg.Done()
 
 	ticker := time.NewTicker(saveIndexTime)
 	defer ticker.Stop()
 
+	checkpointTicker := time.NewTicker(checkpointCheckTime)
+	defer checkpointTicker.Stop()
+
 	for {
 		select {
 		case <-ctx.Done():
 			return
+		case <-done:
+			return
 		case <-ticker.C:
 			debug.Log("saving full indexes")
 			err := arch.repo.SaveFullIndex(ctx)
@@ -637,6 +1034,25 @@ func (arch *Archiver) saveIndexes(ctx context.Context, wg *sync.WaitGroup) {
 				debug.Log("save indexes returned an error: %v", err)
 				fmt.Fprintf(os.Stderr, "error saving preliminary index: %v\n", err)
 			}
+		case <-checkpointTicker.C:
+			if arch.checkpoint == nil || !arch.checkpoint.Due() {
+				continue
+			}
+
+			err := arch.checkpoint.Checkpoint(ctx)
+			if err != nil {
+				debug.Log("checkpoint returned an error: %v", err)
+				fmt.Fprintf(os.Stderr, "error saving checkpoint: %v\n", err)
+				continue
+			}
+
+			if arch.resume != nil {
+				err = arch.resume.Save(arch.ResumeFile)
+				if err != nil {
+					debug.Log("saving the resume file returned an error: %v", err)
+					fmt.Fprintf(os.Stderr, "error saving resume file: %v\n", err)
+				}
+			}
 		}
 	}
 }
@@ -668,8 +1084,9 @@ func (p baseNameSlice) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
 
 // Snapshot creates a snapshot of the given paths. If parentrestic.ID is set, this is
 // used to compare the files to the ones archived at the time this snapshot was
-// taken.
-func (arch *Archiver) Snapshot(ctx context.Context, p *restic.Progress, paths, tags []string, hostname string, parentID *restic.ID, time time.Time) (*restic.Snapshot, restic.ID, error) {
+// taken. If SkipIfUnchanged is set and nothing has changed, the parent snapshot
+// and its ID are returned and no new snapshot is saved.
+func (arch *Archiver) Snapshot(ctx context.Context, p *restic.Progress, paths, tags []string, hostname string, parentID *restic.ID, timestamp time.Time) (*restic.Snapshot, restic.ID, error) {
 	paths = unique(paths)
 	sort.Sort(baseNameSlice(paths))
 
@@ -684,20 +1101,27 @@ func (arch *Archiver) Snapshot(ctx context.Context, p *restic.Progress, paths, t
 	defer p.Done()
 
 	// create new snapshot
-	sn, err := restic.NewSnapshot(paths, tags, hostname, time)
+	sn, err := restic.NewSnapshot(paths, tags, hostname, timestamp)
 	if err != nil {
 		return nil, restic.ID{}, err
 	}
 	sn.Excludes = arch.Excludes
+	sn.Labels = arch.Labels
+	sn.ProgramVersion = arch.ProgramVersion
+	arch.changedFiles.list = nil
 
-	jobs := archivePipe{}
+	arch.summary.SnapshotSummary = restic.SnapshotSummary{BackupStart: time.Now()}
+	uploadedBefore := uploadedBytes(arch.repo)
+
+	jobs := archivePipe{ignore: arch.ChangeIgnoreFlags}
 
 	// use parent snapshot (if some was given)
+	var parent *restic.Snapshot
 	if parentID != nil {
 		sn.Parent = parentID
 
 		// load parent snapshot
-		parent, err := restic.LoadSnapshot(ctx, arch.repo, *parentID)
+		parent, err = restic.LoadSnapshot(ctx, arch.repo, *parentID)
 		if err != nil {
 			return nil, restic.ID{}, err
 		}
@@ -717,7 +1141,7 @@ func (arch *Archiver) Snapshot(ctx context.Context, p *restic.Progress, paths, t
 	pipeCh := make(chan pipe.Job)
 	resCh := make(chan pipe.Result, 1)
 	go func() {
-		pipe.Walk(ctx, paths, arch.SelectFilter, pipeCh, resCh)
+		pipe.Walk(ctx, paths, arch.Select, pipeCh, resCh)
 		debug.Log("pipe.Walk done")
 	}()
 	jobs.New = pipeCh
@@ -739,7 +1163,20 @@ func (arch *Archiver) Snapshot(ctx context.Context, p *restic.Progress, paths, t
 		wg.Done()
 	}()
 
+	arch.resume = nil
+	if arch.ResumeFile != "" {
+		arch.resume, err = loadResumeState(arch.ResumeFile)
+		if err != nil {
+			return nil, restic.ID{}, err
+		}
+
+		if arch.resume.Len() > 0 {
+			debug.Log("resuming interrupted backup, %d files already saved", arch.resume.Len())
+		}
+	}
+
 	// run workers
+	arch.checkpoint = newCheckpointer(arch.repo, arch.CheckpointInterval, arch.CheckpointSize)
 	for i := 0; i < maxConcurrency; i++ {
 		wg.Add(2)
 		go arch.fileWorker(ctx, &wg, p, entCh)
@@ -748,16 +1185,16 @@ func (arch *Archiver) Snapshot(ctx context.Context, p *restic.Progress, paths, t
 
 	// run index saver
 	var wgIndexSaver sync.WaitGroup
-	indexCtx, indexCancel := context.WithCancel(ctx)
+	indexDone := make(chan struct{})
 	wgIndexSaver.Add(1)
-	go arch.saveIndexes(indexCtx, &wgIndexSaver)
+	go arch.saveIndexes(ctx, indexDone, &wgIndexSaver)
 
 	// wait for all workers to terminate
 	debug.Log("wait for workers")
 	wg.Wait()
 
 	// stop index saver
-	indexCancel()
+	close(indexDone)
 	wgIndexSaver.Wait()
 
 	debug.Log("workers terminated")
@@ -773,6 +1210,11 @@ func (arch *Archiver) Snapshot(ctx context.Context, p *restic.Progress, paths, t
 	debug.Log("root node received: %v", root.Subtree.Str())
 	sn.Tree = root.Subtree
 
+	if len(arch.changedFiles.list) > 0 {
+		sn.ChangedFiles = arch.changedFiles.list
+		sort.Strings(sn.ChangedFiles)
+	}
+
 	// load top-level tree again to see if it is empty
 	toptree, err := arch.repo.LoadTree(ctx, *root.Subtree)
 	if err != nil {
@@ -792,6 +1234,17 @@ func (arch *Archiver) Snapshot(ctx context.Context, p *restic.Progress, paths, t
 
 	debug.Log("saved indexes")
 
+	if arch.SkipIfUnchanged && parent != nil && unchanged(parent, sn) {
+		debug.Log("snapshot is unchanged, returning parent %v", parentID.Str())
+		arch.removeResumeFile()
+		return parent, *parentID, nil
+	}
+
+	summary := arch.summary.SnapshotSummary
+	summary.BackupEnd = time.Now()
+	summary.DataTransferred = uploadedBytes(arch.repo) - uploadedBefore
+	sn.Summary = &summary
+
 	// save snapshot
 	id, err := arch.repo.SaveJSONUnpacked(ctx, restic.SnapshotFile, sn)
 	if err != nil {
@@ -799,10 +1252,40 @@ func (arch *Archiver) Snapshot(ctx context.Context, p *restic.Progress, paths, t
 	}
 
 	debug.Log("saved snapshot %v", id.Str())
+	arch.removeResumeFile()
 
 	return sn, id, nil
 }
 
+// removeResumeFile removes the resume file after the snapshot is complete.
+func (arch *Archiver) removeResumeFile() {
+	if arch.ResumeFile == "" {
+		return
+	}
+
+	err := fs.RemoveIfExists(arch.ResumeFile)
+	if err != nil {
+		debug.Log("unable to remove resume file %v: %v", arch.ResumeFile, err)
+	}
+}
+
+// unchanged returns true if sn has the same tree, tags and labels as parent.
+func unchanged(parent, sn *restic.Snapshot) bool {
+	if parent.Tree == nil || sn.Tree == nil || !parent.Tree.Equal(*sn.Tree) {
+		return false
+	}
+
+	if len(parent.Labels) != len(sn.Labels) || !sn.HasLabels(parent.Labels) {
+		return false
+	}
+
+	if len(parent.Tags) != len(sn.Tags) {
+		return false
+	}
+
+	return parent.HasTags(sn.Tags) && sn.HasTags(parent.Tags)
+}
+
 func isRegularFile(fi os.FileInfo) bool {
 	if fi == nil {
 		return false
@@ -2,10 +2,16 @@ package archiver
 
 import (
 	"context"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/restic/restic/internal/pipe"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
 	"github.com/restic/restic/internal/walk"
 )
 
@@ -143,3 +149,100 @@ func TestArchivePipe(t *testing.T) {
 		i++
 	}
 }
+
+func TestSaveFileChanged(t *testing.T) {
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+
+	tempdir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+
+	filename := filepath.Join(tempdir, "file")
+	data := rtest.Random(23, 300*1024)
+	rtest.OK(t, ioutil.WriteFile(filename, data, 0600))
+
+	var tests = []struct {
+		retries  int
+		changed  bool
+		warnings int
+	}{
+		{0, true, 1},
+		{1, false, 0},
+	}
+
+	for _, test := range tests {
+		t.Run("", func(t *testing.T) {
+			fi, err := os.Lstat(filename)
+			rtest.OK(t, err)
+
+			node, err := restic.NodeFromFileInfo(filename, fi)
+			rtest.OK(t, err)
+
+			// the file is appended to while it is read, so the size
+			// recorded before reading it does not match any more
+			node.Size -= 100
+
+			arch := New(repo)
+			arch.ChangedFileRetries = test.retries
+
+			warnings := 0
+			arch.Warn = func(dir string, fi os.FileInfo, err error) {
+				t.Logf("warning for %v: %v", dir, err)
+				warnings++
+			}
+
+			node, err = arch.SaveFile(context.TODO(), nil, node)
+			rtest.OK(t, err)
+
+			rtest.Equals(t, test.warnings, warnings)
+			rtest.Equals(t, test.changed, len(arch.changedFiles.list) > 0)
+			rtest.Equals(t, uint64(len(data)), node.Size)
+			rtest.Assert(t, len(node.Content) > 0, "no content saved for %v", filename)
+		})
+	}
+}
+
+func TestSnapshotResume(t *testing.T) {
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+
+	tempdir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+
+	filename := filepath.Join(tempdir, "file")
+	rtest.OK(t, ioutil.WriteFile(filename, rtest.Random(23, 1024), 0600))
+
+	fi, err := os.Lstat(filename)
+	rtest.OK(t, err)
+
+	node, err := restic.NodeFromFileInfo(filename, fi)
+	rtest.OK(t, err)
+
+	// record a different blob as the content of the file, so the test can
+	// detect whether the file was read again
+	id, err := repo.SaveBlob(context.TODO(), restic.DataBlob, []byte("saved by an interrupted backup"), restic.ID{})
+	rtest.OK(t, err)
+	rtest.OK(t, repo.Flush(context.TODO()))
+	node.Content = restic.IDs{id}
+
+	resumeFile := filepath.Join(tempdir, "resume", "state")
+	state, err := loadResumeState(resumeFile)
+	rtest.OK(t, err)
+	rtest.Equals(t, 0, state.Len())
+
+	state.Add(filename, node)
+	rtest.OK(t, state.Save(resumeFile))
+
+	arch := New(repo)
+	arch.ResumeFile = resumeFile
+	sn, _, err := arch.Snapshot(context.TODO(), nil, []string{filename}, nil, "localhost", nil, time.Now())
+	rtest.OK(t, err)
+
+	tree, err := repo.LoadTree(context.TODO(), *sn.Tree)
+	rtest.OK(t, err)
+	rtest.Equals(t, 1, len(tree.Nodes))
+	rtest.Equals(t, restic.IDs{id}, tree.Nodes[0].Content)
+
+	_, err = os.Stat(resumeFile)
+	rtest.Assert(t, os.IsNotExist(err), "resume file was not removed after the snapshot was saved: %v", err)
+}
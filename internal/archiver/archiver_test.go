@@ -7,6 +7,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"runtime"
 	"testing"
 	"time"
 
@@ -369,3 +370,125 @@ func TestArchiveNameCollision(t *testing.T) {
 		t.Fatalf("tree has %d nodes, wanted 2: %v", len(tree.Nodes), tree.Nodes)
 	}
 }
+
+func TestArchiveExcludeLargerThan(t *testing.T) {
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+
+	dir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+
+	rtest.OK(t, ioutil.WriteFile(filepath.Join(dir, "small"), []byte("small"), 0644))
+	rtest.OK(t, ioutil.WriteFile(filepath.Join(dir, "large"), bytes.Repeat([]byte("x"), 2048), 0644))
+
+	defer chdir(t, dir)()
+
+	arch := archiver.New(repo)
+	arch.ExcludeLargerThan = 1024
+
+	stat, err := archiver.Scan([]string{"small", "large"}, arch.Select, nil)
+	rtest.OK(t, err)
+	rtest.Equals(t, uint64(1), stat.Files)
+
+	sn, _, err := arch.Snapshot(context.TODO(), nil, []string{"small", "large"}, nil, "localhost", nil, time.Now())
+	rtest.OK(t, err)
+
+	tree, err := repo.LoadTree(context.TODO(), *sn.Tree)
+	rtest.OK(t, err)
+
+	if len(tree.Nodes) != 1 || tree.Nodes[0].Name != "small" {
+		t.Fatalf("wrong nodes in tree, want only small: %v", tree.Nodes)
+	}
+
+	// the file skipped by Scan and Snapshot is only counted once
+	rtest.Equals(t, restic.Stat{Files: 1, Bytes: 2048}, arch.LargeFiles())
+}
+
+func TestArchiveHardlinks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hard links are not recorded on windows")
+	}
+
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+
+	dir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+
+	data := bytes.Repeat([]byte("hardlink"), 1024)
+	rtest.OK(t, ioutil.WriteFile(filepath.Join(dir, "file1"), data, 0644))
+	rtest.OK(t, os.Link(filepath.Join(dir, "file1"), filepath.Join(dir, "file2")))
+	rtest.OK(t, os.Link(filepath.Join(dir, "file1"), filepath.Join(dir, "file3")))
+
+	defer chdir(t, dir)()
+
+	arch := archiver.New(repo)
+	arch.Profile = restic.NewProfile()
+
+	sn, _, err := arch.Snapshot(context.TODO(), nil, []string{"file1", "file2", "file3"}, nil, "localhost", nil, time.Now())
+	rtest.OK(t, err)
+
+	tree, err := repo.LoadTree(context.TODO(), *sn.Tree)
+	rtest.OK(t, err)
+	rtest.Equals(t, 3, len(tree.Nodes))
+
+	for _, node := range tree.Nodes {
+		rtest.Equals(t, uint64(3), node.Links)
+		rtest.Equals(t, tree.Nodes[0].Inode, node.Inode)
+		rtest.Equals(t, tree.Nodes[0].Content, node.Content)
+	}
+
+	// the content is only read once
+	for _, phase := range arch.Profile.Phases() {
+		if phase.Phase == restic.PhaseRead {
+			rtest.Equals(t, uint64(len(data)), phase.Bytes)
+		}
+	}
+}
+
+func TestArchiveSummary(t *testing.T) {
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+
+	dir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+
+	rtest.OK(t, ioutil.WriteFile(filepath.Join(dir, "unchanged"), []byte("unchanged"), 0644))
+	rtest.OK(t, ioutil.WriteFile(filepath.Join(dir, "changed"), []byte("changed"), 0644))
+
+	defer chdir(t, dir)()
+
+	arch := archiver.New(repo)
+	sn, parentID, err := arch.Snapshot(context.TODO(), nil, []string{"."}, nil, "localhost", nil, time.Now())
+	rtest.OK(t, err)
+
+	rtest.Assert(t, sn.Summary != nil, "snapshot has no summary")
+	rtest.Equals(t, uint64(2), sn.Summary.FilesNew)
+	rtest.Equals(t, uint64(2), sn.Summary.DataBlobs)
+	rtest.Assert(t, sn.Summary.TreeBlobs > 0, "no trees counted")
+	rtest.Assert(t, sn.Summary.DataTransferred > sn.Summary.DataAdded,
+		"transferred %d bytes, less than the %d bytes added", sn.Summary.DataTransferred, sn.Summary.DataAdded)
+
+	rtest.OK(t, ioutil.WriteFile(filepath.Join(dir, "changed"), []byte("changed again"), 0644))
+	mtime := time.Now().Add(time.Hour)
+	rtest.OK(t, os.Chtimes(filepath.Join(dir, "changed"), mtime, mtime))
+	rtest.OK(t, ioutil.WriteFile(filepath.Join(dir, "new"), []byte("new"), 0644))
+
+	arch = archiver.New(repo)
+	_, id, err := arch.Snapshot(context.TODO(), nil, []string{"."}, nil, "localhost", &parentID, time.Now())
+	rtest.OK(t, err)
+
+	// the summary is saved in the snapshot
+	sn, err = restic.LoadSnapshot(context.TODO(), repo, id)
+	rtest.OK(t, err)
+
+	s := sn.Summary
+	rtest.Assert(t, s != nil, "loaded snapshot has no summary")
+	rtest.Equals(t, uint64(1), s.FilesNew)
+	rtest.Equals(t, uint64(1), s.FilesChanged)
+	rtest.Equals(t, uint64(1), s.FilesUnmodified)
+	rtest.Equals(t, uint64(3), s.TotalFilesProcessed)
+	rtest.Equals(t, uint64(len("unchanged")+len("changed again")+len("new")), s.TotalBytesProcessed)
+	rtest.Equals(t, uint64(2), s.DataBlobs)
+	rtest.Assert(t, !s.BackupEnd.Before(s.BackupStart), "backup ends before it started: %v", s)
+}
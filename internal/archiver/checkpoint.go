@@ -0,0 +1,76 @@
+package archiver
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/restic"
+)
+
+// Defaults for the checkpoints during a backup.
+const (
+	DefaultCheckpointInterval = 5 * time.Minute
+	DefaultCheckpointSize     = 1 << 30
+)
+
+// checkpointer regularly uploads all open packs and saves the index during a
+// backup. When the backup is interrupted, the data saved up to the last
+// checkpoint is known to the repository and is reused by the next backup.
+type checkpointer struct {
+	repo restic.Repository
+
+	// interval and size are the time and the amount of new data after which
+	// a checkpoint is made, zero disables the respective condition
+	interval time.Duration
+	size     uint64
+
+	m     sync.Mutex
+	last  time.Time
+	bytes uint64
+}
+
+func newCheckpointer(repo restic.Repository, interval time.Duration, size uint64) *checkpointer {
+	return &checkpointer{
+		repo:     repo,
+		interval: interval,
+		size:     size,
+		last:     time.Now(),
+	}
+}
+
+// Add records that n bytes of new data have been saved.
+func (c *checkpointer) Add(n uint64) {
+	c.m.Lock()
+	c.bytes += n
+	c.m.Unlock()
+}
+
+// Due returns true if a checkpoint should be made.
+func (c *checkpointer) Due() bool {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	if c.size > 0 && c.bytes >= c.size {
+		return true
+	}
+
+	return c.interval > 0 && time.Since(c.last) >= c.interval
+}
+
+// Checkpoint uploads all open packs and saves the index.
+func (c *checkpointer) Checkpoint(ctx context.Context) error {
+	c.m.Lock()
+	debug.Log("checkpoint after %v, %d new bytes", time.Since(c.last), c.bytes)
+	c.last = time.Now()
+	c.bytes = 0
+	c.m.Unlock()
+
+	err := c.repo.Flush(ctx)
+	if err != nil {
+		return err
+	}
+
+	return c.repo.SaveIndex(ctx)
+}
@@ -0,0 +1,117 @@
+package archiver
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/restic"
+)
+
+// resumeState records the files saved by a backup, it is written to a file at
+// each checkpoint. When the backup is interrupted, the next backup of the same
+// paths uses it to find the content of files which have not been modified
+// since, without reading them again.
+type resumeState struct {
+	m     sync.Mutex
+	nodes map[string]*restic.Node
+}
+
+// loadResumeState reads the state from filename. A missing file results in an
+// empty state.
+func loadResumeState(filename string) (*resumeState, error) {
+	s := &resumeState{nodes: make(map[string]*restic.Node)}
+
+	buf, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(errors.Cause(err)) {
+		return s, nil
+	}
+
+	if err != nil {
+		return nil, errors.Wrap(err, "ReadFile")
+	}
+
+	err = json.Unmarshal(buf, &s.nodes)
+	if err != nil {
+		return nil, errors.Wrap(err, "Unmarshal")
+	}
+
+	debug.Log("loaded %d nodes from %v", len(s.nodes), filename)
+	return s, nil
+}
+
+// Len returns the number of files in the state.
+func (s *resumeState) Len() int {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	return len(s.nodes)
+}
+
+// Add records that the file at path was saved as node.
+func (s *resumeState) Add(path string, node *restic.Node) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	s.nodes[path] = node
+}
+
+// Lookup returns the node for the file at path, if the file has not been
+// modified since it was saved. The metadata selected by ignore is not
+// considered.
+func (s *resumeState) Lookup(path string, fi os.FileInfo, ignore restic.ChangeIgnoreFlags) *restic.Node {
+	s.m.Lock()
+	node, ok := s.nodes[path]
+	s.m.Unlock()
+
+	if !ok || node.IsNewerIgnoring(path, fi, ignore) {
+		return nil
+	}
+
+	return node
+}
+
+// Save writes the state to filename. The file is replaced atomically, so an
+// interruption never leaves a partially written file.
+func (s *resumeState) Save(filename string) error {
+	s.m.Lock()
+	buf, err := json.Marshal(s.nodes)
+	s.m.Unlock()
+
+	if err != nil {
+		return errors.Wrap(err, "Marshal")
+	}
+
+	dir := filepath.Dir(filename)
+	if err = fs.MkdirAll(dir, 0700); err != nil {
+		return errors.Wrap(err, "MkdirAll")
+	}
+
+	f, err := ioutil.TempFile(dir, "tmp-")
+	if err != nil {
+		return errors.Wrap(err, "TempFile")
+	}
+
+	_, err = f.Write(buf)
+	if err == nil {
+		err = f.Close()
+	} else {
+		_ = f.Close()
+	}
+
+	if err == nil {
+		err = fs.Rename(f.Name(), filename)
+	}
+
+	if err != nil {
+		_ = fs.Remove(f.Name())
+		return errors.Wrap(err, "save resume file")
+	}
+
+	return nil
+}
@@ -0,0 +1,96 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/restic"
+)
+
+// AppendOnlyError is returned by AppendOnlyBackend when a file which is
+// protected would be removed or overwritten.
+type AppendOnlyError struct {
+	Op     string
+	Handle restic.Handle
+}
+
+func (e *AppendOnlyError) Error() string {
+	if e.Handle == (restic.Handle{}) {
+		return fmt.Sprintf("%v refused, the repository is append-only", e.Op)
+	}
+	return fmt.Sprintf("%v(%v) refused, the repository is append-only", e.Op, e.Handle)
+}
+
+// IsAppendOnly returns true if err was returned because the repository is
+// append-only.
+func IsAppendOnly(err error) bool {
+	_, ok := err.(*AppendOnlyError)
+	return ok
+}
+
+// AppendOnlyBackend refuses to remove or overwrite the files which hold the
+// history of a repository: the data files, snapshots, keys and the config.
+// Index and lock files can still be removed. This guards against deleting
+// data by accident, it cannot stop a client which does not use it.
+type AppendOnlyBackend struct {
+	restic.Backend
+}
+
+// statically ensure that AppendOnlyBackend implements restic.Backend.
+var _ restic.Backend = &AppendOnlyBackend{}
+
+// NewAppendOnlyBackend wraps be so that protected files can only be added.
+func NewAppendOnlyBackend(be restic.Backend) *AppendOnlyBackend {
+	return &AppendOnlyBackend{Backend: be}
+}
+
+// protected returns true if files of type t must not be removed or
+// overwritten.
+func protected(t restic.FileType) bool {
+	switch t {
+	case restic.DataFile, restic.SnapshotFile, restic.KeyFile, restic.ConfigFile:
+		return true
+	}
+	return false
+}
+
+// Save stores the data, protected files must not exist yet. This is checked
+// before the file is saved, so a file which is saved concurrently by another
+// client can still be overwritten.
+func (be *AppendOnlyBackend) Save(ctx context.Context, h restic.Handle, rd restic.RewindReader) error {
+	if protected(h.Type) {
+		exists, err := be.Backend.Test(ctx, h)
+		if err != nil {
+			return err
+		}
+
+		if exists {
+			debug.Log("refusing to overwrite %v", h)
+			return &AppendOnlyError{Op: "Save", Handle: h}
+		}
+	}
+
+	return be.Backend.Save(ctx, h, rd)
+}
+
+// Remove removes the file, unless it is protected.
+func (be *AppendOnlyBackend) Remove(ctx context.Context, h restic.Handle) error {
+	if protected(h.Type) {
+		debug.Log("refusing to remove %v", h)
+		return &AppendOnlyError{Op: "Remove", Handle: h}
+	}
+
+	return be.Backend.Remove(ctx, h)
+}
+
+// IsPermanentError returns true for errors returned because the repository
+// is append-only.
+func (be *AppendOnlyBackend) IsPermanentError(err error) bool {
+	return IsAppendOnly(err) || be.Backend.IsPermanentError(err)
+}
+
+// Delete refuses to remove all data in the backend.
+func (be *AppendOnlyBackend) Delete(ctx context.Context) error {
+	return &AppendOnlyError{Op: "Delete"}
+}
@@ -0,0 +1,53 @@
+package backend
+
+import (
+	"context"
+	"testing"
+
+	"github.com/restic/restic/internal/mock"
+	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/test"
+)
+
+func TestAppendOnlyBackend(t *testing.T) {
+	files := make(map[restic.Handle]bool)
+	be := NewAppendOnlyBackend(&mock.Backend{
+		SaveFn: func(ctx context.Context, h restic.Handle, rd restic.RewindReader) error {
+			files[h] = true
+			return nil
+		},
+		TestFn: func(ctx context.Context, h restic.Handle) (bool, error) {
+			return files[h], nil
+		},
+		RemoveFn: func(ctx context.Context, h restic.Handle) error {
+			delete(files, h)
+			return nil
+		},
+		IsPermanentErrorFn: func(err error) bool {
+			return false
+		},
+	})
+
+	ctx := context.TODO()
+	for _, tpe := range []restic.FileType{restic.DataFile, restic.SnapshotFile, restic.KeyFile, restic.IndexFile, restic.LockFile} {
+		h := restic.Handle{Type: tpe, Name: restic.NewRandomID().String()}
+		test.OK(t, be.Save(ctx, h, restic.NewByteReader([]byte("foo"))))
+
+		if protected(tpe) {
+			err := be.Save(ctx, h, restic.NewByteReader([]byte("bar")))
+			test.Assert(t, IsAppendOnly(err), "overwriting %v: expected append-only error, got %v", h, err)
+
+			err = be.Remove(ctx, h)
+			test.Assert(t, IsAppendOnly(err), "removing %v: expected append-only error, got %v", h, err)
+			test.Assert(t, be.IsPermanentError(err), "append-only error is not permanent")
+			test.Assert(t, files[h], "%v was removed", h)
+			continue
+		}
+
+		test.OK(t, be.Save(ctx, h, restic.NewByteReader([]byte("bar"))))
+		test.OK(t, be.Remove(ctx, h))
+		test.Assert(t, !files[h], "%v was not removed", h)
+	}
+
+	test.Assert(t, IsAppendOnly(be.Delete(ctx)), "Delete was not refused")
+}
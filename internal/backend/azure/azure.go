@@ -99,6 +99,23 @@ func (be *Backend) IsNotExist(err error) bool {
 	return os.IsNotExist(err)
 }
 
+// IsPermanentError returns true if the error cannot be resolved by retrying,
+// e.g. because the file does not exist or the credentials are invalid.
+func (be *Backend) IsPermanentError(err error) bool {
+	if be.IsNotExist(err) {
+		return true
+	}
+
+	if e, ok := errors.Cause(err).(storage.AzureStorageServiceError); ok {
+		switch e.StatusCode {
+		case http.StatusNotFound, http.StatusUnauthorized, http.StatusForbidden:
+			return true
+		}
+	}
+
+	return false
+}
+
 // Join combines path components with slashes.
 func (be *Backend) Join(p ...string) string {
 	return path.Join(p...)
@@ -114,9 +131,11 @@ func (be *Backend) Path() string {
 	return be.prefix
 }
 
-// preventCloser wraps an io.Reader to run a function instead of the original Close() function.
+// preventCloser wraps a restic.RewindReader to run a function instead of the
+// original Close() function. It also reports the length of the data, so that
+// the azure library does not buffer the whole reader in memory.
 type preventCloser struct {
-	io.Reader
+	restic.RewindReader
 	f func()
 }
 
@@ -125,8 +144,12 @@ func (wr preventCloser) Close() error {
 	return nil
 }
 
+func (wr preventCloser) Len() int {
+	return int(wr.Length())
+}
+
 // Save stores data in the backend at the handle.
-func (be *Backend) Save(ctx context.Context, h restic.Handle, rd io.Reader) (err error) {
+func (be *Backend) Save(ctx context.Context, h restic.Handle, rd restic.RewindReader) (err error) {
 	if err := h.Valid(); err != nil {
 		return err
 	}
@@ -149,8 +172,8 @@ func (be *Backend) Save(ctx context.Context, h restic.Handle, rd io.Reader) (err
 
 	// wrap the reader so that net/http client cannot close the reader, return
 	// the token instead.
-	rd = preventCloser{
-		Reader: rd,
+	dataReader := preventCloser{
+		RewindReader: rd,
 		f: func() {
 			debug.Log("Close()")
 		},
@@ -158,7 +181,7 @@ func (be *Backend) Save(ctx context.Context, h restic.Handle, rd io.Reader) (err
 
 	debug.Log("InsertObject(%v, %v)", be.container.Name, objName)
 
-	err = be.container.GetBlobReference(objName).CreateBlockBlobFromReader(rd, nil)
+	err = be.container.GetBlobReference(objName).CreateBlockBlobFromReader(dataReader, nil)
 
 	be.sem.ReleaseToken()
 	debug.Log("%v, err %#v", objName, err)
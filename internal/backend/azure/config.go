@@ -3,6 +3,7 @@ package azure
 import (
 	"path"
 	"strings"
+	"time"
 
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/options"
@@ -16,13 +17,15 @@ type Config struct {
 	Container   string
 	Prefix      string
 
-	Connections uint `option:"connections" help:"set a limit for the number of concurrent connections (default: 20)"`
+	Connections uint          `option:"connections" help:"set a limit for the number of concurrent connections (default: 20)"`
+	Timeout     time.Duration `option:"timeout" help:"abort and retry requests which make no progress for the duration (default: 5m, 0 disables)"`
 }
 
 // NewConfig returns a new Config with the default values filled in.
 func NewConfig() Config {
 	return Config{
 		Connections: 5,
+		Timeout:     5 * time.Minute,
 	}
 }
 
@@ -1,6 +1,9 @@
 package azure
 
-import "testing"
+import (
+	"testing"
+	"time"
+)
 
 var configTests = []struct {
 	s   string
@@ -10,16 +13,19 @@ var configTests = []struct {
 		Container:   "container-name",
 		Prefix:      "",
 		Connections: 5,
+		Timeout:     5 * time.Minute,
 	}},
 	{"azure:container-name:/prefix/directory", Config{
 		Container:   "container-name",
 		Prefix:      "prefix/directory",
 		Connections: 5,
+		Timeout:     5 * time.Minute,
 	}},
 	{"azure:container-name:/prefix/directory/", Config{
 		Container:   "container-name",
 		Prefix:      "prefix/directory",
 		Connections: 5,
+		Timeout:     5 * time.Minute,
 	}},
 }
 
@@ -1,6 +1,9 @@
 package b2
 
-import "testing"
+import (
+	"testing"
+	"time"
+)
 
 var configTests = []struct {
 	s   string
@@ -10,31 +13,37 @@ var configTests = []struct {
 		Bucket:      "bucketname",
 		Prefix:      "",
 		Connections: 5,
+		Timeout:     5 * time.Minute,
 	}},
 	{"b2:bucketname:", Config{
 		Bucket:      "bucketname",
 		Prefix:      "",
 		Connections: 5,
+		Timeout:     5 * time.Minute,
 	}},
 	{"b2:bucketname:/prefix/directory", Config{
 		Bucket:      "bucketname",
 		Prefix:      "prefix/directory",
 		Connections: 5,
+		Timeout:     5 * time.Minute,
 	}},
 	{"b2:foobar", Config{
 		Bucket:      "foobar",
 		Prefix:      "",
 		Connections: 5,
+		Timeout:     5 * time.Minute,
 	}},
 	{"b2:foobar:", Config{
 		Bucket:      "foobar",
 		Prefix:      "",
 		Connections: 5,
+		Timeout:     5 * time.Minute,
 	}},
 	{"b2:foobar:/", Config{
 		Bucket:      "foobar",
 		Prefix:      "",
 		Connections: 5,
+		Timeout:     5 * time.Minute,
 	}},
 }
 
@@ -0,0 +1,42 @@
+package b2
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/restic/restic/internal/backend"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+
+	"github.com/kurin/blazer/b2"
+)
+
+// ensure statically that *b2Backend can check the lifecycle rules.
+var _ restic.LifecycleChecker = &b2Backend{}
+
+// lifecycleProblems returns a description of the rules which hide files
+// below prefix. Rules which only delete hidden files do not affect restic,
+// which removes all versions of a file itself.
+func lifecycleProblems(rules []b2.LifecycleRule, prefix string) []string {
+	var problems []string
+	for _, rule := range rules {
+		if rule.DaysNewUntilHidden == 0 || !backend.PrefixAffected(rule.Prefix, prefix) {
+			continue
+		}
+
+		problems = append(problems, fmt.Sprintf("lifecycle rule for prefix %q hides files %d days after they were uploaded", rule.Prefix, rule.DaysNewUntilHidden))
+	}
+
+	return problems
+}
+
+// CheckLifecycle returns the lifecycle rules of the bucket which hide the
+// files of the repository.
+func (be *b2Backend) CheckLifecycle(ctx context.Context) ([]string, error) {
+	attrs, err := be.bucket.Attrs(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "Attrs")
+	}
+
+	return lifecycleProblems(attrs.LifecycleRules, be.cfg.Prefix), nil
+}
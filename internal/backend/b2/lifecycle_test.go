@@ -0,0 +1,26 @@
+package b2
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/kurin/blazer/b2"
+)
+
+func TestLifecycleProblems(t *testing.T) {
+	rules := []b2.LifecycleRule{
+		{Prefix: "logs/", DaysNewUntilHidden: 7},
+		{Prefix: "", DaysHiddenUntilDeleted: 1},
+		{Prefix: "restic/", DaysNewUntilHidden: 30, DaysHiddenUntilDeleted: 1},
+	}
+
+	want := []string{`lifecycle rule for prefix "restic/" hides files 30 days after they were uploaded`}
+	problems := lifecycleProblems(rules, "restic")
+	if !reflect.DeepEqual(problems, want) {
+		t.Errorf("wrong problems, want %q, got %q", want, problems)
+	}
+
+	if problems := lifecycleProblems(rules, "backup"); len(problems) != 0 {
+		t.Errorf("unexpected problems for prefix backup: %q", problems)
+	}
+}
@@ -8,12 +8,12 @@ import (
 
 	"github.com/cenkalti/backoff"
 	"github.com/restic/restic/internal/debug"
-	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/restic"
 )
 
-// RetryBackend retries operations on the backend in case of an error with a
-// backoff.
+// RetryBackend retries operations on the backend in case of an error with an
+// exponential backoff. Errors for which the backend's IsPermanentError
+// returns true are not retried.
 type RetryBackend struct {
 	restic.Backend
 	MaxTries int
@@ -34,7 +34,15 @@ func NewRetryBackend(be restic.Backend, maxTries int, report func(string, error,
 }
 
 func (be *RetryBackend) retry(ctx context.Context, msg string, f func() error) error {
-	err := backoff.RetryNotify(f,
+	err := backoff.RetryNotify(
+		func() error {
+			err := f()
+			if err != nil && be.Backend.IsPermanentError(err) {
+				debug.Log("%v failed with permanent error: %v", msg, err)
+				return backoff.Permanent(err)
+			}
+			return err
+		},
 		backoff.WithContext(backoff.WithMaxTries(backoff.NewExponentialBackOff(), uint64(be.MaxTries)), ctx),
 		func(err error, d time.Duration) {
 			if be.Report != nil {
@@ -46,24 +54,11 @@ func (be *RetryBackend) retry(ctx context.Context, msg string, f func() error) e
 	return err
 }
 
-// Save stores the data in the backend under the given handle.
-func (be *RetryBackend) Save(ctx context.Context, h restic.Handle, rd io.Reader) error {
-	seeker, ok := rd.(io.Seeker)
-	if !ok {
-		return errors.Errorf("reader %T is not a seeker", rd)
-	}
-
-	pos, err := seeker.Seek(0, io.SeekCurrent)
-	if err != nil {
-		return errors.Wrap(err, "Seek")
-	}
-
-	if pos != 0 {
-		return errors.Errorf("reader is not at the beginning (pos %v)", pos)
-	}
-
+// Save stores the data in the backend under the given handle. The reader is
+// rewound before each attempt.
+func (be *RetryBackend) Save(ctx context.Context, h restic.Handle, rd restic.RewindReader) error {
 	return be.retry(ctx, fmt.Sprintf("Save(%v)", h), func() error {
-		_, err := seeker.Seek(0, io.SeekStart)
+		err := rd.Rewind()
 		if err != nil {
 			return err
 		}
@@ -128,3 +123,35 @@ func (be *RetryBackend) Test(ctx context.Context, h restic.Handle) (exists bool,
 	})
 	return exists, err
 }
+
+// List runs fn for each file in the backend which has the type t. When an
+// error occurs during listing, List is retried and fn is only called for files
+// which have not been listed before. Errors returned by fn are not retried.
+func (be *RetryBackend) List(ctx context.Context, t restic.FileType, fn func(restic.FileInfo) error) error {
+	listed := make(map[string]struct{})
+
+	var innerErr error
+	err := be.retry(ctx, fmt.Sprintf("List(%v)", t), func() error {
+		err := be.Backend.List(ctx, t, func(fi restic.FileInfo) error {
+			if _, ok := listed[fi.Name]; ok {
+				return nil
+			}
+			listed[fi.Name] = struct{}{}
+
+			innerErr = fn(fi)
+			return innerErr
+		})
+
+		if innerErr != nil {
+			// do not retry when fn returned an error
+			return backoff.Permanent(innerErr)
+		}
+		return err
+	})
+
+	if innerErr != nil {
+		return innerErr
+	}
+
+	return err
+}
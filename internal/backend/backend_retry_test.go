@@ -13,10 +13,12 @@ import (
 	"github.com/restic/restic/internal/test"
 )
 
-func TestBackendRetrySeeker(t *testing.T) {
+func TestBackendSaveRewind(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
 	be := &mock.Backend{
-		SaveFn: func(ctx context.Context, h restic.Handle, rd io.Reader) error {
-			return nil
+		SaveFn: func(ctx context.Context, h restic.Handle, rd restic.RewindReader) error {
+			_, err := io.Copy(buf, rd)
+			return err
 		},
 	}
 
@@ -26,27 +28,20 @@ func TestBackendRetrySeeker(t *testing.T) {
 
 	data := test.Random(24, 23*14123)
 
-	type wrapReader struct {
-		io.Reader
-	}
-
-	var rd io.Reader
-	rd = wrapReader{bytes.NewReader(data)}
-
-	err := retryBackend.Save(context.TODO(), restic.Handle{}, rd)
-	if err == nil {
-		t.Fatal("did not get expected error for retry backend with non-seeker reader")
+	// the reader is rewound before it is passed to the backend
+	rd := restic.NewByteReader(data)
+	_, err := io.CopyN(ioutil.Discard, rd, 5)
+	if err != nil {
+		t.Fatal(err)
 	}
 
-	rd = bytes.NewReader(data)
-	_, err = io.CopyN(ioutil.Discard, rd, 5)
+	err = retryBackend.Save(context.TODO(), restic.Handle{}, rd)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	err = retryBackend.Save(context.TODO(), restic.Handle{}, rd)
-	if err == nil {
-		t.Fatal("did not get expected error for partial reader")
+	if !bytes.Equal(data, buf.Bytes()) {
+		t.Errorf("wrong data written to backend")
 	}
 }
 
@@ -54,7 +49,7 @@ func TestBackendSaveRetry(t *testing.T) {
 	buf := bytes.NewBuffer(nil)
 	errcount := 0
 	be := &mock.Backend{
-		SaveFn: func(ctx context.Context, h restic.Handle, rd io.Reader) error {
+		SaveFn: func(ctx context.Context, h restic.Handle, rd restic.RewindReader) error {
 			if errcount == 0 {
 				errcount++
 				_, err := io.CopyN(ioutil.Discard, rd, 120)
@@ -75,7 +70,7 @@ func TestBackendSaveRetry(t *testing.T) {
 	}
 
 	data := test.Random(23, 5*1024*1024+11241)
-	err := retryBackend.Save(context.TODO(), restic.Handle{}, bytes.NewReader(data))
+	err := retryBackend.Save(context.TODO(), restic.Handle{}, restic.NewByteReader(data))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -88,3 +83,118 @@ func TestBackendSaveRetry(t *testing.T) {
 		t.Errorf("wrong data written to backend")
 	}
 }
+
+func TestBackendLoadPermanentError(t *testing.T) {
+	calls := 0
+	permanentErr := errors.New("permanent error")
+	be := &mock.Backend{
+		LoadFn: func(ctx context.Context, h restic.Handle, length int, offset int64) (io.ReadCloser, error) {
+			calls++
+			return nil, permanentErr
+		},
+		IsPermanentErrorFn: func(err error) bool {
+			return errors.Cause(err) == permanentErr
+		},
+	}
+
+	retryBackend := RetryBackend{
+		Backend:  be,
+		MaxTries: 10,
+	}
+
+	_, err := retryBackend.Load(context.TODO(), restic.Handle{}, 0, 0)
+	if errors.Cause(err) != permanentErr {
+		t.Fatalf("wrong error returned, want %v, got %v", permanentErr, err)
+	}
+
+	if calls != 1 {
+		t.Errorf("permanent error was retried, Load was called %d times", calls)
+	}
+}
+
+func TestBackendListRetry(t *testing.T) {
+	const (
+		ID1 = "id1"
+		ID2 = "id2"
+	)
+
+	retry := 0
+	be := &mock.Backend{
+		ListFn: func(ctx context.Context, t restic.FileType, fn func(restic.FileInfo) error) error {
+			// fail during first listing of the files
+			if retry == 0 {
+				retry++
+				_ = fn(restic.FileInfo{Name: ID1})
+				return errors.New("test list error")
+			}
+			retry++
+			_ = fn(restic.FileInfo{Name: ID1})
+			_ = fn(restic.FileInfo{Name: ID2})
+			return nil
+		},
+	}
+
+	retryBackend := RetryBackend{
+		Backend:  be,
+		MaxTries: 10,
+	}
+
+	var listed []string
+	err := retryBackend.List(context.TODO(), restic.DataFile, func(fi restic.FileInfo) error {
+		listed = append(listed, fi.Name)
+		return nil
+	})
+	test.OK(t, err)
+	test.Equals(t, 2, retry)
+	test.Equals(t, []string{ID1, ID2}, listed)
+}
+
+func TestBackendListRetryErrorFn(t *testing.T) {
+	var names = []string{"id1", "id2", "foo", "bar"}
+
+	be := &mock.Backend{
+		ListFn: func(ctx context.Context, tpe restic.FileType, fn func(restic.FileInfo) error) error {
+			t.Logf("List called for %v", tpe)
+			for _, name := range names {
+				err := fn(restic.FileInfo{Name: name})
+				if err != nil {
+					return err
+				}
+			}
+
+			return nil
+		},
+	}
+
+	retryBackend := RetryBackend{
+		Backend:  be,
+		MaxTries: 10,
+	}
+
+	testErr := errors.New("test error")
+
+	var listed []string
+	run := 0
+	err := retryBackend.List(context.TODO(), restic.DataFile, func(fi restic.FileInfo) error {
+		t.Logf("fn called for %v", fi.Name)
+		run++
+		// return an error for the third item in the list
+		if run == 3 {
+			t.Log("returning an error")
+			return testErr
+		}
+		listed = append(listed, fi.Name)
+		return nil
+	})
+
+	if err != testErr {
+		t.Fatalf("wrong error returned, want %v, got %v", testErr, err)
+	}
+
+	// processing should stop after the error was returned, so run should be 3
+	if run != 3 {
+		t.Fatalf("function was called %d times, wanted %v", run, 3)
+	}
+
+	test.Equals(t, []string{"id1", "id2"}, listed)
+}
@@ -0,0 +1,239 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/restic"
+)
+
+// TimeoutError is returned by TimeoutBackend when an operation was aborted
+// because it made no progress for too long.
+type TimeoutError struct {
+	Op      string
+	Timeout time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("%v made no progress for %v, aborted", e.Op, e.Timeout)
+}
+
+// IsTimeout returns true if err was returned for an operation which timed
+// out.
+func IsTimeout(err error) bool {
+	_, ok := err.(*TimeoutError)
+	return ok
+}
+
+// watchdog cancels a context when it is not reset within the timeout.
+type watchdog struct {
+	timeout time.Duration
+	cancel  context.CancelFunc
+	timer   *time.Timer
+
+	m     sync.Mutex
+	fired bool
+}
+
+// newWatchdog returns a watchdog which is already running and the context
+// it cancels.
+func newWatchdog(ctx context.Context, timeout time.Duration) (context.Context, *watchdog) {
+	ctx, cancel := context.WithCancel(ctx)
+	w := &watchdog{timeout: timeout, cancel: cancel}
+	w.timer = time.AfterFunc(timeout, func() {
+		w.m.Lock()
+		w.fired = true
+		w.m.Unlock()
+		cancel()
+	})
+	return ctx, w
+}
+
+// reset restarts the timeout, it is called when the operation makes progress.
+func (w *watchdog) reset() {
+	w.timer.Reset(w.timeout)
+}
+
+// pause stops the timeout until reset is called again, e.g. while the caller
+// processes the data.
+func (w *watchdog) pause() {
+	w.timer.Stop()
+}
+
+// expired returns true if the timeout has passed.
+func (w *watchdog) expired() bool {
+	w.m.Lock()
+	defer w.m.Unlock()
+	return w.fired
+}
+
+// stop stops the watchdog and cancels the context. It returns true if the
+// timeout has passed before.
+func (w *watchdog) stop() bool {
+	w.timer.Stop()
+	w.cancel()
+	return w.expired()
+}
+
+// TimeoutBackend aborts operations on the backend which make no progress
+// within Timeout, e.g. because an HTTP request hangs. For Save and Load, the
+// timeout is restarted whenever data is transferred, so large files can be
+// transferred on slow connections. Aborted operations return a
+// *TimeoutError, which is not permanent and can be retried by a
+// RetryBackend.
+type TimeoutBackend struct {
+	restic.Backend
+	Timeout time.Duration
+	Report  func(string, time.Duration)
+}
+
+// statically ensure that TimeoutBackend implements restic.Backend.
+var _ restic.Backend = &TimeoutBackend{}
+
+// NewTimeoutBackend wraps be with a backend that aborts operations after
+// timeout. report is called with a description of each aborted operation.
+func NewTimeoutBackend(be restic.Backend, timeout time.Duration, report func(string, time.Duration)) *TimeoutBackend {
+	return &TimeoutBackend{
+		Backend: be,
+		Timeout: timeout,
+		Report:  report,
+	}
+}
+
+// timedOut returns the error for the operation msg which was aborted by w,
+// err is returned unchanged if the timeout has not passed or when ctx was
+// cancelled by the caller.
+func (be *TimeoutBackend) timedOut(ctx context.Context, msg string, w *watchdog, err error) error {
+	if !w.stop() || ctx.Err() != nil {
+		return err
+	}
+
+	debug.Log("%v timed out after %v, error was %v", msg, be.Timeout, err)
+	if be.Report != nil {
+		be.Report(msg, be.Timeout)
+	}
+	return &TimeoutError{Op: msg, Timeout: be.Timeout}
+}
+
+func (be *TimeoutBackend) call(ctx context.Context, msg string, f func(context.Context) error) error {
+	wctx, w := newWatchdog(ctx, be.Timeout)
+	err := f(wctx)
+	return be.timedOut(ctx, msg, w, err)
+}
+
+// watchedReader restarts the watchdog whenever data is read.
+type watchedReader struct {
+	restic.RewindReader
+	w *watchdog
+}
+
+func (rd watchedReader) Read(p []byte) (int, error) {
+	n, err := rd.RewindReader.Read(p)
+	rd.w.reset()
+	return n, err
+}
+
+// Save stores the data in the backend under the given handle. The timeout is
+// restarted whenever the backend reads data from rd.
+func (be *TimeoutBackend) Save(ctx context.Context, h restic.Handle, rd restic.RewindReader) error {
+	msg := fmt.Sprintf("Save(%v)", h)
+	wctx, w := newWatchdog(ctx, be.Timeout)
+	err := be.Backend.Save(wctx, h, watchedReader{RewindReader: rd, w: w})
+	return be.timedOut(ctx, msg, w, err)
+}
+
+// Load returns a reader that yields the contents of the file at h at the
+// given offset. The timeout applies to opening the file and to each read from
+// the returned reader.
+func (be *TimeoutBackend) Load(ctx context.Context, h restic.Handle, length int, offset int64) (io.ReadCloser, error) {
+	msg := fmt.Sprintf("Load(%v, %v, %v)", h, length, offset)
+	wctx, w := newWatchdog(ctx, be.Timeout)
+
+	rd, err := be.Backend.Load(wctx, h, length, offset)
+	if err != nil {
+		return nil, be.timedOut(ctx, msg, w, err)
+	}
+
+	w.pause()
+	return &watchedReadCloser{ReadCloser: rd, be: be, ctx: ctx, msg: msg, w: w}, nil
+}
+
+// watchedReadCloser aborts reads which take longer than the timeout. The time
+// between reads is not counted.
+type watchedReadCloser struct {
+	io.ReadCloser
+	be  *TimeoutBackend
+	ctx context.Context
+	msg string
+	w   *watchdog
+	err error
+}
+
+func (rd *watchedReadCloser) Read(p []byte) (int, error) {
+	if rd.err != nil {
+		return 0, rd.err
+	}
+
+	rd.w.reset()
+	n, err := rd.ReadCloser.Read(p)
+	rd.w.pause()
+
+	if err != nil && err != io.EOF && rd.w.expired() {
+		rd.err = rd.be.timedOut(rd.ctx, rd.msg, rd.w, err)
+		return n, rd.err
+	}
+	return n, err
+}
+
+func (rd *watchedReadCloser) Close() error {
+	err := rd.ReadCloser.Close()
+	rd.w.stop()
+	return err
+}
+
+// Stat returns information about the File identified by h.
+func (be *TimeoutBackend) Stat(ctx context.Context, h restic.Handle) (fi restic.FileInfo, err error) {
+	err = be.call(ctx, fmt.Sprintf("Stat(%v)", h), func(ctx context.Context) error {
+		var innerError error
+		fi, innerError = be.Backend.Stat(ctx, h)
+		return innerError
+	})
+	return fi, err
+}
+
+// Remove removes a File with type t and name.
+func (be *TimeoutBackend) Remove(ctx context.Context, h restic.Handle) error {
+	return be.call(ctx, fmt.Sprintf("Remove(%v)", h), func(ctx context.Context) error {
+		return be.Backend.Remove(ctx, h)
+	})
+}
+
+// Test a boolean value whether a File with the name and type exists.
+func (be *TimeoutBackend) Test(ctx context.Context, h restic.Handle) (exists bool, err error) {
+	err = be.call(ctx, fmt.Sprintf("Test(%v)", h), func(ctx context.Context) error {
+		var innerError error
+		exists, innerError = be.Backend.Test(ctx, h)
+		return innerError
+	})
+	return exists, err
+}
+
+// List runs fn for each file in the backend which has the type t. The timeout
+// is restarted for each file, the time spent in fn is not counted.
+func (be *TimeoutBackend) List(ctx context.Context, t restic.FileType, fn func(restic.FileInfo) error) error {
+	msg := fmt.Sprintf("List(%v)", t)
+	wctx, w := newWatchdog(ctx, be.Timeout)
+
+	err := be.Backend.List(wctx, t, func(fi restic.FileInfo) error {
+		w.pause()
+		err := fn(fi)
+		w.reset()
+		return err
+	})
+
+	return be.timedOut(ctx, msg, w, err)
+}
@@ -0,0 +1,118 @@
+package backend
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/mock"
+	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/test"
+)
+
+// hangingReader blocks reads until the context is cancelled.
+type hangingReader struct {
+	ctx context.Context
+}
+
+func (rd hangingReader) Read(p []byte) (int, error) {
+	<-rd.ctx.Done()
+	return 0, rd.ctx.Err()
+}
+
+func (rd hangingReader) Close() error {
+	return nil
+}
+
+func TestTimeoutBackendSave(t *testing.T) {
+	data := test.Random(23, 5*1024)
+	buf := bytes.NewBuffer(nil)
+
+	be := &mock.Backend{
+		SaveFn: func(ctx context.Context, h restic.Handle, rd restic.RewindReader) error {
+			// a slow upload which makes progress does not time out
+			for {
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-time.After(10 * time.Millisecond):
+				}
+
+				_, err := io.CopyN(buf, rd, 1024)
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					return err
+				}
+			}
+
+			// waiting for the response after the upload times out
+			<-ctx.Done()
+			return ctx.Err()
+		},
+	}
+
+	var reported []string
+	tb := NewTimeoutBackend(be, 50*time.Millisecond, func(msg string, d time.Duration) {
+		reported = append(reported, msg)
+	})
+
+	err := tb.Save(context.TODO(), restic.Handle{Type: restic.DataFile, Name: "foo"}, restic.NewByteReader(data))
+	if !IsTimeout(err) {
+		t.Fatalf("expected timeout error, got %v", err)
+	}
+
+	if !bytes.Equal(data, buf.Bytes()) {
+		t.Errorf("wrong data written to backend")
+	}
+
+	if len(reported) != 1 {
+		t.Errorf("expected one reported timeout, got %v", reported)
+	}
+}
+
+func TestTimeoutBackendLoad(t *testing.T) {
+	be := &mock.Backend{
+		LoadFn: func(ctx context.Context, h restic.Handle, length int, offset int64) (io.ReadCloser, error) {
+			return hangingReader{ctx: ctx}, nil
+		},
+	}
+
+	tb := NewTimeoutBackend(be, 20*time.Millisecond, nil)
+
+	rd, err := tb.Load(context.TODO(), restic.Handle{Type: restic.DataFile, Name: "foo"}, 0, 0)
+	test.OK(t, err)
+
+	// the time between reading the data is not counted
+	time.Sleep(50 * time.Millisecond)
+
+	_, err = ioutil.ReadAll(rd)
+	if !IsTimeout(err) {
+		t.Fatalf("expected timeout error, got %v", err)
+	}
+	test.OK(t, rd.Close())
+}
+
+func TestTimeoutBackendCancel(t *testing.T) {
+	be := &mock.Backend{
+		StatFn: func(ctx context.Context, h restic.Handle) (restic.FileInfo, error) {
+			<-ctx.Done()
+			return restic.FileInfo{}, ctx.Err()
+		},
+	}
+
+	tb := NewTimeoutBackend(be, time.Hour, nil)
+
+	ctx, cancel := context.WithTimeout(context.TODO(), 20*time.Millisecond)
+	defer cancel()
+
+	// cancelling the context of the caller is not reported as a timeout
+	_, err := tb.Stat(ctx, restic.Handle{Type: restic.DataFile, Name: "foo"})
+	if err == nil || IsTimeout(err) {
+		t.Fatalf("expected context error, got %v", err)
+	}
+}
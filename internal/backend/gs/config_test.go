@@ -1,6 +1,9 @@
 package gs
 
-import "testing"
+import (
+	"testing"
+	"time"
+)
 
 var configTests = []struct {
 	s   string
@@ -10,16 +13,19 @@ var configTests = []struct {
 		Bucket:      "bucketname",
 		Prefix:      "",
 		Connections: 5,
+		Timeout:     5 * time.Minute,
 	}},
 	{"gs:bucketname:/prefix/directory", Config{
 		Bucket:      "bucketname",
 		Prefix:      "prefix/directory",
 		Connections: 5,
+		Timeout:     5 * time.Minute,
 	}},
 	{"gs:bucketname:/prefix/directory/", Config{
 		Bucket:      "bucketname",
 		Prefix:      "prefix/directory",
 		Connections: 5,
+		Timeout:     5 * time.Minute,
 	}},
 }
 
@@ -5,6 +5,7 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"net/http"
 	"os"
 	"path"
 	"strings"
@@ -16,6 +17,7 @@ import (
 
 	"io/ioutil"
 
+	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
 	"google.golang.org/api/googleapi"
 	storage "google.golang.org/api/storage/v1"
@@ -41,7 +43,7 @@ type Backend struct {
 // Ensure that *Backend implements restic.Backend.
 var _ restic.Backend = &Backend{}
 
-func getStorageService(jsonKeyPath string) (*storage.Service, error) {
+func getStorageService(jsonKeyPath string, rt http.RoundTripper) (*storage.Service, error) {
 
 	raw, err := ioutil.ReadFile(jsonKeyPath)
 	if err != nil {
@@ -53,7 +55,11 @@ func getStorageService(jsonKeyPath string) (*storage.Service, error) {
 		return nil, err
 	}
 
-	client := conf.Client(context.TODO())
+	// create a new context with the HTTP client stored at the oauth2.HTTPClient key,
+	// so that the oauth2 client uses rt for all requests
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, &http.Client{Transport: rt})
+
+	client := conf.Client(ctx)
 
 	service, err := storage.New(client)
 	if err != nil {
@@ -65,10 +71,10 @@ func getStorageService(jsonKeyPath string) (*storage.Service, error) {
 
 const defaultListMaxItems = 1000
 
-func open(cfg Config) (*Backend, error) {
+func open(cfg Config, rt http.RoundTripper) (*Backend, error) {
 	debug.Log("open, config %#v", cfg)
 
-	service, err := getStorageService(cfg.JSONKeyPath)
+	service, err := getStorageService(cfg.JSONKeyPath, rt)
 	if err != nil {
 		return nil, errors.Wrap(err, "getStorageService")
 	}
@@ -95,8 +101,8 @@ func open(cfg Config) (*Backend, error) {
 }
 
 // Open opens the gs backend at the specified bucket.
-func Open(cfg Config) (restic.Backend, error) {
-	return open(cfg)
+func Open(cfg Config, rt http.RoundTripper) (restic.Backend, error) {
+	return open(cfg, rt)
 }
 
 // Create opens the gs backend at the specified bucket and attempts to creates
@@ -104,8 +110,8 @@ func Open(cfg Config) (restic.Backend, error) {
 //
 // The service account must have the "storage.buckets.create" permission to
 // create a bucket the does not yet exist.
-func Create(cfg Config) (restic.Backend, error) {
-	be, err := open(cfg)
+func Create(cfg Config, rt http.RoundTripper) (restic.Backend, error) {
+	be, err := open(cfg, rt)
 	if err != nil {
 		return nil, errors.Wrap(err, "open")
 	}
@@ -179,6 +185,23 @@ func (be *Backend) IsNotExist(err error) bool {
 	return false
 }
 
+// IsPermanentError returns true if the error cannot be resolved by retrying,
+// e.g. because the file does not exist or the credentials are invalid.
+func (be *Backend) IsPermanentError(err error) bool {
+	if be.IsNotExist(err) {
+		return true
+	}
+
+	if er, ok := errors.Cause(err).(*googleapi.Error); ok {
+		switch er.Code {
+		case http.StatusUnauthorized, http.StatusForbidden:
+			return true
+		}
+	}
+
+	return false
+}
+
 // Join combines path components with slashes.
 func (be *Backend) Join(p ...string) string {
 	return path.Join(p...)
@@ -195,7 +218,7 @@ func (be *Backend) Path() string {
 }
 
 // Save stores data in the backend at the handle.
-func (be *Backend) Save(ctx context.Context, h restic.Handle, rd io.Reader) (err error) {
+func (be *Backend) Save(ctx context.Context, h restic.Handle, rd restic.RewindReader) (err error) {
 	if err := h.Valid(); err != nil {
 		return err
 	}
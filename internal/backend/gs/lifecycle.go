@@ -0,0 +1,69 @@
+package gs
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/restic/restic/internal/restic"
+
+	storage "google.golang.org/api/storage/v1"
+)
+
+// Ensure that *Backend can check the lifecycle rules of the bucket.
+var _ restic.LifecycleChecker = &Backend{}
+
+// lifecycleProblems returns a description of the lifecycle rules of bucket
+// which delete or hide live objects. The rules apply to all objects in the
+// bucket. In a versioned bucket, deleted objects are hidden as noncurrent
+// versions.
+func lifecycleProblems(bucket *storage.Bucket) []string {
+	if bucket.Lifecycle == nil {
+		return nil
+	}
+
+	deleted := "deletes"
+	if bucket.Versioning != nil && bucket.Versioning.Enabled {
+		deleted = "hides (as noncurrent versions)"
+	}
+
+	var problems []string
+	for i, rule := range bucket.Lifecycle.Rule {
+		if rule.Action == nil || rule.Action.Type != "Delete" {
+			continue
+		}
+
+		cond := rule.Condition
+		if cond == nil {
+			cond = &storage.BucketLifecycleRuleCondition{}
+		}
+
+		// rules for noncurrent versions do not affect the live files
+		if (cond.IsLive != nil && !*cond.IsLive) || cond.NumNewerVersions > 0 {
+			continue
+		}
+
+		var when string
+		switch {
+		case cond.Age > 0:
+			when = fmt.Sprintf(" older than %d days", cond.Age)
+		case cond.CreatedBefore != "":
+			when = fmt.Sprintf(" created before %v", cond.CreatedBefore)
+		}
+
+		problems = append(problems, fmt.Sprintf("lifecycle rule %d %s all files%s", i+1, deleted, when))
+	}
+
+	return problems
+}
+
+// CheckLifecycle returns the lifecycle rules of the bucket which delete the
+// files of the repository. This requires the permission storage.buckets.get.
+func (be *Backend) CheckLifecycle(ctx context.Context) ([]string, error) {
+	bucket, err := be.service.Buckets.Get(be.bucketName).Context(ctx).Do()
+	if err != nil {
+		return nil, errors.Wrap(err, "service.Buckets.Get")
+	}
+
+	return lifecycleProblems(bucket), nil
+}
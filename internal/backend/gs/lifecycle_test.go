@@ -0,0 +1,62 @@
+package gs
+
+import (
+	"reflect"
+	"testing"
+
+	storage "google.golang.org/api/storage/v1"
+)
+
+func TestLifecycleProblems(t *testing.T) {
+	live, noncurrent := true, false
+
+	bucket := &storage.Bucket{
+		Lifecycle: &storage.BucketLifecycle{
+			Rule: []*storage.BucketLifecycleRule{
+				{
+					Action:    &storage.BucketLifecycleRuleAction{Type: "Delete"},
+					Condition: &storage.BucketLifecycleRuleCondition{Age: 30},
+				},
+				{
+					Action:    &storage.BucketLifecycleRuleAction{Type: "Delete"},
+					Condition: &storage.BucketLifecycleRuleCondition{NumNewerVersions: 3},
+				},
+				{
+					Action:    &storage.BucketLifecycleRuleAction{Type: "Delete"},
+					Condition: &storage.BucketLifecycleRuleCondition{IsLive: &noncurrent, Age: 7},
+				},
+				{
+					Action:    &storage.BucketLifecycleRuleAction{Type: "SetStorageClass", StorageClass: "COLDLINE"},
+					Condition: &storage.BucketLifecycleRuleCondition{Age: 90},
+				},
+				{
+					Action:    &storage.BucketLifecycleRuleAction{Type: "Delete"},
+					Condition: &storage.BucketLifecycleRuleCondition{IsLive: &live, CreatedBefore: "2018-01-01"},
+				},
+			},
+		},
+	}
+
+	want := []string{
+		"lifecycle rule 1 deletes all files older than 30 days",
+		"lifecycle rule 5 deletes all files created before 2018-01-01",
+	}
+	problems := lifecycleProblems(bucket)
+	if !reflect.DeepEqual(problems, want) {
+		t.Errorf("wrong problems, want %q, got %q", want, problems)
+	}
+
+	bucket.Versioning = &storage.BucketVersioning{Enabled: true}
+	want = []string{
+		"lifecycle rule 1 hides (as noncurrent versions) all files older than 30 days",
+		"lifecycle rule 5 hides (as noncurrent versions) all files created before 2018-01-01",
+	}
+	problems = lifecycleProblems(bucket)
+	if !reflect.DeepEqual(problems, want) {
+		t.Errorf("wrong problems, want %q, got %q", want, problems)
+	}
+
+	if problems := lifecycleProblems(&storage.Bucket{}); len(problems) != 0 {
+		t.Errorf("unexpected problems for bucket without lifecycle: %q", problems)
+	}
+}
@@ -0,0 +1,127 @@
+package backend
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+)
+
+// parseRange parses a single byte range as sent by the backends in the Range
+// header, e.g. "bytes=10-" or "bytes=10-19". For an open range, end is -1.
+func parseRange(s string) (start, end int64, err error) {
+	if !strings.HasPrefix(s, "bytes=") {
+		return 0, 0, errors.Errorf("invalid range %q", s)
+	}
+
+	data := strings.SplitN(strings.TrimPrefix(s, "bytes="), "-", 2)
+	if len(data) != 2 {
+		return 0, 0, errors.Errorf("invalid range %q", s)
+	}
+
+	start, err = strconv.ParseInt(data[0], 10, 64)
+	if err != nil {
+		return 0, 0, errors.Errorf("invalid range %q", s)
+	}
+
+	if data[1] == "" {
+		return start, -1, nil
+	}
+
+	end, err = strconv.ParseInt(data[1], 10, 64)
+	if err != nil || end < start {
+		return 0, 0, errors.Errorf("invalid range %q", s)
+	}
+
+	return start, end, nil
+}
+
+type rangeRoundTripper struct {
+	rt   http.RoundTripper
+	warn func(host string)
+	once sync.Once
+}
+
+// RangeRoundTripper wraps rt so that responses to ranged requests are checked.
+// Some servers (and misconfigured proxies) ignore the Range header and return
+// the complete file. In this case, the unrequested prefix of the body is
+// discarded and the rest is limited to the requested length, so the caller
+// receives the data it asked for. The function warn is called once when this
+// is detected for the first time.
+func RangeRoundTripper(rt http.RoundTripper, warn func(host string)) http.RoundTripper {
+	return &rangeRoundTripper{rt: rt, warn: warn}
+}
+
+func (r *rangeRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := r.rt.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		return resp, err
+	}
+
+	byteRange := req.Header.Get("Range")
+	if req.Method != http.MethodGet || byteRange == "" {
+		return resp, err
+	}
+
+	start, end, err := parseRange(byteRange)
+	if err != nil {
+		// leave requests alone that we do not understand
+		debug.Log("unable to parse range: %v", err)
+		return resp, nil
+	}
+
+	if start == 0 && end == -1 {
+		// the complete file was requested
+		return resp, nil
+	}
+
+	debug.Log("server returned the complete file for range %v of %v", byteRange, req.URL)
+	r.once.Do(func() {
+		if r.warn != nil {
+			r.warn(req.URL.Host)
+		}
+	})
+
+	if start > 0 {
+		n, err := io.CopyN(ioutil.Discard, resp.Body, start)
+		if err != nil {
+			_ = resp.Body.Close()
+			return nil, errors.Errorf("server ignored range %v, discarding %d bytes failed after %d bytes: %v",
+				byteRange, start, n, err)
+		}
+	}
+
+	total := resp.ContentLength
+	length := int64(-1)
+	if total >= 0 {
+		length = total - start
+	}
+
+	if end >= 0 {
+		if length < 0 || end-start+1 < length {
+			length = end - start + 1
+		}
+		resp.Body = LimitReadCloser(resp.Body, length)
+	}
+
+	resp.StatusCode = http.StatusPartialContent
+	resp.Status = fmt.Sprintf("%d %s", http.StatusPartialContent, http.StatusText(http.StatusPartialContent))
+	resp.ContentLength = length
+	resp.Header.Del("Content-Length")
+	if length >= 0 {
+		resp.Header.Set("Content-Length", strconv.FormatInt(length, 10))
+		size := "*"
+		if total >= 0 {
+			size = strconv.FormatInt(total, 10)
+		}
+		resp.Header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%s", start, start+length-1, size))
+	}
+
+	return resp, nil
+}
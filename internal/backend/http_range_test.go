@@ -0,0 +1,116 @@
+package backend
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/restic/restic/internal/test"
+)
+
+func TestParseRange(t *testing.T) {
+	var tests = []struct {
+		s          string
+		start, end int64
+		err        bool
+	}{
+		{"bytes=0-", 0, -1, false},
+		{"bytes=23-", 23, -1, false},
+		{"bytes=10-19", 10, 19, false},
+		{"bytes=10-9", 0, 0, true},
+		{"bytes=-10", 0, 0, true},
+		{"10-19", 0, 0, true},
+		{"bytes=x-19", 0, 0, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.s, func(t *testing.T) {
+			start, end, err := parseRange(test.s)
+			if test.err {
+				if err == nil {
+					t.Fatalf("expected error not found")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if start != test.start || end != test.end {
+				t.Fatalf("wrong range returned, want %d-%d, got %d-%d", test.start, test.end, start, end)
+			}
+		})
+	}
+}
+
+func TestRangeRoundTripper(t *testing.T) {
+	data := test.Random(23, 1000)
+
+	// the server ignores the Range header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Length", fmt.Sprintf("%d", len(data)))
+		_, _ = w.Write(data)
+	}))
+	defer srv.Close()
+
+	var warnings int
+	client := &http.Client{
+		Transport: RangeRoundTripper(http.DefaultTransport, func(string) {
+			warnings++
+		}),
+	}
+
+	var tests = []struct {
+		byteRange  string
+		start, end int
+	}{
+		{"", 0, len(data)},
+		{"bytes=0-", 0, len(data)},
+		{"bytes=100-", 100, len(data)},
+		{"bytes=100-199", 100, 200},
+		{"bytes=900-1999", 900, len(data)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.byteRange, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, srv.URL, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if test.byteRange != "" {
+				req.Header.Set("Range", test.byteRange)
+			}
+
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			buf, err := ioutil.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err = resp.Body.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			if !bytes.Equal(buf, data[test.start:test.end]) {
+				t.Fatalf("wrong data returned, want %d bytes, got %d bytes", test.end-test.start, len(buf))
+			}
+
+			if resp.ContentLength != int64(len(buf)) {
+				t.Fatalf("wrong content length, want %d, got %d", len(buf), resp.ContentLength)
+			}
+		})
+	}
+
+	if warnings != 1 {
+		t.Fatalf("expected exactly one warning, got %d", warnings)
+	}
+}
@@ -7,15 +7,56 @@ import (
 	"io/ioutil"
 	"net"
 	"net/http"
+	"net/url"
+	"strings"
 	"time"
 
 	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/options"
+
+	"golang.org/x/net/http2"
 )
 
-// Transport returns a new http.RoundTripper with default settings applied. If
-// a custom rootCertFilename is non-empty, it must point to a valid PEM file,
-// otherwise the function will return an error.
-func Transport(rootCertFilenames []string) (http.RoundTripper, error) {
+// TransportOptions collects the options for the HTTP transport which is
+// shared by all HTTP based backends. The fields with an option tag can be set
+// as extended options in the namespace "http", e.g. "-o http.no-http2=true".
+type TransportOptions struct {
+	// RootCertFilenames contains the PEM files with the root certificates
+	// which are trusted instead of the system certificates.
+	RootCertFilenames []string
+
+	// TLSClientCertKeyFilename is a PEM file containing the certificate and
+	// the private key used to authenticate the client.
+	TLSClientCertKeyFilename string
+
+	// ProxyURL is the URL of the proxy used for all requests. If it is
+	// empty, the proxy is taken from the environment variables HTTP_PROXY,
+	// HTTPS_PROXY and NO_PROXY.
+	ProxyURL string
+
+	MaxIdleConns           uint          `option:"max-idle-conns" help:"keep at most this number of idle connections per host (default: 100)"`
+	IdleConnTimeout        time.Duration `option:"idle-timeout" help:"close connections which have been idle for the duration (default: 90s)"`
+	DisableHTTP2           bool          `option:"no-http2" help:"only use HTTP/1.1, even if the server supports HTTP/2"`
+	DisableTLSSessionCache bool          `option:"no-tls-session-cache" help:"do not resume TLS sessions when opening new connections"`
+}
+
+func init() {
+	options.Register("http", TransportOptions{})
+}
+
+// Transport returns a new http.RoundTripper with the options applied. The
+// files in opts must contain valid PEM data, otherwise an error is returned.
+func Transport(opts TransportOptions) (http.RoundTripper, error) {
+	maxIdleConns := 100
+	if opts.MaxIdleConns > 0 {
+		maxIdleConns = int(opts.MaxIdleConns)
+	}
+
+	idleConnTimeout := 90 * time.Second
+	if opts.IdleConnTimeout > 0 {
+		idleConnTimeout = opts.IdleConnTimeout
+	}
+
 	// copied from net/http
 	tr := &http.Transport{
 		Proxy: http.ProxyFromEnvironment,
@@ -24,35 +65,99 @@ func Transport(rootCertFilenames []string) (http.RoundTripper, error) {
 			KeepAlive: 30 * time.Second,
 			DualStack: true,
 		}).DialContext,
-		MaxIdleConns:          100,
-		MaxIdleConnsPerHost:   100,
-		IdleConnTimeout:       90 * time.Second,
+		MaxIdleConns:          maxIdleConns,
+		MaxIdleConnsPerHost:   maxIdleConns,
+		IdleConnTimeout:       idleConnTimeout,
 		TLSHandshakeTimeout:   10 * time.Second,
 		ExpectContinueTimeout: 1 * time.Second,
+		TLSClientConfig:       &tls.Config{},
+	}
+
+	if opts.ProxyURL != "" {
+		proxy, err := parseProxyURL(opts.ProxyURL)
+		if err != nil {
+			return nil, err
+		}
+		tr.Proxy = http.ProxyURL(proxy)
+	}
+
+	if opts.DisableHTTP2 {
+		// a non-nil, empty map prevents the upgrade to HTTP/2
+		tr.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
 	}
 
-	if rootCertFilenames == nil {
-		return debug.RoundTripper(tr), nil
+	if !opts.DisableTLSSessionCache {
+		tr.TLSClientConfig.ClientSessionCache = tls.NewLRUClientSessionCache(0)
 	}
 
-	p := x509.NewCertPool()
-	for _, filename := range rootCertFilenames {
-		if filename == "" {
-			return nil, fmt.Errorf("empty filename for root certificate supplied")
+	if opts.TLSClientCertKeyFilename != "" {
+		b, err := ioutil.ReadFile(opts.TLSClientCertKeyFilename)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read client certificate: %v", err)
 		}
-		b, err := ioutil.ReadFile(filename)
+
+		// the file contains both the certificate and the key
+		cert, err := tls.X509KeyPair(b, b)
 		if err != nil {
-			return nil, fmt.Errorf("unable to read root certificate: %v", err)
+			return nil, fmt.Errorf("cannot parse client certificate and key from %q: %v", opts.TLSClientCertKeyFilename, err)
 		}
-		if ok := p.AppendCertsFromPEM(b); !ok {
-			return nil, fmt.Errorf("cannot parse root certificate from %q", filename)
+
+		tr.TLSClientConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	if opts.RootCertFilenames != nil {
+		p := x509.NewCertPool()
+		for _, filename := range opts.RootCertFilenames {
+			if filename == "" {
+				return nil, fmt.Errorf("empty filename for root certificate supplied")
+			}
+			b, err := ioutil.ReadFile(filename)
+			if err != nil {
+				return nil, fmt.Errorf("unable to read root certificate: %v", err)
+			}
+			if ok := p.AppendCertsFromPEM(b); !ok {
+				return nil, fmt.Errorf("cannot parse root certificate from %q", filename)
+			}
 		}
+
+		tr.TLSClientConfig.RootCAs = p
 	}
 
-	tr.TLSClientConfig = &tls.Config{
-		RootCAs: p,
+	// a custom dialer and TLS config disable HTTP/2 unless it is configured
+	// explicitly
+	if !opts.DisableHTTP2 {
+		if err := http2.ConfigureTransport(tr); err != nil {
+			return nil, fmt.Errorf("unable to enable HTTP/2: %v", err)
+		}
 	}
 
+	debug.Log("transport: max %d idle connections, HTTP/2 %v, TLS session cache %v, proxy %q",
+		maxIdleConns, !opts.DisableHTTP2, !opts.DisableTLSSessionCache, opts.ProxyURL)
+
 	// wrap in the debug round tripper
 	return debug.RoundTripper(tr), nil
 }
+
+// parseProxyURL parses the URL of a proxy. The scheme defaults to "http", which
+// is the only scheme net/http supports in Go 1.8, SOCKS5 and HTTPS proxies
+// need Go 1.9 and 1.10 respectively.
+func parseProxyURL(s string) (*url.URL, error) {
+	if !strings.Contains(s, "://") {
+		s = "http://" + s
+	}
+
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy URL: %v", err)
+	}
+
+	if u.Scheme != "http" {
+		return nil, fmt.Errorf("invalid proxy URL %q: unsupported scheme %q, only http is supported", s, u.Scheme)
+	}
+
+	if u.Host == "" {
+		return nil, fmt.Errorf("invalid proxy URL %q: no host", s)
+	}
+
+	return u, nil
+}
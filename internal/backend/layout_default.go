@@ -16,11 +16,13 @@ type DefaultLayout struct {
 }
 
 var defaultLayoutPaths = map[restic.FileType]string{
-	restic.DataFile:     "data",
-	restic.SnapshotFile: "snapshots",
-	restic.IndexFile:    "index",
-	restic.LockFile:     "locks",
-	restic.KeyFile:      "keys",
+	restic.DataFile:      "data",
+	restic.SnapshotFile:  "snapshots",
+	restic.IndexFile:     "index",
+	restic.LockFile:      "locks",
+	restic.KeyFile:       "keys",
+	restic.ManifestFile:  "manifest",
+	restic.MigrationFile: "migrations",
 }
 
 func (l *DefaultLayout) String() string {
@@ -22,7 +22,7 @@ func (l *RESTLayout) Name() string {
 
 // Dirname returns the directory path for a given file type and name.
 func (l *RESTLayout) Dirname(h restic.Handle) string {
-	if h.Type == restic.ConfigFile {
+	if h.Type == restic.ConfigFile || h.Type == restic.ArchiveFile {
 		return l.URL + l.Join(l.Path, "/")
 	}
 
@@ -11,11 +11,13 @@ type S3LegacyLayout struct {
 }
 
 var s3LayoutPaths = map[restic.FileType]string{
-	restic.DataFile:     "data",
-	restic.SnapshotFile: "snapshot",
-	restic.IndexFile:    "index",
-	restic.LockFile:     "lock",
-	restic.KeyFile:      "key",
+	restic.DataFile:      "data",
+	restic.SnapshotFile:  "snapshot",
+	restic.IndexFile:     "index",
+	restic.LockFile:      "lock",
+	restic.KeyFile:       "key",
+	restic.ManifestFile:  "manifest",
+	restic.MigrationFile: "migration",
 }
 
 func (l *S3LegacyLayout) String() string {
@@ -40,6 +40,12 @@ func TestDefaultLayout(t *testing.T) {
 			restic.Handle{Type: restic.SnapshotFile, Name: "123456"},
 			filepath.Join(tempdir, "snapshots", "123456"),
 		},
+		{
+			tempdir,
+			filepath.Join,
+			restic.Handle{Type: restic.ArchiveFile, Name: "restore.tar"},
+			filepath.Join(tempdir, "restore.tar"),
+		},
 		{
 			tempdir,
 			filepath.Join,
@@ -110,6 +116,8 @@ func TestDefaultLayout(t *testing.T) {
 			filepath.Join(tempdir, "index"),
 			filepath.Join(tempdir, "locks"),
 			filepath.Join(tempdir, "keys"),
+			filepath.Join(tempdir, "manifest"),
+			filepath.Join(tempdir, "migrations"),
 		}
 
 		for i := 0; i < 256; i++ {
@@ -187,6 +195,8 @@ func TestRESTLayout(t *testing.T) {
 			filepath.Join(path, "index"),
 			filepath.Join(path, "locks"),
 			filepath.Join(path, "keys"),
+			filepath.Join(path, "manifest"),
+			filepath.Join(path, "migrations"),
 		}
 
 		sort.Sort(sort.StringSlice(want))
@@ -232,6 +242,12 @@ func TestRESTLayoutURLs(t *testing.T) {
 			"https://hostname.foo:1234/prefix/repo/config",
 			"https://hostname.foo:1234/prefix/repo/",
 		},
+		{
+			&RESTLayout{URL: "https://hostname.foo:1234/prefix/repo", Path: "/", Join: path.Join},
+			restic.Handle{Type: restic.ArchiveFile, Name: "restore.tar"},
+			"https://hostname.foo:1234/prefix/repo/restore.tar",
+			"https://hostname.foo:1234/prefix/repo/",
+		},
 		{
 			&S3LegacyLayout{URL: "https://hostname.foo", Path: "/", Join: path.Join},
 			restic.Handle{Type: restic.DataFile, Name: "foobar"},
@@ -268,6 +284,12 @@ func TestRESTLayoutURLs(t *testing.T) {
 			"/config",
 			"/",
 		},
+		{
+			&S3LegacyLayout{URL: "", Path: "prefix", Join: path.Join},
+			restic.Handle{Type: restic.ArchiveFile, Name: "restore.zip"},
+			"prefix/restore.zip",
+			"prefix/",
+		},
 	}
 
 	for _, test := range tests {
@@ -333,6 +355,8 @@ func TestS3LegacyLayout(t *testing.T) {
 			filepath.Join(path, "index"),
 			filepath.Join(path, "lock"),
 			filepath.Join(path, "key"),
+			filepath.Join(path, "manifest"),
+			filepath.Join(path, "migration"),
 		}
 
 		sort.Sort(sort.StringSlice(want))
@@ -0,0 +1,14 @@
+package backend
+
+import "strings"
+
+// PrefixAffected returns true if a rule of a storage service for all object
+// names starting with rulePrefix applies to files of a repository stored
+// below prefix.
+func PrefixAffected(rulePrefix, prefix string) bool {
+	if prefix != "" {
+		prefix = strings.TrimSuffix(prefix, "/") + "/"
+	}
+
+	return strings.HasPrefix(prefix, rulePrefix) || strings.HasPrefix(rulePrefix, prefix)
+}
@@ -0,0 +1,32 @@
+package backend_test
+
+import (
+	"testing"
+
+	"github.com/restic/restic/internal/backend"
+)
+
+func TestPrefixAffected(t *testing.T) {
+	var tests = []struct {
+		rulePrefix, prefix string
+		affected           bool
+	}{
+		{"", "", true},
+		{"", "restic", true},
+		{"res", "restic", true},
+		{"restic/", "restic", true},
+		{"restic/data/", "restic", true},
+		{"restic/data/", "", true},
+		{"restic2/", "restic", false},
+		{"logs/", "restic", false},
+		{"logs/", "restic/", false},
+		{"restic/", "restic/", true},
+	}
+
+	for _, test := range tests {
+		affected := backend.PrefixAffected(test.rulePrefix, test.prefix)
+		if affected != test.affected {
+			t.Errorf("PrefixAffected(%q, %q) = %v, want %v", test.rulePrefix, test.prefix, affected, test.affected)
+		}
+	}
+}
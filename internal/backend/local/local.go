@@ -97,8 +97,15 @@ func (b *Local) IsNotExist(err error) bool {
 	return os.IsNotExist(errors.Cause(err))
 }
 
+// IsPermanentError returns true if the error cannot be resolved by retrying,
+// e.g. because the file does not exist or access is denied.
+func (b *Local) IsPermanentError(err error) bool {
+	err = errors.Cause(err)
+	return os.IsNotExist(err) || os.IsPermission(err)
+}
+
 // Save stores data in the backend at the handle.
-func (b *Local) Save(ctx context.Context, h restic.Handle, rd io.Reader) error {
+func (b *Local) Save(ctx context.Context, h restic.Handle, rd restic.RewindReader) error {
 	debug.Log("Save %v", h)
 	if err := h.Valid(); err != nil {
 		return err
@@ -127,12 +134,18 @@ func (b *Local) Save(ctx context.Context, h restic.Handle, rd io.Reader) error {
 	}
 
 	// save data, then sync
-	_, err = io.Copy(f, rd)
+	wbytes, err := io.Copy(f, rd)
 	if err != nil {
 		_ = f.Close()
 		return errors.Wrap(err, "Write")
 	}
 
+	// sanity check
+	if wbytes != rd.Length() {
+		_ = f.Close()
+		return errors.Errorf("wrote %d bytes instead of the expected %d bytes", wbytes, rd.Length())
+	}
+
 	if err = f.Sync(); err != nil {
 		_ = f.Close()
 		return errors.Wrap(err, "Sync")
@@ -219,9 +232,54 @@ func (b *Local) Remove(ctx context.Context, h restic.Handle) error {
 		return errors.Wrap(err, "Chmod")
 	}
 
+	if b.SecureDelete {
+		err = overwriteFile(fn)
+		if err != nil {
+			return err
+		}
+	}
+
 	return fs.Remove(fn)
 }
 
+// overwriteFile overwrites the content of the file fn with zeros and syncs it
+// to disk, so that the data cannot be recovered after the file is removed.
+func overwriteFile(fn string) error {
+	debug.Log("overwrite %v", fn)
+	f, err := fs.OpenFile(fn, os.O_WRONLY, 0)
+	if err != nil {
+		return errors.Wrap(err, "OpenFile")
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return errors.Wrap(err, "Stat")
+	}
+
+	buf := make([]byte, 64*1024)
+	for remaining := fi.Size(); remaining > 0; {
+		n := int64(len(buf))
+		if remaining < n {
+			n = remaining
+		}
+
+		_, err = f.Write(buf[:n])
+		if err != nil {
+			_ = f.Close()
+			return errors.Wrap(err, "Write")
+		}
+		remaining -= n
+	}
+
+	if err = f.Sync(); err != nil {
+		_ = f.Close()
+		return errors.Wrap(err, "Sync")
+	}
+
+	return errors.Wrap(f.Close(), "Close")
+}
+
 func isFile(fi os.FileInfo) bool {
 	return fi.Mode()&(os.ModeType|os.ModeCharDevice) == 0
 }
@@ -235,6 +293,10 @@ func (b *Local) List(ctx context.Context, t restic.FileType, fn func(restic.File
 	return fs.Walk(basedir, func(path string, fi os.FileInfo, err error) error {
 		debug.Log("walk on %v\n", path)
 		if err != nil {
+			// the directory for this type may not exist in older repositories
+			if path == basedir && b.IsNotExist(err) {
+				return nil
+			}
 			return err
 		}
 
@@ -273,6 +335,28 @@ func (b *Local) List(ctx context.Context, t restic.FileType, fn func(restic.File
 // Delete removes the repository and all files.
 func (b *Local) Delete(ctx context.Context) error {
 	debug.Log("Delete()")
+	if b.SecureDelete {
+		err := fs.Walk(b.Path, func(path string, fi os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+
+			if !isFile(fi) {
+				return nil
+			}
+
+			// reset read-only flag
+			if err = fs.Chmod(path, 0666); err != nil {
+				return errors.Wrap(err, "Chmod")
+			}
+
+			return overwriteFile(path)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
 	return fs.RemoveAll(b.Path)
 }
 
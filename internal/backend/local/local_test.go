@@ -1,6 +1,7 @@
 package local_test
 
 import (
+	"context"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -12,7 +13,7 @@ import (
 	rtest "github.com/restic/restic/internal/test"
 )
 
-func newTestSuite(t testing.TB) *test.Suite {
+func newTestSuite(t testing.TB, secureDelete bool) *test.Suite {
 	return &test.Suite{
 		// NewConfig returns a config for a new temporary backend that will be used in tests.
 		NewConfig: func() (interface{}, error) {
@@ -24,7 +25,8 @@ func newTestSuite(t testing.TB) *test.Suite {
 			t.Logf("create new backend at %v", dir)
 
 			cfg := local.Config{
-				Path: dir,
+				Path:         dir,
+				SecureDelete: secureDelete,
 			}
 			return cfg, nil
 		},
@@ -55,11 +57,15 @@ func newTestSuite(t testing.TB) *test.Suite {
 }
 
 func TestBackend(t *testing.T) {
-	newTestSuite(t).RunTests(t)
+	newTestSuite(t, false).RunTests(t)
+}
+
+func TestBackendSecureDelete(t *testing.T) {
+	newTestSuite(t, true).RunTests(t)
 }
 
 func BenchmarkBackend(t *testing.B) {
-	newTestSuite(t).RunBenchmarks(t)
+	newTestSuite(t, false).RunBenchmarks(t)
 }
 
 func readdirnames(t testing.TB, dir string) []string {
@@ -134,3 +140,31 @@ func TestOpenNotExistingDirectory(t *testing.T) {
 	removeAll(t, filepath.Join(dir, "data"))
 	empty(t, dir)
 }
+
+func TestSecureDelete(t *testing.T) {
+	dir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+
+	be, err := local.Create(local.Config{Path: filepath.Join(dir, "repo"), SecureDelete: true})
+	rtest.OK(t, err)
+
+	data := rtest.Random(23, 200*1024)
+	id := restic.Hash(data)
+	h := restic.Handle{Type: restic.DataFile, Name: id.String()}
+	rtest.OK(t, be.Save(context.TODO(), h, restic.NewByteReader(data)))
+
+	// the second link to the file still exists after the file was removed
+	link := filepath.Join(dir, "link")
+	rtest.OK(t, os.Link(be.Filename(h), link))
+
+	rtest.OK(t, be.Remove(context.TODO(), h))
+
+	_, err = be.Stat(context.TODO(), h)
+	rtest.Assert(t, be.IsNotExist(err), "file still exists after Remove: %v", err)
+
+	buf, err := ioutil.ReadFile(link)
+	rtest.OK(t, err)
+	rtest.Equals(t, make([]byte, len(data)), buf)
+
+	rtest.OK(t, be.Close())
+}
@@ -4,9 +4,11 @@ import (
 	"net/url"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/restic/restic/internal/backend/b2"
 	"github.com/restic/restic/internal/backend/local"
+	"github.com/restic/restic/internal/backend/rclone"
 	"github.com/restic/restic/internal/backend/rest"
 	"github.com/restic/restic/internal/backend/s3"
 	"github.com/restic/restic/internal/backend/sftp"
@@ -171,6 +173,7 @@ var parseTests = []struct {
 				Bucket:      "bucketname",
 				Prefix:      "",
 				Connections: 5,
+				Timeout:     5 * time.Minute,
 			},
 		},
 	},
@@ -182,6 +185,7 @@ var parseTests = []struct {
 				Bucket:      "bucketname",
 				Prefix:      "",
 				Connections: 5,
+				Timeout:     5 * time.Minute,
 			},
 		},
 	},
@@ -193,6 +197,7 @@ var parseTests = []struct {
 				Bucket:      "bucketname",
 				Prefix:      "prefix/directory",
 				Connections: 5,
+				Timeout:     5 * time.Minute,
 			},
 		},
 	},
@@ -204,6 +209,7 @@ var parseTests = []struct {
 				Bucket:      "repo",
 				Prefix:      "",
 				Connections: 5,
+				Timeout:     5 * time.Minute,
 			},
 		},
 	},
@@ -215,6 +221,7 @@ var parseTests = []struct {
 				Bucket:      "repo",
 				Prefix:      "prefix/directory",
 				Connections: 5,
+				Timeout:     5 * time.Minute,
 			},
 		},
 	},
@@ -226,6 +233,7 @@ var parseTests = []struct {
 				Bucket:      "repo",
 				Prefix:      "",
 				Connections: 5,
+				Timeout:     5 * time.Minute,
 			},
 		},
 	},
@@ -237,6 +245,7 @@ var parseTests = []struct {
 				Bucket:      "repo",
 				Prefix:      "prefix/directory",
 				Connections: 5,
+				Timeout:     5 * time.Minute,
 			},
 		},
 	},
@@ -249,6 +258,7 @@ var parseTests = []struct {
 				Prefix:      "",
 				UseHTTP:     true,
 				Connections: 5,
+				Timeout:     5 * time.Minute,
 			},
 		},
 	},
@@ -259,6 +269,7 @@ var parseTests = []struct {
 				Container:   "container17",
 				Prefix:      "",
 				Connections: 5,
+				Timeout:     5 * time.Minute,
 			},
 		},
 	},
@@ -269,6 +280,7 @@ var parseTests = []struct {
 				Container:   "container17",
 				Prefix:      "prefix97",
 				Connections: 5,
+				Timeout:     5 * time.Minute,
 			},
 		},
 	},
@@ -278,6 +290,19 @@ var parseTests = []struct {
 			Config: rest.Config{
 				URL:         parseURL("http://hostname.foo:1234/"),
 				Connections: 5,
+				Timeout:     5 * time.Minute,
+			},
+		},
+	},
+	{
+		"rclone:remote:path/to/repo",
+		Location{Scheme: "rclone",
+			Config: rclone.Config{
+				Program:     "rclone",
+				Args:        "serve restic --stdio --b2-hard-delete --drive-use-trash=false",
+				Remote:      "remote:path/to/repo",
+				Connections: 5,
+				Timeout:     5 * time.Minute,
 			},
 		},
 	},
@@ -287,6 +312,7 @@ var parseTests = []struct {
 				Bucket:      "bucketname",
 				Prefix:      "prefix",
 				Connections: 5,
+				Timeout:     5 * time.Minute,
 			},
 		},
 	},
@@ -296,6 +322,7 @@ var parseTests = []struct {
 				Bucket:      "bucketname",
 				Prefix:      "",
 				Connections: 5,
+				Timeout:     5 * time.Minute,
 			},
 		},
 	},
@@ -57,8 +57,13 @@ func (be *MemoryBackend) IsNotExist(err error) bool {
 	return errors.Cause(err) == errNotFound
 }
 
+// IsPermanentError returns true if the error cannot be resolved by retrying.
+func (be *MemoryBackend) IsPermanentError(err error) bool {
+	return be.IsNotExist(err)
+}
+
 // Save adds new Data to the backend.
-func (be *MemoryBackend) Save(ctx context.Context, h restic.Handle, rd io.Reader) error {
+func (be *MemoryBackend) Save(ctx context.Context, h restic.Handle, rd restic.RewindReader) error {
 	if err := h.Valid(); err != nil {
 		return err
 	}
@@ -79,6 +84,10 @@ func (be *MemoryBackend) Save(ctx context.Context, h restic.Handle, rd io.Reader
 		return err
 	}
 
+	if int64(len(buf)) != rd.Length() {
+		return errors.Errorf("wrote %d bytes instead of the expected %d bytes", len(buf), rd.Length())
+	}
+
 	be.data[h] = buf
 	debug.Log("saved %v bytes at %v", len(buf), h)
 
@@ -0,0 +1,253 @@
+package rclone
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/restic/restic/internal/backend"
+	"github.com/restic/restic/internal/backend/rest"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+	"golang.org/x/net/context/ctxhttp"
+	"golang.org/x/net/http2"
+)
+
+// Backend is used to access data stored somewhere via rclone.
+type Backend struct {
+	restic.Backend
+
+	tr   *http2.Transport
+	cmd  *exec.Cmd
+	conn *StdioConn
+
+	// waitCh is closed when the process has exited, waitResult contains the
+	// error returned by cmd.Wait afterwards.
+	waitCh     <-chan struct{}
+	waitResult error
+
+	// wg tracks the goroutine forwarding the output on stderr.
+	wg sync.WaitGroup
+}
+
+// waitForExit is the time Close waits for rclone to exit after the
+// connection has been closed, before the process is killed.
+const waitForExit = 5 * time.Second
+
+// run starts command with args and returns a connection to its stdin and
+// stdout. Output written to stderr is passed to the debug log.
+func (be *Backend) run(command string, args ...string) error {
+	cmd := exec.Command(command, args...)
+	detachProcess(cmd)
+
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return errors.Wrap(err, "cmd.StderrPipe")
+	}
+
+	// use pipes instead of cmd.Std{in,out}Pipe(), these are closed by cmd.Wait
+	// before all data has been read
+	stdinRd, stdinWr, err := os.Pipe()
+	if err != nil {
+		return errors.Wrap(err, "os.Pipe")
+	}
+
+	stdoutRd, stdoutWr, err := os.Pipe()
+	if err != nil {
+		_ = stdinRd.Close()
+		_ = stdinWr.Close()
+		return errors.Wrap(err, "os.Pipe")
+	}
+
+	cmd.Stdin = stdinRd
+	cmd.Stdout = stdoutWr
+
+	debug.Log("start %v %v", command, args)
+	err = cmd.Start()
+
+	// the child's ends of the pipes are not needed any more
+	_ = stdinRd.Close()
+	_ = stdoutWr.Close()
+
+	if err != nil {
+		_ = stdinWr.Close()
+		_ = stdoutRd.Close()
+		return errors.Wrap(err, "cmd.Start")
+	}
+
+	be.wg.Add(1)
+	go func() {
+		defer be.wg.Done()
+		sc := bufio.NewScanner(stderr)
+		for sc.Scan() {
+			debug.Log("%v: %v", command, sc.Text())
+		}
+	}()
+
+	be.cmd = cmd
+	be.conn = &StdioConn{rd: stdoutRd, wr: stdinWr}
+	return nil
+}
+
+// New starts rclone and returns a backend which talks to it via HTTP/2 over
+// rclone's stdin and stdout. The REST backend is not set up yet.
+func New(cfg Config) (*Backend, error) {
+	args, err := backend.SplitShellStrings(cfg.Args)
+	if err != nil {
+		return nil, errors.Fatalf("unable to parse rclone arguments: %v", err)
+	}
+	args = append(args, cfg.Remote)
+
+	be := &Backend{}
+	err = be.run(cfg.Program, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to start rclone")
+	}
+
+	waitCh := make(chan struct{})
+	be.waitCh = waitCh
+	go func() {
+		// wait for the stderr goroutine first, cmd.Wait closes the pipe
+		be.wg.Wait()
+		err := be.cmd.Wait()
+		debug.Log("rclone exited with %v", err)
+		be.waitResult = err
+		close(waitCh)
+	}()
+
+	// there is only a single connection to rclone, it is handed to the
+	// transport exactly once
+	var dialed bool
+	var dialMu sync.Mutex
+	be.tr = &http2.Transport{
+		AllowHTTP: true, // this is not really HTTP, just stdin/stdout
+		DialTLS: func(network, address string, cfg *tls.Config) (net.Conn, error) {
+			dialMu.Lock()
+			defer dialMu.Unlock()
+
+			debug.Log("new connection requested, %v %v", network, address)
+			if dialed {
+				return nil, errors.New("connection to rclone is lost")
+			}
+			dialed = true
+			return be.conn, nil
+		},
+	}
+
+	// make sure rclone is there and answers requests
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	client := &http.Client{Transport: debug.RoundTripper(be.tr)}
+	req, err := http.NewRequest(http.MethodGet, "http://localhost/", nil)
+	if err != nil {
+		_ = be.Close()
+		return nil, errors.Wrap(err, "NewRequest")
+	}
+	req.Header.Set("Accept", "application/vnd.x.restic.rest.v2")
+
+	res, err := ctxhttp.Do(ctx, client, req)
+	if err != nil {
+		_ = be.Close()
+		return nil, errors.Fatalf("error talking HTTP to rclone: %v", err)
+	}
+	_ = res.Body.Close()
+
+	debug.Log("HTTP status %q returned, rclone is ready", res.Status)
+	return be, nil
+}
+
+// restConfig returns the configuration for the REST backend which is used to
+// send requests to rclone.
+func restConfig(cfg Config) rest.Config {
+	u, err := url.Parse("http://localhost/")
+	if err != nil {
+		panic(err)
+	}
+
+	restCfg := rest.NewConfig()
+	restCfg.URL = u
+	restCfg.Connections = cfg.Connections
+	return restCfg
+}
+
+// Open starts rclone and opens the repository stored at cfg.Remote.
+func Open(cfg Config) (*Backend, error) {
+	be, err := New(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	restBackend, err := rest.Open(restConfig(cfg), debug.RoundTripper(be.tr))
+	if err != nil {
+		_ = be.Close()
+		return nil, err
+	}
+
+	be.Backend = restBackend
+	return be, nil
+}
+
+// Create starts rclone and initializes a new repository at cfg.Remote.
+func Create(cfg Config) (*Backend, error) {
+	be, err := New(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	restBackend, err := rest.Create(restConfig(cfg), debug.RoundTripper(be.tr))
+	if err != nil {
+		_ = be.Close()
+		return nil, err
+	}
+
+	be.Backend = restBackend
+	return be, nil
+}
+
+// Close closes the connection to rclone, which then exits. If it does not
+// exit within a few seconds, the process is killed.
+func (be *Backend) Close() error {
+	debug.Log("exiting rclone")
+
+	var err error
+	if be.Backend != nil {
+		err = be.Backend.Close()
+	}
+
+	be.tr.CloseIdleConnections()
+	cerr := be.conn.Close()
+	if cerr != nil && err == nil {
+		err = cerr
+	}
+
+	select {
+	case <-be.waitCh:
+		debug.Log("rclone exited")
+	case <-time.After(waitForExit):
+		debug.Log("timeout, killing rclone")
+		if kerr := be.cmd.Process.Kill(); kerr != nil {
+			return errors.Wrap(kerr, "Kill")
+		}
+		<-be.waitCh
+		return err
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if be.waitResult != nil {
+		return fmt.Errorf("rclone exited with an error: %v", be.waitResult)
+	}
+	return nil
+}
@@ -0,0 +1,3 @@
+// Package rclone implements a backend which runs "rclone serve restic" as a
+// subprocess and talks to it via HTTP/2 over its stdin and stdout.
+package rclone
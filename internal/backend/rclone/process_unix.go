@@ -0,0 +1,17 @@
+// +build !windows
+
+package rclone
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// detachProcess runs cmd in a new process group, so that a SIGINT sent to
+// restic by pressing Ctrl-C does not terminate rclone before restic has
+// cleaned up.
+func detachProcess(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Setpgid: true,
+	}
+}
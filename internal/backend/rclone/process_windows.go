@@ -0,0 +1,14 @@
+package rclone
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// detachProcess runs cmd in a new process group, so that pressing Ctrl-C
+// does not terminate rclone before restic has cleaned up.
+func detachProcess(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP,
+	}
+}
@@ -0,0 +1,88 @@
+package rclone
+
+import (
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+)
+
+// StdioConn implements a net.Conn via the stdin and stdout of a process.
+type StdioConn struct {
+	// rd is connected to stdout of the process, wr to stdin.
+	rd    io.ReadCloser
+	wr    io.WriteCloser
+	close sync.Once
+}
+
+func (s *StdioConn) Read(p []byte) (int, error) {
+	return s.rd.Read(p)
+}
+
+func (s *StdioConn) Write(p []byte) (int, error) {
+	return s.wr.Write(p)
+}
+
+// Close closes both streams.
+func (s *StdioConn) Close() (err error) {
+	s.close.Do(func() {
+		debug.Log("close stdio connection")
+		var errs []error
+
+		for _, f := range []func() error{s.wr.Close, s.rd.Close} {
+			err := f()
+			if err != nil {
+				errs = append(errs, err)
+			}
+		}
+
+		if len(errs) > 0 {
+			err = errors.Errorf("closing the stdio connection failed: %v", errs)
+		}
+	})
+
+	return err
+}
+
+// LocalAddr returns a dummy address.
+func (s *StdioConn) LocalAddr() net.Addr {
+	return Addr{}
+}
+
+// RemoteAddr returns a dummy address.
+func (s *StdioConn) RemoteAddr() net.Addr {
+	return Addr{}
+}
+
+// SetDeadline is a no-op, deadlines are not supported for the pipes.
+func (s *StdioConn) SetDeadline(t time.Time) error {
+	return nil
+}
+
+// SetReadDeadline is a no-op, deadlines are not supported for the pipes.
+func (s *StdioConn) SetReadDeadline(t time.Time) error {
+	return nil
+}
+
+// SetWriteDeadline is a no-op, deadlines are not supported for the pipes.
+func (s *StdioConn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
+
+// make sure StdioConn implements net.Conn
+var _ net.Conn = &StdioConn{}
+
+// Addr implements net.Addr for stdin/stdout.
+type Addr struct{}
+
+// Network returns the network type as a string.
+func (a Addr) Network() string {
+	return "stdio"
+}
+
+func (a Addr) String() string {
+	return "stdio"
+}
@@ -3,6 +3,7 @@ package rest
 import (
 	"net/url"
 	"strings"
+	"time"
 
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/options"
@@ -11,7 +12,8 @@ import (
 // Config contains all configuration necessary to connect to a REST server.
 type Config struct {
 	URL         *url.URL
-	Connections uint `option:"connections" help:"set a limit for the number of concurrent connections (default: 5)"`
+	Connections uint          `option:"connections" help:"set a limit for the number of concurrent connections (default: 5)"`
+	Timeout     time.Duration `option:"timeout" help:"abort and retry requests which make no progress for the duration (default: 5m, 0 disables)"`
 }
 
 func init() {
@@ -22,6 +24,7 @@ func init() {
 func NewConfig() Config {
 	return Config{
 		Connections: 5,
+		Timeout:     5 * time.Minute,
 	}
 }
 
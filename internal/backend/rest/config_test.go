@@ -4,6 +4,7 @@ import (
 	"net/url"
 	"reflect"
 	"testing"
+	"time"
 )
 
 func parseURL(s string) *url.URL {
@@ -22,6 +23,7 @@ var configTests = []struct {
 	{"rest:http://localhost:1234", Config{
 		URL:         parseURL("http://localhost:1234"),
 		Connections: 5,
+		Timeout:     5 * time.Minute,
 	}},
 }
 
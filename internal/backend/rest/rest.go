@@ -105,7 +105,7 @@ func (b *restBackend) Location() string {
 }
 
 // Save stores data in the backend at the handle.
-func (b *restBackend) Save(ctx context.Context, h restic.Handle, rd io.Reader) (err error) {
+func (b *restBackend) Save(ctx context.Context, h restic.Handle, rd restic.RewindReader) (err error) {
 	if err := h.Valid(); err != nil {
 		return err
 	}
@@ -114,12 +114,11 @@ func (b *restBackend) Save(ctx context.Context, h restic.Handle, rd io.Reader) (
 	defer cancel()
 
 	// make sure that client.Post() cannot close the reader by wrapping it
-	rd = ioutil.NopCloser(rd)
-
-	req, err := http.NewRequest(http.MethodPost, b.Filename(h), rd)
+	req, err := http.NewRequest(http.MethodPost, b.Filename(h), ioutil.NopCloser(rd))
 	if err != nil {
 		return errors.Wrap(err, "NewRequest")
 	}
+	req.ContentLength = rd.Length()
 	req.Header.Set("Content-Type", "application/octet-stream")
 	req.Header.Set("Accept", contentTypeV2)
 
@@ -143,7 +142,7 @@ func (b *restBackend) Save(ctx context.Context, h restic.Handle, rd io.Reader) (
 	}
 
 	if resp.StatusCode != 200 {
-		return errors.Errorf("server response unexpected: %v (%v)", resp.Status, resp.StatusCode)
+		return ErrUnexpectedStatus{StatusCode: resp.StatusCode, Status: resp.Status}
 	}
 
 	return nil
@@ -166,6 +165,37 @@ func (b *restBackend) IsNotExist(err error) bool {
 	return ok
 }
 
+// ErrUnexpectedStatus is returned when the server responds with an unexpected
+// HTTP status code.
+type ErrUnexpectedStatus struct {
+	StatusCode int
+	Status     string
+}
+
+func (e ErrUnexpectedStatus) Error() string {
+	return fmt.Sprintf("unexpected HTTP response (%v): %v", e.StatusCode, e.Status)
+}
+
+// IsPermanentError returns true if the error cannot be resolved by retrying,
+// e.g. because the file does not exist or the credentials are invalid.
+func (b *restBackend) IsPermanentError(err error) bool {
+	if b.IsNotExist(err) {
+		return true
+	}
+
+	e, ok := errors.Cause(err).(ErrUnexpectedStatus)
+	if !ok {
+		return false
+	}
+
+	switch e.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return true
+	}
+
+	return false
+}
+
 // Load returns a reader that yields the contents of the file at h at the
 // given offset. If length is nonzero, only a portion of the file is
 // returned. rd must be closed after use.
@@ -215,7 +245,7 @@ func (b *restBackend) Load(ctx context.Context, h restic.Handle, length int, off
 
 	if resp.StatusCode != 200 && resp.StatusCode != 206 {
 		_ = resp.Body.Close()
-		return nil, errors.Errorf("unexpected HTTP response (%v): %v", resp.StatusCode, resp.Status)
+		return nil, ErrUnexpectedStatus{StatusCode: resp.StatusCode, Status: resp.Status}
 	}
 
 	return resp.Body, nil
@@ -251,7 +281,7 @@ func (b *restBackend) Stat(ctx context.Context, h restic.Handle) (restic.FileInf
 	}
 
 	if resp.StatusCode != 200 {
-		return restic.FileInfo{}, errors.Errorf("unexpected HTTP response (%v): %v", resp.StatusCode, resp.Status)
+		return restic.FileInfo{}, ErrUnexpectedStatus{StatusCode: resp.StatusCode, Status: resp.Status}
 	}
 
 	if resp.ContentLength < 0 {
@@ -1,6 +1,9 @@
 package s3
 
-import "testing"
+import (
+	"testing"
+	"time"
+)
 
 var configTests = []struct {
 	s   string
@@ -11,60 +14,70 @@ var configTests = []struct {
 		Bucket:      "bucketname",
 		Prefix:      "",
 		Connections: 5,
+		Timeout:     5 * time.Minute,
 	}},
 	{"s3://eu-central-1/bucketname/", Config{
 		Endpoint:    "eu-central-1",
 		Bucket:      "bucketname",
 		Prefix:      "",
 		Connections: 5,
+		Timeout:     5 * time.Minute,
 	}},
 	{"s3://eu-central-1/bucketname/prefix/directory", Config{
 		Endpoint:    "eu-central-1",
 		Bucket:      "bucketname",
 		Prefix:      "prefix/directory",
 		Connections: 5,
+		Timeout:     5 * time.Minute,
 	}},
 	{"s3://eu-central-1/bucketname/prefix/directory/", Config{
 		Endpoint:    "eu-central-1",
 		Bucket:      "bucketname",
 		Prefix:      "prefix/directory",
 		Connections: 5,
+		Timeout:     5 * time.Minute,
 	}},
 	{"s3:eu-central-1/foobar", Config{
 		Endpoint:    "eu-central-1",
 		Bucket:      "foobar",
 		Prefix:      "",
 		Connections: 5,
+		Timeout:     5 * time.Minute,
 	}},
 	{"s3:eu-central-1/foobar/", Config{
 		Endpoint:    "eu-central-1",
 		Bucket:      "foobar",
 		Prefix:      "",
 		Connections: 5,
+		Timeout:     5 * time.Minute,
 	}},
 	{"s3:eu-central-1/foobar/prefix/directory", Config{
 		Endpoint:    "eu-central-1",
 		Bucket:      "foobar",
 		Prefix:      "prefix/directory",
 		Connections: 5,
+		Timeout:     5 * time.Minute,
 	}},
 	{"s3:eu-central-1/foobar/prefix/directory/", Config{
 		Endpoint:    "eu-central-1",
 		Bucket:      "foobar",
 		Prefix:      "prefix/directory",
 		Connections: 5,
+		Timeout:     5 * time.Minute,
 	}},
 	{"s3:https://hostname:9999/foobar", Config{
 		Endpoint:    "hostname:9999",
 		Bucket:      "foobar",
 		Prefix:      "",
 		Connections: 5,
+		Timeout:     5 * time.Minute,
 	}},
 	{"s3:https://hostname:9999/foobar/", Config{
 		Endpoint:    "hostname:9999",
 		Bucket:      "foobar",
 		Prefix:      "",
 		Connections: 5,
+		Timeout:     5 * time.Minute,
 	}},
 	{"s3:http://hostname:9999/foobar", Config{
 		Endpoint:    "hostname:9999",
@@ -72,6 +85,7 @@ var configTests = []struct {
 		Prefix:      "",
 		UseHTTP:     true,
 		Connections: 5,
+		Timeout:     5 * time.Minute,
 	}},
 	{"s3:http://hostname:9999/foobar/", Config{
 		Endpoint:    "hostname:9999",
@@ -79,6 +93,7 @@ var configTests = []struct {
 		Prefix:      "",
 		UseHTTP:     true,
 		Connections: 5,
+		Timeout:     5 * time.Minute,
 	}},
 	{"s3:http://hostname:9999/bucket/prefix/directory", Config{
 		Endpoint:    "hostname:9999",
@@ -86,6 +101,7 @@ var configTests = []struct {
 		Prefix:      "prefix/directory",
 		UseHTTP:     true,
 		Connections: 5,
+		Timeout:     5 * time.Minute,
 	}},
 	{"s3:http://hostname:9999/bucket/prefix/directory/", Config{
 		Endpoint:    "hostname:9999",
@@ -93,6 +109,7 @@ var configTests = []struct {
 		Prefix:      "prefix/directory",
 		UseHTTP:     true,
 		Connections: 5,
+		Timeout:     5 * time.Minute,
 	}},
 }
 
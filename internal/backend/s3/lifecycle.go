@@ -0,0 +1,212 @@
+package s3
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+
+	"github.com/restic/restic/internal/backend"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+
+	"github.com/minio/minio-go"
+	"github.com/minio/minio-go/pkg/s3signer"
+)
+
+// make sure that *Backend can check the lifecycle rules of the bucket
+var _ restic.LifecycleChecker = &Backend{}
+
+// emptySHA256 is the SHA256 hash of an empty request body.
+const emptySHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// lifecycleConfiguration is the lifecycle configuration of a bucket.
+type lifecycleConfiguration struct {
+	Rules []lifecycleRule `xml:"Rule"`
+}
+
+type lifecycleRule struct {
+	ID     string `xml:"ID"`
+	Status string `xml:"Status"`
+
+	// the prefix is either specified directly (deprecated) or in the filter
+	Prefix string `xml:"Prefix"`
+	Filter struct {
+		Prefix string     `xml:"Prefix"`
+		Tag    *struct{}  `xml:"Tag"`
+		And    *ruleAndOp `xml:"And"`
+	} `xml:"Filter"`
+
+	Expiration *struct {
+		Days int    `xml:"Days"`
+		Date string `xml:"Date"`
+	} `xml:"Expiration"`
+	Transitions []struct {
+		StorageClass string `xml:"StorageClass"`
+	} `xml:"Transition"`
+}
+
+type ruleAndOp struct {
+	Prefix string     `xml:"Prefix"`
+	Tags   []struct{} `xml:"Tag"`
+}
+
+// prefix returns the prefix the rule applies to.
+func (r lifecycleRule) prefix() string {
+	switch {
+	case r.Filter.And != nil:
+		return r.Filter.And.Prefix
+	case r.Filter.Prefix != "":
+		return r.Filter.Prefix
+	}
+	return r.Prefix
+}
+
+// usesTags returns true if the rule only applies to objects with a tag.
+// restic does not tag objects, so these rules never apply.
+func (r lifecycleRule) usesTags() bool {
+	return r.Filter.Tag != nil || (r.Filter.And != nil && len(r.Filter.And.Tags) > 0)
+}
+
+// versioningConfiguration is the versioning configuration of a bucket.
+type versioningConfiguration struct {
+	Status string `xml:"Status"`
+}
+
+// archiveStorageClasses are the storage classes from which objects cannot be
+// read without restoring them first.
+var archiveStorageClasses = map[string]bool{
+	"GLACIER":      true,
+	"DEEP_ARCHIVE": true,
+}
+
+// getBucketConfig requests the bucket subresource (e.g. "lifecycle") and
+// decodes the XML response into v. The returned bool is false if the bucket
+// has no such configuration.
+func (be *Backend) getBucketConfig(ctx context.Context, region, subresource string, v interface{}) (bool, error) {
+	scheme := "https"
+	if be.cfg.UseHTTP {
+		scheme = "http"
+	}
+
+	host := be.cfg.Endpoint
+	if host == "s3.amazonaws.com" && region != "" && region != "us-east-1" {
+		host = "s3." + region + ".amazonaws.com"
+	}
+
+	u := url.URL{
+		Scheme:   scheme,
+		Host:     host,
+		Path:     "/" + be.cfg.Bucket + "/",
+		RawQuery: subresource,
+	}
+
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return false, errors.Wrap(err, "NewRequest")
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("X-Amz-Content-Sha256", emptySHA256)
+
+	creds, err := be.creds.Get()
+	if err != nil {
+		return false, errors.Wrap(err, "Credentials.Get")
+	}
+
+	if !creds.SignerType.IsAnonymous() {
+		req = s3signer.SignV4(*req, creds.AccessKeyID, creds.SecretAccessKey, creds.SessionToken, region)
+	}
+
+	res, err := (&http.Client{Transport: be.rt}).Do(req)
+	if err != nil {
+		return false, errors.Wrap(err, "Do")
+	}
+
+	defer func() {
+		_, _ = io.Copy(ioutil.Discard, res.Body)
+		_ = res.Body.Close()
+	}()
+
+	if res.StatusCode != http.StatusOK {
+		var e minio.ErrorResponse
+		if err := xml.NewDecoder(res.Body).Decode(&e); err != nil {
+			return false, errors.Errorf("unexpected HTTP response (%v): %v", res.StatusCode, res.Status)
+		}
+
+		if e.Code == "NoSuchLifecycleConfiguration" {
+			return false, nil
+		}
+
+		e.StatusCode = res.StatusCode
+		return false, e
+	}
+
+	err = xml.NewDecoder(res.Body).Decode(v)
+	if err != nil {
+		return false, errors.Wrap(err, "Decode")
+	}
+
+	return true, nil
+}
+
+// lifecycleProblems returns a description of the rules in lifecycle which
+// delete or hide files below prefix. In a versioned bucket, expired objects
+// are hidden instead of deleted.
+func lifecycleProblems(lifecycle lifecycleConfiguration, versioned bool, prefix string) []string {
+	expired := "deletes"
+	if versioned {
+		expired = "hides (as noncurrent versions)"
+	}
+
+	var problems []string
+	for _, rule := range lifecycle.Rules {
+		if rule.Status != "Enabled" || rule.usesTags() || !backend.PrefixAffected(rule.prefix(), prefix) {
+			continue
+		}
+
+		if rule.Expiration != nil && (rule.Expiration.Days > 0 || rule.Expiration.Date != "") {
+			problems = append(problems, fmt.Sprintf("lifecycle rule %q for prefix %q %s expired files", rule.ID, rule.prefix(), expired))
+		}
+
+		for _, t := range rule.Transitions {
+			if archiveStorageClasses[t.StorageClass] {
+				problems = append(problems, fmt.Sprintf("lifecycle rule %q for prefix %q moves files to storage class %v, from which they cannot be read directly", rule.ID, rule.prefix(), t.StorageClass))
+			}
+		}
+	}
+
+	return problems
+}
+
+// CheckLifecycle returns the lifecycle rules of the bucket which delete the
+// files of the repository or move them to a storage class from which they
+// cannot be read directly.
+func (be *Backend) CheckLifecycle(ctx context.Context) ([]string, error) {
+	region, err := be.client.GetBucketLocation(be.cfg.Bucket)
+	if err != nil {
+		return nil, errors.Wrap(err, "GetBucketLocation")
+	}
+
+	var lifecycle lifecycleConfiguration
+	found, err := be.getBucketConfig(ctx, region, "lifecycle", &lifecycle)
+	if err != nil {
+		return nil, err
+	}
+
+	if !found {
+		debug.Log("bucket %v has no lifecycle configuration", be.cfg.Bucket)
+		return nil, nil
+	}
+
+	var versioning versioningConfiguration
+	_, err = be.getBucketConfig(ctx, region, "versioning", &versioning)
+	if err != nil {
+		return nil, err
+	}
+
+	return lifecycleProblems(lifecycle, versioning.Status == "Enabled", be.cfg.Prefix), nil
+}
@@ -0,0 +1,95 @@
+package s3
+
+import (
+	"encoding/xml"
+	"testing"
+)
+
+const testLifecycle = `<LifecycleConfiguration xmlns="http://s3.amazonaws.com/doc/2006-03-01/">
+  <Rule>
+    <ID>expire-logs</ID>
+    <Filter><Prefix>logs/</Prefix></Filter>
+    <Status>Enabled</Status>
+    <Expiration><Days>30</Days></Expiration>
+  </Rule>
+  <Rule>
+    <ID>expire-all</ID>
+    <Filter><Prefix></Prefix></Filter>
+    <Status>Enabled</Status>
+    <Expiration><Days>365</Days></Expiration>
+  </Rule>
+  <Rule>
+    <ID>disabled</ID>
+    <Prefix>restic/</Prefix>
+    <Status>Disabled</Status>
+    <Expiration><Days>1</Days></Expiration>
+  </Rule>
+  <Rule>
+    <ID>tagged</ID>
+    <Filter><And><Prefix>restic/</Prefix><Tag><Key>tmp</Key><Value>1</Value></Tag></And></Filter>
+    <Status>Enabled</Status>
+    <Expiration><Days>1</Days></Expiration>
+  </Rule>
+  <Rule>
+    <ID>archive</ID>
+    <Filter><Prefix>restic/data/</Prefix></Filter>
+    <Status>Enabled</Status>
+    <Transition><Days>90</Days><StorageClass>STANDARD_IA</StorageClass></Transition>
+    <Transition><Days>180</Days><StorageClass>GLACIER</StorageClass></Transition>
+  </Rule>
+  <Rule>
+    <ID>old-versions</ID>
+    <Filter><Prefix>restic/</Prefix></Filter>
+    <Status>Enabled</Status>
+    <NoncurrentVersionExpiration><NoncurrentDays>7</NoncurrentDays></NoncurrentVersionExpiration>
+  </Rule>
+</LifecycleConfiguration>`
+
+func TestLifecycleProblems(t *testing.T) {
+	var lifecycle lifecycleConfiguration
+	if err := xml.Unmarshal([]byte(testLifecycle), &lifecycle); err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		prefix    string
+		versioned bool
+		problems  []string
+	}{
+		{
+			prefix: "restic",
+			problems: []string{
+				`lifecycle rule "expire-all" for prefix "" deletes expired files`,
+				`lifecycle rule "archive" for prefix "restic/data/" moves files to storage class GLACIER, from which they cannot be read directly`,
+			},
+		},
+		{
+			prefix:    "backup",
+			versioned: true,
+			problems: []string{
+				`lifecycle rule "expire-all" for prefix "" hides (as noncurrent versions) expired files`,
+			},
+		},
+		{
+			prefix: "logs",
+			problems: []string{
+				`lifecycle rule "expire-logs" for prefix "logs/" deletes expired files`,
+				`lifecycle rule "expire-all" for prefix "" deletes expired files`,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		problems := lifecycleProblems(lifecycle, test.versioned, test.prefix)
+		if len(problems) != len(test.problems) {
+			t.Errorf("prefix %q: wrong problems, want %q, got %q", test.prefix, test.problems, problems)
+			continue
+		}
+
+		for i := range problems {
+			if problems[i] != test.problems[i] {
+				t.Errorf("prefix %q: wrong problem %d, want %q, got %q", test.prefix, i, test.problems[i], problems[i])
+			}
+		}
+	}
+}
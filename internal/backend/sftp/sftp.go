@@ -177,9 +177,28 @@ func (r *SFTP) IsNotExist(err error) bool {
 	return statusError.Error() == `sftp: "No such file" (SSH_FX_NO_SUCH_FILE)`
 }
 
+// sftpPermissionDenied is the status code SSH_FX_PERMISSION_DENIED.
+const sftpPermissionDenied = 3
+
+// IsPermanentError returns true if the error cannot be resolved by retrying,
+// e.g. because the file does not exist or access is denied.
+func (r *SFTP) IsPermanentError(err error) bool {
+	if r.IsNotExist(err) {
+		return true
+	}
+
+	err = errors.Cause(err)
+	if os.IsPermission(err) {
+		return true
+	}
+
+	statusError, ok := err.(*sftp.StatusError)
+	return ok && statusError.Code == sftpPermissionDenied
+}
+
 func buildSSHCommand(cfg Config) (cmd string, args []string, err error) {
 	if cfg.Command != "" {
-		return SplitShellArgs(cfg.Command)
+		return backend.SplitShellArgs(cfg.Command)
 	}
 
 	cmd = "ssh"
@@ -282,7 +301,7 @@ func Join(parts ...string) string {
 }
 
 // Save stores data in the backend at the handle.
-func (r *SFTP) Save(ctx context.Context, h restic.Handle, rd io.Reader) (err error) {
+func (r *SFTP) Save(ctx context.Context, h restic.Handle, rd restic.RewindReader) (err error) {
 	debug.Log("Save %v", h)
 	if err := r.clientError(); err != nil {
 		return err
@@ -313,12 +332,18 @@ func (r *SFTP) Save(ctx context.Context, h restic.Handle, rd io.Reader) (err err
 	}
 
 	// save data
-	_, err = io.Copy(f, rd)
+	wbytes, err := io.Copy(f, rd)
 	if err != nil {
 		_ = f.Close()
 		return errors.Wrap(err, "Write")
 	}
 
+	// sanity check
+	if wbytes != rd.Length() {
+		_ = f.Close()
+		return errors.Errorf("wrote %d bytes instead of the expected %d bytes", wbytes, rd.Length())
+	}
+
 	err = f.Close()
 	if err != nil {
 		return errors.Wrap(err, "Close")
@@ -417,6 +442,10 @@ func (r *SFTP) List(ctx context.Context, t restic.FileType, fn func(restic.FileI
 	walker := r.c.Walk(basedir)
 	for walker.Step() {
 		if walker.Err() != nil {
+			// the directory for this type may not exist in older repositories
+			if walker.Path() == basedir && r.IsNotExist(walker.Err()) {
+				return ctx.Err()
+			}
 			return walker.Err()
 		}
 
@@ -1,4 +1,4 @@
-package sftp
+package backend
 
 import (
 	"unicode"
@@ -41,8 +41,9 @@ func (s *shellSplitter) isSplitChar(c rune) bool {
 	return c == '\\' || unicode.IsSpace(c)
 }
 
-// SplitShellArgs returns the list of arguments from a shell command string.
-func SplitShellArgs(data string) (cmd string, args []string, err error) {
+// SplitShellStrings returns the list of fields from a string with shell
+// quoting. An empty list is returned for an empty string.
+func SplitShellStrings(data string) (strs []string, err error) {
 	s := &shellSplitter{}
 
 	// derived from strings.SplitFunc
@@ -50,7 +51,7 @@ func SplitShellArgs(data string) (cmd string, args []string, err error) {
 	for i, rune := range data {
 		if s.isSplitChar(rune) {
 			if fieldStart >= 0 {
-				args = append(args, data[fieldStart:i])
+				strs = append(strs, data[fieldStart:i])
 				fieldStart = -1
 			}
 		} else if fieldStart == -1 {
@@ -58,14 +59,24 @@ func SplitShellArgs(data string) (cmd string, args []string, err error) {
 		}
 	}
 	if fieldStart >= 0 { // Last field might end at EOF.
-		args = append(args, data[fieldStart:])
+		strs = append(strs, data[fieldStart:])
 	}
 
 	switch s.quote {
 	case '\'':
-		return "", nil, errors.New("single-quoted string not terminated")
+		return nil, errors.New("single-quoted string not terminated")
 	case '"':
-		return "", nil, errors.New("double-quoted string not terminated")
+		return nil, errors.New("double-quoted string not terminated")
+	}
+
+	return strs, nil
+}
+
+// SplitShellArgs returns the list of arguments from a shell command string.
+func SplitShellArgs(data string) (cmd string, args []string, err error) {
+	args, err = SplitShellStrings(data)
+	if err != nil {
+		return "", nil, err
 	}
 
 	if len(args) == 0 {
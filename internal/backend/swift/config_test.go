@@ -1,6 +1,9 @@
 package swift
 
-import "testing"
+import (
+	"testing"
+	"time"
+)
 
 var configTests = []struct {
 	s   string
@@ -12,6 +15,7 @@ var configTests = []struct {
 			Container:   "cnt1",
 			Prefix:      "",
 			Connections: 5,
+			Timeout:     5 * time.Minute,
 		},
 	},
 	{
@@ -19,6 +23,7 @@ var configTests = []struct {
 		Config{Container: "cnt2",
 			Prefix:      "prefix",
 			Connections: 5,
+			Timeout:     5 * time.Minute,
 		},
 	},
 	{
@@ -26,6 +31,7 @@ var configTests = []struct {
 		Config{Container: "cnt3",
 			Prefix:      "prefix/longer",
 			Connections: 5,
+			Timeout:     5 * time.Minute,
 		},
 	},
 }
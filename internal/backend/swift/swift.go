@@ -153,7 +153,7 @@ func (be *beSwift) Load(ctx context.Context, h restic.Handle, length int, offset
 }
 
 // Save stores data in the backend at the handle.
-func (be *beSwift) Save(ctx context.Context, h restic.Handle, rd io.Reader) (err error) {
+func (be *beSwift) Save(ctx context.Context, h restic.Handle, rd restic.RewindReader) (err error) {
 	if err = h.Valid(); err != nil {
 		return err
 	}
@@ -303,6 +303,19 @@ func (be *beSwift) IsNotExist(err error) bool {
 	return false
 }
 
+// IsPermanentError returns true if the error cannot be resolved by retrying,
+// e.g. because the file does not exist or the credentials are invalid.
+func (be *beSwift) IsPermanentError(err error) bool {
+	if e, ok := errors.Cause(err).(*swift.Error); ok {
+		switch e.StatusCode {
+		case http.StatusNotFound, http.StatusUnauthorized, http.StatusForbidden:
+			return true
+		}
+	}
+
+	return false
+}
+
 // Delete removes all restic objects in the container.
 // It will not remove the container itself.
 func (be *beSwift) Delete(ctx context.Context) error {
@@ -0,0 +1,217 @@
+// Package tiered implements a backend which splits a repository between two
+// backends: pack files with file data are stored in a cold backend, which can
+// be slow and cheap, everything else (config, keys, index, snapshots, locks
+// and pack files with trees) in a hot backend.
+package tiered
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+)
+
+// Backend distributes the files of a repository between two backends.
+type Backend struct {
+	hot, cold restic.Backend
+
+	// hotPacks contains the names of the pack files stored in the hot
+	// backend, it is loaded when a pack file is accessed for the first time.
+	m        sync.Mutex
+	hotPacks map[string]struct{}
+}
+
+// make sure that *Backend implements restic.Backend
+var _ restic.Backend = &Backend{}
+
+// New returns a backend which stores pack files with data blobs in cold and
+// all other files in hot.
+func New(hot, cold restic.Backend) *Backend {
+	return &Backend{hot: hot, cold: cold}
+}
+
+// loadHotPacks lists the pack files in the hot backend, it must be called
+// with be.m held.
+func (be *Backend) loadHotPacks(ctx context.Context) error {
+	if be.hotPacks != nil {
+		return nil
+	}
+
+	packs := make(map[string]struct{})
+	err := be.hot.List(ctx, restic.DataFile, func(fi restic.FileInfo) error {
+		packs[fi.Name] = struct{}{}
+		return nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "listing pack files in the hot backend")
+	}
+
+	debug.Log("%d pack files in the hot backend", len(packs))
+	be.hotPacks = packs
+	return nil
+}
+
+// backend returns the backend which stores the file h.
+func (be *Backend) backend(ctx context.Context, h restic.Handle) (restic.Backend, error) {
+	if h.Type != restic.DataFile {
+		return be.hot, nil
+	}
+
+	be.m.Lock()
+	defer be.m.Unlock()
+
+	if err := be.loadHotPacks(ctx); err != nil {
+		return nil, err
+	}
+
+	if _, ok := be.hotPacks[h.Name]; ok {
+		return be.hot, nil
+	}
+	return be.cold, nil
+}
+
+// Location returns the locations of both backends.
+func (be *Backend) Location() string {
+	return be.hot.Location() + " (data packs: " + be.cold.Location() + ")"
+}
+
+// Test returns whether the file h exists.
+func (be *Backend) Test(ctx context.Context, h restic.Handle) (bool, error) {
+	b, err := be.backend(ctx, h)
+	if err != nil {
+		return false, err
+	}
+	return b.Test(ctx, h)
+}
+
+// Remove removes the file h.
+func (be *Backend) Remove(ctx context.Context, h restic.Handle) error {
+	b, err := be.backend(ctx, h)
+	if err != nil {
+		return err
+	}
+
+	err = b.Remove(ctx, h)
+	if err != nil {
+		return err
+	}
+
+	if h.Type == restic.DataFile {
+		be.m.Lock()
+		delete(be.hotPacks, h.Name)
+		be.m.Unlock()
+	}
+
+	return nil
+}
+
+// Close closes both backends.
+func (be *Backend) Close() error {
+	err := be.hot.Close()
+	if cerr := be.cold.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Save stores the data from rd under the handle h. Pack files are stored in
+// the cold backend unless the context passed to Save marks them as
+// containing only trees.
+func (be *Backend) Save(ctx context.Context, h restic.Handle, rd restic.RewindReader) error {
+	if h.Type != restic.DataFile {
+		return be.hot.Save(ctx, h, rd)
+	}
+
+	if t, ok := restic.PackTypeFromContext(ctx); !ok || t != restic.TreeBlob {
+		debug.Log("saving pack %v in the cold backend", h)
+		return be.cold.Save(ctx, h, rd)
+	}
+
+	be.m.Lock()
+	defer be.m.Unlock()
+
+	if err := be.loadHotPacks(ctx); err != nil {
+		return err
+	}
+
+	debug.Log("saving tree pack %v in the hot backend", h)
+	err := be.hot.Save(ctx, h, rd)
+	if err != nil {
+		return err
+	}
+
+	be.hotPacks[h.Name] = struct{}{}
+	return nil
+}
+
+// Load returns a reader for the file h.
+func (be *Backend) Load(ctx context.Context, h restic.Handle, length int, offset int64) (io.ReadCloser, error) {
+	b, err := be.backend(ctx, h)
+	if err != nil {
+		return nil, err
+	}
+	return b.Load(ctx, h, length, offset)
+}
+
+// Stat returns information about the file h.
+func (be *Backend) Stat(ctx context.Context, h restic.Handle) (restic.FileInfo, error) {
+	b, err := be.backend(ctx, h)
+	if err != nil {
+		return restic.FileInfo{}, err
+	}
+	return b.Stat(ctx, h)
+}
+
+// List runs fn for each file of type t. For pack files, the files in both
+// backends are listed.
+func (be *Backend) List(ctx context.Context, t restic.FileType, fn func(restic.FileInfo) error) error {
+	if t != restic.DataFile {
+		return be.hot.List(ctx, t, fn)
+	}
+
+	packs := make(map[string]struct{})
+	err := be.hot.List(ctx, t, func(fi restic.FileInfo) error {
+		packs[fi.Name] = struct{}{}
+		return fn(fi)
+	})
+	if err != nil {
+		return err
+	}
+
+	// the list is complete, merge it with packs saved in the meantime
+	be.m.Lock()
+	if be.hotPacks == nil {
+		be.hotPacks = packs
+	} else {
+		for name := range packs {
+			be.hotPacks[name] = struct{}{}
+		}
+	}
+	be.m.Unlock()
+
+	return be.cold.List(ctx, t, fn)
+}
+
+// IsNotExist returns true if the error was caused by a non-existing file in
+// one of the backends.
+func (be *Backend) IsNotExist(err error) bool {
+	return be.hot.IsNotExist(err) || be.cold.IsNotExist(err)
+}
+
+// IsPermanentError returns true if the error cannot be resolved by retrying
+// the operation in one of the backends.
+func (be *Backend) IsPermanentError(err error) bool {
+	return be.hot.IsPermanentError(err) || be.cold.IsPermanentError(err)
+}
+
+// Delete removes all data in both backends.
+func (be *Backend) Delete(ctx context.Context) error {
+	err := be.hot.Delete(ctx)
+	if err != nil {
+		return err
+	}
+	return be.cold.Delete(ctx)
+}
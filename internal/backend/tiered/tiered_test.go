@@ -0,0 +1,141 @@
+package tiered_test
+
+import (
+	"context"
+	"io/ioutil"
+	"sort"
+	"testing"
+
+	"github.com/restic/restic/internal/backend/mem"
+	"github.com/restic/restic/internal/backend/test"
+	"github.com/restic/restic/internal/backend/tiered"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+type tieredConfig struct {
+	hot, cold restic.Backend
+}
+
+func newTestSuite() *test.Suite {
+	return &test.Suite{
+		// NewConfig returns a config for a new temporary backend that will be used in tests.
+		NewConfig: func() (interface{}, error) {
+			return &tieredConfig{}, nil
+		},
+
+		// CreateFn is a function that creates a temporary repository for the tests.
+		Create: func(cfg interface{}) (restic.Backend, error) {
+			c := cfg.(*tieredConfig)
+			if c.hot != nil {
+				ok, err := c.hot.Test(context.TODO(), restic.Handle{Type: restic.ConfigFile})
+				if err != nil {
+					return nil, err
+				}
+
+				if ok {
+					return nil, errors.New("config already exists")
+				}
+			}
+
+			c.hot, c.cold = mem.New(), mem.New()
+			return tiered.New(c.hot, c.cold), nil
+		},
+
+		// OpenFn is a function that opens a previously created temporary repository.
+		Open: func(cfg interface{}) (restic.Backend, error) {
+			c := cfg.(*tieredConfig)
+			if c.hot == nil {
+				c.hot, c.cold = mem.New(), mem.New()
+			}
+			return tiered.New(c.hot, c.cold), nil
+		},
+
+		// CleanupFn removes data created during the tests.
+		Cleanup: func(cfg interface{}) error {
+			// no cleanup needed
+			return nil
+		},
+	}
+}
+
+func TestSuiteBackendTiered(t *testing.T) {
+	newTestSuite().RunTests(t)
+}
+
+func save(t testing.TB, ctx context.Context, be restic.Backend, h restic.Handle, data string) {
+	err := be.Save(ctx, h, restic.NewByteReader([]byte(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func exists(t testing.TB, be restic.Backend, h restic.Handle) bool {
+	ok, err := be.Test(context.TODO(), h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ok
+}
+
+func TestTieredPlacement(t *testing.T) {
+	ctx := context.TODO()
+	hot, cold := mem.New(), mem.New()
+	be := tiered.New(hot, cold)
+
+	config := restic.Handle{Type: restic.ConfigFile}
+	index := restic.Handle{Type: restic.IndexFile, Name: restic.NewRandomID().String()}
+	treePack := restic.Handle{Type: restic.DataFile, Name: restic.NewRandomID().String()}
+	dataPack := restic.Handle{Type: restic.DataFile, Name: restic.NewRandomID().String()}
+	unknownPack := restic.Handle{Type: restic.DataFile, Name: restic.NewRandomID().String()}
+
+	save(t, ctx, be, config, "config")
+	save(t, ctx, be, index, "index")
+	save(t, restic.WithPackType(ctx, restic.TreeBlob), be, treePack, "trees")
+	save(t, restic.WithPackType(ctx, restic.DataBlob), be, dataPack, "data")
+	save(t, ctx, be, unknownPack, "unknown")
+
+	var tests = []struct {
+		h       restic.Handle
+		hot     bool
+		content string
+	}{
+		{config, true, "config"},
+		{index, true, "index"},
+		{treePack, true, "trees"},
+		{dataPack, false, "data"},
+		{unknownPack, false, "unknown"},
+	}
+
+	// use a new instance so that the location of the packs is not known yet
+	be = tiered.New(hot, cold)
+
+	for _, test := range tests {
+		rtest.Equals(t, test.hot, exists(t, hot, test.h))
+		rtest.Equals(t, !test.hot, exists(t, cold, test.h))
+
+		rd, err := be.Load(ctx, test.h, 0, 0)
+		rtest.OK(t, err)
+		buf, err := ioutil.ReadAll(rd)
+		rtest.OK(t, err)
+		rtest.OK(t, rd.Close())
+		rtest.Equals(t, test.content, string(buf))
+	}
+
+	var packs []string
+	err := be.List(ctx, restic.DataFile, func(fi restic.FileInfo) error {
+		packs = append(packs, fi.Name)
+		return nil
+	})
+	rtest.OK(t, err)
+
+	want := []string{treePack.Name, dataPack.Name, unknownPack.Name}
+	sort.Strings(want)
+	sort.Strings(packs)
+	rtest.Equals(t, want, packs)
+
+	rtest.OK(t, be.Remove(ctx, treePack))
+	rtest.Assert(t, !exists(t, hot, treePack), "tree pack was not removed from the hot backend")
+	rtest.Assert(t, !exists(t, be, treePack), "tree pack still exists")
+}
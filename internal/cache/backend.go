@@ -5,8 +5,8 @@ import (
 	"io"
 	"sync"
 
-	"github.com/pkg/errors"
 	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/metrics"
 	"github.com/restic/restic/internal/restic"
 )
 
@@ -49,36 +49,66 @@ var autoCacheTypes = map[restic.FileType]struct{}{
 	restic.SnapshotFile: struct{}{},
 }
 
+// List runs fn for each file of type t in the backend. When all files of a
+// type which is cached automatically have been listed successfully, files
+// which have been removed from the repository (e.g. by another client) are
+// also removed from the cache.
+func (b *Backend) List(ctx context.Context, t restic.FileType, fn func(restic.FileInfo) error) error {
+	if _, ok := autoCacheTypes[t]; !ok {
+		return b.Backend.List(ctx, t, fn)
+	}
+
+	valid := restic.NewIDSet()
+	err := b.Backend.List(ctx, t, func(fi restic.FileInfo) error {
+		id, err := restic.ParseID(fi.Name)
+		if err == nil {
+			valid.Insert(id)
+		}
+
+		return fn(fi)
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	debug.Log("List(%v): removing stale files from the cache", t)
+	if err = b.Cache.Clear(t, valid); err != nil {
+		// the cache is only an optimization, the listing itself was successful
+		debug.Log("unable to clear the cache: %v", err)
+	}
+
+	return nil
+}
+
 // Save stores a new file in the backend and the cache.
-func (b *Backend) Save(ctx context.Context, h restic.Handle, rd io.Reader) (err error) {
+func (b *Backend) Save(ctx context.Context, h restic.Handle, rd restic.RewindReader) error {
 	if _, ok := autoCacheTypes[h.Type]; !ok {
 		return b.Backend.Save(ctx, h, rd)
 	}
 
 	debug.Log("Save(%v): auto-store in the cache", h)
 
-	seeker, ok := rd.(io.Seeker)
-	if !ok {
-		return errors.New("reader is not a seeker")
-	}
-
-	pos, err := seeker.Seek(0, io.SeekCurrent)
+	// make sure the reader is at the start
+	err := rd.Rewind()
 	if err != nil {
-		return errors.Wrapf(err, "Seek")
-	}
-
-	if pos != 0 {
-		return errors.Errorf("reader is not rewind (pos %d)", pos)
+		return err
 	}
 
+	// first, save in the backend
 	err = b.Backend.Save(ctx, h, rd)
 	if err != nil {
 		return err
 	}
 
-	_, err = seeker.Seek(pos, io.SeekStart)
+	// next, save in the cache
+	err = rd.Rewind()
 	if err != nil {
-		return errors.Wrapf(err, "Seek")
+		return err
 	}
 
 	err = b.Cache.Save(h, rd)
@@ -98,14 +128,6 @@ var autoCacheFiles = map[restic.FileType]bool{
 
 func (b *Backend) cacheFile(ctx context.Context, h restic.Handle) error {
 	finish := make(chan struct{})
-	defer func() {
-		close(finish)
-
-		// remove the finish channel from the map
-		b.inProgressMutex.Lock()
-		delete(b.inProgress, h)
-		b.inProgressMutex.Unlock()
-	}()
 
 	b.inProgressMutex.Lock()
 	other, alreadyDownloading := b.inProgress[h]
@@ -121,12 +143,35 @@ func (b *Backend) cacheFile(ctx context.Context, h restic.Handle) error {
 		return nil
 	}
 
+	defer func() {
+		close(finish)
+
+		// remove the finish channel from the map
+		b.inProgressMutex.Lock()
+		delete(b.inProgress, h)
+		b.inProgressMutex.Unlock()
+	}()
+
+	// other processes using the same cache may download the file at the
+	// same time, wait for them to finish
+	unlock, err := b.Cache.lock(h)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if b.Cache.Has(h) {
+		debug.Log("%v has been cached by another process", h)
+		return nil
+	}
+
 	rd, err := b.Backend.Load(ctx, h, 0, 0)
 	if err != nil {
 		return err
 	}
 
 	if err = b.Cache.Save(h, rd); err != nil {
+		_ = rd.Close()
 		return err
 	}
 
@@ -150,8 +195,28 @@ func (b *Backend) loadFromCacheOrDelegate(ctx context.Context, h restic.Handle,
 	return b.Backend.Load(ctx, h, length, offset)
 }
 
-// Load loads a file from the cache or the backend.
+// Load loads a file from the cache or the backend. For pack files, the number
+// of reads is recorded in the cache's statistics, the hits and misses of all
+// files are counted in the metrics.
 func (b *Backend) Load(ctx context.Context, h restic.Handle, length int, offset int64) (io.ReadCloser, error) {
+	rd, hit, err := b.load(ctx, h, length, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	if hit {
+		metrics.CacheHits.Inc()
+	} else {
+		metrics.CacheMisses.Inc()
+	}
+
+	b.Cache.recordRead(h, hit)
+	return b.Cache.countReads(h, rd), nil
+}
+
+// load loads a file from the cache or the backend, hit is true if the file
+// was already present in the cache.
+func (b *Backend) load(ctx context.Context, h restic.Handle, length int, offset int64) (rd io.ReadCloser, hit bool, err error) {
 	b.inProgressMutex.Lock()
 	waitForFinish, inProgress := b.inProgress[h]
 	b.inProgressMutex.Unlock()
@@ -166,7 +231,7 @@ func (b *Backend) Load(ctx context.Context, h restic.Handle, length int, offset
 		debug.Log("Load(%v, %v, %v) from cache", h, length, offset)
 		rd, err := b.Cache.Load(h, length, offset)
 		if err == nil {
-			return rd, nil
+			return rd, true, nil
 		}
 		debug.Log("error loading %v from cache: %v", h, err)
 	}
@@ -178,32 +243,37 @@ func (b *Backend) Load(ctx context.Context, h restic.Handle, length int, offset
 
 			err := b.cacheFile(ctx, h)
 			if err == nil {
-				return b.loadFromCacheOrDelegate(ctx, h, length, offset)
+				rd, err = b.loadFromCacheOrDelegate(ctx, h, length, offset)
+				return rd, false, err
 			}
 
 			debug.Log("error caching %v: %v", h, err)
 		}
 
 		debug.Log("Load(%v, %v, %v): partial file requested, delegating to backend", h, length, offset)
-		return b.Backend.Load(ctx, h, length, offset)
+		rd, err = b.Backend.Load(ctx, h, length, offset)
+		return rd, false, err
 	}
 
 	// if we don't automatically cache this file type, fall back to the backend
 	if _, ok := autoCacheFiles[h.Type]; !ok {
 		debug.Log("Load(%v, %v, %v): delegating to backend", h, length, offset)
-		return b.Backend.Load(ctx, h, length, offset)
+		rd, err = b.Backend.Load(ctx, h, length, offset)
+		return rd, false, err
 	}
 
 	debug.Log("auto-store %v in the cache", h)
-	err := b.cacheFile(ctx, h)
+	err = b.cacheFile(ctx, h)
 
 	if err == nil {
 		// load the cached version
-		return b.Cache.Load(h, 0, 0)
+		rd, err = b.Cache.Load(h, 0, 0)
+		return rd, false, err
 	}
 
 	debug.Log("error caching %v: %v, falling back to backend", h, err)
-	return b.Backend.Load(ctx, h, length, offset)
+	rd, err = b.Backend.Load(ctx, h, length, offset)
+	return rd, false, err
 }
 
 // Stat tests whether the backend has a file. If it does not exist but still
@@ -228,3 +298,8 @@ func (b *Backend) Stat(ctx context.Context, h restic.Handle) (restic.FileInfo, e
 func (b *Backend) IsNotExist(err error) bool {
 	return b.Backend.IsNotExist(err)
 }
+
+// IsPermanentError returns true if the error cannot be resolved by retrying.
+func (b *Backend) IsPermanentError(err error) bool {
+	return b.Backend.IsPermanentError(err)
+}
@@ -3,7 +3,12 @@ package cache
 import (
 	"bytes"
 	"context"
+	"io"
+	"io/ioutil"
 	"math/rand"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
 	"testing"
 
 	"github.com/restic/restic/internal/backend"
@@ -28,7 +33,7 @@ func loadAndCompare(t testing.TB, be restic.Backend, h restic.Handle, data []byt
 }
 
 func save(t testing.TB, be restic.Backend, h restic.Handle, data []byte) {
-	err := be.Save(context.TODO(), h, bytes.NewReader(data))
+	err := be.Save(context.TODO(), h, restic.NewByteReader(data))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -112,3 +117,211 @@ func TestBackend(t *testing.T) {
 		t.Errorf("removed file still in cache after stat")
 	}
 }
+
+func TestBackendListClearsStaleFiles(t *testing.T) {
+	be := mem.New()
+
+	c, cleanup := TestNewCache(t)
+	defer cleanup()
+
+	wbe := c.Wrap(be)
+
+	h1, data1 := randomData(512)
+	h2, data2 := randomData(512)
+
+	// save via cache
+	save(t, wbe, h1, data1)
+	save(t, wbe, h2, data2)
+	if !c.Has(h1) || !c.Has(h2) {
+		t.Fatalf("cache doesn't have files after save")
+	}
+
+	// remove directly, as another client would do
+	remove(t, be, h1)
+	if !c.Has(h1) {
+		t.Fatalf("file not in cache any more")
+	}
+
+	// an aborted listing must not remove anything
+	ctx, cancel := context.WithCancel(context.TODO())
+	cancel()
+	_ = wbe.List(ctx, restic.IndexFile, func(restic.FileInfo) error {
+		return nil
+	})
+	if !c.Has(h1) {
+		t.Errorf("stale file removed from cache after aborted List")
+	}
+
+	var names []string
+	err := wbe.List(context.TODO(), restic.IndexFile, func(fi restic.FileInfo) error {
+		names = append(names, fi.Name)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(names) != 1 || names[0] != h2.Name {
+		t.Errorf("wrong files listed, want [%v], got %v", h2.Name, names)
+	}
+
+	if c.Has(h1) {
+		t.Errorf("stale file still in cache after List")
+	}
+
+	if !c.Has(h2) {
+		t.Errorf("valid file removed from cache after List")
+	}
+}
+
+func TestBackendStats(t *testing.T) {
+	be := mem.New()
+
+	c, cleanup := TestNewCache(t)
+	defer cleanup()
+
+	wbe := c.Wrap(be)
+
+	data := test.Random(23, 2000)
+	id := restic.Hash(data)
+	h := restic.Handle{Type: restic.DataFile, Name: id.String()}
+	save(t, be, h, data)
+
+	// read the complete file twice and a part once
+	loadAndCompare(t, wbe, h, data)
+	loadAndCompare(t, wbe, h, data)
+
+	rd, err := wbe.Load(context.TODO(), h, 100, 50)
+	test.OK(t, err)
+	_, err = ioutil.ReadAll(rd)
+	test.OK(t, err)
+	test.OK(t, rd.Close())
+
+	// reads of other file types are not recorded
+	hi, idx := randomData(500)
+	save(t, be, hi, idx)
+	loadAndCompare(t, wbe, hi, idx)
+
+	stats, err := c.Stats()
+	test.OK(t, err)
+	test.Equals(t, 1, len(stats))
+	test.Equals(t, uint64(3), stats[id].Reads)
+	test.Equals(t, uint64(2*2000+100), stats[id].BytesRead)
+
+	test.OK(t, c.SaveStats())
+
+	// the saved statistics are available in a new cache for the same directory
+	c2, err := New(filepath.Base(c.Path), c.Base)
+	test.OK(t, err)
+
+	stats, err = c2.Stats()
+	test.OK(t, err)
+	test.Equals(t, uint64(3), stats[id].Reads)
+
+	// statistics from several processes are merged
+	loadAndCompare(t, c2.Wrap(be), h, data)
+	test.OK(t, c2.SaveStats())
+
+	stats, err = c.Stats()
+	test.OK(t, err)
+	test.Equals(t, uint64(4), stats[id].Reads)
+	test.Equals(t, uint64(3*2000+100), stats[id].BytesRead)
+
+	files, size, err := c.Usage(restic.IndexFile)
+	test.OK(t, err)
+	test.Equals(t, 1, files)
+	test.Equals(t, int64(500), size)
+}
+
+func TestSaveStatsConcurrent(t *testing.T) {
+	c, cleanup := TestNewCache(t)
+	defer cleanup()
+
+	id := restic.NewRandomID()
+	h := restic.Handle{Type: restic.DataFile, Name: id.String()}
+
+	// several processes using the same cache directory save their
+	// statistics at the same time, no reads are lost
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		c2, err := New(filepath.Base(c.Path), c.Base)
+		test.OK(t, err)
+		c2.recordRead(h, false)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := c2.SaveStats(); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	stats, err := c.Stats()
+	test.OK(t, err)
+	test.Equals(t, uint64(10), stats[id].Reads)
+}
+
+// loadCountingBackend counts the number of calls to Load.
+type loadCountingBackend struct {
+	restic.Backend
+	loads int32
+}
+
+func (be *loadCountingBackend) Load(ctx context.Context, h restic.Handle, length int, offset int64) (io.ReadCloser, error) {
+	atomic.AddInt32(&be.loads, 1)
+	return be.Backend.Load(ctx, h, length, offset)
+}
+
+func TestBackendConcurrentCaches(t *testing.T) {
+	be := &loadCountingBackend{Backend: mem.New()}
+
+	c1, cleanup := TestNewCache(t)
+	defer cleanup()
+
+	// a second cache for the same repository in the same directory, as used
+	// by another process
+	c2, err := New(filepath.Base(c1.Path), c1.Base)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	backends := []restic.Backend{c1.Wrap(be), c2.Wrap(be)}
+
+	h, data := randomData(5234142)
+	save(t, be.Backend, h, data)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(wbe restic.Backend) {
+			defer wg.Done()
+
+			buf, err := backend.LoadAll(context.TODO(), wbe, h)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+
+			if !bytes.Equal(buf, data) {
+				t.Errorf("wrong data returned")
+			}
+		}(backends[i%len(backends)])
+	}
+	wg.Wait()
+
+	if be.loads != 1 {
+		t.Errorf("file was downloaded %d times, want 1", be.loads)
+	}
+
+	// no temporary files are left in the cache
+	files, err := ioutil.ReadDir(filepath.Dir(c1.filename(h)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(files) != 1 || files[0].Name() != h.Name {
+		t.Errorf("unexpected files in the cache: %v", files)
+	}
+}
@@ -19,6 +19,8 @@ type Cache struct {
 	Path             string
 	Base             string
 	PerformReadahead func(restic.Handle) bool
+
+	stats *packStats
 }
 
 const dirMode = 0700
@@ -137,6 +139,9 @@ func New(id string, basedir string) (c *Cache, err error) {
 		}
 	}
 
+	// temporary files of processes which were interrupted are never renamed
+	removeStaleTempFiles(cachedir)
+
 	c = &Cache{
 		Path: cachedir,
 		Base: basedir,
@@ -144,11 +149,47 @@ func New(id string, basedir string) (c *Cache, err error) {
 			// do not perform readahead by default
 			return false
 		},
+		stats: newPackStats(),
 	}
 
 	return c, nil
 }
 
+// maxTempAge is the time after which a temporary file which has not been
+// modified is considered stale. Files which are written by other processes
+// are modified continuously.
+const maxTempAge = time.Hour
+
+// removeStaleTempFiles removes the temporary files in cachedir and the
+// directories for the cached files which were not modified within maxTempAge.
+func removeStaleTempFiles(cachedir string) {
+	patterns := []string{filepath.Join(cachedir, tempPrefix+"*")}
+	for _, p := range cacheLayoutPaths {
+		patterns = append(patterns, filepath.Join(cachedir, p, "*", tempPrefix+"*"))
+	}
+
+	oldest := time.Now().Add(-maxTempAge)
+	for _, pattern := range patterns {
+		names, err := filepath.Glob(pattern)
+		if err != nil {
+			debug.Log("Glob(%v) failed: %v", pattern, err)
+			continue
+		}
+
+		for _, name := range names {
+			fi, err := fs.Lstat(name)
+			if err != nil || !fi.Mode().IsRegular() || !fi.ModTime().Before(oldest) {
+				continue
+			}
+
+			debug.Log("removing stale temporary file %v", name)
+			if err = fs.Remove(name); err != nil {
+				debug.Log("unable to remove %v: %v", name, err)
+			}
+		}
+	}
+}
+
 // updateTimestamp sets the modification timestamp (mtime and atime) for the
 // directory d to the current time.
 func updateTimestamp(d string) error {
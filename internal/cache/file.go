@@ -2,6 +2,7 @@ package cache
 
 import (
 	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 
@@ -12,6 +13,10 @@ import (
 	"github.com/restic/restic/internal/restic"
 )
 
+// tempPrefix is the prefix of the temporary files used while a file is
+// saved in the cache.
+const tempPrefix = "tmp-"
+
 func (c *Cache) filename(h restic.Handle) string {
 	if len(h.Name) < 2 {
 		panic("Name is empty or too short")
@@ -78,8 +83,49 @@ func (c *Cache) Load(h restic.Handle, length int, offset int64) (io.ReadCloser,
 	return rd, nil
 }
 
-// SaveWriter returns a writer for the cache object h. It must be closed after writing is finished.
+// cacheWriter writes a file to a temporary file within the cache, which is
+// renamed to the final name when the writer is closed. This way, other
+// processes using the same cache never see partially written files.
+type cacheWriter struct {
+	*os.File
+	filename string
+}
+
+// Close moves the file to its final location.
+func (w *cacheWriter) Close() error {
+	tempname := w.File.Name()
+	if err := w.File.Close(); err != nil {
+		_ = fs.Remove(tempname)
+		return errors.Wrap(err, "Close")
+	}
+
+	if err := fs.Rename(tempname, w.filename); err != nil {
+		_ = fs.Remove(tempname)
+
+		// the file may have been saved concurrently by another process
+		if _, serr := fs.Stat(w.filename); serr == nil {
+			return nil
+		}
+
+		return errors.Wrap(err, "Rename")
+	}
+
+	return nil
+}
+
+// abort removes the temporary file.
+func (w *cacheWriter) abort() {
+	_ = w.File.Close()
+	_ = fs.Remove(w.File.Name())
+}
+
+// SaveWriter returns a writer for the cache object h. It must be closed after
+// writing is finished, the file is only visible in the cache afterwards.
 func (c *Cache) SaveWriter(h restic.Handle) (io.WriteCloser, error) {
+	return c.saveWriter(h)
+}
+
+func (c *Cache) saveWriter(h restic.Handle) (*cacheWriter, error) {
 	debug.Log("Save to cache: %v", h)
 	if !c.canBeCached(h.Type) {
 		return nil, errors.New("cannot be cached")
@@ -91,12 +137,12 @@ func (c *Cache) SaveWriter(h restic.Handle) (io.WriteCloser, error) {
 		return nil, errors.Wrap(err, "MkdirAll")
 	}
 
-	f, err := fs.OpenFile(p, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0400)
+	f, err := ioutil.TempFile(filepath.Dir(p), tempPrefix)
 	if err != nil {
-		return nil, errors.Wrap(err, "Create")
+		return nil, errors.Wrap(err, "TempFile")
 	}
 
-	return f, err
+	return &cacheWriter{File: f, filename: p}, nil
 }
 
 // Save saves a file in the cache.
@@ -106,30 +152,23 @@ func (c *Cache) Save(h restic.Handle, rd io.Reader) error {
 		return errors.New("Save() called with nil reader")
 	}
 
-	f, err := c.SaveWriter(h)
+	wr, err := c.saveWriter(h)
 	if err != nil {
 		return err
 	}
 
-	n, err := io.Copy(f, rd)
+	n, err := io.Copy(wr, rd)
 	if err != nil {
-		_ = f.Close()
-		_ = c.Remove(h)
+		wr.abort()
 		return errors.Wrap(err, "Copy")
 	}
 
 	if n <= crypto.Extension {
-		_ = f.Close()
-		_ = c.Remove(h)
+		wr.abort()
 		return errors.Errorf("trying to cache truncated file %v", h)
 	}
 
-	if err = f.Close(); err != nil {
-		_ = c.Remove(h)
-		return errors.Wrap(err, "Close")
-	}
-
-	return nil
+	return wr.Close()
 }
 
 // Remove deletes a file. When the file is not cache, no error is returned.
@@ -171,6 +210,35 @@ func isFile(fi os.FileInfo) bool {
 	return fi.Mode()&(os.ModeType|os.ModeCharDevice) == 0
 }
 
+// Usage returns the number of files of type t in the cache and their total
+// size.
+func (c *Cache) Usage(t restic.FileType) (files int, size int64, err error) {
+	if !c.canBeCached(t) {
+		return 0, 0, nil
+	}
+
+	dir := filepath.Join(c.Path, cacheLayoutPaths[t])
+	err = filepath.Walk(dir, func(name string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return errors.Wrap(err, "Walk")
+		}
+
+		if !isFile(fi) {
+			return nil
+		}
+
+		if _, err := restic.ParseID(filepath.Base(name)); err != nil {
+			return nil
+		}
+
+		files++
+		size += fi.Size()
+		return nil
+	})
+
+	return files, size, err
+}
+
 // list returns a list of all files of type T in the cache.
 func (c *Cache) list(t restic.FileType) (restic.IDSet, error) {
 	if !c.canBeCached(t) {
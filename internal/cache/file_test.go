@@ -6,6 +6,8 @@ import (
 	"io"
 	"io/ioutil"
 	"math/rand"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -257,3 +259,60 @@ func TestFileLoad(t *testing.T) {
 		})
 	}
 }
+
+func TestTryLock(t *testing.T) {
+	dir, cleanup := test.TempDir(t)
+	defer cleanup()
+
+	name := filepath.Join(dir, "locks", "test")
+
+	unlock, err := TryLock(name)
+	test.OK(t, err)
+
+	// the lock is held, even within the same process
+	_, err = TryLock(name)
+	test.Assert(t, IsLocked(err), "expected lock to be held, got %v", err)
+
+	unlock()
+
+	unlock, err = TryLock(name)
+	test.OK(t, err)
+	unlock()
+}
+
+func TestNewRemovesStaleTempFiles(t *testing.T) {
+	c, cleanup := TestNewCache(t)
+	defer cleanup()
+
+	dir := filepath.Join(c.Path, cacheLayoutPaths[restic.DataFile], "ab")
+	test.OK(t, os.MkdirAll(dir, dirMode))
+
+	stale := []string{
+		filepath.Join(dir, tempPrefix+"123"),
+		filepath.Join(c.Path, tempPrefix+"stats-456"),
+	}
+	fresh := filepath.Join(dir, tempPrefix+"789")
+	other := filepath.Join(dir, "abcdef")
+
+	old := time.Now().Add(-2 * maxTempAge)
+	for _, name := range append(stale, fresh, other) {
+		test.OK(t, ioutil.WriteFile(name, []byte("foo"), fileMode))
+		if name != fresh {
+			test.OK(t, os.Chtimes(name, old, old))
+		}
+	}
+
+	_, err := New(filepath.Base(c.Path), c.Base)
+	test.OK(t, err)
+
+	for _, name := range stale {
+		_, err := os.Stat(name)
+		test.Assert(t, os.IsNotExist(err), "stale file %v was not removed", name)
+	}
+
+	// files which may still be written by another process and cached files are kept
+	for _, name := range []string{fresh, other} {
+		_, err := os.Stat(name)
+		test.OK(t, err)
+	}
+}
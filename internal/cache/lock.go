@@ -0,0 +1,97 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/restic"
+)
+
+// lockDir is the directory within the cache which contains the lock files.
+const lockDir = "locks"
+
+// lock acquires an exclusive lock for the file h which is shared with all
+// other processes using the same cache directory, so only one of them
+// downloads a file into the cache. Files with the same two-character prefix
+// share a lock file, which keeps the number of lock files small. The
+// returned function releases the lock.
+func (c *Cache) lock(h restic.Handle) (unlock func(), err error) {
+	return c.lockName(cacheLayoutPaths[h.Type] + "-" + h.Name[:2])
+}
+
+// lockName acquires the exclusive lock name in the lock directory of the
+// cache, it blocks until the lock is released by other processes. The
+// returned function releases the lock.
+func (c *Cache) lockName(name string) (unlock func(), err error) {
+	dir := filepath.Join(c.Path, lockDir)
+	if err = fs.MkdirAll(dir, dirMode); err != nil {
+		return nil, errors.Wrap(err, "MkdirAll")
+	}
+
+	name = filepath.Join(dir, name)
+	f, err := fs.OpenFile(name, os.O_CREATE|os.O_RDWR, fileMode)
+	if err != nil {
+		return nil, errors.Wrap(err, "OpenFile")
+	}
+
+	debug.Log("acquire cache lock %v", name)
+	if err = lockFile(f); err != nil {
+		_ = f.Close()
+		return nil, errors.Wrap(err, "lock")
+	}
+
+	unlock = func() {
+		debug.Log("release cache lock %v", name)
+		if err := unlockFile(f); err != nil {
+			debug.Log("unable to unlock %v: %v", name, err)
+		}
+		_ = f.Close()
+	}
+
+	return unlock, nil
+}
+
+// errLocked is returned by tryLockFile if the lock is held by another
+// process.
+var errLocked = errors.New("locked by another process")
+
+// IsLocked returns true if err was returned by TryLock because the lock is
+// held by another process.
+func IsLocked(err error) bool {
+	return errors.Cause(err) == errLocked
+}
+
+// TryLock acquires an exclusive lock on the file name, which is created if it
+// does not exist. The lock is only shared with processes on the same host. If
+// another process holds the lock, an error is returned for which IsLocked is
+// true. The returned function releases the lock.
+func TryLock(name string) (unlock func(), err error) {
+	if err = fs.MkdirAll(filepath.Dir(name), dirMode); err != nil {
+		return nil, errors.Wrap(err, "MkdirAll")
+	}
+
+	f, err := fs.OpenFile(name, os.O_CREATE|os.O_RDWR, fileMode)
+	if err != nil {
+		return nil, errors.Wrap(err, "OpenFile")
+	}
+
+	if err = tryLockFile(f); err != nil {
+		_ = f.Close()
+		return nil, errors.Wrap(err, "lock")
+	}
+
+	debug.Log("acquired lock %v", name)
+
+	unlock = func() {
+		debug.Log("release lock %v", name)
+		if err := unlockFile(f); err != nil {
+			debug.Log("unable to unlock %v: %v", name, err)
+		}
+		_ = f.Close()
+	}
+
+	return unlock, nil
+}
@@ -0,0 +1,60 @@
+// +build windows
+
+package cache
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	modkernel32      = windows.NewLazySystemDLL("kernel32.dll")
+	procLockFileEx   = modkernel32.NewProc("LockFileEx")
+	procUnlockFileEx = modkernel32.NewProc("UnlockFileEx")
+)
+
+const (
+	lockfileFailImmediately = 0x1
+	lockfileExclusiveLock   = 0x2
+)
+
+// errLockViolation is returned by LockFileEx if the lock is held by another
+// process.
+const errLockViolation = syscall.Errno(33)
+
+// lockFile blocks until an exclusive lock on f is acquired.
+func lockFile(f *os.File) error {
+	var ol windows.Overlapped
+	r, _, err := procLockFileEx.Call(f.Fd(), lockfileExclusiveLock, 0, 1, 0, uintptr(unsafe.Pointer(&ol)))
+	if r == 0 {
+		return err
+	}
+	return nil
+}
+
+// unlockFile releases the lock on f.
+func unlockFile(f *os.File) error {
+	var ol windows.Overlapped
+	r, _, err := procUnlockFileEx.Call(f.Fd(), 0, 1, 0, uintptr(unsafe.Pointer(&ol)))
+	if r == 0 {
+		return err
+	}
+	return nil
+}
+
+// tryLockFile acquires an exclusive lock on f, errLocked is returned if
+// another process holds it.
+func tryLockFile(f *os.File) error {
+	var ol windows.Overlapped
+	r, _, err := procLockFileEx.Call(f.Fd(), lockfileExclusiveLock|lockfileFailImmediately, 0, 1, 0, uintptr(unsafe.Pointer(&ol)))
+	if r == 0 {
+		if err == errLockViolation {
+			return errLocked
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,249 @@
+package cache
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/restic"
+)
+
+// statsFilename is the name of the file in the cache directory which contains
+// the read statistics for the pack files.
+const statsFilename = "stats.json"
+
+// PackStats records how often a pack file was read.
+type PackStats struct {
+	Reads     uint64    `json:"reads"`
+	CacheHits uint64    `json:"cache_hits"`
+	BytesRead uint64    `json:"bytes_read"`
+	LastRead  time.Time `json:"last_read"`
+}
+
+// add merges the counters in other into s.
+func (s *PackStats) add(other PackStats) {
+	s.Reads += other.Reads
+	s.CacheHits += other.CacheHits
+	s.BytesRead += other.BytesRead
+	if other.LastRead.After(s.LastRead) {
+		s.LastRead = other.LastRead
+	}
+}
+
+// packStats collects the read statistics which have not been saved yet.
+type packStats struct {
+	mu    sync.Mutex
+	packs map[restic.ID]*PackStats
+}
+
+func newPackStats() *packStats {
+	return &packStats{packs: make(map[restic.ID]*PackStats)}
+}
+
+// get returns the entry for the pack id, it must be called with mu held.
+func (s *packStats) get(id restic.ID) *PackStats {
+	ps, ok := s.packs[id]
+	if !ok {
+		ps = &PackStats{}
+		s.packs[id] = ps
+	}
+	return ps
+}
+
+// recordRead records that the pack file h is read, hit is true if it was
+// read from the cache.
+func (c *Cache) recordRead(h restic.Handle, hit bool) {
+	if h.Type != restic.DataFile {
+		return
+	}
+
+	id, err := restic.ParseID(h.Name)
+	if err != nil {
+		return
+	}
+
+	c.stats.mu.Lock()
+	defer c.stats.mu.Unlock()
+
+	ps := c.stats.get(id)
+	ps.Reads++
+	if hit {
+		ps.CacheHits++
+	}
+	ps.LastRead = time.Now()
+}
+
+// recordBytes records that n bytes were read from the pack file h.
+func (c *Cache) recordBytes(h restic.Handle, n uint64) {
+	id, err := restic.ParseID(h.Name)
+	if err != nil {
+		return
+	}
+
+	c.stats.mu.Lock()
+	c.stats.get(id).BytesRead += n
+	c.stats.mu.Unlock()
+}
+
+// countingReadCloser counts the bytes read from a pack file.
+type countingReadCloser struct {
+	io.ReadCloser
+	n    uint64
+	done func(uint64)
+	once sync.Once
+}
+
+func (rd *countingReadCloser) Read(p []byte) (int, error) {
+	n, err := rd.ReadCloser.Read(p)
+	rd.n += uint64(n)
+	return n, err
+}
+
+func (rd *countingReadCloser) Close() error {
+	rd.once.Do(func() { rd.done(rd.n) })
+	return rd.ReadCloser.Close()
+}
+
+// countReads wraps rd so that the number of bytes read is recorded for the
+// pack file h.
+func (c *Cache) countReads(h restic.Handle, rd io.ReadCloser) io.ReadCloser {
+	if h.Type != restic.DataFile {
+		return rd
+	}
+
+	return &countingReadCloser{
+		ReadCloser: rd,
+		done: func(n uint64) {
+			c.recordBytes(h, n)
+		},
+	}
+}
+
+func (c *Cache) loadStats() (map[restic.ID]PackStats, error) {
+	stats := make(map[restic.ID]PackStats)
+
+	buf, err := ioutil.ReadFile(filepath.Join(c.Path, statsFilename))
+	if os.IsNotExist(err) {
+		return stats, nil
+	}
+
+	if err != nil {
+		return nil, errors.Wrap(err, "ReadFile")
+	}
+
+	// the file maps the hex representation of the IDs to the statistics
+	var entries map[string]PackStats
+	if err = json.Unmarshal(buf, &entries); err != nil {
+		// the statistics are only informational, start over
+		debug.Log("unable to decode %v: %v", statsFilename, err)
+		return stats, nil
+	}
+
+	for name, ps := range entries {
+		id, err := restic.ParseID(name)
+		if err != nil {
+			debug.Log("ignoring invalid ID %q in %v", name, statsFilename)
+			continue
+		}
+		stats[id] = ps
+	}
+
+	return stats, nil
+}
+
+// Stats returns the read statistics for all pack files recorded so far,
+// including those which have not been saved yet.
+func (c *Cache) Stats() (map[restic.ID]PackStats, error) {
+	stats, err := c.loadStats()
+	if err != nil {
+		return nil, err
+	}
+
+	c.stats.mu.Lock()
+	defer c.stats.mu.Unlock()
+
+	for id, ps := range c.stats.packs {
+		entry := stats[id]
+		entry.add(*ps)
+		stats[id] = entry
+	}
+
+	return stats, nil
+}
+
+// SaveStats adds the statistics recorded since the last call to the file in
+// the cache directory. Entries for packs which are not in the cache and have
+// not been read within the last 30 days are removed.
+func (c *Cache) SaveStats() error {
+	c.stats.mu.Lock()
+	defer c.stats.mu.Unlock()
+
+	if len(c.stats.packs) == 0 {
+		return nil
+	}
+
+	// other processes using the cache merge their statistics at the same time
+	unlock, err := c.lockName("stats")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	stats, err := c.loadStats()
+	if err != nil {
+		return err
+	}
+
+	for id, ps := range c.stats.packs {
+		entry := stats[id]
+		entry.add(*ps)
+		stats[id] = entry
+	}
+
+	entries := make(map[string]PackStats, len(stats))
+	oldest := time.Now().Add(-maxCacheAge)
+	for id, ps := range stats {
+		h := restic.Handle{Type: restic.DataFile, Name: id.String()}
+		if ps.LastRead.Before(oldest) && !c.Has(h) {
+			continue
+		}
+		entries[id.String()] = ps
+	}
+
+	buf, err := json.Marshal(entries)
+	if err != nil {
+		return errors.Wrap(err, "Marshal")
+	}
+
+	// write to a temporary file first, so that the file is replaced atomically
+	f, err := ioutil.TempFile(c.Path, tempPrefix+"stats-")
+	if err != nil {
+		return errors.Wrap(err, "TempFile")
+	}
+
+	if _, err = f.Write(buf); err != nil {
+		_ = f.Close()
+		_ = fs.Remove(f.Name())
+		return errors.Wrap(err, "Write")
+	}
+
+	if err = f.Close(); err != nil {
+		_ = fs.Remove(f.Name())
+		return errors.Wrap(err, "Close")
+	}
+
+	if err = fs.Rename(f.Name(), filepath.Join(c.Path, statsFilename)); err != nil {
+		_ = fs.Remove(f.Name())
+		return errors.Wrap(err, "Rename")
+	}
+
+	c.stats.packs = make(map[restic.ID]*PackStats)
+	return nil
+}
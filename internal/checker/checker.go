@@ -517,9 +517,35 @@ func filterTrees(ctx context.Context, backlog restic.IDs, loaderChan chan<- rest
 // subtrees are available in the index. errChan is closed after all trees have
 // been traversed.
 func (c *Checker) Structure(ctx context.Context, errChan chan<- error) {
+	trees, errs := loadSnapshotTreeIDs(ctx, c.repo)
+	c.checkStructure(ctx, trees, errs, errChan)
+}
+
+// SnapshotStructure works like Structure, but only checks the trees and blobs
+// reachable from the given snapshots. errChan is closed after all trees have
+// been traversed.
+func (c *Checker) SnapshotStructure(ctx context.Context, snapshots restic.IDs, errChan chan<- error) {
+	var (
+		trees restic.IDs
+		errs  []error
+	)
+
+	for _, id := range snapshots {
+		debug.Log("load snapshot %v", id.Str())
+		treeID, err := loadTreeFromSnapshot(ctx, c.repo, id)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		trees = append(trees, treeID)
+	}
+
+	c.checkStructure(ctx, trees, errs, errChan)
+}
+
+func (c *Checker) checkStructure(ctx context.Context, trees restic.IDs, errs []error, errChan chan<- error) {
 	defer close(errChan)
 
-	trees, errs := loadSnapshotTreeIDs(ctx, c.repo)
 	debug.Log("need to check %d trees from snapshots, %d errs returned", len(trees), len(errs))
 
 	for _, err := range errs {
@@ -620,6 +646,38 @@ func (c *Checker) UnusedBlobs() (blobs restic.IDs) {
 	return blobs
 }
 
+// ReferencedPacks returns the IDs of all packs which contain trees or data
+// blobs referenced by the trees checked so far.
+func (c *Checker) ReferencedPacks() restic.IDSet {
+	c.blobRefs.Lock()
+	defer c.blobRefs.Unlock()
+
+	packs := restic.NewIDSet()
+	for id := range c.blobRefs.M {
+		for _, tpe := range []restic.BlobType{restic.DataBlob, restic.TreeBlob} {
+			blobs, found := c.masterIndex.Lookup(id, tpe)
+			if !found {
+				continue
+			}
+
+			for _, blob := range blobs {
+				packs.Insert(blob.PackID)
+			}
+		}
+	}
+
+	return packs
+}
+
+// GetPacks returns the IDs of all packs contained in the index.
+func (c *Checker) GetPacks() restic.IDSet {
+	packs := restic.NewIDSet()
+	for id := range c.packs {
+		packs.Insert(id)
+	}
+	return packs
+}
+
 // CountPacks returns the number of packs in the repository.
 func (c *Checker) CountPacks() uint64 {
 	return uint64(len(c.packs))
@@ -716,6 +774,34 @@ func checkPack(ctx context.Context, r restic.Repository, id restic.ID) error {
 
 // ReadData loads all data from the repository and checks the integrity.
 func (c *Checker) ReadData(ctx context.Context, p *restic.Progress, errChan chan<- error) {
+	c.readPacks(ctx, p, errChan, func(ctx context.Context, ch chan<- restic.ID) error {
+		return c.repo.List(ctx, restic.DataFile, func(id restic.ID, size int64) error {
+			select {
+			case <-ctx.Done():
+			case ch <- id:
+			}
+			return nil
+		})
+	})
+}
+
+// ReadPacks loads the given packs from the repository and checks the
+// integrity.
+func (c *Checker) ReadPacks(ctx context.Context, packs restic.IDSet, p *restic.Progress, errChan chan<- error) {
+	c.readPacks(ctx, p, errChan, func(ctx context.Context, ch chan<- restic.ID) error {
+		for id := range packs {
+			select {
+			case <-ctx.Done():
+				return nil
+			case ch <- id:
+			}
+		}
+		return nil
+	})
+}
+
+// readPacks checks all packs sent to the channel by produce.
+func (c *Checker) readPacks(ctx context.Context, p *restic.Progress, errChan chan<- error, produce func(context.Context, chan<- restic.ID) error) {
 	defer close(errChan)
 
 	p.Start()
@@ -727,13 +813,7 @@ func (c *Checker) ReadData(ctx context.Context, p *restic.Progress, errChan chan
 	// start producer for channel ch
 	g.Go(func() error {
 		defer close(ch)
-		return c.repo.List(ctx, restic.DataFile, func(id restic.ID, size int64) error {
-			select {
-			case <-ctx.Done():
-			case ch <- id:
-			}
-			return nil
-		})
+		return produce(ctx, ch)
 	})
 
 	// run workers
@@ -3,6 +3,7 @@ package checker_test
 import (
 	"context"
 	"io"
+	"io/ioutil"
 	"math/rand"
 	"path/filepath"
 	"sort"
@@ -182,6 +183,62 @@ func TestUnreferencedBlobs(t *testing.T) {
 	test.Equals(t, unusedBlobsBySnapshot, blobs)
 }
 
+func TestSnapshotStructure(t *testing.T) {
+	repodir, cleanup := test.Env(t, checkerTestData)
+	defer cleanup()
+
+	repo := repository.TestOpenLocal(t, repodir)
+
+	excluded := restic.TestParseID("51d249d28815200d59e4be7b3f21a157b864dc343353df9d8e498220c2499b02")
+
+	// blobs only referenced by the excluded snapshot
+	unusedBlobs := restic.IDs{
+		restic.TestParseID("58c748bbe2929fdf30c73262bd8313fe828f8925b05d1d4a87fe109082acb849"),
+		restic.TestParseID("988a272ab9768182abfd1fe7d7a7b68967825f0b861d3b36156795832c772235"),
+		restic.TestParseID("c01952de4d91da1b1b80bc6e06eaa4ec21523f4853b69dc8231708b9b7ec62d8"),
+		restic.TestParseID("bec3a53d7dc737f9a9bee68b107ec9e8ad722019f649b34d474b9982c3a3fec7"),
+		restic.TestParseID("2a6f01e5e92d8343c4c6b78b51c5a4dc9c39d42c04e26088c7614b13d8d0559d"),
+		restic.TestParseID("18b51b327df9391732ba7aaf841a4885f350d8a557b2da8352c9acf8898e3f10"),
+	}
+	sort.Sort(unusedBlobs)
+
+	var snapshots restic.IDs
+	test.OK(t, repo.List(context.TODO(), restic.SnapshotFile, func(id restic.ID, size int64) error {
+		if !id.Equal(excluded) {
+			snapshots = append(snapshots, id)
+		}
+		return nil
+	}))
+
+	chkr := checker.New(repo)
+	_, errs := chkr.LoadIndex(context.TODO())
+	if len(errs) > 0 {
+		t.Fatalf("expected no errors, got %v: %v", len(errs), errs)
+	}
+
+	test.OKs(t, collectErrors(context.TODO(), func(ctx context.Context, errChan chan<- error) {
+		chkr.SnapshotStructure(ctx, snapshots, errChan)
+	}))
+
+	blobs := chkr.UnusedBlobs()
+	sort.Sort(blobs)
+	test.Equals(t, unusedBlobs, blobs)
+
+	packs := chkr.ReferencedPacks()
+	test.Assert(t, len(packs) > 0 && uint64(len(packs)) <= chkr.CountPacks(),
+		"unexpected number of referenced packs: %d", len(packs))
+
+	test.OKs(t, collectErrors(context.TODO(), func(ctx context.Context, errChan chan<- error) {
+		chkr.ReadPacks(ctx, packs, nil, errChan)
+	}))
+
+	// a snapshot which does not exist is reported
+	errs = collectErrors(context.TODO(), func(ctx context.Context, errChan chan<- error) {
+		chkr.SnapshotStructure(ctx, restic.IDs{restic.NewRandomID()}, errChan)
+	})
+	test.Assert(t, len(errs) == 1, "expected exactly one error, got %v", errs)
+}
+
 func TestModifiedIndex(t *testing.T) {
 	repodir, cleanup := test.Env(t, checkerTestData)
 	defer cleanup()
@@ -198,17 +255,19 @@ func TestModifiedIndex(t *testing.T) {
 	f, err := repo.Backend().Load(context.TODO(), h, 0, 0)
 	test.OK(t, err)
 
+	buf, err := ioutil.ReadAll(f)
+	test.OK(t, err)
+	test.OK(t, f.Close())
+
 	// save the index again with a modified name so that the hash doesn't match
 	// the content any more
 	h2 := restic.Handle{
 		Type: restic.IndexFile,
 		Name: "80f838b4ac28735fda8644fe6a08dbc742e57aaf81b30977b4fefa357010eafd",
 	}
-	err = repo.Backend().Save(context.TODO(), h2, f)
+	err = repo.Backend().Save(context.TODO(), h2, restic.NewByteReader(buf))
 	test.OK(t, err)
 
-	test.OK(t, f.Close())
-
 	chkr := checker.New(repo)
 	hints, errs := chkr.LoadIndex(context.TODO())
 	if len(errs) == 0 {
@@ -0,0 +1,219 @@
+package cron
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/restic/restic/internal/errors"
+)
+
+// Schedule is a parsed cron expression with the five fields minute, hour, day
+// of month, month and day of week.
+type Schedule struct {
+	expr string
+
+	minute, hour, dom, month, dow uint64
+
+	// the day matches either field if both are restricted, like cron does
+	domAny, dowAny bool
+}
+
+// macros are the abbreviations for common schedules.
+var macros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+var monthNames = []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}
+
+var dayNames = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// field describes the allowed values of a field of the expression.
+type field struct {
+	name     string
+	min, max int
+	names    []string // names for the values starting at min
+}
+
+var fields = []field{
+	{"minute", 0, 59, nil},
+	{"hour", 0, 23, nil},
+	{"day of month", 1, 31, nil},
+	{"month", 1, 12, monthNames},
+	{"day of week", 0, 7, dayNames},
+}
+
+// Parse parses a cron expression like "30 2 * * 1-5". Each field is either
+// "*", a value, a range "a-b" or a comma-separated list of them, ranges and
+// "*" can be followed by a step like "*/15". Months and days of week can be
+// given by their English abbreviation, 0 and 7 are both Sunday. The macros
+// @hourly, @daily, @weekly, @monthly and @yearly are accepted as well.
+func Parse(expr string) (*Schedule, error) {
+	s := strings.TrimSpace(expr)
+	if m, ok := macros[strings.ToLower(s)]; ok {
+		s = m
+	}
+
+	parts := strings.Fields(s)
+	if len(parts) != len(fields) {
+		return nil, errors.Errorf("invalid cron expression %q: need %d fields, got %d", expr, len(fields), len(parts))
+	}
+
+	var bits [5]uint64
+	for i, f := range fields {
+		b, err := f.parse(parts[i])
+		if err != nil {
+			return nil, errors.Errorf("invalid cron expression %q: %v", expr, err)
+		}
+		bits[i] = b
+	}
+
+	sched := &Schedule{
+		expr:   expr,
+		minute: bits[0],
+		hour:   bits[1],
+		dom:    bits[2],
+		month:  bits[3],
+		dow:    bits[4],
+		domAny: strings.HasPrefix(parts[2], "*"),
+		dowAny: strings.HasPrefix(parts[4], "*"),
+	}
+
+	// Sunday is both 0 and 7
+	if sched.dow&(1<<7) != 0 {
+		sched.dow |= 1
+	}
+
+	return sched, nil
+}
+
+// parse returns the values of s as a bit set.
+func (f field) parse(s string) (bits uint64, err error) {
+	for _, item := range strings.Split(s, ",") {
+		step := 1
+		if pos := strings.Index(item, "/"); pos >= 0 {
+			step, err = strconv.Atoi(item[pos+1:])
+			if err != nil || step <= 0 {
+				return 0, errors.Errorf("invalid step %q for %v", item[pos+1:], f.name)
+			}
+			item = item[:pos]
+		}
+
+		lo, hi := f.min, f.max
+		switch {
+		case item == "*":
+		case strings.Contains(item, "-"):
+			pos := strings.Index(item, "-")
+			if lo, err = f.value(item[:pos]); err != nil {
+				return 0, err
+			}
+			if hi, err = f.value(item[pos+1:]); err != nil {
+				return 0, err
+			}
+			if lo > hi {
+				return 0, errors.Errorf("invalid range %q for %v", item, f.name)
+			}
+		default:
+			if lo, err = f.value(item); err != nil {
+				return 0, err
+			}
+			// "5/10" means every tenth value starting at 5
+			if step == 1 {
+				hi = lo
+			}
+		}
+
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+
+	return bits, nil
+}
+
+// value parses a single value of the field.
+func (f field) value(s string) (int, error) {
+	for i, name := range f.names {
+		if strings.ToLower(s) == name {
+			return f.min + i, nil
+		}
+	}
+
+	v, err := strconv.Atoi(s)
+	if err != nil || v < f.min || v > f.max {
+		return 0, errors.Errorf("invalid value %q for %v, must be between %d and %d", s, f.name, f.min, f.max)
+	}
+	return v, nil
+}
+
+// String returns the expression the schedule was parsed from.
+func (s *Schedule) String() string {
+	return s.expr
+}
+
+func has(bits uint64, v int) bool {
+	return bits&(1<<uint(v)) != 0
+}
+
+// dayMatches returns true if the day of t is selected by the schedule.
+func (s *Schedule) dayMatches(t time.Time) bool {
+	dom := has(s.dom, t.Day())
+	dow := has(s.dow, int(t.Weekday()))
+
+	switch {
+	case s.domAny && s.dowAny:
+		return true
+	case s.domAny:
+		return dow
+	case s.dowAny:
+		return dom
+	default:
+		return dom || dow
+	}
+}
+
+// maxSearch is the time after which Next gives up, some schedules never
+// match, e.g. "0 0 31 2 *".
+const maxSearch = 5 * 366 * 24 * time.Hour
+
+// Next returns the first time after t which is selected by the schedule, in
+// the location of t. The zero time is returned if there is none.
+func (s *Schedule) Next(t time.Time) time.Time {
+	loc := t.Location()
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.Add(maxSearch)
+
+	for t.Before(limit) {
+		year, month, day := t.Date()
+
+		if !has(s.month, int(month)) {
+			t = time.Date(year, month+1, 1, 0, 0, 0, 0, loc)
+			continue
+		}
+
+		if !s.dayMatches(t) {
+			t = time.Date(year, month, day+1, 0, 0, 0, 0, loc)
+			continue
+		}
+
+		if !has(s.hour, t.Hour()) {
+			t = time.Date(year, month, day, t.Hour()+1, 0, 0, 0, loc)
+			continue
+		}
+
+		if !has(s.minute, t.Minute()) {
+			t = t.Add(time.Minute)
+			continue
+		}
+
+		return t
+	}
+
+	return time.Time{}
+}
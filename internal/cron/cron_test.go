@@ -0,0 +1,88 @@
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNext(t *testing.T) {
+	// Wednesday
+	start := time.Date(2021, 3, 10, 14, 23, 42, 0, time.UTC)
+
+	var tests = []struct {
+		expr string
+		next time.Time
+	}{
+		{"* * * * *", time.Date(2021, 3, 10, 14, 24, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2021, 3, 10, 14, 30, 0, 0, time.UTC)},
+		{"5/20 * * * *", time.Date(2021, 3, 10, 14, 25, 0, 0, time.UTC)},
+		{"0 3 * * *", time.Date(2021, 3, 11, 3, 0, 0, 0, time.UTC)},
+		{"30 2 * * sat,sun", time.Date(2021, 3, 13, 2, 30, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2021, 3, 14, 0, 0, 0, 0, time.UTC)},
+		{"0 9-17 * * mon-fri", time.Date(2021, 3, 10, 15, 0, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2021, 4, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 feb *", time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		// both days are restricted, either one matches
+		{"0 0 20 * fri", time.Date(2021, 3, 12, 0, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2021, 3, 10, 15, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2021, 3, 11, 0, 0, 0, 0, time.UTC)},
+		{"@weekly", time.Date(2021, 3, 14, 0, 0, 0, 0, time.UTC)},
+		{"@yearly", time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 31 2 *", time.Time{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.expr, func(t *testing.T) {
+			s, err := Parse(test.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			next := s.Next(start)
+			if !next.Equal(test.next) {
+				t.Errorf("wrong next time, want %v, got %v", test.next, next)
+			}
+		})
+	}
+}
+
+func TestNextDST(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("time zone data not available: %v", err)
+	}
+
+	s, err := Parse("30 2 * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 02:30 does not exist on the day the clocks are put forward
+	next := s.Next(time.Date(2021, 3, 28, 1, 0, 0, 0, loc))
+	want := time.Date(2021, 3, 29, 2, 30, 0, 0, loc)
+	if !next.Equal(want) {
+		t.Errorf("wrong next time, want %v, got %v", want, next)
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"foo * * * *",
+		"@often",
+	} {
+		_, err := Parse(expr)
+		if err == nil {
+			t.Errorf("expected error for %q", expr)
+		}
+	}
+}
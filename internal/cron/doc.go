@@ -0,0 +1,2 @@
+// Package cron implements schedules given as cron expressions.
+package cron
@@ -26,6 +26,19 @@ var DefaultKDFParams = Params{
 	P: sscrypt.DefaultParams.P,
 }
 
+// Check returns an error if the parameters cannot be used for KDF().
+func (p Params) Check() error {
+	params := sscrypt.Params{
+		N:       p.N,
+		R:       p.R,
+		P:       p.P,
+		DKLen:   sscrypt.DefaultParams.DKLen,
+		SaltLen: saltLength,
+	}
+
+	return errors.Wrap(params.Check(), "Check")
+}
+
 // Calibrate determines new KDF parameters for the current hardware.
 func Calibrate(timeout time.Duration, memory int) (Params, error) {
 	defaultParams := sscrypt.Params{
@@ -56,16 +69,8 @@ func KDF(p Params, salt []byte, password string) (*Key, error) {
 	}
 
 	// make sure we have valid parameters
-	params := sscrypt.Params{
-		N:       p.N,
-		R:       p.R,
-		P:       p.P,
-		DKLen:   sscrypt.DefaultParams.DKLen,
-		SaltLen: len(salt),
-	}
-
-	if err := params.Check(); err != nil {
-		return nil, errors.Wrap(err, "Check")
+	if err := p.Check(); err != nil {
+		return nil, err
 	}
 
 	derKeys := &Key{}
@@ -12,3 +12,27 @@ func TestCalibrate(t *testing.T) {
 	}
 	t.Logf("testing calibrate, params after: %v", params)
 }
+
+func TestParamsCheck(t *testing.T) {
+	var tests = []struct {
+		p  Params
+		ok bool
+	}{
+		{DefaultKDFParams, true},
+		{Params{N: 128, R: 1, P: 1}, true},
+		{Params{N: 1001, R: 8, P: 1}, false},
+		{Params{N: 0, R: 8, P: 1}, false},
+		{Params{N: 16384, R: 0, P: 1}, false},
+		{Params{N: 16384, R: 8, P: 0}, false},
+	}
+
+	for _, test := range tests {
+		err := test.p.Check()
+		if test.ok && err != nil {
+			t.Errorf("params %v: unexpected error %v", test.p, err)
+		}
+		if !test.ok && err == nil {
+			t.Errorf("params %v: expected error not found", test.p)
+		}
+	}
+}
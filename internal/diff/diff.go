@@ -0,0 +1,243 @@
+// Package diff compares two trees of a repository, e.g. the trees of two
+// snapshots, and reports the items which were added, removed or modified.
+package diff
+
+import (
+	"context"
+	"path"
+	"reflect"
+	"sort"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+)
+
+// TreeLoader loads tree objects.
+type TreeLoader interface {
+	LoadTree(context.Context, restic.ID) (*restic.Tree, error)
+}
+
+// SkipSubtree can be returned by the function passed to Trees to skip the
+// items below the path of the change, e.g. the content of a removed
+// directory.
+var SkipSubtree = errors.New("skip subtree")
+
+// Change is an item which differs between two trees. For added items, Old is
+// nil, for removed items, New is nil.
+type Change struct {
+	// Path is the slash-separated path of the item, starting with "/".
+	Path string
+	Old  *restic.Node
+	New  *restic.Node
+}
+
+// Added returns true if the item only exists in the second tree.
+func (c Change) Added() bool {
+	return c.Old == nil
+}
+
+// Removed returns true if the item only exists in the first tree.
+func (c Change) Removed() bool {
+	return c.New == nil
+}
+
+// Node returns the new node, or the old node for removed items.
+func (c Change) Node() *restic.Node {
+	if c.New != nil {
+		return c.New
+	}
+	return c.Old
+}
+
+// TypeChanged returns true if the item exists in both trees with different
+// types, e.g. a file was replaced by a directory.
+func (c Change) TypeChanged() bool {
+	return c.Old != nil && c.New != nil && c.Old.Type != c.New.Type
+}
+
+// ContentChanged returns true if the content of a file, the target of a
+// symlink or the device of a device node was modified.
+func (c Change) ContentChanged() bool {
+	if c.Old == nil || c.New == nil || c.TypeChanged() {
+		return false
+	}
+
+	switch c.New.Type {
+	case "file":
+		return !reflect.DeepEqual(c.Old.Content, c.New.Content)
+	case "symlink":
+		return c.Old.LinkTarget != c.New.LinkTarget
+	case "dev", "chardev":
+		return c.Old.Device != c.New.Device
+	}
+
+	return false
+}
+
+// MetadataChanges returns the names of the metadata fields which differ
+// between the old and the new node: "mode", "mtime", "owner" and "xattrs".
+// Timestamps and numbers which change for every backup (e.g. the inode) are
+// not compared, neither are the nodes of items whose type has changed.
+func (c Change) MetadataChanges() []string {
+	if c.Old == nil || c.New == nil || c.TypeChanged() {
+		return nil
+	}
+
+	n1, n2 := c.Old, c.New
+
+	var changes []string
+	if n1.Mode != n2.Mode {
+		changes = append(changes, "mode")
+	}
+	if !n1.ModTime.Equal(n2.ModTime) {
+		changes = append(changes, "mtime")
+	}
+	if n1.UID != n2.UID || n1.GID != n2.GID || n1.User != n2.User || n1.Group != n2.Group {
+		changes = append(changes, "owner")
+	}
+	if (len(n1.ExtendedAttributes) > 0 || len(n2.ExtendedAttributes) > 0) &&
+		!reflect.DeepEqual(n1.ExtendedAttributes, n2.ExtendedAttributes) {
+		changes = append(changes, "xattrs")
+	}
+
+	return changes
+}
+
+// MetadataChanged returns true if any of the fields returned by
+// MetadataChanges differs.
+func (c Change) MetadataChanged() bool {
+	return len(c.MetadataChanges()) > 0
+}
+
+// SizeDelta returns the difference of the size of the new and the old node.
+func (c Change) SizeDelta() int64 {
+	var delta int64
+	if c.New != nil {
+		delta += int64(c.New.Size)
+	}
+	if c.Old != nil {
+		delta -= int64(c.Old.Size)
+	}
+	return delta
+}
+
+// changed returns true if the change needs to be reported.
+func (c Change) changed() bool {
+	return c.Added() || c.Removed() || c.TypeChanged() || c.ContentChanged() || c.MetadataChanged()
+}
+
+// Trees calls fn for each item which was added, removed or modified from the
+// tree id1 to the tree id2, ordered by path. A nil ID stands for an empty
+// tree. The content of added and removed directories is reported as added or
+// removed after the directory itself, unless fn returns SkipSubtree.
+// Directories whose metadata is unchanged are not reported, only the items
+// below them.
+func Trees(ctx context.Context, repo TreeLoader, id1, id2 *restic.ID, fn func(Change) error) error {
+	return diffTrees(ctx, repo, "/", id1, id2, fn)
+}
+
+// loadTree loads the tree id, nil returns an empty tree.
+func loadTree(ctx context.Context, repo TreeLoader, id *restic.ID) (*restic.Tree, error) {
+	if id == nil {
+		return restic.NewTree(), nil
+	}
+	return repo.LoadTree(ctx, *id)
+}
+
+// subtree returns the subtree ID of node if it is a directory, nil otherwise.
+func subtree(node *restic.Node) *restic.ID {
+	if node == nil || node.Type != "dir" {
+		return nil
+	}
+	return node.Subtree
+}
+
+func diffTrees(ctx context.Context, repo TreeLoader, prefix string, id1, id2 *restic.ID, fn func(Change) error) error {
+	if id1 != nil && id2 != nil && id1.Equal(*id2) {
+		return nil
+	}
+
+	debug.Log("diffing %v to %v", id1, id2)
+
+	tree1, err := loadTree(ctx, repo, id1)
+	if err != nil {
+		return err
+	}
+
+	tree2, err := loadTree(ctx, repo, id2)
+	if err != nil {
+		return err
+	}
+
+	nodes1, nodes2, names := uniqueNodeNames(tree1, tree2)
+
+	for _, name := range names {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		c := Change{
+			Path: path.Join(prefix, name),
+			Old:  nodes1[name],
+			New:  nodes2[name],
+		}
+
+		if c.changed() {
+			err := fn(c)
+			if err == SkipSubtree {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		sub1, sub2 := subtree(c.Old), subtree(c.New)
+		if sub1 == nil && sub2 == nil {
+			continue
+		}
+
+		// for a type change, the content of the old directory is removed
+		// before the content of the new directory is added
+		if c.TypeChanged() {
+			err = diffTrees(ctx, repo, c.Path, sub1, nil, fn)
+			if err == nil {
+				err = diffTrees(ctx, repo, c.Path, nil, sub2, fn)
+			}
+		} else {
+			err = diffTrees(ctx, repo, c.Path, sub1, sub2, fn)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// uniqueNodeNames returns the nodes of both trees by name and the sorted list
+// of all names.
+func uniqueNodeNames(tree1, tree2 *restic.Tree) (tree1Nodes, tree2Nodes map[string]*restic.Node, uniqueNames []string) {
+	names := make(map[string]struct{})
+	tree1Nodes = make(map[string]*restic.Node)
+	for _, node := range tree1.Nodes {
+		tree1Nodes[node.Name] = node
+		names[node.Name] = struct{}{}
+	}
+
+	tree2Nodes = make(map[string]*restic.Node)
+	for _, node := range tree2.Nodes {
+		tree2Nodes[node.Name] = node
+		names[node.Name] = struct{}{}
+	}
+
+	uniqueNames = make([]string, 0, len(names))
+	for name := range names {
+		uniqueNames = append(uniqueNames, name)
+	}
+
+	sort.Strings(uniqueNames)
+	return tree1Nodes, tree2Nodes, uniqueNames
+}
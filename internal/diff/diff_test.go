@@ -0,0 +1,201 @@
+package diff_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/diff"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+// treeMap is a TreeLoader which keeps the trees in memory.
+type treeMap map[restic.ID]*restic.Tree
+
+func (m treeMap) LoadTree(ctx context.Context, id restic.ID) (*restic.Tree, error) {
+	tree, ok := m[id]
+	if !ok {
+		return nil, fmt.Errorf("tree %v not found", id.Str())
+	}
+	return tree, nil
+}
+
+// TestTree describes a tree, the values are either TestTree for directories,
+// TestFile or TestSymlink.
+type TestTree map[string]interface{}
+
+type TestFile struct {
+	Content string
+	Mode    os.FileMode
+}
+
+type TestSymlink struct {
+	Target string
+}
+
+// save stores tree in m and returns its ID.
+func (m treeMap) save(t testing.TB, tree TestTree) restic.ID {
+	res := restic.NewTree()
+	for name, item := range tree {
+		node := &restic.Node{Name: name, ModTime: time.Unix(1500000000, 0)}
+		switch item := item.(type) {
+		case TestTree:
+			id := m.save(t, item)
+			node.Type = "dir"
+			node.Subtree = &id
+		case TestFile:
+			node.Type = "file"
+			node.Mode = 0644
+			if item.Mode != 0 {
+				node.Mode = item.Mode
+			}
+			node.Size = uint64(len(item.Content))
+			node.Content = restic.IDs{restic.Hash([]byte(item.Content))}
+		case TestSymlink:
+			node.Type = "symlink"
+			node.LinkTarget = item.Target
+		default:
+			t.Fatalf("unknown item %T", item)
+		}
+		rtest.OK(t, res.Insert(node))
+	}
+
+	buf, err := json.Marshal(res)
+	rtest.OK(t, err)
+	id := restic.Hash(buf)
+	m[id] = res
+	return id
+}
+
+func formatChange(c diff.Change) string {
+	var mod string
+	switch {
+	case c.Added():
+		mod = "+"
+	case c.Removed():
+		mod = "-"
+	default:
+		if c.TypeChanged() {
+			mod += "T"
+		}
+		if c.ContentChanged() {
+			mod += "M"
+		}
+		if c.MetadataChanged() {
+			mod += "U(" + strings.Join(c.MetadataChanges(), ",") + ")"
+		}
+	}
+	return fmt.Sprintf("%s %s %+d", mod, c.Path, c.SizeDelta())
+}
+
+func TestTrees(t *testing.T) {
+	m := make(treeMap)
+
+	tree1 := m.save(t, TestTree{
+		"same":     TestFile{Content: "same"},
+		"modified": TestFile{Content: "old content"},
+		"mode":     TestFile{Content: "mode"},
+		"removed": TestTree{
+			"a": TestFile{Content: "a"},
+			"b": TestTree{"c": TestFile{Content: "c"}},
+		},
+		"link":     TestSymlink{Target: "foo"},
+		"typechg":  TestTree{"x": TestFile{Content: "x"}},
+		"unchdir":  TestTree{"y": TestFile{Content: "y"}},
+		"changdir": TestTree{"z": TestFile{Content: "z"}},
+	})
+
+	tree2 := m.save(t, TestTree{
+		"same":     TestFile{Content: "same"},
+		"modified": TestFile{Content: "new"},
+		"mode":     TestFile{Content: "mode", Mode: 0755},
+		"added": TestTree{
+			"d": TestFile{Content: "dd"},
+		},
+		"link":     TestSymlink{Target: "bar"},
+		"typechg":  TestFile{Content: "now a file"},
+		"unchdir":  TestTree{"y": TestFile{Content: "y"}},
+		"changdir": TestTree{"z": TestFile{Content: "zz"}},
+	})
+
+	var tests = []struct {
+		id1, id2 *restic.ID
+		skip     bool
+		want     []string
+	}{
+		{
+			id1: &tree1, id2: &tree2,
+			want: []string{
+				"+ /added +0",
+				"+ /added/d +2",
+				"M /changdir/z +1",
+				"M /link +0",
+				"U(mode) /mode +0",
+				"M /modified -8",
+				"- /removed +0",
+				"- /removed/a -1",
+				"- /removed/b +0",
+				"- /removed/b/c -1",
+				"T /typechg +10",
+				"- /typechg/x -1",
+			},
+		},
+		{
+			id1: &tree1, id2: &tree2, skip: true,
+			want: []string{
+				"+ /added +0",
+				"M /changdir/z +1",
+				"M /link +0",
+				"U(mode) /mode +0",
+				"M /modified -8",
+				"- /removed +0",
+				"T /typechg +10",
+			},
+		},
+		{
+			id1: &tree1, id2: &tree1,
+		},
+		{
+			id1: nil, id2: &tree1, skip: true,
+			want: []string{
+				"+ /changdir +0",
+				"+ /link +0",
+				"+ /mode +4",
+				"+ /modified +11",
+				"+ /removed +0",
+				"+ /same +4",
+				"+ /typechg +0",
+				"+ /unchdir +0",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		var changes []string
+		err := diff.Trees(context.TODO(), m, test.id1, test.id2, func(c diff.Change) error {
+			changes = append(changes, formatChange(c))
+			if test.skip && (c.Added() || c.Removed() || c.TypeChanged()) {
+				return diff.SkipSubtree
+			}
+			return nil
+		})
+		rtest.OK(t, err)
+		rtest.Equals(t, test.want, changes)
+	}
+}
+
+func TestTreesError(t *testing.T) {
+	m := make(treeMap)
+	tree1 := m.save(t, TestTree{"foo": TestFile{Content: "foo"}})
+	tree2 := m.save(t, TestTree{"bar": TestFile{Content: "bar"}})
+
+	err := diff.Trees(context.TODO(), m, &tree1, &tree2, func(c diff.Change) error {
+		return fmt.Errorf("error for %v", c.Path)
+	})
+	rtest.Assert(t, err != nil && err.Error() == "error for /bar", "wrong error %v", err)
+}
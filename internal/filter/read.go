@@ -0,0 +1,102 @@
+package filter
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/restic/restic/internal/errors"
+)
+
+// ReadPatterns reads patterns from rd, one per line. Leading and trailing
+// whitespace is removed, empty lines and lines starting with "#" are ignored
+// and environment variables are expanded.
+func ReadPatterns(rd io.Reader) ([]string, error) {
+	var patterns []string
+
+	sc := bufio.NewScanner(rd)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		patterns = append(patterns, os.ExpandEnv(line))
+	}
+
+	if err := sc.Err(); err != nil {
+		return nil, errors.Wrap(err, "Scan")
+	}
+
+	return patterns, nil
+}
+
+// ReadLines reads file names from rd, one per line. The lines are returned
+// verbatim, only empty lines are ignored.
+func ReadLines(rd io.Reader) ([]string, error) {
+	var lines []string
+
+	sc := bufio.NewScanner(rd)
+	for sc.Scan() {
+		if sc.Text() == "" {
+			continue
+		}
+
+		lines = append(lines, sc.Text())
+	}
+
+	if err := sc.Err(); err != nil {
+		return nil, errors.Wrap(err, "Scan")
+	}
+
+	return lines, nil
+}
+
+// scanNull is a bufio.SplitFunc which splits the input at null bytes.
+func scanNull(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if i := bytes.IndexByte(data, 0); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+
+	return 0, nil, nil
+}
+
+// ReadNullSeparated reads file names separated by null bytes from rd, as
+// printed by "find -print0". Names may contain any other character, including
+// newlines. Empty names are ignored.
+func ReadNullSeparated(rd io.Reader) ([]string, error) {
+	var names []string
+
+	sc := bufio.NewScanner(rd)
+	sc.Split(scanNull)
+	for sc.Scan() {
+		if sc.Text() == "" {
+			continue
+		}
+
+		names = append(names, sc.Text())
+	}
+
+	if err := sc.Err(); err != nil {
+		return nil, errors.Wrap(err, "Scan")
+	}
+
+	return names, nil
+}
+
+// Lower returns the patterns converted to lower case, for matching against
+// paths which are converted to lower case as well.
+func Lower(patterns []string) []string {
+	lower := make([]string, 0, len(patterns))
+	for _, pattern := range patterns {
+		lower = append(lower, strings.ToLower(pattern))
+	}
+
+	return lower
+}
@@ -0,0 +1,43 @@
+package filter_test
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/restic/restic/internal/filter"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestReadPatterns(t *testing.T) {
+	rtest.OK(t, os.Setenv("RESTIC_TEST_PATTERN", "foo"))
+	defer os.Unsetenv("RESTIC_TEST_PATTERN")
+
+	input := "*.go\n\n# comment\n  /tmp/$RESTIC_TEST_PATTERN  \r\n"
+	patterns, err := filter.ReadPatterns(strings.NewReader(input))
+	rtest.OK(t, err)
+	rtest.Equals(t, []string{"*.go", "/tmp/foo"}, patterns)
+}
+
+func TestReadLines(t *testing.T) {
+	input := "/home/user/# not a comment\n\n /home/user/leading space\r\n/home/user/$HOME\n"
+	lines, err := filter.ReadLines(strings.NewReader(input))
+	rtest.OK(t, err)
+	rtest.Equals(t, []string{"/home/user/# not a comment", " /home/user/leading space", "/home/user/$HOME"}, lines)
+}
+
+func TestReadNullSeparated(t *testing.T) {
+	input := "/home/user/new\nline\x00\x00/home/user/# foo\x00/home/user/last"
+	names, err := filter.ReadNullSeparated(strings.NewReader(input))
+	rtest.OK(t, err)
+	rtest.Equals(t, []string{"/home/user/new\nline", "/home/user/# foo", "/home/user/last"}, names)
+}
+
+func TestLower(t *testing.T) {
+	patterns := filter.Lower([]string{"*.JPG", "C:\\Users\\Foo"})
+	rtest.Equals(t, []string{"*.jpg", "c:\\users\\foo"}, patterns)
+
+	match, _, err := filter.List(patterns, strings.ToLower("/home/user/IMG_0001.JPG"))
+	rtest.OK(t, err)
+	rtest.Assert(t, match, "lower case pattern did not match lower case path")
+}
@@ -10,8 +10,8 @@ import (
 )
 
 // DeviceID extracts the device ID from an os.FileInfo object by casting it
-// to syscall.Stat_t
-func DeviceID(fi os.FileInfo) (deviceID uint64, err error) {
+// to syscall.Stat_t. path is not used on this platform.
+func DeviceID(path string, fi os.FileInfo) (deviceID uint64, err error) {
 	if fi == nil {
 		return 0, errors.New("unable to determine device: fi is nil")
 	}
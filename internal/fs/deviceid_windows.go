@@ -6,10 +6,31 @@ import (
 	"os"
 
 	"github.com/restic/restic/internal/errors"
+
+	"golang.org/x/sys/windows"
 )
 
-// DeviceID extracts the device ID from an os.FileInfo object by casting it
-// to syscall.Stat_t
-func DeviceID(fi os.FileInfo) (deviceID uint64, err error) {
-	return 0, errors.New("Device IDs are not supported on Windows")
+// DeviceID returns the serial number of the volume the item at path is
+// stored on. A volume mounted in a directory of another volume (or a network
+// share) has a different serial number than the volume it is mounted on.
+func DeviceID(path string, fi os.FileInfo) (deviceID uint64, err error) {
+	name := fixpath(path)
+	p, err := windows.UTF16PtrFromString(name)
+	if err != nil {
+		return 0, errors.Wrap(err, "UTF16PtrFromString")
+	}
+
+	volume := make([]uint16, len(name)+windows.MAX_PATH)
+	err = windows.GetVolumePathName(p, &volume[0], uint32(len(volume)))
+	if err != nil {
+		return 0, errors.Wrapf(err, "unable to determine volume of %v", path)
+	}
+
+	var serial uint32
+	err = windows.GetVolumeInformation(&volume[0], nil, 0, &serial, nil, nil, nil, 0)
+	if err != nil {
+		return 0, errors.Wrapf(err, "unable to determine serial number of the volume of %v", path)
+	}
+
+	return uint64(serial), nil
 }
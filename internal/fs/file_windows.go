@@ -96,3 +96,18 @@ func TempFile(dir, prefix string) (f *os.File, err error) {
 func Chmod(name string, mode os.FileMode) error {
 	return os.Chmod(fixpath(name), mode)
 }
+
+// fsctlSetSparse is the control code which marks a file as sparse.
+const fsctlSetSparse = 0x900c4
+
+// MakeSparse prepares f for being written as a sparse file. On NTFS, the
+// parts of a file which are never written are only left unallocated when the
+// file has been marked as sparse.
+func MakeSparse(f *os.File) error {
+	var bytesReturned uint32
+	err := syscall.DeviceIoControl(syscall.Handle(f.Fd()), fsctlSetSparse, nil, 0, nil, 0, &bytesReturned, nil)
+	if err != nil {
+		return &os.PathError{Op: "DeviceIoControl", Path: f.Name(), Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,24 @@
+// +build !windows
+
+package fs
+
+import (
+	"os"
+	"syscall"
+
+	"github.com/restic/restic/internal/errors"
+)
+
+// Owner extracts the user and group ID of the owner from an os.FileInfo
+// object by casting it to syscall.Stat_t
+func Owner(fi os.FileInfo) (uid, gid uint32, err error) {
+	if fi == nil {
+		return 0, 0, errors.New("unable to determine owner: fi is nil")
+	}
+
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		return st.Uid, st.Gid, nil
+	}
+
+	return 0, 0, errors.New("Could not cast to syscall.Stat_t")
+}
@@ -0,0 +1,15 @@
+// +build windows
+
+package fs
+
+import (
+	"os"
+
+	"github.com/restic/restic/internal/errors"
+)
+
+// Owner extracts the user and group ID of the owner from an os.FileInfo
+// object by casting it to syscall.Stat_t
+func Owner(fi os.FileInfo) (uid, gid uint32, err error) {
+	return 0, 0, errors.New("Owner IDs are not supported on Windows")
+}
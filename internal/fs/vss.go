@@ -0,0 +1,10 @@
+package fs
+
+// ShadowCopy is a read-only snapshot of a volume created by the Volume
+// Shadow Copy Service on Windows. While it exists, SourcePath maps paths on
+// the volume to the shadow copy.
+type ShadowCopy struct {
+	ID     string // ID of the shadow copy, e.g. "{2c2a1f36-...}"
+	Volume string // the volume, e.g. "C:"
+	Device string // the device through which the shadow copy is read
+}
@@ -0,0 +1,21 @@
+// +build !windows
+
+package fs
+
+import "github.com/restic/restic/internal/errors"
+
+// CreateShadowCopy returns an error, shadow copies are only supported on
+// Windows.
+func CreateShadowCopy(volume string) (*ShadowCopy, error) {
+	return nil, errors.New("shadow copies are only supported on Windows")
+}
+
+// Delete does nothing.
+func (s *ShadowCopy) Delete() error {
+	return nil
+}
+
+// SourcePath returns name unchanged.
+func SourcePath(name string) string {
+	return name
+}
@@ -0,0 +1,154 @@
+package fs
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+)
+
+// shadowCopies contains the shadow copies which exist, by upper case volume
+// name.
+var shadowCopies struct {
+	m map[string]*ShadowCopy
+	sync.Mutex
+}
+
+// shadowCopyErrors are the messages for the return values of
+// Win32_ShadowCopy.Create.
+var shadowCopyErrors = map[string]string{
+	"1":  "access denied, run restic as administrator",
+	"2":  "invalid argument",
+	"3":  "volume not found",
+	"4":  "volume not supported",
+	"5":  "unsupported shadow copy context",
+	"6":  "insufficient storage",
+	"7":  "volume is in use",
+	"8":  "maximum number of shadow copies reached",
+	"9":  "another shadow copy operation is already in progress",
+	"10": "shadow copy provider vetoed the operation",
+	"11": "shadow copy provider not registered",
+	"12": "shadow copy provider failure",
+}
+
+// createShadowCopyScript creates a shadow copy of a volume via WMI and
+// prints its ID and device, or the return value of Create on failure.
+const createShadowCopyScript = `
+$r = (Get-WmiObject -List Win32_ShadowCopy).Create('%s\', 'ClientAccessible')
+if ($r.ReturnValue -ne 0) { Write-Output "error"; Write-Output $r.ReturnValue; exit 1 }
+$s = Get-WmiObject Win32_ShadowCopy | Where-Object { $_.ID -eq $r.ShadowID }
+Write-Output $s.ID
+Write-Output $s.DeviceObject
+`
+
+// deleteShadowCopyScript deletes the shadow copy with an ID.
+const deleteShadowCopyScript = `
+Get-WmiObject Win32_ShadowCopy | Where-Object { $_.ID -eq '%s' } | ForEach-Object { $_.Delete() }
+`
+
+// runPowerShell runs script and returns the non-empty lines it printed.
+func runPowerShell(script string) ([]string, error) {
+	cmd := exec.Command("powershell.exe", "-NoProfile", "-NonInteractive", "-Command", script)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+
+	var lines []string
+	for _, line := range strings.Split(string(out), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	if err != nil && (len(lines) == 0 || lines[0] != "error") {
+		return nil, errors.Errorf("powershell: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	return lines, nil
+}
+
+// CreateShadowCopy creates a shadow copy of volume (e.g. "C:"), which
+// requires administrator privileges. Until Delete is called, SourcePath maps
+// paths on the volume to the shadow copy.
+func CreateShadowCopy(volume string) (*ShadowCopy, error) {
+	if len(volume) != 2 || volume[1] != ':' {
+		return nil, errors.Errorf("invalid volume %q, only local drives are supported", volume)
+	}
+	volume = strings.ToUpper(volume)
+
+	lines, err := runPowerShell(fmt.Sprintf(createShadowCopyScript, volume))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(lines) == 2 && lines[0] == "error" {
+		msg, ok := shadowCopyErrors[lines[1]]
+		if !ok {
+			msg = "unknown error " + lines[1]
+		}
+		return nil, errors.Errorf("creating shadow copy of %v failed: %v", volume, msg)
+	}
+
+	if len(lines) != 2 {
+		return nil, errors.Errorf("unexpected output creating shadow copy of %v: %q", volume, lines)
+	}
+
+	s := &ShadowCopy{ID: lines[0], Volume: volume, Device: lines[1]}
+	debug.Log("created shadow copy %v of %v at %v", s.ID, s.Volume, s.Device)
+
+	shadowCopies.Lock()
+	if shadowCopies.m == nil {
+		shadowCopies.m = make(map[string]*ShadowCopy)
+	}
+	shadowCopies.m[volume] = s
+	shadowCopies.Unlock()
+
+	return s, nil
+}
+
+// Delete removes the shadow copy.
+func (s *ShadowCopy) Delete() error {
+	shadowCopies.Lock()
+	if shadowCopies.m[s.Volume] == s {
+		delete(shadowCopies.m, s.Volume)
+	}
+	shadowCopies.Unlock()
+
+	debug.Log("deleting shadow copy %v of %v", s.ID, s.Volume)
+	_, err := runPowerShell(fmt.Sprintf(deleteShadowCopyScript, s.ID))
+	if err != nil {
+		return errors.Wrapf(err, "deleting shadow copy of %v", s.Volume)
+	}
+	return nil
+}
+
+// SourcePath returns the path under which the file name is read for a
+// backup. If a shadow copy of its volume exists, the path points into the
+// shadow copy, otherwise name is returned.
+func SourcePath(name string) string {
+	shadowCopies.Lock()
+	defer shadowCopies.Unlock()
+
+	if len(shadowCopies.m) == 0 {
+		return name
+	}
+
+	abspath, err := filepath.Abs(name)
+	if err != nil {
+		return name
+	}
+
+	volume := filepath.VolumeName(abspath)
+	s, ok := shadowCopies.m[strings.ToUpper(volume)]
+	if !ok {
+		return name
+	}
+
+	return s.Device + abspath[len(volume):]
+}
@@ -0,0 +1,34 @@
+package fs
+
+import (
+	"testing"
+)
+
+func TestSourcePath(t *testing.T) {
+	s := &ShadowCopy{ID: "{test}", Volume: "C:", Device: `\\?\GLOBALROOT\Device\HarddiskVolumeShadowCopy1`}
+
+	shadowCopies.Lock()
+	shadowCopies.m = map[string]*ShadowCopy{"C:": s}
+	shadowCopies.Unlock()
+
+	defer func() {
+		shadowCopies.Lock()
+		shadowCopies.m = nil
+		shadowCopies.Unlock()
+	}()
+
+	var tests = []struct {
+		path, want string
+	}{
+		{`C:\Users\foo\file.pst`, `\\?\GLOBALROOT\Device\HarddiskVolumeShadowCopy1\Users\foo\file.pst`},
+		{`c:\Users`, `\\?\GLOBALROOT\Device\HarddiskVolumeShadowCopy1\Users`},
+		{`D:\data`, `D:\data`},
+		{`\\server\share\file`, `\\server\share\file`},
+	}
+
+	for _, test := range tests {
+		if got := SourcePath(test.path); got != test.want {
+			t.Errorf("SourcePath(%q) = %q, want %q", test.path, got, test.want)
+		}
+	}
+}
@@ -150,3 +150,28 @@ func TestFuseFile(t *testing.T) {
 
 	rtest.OK(t, f.Release(ctx, nil))
 }
+
+func TestFileOwner(t *testing.T) {
+	node := &restic.Node{Name: "foo", Mode: 0640, UID: 1000, GID: 100}
+
+	uid, gid := uint32(2000), uint32(200)
+	for _, tc := range []struct {
+		cfg      Config
+		uid, gid uint32
+	}{
+		{Config{}, 1000, 100},
+		{Config{OwnerIsRoot: true}, 0, 0},
+		{Config{UID: &uid}, 2000, 100},
+		{Config{GID: &gid}, 1000, 200},
+		{Config{UID: &uid, GID: &gid}, 2000, 200},
+	} {
+		root := &Root{cfg: tc.cfg}
+		f, err := newFile(context.TODO(), root, 1, node)
+		rtest.OK(t, err)
+
+		attr := fuse.Attr{}
+		rtest.OK(t, f.Attr(context.TODO(), &attr))
+		rtest.Equals(t, tc.uid, attr.Uid)
+		rtest.Equals(t, tc.gid, attr.Gid)
+	}
+}
@@ -16,7 +16,12 @@ import (
 
 // Config holds settings for the fuse mount.
 type Config struct {
-	OwnerIsRoot      bool
+	OwnerIsRoot bool
+
+	// UID and GID replace the owner and group of all files and directories
+	// if they are set.
+	UID, GID *uint32
+
 	Host             string
 	Tags             []restic.TagList
 	Paths            []string
@@ -37,6 +42,21 @@ type Root struct {
 	*MetaDir
 }
 
+// owner returns the owner and group shown for a node owned by uid and gid.
+func (r *Root) owner(uid, gid uint32) (uint32, uint32) {
+	if r.cfg.OwnerIsRoot {
+		return 0, 0
+	}
+
+	if r.cfg.UID != nil {
+		uid = *r.cfg.UID
+	}
+	if r.cfg.GID != nil {
+		gid = *r.cfg.GID
+	}
+	return uid, gid
+}
+
 // ensure that *Root implements these interfaces
 var _ = fs.HandleReadDirAller(&Root{})
 var _ = fs.NodeStringLookuper(&Root{})
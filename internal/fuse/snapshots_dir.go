@@ -6,6 +6,7 @@ package fuse
 import (
 	"fmt"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/restic/restic/internal/debug"
@@ -73,6 +74,12 @@ var _ = fs.HandleReadDirAller(&HostsDir{})
 var _ = fs.NodeStringLookuper(&HostsDir{})
 var _ = fs.NodeReadlinker(&snapshotLink{})
 
+// isValidDirName returns true if name can be used as the name of a
+// directory, tags and host names which cannot are not listed.
+func isValidDirName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.Contains(name, "/")
+}
+
 // read tag names from the current repository-state.
 func updateTagNames(d *TagsDir) {
 	if d.snCount != d.root.snCount {
@@ -80,7 +87,7 @@ func updateTagNames(d *TagsDir) {
 		d.tags = make(map[string]bool, len(d.root.snapshots))
 		for _, snapshot := range d.root.snapshots {
 			for _, tag := range snapshot.Tags {
-				if tag != "" {
+				if isValidDirName(tag) {
 					d.tags[tag] = true
 				}
 			}
@@ -94,7 +101,9 @@ func updateHostsNames(d *HostsDir) {
 		d.snCount = d.root.snCount
 		d.hosts = make(map[string]bool, len(d.root.snapshots))
 		for _, snapshot := range d.root.snapshots {
-			d.hosts[snapshot.Hostname] = true
+			if isValidDirName(snapshot.Hostname) {
+				d.hosts[snapshot.Hostname] = true
+			}
 		}
 	}
 }
@@ -103,6 +112,7 @@ func updateHostsNames(d *HostsDir) {
 func updateSnapshotIDSNames(d *SnapshotsIDSDir) {
 	if d.snCount != d.root.snCount {
 		d.snCount = d.root.snCount
+		d.names = make(map[string]*restic.Snapshot, len(d.root.snapshots))
 		for _, sn := range d.root.snapshots {
 			name := sn.ID().Str()
 			d.names[name] = sn
@@ -167,10 +177,7 @@ func (d *SnapshotsDir) Attr(ctx context.Context, attr *fuse.Attr) error {
 	attr.Inode = d.inode
 	attr.Mode = os.ModeDir | 0555
 
-	if !d.root.cfg.OwnerIsRoot {
-		attr.Uid = uint32(os.Getuid())
-		attr.Gid = uint32(os.Getgid())
-	}
+	attr.Uid, attr.Gid = d.root.owner(uint32(os.Getuid()), uint32(os.Getgid()))
 	debug.Log("attr: %v", attr)
 	return nil
 }
@@ -180,10 +187,7 @@ func (d *SnapshotsIDSDir) Attr(ctx context.Context, attr *fuse.Attr) error {
 	attr.Inode = d.inode
 	attr.Mode = os.ModeDir | 0555
 
-	if !d.root.cfg.OwnerIsRoot {
-		attr.Uid = uint32(os.Getuid())
-		attr.Gid = uint32(os.Getgid())
-	}
+	attr.Uid, attr.Gid = d.root.owner(uint32(os.Getuid()), uint32(os.Getgid()))
 	debug.Log("attr: %v", attr)
 	return nil
 }
@@ -193,10 +197,7 @@ func (d *HostsDir) Attr(ctx context.Context, attr *fuse.Attr) error {
 	attr.Inode = d.inode
 	attr.Mode = os.ModeDir | 0555
 
-	if !d.root.cfg.OwnerIsRoot {
-		attr.Uid = uint32(os.Getuid())
-		attr.Gid = uint32(os.Getgid())
-	}
+	attr.Uid, attr.Gid = d.root.owner(uint32(os.Getuid()), uint32(os.Getgid()))
 	debug.Log("attr: %v", attr)
 	return nil
 }
@@ -206,10 +207,7 @@ func (d *TagsDir) Attr(ctx context.Context, attr *fuse.Attr) error {
 	attr.Inode = d.inode
 	attr.Mode = os.ModeDir | 0555
 
-	if !d.root.cfg.OwnerIsRoot {
-		attr.Uid = uint32(os.Getuid())
-		attr.Gid = uint32(os.Getgid())
-	}
+	attr.Uid, attr.Gid = d.root.owner(uint32(os.Getuid()), uint32(os.Getgid()))
 	debug.Log("attr: %v", attr)
 	return nil
 }
@@ -436,10 +434,7 @@ func (l *snapshotLink) Attr(ctx context.Context, a *fuse.Attr) error {
 	a.Inode = l.inode
 	a.Mode = os.ModeSymlink | 0777
 
-	if !l.root.cfg.OwnerIsRoot {
-		a.Uid = uint32(os.Getuid())
-		a.Gid = uint32(os.Getgid())
-	}
+	a.Uid, a.Gid = l.root.owner(uint32(os.Getuid()), uint32(os.Getgid()))
 	a.Atime = l.snapshot.Time
 	a.Ctime = l.snapshot.Time
 	a.Mtime = l.snapshot.Time
@@ -519,13 +514,13 @@ func (d *HostsDir) Lookup(ctx context.Context, name string) (fs.Node, error) {
 
 		_, ok := d.hosts[name]
 		if ok {
-			return NewSnapshotsDir(d.root, fs.GenerateDynamicInode(d.root.inode, name), "", name), nil
+			return NewSnapshotsDir(d.root, fs.GenerateDynamicInode(d.inode, name), "", name), nil
 		}
 
 		return nil, fuse.ENOENT
 	}
 
-	return NewSnapshotsDir(d.root, fs.GenerateDynamicInode(d.root.inode, name), "", name), nil
+	return NewSnapshotsDir(d.root, fs.GenerateDynamicInode(d.inode, name), "", name), nil
 }
 
 // Lookup returns a specific entry from the TagsDir.
@@ -542,11 +537,11 @@ func (d *TagsDir) Lookup(ctx context.Context, name string) (fs.Node, error) {
 
 		_, ok := d.tags[name]
 		if ok {
-			return NewSnapshotsDir(d.root, fs.GenerateDynamicInode(d.root.inode, name), name, ""), nil
+			return NewSnapshotsDir(d.root, fs.GenerateDynamicInode(d.inode, name), name, ""), nil
 		}
 
 		return nil, fuse.ENOENT
 	}
 
-	return NewSnapshotsDir(d.root, fs.GenerateDynamicInode(d.root.inode, name), name, ""), nil
+	return NewSnapshotsDir(d.root, fs.GenerateDynamicInode(d.inode, name), name, ""), nil
 }
@@ -0,0 +1,89 @@
+package metrics
+
+import (
+	"context"
+	"io"
+
+	"github.com/restic/restic/internal/restic"
+)
+
+// Backend wraps be so that the requests and the bytes transferred are counted
+// in the default registry.
+func Backend(be restic.Backend) restic.Backend {
+	return &countingBackend{Backend: be}
+}
+
+type countingBackend struct {
+	restic.Backend
+}
+
+// record counts a request for the operation op which returned err. Files
+// which do not exist are not counted as errors.
+func (be *countingBackend) record(op string, err error) {
+	BackendRequests.With(op).Inc()
+	if err != nil && !be.Backend.IsNotExist(err) {
+		BackendErrors.With(op).Inc()
+	}
+}
+
+func (be *countingBackend) Save(ctx context.Context, h restic.Handle, rd restic.RewindReader) error {
+	err := be.Backend.Save(ctx, h, countingRewindReader{rd})
+	be.record("save", err)
+	return err
+}
+
+type countingRewindReader struct {
+	restic.RewindReader
+}
+
+func (rd countingRewindReader) Read(p []byte) (int, error) {
+	n, err := rd.RewindReader.Read(p)
+	BytesUploaded.Add(uint64(n))
+	return n, err
+}
+
+func (be *countingBackend) Load(ctx context.Context, h restic.Handle, length int, offset int64) (io.ReadCloser, error) {
+	rd, err := be.Backend.Load(ctx, h, length, offset)
+	be.record("load", err)
+	if err != nil {
+		return nil, err
+	}
+
+	return countingReadCloser{rd}, nil
+}
+
+type countingReadCloser struct {
+	io.ReadCloser
+}
+
+func (rd countingReadCloser) Read(p []byte) (int, error) {
+	n, err := rd.ReadCloser.Read(p)
+	BytesDownloaded.Add(uint64(n))
+	return n, err
+}
+
+func (be *countingBackend) Stat(ctx context.Context, h restic.Handle) (restic.FileInfo, error) {
+	fi, err := be.Backend.Stat(ctx, h)
+	be.record("stat", err)
+	return fi, err
+}
+
+func (be *countingBackend) Test(ctx context.Context, h restic.Handle) (bool, error) {
+	found, err := be.Backend.Test(ctx, h)
+	be.record("test", err)
+	return found, err
+}
+
+func (be *countingBackend) Remove(ctx context.Context, h restic.Handle) error {
+	err := be.Backend.Remove(ctx, h)
+	be.record("remove", err)
+	return err
+}
+
+func (be *countingBackend) List(ctx context.Context, t restic.FileType, fn func(restic.FileInfo) error) error {
+	err := be.Backend.List(ctx, t, fn)
+	be.record("list", err)
+	return err
+}
+
+var _ restic.Backend = (*countingBackend)(nil)
@@ -0,0 +1,2 @@
+// Package metrics implements counters which can be scraped by Prometheus.
+package metrics
@@ -0,0 +1,170 @@
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// Counter is a value which only increases. It is safe for concurrent use.
+type Counter struct {
+	v uint64
+}
+
+// Add increases the counter by n.
+func (c *Counter) Add(n uint64) {
+	atomic.AddUint64(&c.v, n)
+}
+
+// Inc increases the counter by one.
+func (c *Counter) Inc() {
+	c.Add(1)
+}
+
+// Value returns the current value of the counter.
+func (c *Counter) Value() uint64 {
+	return atomic.LoadUint64(&c.v)
+}
+
+// CounterVec is a set of counters which are distinguished by the value of a
+// single label.
+type CounterVec struct {
+	label string
+
+	m        sync.Mutex
+	counters map[string]*Counter
+}
+
+// With returns the counter for the label value, it is created on first use.
+func (v *CounterVec) With(value string) *Counter {
+	v.m.Lock()
+	defer v.m.Unlock()
+
+	c, ok := v.counters[value]
+	if !ok {
+		c = &Counter{}
+		v.counters[value] = c
+	}
+	return c
+}
+
+// values returns the label values and their counters, sorted by value.
+func (v *CounterVec) values() (values []string, counters []*Counter) {
+	v.m.Lock()
+	defer v.m.Unlock()
+
+	for value := range v.counters {
+		values = append(values, value)
+	}
+	sort.Strings(values)
+
+	for _, value := range values {
+		counters = append(counters, v.counters[value])
+	}
+	return values, counters
+}
+
+// metric is a counter or a set of counters registered under a name.
+type metric struct {
+	name string
+	help string
+	c    *Counter
+	vec  *CounterVec
+}
+
+// Registry collects the metrics which are exported together.
+type Registry struct {
+	m       sync.Mutex
+	metrics []metric
+}
+
+// NewRegistry returns a new, empty registry.
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (r *Registry) register(m metric) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	for _, other := range r.metrics {
+		if other.name == m.name {
+			panic(fmt.Sprintf("metric %v registered twice", m.name))
+		}
+	}
+
+	r.metrics = append(r.metrics, m)
+}
+
+// NewCounter registers a new counter with the name and help text.
+func (r *Registry) NewCounter(name, help string) *Counter {
+	c := &Counter{}
+	r.register(metric{name: name, help: help, c: c})
+	return c
+}
+
+// NewCounterVec registers a new set of counters with the name and help text,
+// which are distinguished by the label.
+func (r *Registry) NewCounterVec(name, help, label string) *CounterVec {
+	v := &CounterVec{label: label, counters: make(map[string]*Counter)}
+	r.register(metric{name: name, help: help, vec: v})
+	return v
+}
+
+// Write writes all metrics in the Prometheus text format to wr, in the order
+// in which they were registered.
+func (r *Registry) Write(wr io.Writer) error {
+	r.m.Lock()
+	metrics := append([]metric(nil), r.metrics...)
+	r.m.Unlock()
+
+	var buf bytes.Buffer
+	for _, m := range metrics {
+		fmt.Fprintf(&buf, "# HELP %s %s\n", m.name, m.help)
+		fmt.Fprintf(&buf, "# TYPE %s counter\n", m.name)
+
+		if m.c != nil {
+			fmt.Fprintf(&buf, "%s %d\n", m.name, m.c.Value())
+			continue
+		}
+
+		values, counters := m.vec.values()
+		for i, value := range values {
+			fmt.Fprintf(&buf, "%s{%s=%q} %d\n", m.name, m.vec.label, value, counters[i].Value())
+		}
+	}
+
+	_, err := wr.Write(buf.Bytes())
+	return err
+}
+
+// ServeHTTP returns the metrics in the Prometheus text format.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	_ = r.Write(w)
+}
+
+// Default is the registry which contains the metrics of restic.
+var Default = NewRegistry()
+
+// The metrics recorded by restic.
+var (
+	BackendRequests = Default.NewCounterVec("restic_backend_requests_total",
+		"Number of requests sent to the backend.", "operation")
+	BackendErrors = Default.NewCounterVec("restic_backend_errors_total",
+		"Number of requests to the backend which failed.", "operation")
+	BackendRetries = Default.NewCounter("restic_backend_retries_total",
+		"Number of failed backend operations which were retried.")
+	BytesUploaded = Default.NewCounter("restic_backend_uploaded_bytes_total",
+		"Bytes sent to the backend.")
+	BytesDownloaded = Default.NewCounter("restic_backend_downloaded_bytes_total",
+		"Bytes received from the backend.")
+	CacheHits = Default.NewCounter("restic_cache_hits_total",
+		"Number of files which were read from the local cache.")
+	CacheMisses = Default.NewCounter("restic_cache_misses_total",
+		"Number of files which were not found in the local cache and were read from the backend.")
+)
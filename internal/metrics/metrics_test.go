@@ -0,0 +1,83 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/restic/restic/internal/backend/mem"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestRegistryWrite(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounter("test_total", "A counter.")
+	v := r.NewCounterVec("test_requests_total", "Some requests.", "operation")
+
+	c.Add(3)
+	v.With("save").Inc()
+	v.With("load").Add(2)
+
+	var buf bytes.Buffer
+	rtest.OK(t, r.Write(&buf))
+
+	want := `# HELP test_total A counter.
+# TYPE test_total counter
+test_total 3
+# HELP test_requests_total Some requests.
+# TYPE test_requests_total counter
+test_requests_total{operation="load"} 2
+test_requests_total{operation="save"} 1
+`
+	rtest.Equals(t, want, buf.String())
+
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	res, err := http.Get(srv.URL)
+	rtest.OK(t, err)
+	body, err := ioutil.ReadAll(res.Body)
+	rtest.OK(t, err)
+	rtest.OK(t, res.Body.Close())
+
+	rtest.Equals(t, want, string(body))
+	rtest.Assert(t, strings.HasPrefix(res.Header.Get("Content-Type"), "text/plain"),
+		"wrong content type %q", res.Header.Get("Content-Type"))
+}
+
+func TestBackend(t *testing.T) {
+	ctx := context.Background()
+	be := Backend(mem.New())
+
+	data := []byte("foobar")
+	h := restic.Handle{Type: restic.DataFile, Name: restic.Hash(data).String()}
+
+	saves := BackendRequests.With("save").Value()
+	loads := BackendRequests.With("load").Value()
+	statErrors := BackendErrors.With("stat").Value()
+	uploaded := BytesUploaded.Value()
+	downloaded := BytesDownloaded.Value()
+
+	rtest.OK(t, be.Save(ctx, h, restic.NewByteReader(data)))
+
+	rd, err := be.Load(ctx, h, 0, 0)
+	rtest.OK(t, err)
+	_, err = ioutil.ReadAll(rd)
+	rtest.OK(t, err)
+	rtest.OK(t, rd.Close())
+
+	// files which do not exist are not counted as errors
+	_, err = be.Stat(ctx, restic.Handle{Type: restic.DataFile, Name: "missing"})
+	rtest.Assert(t, err != nil, "expected error for missing file")
+
+	rtest.Equals(t, saves+1, BackendRequests.With("save").Value())
+	rtest.Equals(t, loads+1, BackendRequests.With("load").Value())
+	rtest.Equals(t, statErrors, BackendErrors.With("stat").Value())
+	rtest.Equals(t, uploaded+uint64(len(data)), BytesUploaded.Value())
+	rtest.Equals(t, downloaded+uint64(len(data)), BytesDownloaded.Value())
+}
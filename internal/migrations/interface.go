@@ -20,3 +20,10 @@ type Migration interface {
 	// Descr returns a description what the migration does.
 	Desc() string
 }
+
+// RollbackRecorder is implemented by migrations which can describe how to undo
+// their changes. RollbackInfo is called before the migration is applied, the
+// result is stored in the record for the migration.
+type RollbackRecorder interface {
+	RollbackInfo(context.Context, restic.Repository) (map[string]string, error)
+}
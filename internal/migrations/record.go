@@ -0,0 +1,154 @@
+package migrations
+
+import (
+	"context"
+	"os"
+	"os/user"
+	"time"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+)
+
+// Record status values.
+const (
+	StatusRunning   = "running"
+	StatusCompleted = "completed"
+	StatusFailed    = "failed"
+)
+
+// Record is saved in the repository for each migration that is applied. It
+// allows checking which migrations were applied to a repository, and contains
+// the information needed to undo a migration manually.
+type Record struct {
+	Migration string            `json:"migration"`
+	Time      time.Time         `json:"time"`
+	Finished  time.Time         `json:"finished,omitempty"`
+	Status    string            `json:"status"`
+	Error     string            `json:"error,omitempty"`
+	Version   string            `json:"version"`
+	Hostname  string            `json:"hostname"`
+	Username  string            `json:"username"`
+	Rollback  map[string]string `json:"rollback,omitempty"`
+
+	id *restic.ID
+}
+
+// ID returns the ID of the file the record is stored in.
+func (r Record) ID() *restic.ID {
+	return r.id
+}
+
+// LoadRecords returns the records of all migrations applied to the
+// repository. Records which cannot be loaded are ignored.
+func LoadRecords(ctx context.Context, repo restic.Repository) (records []*Record, err error) {
+	err = repo.List(ctx, restic.MigrationFile, func(id restic.ID, size int64) error {
+		r := &Record{}
+		if err := repo.LoadJSONUnpacked(ctx, restic.MigrationFile, id, r); err != nil {
+			debug.Log("unable to load migration record %v: %v", id.Str(), err)
+			return nil
+		}
+
+		r.id = &id
+		records = append(records, r)
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+// Applied returns the most recent record for the migration name which has
+// completed successfully, or nil if the migration was never applied.
+func Applied(records []*Record, name string) *Record {
+	var latest *Record
+	for _, r := range records {
+		if r.Migration != name || r.Status != StatusCompleted {
+			continue
+		}
+
+		if latest == nil || r.Time.After(latest.Time) {
+			latest = r
+		}
+	}
+
+	return latest
+}
+
+// save stores r in the repository and removes the file the record was stored
+// in before.
+func (r *Record) save(ctx context.Context, repo restic.Repository) error {
+	id, err := repo.SaveJSONUnpacked(ctx, restic.MigrationFile, r)
+	if err != nil {
+		return err
+	}
+
+	old := r.id
+	r.id = &id
+
+	if old != nil {
+		debug.Log("removing superseded migration record %v", old.Str())
+		return repo.Backend().Remove(ctx, restic.Handle{Type: restic.MigrationFile, Name: old.String()})
+	}
+
+	return nil
+}
+
+// Run applies the migration m to the repository. Before the migration is
+// applied, a record with the status "running" and the rollback information
+// (if the migration provides it) is saved in the repository. The record is
+// updated with the result of the migration afterwards. version is the version
+// of restic that applies the migration.
+func Run(ctx context.Context, repo restic.Repository, m Migration, version string) (*Record, error) {
+	r := &Record{
+		Migration: m.Name(),
+		Time:      time.Now(),
+		Status:    StatusRunning,
+		Version:   version,
+	}
+
+	hn, err := os.Hostname()
+	if err == nil {
+		r.Hostname = hn
+	}
+
+	usr, err := user.Current()
+	if err == nil {
+		r.Username = usr.Username
+	}
+
+	if rb, ok := m.(RollbackRecorder); ok {
+		r.Rollback, err = rb.RollbackInfo(ctx, repo)
+		if err != nil {
+			return nil, errors.Wrap(err, "RollbackInfo")
+		}
+	}
+
+	if err = r.save(ctx, repo); err != nil {
+		return nil, errors.Wrap(err, "save migration record")
+	}
+
+	applyErr := m.Apply(ctx, repo)
+
+	r.Finished = time.Now()
+	r.Status = StatusCompleted
+	if applyErr != nil {
+		r.Status = StatusFailed
+		r.Error = applyErr.Error()
+	}
+
+	err = r.save(ctx, repo)
+	if applyErr != nil {
+		return r, applyErr
+	}
+
+	if err != nil {
+		return r, errors.Wrap(err, "save migration record")
+	}
+
+	return r, nil
+}
@@ -0,0 +1,58 @@
+package migrations_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/migrations"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+type testMigration struct {
+	err error
+}
+
+func (m *testMigration) Check(context.Context, restic.Repository) (bool, error) { return true, nil }
+func (m *testMigration) Apply(context.Context, restic.Repository) error         { return m.err }
+func (m *testMigration) Name() string                                           { return "test" }
+func (m *testMigration) Desc() string                                           { return "test migration" }
+
+func (m *testMigration) RollbackInfo(context.Context, restic.Repository) (map[string]string, error) {
+	return map[string]string{"foo": "bar"}, nil
+}
+
+func TestRun(t *testing.T) {
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+
+	records, err := migrations.LoadRecords(context.TODO(), repo)
+	rtest.OK(t, err)
+	rtest.Equals(t, 0, len(records))
+
+	// a failed migration is recorded, but not reported as applied
+	_, err = migrations.Run(context.TODO(), repo, &testMigration{err: errors.New("failed")}, "test")
+	rtest.Assert(t, err != nil, "expected error, got nil")
+
+	records, err = migrations.LoadRecords(context.TODO(), repo)
+	rtest.OK(t, err)
+	rtest.Equals(t, 1, len(records))
+	rtest.Equals(t, migrations.StatusFailed, records[0].Status)
+	rtest.Equals(t, "failed", records[0].Error)
+	rtest.Assert(t, migrations.Applied(records, "test") == nil, "failed migration listed as applied")
+
+	r, err := migrations.Run(context.TODO(), repo, &testMigration{}, "test")
+	rtest.OK(t, err)
+
+	records, err = migrations.LoadRecords(context.TODO(), repo)
+	rtest.OK(t, err)
+	rtest.Equals(t, 2, len(records))
+
+	applied := migrations.Applied(records, "test")
+	rtest.Assert(t, applied != nil, "migration not listed as applied")
+	rtest.Equals(t, r.ID(), applied.ID())
+	rtest.Equals(t, migrations.StatusCompleted, applied.Status)
+	rtest.Equals(t, "bar", applied.Rollback["foo"])
+}
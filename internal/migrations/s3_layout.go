@@ -71,6 +71,16 @@ func (m *S3Layout) moveFiles(ctx context.Context, be *s3.Backend, l backend.Layo
 	return nil
 }
 
+// RollbackInfo returns the layout used before the migration.
+func (m *S3Layout) RollbackInfo(ctx context.Context, repo restic.Repository) (map[string]string, error) {
+	be, ok := repo.Backend().(*s3.Backend)
+	if !ok {
+		return nil, errors.New("backend is not s3")
+	}
+
+	return map[string]string{"layout": be.Layout.Name()}, nil
+}
+
 // Apply runs the migration.
 func (m *S3Layout) Apply(ctx context.Context, repo restic.Repository) error {
 	be, ok := repo.Backend().(*s3.Backend)
@@ -96,6 +106,7 @@ func (m *S3Layout) Apply(ctx context.Context, repo restic.Repository) error {
 		restic.DataFile,
 		restic.KeyFile,
 		restic.LockFile,
+		restic.MigrationFile,
 	} {
 		err := m.moveFiles(ctx, be, newLayout, t)
 		if err != nil {
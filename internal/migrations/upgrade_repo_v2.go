@@ -0,0 +1,119 @@
+package migrations
+
+import (
+	"context"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"strconv"
+
+	"github.com/restic/restic/internal/backend"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+)
+
+func init() {
+	register(&UpgradeRepoV2{})
+}
+
+// UpgradeRepoV2 upgrades a repository to version 2. Afterwards, new pack
+// files contain a checksum of the header, existing pack files are not
+// changed. Older versions of restic cannot access the repository any more.
+type UpgradeRepoV2 struct{}
+
+// Check tests whether the migration can be applied.
+func (m *UpgradeRepoV2) Check(ctx context.Context, repo restic.Repository) (bool, error) {
+	return repo.Config().Version < 2, nil
+}
+
+// writeBackup saves buf in a temporary file and returns the file name.
+func writeBackup(buf []byte) (string, error) {
+	f, err := ioutil.TempFile("", "restic-config-backup-")
+	if err != nil {
+		return "", errors.Wrap(err, "TempFile")
+	}
+
+	if _, err = f.Write(buf); err != nil {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+		return "", errors.Wrap(err, "Write")
+	}
+
+	if err = f.Close(); err != nil {
+		_ = os.Remove(f.Name())
+		return "", errors.Wrap(err, "Close")
+	}
+
+	return f.Name(), nil
+}
+
+// RollbackInfo returns the version of the repository and the (encrypted)
+// config file before the migration, which can be saved again to restore the
+// old version.
+func (m *UpgradeRepoV2) RollbackInfo(ctx context.Context, repo restic.Repository) (map[string]string, error) {
+	buf, err := backend.LoadAll(ctx, repo.Backend(), restic.Handle{Type: restic.ConfigFile})
+	if err != nil {
+		return nil, errors.Wrap(err, "load config")
+	}
+
+	return map[string]string{
+		"version": strconv.FormatUint(uint64(repo.Config().Version), 10),
+		"config":  base64.StdEncoding.EncodeToString(buf),
+	}, nil
+}
+
+// Apply runs the migration.
+func (m *UpgradeRepoV2) Apply(ctx context.Context, repo restic.Repository) error {
+	cfg := repo.Config()
+	if cfg.Version >= 2 {
+		return errors.Errorf("repository already has version %d", cfg.Version)
+	}
+
+	be := repo.Backend()
+	h := restic.Handle{Type: restic.ConfigFile}
+
+	// the config file cannot be replaced in place, so keep a copy of the old
+	// one in case saving the new config fails
+	oldConfig, err := backend.LoadAll(ctx, be, h)
+	if err != nil {
+		return errors.Wrap(err, "load config")
+	}
+
+	backupFile, err := writeBackup(oldConfig)
+	if err != nil {
+		return err
+	}
+	debug.Log("old config saved to %v", backupFile)
+
+	if err = be.Remove(ctx, h); err != nil {
+		_ = os.Remove(backupFile)
+		return errors.Wrap(err, "remove config")
+	}
+
+	cfg.Version = 2
+	_, err = repo.SaveJSONUnpacked(ctx, restic.ConfigFile, cfg)
+	if err != nil {
+		rerr := be.Save(ctx, h, restic.NewByteReader(oldConfig))
+		if rerr != nil {
+			return errors.Errorf("saving the new config failed: %v, restoring the old config failed as well: %v, "+
+				"a copy of the old config file is stored at %v", err, rerr, backupFile)
+		}
+
+		_ = os.Remove(backupFile)
+		return errors.Wrap(err, "save config")
+	}
+
+	_ = os.Remove(backupFile)
+	return nil
+}
+
+// Name returns the name for this migration.
+func (m *UpgradeRepoV2) Name() string {
+	return "upgrade_repo_v2"
+}
+
+// Desc returns a short description what the migration does.
+func (m *UpgradeRepoV2) Desc() string {
+	return "upgrade the repository to version 2, new packs contain a checksum of the header"
+}
@@ -10,16 +10,17 @@ import (
 
 // Backend implements a mock backend.
 type Backend struct {
-	CloseFn      func() error
-	IsNotExistFn func(err error) bool
-	SaveFn       func(ctx context.Context, h restic.Handle, rd io.Reader) error
-	LoadFn       func(ctx context.Context, h restic.Handle, length int, offset int64) (io.ReadCloser, error)
-	StatFn       func(ctx context.Context, h restic.Handle) (restic.FileInfo, error)
-	ListFn       func(ctx context.Context, t restic.FileType, fn func(restic.FileInfo) error) error
-	RemoveFn     func(ctx context.Context, h restic.Handle) error
-	TestFn       func(ctx context.Context, h restic.Handle) (bool, error)
-	DeleteFn     func(ctx context.Context) error
-	LocationFn   func() string
+	CloseFn            func() error
+	IsNotExistFn       func(err error) bool
+	IsPermanentErrorFn func(err error) bool
+	SaveFn             func(ctx context.Context, h restic.Handle, rd restic.RewindReader) error
+	LoadFn             func(ctx context.Context, h restic.Handle, length int, offset int64) (io.ReadCloser, error)
+	StatFn             func(ctx context.Context, h restic.Handle) (restic.FileInfo, error)
+	ListFn             func(ctx context.Context, t restic.FileType, fn func(restic.FileInfo) error) error
+	RemoveFn           func(ctx context.Context, h restic.Handle) error
+	TestFn             func(ctx context.Context, h restic.Handle) (bool, error)
+	DeleteFn           func(ctx context.Context) error
+	LocationFn         func() string
 }
 
 // Close the backend.
@@ -49,8 +50,17 @@ func (m *Backend) IsNotExist(err error) bool {
 	return m.IsNotExistFn(err)
 }
 
+// IsPermanentError returns true if the error cannot be resolved by retrying.
+func (m *Backend) IsPermanentError(err error) bool {
+	if m.IsPermanentErrorFn == nil {
+		return false
+	}
+
+	return m.IsPermanentErrorFn(err)
+}
+
 // Save data in the backend.
-func (m *Backend) Save(ctx context.Context, h restic.Handle, rd io.Reader) error {
+func (m *Backend) Save(ctx context.Context, h restic.Handle, rd restic.RewindReader) error {
 	if m.SaveFn == nil {
 		return errors.New("not implemented")
 	}
@@ -0,0 +1,431 @@
+// Package nbd implements a read-only server for the network block device
+// (NBD) protocol. Only the fixed newstyle handshake is supported, which is
+// what all current clients (e.g. nbd-client, qemu-nbd) use.
+//
+// The protocol is described in
+// https://github.com/NetworkBlockDevice/nbd/blob/master/doc/proto.md
+package nbd
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"net"
+	"sync"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+)
+
+// protocol constants, the names follow the specification.
+const (
+	nbdMagic         = 0x4e42444d41474943 // "NBDMAGIC"
+	optMagic         = 0x49484156454f5054 // "IHAVEOPT"
+	optReplyMagic    = 0x3e889045565a9
+	requestMagic     = 0x25609513
+	simpleReplyMagic = 0x67446698
+
+	flagFixedNewstyle = 1 << 0
+	flagNoZeroes      = 1 << 1
+
+	flagHasFlags = 1 << 0
+	flagReadOnly = 1 << 1
+
+	optExportName = 1
+	optAbort      = 2
+	optList       = 3
+	optInfo       = 6
+	optGo         = 7
+
+	repAck    = 1
+	repServer = 2
+	repInfo   = 3
+
+	repErrUnsup   = 1<<31 + 1
+	repErrInvalid = 1<<31 + 3
+	repErrUnknown = 1<<31 + 6
+
+	infoExport = 0
+
+	cmdRead  = 0
+	cmdWrite = 1
+	cmdDisc  = 2
+	cmdFlush = 3
+	cmdTrim  = 4
+
+	errPerm  = 1
+	errIO    = 5
+	errInval = 22
+)
+
+// maxOptionLength is the maximal length of the data sent with an option,
+// maxReadLength the maximal number of bytes returned for a read request.
+const (
+	maxOptionLength = 64 * 1024
+	maxReadLength   = 32 * 1024 * 1024
+)
+
+// Export is a block device offered to clients.
+type Export struct {
+	// Name is the name of the export. Clients which request the default
+	// export (with an empty name) get this export, too.
+	Name string
+
+	// Size is the size of the device in bytes.
+	Size int64
+
+	io.ReaderAt
+}
+
+// errAbort is returned when the client ends the connection during the
+// handshake.
+var errAbort = errors.New("client aborted the handshake")
+
+// Serve accepts connections on l and serves exp to the clients until ctx is
+// cancelled. Errors on individual connections are only logged.
+func Serve(ctx context.Context, l net.Listener, exp Export) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	go func() {
+		<-ctx.Done()
+		_ = l.Close()
+	}()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return errors.Wrap(err, "Accept")
+		}
+
+		debug.Log("new connection from %v", conn.RemoteAddr())
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := ServeConn(ctx, conn, exp)
+			if err != nil {
+				debug.Log("connection from %v: %v", conn.RemoteAddr(), err)
+			}
+		}()
+	}
+}
+
+// ServeConn runs the handshake with the client connected via conn and then
+// answers the requests until the client disconnects or ctx is cancelled. The
+// connection is closed afterwards.
+func ServeConn(ctx context.Context, conn net.Conn, exp Export) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	go func() {
+		<-ctx.Done()
+		_ = conn.Close()
+	}()
+
+	c := &serverConn{
+		rd:  bufio.NewReader(conn),
+		wr:  bufio.NewWriter(conn),
+		exp: exp,
+	}
+
+	err := c.handshake()
+	if err == errAbort {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	err = c.transmission()
+	if ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
+
+type serverConn struct {
+	rd  *bufio.Reader
+	wr  *bufio.Writer
+	exp Export
+
+	noZeroes bool
+}
+
+func (c *serverConn) read(data ...interface{}) error {
+	for _, v := range data {
+		if err := binary.Read(c.rd, binary.BigEndian, v); err != nil {
+			return errors.Wrap(err, "Read")
+		}
+	}
+	return nil
+}
+
+func (c *serverConn) write(data ...interface{}) error {
+	for _, v := range data {
+		if err := binary.Write(c.wr, binary.BigEndian, v); err != nil {
+			return errors.Wrap(err, "Write")
+		}
+	}
+	return nil
+}
+
+func (c *serverConn) flush() error {
+	return errors.Wrap(c.wr.Flush(), "Flush")
+}
+
+// transmissionFlags returns the flags sent to the client for the export.
+func (c *serverConn) transmissionFlags() uint16 {
+	return flagHasFlags | flagReadOnly
+}
+
+// handshake negotiates the options with the client, it returns nil when the
+// client has selected the export.
+func (c *serverConn) handshake() error {
+	err := c.write(uint64(nbdMagic), uint64(optMagic), uint16(flagFixedNewstyle|flagNoZeroes))
+	if err != nil {
+		return err
+	}
+
+	if err = c.flush(); err != nil {
+		return err
+	}
+
+	var clientFlags uint32
+	if err = c.read(&clientFlags); err != nil {
+		return err
+	}
+
+	if clientFlags&flagFixedNewstyle == 0 {
+		return errors.New("client does not support the fixed newstyle handshake")
+	}
+	c.noZeroes = clientFlags&flagNoZeroes != 0
+
+	for {
+		var (
+			magic  uint64
+			option uint32
+			length uint32
+		)
+
+		if err = c.read(&magic, &option, &length); err != nil {
+			return err
+		}
+
+		if magic != optMagic {
+			return errors.Errorf("invalid option magic %x", magic)
+		}
+
+		if length > maxOptionLength {
+			return errors.Errorf("option data too large (%d bytes)", length)
+		}
+
+		data := make([]byte, length)
+		if _, err = io.ReadFull(c.rd, data); err != nil {
+			return errors.Wrap(err, "ReadFull")
+		}
+
+		debug.Log("option %d, %d bytes of data", option, length)
+
+		done, err := c.handleOption(option, data)
+		if err != nil {
+			return err
+		}
+
+		if err = c.flush(); err != nil {
+			return err
+		}
+
+		if done {
+			return nil
+		}
+	}
+}
+
+// handleOption processes a single option, done is true when the transmission
+// phase starts afterwards.
+func (c *serverConn) handleOption(option uint32, data []byte) (done bool, err error) {
+	switch option {
+	case optExportName:
+		if !c.knownExport(string(data)) {
+			// there is no way to report an error for this option
+			return false, errors.Errorf("client requested unknown export %q", data)
+		}
+
+		err = c.write(uint64(c.exp.Size), c.transmissionFlags())
+		if err == nil && !c.noZeroes {
+			err = c.write(make([]byte, 124))
+		}
+		return true, err
+
+	case optAbort:
+		err = c.reply(option, repAck, nil)
+		if err == nil {
+			err = c.flush()
+		}
+		if err != nil {
+			return false, err
+		}
+		return false, errAbort
+
+	case optList:
+		if len(data) != 0 {
+			return false, c.replyError(option, repErrInvalid, "unexpected data for list")
+		}
+
+		buf := make([]byte, 4, 4+len(c.exp.Name))
+		binary.BigEndian.PutUint32(buf, uint32(len(c.exp.Name)))
+		buf = append(buf, c.exp.Name...)
+		if err = c.reply(option, repServer, buf); err != nil {
+			return false, err
+		}
+		return false, c.reply(option, repAck, nil)
+
+	case optInfo, optGo:
+		if len(data) < 6 {
+			return false, c.replyError(option, repErrInvalid, "option data too short")
+		}
+
+		nameLen := int(binary.BigEndian.Uint32(data))
+		if len(data) < 4+nameLen+2 {
+			return false, c.replyError(option, repErrInvalid, "option data too short")
+		}
+
+		name := string(data[4 : 4+nameLen])
+		if !c.knownExport(name) {
+			return false, c.replyError(option, repErrUnknown, "unknown export")
+		}
+
+		// the client may request additional information, but the size and
+		// flags are all there is to tell
+		buf := make([]byte, 12)
+		binary.BigEndian.PutUint16(buf[0:], infoExport)
+		binary.BigEndian.PutUint64(buf[2:], uint64(c.exp.Size))
+		binary.BigEndian.PutUint16(buf[10:], c.transmissionFlags())
+		if err = c.reply(option, repInfo, buf); err != nil {
+			return false, err
+		}
+
+		if err = c.reply(option, repAck, nil); err != nil {
+			return false, err
+		}
+
+		return option == optGo, nil
+
+	default:
+		return false, c.replyError(option, repErrUnsup, "unsupported option")
+	}
+}
+
+// knownExport returns true if the client may use name to select the export.
+func (c *serverConn) knownExport(name string) bool {
+	return name == "" || name == c.exp.Name
+}
+
+func (c *serverConn) reply(option, typ uint32, data []byte) error {
+	err := c.write(uint64(optReplyMagic), option, typ, uint32(len(data)))
+	if err != nil {
+		return err
+	}
+	_, err = c.wr.Write(data)
+	return errors.Wrap(err, "Write")
+}
+
+func (c *serverConn) replyError(option, typ uint32, msg string) error {
+	return c.reply(option, typ, []byte(msg))
+}
+
+// transmission answers requests until the client disconnects.
+func (c *serverConn) transmission() error {
+	var buf []byte
+
+	for {
+		var (
+			magic  uint32
+			flags  uint16
+			typ    uint16
+			handle uint64
+			offset uint64
+			length uint32
+		)
+
+		err := c.read(&magic, &flags, &typ, &handle, &offset, &length)
+		if err != nil {
+			return err
+		}
+
+		if magic != requestMagic {
+			return errors.Errorf("invalid request magic %x", magic)
+		}
+
+		switch typ {
+		case cmdRead:
+			if offset+uint64(length) > uint64(c.exp.Size) || offset+uint64(length) < offset || length > maxReadLength {
+				err = c.simpleReply(handle, errInval, nil)
+				break
+			}
+
+			if cap(buf) < int(length) {
+				buf = make([]byte, length)
+			}
+			buf = buf[:length]
+
+			_, rerr := c.exp.ReadAt(buf, int64(offset))
+			if rerr != nil && rerr != io.EOF {
+				debug.Log("read %d bytes at %d failed: %v", length, offset, rerr)
+				err = c.simpleReply(handle, errIO, nil)
+				break
+			}
+
+			err = c.simpleReply(handle, 0, buf)
+
+		case cmdWrite:
+			// the payload must be consumed before the error is sent
+			_, err = io.CopyN(ioutil.Discard, c.rd, int64(length))
+			if err != nil {
+				return errors.Wrap(err, "Discard")
+			}
+			err = c.simpleReply(handle, errPerm, nil)
+
+		case cmdDisc:
+			debug.Log("client disconnected")
+			return nil
+
+		case cmdFlush:
+			// nothing is ever written
+			err = c.simpleReply(handle, 0, nil)
+
+		case cmdTrim:
+			err = c.simpleReply(handle, errPerm, nil)
+
+		default:
+			err = c.simpleReply(handle, errInval, nil)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if err = c.flush(); err != nil {
+			return err
+		}
+	}
+}
+
+func (c *serverConn) simpleReply(handle uint64, code uint32, data []byte) error {
+	err := c.write(uint32(simpleReplyMagic), code, handle)
+	if err != nil {
+		return err
+	}
+	_, err = c.wr.Write(data)
+	return errors.Wrap(err, "Write")
+}
@@ -0,0 +1,224 @@
+package nbd
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+
+	rtest "github.com/restic/restic/internal/test"
+)
+
+// testClient implements the client side of the protocol.
+type testClient struct {
+	t    *testing.T
+	conn net.Conn
+}
+
+func (c *testClient) write(data ...interface{}) {
+	for _, v := range data {
+		// writes to a net.Pipe block until they are read, even empty ones
+		if buf, ok := v.([]byte); ok && len(buf) == 0 {
+			continue
+		}
+
+		err := binary.Write(c.conn, binary.BigEndian, v)
+		if err != nil {
+			c.t.Fatal(err)
+		}
+	}
+}
+
+func (c *testClient) read(data ...interface{}) {
+	for _, v := range data {
+		err := binary.Read(c.conn, binary.BigEndian, v)
+		if err != nil {
+			c.t.Fatal(err)
+		}
+	}
+}
+
+func (c *testClient) readBytes(n int) []byte {
+	buf := make([]byte, n)
+	_, err := io.ReadFull(c.conn, buf)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	return buf
+}
+
+// handshake reads the greeting from the server and sends the client flags.
+func (c *testClient) handshake() {
+	var (
+		magic1, magic2 uint64
+		flags          uint16
+	)
+	c.read(&magic1, &magic2, &flags)
+	rtest.Equals(c.t, uint64(nbdMagic), magic1)
+	rtest.Equals(c.t, uint64(optMagic), magic2)
+	rtest.Assert(c.t, flags&flagFixedNewstyle != 0, "fixed newstyle flag not set")
+
+	c.write(uint32(flagFixedNewstyle | flagNoZeroes))
+}
+
+// option sends an option with the data.
+func (c *testClient) option(option uint32, data []byte) {
+	c.write(uint64(optMagic), option, uint32(len(data)), data)
+}
+
+// reply reads a reply for an option.
+func (c *testClient) reply(option uint32) (typ uint32, data []byte) {
+	var (
+		magic  uint64
+		opt    uint32
+		length uint32
+	)
+	c.read(&magic, &opt, &typ, &length)
+	rtest.Equals(c.t, uint64(optReplyMagic), magic)
+	rtest.Equals(c.t, option, opt)
+
+	return typ, c.readBytes(int(length))
+}
+
+// request sends a request and reads the reply header.
+func (c *testClient) request(typ uint16, handle, offset uint64, length uint32, payload []byte) (code uint32) {
+	c.write(uint32(requestMagic), uint16(0), typ, handle, offset, length, payload)
+
+	var (
+		magic uint32
+		h     uint64
+	)
+	c.read(&magic, &code, &h)
+	rtest.Equals(c.t, uint32(simpleReplyMagic), magic)
+	rtest.Equals(c.t, handle, h)
+	return code
+}
+
+func nameData(name string) []byte {
+	buf := make([]byte, 4, 4+len(name)+2)
+	binary.BigEndian.PutUint32(buf, uint32(len(name)))
+	buf = append(buf, name...)
+	// no information requests
+	return append(buf, 0, 0)
+}
+
+func startServer(t *testing.T, exp Export) (*testClient, func()) {
+	srv, cl := net.Pipe()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- ServeConn(ctx, srv, exp)
+	}()
+
+	cleanup := func() {
+		_ = cl.Close()
+		cancel()
+		if err := <-done; err != nil {
+			t.Logf("server returned error: %v", err)
+		}
+	}
+
+	return &testClient{t: t, conn: cl}, cleanup
+}
+
+func TestServeConn(t *testing.T) {
+	data := rtest.Random(23, 100000)
+	exp := Export{Name: "image", Size: int64(len(data)), ReaderAt: bytes.NewReader(data)}
+
+	c, cleanup := startServer(t, exp)
+	defer cleanup()
+
+	c.handshake()
+
+	// list the exports
+	c.option(optList, nil)
+	typ, reply := c.reply(optList)
+	rtest.Equals(t, uint32(repServer), typ)
+	rtest.Equals(t, append([]byte{0, 0, 0, 5}, "image"...), reply)
+	typ, _ = c.reply(optList)
+	rtest.Equals(t, uint32(repAck), typ)
+
+	// unknown options are rejected
+	c.option(42, nil)
+	typ, _ = c.reply(42)
+	rtest.Equals(t, uint32(repErrUnsup), typ)
+
+	// unknown exports are rejected
+	c.option(optInfo, nameData("foo"))
+	typ, _ = c.reply(optInfo)
+	rtest.Equals(t, uint32(repErrUnknown), typ)
+
+	// select the export
+	c.option(optGo, nameData("image"))
+	typ, reply = c.reply(optGo)
+	rtest.Equals(t, uint32(repInfo), typ)
+	rtest.Equals(t, 12, len(reply))
+	rtest.Equals(t, uint64(len(data)), binary.BigEndian.Uint64(reply[2:]))
+	rtest.Equals(t, uint16(flagHasFlags|flagReadOnly), binary.BigEndian.Uint16(reply[10:]))
+	typ, _ = c.reply(optGo)
+	rtest.Equals(t, uint32(repAck), typ)
+
+	// read some data
+	var tests = []struct {
+		offset uint64
+		length uint32
+	}{
+		{0, 512},
+		{1000, 4096},
+		{uint64(len(data)) - 10, 10},
+	}
+
+	for i, test := range tests {
+		code := c.request(cmdRead, uint64(i), test.offset, test.length, nil)
+		rtest.Equals(t, uint32(0), code)
+		buf := c.readBytes(int(test.length))
+		if !bytes.Equal(buf, data[test.offset:test.offset+uint64(test.length)]) {
+			t.Errorf("wrong data returned for offset %d, length %d", test.offset, test.length)
+		}
+	}
+
+	// reads beyond the end fail
+	code := c.request(cmdRead, 10, uint64(len(data))-10, 20, nil)
+	rtest.Equals(t, uint32(errInval), code)
+
+	// writes are rejected
+	code = c.request(cmdWrite, 11, 0, 4, []byte("test"))
+	rtest.Equals(t, uint32(errPerm), code)
+
+	// the connection is still usable
+	code = c.request(cmdRead, 12, 0, 10, nil)
+	rtest.Equals(t, uint32(0), code)
+	rtest.Equals(t, data[:10], c.readBytes(10))
+
+	c.write(uint32(requestMagic), uint16(0), uint16(cmdDisc), uint64(13), uint64(0), uint32(0))
+}
+
+func TestServeConnExportName(t *testing.T) {
+	data := rtest.Random(42, 4096)
+	exp := Export{Name: "image", Size: int64(len(data)), ReaderAt: bytes.NewReader(data)}
+
+	c, cleanup := startServer(t, exp)
+	defer cleanup()
+
+	c.handshake()
+
+	// request the default export with the old option
+	c.option(optExportName, nil)
+
+	var (
+		size  uint64
+		flags uint16
+	)
+	c.read(&size, &flags)
+	rtest.Equals(t, uint64(len(data)), size)
+	rtest.Equals(t, uint16(flagHasFlags|flagReadOnly), flags)
+
+	code := c.request(cmdRead, 1, 100, 100, nil)
+	rtest.Equals(t, uint32(0), code)
+	rtest.Equals(t, data[100:200], c.readBytes(100))
+
+	c.write(uint32(requestMagic), uint16(0), uint16(cmdDisc), uint64(2), uint64(0), uint32(0))
+}
@@ -201,6 +201,19 @@ func (o Options) Apply(ns string, dst interface{}) error {
 
 			v.Field(i).SetUint(vi)
 
+		case "bool":
+			// a bare option without value enables it
+			if value == "" {
+				value = "true"
+			}
+
+			vb, err := strconv.ParseBool(value)
+			if err != nil {
+				return err
+			}
+
+			v.Field(i).SetBool(vb)
+
 		case "Duration":
 			d, err := time.ParseDuration(value)
 			if err != nil {
@@ -2,6 +2,7 @@ package pack
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"encoding/binary"
 	"fmt"
 	"io"
@@ -22,6 +23,8 @@ type Packer struct {
 	k     *crypto.Key
 	wr    io.Writer
 
+	headerChecksum bool
+
 	m sync.Mutex
 }
 
@@ -34,6 +37,16 @@ func NewPacker(k *crypto.Key, wr io.Writer) *Packer {
 	return &Packer{k: k, wr: wr}
 }
 
+// EnableHeaderChecksum configures the packer to store a SHA-256 hash of the
+// encrypted header in the pack, as required for repositories with version 2
+// or later.
+func (p *Packer) EnableHeaderChecksum() {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	p.headerChecksum = true
+}
+
 // Add saves the data read from rd as a new blob to the packer. Returned is the
 // number of bytes written to the pack.
 func (p *Packer) Add(t restic.BlobType, id restic.ID, data []byte) (int, error) {
@@ -93,8 +106,20 @@ func (p *Packer) Finalize() (uint, error) {
 
 	bytesWritten += uint(hdrBytes)
 
+	hdrLength := uint32(restic.CiphertextLength(len(p.blobs) * int(entrySize)))
+	if p.headerChecksum {
+		sum := sha256.Sum256(encryptedHeader)
+		n, err = p.wr.Write(sum[:])
+		if err != nil {
+			return 0, errors.Wrap(err, "Write")
+		}
+		bytesWritten += uint(n)
+
+		hdrLength |= headerChecksumFlag
+	}
+
 	// write length
-	err = binary.Write(p.wr, binary.LittleEndian, uint32(restic.CiphertextLength(len(p.blobs)*int(entrySize))))
+	err = binary.Write(p.wr, binary.LittleEndian, hdrLength)
 	if err != nil {
 		return 0, errors.Wrap(err, "binary.Write")
 	}
@@ -172,6 +197,14 @@ func (p *Packer) String() string {
 
 const maxHeaderSize = 16 * 1024 * 1024
 
+// headerChecksumFlag is set in the header length of packs which contain a
+// SHA-256 hash of the encrypted header, stored between the header and the
+// header length. This allows detecting a damaged header without the key.
+const (
+	headerChecksumFlag = 1 << 31
+	headerChecksumSize = sha256.Size
+)
+
 // we require at least one entry in the header, and one blob for a pack file
 var minFileSize = entrySize + crypto.Extension
 
@@ -179,7 +212,8 @@ var minFileSize = entrySize + crypto.Extension
 var eagerEntries = uint(15)
 
 // readHeader reads the header at the end of rd. size is the length of the
-// whole data accessible in rd.
+// whole data accessible in rd. If the pack contains a checksum of the header,
+// it is verified.
 func readHeader(rd io.ReaderAt, size int64) ([]byte, error) {
 	debug.Log("size: %v", size)
 	if size == 0 {
@@ -196,13 +230,14 @@ func readHeader(rd io.ReaderAt, size int64) ([]byte, error) {
 	// eagerly download eagerEntries header entries as part of header-length request.
 	// only make second request if actual number of entries is greater than eagerEntries
 
-	eagerHl := uint32((eagerEntries * entrySize) + crypto.Extension)
-	if int64(eagerHl) > size {
-		eagerHl = uint32(size) - uint32(binary.Size(uint32(0)))
+	lengthSize := int64(binary.Size(uint32(0)))
+	eagerSize := int64(eagerEntries*entrySize+crypto.Extension+headerChecksumSize) + lengthSize
+	if eagerSize > size {
+		eagerSize = size
 	}
-	eagerBuf := make([]byte, eagerHl+uint32(binary.Size(uint32(0))))
+	eagerBuf := make([]byte, eagerSize)
 
-	n, err := rd.ReadAt(eagerBuf, size-int64(len(eagerBuf)))
+	n, err := rd.ReadAt(eagerBuf, size-eagerSize)
 	if err != nil {
 		return nil, err
 	}
@@ -210,8 +245,25 @@ func readHeader(rd io.ReaderAt, size int64) ([]byte, error) {
 		return nil, errors.New("not enough bytes read")
 	}
 
-	hl := binary.LittleEndian.Uint32(eagerBuf[eagerHl:])
-	debug.Log("header length: %v", size)
+	hl := binary.LittleEndian.Uint32(eagerBuf[eagerSize-lengthSize:])
+	eagerBuf = eagerBuf[:eagerSize-lengthSize]
+	debug.Log("header length: %v", hl)
+
+	// trailer is the number of bytes after the header
+	trailer := lengthSize
+
+	var checksum []byte
+	if hl&headerChecksumFlag != 0 {
+		hl &^= headerChecksumFlag
+		if len(eagerBuf) < headerChecksumSize {
+			err := InvalidFileError{Message: "file is too small"}
+			return nil, errors.Wrap(err, "readHeader")
+		}
+
+		checksum = eagerBuf[len(eagerBuf)-headerChecksumSize:]
+		eagerBuf = eagerBuf[:len(eagerBuf)-headerChecksumSize]
+		trailer += headerChecksumSize
+	}
 
 	if hl == 0 {
 		err := InvalidFileError{Message: "header length is zero"}
@@ -228,7 +280,7 @@ func readHeader(rd io.ReaderAt, size int64) ([]byte, error) {
 		return nil, errors.Wrap(err, "readHeader")
 	}
 
-	if int64(hl) > size-int64(binary.Size(hl)) {
+	if int64(hl) > size-trailer {
 		err := InvalidFileError{Message: "header is larger than file"}
 		return nil, errors.Wrap(err, "readHeader")
 	}
@@ -238,24 +290,30 @@ func readHeader(rd io.ReaderAt, size int64) ([]byte, error) {
 		return nil, errors.Wrap(err, "readHeader")
 	}
 
-	eagerBuf = eagerBuf[:eagerHl]
-
 	var buf []byte
-	if hl <= eagerHl {
+	if int(hl) <= len(eagerBuf) {
 		// already have all header bytes. yay.
-		buf = eagerBuf[eagerHl-hl:]
+		buf = eagerBuf[len(eagerBuf)-int(hl):]
 	} else {
 		// need more header bytes
 		buf = make([]byte, hl)
-		missingHl := hl - eagerHl
-		n, err := rd.ReadAt(buf[:missingHl], size-int64(hl)-int64(binary.Size(hl)))
+		missingHl := int(hl) - len(eagerBuf)
+		n, err := rd.ReadAt(buf[:missingHl], size-int64(hl)-trailer)
 		if err != nil {
 			return nil, errors.Wrap(err, "ReadAt")
 		}
-		if uint32(n) != missingHl {
+		if n != missingHl {
 			return nil, errors.New("not enough bytes read")
 		}
-		copy(buf[hl-eagerHl:], eagerBuf)
+		copy(buf[missingHl:], eagerBuf)
+	}
+
+	if checksum != nil {
+		sum := sha256.Sum256(buf)
+		if !bytes.Equal(sum[:], checksum) {
+			err := InvalidFileError{Message: "header checksum does not match, the pack is damaged"}
+			return nil, errors.Wrap(err, "readHeader")
+		}
 	}
 
 	return buf, nil
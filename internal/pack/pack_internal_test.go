@@ -2,6 +2,7 @@ package pack
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"encoding/binary"
 	"io"
 	"testing"
@@ -44,3 +45,28 @@ func TestReadHeaderEagerLoad(t *testing.T) {
 	testReadHeader(eagerEntries, 1)
 	testReadHeader(eagerEntries+1, 2)
 }
+
+func TestReadHeaderChecksumEagerLoad(t *testing.T) {
+	testReadHeader := func(entryCount uint, expectedReadInvocationCount int) {
+		expectedHeader := rtest.Random(0, int(entryCount*entrySize)+crypto.Extension)
+		sum := sha256.Sum256(expectedHeader)
+
+		buf := &bytes.Buffer{}
+		buf.Write(rtest.Random(0, 100))                                                        // pack blobs data
+		buf.Write(expectedHeader)                                                              // pack header
+		buf.Write(sum[:])                                                                      // header checksum
+		binary.Write(buf, binary.LittleEndian, uint32(len(expectedHeader))|headerChecksumFlag) // pack header length
+
+		rd := &countingReaderAt{delegate: bytes.NewReader(buf.Bytes())}
+
+		header, err := readHeader(rd, int64(buf.Len()))
+		rtest.OK(t, err)
+
+		rtest.Equals(t, expectedHeader, header)
+		rtest.Equals(t, expectedReadInvocationCount, rd.invocationCount)
+	}
+
+	testReadHeader(1, 1)
+	testReadHeader(eagerEntries, 1)
+	testReadHeader(eagerEntries+1, 2)
+}
@@ -12,6 +12,7 @@ import (
 
 	"github.com/restic/restic/internal/backend/mem"
 	"github.com/restic/restic/internal/crypto"
+	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/pack"
 	"github.com/restic/restic/internal/restic"
 	rtest "github.com/restic/restic/internal/test"
@@ -127,7 +128,7 @@ func TestUnpackReadSeeker(t *testing.T) {
 	id := restic.Hash(packData)
 
 	handle := restic.Handle{Type: restic.DataFile, Name: id.String()}
-	rtest.OK(t, b.Save(context.TODO(), handle, bytes.NewReader(packData)))
+	rtest.OK(t, b.Save(context.TODO(), handle, restic.NewByteReader(packData)))
 	verifyBlobs(t, bufs, k, restic.ReaderAt(b, handle), packSize)
 }
 
@@ -140,6 +141,39 @@ func TestShortPack(t *testing.T) {
 	id := restic.Hash(packData)
 
 	handle := restic.Handle{Type: restic.DataFile, Name: id.String()}
-	rtest.OK(t, b.Save(context.TODO(), handle, bytes.NewReader(packData)))
+	rtest.OK(t, b.Save(context.TODO(), handle, restic.NewByteReader(packData)))
 	verifyBlobs(t, bufs, k, restic.ReaderAt(b, handle), packSize)
 }
+
+func TestPackHeaderChecksum(t *testing.T) {
+	k := crypto.NewRandomKey()
+
+	p := pack.NewPacker(k, nil)
+	p.EnableHeaderChecksum()
+	for _, l := range testLens {
+		b := rtest.Random(l, l)
+		_, err := p.Add(restic.DataBlob, restic.Hash(b), b)
+		rtest.OK(t, err)
+	}
+
+	_, err := p.Finalize()
+	rtest.OK(t, err)
+
+	packData := p.Writer().(*bytes.Buffer).Bytes()
+	rtest.Equals(t, uint(len(packData)), p.Size())
+
+	entries, err := pack.List(k, bytes.NewReader(packData), int64(len(packData)))
+	rtest.OK(t, err)
+	rtest.Equals(t, len(testLens), len(entries))
+
+	// damage the header, which is detected by the checksum before the header
+	// is decrypted
+	headerSize := restic.CiphertextLength(len(testLens) * (binary.Size(restic.BlobType(0)) + binary.Size(uint32(0)) + len(restic.ID{})))
+	damaged := append([]byte{}, packData...)
+	damaged[len(damaged)-4-sha256.Size-headerSize/2] ^= 0x01
+
+	_, err = pack.List(k, bytes.NewReader(damaged), int64(len(damaged)))
+	rtest.Assert(t, err != nil, "damaged header not detected")
+	_, ok := errors.Cause(err).(pack.InvalidFileError)
+	rtest.Assert(t, ok, "wrong error returned: %v", err)
+}
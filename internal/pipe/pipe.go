@@ -34,6 +34,10 @@ type Entry struct {
 	// points to the old node if available, interface{} is used to prevent
 	// circular import
 	Node interface{}
+
+	// Changed is set if the old snapshot contains the file, but it has been
+	// modified since, so Node is nil.
+	Changed bool
 }
 
 func (e Entry) Path() string          { return e.path }
@@ -62,7 +66,7 @@ func (e Dir) Result() chan<- Result { return e.result }
 // a sorted list of directory entries.
 // taken from filepath/path.go
 func readDirNames(dirname string) ([]string, error) {
-	f, err := fs.Open(dirname)
+	f, err := fs.Open(fs.SourcePath(dirname))
 	if err != nil {
 		return nil, errors.Wrap(err, "Open")
 	}
@@ -87,7 +91,7 @@ func walk(ctx context.Context, basedir, dir string, selectFunc SelectFunc, jobs
 		panic(err)
 	}
 
-	info, err := fs.Lstat(dir)
+	info, err := fs.Lstat(fs.SourcePath(dir))
 	if err != nil {
 		err = errors.Wrap(err, "Lstat")
 		debug.Log("error for %v: %v, res %p", dir, err, res)
@@ -133,7 +137,7 @@ func walk(ctx context.Context, basedir, dir string, selectFunc SelectFunc, jobs
 	for _, name := range names {
 		subpath := filepath.Join(dir, name)
 
-		fi, statErr := fs.Lstat(subpath)
+		fi, statErr := fs.Lstat(fs.SourcePath(subpath))
 		if !selectFunc(subpath, fi) {
 			debug.Log("file %v excluded by filter", subpath)
 			continue
@@ -0,0 +1,84 @@
+package progress
+
+import (
+	"sync"
+	"time"
+)
+
+// statusMessage is the JSON representation of a status update.
+type statusMessage struct {
+	MessageType      string   `json:"message_type"`
+	Action           string   `json:"action,omitempty"`
+	SecondsElapsed   uint64   `json:"seconds_elapsed"`
+	SecondsRemaining uint64   `json:"seconds_remaining,omitempty"`
+	PercentDone      float64  `json:"percent_done"`
+	TotalFiles       uint64   `json:"total_files,omitempty"`
+	FilesDone        uint64   `json:"files_done"`
+	TotalBytes       uint64   `json:"total_bytes,omitempty"`
+	BytesDone        uint64   `json:"bytes_done"`
+	Total            uint64   `json:"total,omitempty"`
+	Done             uint64   `json:"done,omitempty"`
+	ErrorCount       uint64   `json:"error_count"`
+	CurrentFiles     []string `json:"current_files,omitempty"`
+}
+
+// JSON prints the status as JSON messages with the type "status", at most
+// once per Interval.
+type JSON struct {
+	// Message writes a single message.
+	Message func(interface{})
+	// Action describes what is counted when the operation counts items
+	// other than files (e.g. "packs"), it is included in the messages.
+	Action string
+	// Interval is the minimal time between two messages, the default is one
+	// second.
+	Interval time.Duration
+
+	m    sync.Mutex
+	last time.Time
+}
+
+func (j *JSON) message(s Status) statusMessage {
+	msg := statusMessage{
+		MessageType:      "status",
+		Action:           j.Action,
+		SecondsElapsed:   uint64(s.Elapsed / time.Second),
+		SecondsRemaining: uint64(s.Remaining / time.Second),
+		PercentDone:      s.PercentDone,
+		TotalFiles:       s.Total.Files,
+		FilesDone:        s.Done.Files,
+		TotalBytes:       s.Total.Bytes,
+		BytesDone:        s.Done.Bytes,
+		ErrorCount:       s.Done.Errors,
+		CurrentFiles:     s.CurrentFiles,
+	}
+
+	if j.Action != "" {
+		msg.Total = s.Total.Blobs
+		msg.Done = s.Done.Blobs
+	}
+
+	return msg
+}
+
+// Update prints a status message unless the last one was printed less than
+// Interval ago.
+func (j *JSON) Update(s Status) {
+	interval := j.Interval
+	if interval == 0 {
+		interval = time.Second
+	}
+
+	j.m.Lock()
+	if time.Since(j.last) < interval {
+		j.m.Unlock()
+		return
+	}
+	j.last = time.Now()
+	j.m.Unlock()
+
+	j.Message(j.message(s))
+}
+
+// Done does nothing, the summary of an operation is printed by the command.
+func (j *JSON) Done(s Status) {}
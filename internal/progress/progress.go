@@ -0,0 +1,106 @@
+// Package progress prints the status of long running operations, either as
+// text on a terminal or as JSON messages.
+package progress
+
+import (
+	"time"
+
+	"github.com/restic/restic/internal/restic"
+)
+
+// Status describes the progress of an operation at one point in time.
+type Status struct {
+	Elapsed time.Duration
+	Done    restic.Stat
+	Total   restic.Stat
+
+	// PercentDone is the fraction of the operation which is done, between 0
+	// and 1. It is zero when the total is unknown.
+	PercentDone float64
+
+	// Remaining is the estimated time until the operation is done, it is
+	// zero when it cannot be estimated yet.
+	Remaining time.Duration
+
+	// BytesPerSecond is the average rate at which data was processed.
+	BytesPerSecond uint64
+
+	// CurrentFiles are the files which are currently processed.
+	CurrentFiles []string
+}
+
+// done returns the amount of work which is done and the total, in bytes if
+// the total number of bytes is known, otherwise in blobs or items (files and
+// directories).
+func done(cur, total restic.Stat) (uint64, uint64) {
+	switch {
+	case total.Bytes > 0:
+		return cur.Bytes, total.Bytes
+	case total.Blobs > 0:
+		return cur.Blobs, total.Blobs
+	default:
+		return cur.Files + cur.Dirs, total.Files + total.Dirs
+	}
+}
+
+// NewStatus computes the status of an operation which has processed cur of
+// total within d.
+func NewStatus(cur, total restic.Stat, d time.Duration, files []string) Status {
+	s := Status{
+		Elapsed:      d,
+		Done:         cur,
+		Total:        total,
+		CurrentFiles: files,
+	}
+
+	if sec := uint64(d / time.Second); sec > 0 {
+		s.BytesPerSecond = cur.Bytes / sec
+	}
+
+	n, max := done(cur, total)
+	if max == 0 {
+		return s
+	}
+
+	s.PercentDone = float64(n) / float64(max)
+	if s.PercentDone > 1 {
+		s.PercentDone = 1
+	}
+
+	if n > 0 && n < max {
+		s.Remaining = time.Duration(float64(d)*float64(max-n)/float64(n)) / time.Second * time.Second
+	}
+
+	return s
+}
+
+// Printer prints the status of an operation.
+type Printer interface {
+	// Update is called periodically while the operation is running.
+	Update(Status)
+	// Done is called once when the operation has finished.
+	Done(Status)
+}
+
+// New returns a restic.Progress which calls pr with the status of the
+// operation. Updates are printed at least every interval, if it is zero
+// they are only printed when stdout is a terminal. The total for the
+// operation can be set with SetTotal on the returned progress.
+func New(pr Printer, interval time.Duration) *restic.Progress {
+	var p *restic.Progress
+	if interval > 0 {
+		p = restic.NewProgressInterval(interval)
+	} else {
+		p = restic.NewProgress()
+	}
+
+	p.OnUpdate = func(s restic.Stat, d time.Duration, ticker bool) {
+		pr.Update(NewStatus(s, p.Total(), d, p.CurrentItems()))
+	}
+
+	p.OnDone = func(s restic.Stat, d time.Duration, ticker bool) {
+		pr.Done(NewStatus(s, p.Total(), d, nil))
+	}
+
+	return p
+}
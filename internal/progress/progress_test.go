@@ -0,0 +1,74 @@
+package progress
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestNewStatus(t *testing.T) {
+	var tests = []struct {
+		cur, total restic.Stat
+		d          time.Duration
+		percent    float64
+		remaining  time.Duration
+	}{
+		{restic.Stat{}, restic.Stat{}, time.Second, 0, 0},
+		{restic.Stat{Bytes: 25}, restic.Stat{Bytes: 100}, 10 * time.Second, 0.25, 30 * time.Second},
+		{restic.Stat{Bytes: 100}, restic.Stat{Bytes: 100}, 10 * time.Second, 1, 0},
+		{restic.Stat{Bytes: 150}, restic.Stat{Bytes: 100}, 10 * time.Second, 1, 0},
+		{restic.Stat{Blobs: 1}, restic.Stat{Blobs: 4}, 5 * time.Second, 0.25, 15 * time.Second},
+		{restic.Stat{Files: 1, Dirs: 1}, restic.Stat{Files: 3, Dirs: 1}, time.Second, 0.5, time.Second},
+	}
+
+	for i, test := range tests {
+		s := NewStatus(test.cur, test.total, test.d, nil)
+		if s.PercentDone != test.percent {
+			t.Errorf("test %d: wrong percentage, want %v, got %v", i, test.percent, s.PercentDone)
+		}
+		if s.Remaining != test.remaining {
+			t.Errorf("test %d: wrong remaining time, want %v, got %v", i, test.remaining, s.Remaining)
+		}
+	}
+}
+
+func TestTextShorten(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	text := &Text{
+		Writer:   buf,
+		Terminal: true,
+		Width:    func() int { return 20 },
+		Format: func(s Status) string {
+			return "[status]"
+		},
+	}
+
+	text.Update(Status{CurrentFiles: []string{"/home/user/a/long/file/name", "/foo"}})
+	rtest.Equals(t, "[status]  /home/...\r", buf.String())
+
+	buf.Reset()
+	text.Terminal = false
+	text.Update(Status{CurrentFiles: []string{"/foo"}})
+	rtest.Equals(t, "[status]  /foo\n", buf.String())
+}
+
+func TestJSONInterval(t *testing.T) {
+	var msgs []interface{}
+	j := &JSON{
+		Message:  func(msg interface{}) { msgs = append(msgs, msg) },
+		Interval: time.Hour,
+	}
+
+	j.Update(NewStatus(restic.Stat{Files: 1}, restic.Stat{Files: 2}, time.Second, []string{"foo"}))
+	j.Update(NewStatus(restic.Stat{Files: 2}, restic.Stat{Files: 2}, time.Second, nil))
+	rtest.Equals(t, 1, len(msgs))
+
+	msg := msgs[0].(statusMessage)
+	rtest.Equals(t, "status", msg.MessageType)
+	rtest.Equals(t, uint64(1), msg.FilesDone)
+	rtest.Equals(t, []string{"foo"}, msg.CurrentFiles)
+	rtest.Equals(t, "", msg.Action)
+}
@@ -0,0 +1,94 @@
+package progress
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Text prints the status as a line of text. On a terminal, the line is
+// overwritten by each update and shortened to the width of the terminal.
+type Text struct {
+	Writer io.Writer
+
+	// Terminal is true when Writer is a terminal.
+	Terminal bool
+	// Width returns the width of the terminal, or zero if it is not known.
+	Width func() int
+	// ClearLine is printed on a terminal before each update.
+	ClearLine string
+	// Hidden returns true when no updates should be printed, e.g. because
+	// the process runs in the background. It may be nil.
+	Hidden func() bool
+
+	// Format returns the status line, the current files are appended to it.
+	Format func(Status) string
+	// Summary returns the text printed when the operation has finished, it
+	// may be nil.
+	Summary func(Status) string
+}
+
+// statusLine returns the line for s, shortened to width if it is not zero.
+func (t *Text) statusLine(s Status, width int) string {
+	line := t.Format(s)
+	if len(s.CurrentFiles) > 0 {
+		line += "  " + s.CurrentFiles[0]
+		if len(s.CurrentFiles) > 1 {
+			line += fmt.Sprintf(" (and %d more)", len(s.CurrentFiles)-1)
+		}
+	}
+
+	return Shorten(line, width)
+}
+
+// Shorten cuts s at width, the end is replaced with "...". It is returned
+// unchanged when width is zero.
+func Shorten(s string, width int) string {
+	if width <= 0 || len(s) < width {
+		return s
+	}
+
+	// leave the last column free, some terminals wrap otherwise
+	max := width - 1
+	if max < 4 {
+		return ""
+	}
+
+	return s[:max-3] + "..."
+}
+
+// Update prints the status line.
+func (t *Text) Update(s Status) {
+	if t.Hidden != nil && t.Hidden() {
+		return
+	}
+
+	if !t.Terminal {
+		fmt.Fprintln(t.Writer, t.statusLine(s, 0))
+		return
+	}
+
+	width := 0
+	if t.Width != nil {
+		width = t.Width()
+	}
+
+	fmt.Fprintf(t.Writer, "%s%s\r", t.ClearLine, t.statusLine(s, width))
+}
+
+// Done prints the summary.
+func (t *Text) Done(s Status) {
+	if t.Terminal {
+		fmt.Fprintln(t.Writer)
+	}
+
+	if t.Summary == nil {
+		return
+	}
+
+	summary := t.Summary(s)
+	if summary != "" && !strings.HasSuffix(summary, "\n") {
+		summary += "\n"
+	}
+	fmt.Fprint(t.Writer, summary)
+}
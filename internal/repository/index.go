@@ -1,9 +1,12 @@
 package repository
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"io"
+	"math"
+	"sort"
 	"sync"
 	"time"
 
@@ -14,39 +17,208 @@ import (
 )
 
 // Index holds a lookup table for id -> pack.
+//
+// In order to keep the memory usage low for large repositories, the entries
+// are kept in a slice instead of a map. The first sorted entries are ordered
+// by blob handle and searched with a binary search, entries added later are
+// appended and found via pending until they are merged into the sorted part.
+// Each pack ID is stored only once in packs, the entries reference it by its
+// position in the list.
 type Index struct {
 	m         sync.Mutex
-	pack      map[restic.BlobHandle][]indexEntry
+	blobs     []indexEntry
+	sorted    int
+	pending   map[restic.BlobHandle][]int
+	packs     restic.IDs
+	packIndex map[restic.ID]uint32
 	treePacks restic.IDs
 
 	final      bool      // set to true for all indexes read from the backend ("finalized")
+	treesOnly  bool      // set to true if only the tree blobs were decoded
 	id         restic.ID // set to the ID of the index when it's finalized
 	supersedes restic.IDs
 	created    time.Time
 }
 
+// indexEntry describes the location of a blob, pack is the position of the
+// pack ID in Index.packs.
 type indexEntry struct {
-	packID restic.ID
-	offset uint
-	length uint
+	id     restic.ID
+	tpe    restic.BlobType
+	pack   uint32
+	offset uint32
+	length uint32
 }
 
+func (e *indexEntry) handle() restic.BlobHandle {
+	return restic.BlobHandle{ID: e.id, Type: e.tpe}
+}
+
+// less returns true if the entry is ordered before the blob handle h.
+func (e *indexEntry) less(h restic.BlobHandle) bool {
+	if c := bytes.Compare(e.id[:], h.ID[:]); c != 0 {
+		return c < 0
+	}
+	return e.tpe < h.Type
+}
+
+// minPendingEntries is the number of entries which may be added to an index
+// before they are merged into the sorted entries. Up to an eighth of the
+// sorted entries may be pending, so that the merges don't dominate the time
+// needed to add many blobs.
+const minPendingEntries = 1024
+
 // NewIndex returns a new index.
 func NewIndex() *Index {
 	return &Index{
-		pack:    make(map[restic.BlobHandle][]indexEntry),
-		created: time.Now(),
+		pending:   make(map[restic.BlobHandle][]int),
+		packIndex: make(map[restic.ID]uint32),
+		created:   time.Now(),
+	}
+}
+
+// errEntryTooLarge is returned when the offset or length of a blob does not
+// fit into an index entry.
+var errEntryTooLarge = errors.New("blob offset or length too large")
+
+// addPack returns the position of the pack ID in idx.packs, it is added if
+// necessary.
+func (idx *Index) addPack(id restic.ID) uint32 {
+	pack, ok := idx.packIndex[id]
+	if !ok {
+		pack = uint32(len(idx.packs))
+		idx.packs = append(idx.packs, id)
+		idx.packIndex[id] = pack
+	}
+	return pack
+}
+
+// add appends an entry for blob without making it available for lookups.
+func (idx *Index) add(blob restic.PackedBlob) error {
+	if uint64(blob.Offset) > math.MaxUint32 || uint64(blob.Length) > math.MaxUint32 {
+		return errEntryTooLarge
+	}
+
+	idx.blobs = append(idx.blobs, indexEntry{
+		id:     blob.ID,
+		tpe:    blob.Type,
+		pack:   idx.addPack(blob.PackID),
+		offset: uint32(blob.Offset),
+		length: uint32(blob.Length),
+	})
+
+	return nil
+}
+
+func (idx *Index) store(blob restic.PackedBlob) error {
+	if err := idx.add(blob); err != nil {
+		return err
+	}
+
+	pos := len(idx.blobs) - 1
+	h := idx.blobs[pos].handle()
+	idx.pending[h] = append(idx.pending[h], pos)
+
+	if unsorted := len(idx.blobs) - idx.sorted; unsorted > minPendingEntries && unsorted > idx.sorted/8 {
+		idx.merge()
 	}
+
+	return nil
 }
 
-func (idx *Index) store(blob restic.PackedBlob) {
-	newEntry := indexEntry{
-		packID: blob.PackID,
-		offset: blob.Offset,
-		length: blob.Length,
+// sortAll sorts all entries, this is used after the entries of a decoded
+// index have been added.
+func (idx *Index) sortAll() {
+	sort.SliceStable(idx.blobs, func(i, j int) bool {
+		return idx.blobs[i].less(idx.blobs[j].handle())
+	})
+	idx.sorted = len(idx.blobs)
+	idx.pending = make(map[restic.BlobHandle][]int)
+}
+
+// merge merges the pending entries into the sorted entries. Entries for the
+// same blob keep the order in which they were added.
+func (idx *Index) merge() {
+	if idx.sorted == len(idx.blobs) {
+		return
+	}
+
+	tail := idx.blobs[idx.sorted:]
+	sort.SliceStable(tail, func(i, j int) bool {
+		return tail[i].less(tail[j].handle())
+	})
+
+	merged := make([]indexEntry, 0, len(idx.blobs))
+	head := idx.blobs[:idx.sorted]
+	for len(head) > 0 && len(tail) > 0 {
+		if tail[0].less(head[0].handle()) {
+			merged = append(merged, tail[0])
+			tail = tail[1:]
+		} else {
+			merged = append(merged, head[0])
+			head = head[1:]
+		}
+	}
+	merged = append(merged, head...)
+	merged = append(merged, tail...)
+
+	idx.blobs = merged
+	idx.sorted = len(merged)
+	idx.pending = make(map[restic.BlobHandle][]int)
+}
+
+// search returns the position of the first sorted entry for the blob h, or
+// the position where it would be inserted.
+func (idx *Index) search(h restic.BlobHandle) int {
+	return sort.Search(idx.sorted, func(i int) bool {
+		return !idx.blobs[i].less(h)
+	})
+}
+
+// find returns the entries for the blob h, in the order they were added.
+func (idx *Index) find(h restic.BlobHandle) (list []indexEntry) {
+	i := idx.search(h)
+	for ; i < idx.sorted && idx.blobs[i].handle() == h; i++ {
+		list = append(list, idx.blobs[i])
+	}
+
+	for _, pos := range idx.pending[h] {
+		list = append(list, idx.blobs[pos])
+	}
+
+	return list
+}
+
+// distinctBlobs returns the number of different blobs in the index, a blob
+// stored in several packs is only counted once.
+func (idx *Index) distinctBlobs() (n int) {
+	for i := 0; i < idx.sorted; i++ {
+		if i == 0 || idx.blobs[i].handle() != idx.blobs[i-1].handle() {
+			n++
+		}
+	}
+
+	for h := range idx.pending {
+		i := idx.search(h)
+		if i == idx.sorted || idx.blobs[i].handle() != h {
+			n++
+		}
+	}
+
+	return n
+}
+
+// packedBlob returns the restic.PackedBlob for the entry e.
+func (idx *Index) packedBlob(e indexEntry) restic.PackedBlob {
+	return restic.PackedBlob{
+		Blob: restic.Blob{
+			ID:     e.id,
+			Type:   e.tpe,
+			Offset: uint(e.offset),
+			Length: uint(e.length),
+		},
+		PackID: idx.packs[e.pack],
 	}
-	h := restic.BlobHandle{ID: blob.ID, Type: blob.Type}
-	idx.pack[h] = append(idx.pack[h], newEntry)
 }
 
 // Final returns true iff the index is already written to the repository, it is
@@ -65,14 +237,16 @@ const (
 	indexMaxAge   = 15 * time.Minute
 )
 
-// IndexFull returns true iff the index is "full enough" to be saved as a preliminary index.
+// IndexFull returns true iff the index is "full enough" to be saved as a
+// preliminary index. Blobs which are stored in several packs are counted
+// once.
 var IndexFull = func(idx *Index) bool {
 	idx.m.Lock()
 	defer idx.m.Unlock()
 
 	debug.Log("checking whether index %p is full", idx)
 
-	packs := len(idx.pack)
+	packs := idx.distinctBlobs()
 	age := time.Now().Sub(idx.created)
 
 	if age > indexMaxAge {
@@ -95,8 +269,9 @@ var IndexFull = func(idx *Index) bool {
 }
 
 // Store remembers the id and pack in the index. An existing entry will be
-// silently overwritten.
-func (idx *Index) Store(blob restic.PackedBlob) {
+// silently overwritten. An error is returned if the offset or the length of
+// the blob are too large for the index.
+func (idx *Index) Store(blob restic.PackedBlob) error {
 	idx.m.Lock()
 	defer idx.m.Unlock()
 
@@ -106,7 +281,11 @@ func (idx *Index) Store(blob restic.PackedBlob) {
 
 	debug.Log("%v", blob)
 
-	idx.store(blob)
+	if err := idx.store(blob); err != nil {
+		return errors.Wrapf(err, "blob %v in pack %v", blob.ID.Str(), blob.PackID.Str())
+	}
+
+	return nil
 }
 
 // Lookup queries the index for the blob ID and returns a restic.PackedBlob.
@@ -116,27 +295,17 @@ func (idx *Index) Lookup(id restic.ID, tpe restic.BlobType) (blobs []restic.Pack
 
 	h := restic.BlobHandle{ID: id, Type: tpe}
 
-	if packs, ok := idx.pack[h]; ok {
-		blobs = make([]restic.PackedBlob, 0, len(packs))
-
-		for _, p := range packs {
-			blob := restic.PackedBlob{
-				Blob: restic.Blob{
-					Type:   tpe,
-					Length: p.length,
-					ID:     id,
-					Offset: p.offset,
-				},
-				PackID: p.packID,
-			}
-
-			blobs = append(blobs, blob)
-		}
+	list := idx.find(h)
+	if len(list) == 0 {
+		return nil, false
+	}
 
-		return blobs, true
+	blobs = make([]restic.PackedBlob, 0, len(list))
+	for _, e := range list {
+		blobs = append(blobs, idx.packedBlob(e))
 	}
 
-	return nil, false
+	return blobs, true
 }
 
 // ListPack returns a list of blobs contained in a pack.
@@ -144,19 +313,14 @@ func (idx *Index) ListPack(id restic.ID) (list []restic.PackedBlob) {
 	idx.m.Lock()
 	defer idx.m.Unlock()
 
-	for h, packList := range idx.pack {
-		for _, entry := range packList {
-			if entry.packID == id {
-				list = append(list, restic.PackedBlob{
-					Blob: restic.Blob{
-						ID:     h.ID,
-						Type:   h.Type,
-						Length: entry.length,
-						Offset: entry.offset,
-					},
-					PackID: entry.packID,
-				})
-			}
+	pack, ok := idx.packIndex[id]
+	if !ok {
+		return nil
+	}
+
+	for _, e := range idx.blobs {
+		if e.pack == pack {
+			list = append(list, idx.packedBlob(e))
 		}
 	}
 
@@ -170,8 +334,7 @@ func (idx *Index) Has(id restic.ID, tpe restic.BlobType) bool {
 
 	h := restic.BlobHandle{ID: id, Type: tpe}
 
-	_, ok := idx.pack[h]
-	return ok
+	return len(idx.find(h)) > 0
 }
 
 // LookupSize returns the length of the plaintext content of the blob with the
@@ -218,21 +381,11 @@ func (idx *Index) Each(ctx context.Context) <-chan restic.PackedBlob {
 			close(ch)
 		}()
 
-		for h, packs := range idx.pack {
-			for _, blob := range packs {
-				select {
-				case <-ctx.Done():
-					return
-				case ch <- restic.PackedBlob{
-					Blob: restic.Blob{
-						ID:     h.ID,
-						Type:   h.Type,
-						Offset: blob.offset,
-						Length: blob.length,
-					},
-					PackID: blob.packID,
-				}:
-				}
+		for _, e := range idx.blobs {
+			select {
+			case <-ctx.Done():
+				return
+			case ch <- idx.packedBlob(e):
 			}
 		}
 	}()
@@ -245,14 +398,7 @@ func (idx *Index) Packs() restic.IDSet {
 	idx.m.Lock()
 	defer idx.m.Unlock()
 
-	packs := restic.NewIDSet()
-	for _, list := range idx.pack {
-		for _, entry := range list {
-			packs.Insert(entry.packID)
-		}
-	}
-
-	return packs
+	return restic.NewIDSet(idx.packs...)
 }
 
 // Count returns the number of blobs of type t in the index.
@@ -261,12 +407,10 @@ func (idx *Index) Count(t restic.BlobType) (n uint) {
 	idx.m.Lock()
 	defer idx.m.Unlock()
 
-	for h, list := range idx.pack {
-		if h.Type != t {
-			continue
+	for _, e := range idx.blobs {
+		if e.tpe == t {
+			n++
 		}
-
-		n += uint(len(list))
 	}
 
 	return
@@ -287,41 +431,41 @@ type blobJSON struct {
 // generatePackList returns a list of packs.
 func (idx *Index) generatePackList() ([]*packJSON, error) {
 	list := []*packJSON{}
-	packs := make(map[restic.ID]*packJSON)
-
-	for h, packedBlobs := range idx.pack {
-		for _, blob := range packedBlobs {
-			if blob.packID.IsNull() {
-				panic("null pack id")
-			}
+	packs := make([]*packJSON, len(idx.packs))
 
-			debug.Log("handle blob %v", h)
+	for _, e := range idx.blobs {
+		h := e.handle()
+		packID := idx.packs[e.pack]
+		if packID.IsNull() {
+			panic("null pack id")
+		}
 
-			if blob.packID.IsNull() {
-				debug.Log("blob %v has no packID! (offset %v, length %v)",
-					h, blob.offset, blob.length)
-				return nil, errors.Errorf("unable to serialize index: pack for blob %v hasn't been written yet", h)
-			}
+		debug.Log("handle blob %v", h)
 
-			// see if pack is already in map
-			p, ok := packs[blob.packID]
-			if !ok {
-				// else create new pack
-				p = &packJSON{ID: blob.packID}
+		if packID.IsNull() {
+			debug.Log("blob %v has no packID! (offset %v, length %v)",
+				h, e.offset, e.length)
+			return nil, errors.Errorf("unable to serialize index: pack for blob %v hasn't been written yet", h)
+		}
 
-				// and append it to the list and map
-				list = append(list, p)
-				packs[p.ID] = p
-			}
+		// see if pack is already in the list
+		p := packs[e.pack]
+		if p == nil {
+			// else create new pack
+			p = &packJSON{ID: packID}
 
-			// add blob
-			p.Blobs = append(p.Blobs, blobJSON{
-				ID:     h.ID,
-				Type:   h.Type,
-				Offset: blob.offset,
-				Length: blob.length,
-			})
+			// and append it to the list
+			list = append(list, p)
+			packs[e.pack] = p
 		}
+
+		// add blob
+		p.Blobs = append(p.Blobs, blobJSON{
+			ID:     h.ID,
+			Type:   h.Type,
+			Offset: uint(e.offset),
+			Length: uint(e.length),
+		})
 	}
 
 	debug.Log("done")
@@ -367,6 +511,7 @@ func (idx *Index) Finalize(w io.Writer) error {
 	defer idx.m.Unlock()
 
 	idx.final = true
+	idx.merge()
 
 	return idx.encode(w)
 }
@@ -453,29 +598,41 @@ func isErrOldIndex(err error) bool {
 // ErrOldIndexFormat means an index with the old format was detected.
 var ErrOldIndexFormat = errors.New("index has old format")
 
-// DecodeIndex loads and unserializes an index from rd.
-func DecodeIndex(buf []byte) (idx *Index, err error) {
-	debug.Log("Start decoding index")
-	idxJSON := &jsonIndex{}
-
-	err = json.Unmarshal(buf, idxJSON)
-	if err != nil {
-		debug.Log("Error %v", err)
-
-		if isErrOldIndex(err) {
-			debug.Log("index is probably old format, trying that")
-			err = ErrOldIndexFormat
+// newIndexFor returns a final index which contains the blobs in list. If
+// treesOnly is set, only the tree blobs are added, but all packs are known to
+// the index.
+func newIndexFor(list []*packJSON, treesOnly bool) (*Index, error) {
+	n := 0
+	for _, pack := range list {
+		for _, blob := range pack.Blobs {
+			if !treesOnly || blob.Type == restic.TreeBlob {
+				n++
+			}
 		}
-
-		return nil, errors.Wrap(err, "Decode")
 	}
 
-	idx = NewIndex()
-	for _, pack := range idxJSON.Packs {
+	idx := NewIndex()
+	idx.blobs = make([]indexEntry, 0, n)
+	idx.packs = make(restic.IDs, 0, len(list))
+	idx.treesOnly = treesOnly
+
+	for _, pack := range list {
 		var data, tree bool
 
+		idx.addPack(pack.ID)
 		for _, blob := range pack.Blobs {
-			idx.store(restic.PackedBlob{
+			switch blob.Type {
+			case restic.DataBlob:
+				data = true
+			case restic.TreeBlob:
+				tree = true
+			}
+
+			if treesOnly && blob.Type != restic.TreeBlob {
+				continue
+			}
+
+			err := idx.add(restic.PackedBlob{
 				Blob: restic.Blob{
 					Type:   blob.Type,
 					ID:     blob.ID,
@@ -484,12 +641,8 @@ func DecodeIndex(buf []byte) (idx *Index, err error) {
 				},
 				PackID: pack.ID,
 			})
-
-			switch blob.Type {
-			case restic.DataBlob:
-				data = true
-			case restic.TreeBlob:
-				tree = true
+			if err != nil {
+				return nil, errors.Wrapf(err, "blob %v in pack %v", blob.ID.Str(), pack.ID.Str())
 			}
 		}
 
@@ -497,9 +650,45 @@ func DecodeIndex(buf []byte) (idx *Index, err error) {
 			idx.treePacks = append(idx.treePacks, pack.ID)
 		}
 	}
-	idx.supersedes = idxJSON.Supersedes
+	idx.sortAll()
 	idx.final = true
 
+	return idx, nil
+}
+
+// DecodeIndex loads and unserializes an index from rd.
+func DecodeIndex(buf []byte) (idx *Index, err error) {
+	return decodeIndex(buf, false)
+}
+
+// DecodeTreeIndex loads and unserializes an index from rd like DecodeIndex,
+// but only keeps the entries for tree blobs. Packs() still returns all packs.
+func DecodeTreeIndex(buf []byte) (idx *Index, err error) {
+	return decodeIndex(buf, true)
+}
+
+func decodeIndex(buf []byte, treesOnly bool) (idx *Index, err error) {
+	debug.Log("Start decoding index")
+	idxJSON := &jsonIndex{}
+
+	err = json.Unmarshal(buf, idxJSON)
+	if err != nil {
+		debug.Log("Error %v", err)
+
+		if isErrOldIndex(err) {
+			debug.Log("index is probably old format, trying that")
+			err = ErrOldIndexFormat
+		}
+
+		return nil, errors.Wrap(err, "Decode")
+	}
+
+	idx, err = newIndexFor(idxJSON.Packs, treesOnly)
+	if err != nil {
+		return nil, err
+	}
+	idx.supersedes = idxJSON.Supersedes
+
 	debug.Log("done")
 	return idx, nil
 }
@@ -515,34 +704,10 @@ func DecodeOldIndex(buf []byte) (idx *Index, err error) {
 		return nil, errors.Wrap(err, "Decode")
 	}
 
-	idx = NewIndex()
-	for _, pack := range list {
-		var data, tree bool
-
-		for _, blob := range pack.Blobs {
-			idx.store(restic.PackedBlob{
-				Blob: restic.Blob{
-					Type:   blob.Type,
-					ID:     blob.ID,
-					Offset: blob.Offset,
-					Length: blob.Length,
-				},
-				PackID: pack.ID,
-			})
-
-			switch blob.Type {
-			case restic.DataBlob:
-				data = true
-			case restic.TreeBlob:
-				tree = true
-			}
-		}
-
-		if !data && tree {
-			idx.treePacks = append(idx.treePacks, pack.ID)
-		}
+	idx, err = newIndexFor(list, false)
+	if err != nil {
+		return nil, err
 	}
-	idx.final = true
 
 	debug.Log("done")
 	return idx, nil
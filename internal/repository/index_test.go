@@ -2,6 +2,8 @@ package repository_test
 
 import (
 	"bytes"
+	"context"
+	"math"
 	"math/rand"
 	"testing"
 
@@ -490,3 +492,161 @@ func TestIndexHas(t *testing.T) {
 	rtest.Assert(t, !idx.Has(restic.NewRandomID(), restic.DataBlob), "Index reports having a data blob not added to it")
 	rtest.Assert(t, !idx.Has(tests[0].id, restic.TreeBlob), "Index reports having a tree blob added to it with the same id as a data blob")
 }
+
+func TestIndexDuplicateBlobs(t *testing.T) {
+	idx := repository.NewIndex()
+
+	id := restic.NewRandomID()
+	packs := restic.IDs{restic.NewRandomID(), restic.NewRandomID(), restic.NewRandomID()}
+	for i, packID := range packs {
+		idx.Store(restic.PackedBlob{
+			Blob: restic.Blob{
+				Type:   restic.DataBlob,
+				ID:     id,
+				Offset: uint(i * 100),
+				Length: 100,
+			},
+			PackID: packID,
+		})
+	}
+
+	blobs, found := idx.Lookup(id, restic.DataBlob)
+	rtest.Assert(t, found, "blob not found in index")
+	rtest.Equals(t, len(packs), len(blobs))
+	for i, blob := range blobs {
+		rtest.Equals(t, packs[i], blob.PackID)
+		rtest.Equals(t, uint(i*100), blob.Offset)
+	}
+
+	rtest.Equals(t, uint(len(packs)), idx.Count(restic.DataBlob))
+	rtest.Equals(t, restic.NewIDSet(packs...), idx.Packs())
+
+	for _, packID := range packs {
+		list := idx.ListPack(packID)
+		rtest.Equals(t, 1, len(list))
+		rtest.Equals(t, id, list[0].ID)
+	}
+
+	wr := bytes.NewBuffer(nil)
+	rtest.OK(t, idx.Finalize(wr))
+
+	idx2, err := repository.DecodeIndex(wr.Bytes())
+	rtest.OK(t, err)
+
+	n := 0
+	for blob := range idx2.Each(context.TODO()) {
+		rtest.Equals(t, id, blob.ID)
+		n++
+	}
+	rtest.Equals(t, len(packs), n)
+}
+
+func TestIndexStoreMany(t *testing.T) {
+	idx := repository.NewIndex()
+
+	// store enough blobs so that the pending entries are merged several
+	// times, every tenth blob is stored again in a later pack
+	var ids restic.IDs
+	packs := make(map[restic.ID]restic.IDs)
+	for i := 0; i < 5000; i++ {
+		packID := restic.NewRandomID()
+		id := restic.NewRandomID()
+		if i%10 == 9 {
+			id = ids[i/2]
+		} else {
+			ids = append(ids, id)
+		}
+
+		idx.Store(restic.PackedBlob{
+			Blob: restic.Blob{
+				Type:   restic.DataBlob,
+				ID:     id,
+				Offset: uint(i),
+				Length: 100,
+			},
+			PackID: packID,
+		})
+		packs[id] = append(packs[id], packID)
+	}
+
+	for _, id := range ids {
+		blobs, found := idx.Lookup(id, restic.DataBlob)
+		rtest.Assert(t, found, "blob %v not found in index", id.Str())
+		rtest.Equals(t, len(packs[id]), len(blobs))
+		for i, blob := range blobs {
+			rtest.Equals(t, packs[id][i], blob.PackID)
+		}
+
+		rtest.Assert(t, !idx.Has(id, restic.TreeBlob), "tree blob %v found in index", id.Str())
+	}
+
+	rtest.Equals(t, uint(5000), idx.Count(restic.DataBlob))
+}
+
+func TestIndexEntryTooLarge(t *testing.T) {
+	buf := []byte(`{"packs": [{"id": "73d04e6125cf3c28a299cc2f3cca3b78ceac396e4fcf9575e34536b26782413c", "blobs": [{"id": "3ec79977ef0cf5de7b08cd12b874cd0f62bbaf7f07f3497a5b1bbcc8cb39b1ce", "type": "data", "offset": 4294967296, "length": 25}]}]}`)
+	_, err := repository.DecodeIndex(buf)
+	rtest.Assert(t, err != nil, "index with a too large offset was decoded without error")
+}
+
+func TestIndexStoreTooLarge(t *testing.T) {
+	if uint64(^uint(0)) <= math.MaxUint32 {
+		t.Skip("offset cannot overflow on this platform")
+	}
+
+	var offset uint64 = math.MaxUint32 + 1
+	idx := repository.NewIndex()
+	err := idx.Store(restic.PackedBlob{
+		Blob: restic.Blob{
+			Type:   restic.DataBlob,
+			ID:     restic.NewRandomID(),
+			Offset: uint(offset),
+			Length: 100,
+		},
+		PackID: restic.NewRandomID(),
+	})
+	rtest.Assert(t, err != nil, "storing a too large offset did not return an error")
+	rtest.Equals(t, uint(0), idx.Count(restic.DataBlob))
+}
+
+func TestDecodeTreeIndex(t *testing.T) {
+	full, err := repository.DecodeIndex(docExample)
+	rtest.OK(t, err)
+
+	idx, err := repository.DecodeTreeIndex(docExample)
+	rtest.OK(t, err)
+
+	for _, test := range exampleTests {
+		_, found := idx.Lookup(test.id, test.tpe)
+		rtest.Equals(t, test.tpe == restic.TreeBlob, found)
+	}
+
+	rtest.Equals(t, uint(0), idx.Count(restic.DataBlob))
+	rtest.Equals(t, full.Count(restic.TreeBlob), idx.Count(restic.TreeBlob))
+	rtest.Equals(t, full.Packs(), idx.Packs())
+	rtest.Equals(t, full.TreePacks(), idx.TreePacks())
+}
+
+func BenchmarkIndexMemory(b *testing.B) {
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		rng := rand.New(rand.NewSource(0))
+		idx := repository.NewIndex()
+
+		for j := 0; j < 10000; j++ {
+			packID := NewRandomTestID(rng)
+			for k := 0; k < 50; k++ {
+				idx.Store(restic.PackedBlob{
+					PackID: packID,
+					Blob: restic.Blob{
+						Type:   restic.DataBlob,
+						ID:     NewRandomTestID(rng),
+						Length: 1000,
+						Offset: uint(k * 1000),
+					},
+				})
+			}
+		}
+	}
+}
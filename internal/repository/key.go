@@ -1,7 +1,6 @@
 package repository
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -10,6 +9,7 @@ import (
 	"time"
 
 	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/options"
 	"github.com/restic/restic/internal/restic"
 
 	"github.com/restic/restic/internal/backend"
@@ -56,6 +56,67 @@ var (
 	KDFMemory = 60
 )
 
+// KDFOptions are the extended options which tune the KDF for new keys.
+type KDFOptions struct {
+	Timeout time.Duration `option:"timeout" help:"calibrate the KDF to take about this long on this machine (default: 500ms)"`
+	Memory  int           `option:"memory" help:"limit the memory used by the calibrated KDF to this many MiB (default: 60)"`
+	N       int           `option:"n" help:"use this scrypt parameter N instead of calibrating the KDF"`
+	R       int           `option:"r" help:"use this scrypt parameter r instead of calibrating the KDF"`
+	P       int           `option:"p" help:"use this scrypt parameter p instead of calibrating the KDF"`
+}
+
+func init() {
+	options.Register("kdf", KDFOptions{})
+}
+
+// ApplyKDFOptions sets the KDF parameters for new keys from the extended
+// options in the namespace "kdf". If any of the scrypt parameters are given,
+// the KDF is not calibrated and the default values are used for the others.
+func ApplyKDFOptions(o options.Options) error {
+	var opts KDFOptions
+	if err := o.Extract("kdf").Apply("kdf", &opts); err != nil {
+		return err
+	}
+
+	if opts.Timeout < 0 {
+		return errors.Fatalf("invalid KDF timeout %v", opts.Timeout)
+	}
+
+	if opts.Memory < 0 {
+		return errors.Fatalf("invalid KDF memory limit %v", opts.Memory)
+	}
+
+	if opts.Timeout > 0 {
+		KDFTimeout = opts.Timeout
+	}
+
+	if opts.Memory > 0 {
+		KDFMemory = opts.Memory
+	}
+
+	if opts.N == 0 && opts.R == 0 && opts.P == 0 {
+		return nil
+	}
+
+	p := crypto.DefaultKDFParams
+	if opts.N != 0 {
+		p.N = opts.N
+	}
+	if opts.R != 0 {
+		p.R = opts.R
+	}
+	if opts.P != 0 {
+		p.P = opts.P
+	}
+
+	if err := p.Check(); err != nil {
+		return errors.Fatalf("invalid KDF parameters N=%d, r=%d, p=%d", p.N, p.R, p.P)
+	}
+
+	Params = &p
+	return nil
+}
+
 // createMasterKey creates a new master key in the given backend and encrypts
 // it with the password.
 func createMasterKey(s *Repository, password string) (*Key, error) {
@@ -250,7 +311,7 @@ func AddKey(ctx context.Context, s *Repository, password string, template *crypt
 		Name: restic.Hash(buf).String(),
 	}
 
-	err = s.be.Save(ctx, h, bytes.NewReader(buf))
+	err = s.be.Save(ctx, h, restic.NewByteReader(buf))
 	if err != nil {
 		return nil, err
 	}
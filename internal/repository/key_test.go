@@ -0,0 +1,43 @@
+package repository_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/crypto"
+	"github.com/restic/restic/internal/options"
+	"github.com/restic/restic/internal/repository"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestApplyKDFOptions(t *testing.T) {
+	oldParams, oldTimeout, oldMemory := repository.Params, repository.KDFTimeout, repository.KDFMemory
+	defer func() {
+		repository.Params, repository.KDFTimeout, repository.KDFMemory = oldParams, oldTimeout, oldMemory
+	}()
+
+	opts, err := options.Parse([]string{"kdf.timeout=2s", "kdf.memory=120", "s3.region=foo"})
+	rtest.OK(t, err)
+
+	repository.Params = nil
+	rtest.OK(t, repository.ApplyKDFOptions(opts))
+	rtest.Equals(t, 2*time.Second, repository.KDFTimeout)
+	rtest.Equals(t, 120, repository.KDFMemory)
+	rtest.Assert(t, repository.Params == nil, "KDF parameters were set without being passed")
+
+	opts, err = options.Parse([]string{"kdf.n=1024"})
+	rtest.OK(t, err)
+
+	rtest.OK(t, repository.ApplyKDFOptions(opts))
+	rtest.Assert(t, repository.Params != nil, "KDF parameters were not set")
+	rtest.Equals(t, crypto.Params{N: 1024, R: crypto.DefaultKDFParams.R, P: crypto.DefaultKDFParams.P}, *repository.Params)
+
+	for _, invalid := range []string{"kdf.n=1001", "kdf.r=-1", "kdf.timeout=-1s", "kdf.foo=bar"} {
+		opts, err = options.Parse([]string{invalid})
+		rtest.OK(t, err)
+
+		if err := repository.ApplyKDFOptions(opts); err == nil {
+			t.Errorf("option %v: expected error not found", invalid)
+		}
+	}
+}
@@ -2,7 +2,10 @@ package repository
 
 import (
 	"context"
+	"fmt"
+	"os"
 	"sync"
+	"sync/atomic"
 
 	"github.com/restic/restic/internal/restic"
 
@@ -13,6 +16,14 @@ import (
 type MasterIndex struct {
 	idx      []*Index
 	idxMutex sync.RWMutex
+
+	// loadIndex loads an index which was decoded with DecodeTreeIndex
+	// completely, it is called when data blobs are needed for the first time.
+	// dataLoaded is set atomically once this has been done, so that lookups
+	// afterwards do not need to take loadMutex.
+	loadIndex  func(restic.ID) (*Index, error)
+	loadMutex  sync.Mutex
+	dataLoaded int32
 }
 
 // NewMasterIndex creates a new master index.
@@ -20,8 +31,106 @@ func NewMasterIndex() *MasterIndex {
 	return &MasterIndex{}
 }
 
+// loadOnDemand sets the function used to load the data blobs of the indexes
+// which only contain tree blobs.
+func (mi *MasterIndex) loadOnDemand(fn func(restic.ID) (*Index, error)) {
+	mi.loadMutex.Lock()
+	defer mi.loadMutex.Unlock()
+
+	mi.loadIndex = fn
+	atomic.StoreInt32(&mi.dataLoaded, 0)
+}
+
+// loadDataBlobs replaces all indexes which only contain tree blobs with the
+// complete index, this is done at most once. The indexes are loaded in
+// parallel. Indexes which cannot be loaded are kept, the data blobs they
+// contain are not found. The first error is printed, which is the only way
+// to report it as the lookup methods cannot return errors.
+func (mi *MasterIndex) loadDataBlobs() {
+	if atomic.LoadInt32(&mi.dataLoaded) == 1 {
+		return
+	}
+
+	mi.loadMutex.Lock()
+	defer mi.loadMutex.Unlock()
+
+	if mi.loadIndex == nil {
+		atomic.StoreInt32(&mi.dataLoaded, 1)
+		return
+	}
+
+	var list []*Index
+	mi.idxMutex.RLock()
+	for _, idx := range mi.idx {
+		if idx.treesOnly {
+			list = append(list, idx)
+		}
+	}
+	mi.idxMutex.RUnlock()
+
+	debug.Log("loading data blobs for %d indexes", len(list))
+
+	ch := make(chan *Index)
+	go func() {
+		defer close(ch)
+		for _, idx := range list {
+			ch <- idx
+		}
+	}()
+
+	var (
+		wg       sync.WaitGroup
+		errMutex sync.Mutex
+		firstErr error
+		failed   int
+	)
+
+	for i := 0; i < loadIndexParallelism; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for idx := range ch {
+				full, err := mi.loadIndex(idx.id)
+				if err != nil {
+					debug.Log("loading index %v failed: %v", idx.id.Str(), err)
+					errMutex.Lock()
+					if firstErr == nil {
+						firstErr = err
+					}
+					failed++
+					errMutex.Unlock()
+					continue
+				}
+
+				mi.idxMutex.Lock()
+				for j := range mi.idx {
+					if mi.idx[j] == idx {
+						mi.idx[j] = full
+					}
+				}
+				mi.idxMutex.Unlock()
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if firstErr != nil {
+		fmt.Fprintf(os.Stderr, "unable to load the data blobs of %d of %d indexes, first error: %v, ignoring\n",
+			failed, len(list), firstErr)
+	}
+
+	mi.loadIndex = nil
+	atomic.StoreInt32(&mi.dataLoaded, 1)
+}
+
 // Lookup queries all known Indexes for the ID and returns the first match.
 func (mi *MasterIndex) Lookup(id restic.ID, tpe restic.BlobType) (blobs []restic.PackedBlob, found bool) {
+	if tpe != restic.TreeBlob {
+		mi.loadDataBlobs()
+	}
+
 	mi.idxMutex.RLock()
 	defer mi.idxMutex.RUnlock()
 
@@ -37,6 +146,10 @@ func (mi *MasterIndex) Lookup(id restic.ID, tpe restic.BlobType) (blobs []restic
 
 // LookupSize queries all known Indexes for the ID and returns the first match.
 func (mi *MasterIndex) LookupSize(id restic.ID, tpe restic.BlobType) (uint, bool) {
+	if tpe != restic.TreeBlob {
+		mi.loadDataBlobs()
+	}
+
 	mi.idxMutex.RLock()
 	defer mi.idxMutex.RUnlock()
 
@@ -52,6 +165,8 @@ func (mi *MasterIndex) LookupSize(id restic.ID, tpe restic.BlobType) (uint, bool
 // ListPack returns the list of blobs in a pack. The first matching index is
 // returned, or nil if no index contains information about the pack id.
 func (mi *MasterIndex) ListPack(id restic.ID) (list []restic.PackedBlob) {
+	mi.loadDataBlobs()
+
 	mi.idxMutex.RLock()
 	defer mi.idxMutex.RUnlock()
 
@@ -67,6 +182,10 @@ func (mi *MasterIndex) ListPack(id restic.ID) (list []restic.PackedBlob) {
 
 // Has queries all known Indexes for the ID and returns the first match.
 func (mi *MasterIndex) Has(id restic.ID, tpe restic.BlobType) bool {
+	if tpe != restic.TreeBlob {
+		mi.loadDataBlobs()
+	}
+
 	mi.idxMutex.RLock()
 	defer mi.idxMutex.RUnlock()
 
@@ -81,6 +200,10 @@ func (mi *MasterIndex) Has(id restic.ID, tpe restic.BlobType) bool {
 
 // Count returns the number of blobs of type t in the index.
 func (mi *MasterIndex) Count(t restic.BlobType) (n uint) {
+	if t != restic.TreeBlob {
+		mi.loadDataBlobs()
+	}
+
 	mi.idxMutex.RLock()
 	defer mi.idxMutex.RUnlock()
 
@@ -114,20 +237,22 @@ func (mi *MasterIndex) Remove(index *Index) {
 }
 
 // Store remembers the id and pack in the index.
-func (mi *MasterIndex) Store(pb restic.PackedBlob) {
+func (mi *MasterIndex) Store(pb restic.PackedBlob) error {
 	mi.idxMutex.Lock()
 	defer mi.idxMutex.Unlock()
 
 	for _, idx := range mi.idx {
 		if !idx.Final() {
-			idx.Store(pb)
-			return
+			return idx.Store(pb)
 		}
 	}
 
 	newIdx := NewIndex()
-	newIdx.Store(pb)
+	if err := newIdx.Store(pb); err != nil {
+		return err
+	}
 	mi.idx = append(mi.idx, newIdx)
+	return nil
 }
 
 // NotFinalIndexes returns all indexes that have not yet been saved.
@@ -175,6 +300,8 @@ func (mi *MasterIndex) FullIndexes() []*Index {
 
 // All returns all indexes.
 func (mi *MasterIndex) All() []*Index {
+	mi.loadDataBlobs()
+
 	mi.idxMutex.Lock()
 	defer mi.idxMutex.Unlock()
 
@@ -185,6 +312,8 @@ func (mi *MasterIndex) All() []*Index {
 // context is cancelled, the background goroutine terminates. This blocks any
 // modification of the index.
 func (mi *MasterIndex) Each(ctx context.Context) <-chan restic.PackedBlob {
+	mi.loadDataBlobs()
+
 	mi.idxMutex.RLock()
 
 	ch := make(chan restic.PackedBlob)
@@ -214,6 +343,8 @@ func (mi *MasterIndex) Each(ctx context.Context) <-chan restic.PackedBlob {
 // packs whose ID is contained in packBlacklist. The new index contains the IDs
 // of all known indexes in the "supersedes" field.
 func (mi *MasterIndex) RebuildIndex(packBlacklist restic.IDSet) (*Index, error) {
+	mi.loadDataBlobs()
+
 	mi.idxMutex.Lock()
 	defer mi.idxMutex.Unlock()
 
@@ -232,7 +363,9 @@ func (mi *MasterIndex) RebuildIndex(packBlacklist restic.IDSet) (*Index, error)
 				continue
 			}
 
-			newIndex.Store(pb)
+			if err := newIndex.Store(pb); err != nil {
+				return nil, err
+			}
 		}
 
 		if !idx.Final() {
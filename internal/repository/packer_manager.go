@@ -3,9 +3,9 @@ package repository
 import (
 	"context"
 	"crypto/sha256"
-	"io"
 	"os"
 	"sync"
+	"time"
 
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/hashing"
@@ -19,7 +19,7 @@ import (
 
 // Saver implements saving data in a backend.
 type Saver interface {
-	Save(context.Context, restic.Handle, io.Reader) error
+	Save(context.Context, restic.Handle, restic.RewindReader) error
 }
 
 // Packer holds a pack.Packer together with a hash writer.
@@ -35,9 +35,10 @@ type packerManager struct {
 	key     *crypto.Key
 	pm      sync.Mutex
 	packers []*Packer
-}
 
-const minPackSize = 4 * 1024 * 1024
+	// headerChecksum is set when the packs need a checksum of the header
+	headerChecksum bool
+}
 
 // newPackerManager returns an new packer manager which writes temporary files
 // to a temporary directory
@@ -70,6 +71,9 @@ func (r *packerManager) findPacker() (packer *Packer, err error) {
 
 	hw := hashing.NewWriter(tmpfile, sha256.New())
 	p := pack.NewPacker(r.key, hw)
+	if r.headerChecksum {
+		p.EnableHeaderChecksum()
+	}
 	packer = &Packer{
 		Packer:  p,
 		hw:      hw,
@@ -96,31 +100,39 @@ func (r *Repository) savePacker(ctx context.Context, t restic.BlobType, p *Packe
 		return err
 	}
 
-	_, err = p.tmpfile.Seek(0, 0)
-	if err != nil {
-		return errors.Wrap(err, "Seek")
-	}
-
 	id := restic.IDFromHash(p.hw.Sum(nil))
 	h := restic.Handle{Type: restic.DataFile, Name: id.String()}
 
-	err = r.be.Save(ctx, h, p.tmpfile)
+	// stream the pack from the temporary file instead of buffering it
+	rd, err := restic.NewFileReader(p.tmpfile)
+	if err != nil {
+		return err
+	}
+
+	// tell the backend which type of blobs the pack contains
+	start := time.Now()
+	err = r.be.Save(restic.WithPackType(ctx, t), h, rd)
 	if err != nil {
 		debug.Log("Save(%v) error: %v", h, err)
 		return err
 	}
+	r.Profile.Since(restic.PhaseUpload, start, uint64(rd.Length()))
 
 	debug.Log("saved as %v", h)
 
+	r.uploadedMu.Lock()
+	r.uploaded += uint64(rd.Length())
+	r.uploadedMu.Unlock()
+
 	if t == restic.TreeBlob && r.Cache != nil {
 		debug.Log("saving tree pack file in cache")
 
-		_, err = p.tmpfile.Seek(0, 0)
+		err = rd.Rewind()
 		if err != nil {
-			return errors.Wrap(err, "Seek")
+			return err
 		}
 
-		err := r.Cache.Save(h, p.tmpfile)
+		err := r.Cache.Save(h, rd)
 		if err != nil {
 			return err
 		}
@@ -139,7 +151,7 @@ func (r *Repository) savePacker(ctx context.Context, t restic.BlobType, p *Packe
 	// update blobs in the index
 	for _, b := range p.Packer.Blobs() {
 		debug.Log("  updating blob %v to pack %v", b.ID.Str(), id.Str())
-		r.idx.Store(restic.PackedBlob{
+		err = r.idx.Store(restic.PackedBlob{
 			Blob: restic.Blob{
 				Type:   b.Type,
 				ID:     b.ID,
@@ -148,6 +160,9 @@ func (r *Repository) savePacker(ctx context.Context, t restic.BlobType, p *Packe
 			},
 			PackID: id,
 		})
+		if err != nil {
+			return err
+		}
 	}
 
 	return nil
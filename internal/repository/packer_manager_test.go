@@ -54,7 +54,12 @@ func saveFile(t testing.TB, be Saver, f *os.File, id restic.ID) {
 	h := restic.Handle{Type: restic.DataFile, Name: id.String()}
 	t.Logf("save file %v", h)
 
-	if err := be.Save(context.TODO(), h, f); err != nil {
+	rd, err := restic.NewFileReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := be.Save(context.TODO(), h, rd); err != nil {
 		t.Fatal(err)
 	}
 
@@ -91,7 +96,7 @@ func fillPacks(t testing.TB, rnd *randReader, be Saver, pm *packerManager, buf [
 		}
 		bytes += l
 
-		if packer.Size() < minPackSize {
+		if packer.Size() < restic.DefaultMinPackSize {
 			pm.insertPacker(packer)
 			continue
 		}
@@ -147,7 +152,7 @@ func BenchmarkPackerManager(t *testing.B) {
 	rnd := newRandReader(rand.NewSource(23))
 
 	be := &mock.Backend{
-		SaveFn: func(context.Context, restic.Handle, io.Reader) error { return nil },
+		SaveFn: func(context.Context, restic.Handle, restic.RewindReader) error { return nil },
 	}
 	blobBuf := make([]byte, maxBlobSize)
 
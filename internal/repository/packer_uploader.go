@@ -0,0 +1,124 @@
+package repository
+
+import (
+	"context"
+	"sync"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/restic"
+)
+
+// DefaultUploadConcurrency is the number of packs uploaded concurrently when
+// the backend does not specify a number of connections.
+const DefaultUploadConcurrency = 2
+
+// packerUploader saves finished packs in the background. At most n packs are
+// uploaded at the same time, saving another pack blocks until one of the
+// uploads has finished. This keeps the number of temporary pack files (and
+// the memory used by the backends) bounded.
+type packerUploader struct {
+	sem chan struct{}
+
+	// running is the number of uploads which have not finished, it is
+	// protected by m. Uploads may be started while another goroutine waits.
+	m       sync.Mutex
+	done    *sync.Cond
+	running int
+	err     error
+}
+
+// newPackerUploader returns a packerUploader which runs at most n uploads
+// concurrently.
+func newPackerUploader(n int) *packerUploader {
+	if n <= 0 {
+		n = 1
+	}
+
+	u := &packerUploader{
+		sem: make(chan struct{}, n),
+	}
+	u.done = sync.NewCond(&u.m)
+	return u
+}
+
+// Err returns the first error of an upload.
+func (u *packerUploader) Err() error {
+	u.m.Lock()
+	defer u.m.Unlock()
+
+	return u.err
+}
+
+// finish records the end of an upload.
+func (u *packerUploader) finish(err error) {
+	u.m.Lock()
+	defer u.m.Unlock()
+
+	if err != nil && u.err == nil {
+		u.err = err
+	}
+
+	u.running--
+	u.done.Broadcast()
+}
+
+// Start runs fn in a new goroutine as soon as fewer than n uploads are
+// running. An error returned by a previous upload is returned instead.
+func (u *packerUploader) Start(ctx context.Context, fn func() error) error {
+	if err := u.Err(); err != nil {
+		return err
+	}
+
+	select {
+	case u.sem <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	u.m.Lock()
+	u.running++
+	u.m.Unlock()
+
+	go func() {
+		err := fn()
+		<-u.sem
+		u.finish(err)
+	}()
+
+	return nil
+}
+
+// Wait blocks until all uploads have finished and returns the first error.
+func (u *packerUploader) Wait() error {
+	u.m.Lock()
+	defer u.m.Unlock()
+
+	for u.running > 0 {
+		u.done.Wait()
+	}
+
+	return u.err
+}
+
+// SetUploadConcurrency sets the number of packs which are uploaded to the
+// backend concurrently. It must be called before blobs are saved.
+func (r *Repository) SetUploadConcurrency(n int) {
+	debug.Log("uploading %d packs concurrently", n)
+	r.uploader = newPackerUploader(n)
+}
+
+// startSavePacker stores p in the backend in the background. It blocks while
+// the maximum number of uploads is running.
+func (r *Repository) startSavePacker(ctx context.Context, t restic.BlobType, p *Packer) error {
+	err := r.uploader.Start(ctx, func() error {
+		return r.savePacker(ctx, t, p)
+	})
+	if err != nil {
+		// the pack is not saved, remove the temporary file
+		_ = p.tmpfile.Close()
+		_ = fs.RemoveIfExists(p.tmpfile.Name())
+	}
+
+	return err
+}
@@ -0,0 +1,149 @@
+package repository_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+// slowBackend counts the number of concurrent uploads of pack files. The
+// uploads block until release is closed.
+type slowBackend struct {
+	restic.Backend
+	release chan struct{}
+
+	m             sync.Mutex
+	running, max  int
+	packs         int
+	failDataFiles bool
+}
+
+func (be *slowBackend) Running() int {
+	be.m.Lock()
+	defer be.m.Unlock()
+	return be.running
+}
+
+func (be *slowBackend) Save(ctx context.Context, h restic.Handle, rd restic.RewindReader) error {
+	if h.Type != restic.DataFile {
+		return be.Backend.Save(ctx, h, rd)
+	}
+
+	be.m.Lock()
+	be.running++
+	if be.running > be.max {
+		be.max = be.running
+	}
+	fail := be.failDataFiles
+	be.m.Unlock()
+
+	if be.release != nil {
+		<-be.release
+	}
+
+	be.m.Lock()
+	be.running--
+	be.packs++
+	be.m.Unlock()
+
+	if fail {
+		return errors.New("upload failed")
+	}
+
+	return be.Backend.Save(ctx, h, rd)
+}
+
+func saveRandomBlobs(repo restic.Repository, num, size int) (ids restic.IDs, err error) {
+	for i := 0; i < num; i++ {
+		buf := rtest.Random(i, size)
+		id, err := repo.SaveBlob(context.TODO(), restic.DataBlob, buf, restic.ID{})
+		if err != nil {
+			return ids, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
+
+func TestConcurrentPackUploads(t *testing.T) {
+	be, _ := repository.TestBackend(t)
+	sbe := &slowBackend{Backend: be, release: make(chan struct{})}
+
+	repo, cleanup := repository.TestRepositoryWithBackend(t, sbe)
+	defer cleanup()
+
+	repo.(*repository.Repository).SetUploadConcurrency(3)
+
+	var (
+		ids restic.IDs
+		err error
+	)
+	done := make(chan struct{})
+	go func() {
+		ids, err = saveRandomBlobs(repo, 30, 1024*1024)
+		close(done)
+	}()
+
+	// wait until the maximum number of uploads is running
+	timeout := time.After(30 * time.Second)
+	for sbe.Running() < 3 {
+		select {
+		case <-timeout:
+			t.Fatalf("uploads did not start, %d running", sbe.Running())
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	// saving more blobs must block until an upload has finished
+	select {
+	case <-done:
+		t.Fatal("saving blobs did not block while uploads were running")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(sbe.release)
+	<-done
+	rtest.OK(t, err)
+	rtest.OK(t, repo.Flush(context.TODO()))
+
+	if sbe.max != 3 {
+		t.Errorf("wrong number of concurrent uploads: want 3, got %d", sbe.max)
+	}
+
+	if sbe.packs < 6 {
+		t.Errorf("too few packs saved: %d", sbe.packs)
+	}
+
+	// all blobs must be in the index after the flush
+	for _, id := range ids {
+		if !repo.Index().Has(id, restic.DataBlob) {
+			t.Errorf("blob %v not found in index", id.Str())
+		}
+	}
+}
+
+func TestConcurrentPackUploadsError(t *testing.T) {
+	be, _ := repository.TestBackend(t)
+	sbe := &slowBackend{Backend: be}
+
+	repo, cleanup := repository.TestRepositoryWithBackend(t, sbe)
+	defer cleanup()
+
+	sbe.failDataFiles = true
+
+	_, err := saveRandomBlobs(repo, 20, 1024*1024)
+	if err == nil {
+		err = repo.Flush(context.TODO())
+	}
+
+	if err == nil {
+		t.Fatal("upload error was not returned")
+	}
+}
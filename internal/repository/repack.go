@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"time"
 
 	"github.com/restic/restic/internal/debug"
 	"github.com/restic/restic/internal/fs"
@@ -21,9 +22,25 @@ import (
 // into a new pack. Returned is the list of obsolete packs which can then
 // be removed.
 func Repack(ctx context.Context, repo restic.Repository, packs restic.IDSet, keepBlobs restic.BlobSet, p *restic.Progress) (obsoletePacks restic.IDSet, err error) {
+	return RepackUntil(ctx, repo, packs.List(), keepBlobs, p, time.Time{})
+}
+
+// RepackUntil works like Repack, but processes the packs in the order given.
+// If deadline is not zero, no new pack is started once the deadline has
+// passed, but at least one pack is always processed so that successive runs
+// make progress. Returned is the list of packs which have been processed completely,
+// these are obsolete and can be removed. Blobs from packs which were not
+// processed remain in keepBlobs.
+func RepackUntil(ctx context.Context, repo restic.Repository, packs restic.IDs, keepBlobs restic.BlobSet, p *restic.Progress, deadline time.Time) (obsoletePacks restic.IDSet, err error) {
 	debug.Log("repacking %d packs while keeping %d blobs", len(packs), len(keepBlobs))
 
-	for packID := range packs {
+	obsoletePacks = restic.NewIDSet()
+	for _, packID := range packs {
+		if !deadline.IsZero() && len(obsoletePacks) > 0 && time.Now().After(deadline) {
+			debug.Log("deadline reached, %d of %d packs processed", len(obsoletePacks), len(packs))
+			break
+		}
+
 		// load the complete pack into a temp file
 		h := restic.Handle{Type: restic.DataFile, Name: packID.String()}
 
@@ -121,6 +138,7 @@ func Repack(ctx context.Context, repo restic.Repository, packs restic.IDSet, kee
 		if err = fs.RemoveIfExists(tempfile.Name()); err != nil {
 			return nil, errors.Wrap(err, "Remove")
 		}
+		obsoletePacks.Insert(packID)
 		if p != nil {
 			p.Report(restic.Stat{Blobs: 1})
 		}
@@ -130,5 +148,5 @@ func Repack(ctx context.Context, repo restic.Repository, packs restic.IDSet, kee
 		return nil, err
 	}
 
-	return packs, nil
+	return obsoletePacks, nil
 }
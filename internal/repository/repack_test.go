@@ -5,6 +5,7 @@ import (
 	"io"
 	"math/rand"
 	"testing"
+	"time"
 
 	"github.com/restic/restic/internal/index"
 	"github.com/restic/restic/internal/repository"
@@ -251,3 +252,36 @@ func TestRepack(t *testing.T) {
 		}
 	}
 }
+
+func TestRepackUntil(t *testing.T) {
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+
+	seed := rand.Int63()
+	rand.Seed(seed)
+	t.Logf("rand seed is %v", seed)
+
+	createRandomBlobs(t, repo, 100, 0.7)
+	saveIndex(t, repo)
+
+	removeBlobs, keepBlobs := selectBlobs(t, repo, 0.2)
+	removePacks := findPacksForBlobs(t, repo, removeBlobs)
+	if len(removePacks) < 2 {
+		t.Skipf("need at least two packs to repack, got %d", len(removePacks))
+	}
+
+	// a deadline in the past still processes exactly one pack
+	list := removePacks.List()
+	obsolete, err := repository.RepackUntil(context.TODO(), repo, list, keepBlobs, nil, time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(obsolete) != 1 {
+		t.Fatalf("expected one pack to be processed, got %d", len(obsolete))
+	}
+
+	if !obsolete.Has(list[0]) {
+		t.Fatalf("expected pack %v to be processed first, got %v", list[0].Str(), obsolete)
+	}
+}
@@ -6,6 +6,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"sync"
+	"time"
 
 	"github.com/restic/restic/internal/cache"
 	"github.com/restic/restic/internal/errors"
@@ -26,27 +28,67 @@ type Repository struct {
 	idx     *MasterIndex
 	restic.Cache
 
+	// packSize overrides the pack size from the config if it is not zero
+	packSize uint
+
 	treePM *packerManager
 	dataPM *packerManager
+
+	// uploader saves the finished packs in the background
+	uploader *packerUploader
+
+	// uploaded is the number of bytes of pack files saved in the backend
+	uploadedMu sync.Mutex
+	uploaded   uint64
+
+	// Profile records the time spent encrypting blobs and uploading pack
+	// and index files, if set.
+	Profile *restic.Profile
 }
 
 // New returns a new repository with backend be.
 func New(be restic.Backend) *Repository {
 	repo := &Repository{
-		be:     be,
-		idx:    NewMasterIndex(),
-		dataPM: newPackerManager(be, nil),
-		treePM: newPackerManager(be, nil),
+		be:       be,
+		idx:      NewMasterIndex(),
+		dataPM:   newPackerManager(be, nil),
+		treePM:   newPackerManager(be, nil),
+		uploader: newPackerUploader(DefaultUploadConcurrency),
 	}
 
 	return repo
 }
 
+// UploadedBytes returns the number of bytes of pack files which have been
+// saved in the backend since the repository was opened.
+func (r *Repository) UploadedBytes() uint64 {
+	r.uploadedMu.Lock()
+	defer r.uploadedMu.Unlock()
+
+	return r.uploaded
+}
+
 // Config returns the repository configuration.
 func (r *Repository) Config() restic.Config {
 	return r.cfg
 }
 
+// SetPackSize sets the size a pack file must reach before it is saved,
+// instead of the size from the config. It must be called before blobs are
+// saved.
+func (r *Repository) SetPackSize(size uint) {
+	debug.Log("using pack size %d", size)
+	r.packSize = size
+}
+
+// PackSize returns the size a pack file must reach before it is saved.
+func (r *Repository) PackSize() uint {
+	if r.packSize != 0 {
+		return r.packSize
+	}
+	return r.cfg.PackSize()
+}
+
 // UseCache replaces the backend with the wrapped cache.
 func (r *Repository) UseCache(c restic.Cache) {
 	if c == nil {
@@ -57,6 +99,13 @@ func (r *Repository) UseCache(c restic.Cache) {
 	r.be = c.Wrap(r.be)
 }
 
+// UseAppendOnly wraps the backend so that the data files, snapshots and keys
+// can neither be removed nor overwritten.
+func (r *Repository) UseAppendOnly() {
+	debug.Log("using append-only backend")
+	r.be = backend.NewAppendOnlyBackend(r.be)
+}
+
 // PrefixLength returns the number of bytes required so that all prefixes of
 // all IDs of type t are unique.
 func (r *Repository) PrefixLength(t restic.FileType) (int, error) {
@@ -217,7 +266,9 @@ func (r *Repository) SaveAndEncrypt(ctx context.Context, t restic.BlobType, data
 	ciphertext = append(ciphertext, nonce...)
 
 	// encrypt blob
+	start := time.Now()
 	ciphertext = r.key.Seal(ciphertext, nonce, data, nil)
+	r.Profile.Since(restic.PhaseEncrypt, start, uint64(len(data)))
 
 	// find suitable packer and add blob
 	var pm *packerManager
@@ -243,14 +294,14 @@ func (r *Repository) SaveAndEncrypt(ctx context.Context, t restic.BlobType, data
 	}
 
 	// if the pack is not full enough, put back to the list
-	if packer.Size() < minPackSize {
+	if packer.Size() < r.PackSize() {
 		debug.Log("pack is not full enough (%d bytes)", packer.Size())
 		pm.insertPacker(packer)
 		return *id, nil
 	}
 
 	// else write the pack to the backend
-	return *id, r.savePacker(ctx, t, packer)
+	return *id, r.startSavePacker(ctx, t, packer)
 }
 
 // SaveJSONUnpacked serialises item as JSON and encrypts and saves it in the
@@ -278,7 +329,7 @@ func (r *Repository) SaveUnpacked(ctx context.Context, t restic.FileType, p []by
 	id = restic.Hash(ciphertext)
 	h := restic.Handle{Type: t, Name: id.String()}
 
-	err = r.be.Save(ctx, h, bytes.NewReader(ciphertext))
+	err = r.be.Save(ctx, h, restic.NewByteReader(ciphertext))
 	if err != nil {
 		debug.Log("error saving blob %v: %v", h, err)
 		return restic.ID{}, err
@@ -288,7 +339,8 @@ func (r *Repository) SaveUnpacked(ctx context.Context, t restic.FileType, p []by
 	return id, nil
 }
 
-// Flush saves all remaining packs.
+// Flush saves all remaining packs and waits until all packs have been
+// uploaded.
 func (r *Repository) Flush(ctx context.Context) error {
 	pms := []struct {
 		t  restic.BlobType
@@ -300,20 +352,22 @@ func (r *Repository) Flush(ctx context.Context) error {
 
 	for _, p := range pms {
 		p.pm.pm.Lock()
+		packers := p.pm.packers
+		p.pm.packers = nil
+		p.pm.pm.Unlock()
 
-		debug.Log("manually flushing %d packs", len(p.pm.packers))
-		for _, packer := range p.pm.packers {
-			err := r.savePacker(ctx, p.t, packer)
+		debug.Log("manually flushing %d packs", len(packers))
+		for _, packer := range packers {
+			err := r.startSavePacker(ctx, p.t, packer)
 			if err != nil {
-				p.pm.pm.Unlock()
+				// wait for the running uploads before returning
+				_ = r.uploader.Wait()
 				return err
 			}
 		}
-		p.pm.packers = p.pm.packers[:0]
-		p.pm.pm.Unlock()
 	}
 
-	return nil
+	return r.uploader.Wait()
 }
 
 // Backend returns the backend for the repository.
@@ -348,10 +402,12 @@ func (r *Repository) saveIndex(ctx context.Context, indexes ...*Index) error {
 	for i, idx := range indexes {
 		debug.Log("Saving index %d", i)
 
+		start := time.Now()
 		sid, err := SaveIndex(ctx, r, idx)
 		if err != nil {
 			return err
 		}
+		r.Profile.Since(restic.PhaseIndex, start, 0)
 
 		debug.Log("Saved index %d as %v", i, sid.Str())
 	}
@@ -374,13 +430,40 @@ const loadIndexParallelism = 20
 // LoadIndex loads all index files from the backend in parallel and stores them
 // in the master index. The first error that occurred is returned.
 func (r *Repository) LoadIndex(ctx context.Context) error {
-	debug.Log("Loading index")
+	return r.loadIndex(ctx, false)
+}
+
+// LoadTreeIndex works like LoadIndex, but only keeps the tree blobs of the
+// index files in memory. The data blobs are loaded on demand when they are
+// needed for the first time, this saves memory for commands which mostly
+// read trees. As the index lookups do not take a context, ctx is used for
+// loading the data blobs and must not be cancelled before the repository is
+// no longer used, errors are printed.
+func (r *Repository) LoadTreeIndex(ctx context.Context) error {
+	err := r.loadIndex(ctx, true)
+	if err != nil {
+		return err
+	}
+
+	r.idx.loadOnDemand(func(id restic.ID) (*Index, error) {
+		return LoadIndex(ctx, r, id)
+	})
+	return nil
+}
+
+func (r *Repository) loadIndex(ctx context.Context, treesOnly bool) error {
+	debug.Log("Loading index, trees only: %v", treesOnly)
 
 	errCh := make(chan error, 1)
 	indexes := make(chan *Index)
 
+	load := LoadIndex
+	if treesOnly {
+		load = loadTreeIndex
+	}
+
 	worker := func(ctx context.Context, id restic.ID) error {
-		idx, err := LoadIndex(ctx, r, id)
+		idx, err := load(ctx, r, id)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "%v, ignoring\n", err)
 			return nil
@@ -400,6 +483,7 @@ func (r *Repository) LoadIndex(ctx context.Context) error {
 			ParallelWorkFuncParseID(worker))
 	}()
 
+	var loaded []*Index
 	validIndex := restic.NewIDSet()
 	for idx := range indexes {
 		id, err := idx.ID()
@@ -407,6 +491,7 @@ func (r *Repository) LoadIndex(ctx context.Context) error {
 			validIndex.Insert(id)
 		}
 		r.idx.Insert(idx)
+		loaded = append(loaded, idx)
 	}
 
 	if r.Cache != nil {
@@ -417,7 +502,7 @@ func (r *Repository) LoadIndex(ctx context.Context) error {
 		}
 
 		packs := restic.NewIDSet()
-		for _, idx := range r.idx.All() {
+		for _, idx := range loaded {
 			for id := range idx.Packs() {
 				packs.Insert(id)
 			}
@@ -430,7 +515,7 @@ func (r *Repository) LoadIndex(ctx context.Context) error {
 		}
 
 		treePacks := restic.NewIDSet()
-		for _, idx := range r.idx.All() {
+		for _, idx := range loaded {
 			for _, id := range idx.TreePacks() {
 				treePacks.Insert(id)
 			}
@@ -461,7 +546,19 @@ func (r *Repository) LoadIndex(ctx context.Context) error {
 
 // LoadIndex loads the index id from backend and returns it.
 func LoadIndex(ctx context.Context, repo restic.Repository, id restic.ID) (*Index, error) {
-	idx, err := LoadIndexWithDecoder(ctx, repo, id, DecodeIndex)
+	return loadIndexWithFallback(ctx, repo, id, DecodeIndex)
+}
+
+// loadTreeIndex loads the tree blobs of the index id from the backend. Indexes
+// in the old format are loaded completely.
+func loadTreeIndex(ctx context.Context, repo restic.Repository, id restic.ID) (*Index, error) {
+	return loadIndexWithFallback(ctx, repo, id, DecodeTreeIndex)
+}
+
+// loadIndexWithFallback loads the index id with fn, DecodeOldIndex is used if
+// the index has the old format.
+func loadIndexWithFallback(ctx context.Context, repo restic.Repository, id restic.ID, fn func([]byte) (*Index, error)) (*Index, error) {
+	idx, err := LoadIndexWithDecoder(ctx, repo, id, fn)
 	if err == nil {
 		return idx, nil
 	}
@@ -486,25 +583,41 @@ func (r *Repository) SearchKey(ctx context.Context, password string, maxKeys int
 	r.dataPM.key = key.master
 	r.treePM.key = key.master
 	r.keyName = key.Name()
-	r.cfg, err = restic.LoadConfig(ctx, r)
-	return err
+	cfg, err := restic.LoadConfig(ctx, r)
+	if err != nil {
+		return err
+	}
+
+	r.setConfig(cfg)
+	return nil
 }
 
 // Init creates a new master key with the supplied password, initializes and
 // saves the repository config.
 func (r *Repository) Init(ctx context.Context, password string) error {
-	has, err := r.be.Test(ctx, restic.Handle{Type: restic.ConfigFile})
+	cfg, err := restic.CreateConfig()
 	if err != nil {
 		return err
 	}
-	if has {
-		return errors.New("repository master key and config already initialized")
+
+	return r.InitWithConfig(ctx, password, cfg)
+}
+
+// InitWithConfig is like Init, but saves the given config. This allows
+// setting the optional parameters, cfg can be created with
+// restic.CreateConfig.
+func (r *Repository) InitWithConfig(ctx context.Context, password string, cfg restic.Config) error {
+	if err := cfg.Valid(); err != nil {
+		return err
 	}
 
-	cfg, err := restic.CreateConfig()
+	has, err := r.be.Test(ctx, restic.Handle{Type: restic.ConfigFile})
 	if err != nil {
 		return err
 	}
+	if has {
+		return errors.New("repository master key and config already initialized")
+	}
 
 	return r.init(ctx, password, cfg)
 }
@@ -521,11 +634,18 @@ func (r *Repository) init(ctx context.Context, password string, cfg restic.Confi
 	r.dataPM.key = key.master
 	r.treePM.key = key.master
 	r.keyName = key.Name()
-	r.cfg = cfg
+	r.setConfig(cfg)
 	_, err = r.SaveJSONUnpacked(ctx, restic.ConfigFile, cfg)
 	return err
 }
 
+// setConfig sets the config used for new data.
+func (r *Repository) setConfig(cfg restic.Config) {
+	r.cfg = cfg
+	r.dataPM.headerChecksum = cfg.PackHeaderChecksums()
+	r.treePM.headerChecksum = cfg.PackHeaderChecksums()
+}
+
 // Key returns the current master key.
 func (r *Repository) Key() *crypto.Key {
 	return r.key
@@ -7,6 +7,7 @@ import (
 	"io"
 	"math/rand"
 	"path/filepath"
+	"sync"
 	"testing"
 	"time"
 
@@ -291,6 +292,52 @@ func TestRepositoryLoadIndex(t *testing.T) {
 	rtest.OK(t, repo.LoadIndex(context.TODO()))
 }
 
+func TestRepositoryLoadTreeIndex(t *testing.T) {
+	repodir, cleanup := rtest.Env(t, repoFixture)
+	defer cleanup()
+
+	repo := repository.TestOpenLocal(t, repodir)
+	rtest.OK(t, repo.LoadIndex(context.TODO()))
+	trees := repo.Index().Count(restic.TreeBlob)
+	data := repo.Index().Count(restic.DataBlob)
+
+	repo = repository.TestOpenLocal(t, repodir)
+	rtest.OK(t, repo.(*repository.Repository).LoadTreeIndex(context.TODO()))
+	rtest.Equals(t, trees, repo.Index().Count(restic.TreeBlob))
+
+	// the data blobs are loaded when they are needed
+	rtest.Equals(t, data, repo.Index().Count(restic.DataBlob))
+	rtest.Assert(t, data > 0, "no data blobs found in the index")
+}
+
+func TestRepositoryLoadTreeIndexConcurrent(t *testing.T) {
+	repodir, cleanup := rtest.Env(t, repoFixture)
+	defer cleanup()
+
+	repo := repository.TestOpenLocal(t, repodir)
+	rtest.OK(t, repo.LoadIndex(context.TODO()))
+	data := repo.Index().Count(restic.DataBlob)
+
+	repo = repository.TestOpenLocal(t, repodir)
+	rtest.OK(t, repo.(*repository.Repository).LoadTreeIndex(context.TODO()))
+
+	// all lookups wait until the data blobs have been loaded once
+	counts := make([]uint, 10)
+	var wg sync.WaitGroup
+	for i := range counts {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			counts[i] = repo.Index().Count(restic.DataBlob)
+		}(i)
+	}
+	wg.Wait()
+
+	for _, n := range counts {
+		rtest.Equals(t, data, n)
+	}
+}
+
 func BenchmarkLoadIndex(b *testing.B) {
 	repository.TestUseLowSecurityKDFParameters(b)
 
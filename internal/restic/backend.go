@@ -20,8 +20,11 @@ type Backend interface {
 	// Close the backend
 	Close() error
 
-	// Save stores the data in the backend under the given handle.
-	Save(ctx context.Context, h Handle, rd io.Reader) error
+	// Save stores the data from rd under the given handle. The reader
+	// reports the length of the data, so backends can stream it without
+	// buffering. Implementations may call rd.Rewind() and read the data
+	// again, e.g. when retrying an upload.
+	Save(ctx context.Context, h Handle, rd RewindReader) error
 
 	// Load returns a reader that yields the contents of the file at h at the
 	// given offset. If length is larger than zero, only a portion of the file
@@ -43,6 +46,11 @@ type Backend interface {
 	// in the backend.
 	IsNotExist(err error) bool
 
+	// IsPermanentError returns true if the error cannot be resolved by
+	// retrying the operation, e.g. because the file does not exist or the
+	// credentials are invalid.
+	IsPermanentError(err error) bool
+
 	// Delete removes all data in the backend.
 	Delete(ctx context.Context) error
 }
@@ -52,3 +60,12 @@ type FileInfo struct {
 	Size int64
 	Name string
 }
+
+// LifecycleChecker is implemented by backends which can detect rules of the
+// storage service that delete or hide the files of a repository, e.g. the
+// lifecycle rules of a bucket.
+type LifecycleChecker interface {
+	// CheckLifecycle returns a description of each rule which affects the
+	// files of the repository.
+	CheckLifecycle(ctx context.Context) ([]string, error)
+}
@@ -2,6 +2,7 @@ package restic
 
 import (
 	"context"
+	"io"
 	"testing"
 
 	"github.com/restic/restic/internal/errors"
@@ -16,11 +17,55 @@ type Config struct {
 	Version           uint        `json:"version"`
 	ID                string      `json:"id"`
 	ChunkerPolynomial chunker.Pol `json:"chunker_polynomial"`
+
+	// The following fields are optional, the defaults are used when they
+	// are zero.
+	MinPackSize        uint `json:"min_pack_size,omitempty"`
+	ChunkerMinSize     uint `json:"chunker_min_size,omitempty"`
+	ChunkerMaxSize     uint `json:"chunker_max_size,omitempty"`
+	ChunkerAverageBits uint `json:"chunker_average_bits,omitempty"`
+
+	// AppendOnly guards the data files, snapshots and keys against being
+	// removed or overwritten by accident. It is enforced by the clients only.
+	AppendOnly bool `json:"append_only,omitempty"`
 }
 
+// DefaultChunkerAverageBits is the number of bits of the rolling hash which
+// must be zero at a chunk boundary, unless the config specifies otherwise.
+// Chunks are 2^20 bytes (1 MiB) large on average.
+const DefaultChunkerAverageBits = 20
+
+// maxChunkerAverageBits limits the average chunk size to 1 GiB.
+const maxChunkerAverageBits = 30
+
+// DefaultMinPackSize is the size a pack file must reach before it is saved,
+// unless the config specifies otherwise.
+const DefaultMinPackSize = 4 * 1024 * 1024
+
+// MaxPackSize is the largest size which can be configured for pack files.
+const MaxPackSize = 128 * 1024 * 1024
+
+// MinChunkSize is the smallest minimal chunk size which can be configured.
+// Smaller chunks only inflate the index, and the chunker needs at least a
+// full window of data.
+const MinChunkSize = 64 * 1024
+
+// MaxChunkSize is the largest maximal chunk size which can be configured, the
+// length of a blob must fit into the pack header and the index.
+const MaxChunkSize = MaxPackSize
+
+// MinRepoVersion and MaxRepoVersion are the oldest and the newest repository
+// versions which are supported. Repositories with version 2 store a checksum
+// of the header in each pack file.
+const (
+	MinRepoVersion = 1
+	MaxRepoVersion = 2
+)
+
 // RepoVersion is the version that is written to the config when a repository
-// is newly created with Init().
-const RepoVersion = 1
+// is newly created with Init(). Older versions of restic cannot read
+// repositories with version 2, so it must be requested explicitly.
+const RepoVersion = MinRepoVersion
 
 // JSONUnpackedLoader loads unpacked JSON.
 type JSONUnpackedLoader interface {
@@ -68,13 +113,106 @@ func LoadConfig(ctx context.Context, r JSONUnpackedLoader) (Config, error) {
 		return Config{}, err
 	}
 
-	if cfg.Version != RepoVersion {
-		return Config{}, errors.New("unsupported repository version")
+	if cfg.Version < MinRepoVersion || cfg.Version > MaxRepoVersion {
+		return Config{}, errors.Errorf("unsupported repository version %d", cfg.Version)
 	}
 
 	if !cfg.ChunkerPolynomial.Irreducible() {
 		return Config{}, errors.New("invalid chunker polynomial")
 	}
 
+	if err = cfg.Valid(); err != nil {
+		return Config{}, err
+	}
+
 	return cfg, nil
 }
+
+// ValidPackSize checks that size can be used as the minimal size of pack
+// files.
+func ValidPackSize(size uint64) error {
+	if size < DefaultMinPackSize || size > MaxPackSize {
+		return errors.Errorf("invalid pack size %d, must be between %d and %d", size, DefaultMinPackSize, MaxPackSize)
+	}
+
+	return nil
+}
+
+// Valid checks the optional parameters of the config.
+func (cfg Config) Valid() error {
+	if cfg.MinPackSize != 0 {
+		if err := ValidPackSize(uint64(cfg.MinPackSize)); err != nil {
+			return err
+		}
+	}
+
+	min, max := cfg.ChunkerBoundaries()
+	if min == 0 || max <= min {
+		return errors.Errorf("invalid chunk size boundaries %d and %d", min, max)
+	}
+
+	if min < MinChunkSize || max > MaxChunkSize {
+		return errors.Errorf("invalid chunk size boundaries %d and %d, must be between %d and %d", min, max, MinChunkSize, MaxChunkSize)
+	}
+
+	bits := cfg.chunkerAverageBits()
+	if bits > maxChunkerAverageBits {
+		return errors.Errorf("invalid average chunk size 2^%d", bits)
+	}
+
+	avg := cfg.ChunkerAverageSize()
+	if avg < uint64(min) || avg > uint64(max) {
+		return errors.Errorf("invalid average chunk size %d, must be between %d and %d", avg, min, max)
+	}
+
+	return nil
+}
+
+// PackHeaderChecksums returns true if new pack files must contain a checksum
+// of the header.
+func (cfg Config) PackHeaderChecksums() bool {
+	return cfg.Version >= 2
+}
+
+// PackSize returns the size a pack file must reach before it is saved.
+func (cfg Config) PackSize() uint {
+	if cfg.MinPackSize == 0 {
+		return DefaultMinPackSize
+	}
+	return cfg.MinPackSize
+}
+
+// ChunkerBoundaries returns the minimal and maximal size of chunks.
+func (cfg Config) ChunkerBoundaries() (min, max uint) {
+	min, max = chunker.MinSize, chunker.MaxSize
+	if cfg.ChunkerMinSize != 0 {
+		min = cfg.ChunkerMinSize
+	}
+	if cfg.ChunkerMaxSize != 0 {
+		max = cfg.ChunkerMaxSize
+	}
+	return min, max
+}
+
+func (cfg Config) chunkerAverageBits() uint {
+	if cfg.ChunkerAverageBits == 0 {
+		return DefaultChunkerAverageBits
+	}
+	return cfg.ChunkerAverageBits
+}
+
+// ChunkerAverageSize returns the size chunks have on average.
+func (cfg Config) ChunkerAverageSize() uint64 {
+	return 1 << cfg.chunkerAverageBits()
+}
+
+// NewChunker returns a chunker for rd which uses the polynomial, the chunk
+// size boundaries and the average chunk size of the repository.
+func (cfg Config) NewChunker(rd io.Reader) *chunker.Chunker {
+	min, max := cfg.ChunkerBoundaries()
+	c := chunker.NewWithBoundaries(rd, cfg.ChunkerPolynomial, min, max)
+	if cfg.ChunkerAverageBits != 0 {
+		c.SetAverageBits(int(cfg.ChunkerAverageBits))
+	}
+	return c
+}
@@ -1,11 +1,15 @@
 package restic_test
 
 import (
+	"bytes"
 	"context"
+	"io"
 	"testing"
 
 	"github.com/restic/restic/internal/restic"
 	rtest "github.com/restic/restic/internal/test"
+
+	"github.com/restic/chunker"
 )
 
 type saver func(restic.FileType, interface{}) (restic.ID, error)
@@ -53,3 +57,103 @@ func TestConfig(t *testing.T) {
 	rtest.Assert(t, cfg1 == cfg2,
 		"configs aren't equal: %v != %v", cfg1, cfg2)
 }
+
+func TestConfigOptionalParameters(t *testing.T) {
+	cfg, err := restic.CreateConfig()
+	rtest.OK(t, err)
+	rtest.OK(t, cfg.Valid())
+
+	rtest.Equals(t, uint(restic.DefaultMinPackSize), cfg.PackSize())
+	min, max := cfg.ChunkerBoundaries()
+	rtest.Equals(t, uint(chunker.MinSize), min)
+	rtest.Equals(t, uint(chunker.MaxSize), max)
+
+	cfg.MinPackSize = 16 * 1024 * 1024
+	cfg.ChunkerMinSize = 1024 * 1024
+	rtest.OK(t, cfg.Valid())
+	rtest.Equals(t, uint(16*1024*1024), cfg.PackSize())
+	min, max = cfg.ChunkerBoundaries()
+	rtest.Equals(t, uint(1024*1024), min)
+	rtest.Equals(t, uint(chunker.MaxSize), max)
+
+	cfg.ChunkerMaxSize = 1024 * 1024
+	rtest.Assert(t, cfg.Valid() != nil, "expected error for invalid chunk size boundaries")
+}
+
+func TestConfigChunkSizeLimits(t *testing.T) {
+	cfg, err := restic.CreateConfig()
+	rtest.OK(t, err)
+
+	cfg.ChunkerMinSize = restic.MinChunkSize
+	cfg.ChunkerMaxSize = restic.MaxChunkSize
+	rtest.OK(t, cfg.Valid())
+
+	for _, size := range []uint{1, 63, restic.MinChunkSize - 1} {
+		cfg.ChunkerMinSize = size
+		rtest.Assert(t, cfg.Valid() != nil, "expected error for minimal chunk size %d", size)
+	}
+	cfg.ChunkerMinSize = restic.MinChunkSize
+
+	for _, size := range []uint{restic.MaxChunkSize + 1, 5 * 1024 * 1024 * 1024} {
+		cfg.ChunkerMaxSize = size
+		rtest.Assert(t, cfg.Valid() != nil, "expected error for maximal chunk size %d", size)
+	}
+}
+
+func TestConfigPackSize(t *testing.T) {
+	cfg, err := restic.CreateConfig()
+	rtest.OK(t, err)
+
+	for _, size := range []uint{restic.DefaultMinPackSize, 16 * 1024 * 1024, restic.MaxPackSize} {
+		cfg.MinPackSize = size
+		rtest.OK(t, cfg.Valid())
+		rtest.Equals(t, size, cfg.PackSize())
+	}
+
+	for _, size := range []uint{1024 * 1024, restic.MaxPackSize + 1} {
+		cfg.MinPackSize = size
+		rtest.Assert(t, cfg.Valid() != nil, "expected error for pack size %d", size)
+	}
+}
+
+func TestConfigChunkerAverageSize(t *testing.T) {
+	cfg, err := restic.CreateConfig()
+	rtest.OK(t, err)
+	rtest.Equals(t, uint64(1<<restic.DefaultChunkerAverageBits), cfg.ChunkerAverageSize())
+
+	cfg.ChunkerMinSize = 1024 * 1024
+	cfg.ChunkerMaxSize = 16 * 1024 * 1024
+	cfg.ChunkerAverageBits = 22
+	rtest.OK(t, cfg.Valid())
+	rtest.Equals(t, uint64(4*1024*1024), cfg.ChunkerAverageSize())
+
+	// the average size must be within the boundaries
+	cfg.ChunkerAverageBits = 25
+	rtest.Assert(t, cfg.Valid() != nil, "expected error for average size larger than the maximal size")
+	cfg.ChunkerAverageBits = 19
+	rtest.Assert(t, cfg.Valid() != nil, "expected error for average size smaller than the minimal size")
+
+	// larger chunks are found with a larger average size
+	cfg.ChunkerMinSize = 64 * 1024
+	cfg.ChunkerMaxSize = 8 * 1024 * 1024
+	data := rtest.Random(23, 8*1024*1024)
+	var counts []int
+	for _, bits := range []uint{17, 20} {
+		cfg.ChunkerAverageBits = bits
+		rtest.OK(t, cfg.Valid())
+
+		c := cfg.NewChunker(bytes.NewReader(data))
+		n := 0
+		for {
+			_, err := c.Next(nil)
+			if err == io.EOF {
+				break
+			}
+			rtest.OK(t, err)
+			n++
+		}
+		counts = append(counts, n)
+	}
+
+	rtest.Assert(t, counts[0] > counts[1], "expected more chunks with a smaller average size, got %v", counts)
+}
@@ -0,0 +1,125 @@
+package restic
+
+import (
+	"context"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+)
+
+// ContentReader provides random access to the content of a file node. The
+// most recently used blob is kept in memory, so that sequential reads of
+// small parts do not load the same blob again.
+type ContentReader struct {
+	ctx  context.Context
+	repo Repository
+	node *Node
+
+	// offsets contains the start of each blob within the file, followed by
+	// the size of the file.
+	offsets []int64
+
+	m        sync.Mutex
+	blobIdx  int
+	blobData []byte
+}
+
+// statically ensure that *ContentReader implements io.ReaderAt.
+var _ io.ReaderAt = &ContentReader{}
+
+// NewContentReader returns a reader for the content of the file node. The
+// size of all blobs must be known to the index of repo.
+func NewContentReader(ctx context.Context, repo Repository, node *Node) (*ContentReader, error) {
+	if node.Type != "file" {
+		return nil, errors.Errorf("node %v is not a file", node.Name)
+	}
+
+	offsets := make([]int64, 0, len(node.Content)+1)
+	var offset int64
+	for _, id := range node.Content {
+		size, found := repo.LookupBlobSize(id, DataBlob)
+		if !found {
+			return nil, errors.Errorf("id %v not found in repository", id)
+		}
+
+		offsets = append(offsets, offset)
+		offset += int64(size)
+	}
+	offsets = append(offsets, offset)
+
+	if uint64(offset) != node.Size {
+		debug.Log("sizes do not match: node.Size %v != size %v, using real size", node.Size, offset)
+	}
+
+	return &ContentReader{
+		ctx:     ctx,
+		repo:    repo,
+		node:    node,
+		offsets: offsets,
+		blobIdx: -1,
+	}, nil
+}
+
+// Size returns the size of the content.
+func (rd *ContentReader) Size() int64 {
+	return rd.offsets[len(rd.offsets)-1]
+}
+
+// blob returns the plaintext of the blob with index i, it must be called
+// with rd.m held.
+func (rd *ContentReader) blob(i int) ([]byte, error) {
+	if i == rd.blobIdx {
+		return rd.blobData, nil
+	}
+
+	buf := NewBlobBuffer(int(rd.offsets[i+1] - rd.offsets[i]))
+	n, err := rd.repo.LoadBlob(rd.ctx, DataBlob, rd.node.Content[i], buf)
+	if err != nil {
+		debug.Log("LoadBlob(%v, %v) failed: %v", rd.node.Name, rd.node.Content[i].Str(), err)
+		return nil, err
+	}
+
+	rd.blobIdx = i
+	rd.blobData = buf[:n]
+	return rd.blobData, nil
+}
+
+// ReadAt reads len(p) bytes starting at offset off. If less data is
+// available, the number of bytes read and io.EOF are returned.
+func (rd *ContentReader) ReadAt(p []byte, off int64) (n int, err error) {
+	if off < 0 {
+		return 0, errors.Errorf("invalid offset %d", off)
+	}
+
+	if off >= rd.Size() {
+		return 0, io.EOF
+	}
+
+	rd.m.Lock()
+	defer rd.m.Unlock()
+
+	// find the first blob which ends after off
+	blobs := len(rd.offsets) - 1
+	i := sort.Search(blobs, func(i int) bool {
+		return rd.offsets[i+1] > off
+	})
+
+	for ; n < len(p) && i < blobs; i++ {
+		data, err := rd.blob(i)
+		if err != nil {
+			return n, err
+		}
+
+		start := off + int64(n) - rd.offsets[i]
+		n += copy(p[n:], data[start:])
+	}
+
+	if n < len(p) {
+		return n, io.EOF
+	}
+
+	return n, nil
+}
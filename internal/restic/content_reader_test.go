@@ -0,0 +1,83 @@
+package restic_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestContentReader(t *testing.T) {
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	node := &restic.Node{Name: "file", Type: "file"}
+	var want []byte
+	for i := 0; i < 10; i++ {
+		data := rtest.Random(i, 1000+i*100)
+		id, err := repo.SaveBlob(ctx, restic.DataBlob, data, restic.ID{})
+		rtest.OK(t, err)
+
+		node.Content = append(node.Content, id)
+		want = append(want, data...)
+	}
+	node.Size = uint64(len(want))
+
+	rtest.OK(t, repo.Flush(ctx))
+
+	rd, err := restic.NewContentReader(ctx, repo, node)
+	rtest.OK(t, err)
+	rtest.Equals(t, int64(len(want)), rd.Size())
+
+	var tests = []struct {
+		off, length int
+	}{
+		{0, 0},
+		{0, 10},
+		{0, len(want)},
+		{999, 2},
+		{1500, 5000},
+		{len(want) - 1, 1},
+	}
+
+	for _, test := range tests {
+		buf := make([]byte, test.length)
+		n, err := rd.ReadAt(buf, int64(test.off))
+		rtest.OK(t, err)
+		rtest.Equals(t, test.length, n)
+
+		if !bytes.Equal(buf, want[test.off:test.off+test.length]) {
+			t.Errorf("wrong data returned for offset %d, length %d", test.off, test.length)
+		}
+	}
+
+	// reads beyond the end return the remaining data and io.EOF
+	buf := make([]byte, 100)
+	n, err := rd.ReadAt(buf, int64(len(want)-10))
+	rtest.Assert(t, err == io.EOF, "expected io.EOF, got %v", err)
+	rtest.Equals(t, 10, n)
+	rtest.Assert(t, bytes.Equal(buf[:n], want[len(want)-10:]), "wrong data returned at the end")
+
+	n, err = rd.ReadAt(buf, int64(len(want)))
+	rtest.Assert(t, err == io.EOF, "expected io.EOF, got %v", err)
+	rtest.Equals(t, 0, n)
+}
+
+func TestContentReaderInvalidNode(t *testing.T) {
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+
+	_, err := restic.NewContentReader(context.TODO(), repo, &restic.Node{Name: "dir", Type: "dir"})
+	rtest.Assert(t, err != nil, "expected error for a directory node")
+
+	node := &restic.Node{Name: "file", Type: "file", Content: restic.IDs{restic.NewRandomID()}}
+	_, err = restic.NewContentReader(context.TODO(), repo, node)
+	rtest.Assert(t, err != nil, "expected error for unknown blob")
+}
@@ -0,0 +1,99 @@
+package restic
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNextNumber(t *testing.T) {
+	var tests = []struct {
+		input string
+		num   int
+		rest  string
+		err   bool
+	}{
+		{input: "12h", num: 12, rest: "h"},
+		{input: "3d", num: 3, rest: "d"},
+		{input: "4d9h", num: 4, rest: "d9h"},
+		{input: "7m5d", num: 7, rest: "m5d"},
+		{input: "-23y5d", num: -23, rest: "y5d"},
+		{input: "d", rest: "d", err: true},
+		{input: "", num: 0, rest: ""},
+	}
+
+	for _, test := range tests {
+		t.Run("", func(t *testing.T) {
+			num, rest, err := nextNumber(test.input)
+
+			if err != nil && !test.err {
+				t.Fatal(err)
+			}
+
+			if test.err && err == nil {
+				t.Fatalf("wanted error for input %q, got nil", test.input)
+			}
+
+			if num != test.num {
+				t.Errorf("input %q: wrong number, want %d, got %d", test.input, test.num, num)
+			}
+
+			if rest != test.rest {
+				t.Errorf("input %q: wrong rest, want %q, got %q", test.input, test.rest, rest)
+			}
+		})
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	var tests = []struct {
+		input  string
+		d      Duration
+		output string
+		err    bool
+	}{
+		{input: "9h", d: Duration{Hours: 9}, output: "9h"},
+		{input: "3d", d: Duration{Days: 3}, output: "3d"},
+		{input: "4d2h", d: Duration{Days: 4, Hours: 2}, output: "4d2h"},
+		{input: "7m5d", d: Duration{Months: 7, Days: 5}, output: "7m5d"},
+		{input: "2y7m5d5h", d: Duration{Years: 2, Months: 7, Days: 5, Hours: 5}, output: "2y7m5d5h"},
+		{input: "5d2y", d: Duration{Years: 2, Days: 5}, output: "2y5d"},
+		{input: "", d: Duration{}, output: ""},
+		{input: "2", err: true},
+		{input: "2w", err: true},
+		{input: "h", err: true},
+	}
+
+	for _, test := range tests {
+		t.Run("", func(t *testing.T) {
+			d, err := ParseDuration(test.input)
+			if test.err {
+				if err == nil {
+					t.Fatalf("Missing error for %v", test.input)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if d != test.d {
+				t.Errorf("input %q: wrong duration, want %#v, got %#v", test.input, test.d, d)
+			}
+
+			if d.String() != test.output {
+				t.Errorf("input %q: wrong string, want %q, got %q", test.input, test.output, d.String())
+			}
+		})
+	}
+}
+
+func TestDurationBefore(t *testing.T) {
+	now := time.Date(2016, 3, 31, 12, 0, 0, 0, time.UTC)
+	d := Duration{Years: 1, Months: 1, Days: 2, Hours: 3}
+
+	want := time.Date(2015, 2, 29, 9, 0, 0, 0, time.UTC)
+	if got := d.Before(now); !got.Equal(want) {
+		t.Errorf("wrong time, want %v, got %v", want, got)
+	}
+}
@@ -11,12 +11,18 @@ type FileType string
 
 // These are the different data types a backend can store.
 const (
-	DataFile     FileType = "data"
-	KeyFile               = "key"
-	LockFile              = "lock"
-	SnapshotFile          = "snapshot"
-	IndexFile             = "index"
-	ConfigFile            = "config"
+	DataFile      FileType = "data"
+	KeyFile                = "key"
+	LockFile               = "lock"
+	SnapshotFile           = "snapshot"
+	IndexFile              = "index"
+	ConfigFile             = "config"
+	ManifestFile           = "manifest"
+	MigrationFile          = "migration"
+
+	// ArchiveFile is an archive written by restore, it is stored with its
+	// name in the base directory of the backend.
+	ArchiveFile = "archive"
 )
 
 // Handle is used to store and access data in a backend.
@@ -46,6 +52,9 @@ func (h Handle) Valid() error {
 	case SnapshotFile:
 	case IndexFile:
 	case ConfigFile:
+	case ManifestFile:
+	case MigrationFile:
+	case ArchiveFile:
 	default:
 		return errors.Errorf("invalid Type %q", h.Type)
 	}
@@ -0,0 +1,528 @@
+package restic
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/fs"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// DefaultRestoreWorkers is the number of pack files which are downloaded
+// concurrently during a restore.
+const DefaultRestoreWorkers = 8
+
+// restoreFile is a file whose content is written after all files have been
+// created.
+type restoreFile struct {
+	node     *Node
+	target   string
+	location string
+
+	// blobs are the data blobs of the file in order, with their offset in
+	// the file
+	blobs []fileBlob
+
+	m sync.Mutex
+	// failed is set when an error for the file has been reported, the
+	// metadata of the file is not restored then
+	failed bool
+	// replaced contains the offsets of blobs which were replaced with zeros
+	replaced map[uint64]struct{}
+}
+
+// fileBlob is a data blob at an offset within a file.
+type fileBlob struct {
+	id     ID
+	offset uint64
+	length uint64
+}
+
+// blobTarget is a location in a file at which a blob is written.
+type blobTarget struct {
+	file   *restoreFile
+	offset uint64
+}
+
+// packBlob is a blob in a pack file which is written to one or more files.
+type packBlob struct {
+	blob    PackedBlob
+	length  uint64 // plaintext length
+	targets []blobTarget
+}
+
+// createFile creates an empty file of the correct size for node at target.
+// The content is written later by restoreContent, which downloads the data
+// ordered by pack files. Hard links to files which have already been created
+// are created directly.
+func (res *Restorer) createFile(node *Node, target, location string, idx *HardlinkIndex) error {
+	if node.Links > 1 && idx.Has(node.Inode, node.DeviceID) {
+		if err := fs.Remove(target); !os.IsNotExist(err) {
+			return errors.Wrap(err, "RemoveCreateHardlink")
+		}
+		err := fs.Link(idx.GetFilename(node.Inode, node.DeviceID), target)
+		if err != nil {
+			return errors.Wrap(err, "CreateHardlink")
+		}
+
+		res.files = append(res.files, &restoreFile{node: node, target: target, location: location})
+		return nil
+	}
+
+	file := &restoreFile{node: node, target: target, location: location}
+
+	var size uint64
+	for _, id := range node.Content {
+		length, found := res.repo.LookupBlobSize(id, DataBlob)
+		if !found {
+			return errors.Errorf("id %v not found in repository", id)
+		}
+
+		file.blobs = append(file.blobs, fileBlob{id: id, offset: size, length: uint64(length)})
+		size += uint64(length)
+	}
+
+	f, err := fs.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return errors.Wrap(err, "OpenFile")
+	}
+
+	if res.Sparse && size > 0 {
+		// not all file systems support sparse files, the data is written
+		// normally then
+		if err := fs.MakeSparse(f); err != nil {
+			debug.Log("unable to make %v sparse: %v", target, err)
+		}
+	}
+
+	// parts of the file which cannot be restored or are left as holes read
+	// as zeros
+	err = f.Truncate(int64(size))
+	closeErr := f.Close()
+
+	if err != nil {
+		return errors.Wrap(err, "Truncate")
+	}
+
+	if closeErr != nil {
+		return errors.Wrap(closeErr, "Close")
+	}
+
+	if node.Links > 1 {
+		idx.Add(node.Inode, node.DeviceID, target)
+	}
+
+	res.files = append(res.files, file)
+	return nil
+}
+
+// planPacks groups the blobs of all files by the pack files they are stored
+// in, ordered by their offset within the pack. A blob which is used several
+// times is only loaded once.
+func (res *Restorer) planPacks() map[ID][]*packBlob {
+	packs := make(map[ID][]*packBlob)
+	blobs := make(map[ID]*packBlob)
+
+	for _, file := range res.files {
+		for _, b := range file.blobs {
+			target := blobTarget{file: file, offset: b.offset}
+
+			if pb, ok := blobs[b.id]; ok {
+				pb.targets = append(pb.targets, target)
+				continue
+			}
+
+			// the index was checked when the file was created
+			list, _ := res.repo.Index().Lookup(b.id, DataBlob)
+			pb := &packBlob{blob: list[0], length: b.length, targets: []blobTarget{target}}
+			blobs[b.id] = pb
+			packs[pb.blob.PackID] = append(packs[pb.blob.PackID], pb)
+		}
+	}
+
+	for _, list := range packs {
+		sort.Slice(list, func(i, j int) bool {
+			return list[i].blob.Offset < list[j].blob.Offset
+		})
+	}
+
+	return packs
+}
+
+// reportError passes err for file to res.Error, once per file. The callbacks
+// are not safe for concurrent use, so calls are serialized.
+func (res *Restorer) reportError(file *restoreFile, err error) error {
+	file.m.Lock()
+	failed := file.failed
+	file.failed = true
+	file.m.Unlock()
+
+	if failed {
+		return nil
+	}
+
+	debug.Log("error restoring %v: %v", file.target, err)
+
+	res.errMu.Lock()
+	defer res.errMu.Unlock()
+
+	return res.Error(file.location, file.node, err)
+}
+
+// blobFailed handles a blob which could not be loaded. If BlobError accepts
+// the damaged blob, the zeros already in the file are kept.
+func (res *Restorer) blobFailed(pb *packBlob, err error) error {
+	for _, target := range pb.targets {
+		if res.BlobError == nil {
+			if rerr := res.reportError(target.file, err); rerr != nil {
+				return rerr
+			}
+			continue
+		}
+
+		debug.Log("replacing damaged blob %v in %v: %v", pb.blob.ID.Str(), target.file.location, err)
+
+		res.errMu.Lock()
+		rerr := res.BlobError(target.file.location, target.file.node, DamagedBlob{
+			ID:     pb.blob.ID,
+			Offset: target.offset,
+			Length: pb.length,
+			Err:    err,
+		})
+		res.errMu.Unlock()
+
+		if rerr != nil {
+			if rerr = res.reportError(target.file, rerr); rerr != nil {
+				return rerr
+			}
+			continue
+		}
+
+		target.file.m.Lock()
+		if target.file.replaced == nil {
+			target.file.replaced = make(map[uint64]struct{})
+		}
+		target.file.replaced[target.offset] = struct{}{}
+		target.file.m.Unlock()
+	}
+
+	return nil
+}
+
+// decryptBlob decrypts the ciphertext of blob in buf and checks its hash.
+func (res *Restorer) decryptBlob(blob PackedBlob, buf []byte) ([]byte, error) {
+	key := res.repo.Key()
+	if len(buf) < key.NonceSize() {
+		return nil, errors.Errorf("blob %v is too short", blob.ID.Str())
+	}
+
+	nonce, ciphertext := buf[:key.NonceSize()], buf[key.NonceSize():]
+	plaintext, err := key.Open(ciphertext[:0], nonce, ciphertext, nil)
+	if err != nil {
+		return nil, errors.Errorf("decrypting blob %v failed: %v", blob.ID, err)
+	}
+
+	if !Hash(plaintext).Equal(blob.ID) {
+		return nil, errors.Errorf("blob %v returned invalid hash", blob.ID)
+	}
+
+	return plaintext, nil
+}
+
+// isZero returns true if buf only contains zeros.
+func isZero(buf []byte) bool {
+	for _, b := range buf {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// writeBlob writes data to all targets of pb.
+func (res *Restorer) writeBlob(pb *packBlob, data []byte, files map[*restoreFile]*os.File) error {
+	if res.Sparse && isZero(data) {
+		// the file was created with the correct size, the blob's range is
+		// left as a hole
+		return nil
+	}
+
+	for _, target := range pb.targets {
+		f, ok := files[target.file]
+		if !ok {
+			var err error
+			f, err = fs.OpenFile(target.file.target, os.O_WRONLY, 0600)
+			if err != nil {
+				if rerr := res.reportError(target.file, errors.Wrap(err, "OpenFile")); rerr != nil {
+					return rerr
+				}
+				continue
+			}
+			files[target.file] = f
+		}
+
+		_, err := f.WriteAt(data, int64(target.offset))
+		if err != nil {
+			if rerr := res.reportError(target.file, errors.Wrap(err, "WriteAt")); rerr != nil {
+				return rerr
+			}
+		}
+	}
+
+	return nil
+}
+
+// restorePack downloads the part of the pack packID which contains blobs with
+// a single request and writes the blobs to the files. Blobs which cannot be
+// taken from the pack are loaded individually, which also tries other copies
+// of the blob.
+func (res *Restorer) restorePack(ctx context.Context, packID ID, blobs []*packBlob) error {
+	debug.Log("restore %d blobs from pack %v", len(blobs), packID.Str())
+
+	// a file is closed after the last blob of this pack has been written to
+	// it, so that a pack with many small files does not keep them all open
+	lastBlob := make(map[*restoreFile]int)
+	for i, pb := range blobs {
+		for _, target := range pb.targets {
+			lastBlob[target.file] = i
+		}
+	}
+
+	files := make(map[*restoreFile]*os.File)
+	closeFile := func(file *restoreFile) {
+		f, ok := files[file]
+		if !ok {
+			return
+		}
+
+		delete(files, file)
+		if err := f.Close(); err != nil {
+			_ = res.reportError(file, errors.Wrap(err, "Close"))
+		}
+	}
+	defer func() {
+		for file := range files {
+			closeFile(file)
+		}
+	}()
+
+	// closeWritten closes the files for which the blob at position i is the
+	// last one in this pack.
+	closeWritten := func(i int) {
+		for _, target := range blobs[i].targets {
+			if lastBlob[target.file] == i {
+				closeFile(target.file)
+			}
+		}
+	}
+
+	// report the files written from this pack as current items
+	locations := make(map[string]struct{})
+	for _, pb := range blobs {
+		for _, target := range pb.targets {
+			locations[target.file.location] = struct{}{}
+		}
+	}
+	for location := range locations {
+		res.Progress.StartItem(location)
+	}
+	defer func() {
+		for location := range locations {
+			res.Progress.FinishItem(location)
+		}
+	}()
+
+	start := blobs[0].blob.Offset
+	last := blobs[len(blobs)-1].blob
+	h := Handle{Type: DataFile, Name: packID.String()}
+
+	var rd io.ReadCloser
+	rd, err := res.repo.Backend().Load(ctx, h, int(last.Offset+last.Length-start), int64(start))
+	if err != nil {
+		debug.Log("loading pack %v failed: %v", packID.Str(), err)
+		rd = nil
+	}
+
+	var buf []byte
+	pos := start
+	for i, pb := range blobs {
+		var data []byte
+		err = nil
+
+		// read the blob from the pack, this also skips the data between blobs
+		if rd != nil {
+			if pb.blob.Offset > pos {
+				_, err = io.CopyN(ioutil.Discard, rd, int64(pb.blob.Offset-pos))
+			}
+
+			if err == nil {
+				if cap(buf) < int(pb.blob.Length) {
+					buf = make([]byte, pb.blob.Length)
+				}
+				buf = buf[:pb.blob.Length]
+				_, err = io.ReadFull(rd, buf)
+			}
+
+			if err != nil {
+				// the rest of the pack cannot be read from this stream
+				debug.Log("reading pack %v failed: %v", packID.Str(), err)
+				_ = rd.Close()
+				rd = nil
+			} else {
+				pos = pb.blob.Offset + pb.blob.Length
+				data, err = res.decryptBlob(pb.blob, buf)
+				if err != nil {
+					debug.Log("blob %v in pack %v is damaged: %v", pb.blob.ID.Str(), packID.Str(), err)
+				}
+			}
+		}
+
+		// fall back to loading the blob on its own
+		if data == nil {
+			if cap(buf) < CiphertextLength(int(pb.length)) {
+				buf = NewBlobBuffer(int(pb.length))
+			}
+
+			var n int
+			n, err = res.repo.LoadBlob(ctx, DataBlob, pb.blob.ID, buf[:cap(buf)])
+			if err != nil {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+
+				if err = res.blobFailed(pb, err); err != nil {
+					return err
+				}
+				res.Progress.Report(Stat{Bytes: pb.length * uint64(len(pb.targets))})
+				closeWritten(i)
+				continue
+			}
+			data = buf[:n]
+		}
+
+		if err = res.writeBlob(pb, data, files); err != nil {
+			return err
+		}
+		res.Progress.Report(Stat{Bytes: pb.length * uint64(len(pb.targets))})
+		closeWritten(i)
+	}
+
+	if rd != nil {
+		return errors.Wrap(rd.Close(), "Close")
+	}
+
+	return nil
+}
+
+// restoreContent writes the content of all files created by createFile. The
+// pack files are downloaded by res.Workers goroutines concurrently.
+func (res *Restorer) restoreContent(ctx context.Context) error {
+	packs := res.planPacks()
+	debug.Log("restoring %d files from %d packs", len(res.files), len(packs))
+
+	workers := res.Workers
+	if workers <= 0 {
+		workers = DefaultRestoreWorkers
+	}
+
+	wg, ctx := errgroup.WithContext(ctx)
+	ch := make(chan ID)
+
+	wg.Go(func() error {
+		defer close(ch)
+		for id := range packs {
+			select {
+			case ch <- id:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		return nil
+	})
+
+	for i := 0; i < workers; i++ {
+		wg.Go(func() error {
+			for id := range ch {
+				err := res.restorePack(ctx, id, packs[id])
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+
+	return wg.Wait()
+}
+
+// verifyFile reads the file again and checks that the content matches the
+// blobs of the node. Blobs which were replaced with zeros are skipped.
+func (res *Restorer) verifyFile(file *restoreFile) error {
+	f, err := fs.OpenFile(file.target, os.O_RDONLY, 0)
+	if err != nil {
+		return errors.Wrap(err, "Open")
+	}
+	defer f.Close()
+
+	var buf []byte
+	for _, b := range file.blobs {
+		if _, ok := file.replaced[b.offset]; ok {
+			continue
+		}
+
+		if cap(buf) < int(b.length) {
+			buf = make([]byte, b.length)
+		}
+		buf = buf[:b.length]
+
+		_, err = f.ReadAt(buf, int64(b.offset))
+		if err != nil {
+			return errors.Wrap(err, "ReadAt")
+		}
+
+		if !Hash(buf).Equal(b.id) {
+			return errors.Errorf("verification failed, content at offset %d does not match blob %v", b.offset, b.id.Str())
+		}
+	}
+
+	return nil
+}
+
+// finishFiles verifies the files if requested and restores their metadata
+// after the content has been written.
+func (res *Restorer) finishFiles() error {
+	for _, file := range res.files {
+		res.Progress.Report(Stat{Files: 1})
+		if file.failed {
+			continue
+		}
+
+		var err error
+		if res.Verify && file.blobs != nil {
+			err = res.verifyFile(file)
+		}
+
+		if err == nil {
+			err = file.node.restoreMetadata(file.target)
+			if err != nil {
+				debug.Log("restoreMetadata(%s) error %v", file.target, err)
+			}
+		}
+
+		if err != nil {
+			err = res.Error(file.location, file.node, err)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
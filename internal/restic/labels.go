@@ -0,0 +1,60 @@
+package restic
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/restic/restic/internal/errors"
+)
+
+// Labels are key=value pairs attached to a snapshot. In contrast to tags,
+// each key has exactly one value.
+type Labels map[string]string
+
+func (l Labels) String() string {
+	pairs := make([]string, 0, len(l))
+	for k, v := range l {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", k, v))
+	}
+	sort.Strings(pairs)
+
+	return "[" + strings.Join(pairs, ", ") + "]"
+}
+
+// Set adds the label in the format "key=value", an existing label with the
+// same key is replaced.
+func (l *Labels) Set(s string) error {
+	pos := strings.Index(s, "=")
+	if pos < 0 {
+		return errors.Errorf("invalid label %q, must be in the format key=value", s)
+	}
+
+	key := strings.TrimSpace(s[:pos])
+	if key == "" {
+		return errors.Errorf("invalid label %q, the key is empty", s)
+	}
+
+	if *l == nil {
+		*l = make(Labels)
+	}
+	(*l)[key] = s[pos+1:]
+	return nil
+}
+
+// Type returns a description of the type.
+func (Labels) Type() string {
+	return "Labels"
+}
+
+// HasLabels returns true if the snapshot has all labels with the same
+// values.
+func (sn *Snapshot) HasLabels(l Labels) bool {
+	for k, v := range l {
+		if value, ok := sn.Labels[k]; !ok || value != v {
+			return false
+		}
+	}
+
+	return true
+}
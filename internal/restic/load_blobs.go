@@ -0,0 +1,216 @@
+package restic
+
+import (
+	"context"
+	"runtime"
+
+	"github.com/restic/restic/internal/errors"
+	"golang.org/x/sync/errgroup"
+)
+
+// loadDataBlob loads and decrypts the data blob id, buf is reused if it is
+// large enough.
+func loadDataBlob(ctx context.Context, repo Repository, id ID, buf []byte) ([]byte, error) {
+	size, found := repo.LookupBlobSize(id, DataBlob)
+	if !found {
+		return nil, errors.Errorf("id %v not found in repository", id)
+	}
+
+	buf = buf[:cap(buf)]
+	if len(buf) < CiphertextLength(int(size)) {
+		buf = NewBlobBuffer(int(size))
+	}
+
+	n, err := repo.LoadBlob(ctx, DataBlob, id, buf)
+	if err != nil {
+		return nil, err
+	}
+
+	return buf[:n], nil
+}
+
+// DamagedBlob describes a data blob which could not be loaded, e.g. because
+// the data in the repository is corrupted.
+type DamagedBlob struct {
+	ID     ID
+	Offset uint64 // offset of the blob's plaintext within the data passed to fn
+	Length uint64 // length of the blob's plaintext
+	Err    error
+}
+
+// LoadDataBlobs loads the data blobs in ids and calls fn with the plaintext of
+// each blob, in the order of ids. Up to GOMAXPROCS blobs are loaded and
+// decrypted concurrently, so that restoring large files is not limited by the
+// speed of a single core. The buffer passed to fn must not be used after fn
+// has returned.
+func LoadDataBlobs(ctx context.Context, repo Repository, ids IDs, fn func(data []byte) error) error {
+	return LoadDataBlobsReplaceDamaged(ctx, repo, ids, fn, nil)
+}
+
+// LoadDataBlobsReplaceDamaged works like LoadDataBlobs, but when a blob cannot
+// be loaded, damaged is called (if it is not nil). If damaged returns nil, fn
+// is called with zeros instead of the blob's plaintext and loading continues.
+// Blobs which are not contained in the index cannot be replaced, because their
+// length is unknown.
+func LoadDataBlobsReplaceDamaged(ctx context.Context, repo Repository, ids IDs, fn func(data []byte) error, damaged func(DamagedBlob) error) error {
+	var offset uint64
+
+	// replace handles the error err which occurred while loading the blob id,
+	// it returns a buffer filled with zeros on success
+	replace := func(id ID, err error, buf []byte) ([]byte, error) {
+		if damaged == nil || ctx.Err() != nil {
+			return nil, err
+		}
+
+		size, found := repo.LookupBlobSize(id, DataBlob)
+		if !found {
+			return nil, err
+		}
+
+		length := int(size)
+		err = damaged(DamagedBlob{ID: id, Offset: offset, Length: uint64(length), Err: err})
+		if err != nil {
+			return nil, err
+		}
+
+		if cap(buf) < length {
+			buf = make([]byte, length)
+		}
+		buf = buf[:length]
+		for i := range buf {
+			buf[i] = 0
+		}
+
+		return buf, nil
+	}
+
+	// process passes the blob to fn and keeps track of the offset
+	process := func(buf []byte) error {
+		offset += uint64(len(buf))
+		return fn(buf)
+	}
+
+	workers := runtime.GOMAXPROCS(0)
+	if workers > len(ids) {
+		workers = len(ids)
+	}
+
+	if workers <= 1 {
+		var buf []byte
+		for _, id := range ids {
+			data, err := loadDataBlob(ctx, repo, id, buf)
+			if err != nil {
+				data, err = replace(id, err, buf)
+				if err != nil {
+					return err
+				}
+			}
+			buf = data
+
+			err = process(buf)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	type result struct {
+		id  ID
+		buf []byte
+		err error
+	}
+
+	type job struct {
+		id  ID
+		res chan result
+	}
+
+	g, ctx := errgroup.WithContext(ctx)
+	jobs := make(chan job)
+
+	// pending holds the result channels in the order of ids, its capacity
+	// limits the number of decrypted blobs held in memory
+	pending := make(chan chan result, workers)
+
+	// buffers which can be reused by the workers
+	free := make(chan []byte, workers+1)
+
+	// start producer
+	g.Go(func() error {
+		defer close(jobs)
+		defer close(pending)
+
+		for _, id := range ids {
+			res := make(chan result, 1)
+			select {
+			case pending <- res:
+			case <-ctx.Done():
+				return nil
+			}
+
+			select {
+			case jobs <- job{id: id, res: res}:
+			case <-ctx.Done():
+				return nil
+			}
+		}
+		return nil
+	})
+
+	// run workers
+	for i := 0; i < workers; i++ {
+		g.Go(func() error {
+			for j := range jobs {
+				var buf []byte
+				select {
+				case buf = <-free:
+				default:
+				}
+
+				buf, err := loadDataBlob(ctx, repo, j.id, buf)
+				if err != nil && damaged == nil {
+					return err
+				}
+
+				// res is buffered, this never blocks
+				j.res <- result{id: j.id, buf: buf, err: err}
+			}
+			return nil
+		})
+	}
+
+	// pass the blobs to fn in order
+	g.Go(func() error {
+		for res := range pending {
+			var r result
+			select {
+			case r = <-res:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+
+			buf := r.buf
+			if r.err != nil {
+				var err error
+				buf, err = replace(r.id, r.err, nil)
+				if err != nil {
+					return err
+				}
+			}
+
+			err := process(buf)
+			if err != nil {
+				return err
+			}
+
+			select {
+			case free <- buf:
+			default:
+			}
+		}
+		return nil
+	})
+
+	return g.Wait()
+}
@@ -0,0 +1,226 @@
+package restic_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"runtime"
+	"testing"
+
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestLoadDataBlobs(t *testing.T) {
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var (
+		ids  restic.IDs
+		want []byte
+	)
+
+	for i := 0; i < 50; i++ {
+		data := rtest.Random(i, 1000+i*100)
+		id, err := repo.SaveBlob(ctx, restic.DataBlob, data, restic.ID{})
+		rtest.OK(t, err)
+
+		ids = append(ids, id)
+		want = append(want, data...)
+	}
+
+	// use a blob more than once
+	ids = append(ids, ids[3])
+	want = append(want, rtest.Random(3, 1300)...)
+
+	rtest.OK(t, repo.Flush(ctx))
+
+	for _, procs := range []int{1, 4} {
+		t.Run(fmt.Sprintf("procs-%d", procs), func(t *testing.T) {
+			defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(procs))
+			testLoadDataBlobs(t, repo, ids, want)
+		})
+	}
+}
+
+func testLoadDataBlobs(t *testing.T, repo restic.Repository, ids restic.IDs, want []byte) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	for _, n := range []int{0, 1, 2, len(ids)} {
+		buf := bytes.NewBuffer(nil)
+		err := restic.LoadDataBlobs(ctx, repo, ids[:n], func(data []byte) error {
+			_, err := buf.Write(data)
+			return err
+		})
+		rtest.OK(t, err)
+
+		var length int
+		for _, id := range ids[:n] {
+			size, _ := repo.LookupBlobSize(id, restic.DataBlob)
+			length += int(size)
+		}
+
+		if !bytes.Equal(buf.Bytes(), want[:length]) {
+			t.Errorf("wrong data returned for %d blobs", n)
+		}
+	}
+
+	// errors returned by fn abort the process
+	errTest := errors.New("test error")
+	calls := 0
+	err := restic.LoadDataBlobs(ctx, repo, ids, func(data []byte) error {
+		calls++
+		if calls == 5 {
+			return errTest
+		}
+		return nil
+	})
+	rtest.Equals(t, errTest, err)
+	rtest.Equals(t, 5, calls)
+
+	// a missing blob is reported
+	err = restic.LoadDataBlobs(ctx, repo, append(restic.IDs{restic.NewRandomID()}, ids...), func([]byte) error {
+		return nil
+	})
+	rtest.Assert(t, err != nil, "expected error for missing blob not returned")
+}
+
+// damagedRepo is a repository where loading some blobs fails.
+type damagedRepo struct {
+	restic.Repository
+	damaged restic.IDSet
+}
+
+func (r damagedRepo) LoadBlob(ctx context.Context, t restic.BlobType, id restic.ID, buf []byte) (int, error) {
+	if r.damaged.Has(id) {
+		return 0, errors.New("blob is damaged")
+	}
+	return r.Repository.LoadBlob(ctx, t, id, buf)
+}
+
+// Backend returns a backend which corrupts the damaged blobs, so they cannot
+// be taken from the pack files either.
+func (r damagedRepo) Backend() restic.Backend {
+	return damagedBackend{Backend: r.Repository.Backend(), repo: r}
+}
+
+type damagedBackend struct {
+	restic.Backend
+	repo damagedRepo
+}
+
+func (be damagedBackend) Load(ctx context.Context, h restic.Handle, length int, offset int64) (io.ReadCloser, error) {
+	rd, err := be.Backend.Load(ctx, h, length, offset)
+	if err != nil || h.Type != restic.DataFile {
+		return rd, err
+	}
+
+	buf, err := ioutil.ReadAll(rd)
+	_ = rd.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	for id := range be.repo.damaged {
+		list, _ := be.repo.Index().Lookup(id, restic.DataBlob)
+		for _, pb := range list {
+			if pb.PackID.String() != h.Name {
+				continue
+			}
+
+			for i := int64(pb.Offset); i < int64(pb.Offset+pb.Length); i++ {
+				if i >= offset && i-offset < int64(len(buf)) {
+					buf[i-offset] ^= 0xff
+				}
+			}
+		}
+	}
+
+	return ioutil.NopCloser(bytes.NewReader(buf)), nil
+}
+
+func TestLoadDataBlobsReplaceDamaged(t *testing.T) {
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var (
+		ids  restic.IDs
+		want []byte
+	)
+
+	damaged := restic.NewIDSet()
+	var wantDamaged []restic.DamagedBlob
+
+	for i := 0; i < 20; i++ {
+		data := rtest.Random(i, 1000+i*100)
+		id, err := repo.SaveBlob(ctx, restic.DataBlob, data, restic.ID{})
+		rtest.OK(t, err)
+
+		if i%7 == 3 {
+			damaged.Insert(id)
+			wantDamaged = append(wantDamaged, restic.DamagedBlob{
+				ID:     id,
+				Offset: uint64(len(want)),
+				Length: uint64(len(data)),
+			})
+			data = make([]byte, len(data))
+		}
+
+		ids = append(ids, id)
+		want = append(want, data...)
+	}
+
+	rtest.OK(t, repo.Flush(ctx))
+
+	drepo := damagedRepo{Repository: repo, damaged: damaged}
+
+	for _, procs := range []int{1, 4} {
+		t.Run(fmt.Sprintf("procs-%d", procs), func(t *testing.T) {
+			defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(procs))
+
+			// without a function for damaged blobs, the error is returned
+			err := restic.LoadDataBlobs(ctx, drepo, ids, func([]byte) error {
+				return nil
+			})
+			rtest.Assert(t, err != nil, "expected error for damaged blob not returned")
+
+			buf := bytes.NewBuffer(nil)
+			var reported []restic.DamagedBlob
+			err = restic.LoadDataBlobsReplaceDamaged(ctx, drepo, ids, func(data []byte) error {
+				_, err := buf.Write(data)
+				return err
+			}, func(blob restic.DamagedBlob) error {
+				rtest.Assert(t, blob.Err != nil, "no error passed for damaged blob %v", blob.ID.Str())
+				blob.Err = nil
+				reported = append(reported, blob)
+				return nil
+			})
+			rtest.OK(t, err)
+
+			rtest.Equals(t, wantDamaged, reported)
+			if !bytes.Equal(buf.Bytes(), want) {
+				t.Errorf("wrong data returned")
+			}
+
+			// errors returned for damaged blobs abort the process
+			errTest := errors.New("test error")
+			err = restic.LoadDataBlobsReplaceDamaged(ctx, drepo, ids, func([]byte) error {
+				return nil
+			}, func(restic.DamagedBlob) error {
+				return errTest
+			})
+			rtest.Equals(t, errTest, err)
+		})
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"os"
 	"os/signal"
 	"os/user"
+	"sort"
 	"sync"
 	"syscall"
 	"testing"
@@ -33,6 +34,11 @@ type Lock struct {
 	UID       uint32    `json:"uid,omitempty"`
 	GID       uint32    `json:"gid,omitempty"`
 
+	// Operation and Paths describe what the process does, they are set for
+	// locks created by NewOperationLock.
+	Operation string   `json:"operation,omitempty"`
+	Paths     []string `json:"paths,omitempty"`
+
 	repo   Repository
 	lockID *ID
 }
@@ -47,6 +53,10 @@ func (e ErrAlreadyLocked) Error() string {
 	return fmt.Sprintf("repository is already locked by %v", e.otherLock)
 }
 
+// ErrLockRemoved is returned by Refresh when the lock was removed by another
+// process, e.g. because it was considered stale.
+var ErrLockRemoved = errors.New("lock was removed by another process")
+
 // IsAlreadyLocked returns true iff err is an instance of ErrAlreadyLocked.
 func IsAlreadyLocked(err error) bool {
 	if _, ok := errors.Cause(err).(ErrAlreadyLocked); ok {
@@ -60,14 +70,27 @@ func IsAlreadyLocked(err error) bool {
 // exclusive lock is already held by another process, ErrAlreadyLocked is
 // returned.
 func NewLock(ctx context.Context, repo Repository) (*Lock, error) {
-	return newLock(ctx, repo, false)
+	return newLock(ctx, repo, false, nil)
 }
 
 // NewExclusiveLock returns a new, exclusive lock for the repository. If
 // another lock (normal and exclusive) is already held by another process,
 // ErrAlreadyLocked is returned.
 func NewExclusiveLock(ctx context.Context, repo Repository) (*Lock, error) {
-	return newLock(ctx, repo, true)
+	return newLock(ctx, repo, true, nil)
+}
+
+// NewOperationLock returns a new, non-exclusive lock which records that the
+// operation op is run on paths. Other processes can find it with Concurrent.
+func NewOperationLock(ctx context.Context, repo Repository, op string, paths []string) (*Lock, error) {
+	p := make([]string, len(paths))
+	copy(p, paths)
+	sort.Strings(p)
+
+	return newLock(ctx, repo, false, func(l *Lock) {
+		l.Operation = op
+		l.Paths = p
+	})
 }
 
 var waitBeforeLockCheck = 200 * time.Millisecond
@@ -78,7 +101,7 @@ func TestSetLockTimeout(t testing.TB, d time.Duration) {
 	waitBeforeLockCheck = d
 }
 
-func newLock(ctx context.Context, repo Repository, excl bool) (*Lock, error) {
+func newLock(ctx context.Context, repo Repository, excl bool, setInfo func(*Lock)) (*Lock, error) {
 	lock := &Lock{
 		Time:      time.Now(),
 		PID:       os.Getpid(),
@@ -86,6 +109,10 @@ func newLock(ctx context.Context, repo Repository, excl bool) (*Lock, error) {
 		repo:      repo,
 	}
 
+	if setInfo != nil {
+		setInfo(lock)
+	}
+
 	hn, err := os.Hostname()
 	if err == nil {
 		lock.Hostname = hn
@@ -156,6 +183,69 @@ func (l *Lock) checkForOtherLocks(ctx context.Context) error {
 	})
 }
 
+// Concurrent returns the locks of other processes on the same host which run
+// the same operation on the same paths and were created before l. Locks of
+// processes which do not exist any more are ignored. Since only older locks are
+// returned, of several processes started at the same time exactly one finds no
+// concurrent locks.
+func (l *Lock) Concurrent(ctx context.Context) ([]*Lock, error) {
+	if l.Operation == "" {
+		return nil, nil
+	}
+
+	var locks []*Lock
+	err := eachLock(ctx, l.repo, func(id ID, lock *Lock, err error) error {
+		if err != nil || (l.lockID != nil && id.Equal(*l.lockID)) {
+			return nil
+		}
+
+		if lock.Operation != l.Operation || lock.Hostname != l.Hostname || !sameStrings(lock.Paths, l.Paths) {
+			return nil
+		}
+
+		// the lock is on this host, so whether the process still exists can
+		// be checked directly, long operations do not become stale
+		if !lock.olderThan(l) || !lock.processExists() {
+			return nil
+		}
+
+		debug.Log("found concurrent lock %v for %v", id.Str(), lock.Operation)
+		locks = append(locks, lock)
+		return nil
+	})
+
+	return locks, err
+}
+
+// olderThan returns true if l was created before other. Locks created at the
+// same time are ordered by their ID.
+func (l *Lock) olderThan(other *Lock) bool {
+	if !l.Time.Equal(other.Time) {
+		return l.Time.Before(other.Time)
+	}
+
+	if l.lockID == nil || other.lockID == nil {
+		return false
+	}
+
+	return l.lockID.String() < other.lockID.String()
+}
+
+// sameStrings returns true if the sorted lists a and b are equal.
+func sameStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
 func eachLock(ctx context.Context, repo Repository, f func(ID, *Lock, error) error) error {
 	return repo.List(ctx, LockFile, func(id ID, size int64) error {
 		lock, err := LoadLock(ctx, repo, id)
@@ -186,14 +276,20 @@ func (l *Lock) Unlock() error {
 	return l.repo.Backend().Remove(context.TODO(), Handle{Type: LockFile, Name: l.lockID.String()})
 }
 
-var staleTimeout = 30 * time.Minute
+// StaleLockTimeout is the age after which a lock which has not been refreshed
+// is considered stale.
+var StaleLockTimeout = 30 * time.Minute
 
 // Stale returns true if the lock is stale. A lock is stale if the timestamp is
-// older than 30 minutes or if it was created on the current machine and the
-// process isn't alive any more.
+// older than StaleLockTimeout or if it was created on the current machine and
+// the process isn't alive any more.
+//
+// The timestamp is set by the clock of the host which created the lock. A
+// timestamp in the future is never considered too old, so a lock of a host
+// whose clock is ahead stays valid until the local clock passes it.
 func (l *Lock) Stale() bool {
 	debug.Log("testing if lock %v for process %d is stale", l, l.PID)
-	if time.Since(l.Time) > staleTimeout {
+	if l.OlderThan(StaleLockTimeout) {
 		debug.Log("lock is stale, timestamp is too old: %v\n", l.Time)
 		return true
 	}
@@ -222,10 +318,28 @@ func (l *Lock) Stale() bool {
 	return false
 }
 
+// OlderThan returns true if the timestamp of the lock is more than age in the
+// past.
+func (l *Lock) OlderThan(age time.Duration) bool {
+	return time.Since(l.Time) > age
+}
+
 // Refresh refreshes the lock by creating a new file in the backend with a new
-// timestamp. Afterwards the old lock is removed.
+// timestamp. Afterwards the old lock is removed. If the old lock does not
+// exist any more, no new lock is created and ErrLockRemoved is returned.
 func (l *Lock) Refresh(ctx context.Context) error {
 	debug.Log("refreshing lock %v", l.lockID.Str())
+	exists, err := l.repo.Backend().Test(ctx, Handle{Type: LockFile, Name: l.lockID.String()})
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		debug.Log("lock %v was removed", l.lockID.Str())
+		return ErrLockRemoved
+	}
+
+	l.Time = time.Now()
 	id, err := l.createLock(ctx)
 	if err != nil {
 		return err
@@ -248,6 +362,10 @@ func (l Lock) String() string {
 		l.Time.Format("2006-01-02 15:04:05"), time.Since(l.Time),
 		l.lockID.Str())
 
+	if l.Operation != "" {
+		text += fmt.Sprintf("\noperation %v", l.Operation)
+	}
+
 	return text
 }
 
@@ -299,3 +417,16 @@ func RemoveAllLocks(ctx context.Context, repo Repository) error {
 		return repo.Backend().Remove(context.TODO(), Handle{Type: LockFile, Name: id.String()})
 	})
 }
+
+// RemoveLocksOlderThan removes all locks with a timestamp more than age in
+// the past, regardless of the host and process which created them.
+func RemoveLocksOlderThan(ctx context.Context, repo Repository, age time.Duration) error {
+	return eachLock(ctx, repo, func(id ID, lock *Lock, err error) error {
+		// ignore locks that cannot be loaded
+		if err != nil || !lock.OlderThan(age) {
+			return nil
+		}
+
+		return repo.Backend().Remove(context.TODO(), Handle{Type: LockFile, Name: id.String()})
+	})
+}
@@ -137,6 +137,34 @@ var staleLockTests = []struct {
 		staleOnOtherHost: false,
 		pid:              os.Getpid() + 500000,
 	},
+	// the clock of the other host is behind, but not by more than the
+	// stale timeout
+	{
+		timestamp:        time.Now().Add(-29 * time.Minute),
+		stale:            false,
+		staleOnOtherHost: false,
+		pid:              os.Getpid(),
+	},
+	{
+		timestamp:        time.Now().Add(-31 * time.Minute),
+		stale:            true,
+		staleOnOtherHost: true,
+		pid:              os.Getpid(),
+	},
+	// the clock of the other host is far ahead, the lock is not stale until
+	// the local clock passes its timestamp
+	{
+		timestamp:        time.Now().Add(2 * time.Hour),
+		stale:            false,
+		staleOnOtherHost: false,
+		pid:              os.Getpid(),
+	},
+	{
+		timestamp:        time.Now().Add(2 * time.Hour),
+		stale:            true,
+		staleOnOtherHost: false,
+		pid:              os.Getpid() + 500000,
+	},
 }
 
 func TestLockStale(t *testing.T) {
@@ -219,6 +247,47 @@ func TestRemoveAllLocks(t *testing.T) {
 		"lock still exists after RemoveAllLocks was called")
 }
 
+func TestRemoveLocksOlderThan(t *testing.T) {
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+
+	id1, err := createFakeLock(repo, time.Now().Add(-3*time.Hour), os.Getpid())
+	rtest.OK(t, err)
+
+	id2, err := createFakeLock(repo, time.Now().Add(-time.Hour), os.Getpid()+500000)
+	rtest.OK(t, err)
+
+	// a lock of a host whose clock is ahead
+	id3, err := createFakeLock(repo, time.Now().Add(3*time.Hour), os.Getpid())
+	rtest.OK(t, err)
+
+	rtest.OK(t, restic.RemoveLocksOlderThan(context.TODO(), repo, 2*time.Hour))
+
+	rtest.Assert(t, !lockExists(repo, t, id1), "old lock still exists")
+	rtest.Assert(t, lockExists(repo, t, id2), "recent lock was removed")
+	rtest.Assert(t, lockExists(repo, t, id3), "lock with a timestamp in the future was removed")
+
+	rtest.OK(t, restic.RemoveAllLocks(context.TODO(), repo))
+}
+
+func TestLockRefreshRemoved(t *testing.T) {
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+
+	lock, err := restic.NewLock(context.TODO(), repo)
+	rtest.OK(t, err)
+
+	rtest.OK(t, restic.RemoveAllLocks(context.TODO(), repo))
+	rtest.Equals(t, restic.ErrLockRemoved, lock.Refresh(context.TODO()))
+
+	var found bool
+	rtest.OK(t, repo.List(context.TODO(), restic.LockFile, func(id restic.ID, size int64) error {
+		found = true
+		return nil
+	}))
+	rtest.Assert(t, !found, "a new lock was created for a removed lock")
+}
+
 func TestLockRefresh(t *testing.T) {
 	repo, cleanup := repository.TestRepository(t)
 	defer cleanup()
@@ -238,6 +307,8 @@ func TestLockRefresh(t *testing.T) {
 		t.Fatal(err)
 	}
 
+	created := lock.Time
+	time.Sleep(10 * time.Millisecond)
 	rtest.OK(t, lock.Refresh(context.TODO()))
 
 	var lockID2 *restic.ID
@@ -254,5 +325,50 @@ func TestLockRefresh(t *testing.T) {
 
 	rtest.Assert(t, !lockID.Equal(*lockID2),
 		"expected a new ID after lock refresh, got the same")
+
+	refreshed, err := restic.LoadLock(context.TODO(), repo, *lockID2)
+	rtest.OK(t, err)
+	rtest.Assert(t, refreshed.Time.After(created),
+		"timestamp %v of the refreshed lock is not newer than %v", refreshed.Time, created)
+
 	rtest.OK(t, lock.Unlock())
 }
+
+func TestLockConcurrent(t *testing.T) {
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+
+	lock1, err := restic.NewOperationLock(context.TODO(), repo, "backup", []string{"/home", "/etc"})
+	rtest.OK(t, err)
+
+	lock2, err := restic.NewOperationLock(context.TODO(), repo, "backup", []string{"/etc", "/home"})
+	rtest.OK(t, err)
+
+	other, err := restic.NewOperationLock(context.TODO(), repo, "backup", []string{"/etc"})
+	rtest.OK(t, err)
+
+	plain, err := restic.NewLock(context.TODO(), repo)
+	rtest.OK(t, err)
+
+	// only the newer lock for the same paths finds the older one
+	locks, err := lock2.Concurrent(context.TODO())
+	rtest.OK(t, err)
+	rtest.Equals(t, 1, len(locks))
+	rtest.Equals(t, lock1.Time.UnixNano(), locks[0].Time.UnixNano())
+
+	for _, lock := range []*restic.Lock{lock1, other, plain} {
+		locks, err = lock.Concurrent(context.TODO())
+		rtest.OK(t, err)
+		rtest.Equals(t, 0, len(locks))
+	}
+
+	rtest.OK(t, lock1.Unlock())
+
+	locks, err = lock2.Concurrent(context.TODO())
+	rtest.OK(t, err)
+	rtest.Equals(t, 0, len(locks))
+
+	rtest.OK(t, lock2.Unlock())
+	rtest.OK(t, other.Unlock())
+	rtest.OK(t, plain.Unlock())
+}
@@ -0,0 +1,136 @@
+package restic
+
+import (
+	"context"
+	"os"
+	"os/user"
+	"time"
+
+	"github.com/restic/restic/internal/debug"
+)
+
+// Manifest status values.
+const (
+	ManifestRunning   = "running"
+	ManifestCompleted = "completed"
+	ManifestFailed    = "failed"
+)
+
+// ManifestEntry records an operation a client has performed on the
+// repository. For each host and operation only the most recent entry is
+// kept, so the manifest shows which client versions access the repository and
+// whether the last run of an operation completed successfully.
+type ManifestEntry struct {
+	Time      time.Time `json:"time"`
+	Finished  time.Time `json:"finished,omitempty"`
+	Operation string    `json:"operation"`
+	Status    string    `json:"status"`
+	Version   string    `json:"version"`
+	Hostname  string    `json:"hostname"`
+	Username  string    `json:"username"`
+	PID       int       `json:"pid"`
+
+	repo Repository
+	id   *ID
+}
+
+// StartOperation saves a new manifest entry for the operation op with the
+// status "running" in the repository. The entry must be updated by calling
+// Finish when the operation has ended.
+func StartOperation(ctx context.Context, repo Repository, op, version string) (*ManifestEntry, error) {
+	e := &ManifestEntry{
+		Time:      time.Now(),
+		Operation: op,
+		Status:    ManifestRunning,
+		Version:   version,
+		PID:       os.Getpid(),
+		repo:      repo,
+	}
+
+	hn, err := os.Hostname()
+	if err == nil {
+		e.Hostname = hn
+	}
+
+	usr, err := user.Current()
+	if err == nil {
+		e.Username = usr.Username
+	}
+
+	id, err := repo.SaveJSONUnpacked(ctx, ManifestFile, e)
+	if err != nil {
+		return nil, err
+	}
+	e.id = &id
+
+	debug.Log("saved manifest entry %v for %v", id.Str(), op)
+	return e, nil
+}
+
+// Finish records the result of the operation. Afterwards, all older entries
+// for the same host and operation are removed from the repository.
+func (e *ManifestEntry) Finish(ctx context.Context, opErr error) error {
+	if e == nil || e.id == nil {
+		return nil
+	}
+
+	e.Finished = time.Now()
+	e.Status = ManifestCompleted
+	if opErr != nil {
+		e.Status = ManifestFailed
+	}
+
+	id, err := e.repo.SaveJSONUnpacked(ctx, ManifestFile, e)
+	if err != nil {
+		return err
+	}
+	e.id = &id
+
+	// remove superseded entries, including the "running" one saved before
+	return eachManifestEntry(ctx, e.repo, func(other *ManifestEntry) error {
+		if other.id.Equal(id) || other.Hostname != e.Hostname || other.Operation != e.Operation {
+			return nil
+		}
+
+		if other.Time.After(e.Time) {
+			return nil
+		}
+
+		debug.Log("removing superseded manifest entry %v", other.id.Str())
+		return e.repo.Backend().Remove(ctx, Handle{Type: ManifestFile, Name: other.id.String()})
+	})
+}
+
+// ID returns the ID of the file the entry is stored in.
+func (e ManifestEntry) ID() *ID {
+	return e.id
+}
+
+func eachManifestEntry(ctx context.Context, repo Repository, fn func(*ManifestEntry) error) error {
+	return repo.List(ctx, ManifestFile, func(id ID, size int64) error {
+		e := &ManifestEntry{}
+		if err := repo.LoadJSONUnpacked(ctx, ManifestFile, id, e); err != nil {
+			// ignore entries that cannot be loaded
+			debug.Log("unable to load manifest entry %v: %v", id.Str(), err)
+			return nil
+		}
+
+		e.repo = repo
+		e.id = &id
+		return fn(e)
+	})
+}
+
+// LoadManifest returns all entries of the repository manifest.
+func LoadManifest(ctx context.Context, repo Repository) (entries []*ManifestEntry, err error) {
+	err = eachManifestEntry(ctx, repo, func(e *ManifestEntry) error {
+		entries = append(entries, e)
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
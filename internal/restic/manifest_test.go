@@ -0,0 +1,58 @@
+package restic_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestManifest(t *testing.T) {
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+
+	entries, err := restic.LoadManifest(context.TODO(), repo)
+	rtest.OK(t, err)
+	rtest.Equals(t, 0, len(entries))
+
+	e, err := restic.StartOperation(context.TODO(), repo, "backup", "test")
+	rtest.OK(t, err)
+
+	entries, err = restic.LoadManifest(context.TODO(), repo)
+	rtest.OK(t, err)
+	rtest.Equals(t, 1, len(entries))
+	rtest.Equals(t, restic.ManifestRunning, entries[0].Status)
+	rtest.Equals(t, "test", entries[0].Version)
+
+	rtest.OK(t, e.Finish(context.TODO(), nil))
+
+	entries, err = restic.LoadManifest(context.TODO(), repo)
+	rtest.OK(t, err)
+	rtest.Equals(t, 1, len(entries))
+	rtest.Equals(t, restic.ManifestCompleted, entries[0].Status)
+
+	// a failed run of the same operation replaces the previous entry
+	e, err = restic.StartOperation(context.TODO(), repo, "backup", "test")
+	rtest.OK(t, err)
+	rtest.OK(t, e.Finish(context.TODO(), errors.New("failed")))
+
+	// other operations are recorded separately
+	e, err = restic.StartOperation(context.TODO(), repo, "prune", "test")
+	rtest.OK(t, err)
+	rtest.OK(t, e.Finish(context.TODO(), nil))
+
+	entries, err = restic.LoadManifest(context.TODO(), repo)
+	rtest.OK(t, err)
+	rtest.Equals(t, 2, len(entries))
+
+	status := make(map[string]string)
+	for _, e := range entries {
+		status[e.Operation] = e.Status
+	}
+
+	rtest.Equals(t, restic.ManifestFailed, status["backup"])
+	rtest.Equals(t, restic.ManifestCompleted, status["prune"])
+}
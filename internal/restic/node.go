@@ -20,7 +20,9 @@ import (
 	"github.com/restic/restic/internal/fs"
 )
 
-// ExtendedAttribute is a tuple storing the xattr name and value.
+// ExtendedAttribute is a tuple storing the xattr name and value. On Linux,
+// POSIX ACLs are stored as the extended attributes system.posix_acl_access
+// and system.posix_acl_default.
 type ExtendedAttribute struct {
 	Name  string `json:"name"`
 	Value []byte `json:"value"`
@@ -44,7 +46,8 @@ type Node struct {
 	Links              uint64              `json:"links,omitempty"`
 	LinkTarget         string              `json:"linktarget,omitempty"`
 	ExtendedAttributes []ExtendedAttribute `json:"extended_attributes,omitempty"`
-	Device             uint64              `json:"device,omitempty"` // in case of Type == "dev", stat.st_rdev
+	SecurityDescriptor []byte              `json:"security_descriptor,omitempty"` // owner, group and DACL on Windows
+	Device             uint64              `json:"device,omitempty"`              // in case of Type == "dev", stat.st_rdev
 	Content            IDs                 `json:"content"`
 	Subtree            *ID                 `json:"subtree,omitempty"`
 
@@ -136,6 +139,12 @@ func (node Node) GetExtendedAttribute(a string) []byte {
 
 // CreateAt creates the node at the given path and restores all the meta data.
 func (node *Node) CreateAt(ctx context.Context, path string, repo Repository, idx *HardlinkIndex) error {
+	return node.createAt(ctx, path, repo, idx, nil)
+}
+
+// createAt works like CreateAt, damaged is passed to
+// LoadDataBlobsReplaceDamaged when the content of a file is restored.
+func (node *Node) createAt(ctx context.Context, path string, repo Repository, idx *HardlinkIndex, damaged func(DamagedBlob) error) error {
 	debug.Log("create node %v at %v", node.Name, path)
 
 	switch node.Type {
@@ -144,7 +153,7 @@ func (node *Node) CreateAt(ctx context.Context, path string, repo Repository, id
 			return err
 		}
 	case "file":
-		if err := node.createFileAt(ctx, path, repo, idx); err != nil {
+		if err := node.createFileAt(ctx, path, repo, idx, damaged); err != nil {
 			return err
 		}
 	case "symlink":
@@ -186,7 +195,7 @@ func (node Node) restoreMetadata(path string) error {
 
 	if node.Type != "symlink" {
 		if err := fs.Chmod(path, node.Mode); err != nil {
-			if firsterr != nil {
+			if firsterr == nil {
 				firsterr = errors.Wrap(err, "Chmod")
 			}
 		}
@@ -195,7 +204,7 @@ func (node Node) restoreMetadata(path string) error {
 	if node.Type != "dir" {
 		if err := node.RestoreTimestamps(path); err != nil {
 			debug.Log("error restoring timestamps for dir %v: %v", path, err)
-			if firsterr != nil {
+			if firsterr == nil {
 				firsterr = err
 			}
 		}
@@ -203,7 +212,14 @@ func (node Node) restoreMetadata(path string) error {
 
 	if err := node.restoreExtendedAttributes(path); err != nil {
 		debug.Log("error restoring extended attributes for %v: %v", path, err)
-		if firsterr != nil {
+		if firsterr == nil {
+			firsterr = err
+		}
+	}
+
+	if err := node.restoreSecurityDescriptor(path); err != nil {
+		debug.Log("error restoring security descriptor for %v: %v", path, err)
+		if firsterr == nil {
 			firsterr = err
 		}
 	}
@@ -211,14 +227,36 @@ func (node Node) restoreMetadata(path string) error {
 	return firsterr
 }
 
+// restoreExtendedAttributes sets all extended attributes of node on path,
+// even if some of them cannot be set. The first error is returned.
 func (node Node) restoreExtendedAttributes(path string) error {
+	var firsterr error
 	for _, attr := range node.ExtendedAttributes {
 		err := Setxattr(path, attr.Name, attr.Value)
 		if err != nil {
-			return err
+			debug.Log("unable to set extended attribute %v for %v: %v", attr.Name, path, err)
+			if firsterr == nil {
+				firsterr = err
+			}
 		}
 	}
-	return nil
+	return firsterr
+}
+
+// FilterExtendedAttributes removes the extended attributes for which keep
+// returns false.
+func (node *Node) FilterExtendedAttributes(keep func(name string) bool) {
+	if keep == nil || len(node.ExtendedAttributes) == 0 {
+		return
+	}
+
+	attrs := node.ExtendedAttributes[:0]
+	for _, attr := range node.ExtendedAttributes {
+		if keep(attr.Name) {
+			attrs = append(attrs, attr)
+		}
+	}
+	node.ExtendedAttributes = attrs
 }
 
 func (node Node) RestoreTimestamps(path string) error {
@@ -247,7 +285,7 @@ func (node Node) createDirAt(path string) error {
 	return nil
 }
 
-func (node Node) createFileAt(ctx context.Context, path string, repo Repository, idx *HardlinkIndex) error {
+func (node Node) createFileAt(ctx context.Context, path string, repo Repository, idx *HardlinkIndex, damaged func(DamagedBlob) error) error {
 	if node.Links > 1 && idx.Has(node.Inode, node.DeviceID) {
 		if err := fs.Remove(path); !os.IsNotExist(err) {
 			return errors.Wrap(err, "RemoveCreateHardlink")
@@ -264,7 +302,7 @@ func (node Node) createFileAt(ctx context.Context, path string, repo Repository,
 		return errors.Wrap(err, "OpenFile")
 	}
 
-	err = node.writeNodeContent(ctx, repo, f)
+	err = node.writeNodeContent(ctx, repo, f, damaged)
 	closeErr := f.Close()
 
 	if err != nil {
@@ -282,32 +320,11 @@ func (node Node) createFileAt(ctx context.Context, path string, repo Repository,
 	return nil
 }
 
-func (node Node) writeNodeContent(ctx context.Context, repo Repository, f *os.File) error {
-	var buf []byte
-	for _, id := range node.Content {
-		size, found := repo.LookupBlobSize(id, DataBlob)
-		if !found {
-			return errors.Errorf("id %v not found in repository", id)
-		}
-
-		buf = buf[:cap(buf)]
-		if len(buf) < CiphertextLength(int(size)) {
-			buf = NewBlobBuffer(int(size))
-		}
-
-		n, err := repo.LoadBlob(ctx, DataBlob, id, buf)
-		if err != nil {
-			return err
-		}
-		buf = buf[:n]
-
-		_, err = f.Write(buf)
-		if err != nil {
-			return errors.Wrap(err, "Write")
-		}
-	}
-
-	return nil
+func (node Node) writeNodeContent(ctx context.Context, repo Repository, f *os.File, damaged func(DamagedBlob) error) error {
+	return LoadDataBlobsReplaceDamaged(ctx, repo, node.Content, func(data []byte) error {
+		_, err := f.Write(data)
+		return errors.Wrap(err, "Write")
+	}, damaged)
 }
 
 func (node Node) createSymlinkAt(path string) error {
@@ -430,6 +447,9 @@ func (node Node) Equals(other Node) bool {
 	if !node.sameExtendedAttributes(other) {
 		return false
 	}
+	if !bytes.Equal(node.SecurityDescriptor, other.SecurityDescriptor) {
+		return false
+	}
 	if node.Subtree != nil {
 		if other.Subtree == nil {
 			return false
@@ -517,8 +537,28 @@ func (node Node) sameExtendedAttributes(other Node) bool {
 	return true
 }
 
+// ChangeIgnoreFlags selects the metadata which is not considered by
+// IsNewerIgnoring when it decides whether a file has changed.
+type ChangeIgnoreFlags uint
+
+const (
+	// ChangeIgnoreInode ignores the inode number, which is not stable on
+	// some file systems, e.g. fuse or network file systems.
+	ChangeIgnoreInode ChangeIgnoreFlags = 1 << iota
+
+	// ChangeIgnoreCtime ignores the change time, which is also updated when
+	// only the metadata of a file is modified.
+	ChangeIgnoreCtime
+)
+
 // IsNewer returns true of the file has been updated since the last Stat().
 func (node *Node) IsNewer(path string, fi os.FileInfo) bool {
+	return node.IsNewerIgnoring(path, fi, 0)
+}
+
+// IsNewerIgnoring works like IsNewer, but does not consider the metadata
+// selected by ignore.
+func (node *Node) IsNewerIgnoring(path string, fi os.FileInfo, ignore ChangeIgnoreFlags) bool {
 	if node.Type != "file" {
 		debug.Log("node %v is newer: not file", path)
 		return true
@@ -542,13 +582,18 @@ func (node *Node) IsNewer(path string, fi os.FileInfo) bool {
 		return false
 	}
 
-	inode := extendedStat.ino()
+	if !node.ModTime.Equal(fi.ModTime()) || node.Size != size {
+		debug.Log("node %v is newer: timestamp or size changed", path)
+		return true
+	}
+
+	if ignore&ChangeIgnoreCtime == 0 && !node.ChangeTime.Equal(changeTime(extendedStat)) {
+		debug.Log("node %v is newer: ctime changed", path)
+		return true
+	}
 
-	if !node.ModTime.Equal(fi.ModTime()) ||
-		!node.ChangeTime.Equal(changeTime(extendedStat)) ||
-		node.Inode != uint64(inode) ||
-		node.Size != size {
-		debug.Log("node %v is newer: timestamp, size or inode changed", path)
+	if ignore&ChangeIgnoreInode == 0 && node.Inode != extendedStat.ino() {
+		debug.Log("node %v is newer: inode changed", path)
 		return true
 	}
 
@@ -676,6 +721,10 @@ func (node *Node) fillExtra(path string, fi os.FileInfo) error {
 		return err
 	}
 
+	if err = node.fillSecurityDescriptor(path); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -0,0 +1,106 @@
+package restic
+
+import (
+	"syscall"
+	"unsafe"
+
+	"github.com/restic/restic/internal/errors"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	modadvapi32         = windows.NewLazySystemDLL("advapi32.dll")
+	procGetFileSecurity = modadvapi32.NewProc("GetFileSecurityW")
+	procSetFileSecurity = modadvapi32.NewProc("SetFileSecurityW")
+)
+
+// The parts of a security descriptor which are saved. The system access
+// control list is left out, reading it requires a special privilege.
+const (
+	ownerSecurityInformation = 0x1
+	groupSecurityInformation = 0x2
+	daclSecurityInformation  = 0x4
+
+	securityInformation = ownerSecurityInformation | groupSecurityInformation | daclSecurityInformation
+)
+
+// errorNotSupported is returned by file systems without security
+// descriptors, e.g. FAT.
+const errorNotSupported syscall.Errno = 50
+
+// getFileSecurity returns the self-relative security descriptor of path.
+func getFileSecurity(path string, info uint32) ([]byte, error) {
+	p, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var needed uint32
+	r, _, err := procGetFileSecurity.Call(uintptr(unsafe.Pointer(p)), uintptr(info), 0, 0, uintptr(unsafe.Pointer(&needed)))
+	if r == 0 && err != windows.ERROR_INSUFFICIENT_BUFFER {
+		return nil, err
+	}
+
+	buf := make([]byte, needed)
+	r, _, err = procGetFileSecurity.Call(uintptr(unsafe.Pointer(p)), uintptr(info),
+		uintptr(unsafe.Pointer(&buf[0])), uintptr(needed), uintptr(unsafe.Pointer(&needed)))
+	if r == 0 {
+		return nil, err
+	}
+
+	return buf[:needed], nil
+}
+
+// setFileSecurity applies the parts info of the security descriptor sd to
+// path.
+func setFileSecurity(path string, info uint32, sd []byte) error {
+	p, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return err
+	}
+
+	r, _, err := procSetFileSecurity.Call(uintptr(unsafe.Pointer(p)), uintptr(info), uintptr(unsafe.Pointer(&sd[0])))
+	if r == 0 {
+		return err
+	}
+	return nil
+}
+
+// fillSecurityDescriptor saves the owner, group and DACL of path.
+func (node *Node) fillSecurityDescriptor(path string) error {
+	if node.Type == "symlink" {
+		return nil
+	}
+
+	sd, err := getFileSecurity(path, securityInformation)
+	if err == errorNotSupported {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "GetFileSecurity")
+	}
+
+	node.SecurityDescriptor = sd
+	return nil
+}
+
+// restoreSecurityDescriptor applies the saved security descriptor to path.
+// Setting the owner requires a special privilege, without it only the DACL
+// is restored.
+func (node Node) restoreSecurityDescriptor(path string) error {
+	if len(node.SecurityDescriptor) == 0 || node.Type == "symlink" {
+		return nil
+	}
+
+	err := setFileSecurity(path, securityInformation, node.SecurityDescriptor)
+	if err == nil || err == errorNotSupported {
+		return nil
+	}
+
+	err = setFileSecurity(path, daclSecurityInformation, node.SecurityDescriptor)
+	if err == errorNotSupported {
+		return nil
+	}
+	return errors.Wrap(err, "SetFileSecurity")
+}
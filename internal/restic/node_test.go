@@ -165,6 +165,25 @@ var nodeTests = []restic.Node{
 	},
 }
 
+func TestNodeFilterExtendedAttributes(t *testing.T) {
+	node := restic.Node{
+		ExtendedAttributes: []restic.ExtendedAttribute{
+			{Name: "user.foo", Value: []byte("foo")},
+			{Name: "security.selinux", Value: []byte("bar")},
+			{Name: "user.baz", Value: []byte("baz")},
+		},
+	}
+
+	node.FilterExtendedAttributes(nil)
+	rtest.Equals(t, 3, len(node.ExtendedAttributes))
+
+	node.FilterExtendedAttributes(func(name string) bool { return name != "security.selinux" })
+	rtest.Equals(t, []restic.ExtendedAttribute{
+		{Name: "user.foo", Value: []byte("foo")},
+		{Name: "user.baz", Value: []byte("baz")},
+	}, node.ExtendedAttributes)
+}
+
 func TestNodeRestoreAt(t *testing.T) {
 	tempdir, err := ioutil.TempDir(rtest.TestTempDir, "restic-test-")
 	rtest.OK(t, err)
@@ -30,3 +30,13 @@ func (s statUnix) uid() uint32   { return uint32(s.Uid) }
 func (s statUnix) gid() uint32   { return uint32(s.Gid) }
 func (s statUnix) rdev() uint64  { return uint64(s.Rdev) }
 func (s statUnix) size() int64   { return int64(s.Size) }
+
+// fillSecurityDescriptor does nothing, security descriptors only exist on
+// Windows. Access control lists are stored as extended attributes instead.
+func (node *Node) fillSecurityDescriptor(path string) error {
+	return nil
+}
+
+func (node Node) restoreSecurityDescriptor(path string) error {
+	return nil
+}
@@ -3,7 +3,9 @@
 package restic
 
 import (
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"runtime"
 	"syscall"
 	"testing"
@@ -133,3 +135,74 @@ func TestNodeFromFileInfo(t *testing.T) {
 		})
 	}
 }
+
+func TestNodeIsNewerIgnoring(t *testing.T) {
+	tempdir, err := ioutil.TempDir("", "restic-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempdir)
+
+	filename := filepath.Join(tempdir, "file")
+	if err = ioutil.WriteFile(filename, []byte("foobar"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	fi, _ := stat(t, filename)
+	node, err := NodeFromFileInfo(filename, fi)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// replace the file with a copy, which has a different inode and ctime
+	// but the same content, size and modification time. The ctime may have
+	// a coarse resolution.
+	time.Sleep(20 * time.Millisecond)
+	other := filepath.Join(tempdir, "other")
+	if err = ioutil.WriteFile(other, []byte("foobar"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Chtimes(other, fi.ModTime(), fi.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Rename(other, filename); err != nil {
+		t.Fatal(err)
+	}
+
+	fi, _ = stat(t, filename)
+	if node.ChangeTime.Equal(changeTime(statUnix(*fi.Sys().(*syscall.Stat_t)))) {
+		t.Skip("ctime of the replaced file did not change")
+	}
+
+	if !node.IsNewer(filename, fi) {
+		t.Fatalf("replaced file is not newer")
+	}
+
+	var tests = []struct {
+		ignore ChangeIgnoreFlags
+		newer  bool
+	}{
+		{ChangeIgnoreInode, true},
+		{ChangeIgnoreCtime, true},
+		{ChangeIgnoreInode | ChangeIgnoreCtime, false},
+	}
+
+	for _, test := range tests {
+		if newer := node.IsNewerIgnoring(filename, fi, test.ignore); newer != test.newer {
+			t.Errorf("ignore %v: want newer %v, got %v", test.ignore, test.newer, newer)
+		}
+	}
+
+	// a different size is always detected
+	if err = ioutil.WriteFile(filename, []byte("foo"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Chtimes(filename, node.ModTime, node.ModTime); err != nil {
+		t.Fatal(err)
+	}
+
+	fi, _ = stat(t, filename)
+	if !node.IsNewerIgnoring(filename, fi, ChangeIgnoreInode|ChangeIgnoreCtime) {
+		t.Errorf("file with different size is not newer")
+	}
+}
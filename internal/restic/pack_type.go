@@ -0,0 +1,20 @@
+package restic
+
+import "context"
+
+// packTypeKey is the key for the pack type in a context.
+type packTypeKey struct{}
+
+// WithPackType returns a context which tells the backend that the pack file
+// saved with it contains only blobs of type t. Backends can use this to store
+// packs with metadata in a different location than packs with file data.
+func WithPackType(ctx context.Context, t BlobType) context.Context {
+	return context.WithValue(ctx, packTypeKey{}, t)
+}
+
+// PackTypeFromContext returns the type of the blobs in the pack file saved
+// with ctx, ok is false if the type is unknown.
+func PackTypeFromContext(ctx context.Context) (t BlobType, ok bool) {
+	t, ok = ctx.Value(packTypeKey{}).(BlobType)
+	return t, ok
+}
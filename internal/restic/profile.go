@@ -0,0 +1,99 @@
+package restic
+
+import (
+	"sync"
+	"time"
+)
+
+// Phases of a backup recorded in a Profile.
+const (
+	PhaseScan    = "scan"
+	PhaseRead    = "read"
+	PhaseChunk   = "chunk"
+	PhaseHash    = "hash"
+	PhaseEncrypt = "encrypt"
+	PhaseUpload  = "upload"
+	PhaseIndex   = "index"
+)
+
+// phaseOrder is the order in which the phases are returned by Phases.
+var phaseOrder = []string{PhaseScan, PhaseRead, PhaseChunk, PhaseHash, PhaseEncrypt, PhaseUpload, PhaseIndex}
+
+// PhaseStat is the time spent in a phase and the amount of data processed.
+// As most phases run concurrently, Duration is the sum over all goroutines
+// and can be longer than the operation took.
+type PhaseStat struct {
+	Phase    string        `json:"phase"`
+	Duration time.Duration `json:"duration"`
+	Bytes    uint64        `json:"bytes"`
+	Count    uint64        `json:"count"`
+}
+
+// BytesPerSecond returns the throughput of the phase.
+func (s PhaseStat) BytesPerSecond() float64 {
+	if s.Duration <= 0 {
+		return 0
+	}
+	return float64(s.Bytes) / s.Duration.Seconds()
+}
+
+// Profile accumulates the time spent in the phases of an operation. All
+// methods can be called concurrently, and on a nil Profile, in which case
+// nothing is recorded.
+type Profile struct {
+	m      sync.Mutex
+	phases map[string]*PhaseStat
+}
+
+// NewProfile returns a new, empty profile.
+func NewProfile() *Profile {
+	return &Profile{phases: make(map[string]*PhaseStat)}
+}
+
+// Add records that d was spent in phase processing bytes.
+func (p *Profile) Add(phase string, d time.Duration, bytes uint64) {
+	if p == nil {
+		return
+	}
+
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	s, ok := p.phases[phase]
+	if !ok {
+		s = &PhaseStat{Phase: phase}
+		p.phases[phase] = s
+	}
+
+	s.Duration += d
+	s.Bytes += bytes
+	s.Count++
+}
+
+// Since records the time since start for phase.
+func (p *Profile) Since(phase string, start time.Time, bytes uint64) {
+	if p == nil {
+		return
+	}
+
+	p.Add(phase, time.Since(start), bytes)
+}
+
+// Phases returns the statistics for all phases which were recorded.
+func (p *Profile) Phases() []PhaseStat {
+	if p == nil {
+		return nil
+	}
+
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	var list []PhaseStat
+	for _, phase := range phaseOrder {
+		if s, ok := p.phases[phase]; ok {
+			list = append(list, *s)
+		}
+	}
+
+	return list
+}
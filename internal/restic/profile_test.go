@@ -0,0 +1,26 @@
+package restic_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestProfile(t *testing.T) {
+	p := restic.NewProfile()
+	p.Add(restic.PhaseUpload, 2*time.Second, 100)
+	p.Add(restic.PhaseRead, time.Second, 50)
+	p.Add(restic.PhaseUpload, 2*time.Second, 100)
+
+	phases := p.Phases()
+	rtest.Equals(t, 2, len(phases))
+	rtest.Equals(t, restic.PhaseStat{Phase: restic.PhaseRead, Duration: time.Second, Bytes: 50, Count: 1}, phases[0])
+	rtest.Equals(t, restic.PhaseStat{Phase: restic.PhaseUpload, Duration: 4 * time.Second, Bytes: 200, Count: 2}, phases[1])
+	rtest.Equals(t, float64(50), phases[1].BytesPerSecond())
+
+	var nilProfile *restic.Profile
+	nilProfile.Add(restic.PhaseRead, time.Second, 1)
+	rtest.Equals(t, 0, len(nilProfile.Phases()))
+}
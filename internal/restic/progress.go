@@ -3,6 +3,7 @@ package restic
 import (
 	"fmt"
 	"os"
+	"sort"
 	"strconv"
 	"sync"
 	"time"
@@ -45,6 +46,9 @@ type Progress struct {
 	lastUpdate time.Time
 
 	running bool
+
+	total Stat
+	items map[string]int
 }
 
 // Stat captures newly done parts of the operation.
@@ -73,6 +77,12 @@ func NewProgress() *Progress {
 	return &Progress{d: d}
 }
 
+// NewProgressInterval returns a new progress reporter which calls OnUpdate
+// every d, also when stdout is not a terminal.
+func NewProgressInterval(d time.Duration) *Progress {
+	return &Progress{d: d}
+}
+
 // Start resets and runs the progress reporter.
 func (p *Progress) Start() {
 	if p == nil || p.running {
@@ -108,9 +118,81 @@ func (p *Progress) Reset() {
 
 	p.curM.Lock()
 	p.cur = Stat{}
+	p.items = nil
+	p.curM.Unlock()
+}
+
+// SetTotal records the statistics for the whole operation, which are used to
+// estimate the remaining time.
+func (p *Progress) SetTotal(s Stat) {
+	if p == nil {
+		return
+	}
+
+	p.curM.Lock()
+	p.total = s
 	p.curM.Unlock()
 }
 
+// Total returns the statistics set with SetTotal.
+func (p *Progress) Total() Stat {
+	if p == nil {
+		return Stat{}
+	}
+
+	p.curM.Lock()
+	defer p.curM.Unlock()
+	return p.total
+}
+
+// StartItem marks item (e.g. a file name) as being processed. Items can be
+// started several times, e.g. by different goroutines, they are listed until
+// FinishItem has been called for each call to StartItem.
+func (p *Progress) StartItem(item string) {
+	if p == nil {
+		return
+	}
+
+	p.curM.Lock()
+	if p.items == nil {
+		p.items = make(map[string]int)
+	}
+	p.items[item]++
+	p.curM.Unlock()
+}
+
+// FinishItem marks item as done.
+func (p *Progress) FinishItem(item string) {
+	if p == nil {
+		return
+	}
+
+	p.curM.Lock()
+	p.items[item]--
+	if p.items[item] <= 0 {
+		delete(p.items, item)
+	}
+	p.curM.Unlock()
+}
+
+// CurrentItems returns the items which are currently being processed, sorted
+// by name.
+func (p *Progress) CurrentItems() []string {
+	if p == nil {
+		return nil
+	}
+
+	p.curM.Lock()
+	items := make([]string, 0, len(p.items))
+	for item := range p.items {
+		items = append(items, item)
+	}
+	p.curM.Unlock()
+
+	sort.Strings(items)
+	return items
+}
+
 // Report adds the statistics from s to the current state and tries to report
 // the accumulated statistics via the feedback channel.
 func (p *Progress) Report(s Stat) {
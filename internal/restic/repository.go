@@ -24,6 +24,9 @@ type Repository interface {
 
 	Config() Config
 
+	// PackSize returns the size a pack file must reach before it is saved.
+	PackSize() uint
+
 	LookupBlobSize(ID, BlobType) (uint, bool)
 
 	// List calls the function fn for each file of type t in the repository.
@@ -4,6 +4,7 @@ import (
 	"context"
 	"os"
 	"path/filepath"
+	"sync"
 
 	"github.com/restic/restic/internal/errors"
 
@@ -18,6 +19,52 @@ type Restorer struct {
 
 	Error        func(dir string, node *Node, err error) error
 	SelectFilter func(item string, dstpath string, node *Node) (selectedForRestore bool, childMayBeSelected bool)
+
+	// BlobError is called when a data blob of the file node cannot be loaded.
+	// If it returns nil, the blob's content is replaced with zeros and
+	// restoring the file continues. When BlobError is nil, the error is
+	// passed to Error.
+	BlobError func(location string, node *Node, blob DamagedBlob) error
+
+	// Workers is the number of pack files downloaded concurrently, zero
+	// means DefaultRestoreWorkers.
+	Workers int
+
+	// Verify enables reading all files again after they have been restored
+	// and checking their content.
+	Verify bool
+
+	// XattrFilter selects the extended attributes which are restored, by
+	// name. All are restored if it is nil.
+	XattrFilter func(name string) bool
+
+	// Sparse enables leaving holes in files instead of writing blobs which
+	// only contain zeros.
+	Sparse bool
+
+	// Progress is updated with the number of files and bytes which have been
+	// restored, the files currently written are reported as items. It may be
+	// nil.
+	Progress *Progress
+
+	// files contains the files which were created, their content is written
+	// ordered by pack files afterwards.
+	files []*restoreFile
+
+	// errMu serializes calls to Error and BlobError while the content is
+	// written.
+	errMu sync.Mutex
+
+	// dirs contains the directories which were restored, their metadata is
+	// applied after all files have been written.
+	dirs []restoredDir
+}
+
+// restoredDir is a directory whose metadata still needs to be restored.
+type restoredDir struct {
+	node     *Node
+	target   string
+	location string
 }
 
 var restorerAbortOnAllErrors = func(str string, node *Node, err error) error { return err }
@@ -79,7 +126,35 @@ func (res *Restorer) restoreTo(ctx context.Context, target, location string, tre
 		selectedForRestore, childMayBeSelected := res.SelectFilter(nodeLocation, nodeTarget, node)
 		debug.Log("SelectFilter returned %v %v", selectedForRestore, childMayBeSelected)
 
-		if node.Type == "dir" && childMayBeSelected {
+		if selectedForRestore {
+			node.FilterExtendedAttributes(res.XattrFilter)
+		}
+
+		if node.Type != "dir" {
+			if selectedForRestore {
+				err = res.restoreNodeTo(ctx, node, nodeTarget, nodeLocation, idx)
+				if err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		if selectedForRestore {
+			// Create the directory now, so that it exists even when it is
+			// empty. An existing directory is reused. The metadata is
+			// restored once all files have been written, see RestoreTo.
+			err = fs.MkdirAll(nodeTarget, 0700)
+			if err != nil {
+				err = res.Error(nodeLocation, node, errors.Wrap(err, "MkdirAll"))
+				if err != nil {
+					return err
+				}
+				continue
+			}
+		}
+
+		if childMayBeSelected {
 			if node.Subtree == nil {
 				return errors.Errorf("Dir without subtree in tree %v", treeID.Str())
 			}
@@ -94,14 +169,29 @@ func (res *Restorer) restoreTo(ctx context.Context, target, location string, tre
 		}
 
 		if selectedForRestore {
-			err = res.restoreNodeTo(ctx, node, nodeTarget, nodeLocation, idx)
-			if err != nil {
-				return err
-			}
+			res.dirs = append(res.dirs, restoredDir{node: node, target: nodeTarget, location: nodeLocation})
+		}
+	}
+
+	return nil
+}
+
+// restoreDirMetadata restores the metadata of all directories which were
+// created, including the timestamps. Subdirectories were appended to
+// res.dirs before their parents, so a restrictive mode of a parent
+// directory does not prevent restoring the metadata of its children.
+func (res *Restorer) restoreDirMetadata() error {
+	for _, dir := range res.dirs {
+		debug.Log("restore metadata for %v", dir.target)
 
-			// Restore directory timestamp at the end. If we would do it earlier, restoring files within
-			// the directory would overwrite the timestamp of the directory they are in.
-			err = node.RestoreTimestamps(nodeTarget)
+		err := dir.node.restoreMetadata(dir.target)
+		if err == nil {
+			err = dir.node.RestoreTimestamps(dir.target)
+		}
+
+		if err != nil {
+			debug.Log("error restoring metadata for %v: %v", dir.target, err)
+			err = res.Error(dir.location, dir.node, err)
 			if err != nil {
 				return err
 			}
@@ -114,7 +204,23 @@ func (res *Restorer) restoreTo(ctx context.Context, target, location string, tre
 func (res *Restorer) restoreNodeTo(ctx context.Context, node *Node, target, location string, idx *HardlinkIndex) error {
 	debug.Log("%v %v %v", node.Name, target, location)
 
-	err := node.CreateAt(ctx, target, res.repo, idx)
+	var damaged func(DamagedBlob) error
+	if res.BlobError != nil {
+		damaged = func(blob DamagedBlob) error {
+			debug.Log("replacing damaged blob %v in %v: %v", blob.ID.Str(), location, blob.Err)
+			return res.BlobError(location, node, blob)
+		}
+	}
+
+	create := func() error {
+		// the content of files is written later
+		if node.Type == "file" {
+			return res.createFile(node, target, location, idx)
+		}
+		return node.createAt(ctx, target, res.repo, idx, damaged)
+	}
+
+	err := create()
 	if err != nil {
 		debug.Log("node.CreateAt(%s) error %v", target, err)
 	}
@@ -126,7 +232,7 @@ func (res *Restorer) restoreNodeTo(ctx context.Context, node *Node, target, loca
 		// Create parent directories and retry
 		err = fs.MkdirAll(filepath.Dir(target), 0700)
 		if err == nil || os.IsExist(errors.Cause(err)) {
-			err = node.CreateAt(ctx, target, res.repo, idx)
+			err = create()
 		}
 	}
 
@@ -152,8 +258,41 @@ func (res *Restorer) RestoreTo(ctx context.Context, dst string) error {
 		}
 	}
 
+	// first create all files and directories, then write the content of the
+	// files ordered by pack files, then restore the metadata of the files
+	// and directories. Otherwise writing the files within a directory would
+	// modify its timestamps again.
+	res.Progress.Start()
+	defer res.Progress.Done()
+
+	res.dirs = nil
+	res.files = nil
 	idx := NewHardlinkIndex()
-	return res.restoreTo(ctx, dst, string(filepath.Separator), *res.sn.Tree, idx)
+	err = res.restoreTo(ctx, dst, string(filepath.Separator), *res.sn.Tree, idx)
+	if err != nil {
+		return err
+	}
+
+	var total Stat
+	for _, file := range res.files {
+		total.Files++
+		for _, b := range file.blobs {
+			total.Bytes += b.length
+		}
+	}
+	res.Progress.SetTotal(total)
+
+	err = res.restoreContent(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = res.finishFiles()
+	if err != nil {
+		return err
+	}
+
+	return res.restoreDirMetadata()
 }
 
 // Snapshot returns the snapshot this restorer is configured to use.
@@ -3,6 +3,7 @@ package restic_test
 import (
 	"bytes"
 	"context"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -28,8 +29,9 @@ type File struct {
 }
 
 type Dir struct {
-	Nodes map[string]Node
-	Mode  os.FileMode
+	Nodes   map[string]Node
+	Mode    os.FileMode
+	ModTime time.Time
 }
 
 func saveFile(t testing.TB, repo restic.Repository, node File) restic.ID {
@@ -73,6 +75,7 @@ func saveDir(t testing.TB, repo restic.Repository, nodes map[string]Node) restic
 			tree.Insert(&restic.Node{
 				Type:    "dir",
 				Mode:    mode,
+				ModTime: node.ModTime,
 				Name:    name,
 				UID:     uint32(os.Getuid()),
 				GID:     uint32(os.Getgid()),
@@ -346,6 +349,69 @@ func TestRestorer(t *testing.T) {
 	}
 }
 
+func TestRestorerDirMetadata(t *testing.T) {
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+
+	modTimes := map[string]time.Time{
+		"dir":        time.Date(2017, 3, 4, 5, 6, 7, 0, time.Local),
+		"dir/subdir": time.Date(2016, 1, 2, 3, 4, 5, 0, time.Local),
+		"dir/empty":  time.Date(2015, 6, 7, 8, 9, 10, 0, time.Local),
+	}
+
+	_, id := saveSnapshot(t, repo, Snapshot{
+		Nodes: map[string]Node{
+			"dir": Dir{
+				ModTime: modTimes["dir"],
+				Nodes: map[string]Node{
+					"file": File{"file in dir"},
+					"subdir": Dir{
+						ModTime: modTimes["dir/subdir"],
+						Nodes: map[string]Node{
+							"file": File{"file in subdir"},
+						},
+					},
+					"empty": Dir{
+						ModTime: modTimes["dir/empty"],
+					},
+				},
+			},
+		},
+	})
+
+	res, err := restic.NewRestorer(repo, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tempdir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+
+	// an existing empty directory is reused
+	rtest.OK(t, os.MkdirAll(filepath.Join(tempdir, "dir", "empty"), 0700))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	rtest.OK(t, res.RestoreTo(ctx, tempdir))
+
+	for dir, modTime := range modTimes {
+		fi, err := os.Stat(filepath.Join(tempdir, filepath.FromSlash(dir)))
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+
+		if !fi.IsDir() {
+			t.Errorf("%v is not a directory", dir)
+		}
+
+		if !fi.ModTime().Equal(modTime) {
+			t.Errorf("%v has wrong modification time: want %v, got %v", dir, modTime, fi.ModTime())
+		}
+	}
+}
+
 func chdir(t testing.TB, target string) func() {
 	prev, err := os.Getwd()
 	if err != nil {
@@ -443,3 +509,160 @@ func TestRestorerRelative(t *testing.T) {
 		})
 	}
 }
+
+func TestRestorerReplaceDamaged(t *testing.T) {
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+
+	_, id := saveSnapshot(t, repo, Snapshot{
+		Nodes: map[string]Node{
+			"foo": File{"content: foo\n"},
+			"dirtest": Dir{
+				Nodes: map[string]Node{
+					"file": File{"content: damaged file\n"},
+				},
+			},
+		},
+	})
+
+	damaged := restic.NewIDSet(restic.Hash([]byte("content: damaged file\n")))
+	drepo := damagedRepo{Repository: repo, damaged: damaged}
+
+	tempdir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// without BlobError, the error is passed to Error
+	res, err := restic.NewRestorer(drepo, id)
+	rtest.OK(t, err)
+
+	var failed []string
+	res.Error = func(dir string, node *restic.Node, err error) error {
+		failed = append(failed, toSlash(dir))
+		return nil
+	}
+
+	rtest.OK(t, res.RestoreTo(ctx, filepath.Join(tempdir, "restore1")))
+	rtest.Equals(t, []string{"/dirtest/file"}, failed)
+
+	// with BlobError, the damaged data is replaced with zeros
+	res, err = restic.NewRestorer(drepo, id)
+	rtest.OK(t, err)
+
+	failed = nil
+	var reported []string
+	res.BlobError = func(location string, node *restic.Node, blob restic.DamagedBlob) error {
+		reported = append(reported, toSlash(location))
+		rtest.Equals(t, uint64(0), blob.Offset)
+		rtest.Equals(t, uint64(len("content: damaged file\n")), blob.Length)
+		return nil
+	}
+
+	rtest.OK(t, res.RestoreTo(ctx, filepath.Join(tempdir, "restore2")))
+	rtest.Equals(t, []string(nil), failed)
+	rtest.Equals(t, []string{"/dirtest/file"}, reported)
+
+	data, err := ioutil.ReadFile(filepath.Join(tempdir, "restore2", "dirtest", "file"))
+	rtest.OK(t, err)
+	rtest.Equals(t, make([]byte, len("content: damaged file\n")), data)
+
+	data, err = ioutil.ReadFile(filepath.Join(tempdir, "restore2", "foo"))
+	rtest.OK(t, err)
+	rtest.Equals(t, []byte("content: foo\n"), data)
+}
+
+func TestRestorerWorkers(t *testing.T) {
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+
+	// "foo" and "dir/same" share the same blob
+	_, id := saveSnapshot(t, repo, Snapshot{
+		Nodes: map[string]Node{
+			"foo": File{"content: foo\n"},
+			"bar": File{"content: bar\n"},
+			"dir": Dir{
+				Nodes: map[string]Node{
+					"same":  File{"content: foo\n"},
+					"other": File{"content: other\n"},
+				},
+			},
+		},
+	})
+
+	files := map[string]string{
+		"foo":       "content: foo\n",
+		"bar":       "content: bar\n",
+		"dir/same":  "content: foo\n",
+		"dir/other": "content: other\n",
+	}
+
+	tempdir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	for _, workers := range []int{1, 4} {
+		res, err := restic.NewRestorer(repo, id)
+		rtest.OK(t, err)
+
+		res.Workers = workers
+		res.Verify = true
+		res.Error = func(dir string, node *restic.Node, err error) error {
+			t.Errorf("unexpected error for %q in dir %v: %v", node.Name, dir, err)
+			return nil
+		}
+
+		target := filepath.Join(tempdir, fmt.Sprintf("restore%d", workers))
+		rtest.OK(t, res.RestoreTo(ctx, target))
+
+		for filename, content := range files {
+			data, err := ioutil.ReadFile(filepath.Join(target, filepath.FromSlash(filename)))
+			rtest.OK(t, err)
+			rtest.Equals(t, []byte(content), data)
+		}
+	}
+}
+
+func TestRestorerSparse(t *testing.T) {
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+
+	zeros := string(make([]byte, 1<<20))
+	_, id := saveSnapshot(t, repo, Snapshot{
+		Nodes: map[string]Node{
+			"zeros": File{zeros},
+			"foo":   File{"content: foo\n"},
+		},
+	})
+
+	tempdir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	res, err := restic.NewRestorer(repo, id)
+	rtest.OK(t, err)
+
+	res.Sparse = true
+	res.Verify = true
+	res.Error = func(dir string, node *restic.Node, err error) error {
+		t.Errorf("unexpected error for %q in dir %v: %v", node.Name, dir, err)
+		return nil
+	}
+
+	rtest.OK(t, res.RestoreTo(ctx, tempdir))
+
+	data, err := ioutil.ReadFile(filepath.Join(tempdir, "zeros"))
+	rtest.OK(t, err)
+	rtest.Equals(t, []byte(zeros), data)
+
+	data, err = ioutil.ReadFile(filepath.Join(tempdir, "foo"))
+	rtest.OK(t, err)
+	rtest.Equals(t, []byte("content: foo\n"), data)
+
+	checkSparse(t, filepath.Join(tempdir, "zeros"))
+}
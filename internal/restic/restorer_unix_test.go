@@ -0,0 +1,28 @@
+// +build !windows
+
+package restic_test
+
+import (
+	"os"
+	"syscall"
+	"testing"
+
+	rtest "github.com/restic/restic/internal/test"
+)
+
+// checkSparse verifies that the file filename does not have all of its
+// content allocated.
+func checkSparse(t testing.TB, filename string) {
+	fi, err := os.Stat(filename)
+	rtest.OK(t, err)
+
+	stat, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		t.Skipf("unable to determine the allocated size of %v", filename)
+	}
+
+	allocated := int64(stat.Blocks) * 512
+	if allocated >= fi.Size() {
+		t.Errorf("file %v is not sparse, %d of %d bytes allocated", filename, allocated, fi.Size())
+	}
+}
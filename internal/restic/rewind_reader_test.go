@@ -0,0 +1,96 @@
+package restic
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestByteReader(t *testing.T) {
+	buf := []byte("foobar")
+	fn := func() RewindReader {
+		return NewByteReader(buf)
+	}
+	testRewindReader(t, fn, buf)
+}
+
+func TestFileReader(t *testing.T) {
+	buf := []byte("foobar")
+
+	d, cleanup := rtest.TempDir(t)
+	defer cleanup()
+
+	filename := filepath.Join(d, "file-reader-test")
+	err := ioutil.WriteFile(filename, buf, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() {
+		err := f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	// move the position away from the start, NewFileReader must rewind
+	_, err = f.Seek(3, io.SeekStart)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fn := func() RewindReader {
+		rd, err := NewFileReader(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rd
+	}
+
+	testRewindReader(t, fn, buf)
+}
+
+func testRewindReader(t *testing.T, fn func() RewindReader, data []byte) {
+	rd := fn()
+
+	if rd.Length() != int64(len(data)) {
+		t.Fatalf("wrong length returned, want %d, got %d", len(data), rd.Length())
+	}
+
+	for i := 0; i < 3; i++ {
+		buf, err := ioutil.ReadAll(rd)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(buf, data) {
+			t.Fatalf("wrong data returned in round %d, want %q, got %q", i, data, buf)
+		}
+
+		// read only a part of the data in the next round
+		err = rd.Rewind()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = io.ReadFull(rd, make([]byte, 2))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = rd.Rewind()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -23,10 +23,53 @@ type Snapshot struct {
 	Excludes []string  `json:"excludes,omitempty"`
 	Tags     []string  `json:"tags,omitempty"`
 	Original *ID       `json:"original,omitempty"`
+	Labels   Labels    `json:"labels,omitempty"`
+
+	// ProgramVersion is the version of the program which created the
+	// snapshot.
+	ProgramVersion string `json:"program_version,omitempty"`
+
+	// ChangedFiles lists the files which were modified while they were
+	// read, their content in the snapshot may be inconsistent.
+	ChangedFiles []string `json:"changed_files,omitempty"`
+
+	// Summary contains the statistics of the backup which created the
+	// snapshot, it is nil for snapshots created by older versions.
+	Summary *SnapshotSummary `json:"summary,omitempty"`
 
 	id *ID // plaintext ID, used during restore
 }
 
+// SnapshotSummary contains the statistics of a backup.
+type SnapshotSummary struct {
+	BackupStart time.Time `json:"backup_start"`
+	BackupEnd   time.Time `json:"backup_end"`
+
+	// FilesNew are files which are not in the parent snapshot, FilesChanged
+	// were read again because they have been modified since the parent
+	// snapshot, FilesUnmodified were taken over from the parent snapshot.
+	FilesNew        uint64 `json:"files_new"`
+	FilesChanged    uint64 `json:"files_changed"`
+	FilesUnmodified uint64 `json:"files_unmodified"`
+
+	// DataBlobs and TreeBlobs are the numbers of blobs added to the
+	// repository, DataAdded is their size before encryption.
+	DataBlobs uint64 `json:"data_blobs"`
+	TreeBlobs uint64 `json:"tree_blobs"`
+	DataAdded uint64 `json:"data_added"`
+
+	// DataTransferred is the size of the pack files uploaded to the backend.
+	DataTransferred uint64 `json:"data_transferred"`
+
+	TotalFilesProcessed uint64 `json:"total_files_processed"`
+	TotalBytesProcessed uint64 `json:"total_bytes_processed"`
+}
+
+// Duration returns how long the backup took.
+func (s SnapshotSummary) Duration() time.Duration {
+	return s.BackupEnd.Sub(s.BackupStart)
+}
+
 // NewSnapshot returns an initialized snapshot struct for the current user and
 // time.
 func NewSnapshot(paths []string, tags []string, hostname string, time time.Time) (*Snapshot, error) {
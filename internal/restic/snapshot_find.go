@@ -6,6 +6,7 @@ import (
 	"os"
 	"time"
 
+	"github.com/restic/restic/internal/debug"
 	"github.com/restic/restic/internal/errors"
 )
 
@@ -74,12 +75,18 @@ func FindFilteredSnapshots(ctx context.Context, repo Repository, host string, ta
 
 	err := repo.List(ctx, SnapshotFile, func(id ID, size int64) error {
 		sn, err := LoadSnapshot(ctx, repo, id)
+		if err != nil && repo.Backend().IsNotExist(err) {
+			// the snapshot was removed after it was listed
+			debug.Log("snapshot %v does not exist any more", id.Str())
+			return nil
+		}
+
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "could not load snapshot %v: %v\n", id.Str(), err)
 			return nil
 		}
 
-		if (host != "" && host != sn.Hostname) || !sn.HasTagList(tags) || !sn.HasPaths(paths) {
+		if !sn.matches(host, tags, paths) {
 			return nil
 		}
 
@@ -93,3 +100,22 @@ func FindFilteredSnapshots(ctx context.Context, repo Repository, host string, ta
 
 	return results, nil
 }
+
+// matches returns true if the snapshot was made on host (if not empty),
+// includes one of the tag lists and all of the paths.
+func (sn *Snapshot) matches(host string, tags []TagList, paths []string) bool {
+	return (host == "" || host == sn.Hostname) && sn.HasTagList(tags) && sn.HasPaths(paths)
+}
+
+// FilterSnapshots returns the snapshots from list which match the filter,
+// like FindFilteredSnapshots does for the snapshots in a repository.
+func FilterSnapshots(list Snapshots, host string, tags []TagList, paths []string) Snapshots {
+	var results Snapshots
+	for _, sn := range list {
+		if sn.matches(host, tags, paths) {
+			results = append(results, sn)
+		}
+	}
+
+	return results
+}
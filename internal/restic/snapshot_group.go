@@ -0,0 +1,133 @@
+package restic
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/restic/restic/internal/errors"
+)
+
+// SnapshotGroupByOptions configures which fields of a snapshot are used to
+// group snapshots.
+type SnapshotGroupByOptions struct {
+	Host bool
+	Path bool
+	Tag  bool
+}
+
+// ParseSnapshotGroupByOptions parses a comma-separated list of grouping
+// fields, e.g. "host,paths". Valid fields are "host", "paths" and "tags",
+// empty fields are ignored.
+func ParseSnapshotGroupByOptions(s string) (SnapshotGroupByOptions, error) {
+	var opts SnapshotGroupByOptions
+
+	for _, field := range strings.Split(s, ",") {
+		switch strings.TrimSpace(field) {
+		case "host":
+			opts.Host = true
+		case "paths":
+			opts.Path = true
+		case "tags":
+			opts.Tag = true
+		case "":
+		default:
+			return SnapshotGroupByOptions{}, errors.Fatalf("unknown grouping option: %q", field)
+		}
+	}
+
+	return opts, nil
+}
+
+// Empty returns true if snapshots are not grouped at all.
+func (opts SnapshotGroupByOptions) Empty() bool {
+	return !opts.Host && !opts.Path && !opts.Tag
+}
+
+// SnapshotGroupKey contains the fields of a snapshot that were used to
+// determine its group. Fields that are not used for grouping are empty. Paths
+// and tags are sorted.
+type SnapshotGroupKey struct {
+	Hostname string   `json:"hostname"`
+	Paths    []string `json:"paths"`
+	Tags     []string `json:"tags"`
+}
+
+// NewSnapshotGroupKey returns the group key of sn.
+func NewSnapshotGroupKey(sn *Snapshot, opts SnapshotGroupByOptions) SnapshotGroupKey {
+	var key SnapshotGroupKey
+
+	if opts.Host {
+		key.Hostname = sn.Hostname
+	}
+
+	if opts.Path {
+		key.Paths = make([]string, len(sn.Paths))
+		copy(key.Paths, sn.Paths)
+		sort.Strings(key.Paths)
+	}
+
+	if opts.Tag {
+		key.Tags = make([]string, len(sn.Tags))
+		copy(key.Tags, sn.Tags)
+		sort.Strings(key.Tags)
+	}
+
+	return key
+}
+
+// String returns a description of the group, e.g. "host [foo], paths [/bin]".
+func (key SnapshotGroupKey) String(opts SnapshotGroupByOptions) string {
+	var info []string
+
+	if opts.Tag {
+		info = append(info, "tags ["+strings.Join(key.Tags, ", ")+"]")
+	}
+	if opts.Host {
+		info = append(info, "host ["+key.Hostname+"]")
+	}
+	if opts.Path {
+		info = append(info, "paths ["+strings.Join(key.Paths, ", ")+"]")
+	}
+
+	return strings.Join(info, ", ")
+}
+
+// SnapshotGroup is a list of snapshots with the same group key.
+type SnapshotGroup struct {
+	Key       SnapshotGroupKey
+	Snapshots Snapshots
+}
+
+// GroupSnapshots groups the snapshots in list according to opts. The
+// snapshots within a group keep their relative order, the groups are sorted
+// by their key. When opts is empty, all snapshots are put into a single group.
+func GroupSnapshots(list Snapshots, opts SnapshotGroupByOptions) []SnapshotGroup {
+	groups := make(map[string]*SnapshotGroup)
+	var keys []string
+
+	for _, sn := range list {
+		key := NewSnapshotGroupKey(sn, opts)
+
+		// the key only consists of strings, marshaling cannot fail
+		buf, _ := json.Marshal(key)
+		k := string(buf)
+
+		group, ok := groups[k]
+		if !ok {
+			group = &SnapshotGroup{Key: key}
+			groups[k] = group
+			keys = append(keys, k)
+		}
+		group.Snapshots = append(group.Snapshots, sn)
+	}
+
+	sort.Strings(keys)
+
+	result := make([]SnapshotGroup, 0, len(keys))
+	for _, k := range keys {
+		result = append(result, *groups[k])
+	}
+
+	return result
+}
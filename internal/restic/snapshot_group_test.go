@@ -0,0 +1,87 @@
+package restic_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestParseSnapshotGroupByOptions(t *testing.T) {
+	var tests = []struct {
+		input string
+		want  restic.SnapshotGroupByOptions
+		err   bool
+	}{
+		{"", restic.SnapshotGroupByOptions{}, false},
+		{"host", restic.SnapshotGroupByOptions{Host: true}, false},
+		{"host,paths", restic.SnapshotGroupByOptions{Host: true, Path: true}, false},
+		{"tags,host,paths", restic.SnapshotGroupByOptions{Host: true, Path: true, Tag: true}, false},
+		{"paths,", restic.SnapshotGroupByOptions{Path: true}, false},
+		{"host, tags", restic.SnapshotGroupByOptions{Host: true, Tag: true}, false},
+		{"path", restic.SnapshotGroupByOptions{}, true},
+		{"host,foo", restic.SnapshotGroupByOptions{}, true},
+	}
+
+	for _, test := range tests {
+		t.Run("", func(t *testing.T) {
+			opts, err := restic.ParseSnapshotGroupByOptions(test.input)
+			if test.err {
+				rtest.Assert(t, err != nil, "expected error for %q, got nil", test.input)
+				return
+			}
+
+			rtest.OK(t, err)
+			rtest.Equals(t, test.want, opts)
+		})
+	}
+}
+
+func TestGroupSnapshots(t *testing.T) {
+	newSnapshot := func(host string, paths, tags []string) *restic.Snapshot {
+		sn, err := restic.NewSnapshot(paths, tags, host, time.Now())
+		rtest.OK(t, err)
+		return sn
+	}
+
+	list := restic.Snapshots{
+		newSnapshot("foo", []string{"/home", "/etc"}, []string{"a"}),
+		newSnapshot("bar", []string{"/home"}, nil),
+		newSnapshot("foo", []string{"/etc", "/home"}, []string{"b"}),
+		newSnapshot("foo", []string{"/home"}, []string{"a"}),
+	}
+
+	var tests = []struct {
+		opts   restic.SnapshotGroupByOptions
+		groups [][]int
+	}{
+		{restic.SnapshotGroupByOptions{}, [][]int{{0, 1, 2, 3}}},
+		{restic.SnapshotGroupByOptions{Host: true}, [][]int{{1}, {0, 2, 3}}},
+		{restic.SnapshotGroupByOptions{Path: true}, [][]int{{0, 2}, {1, 3}}},
+		{restic.SnapshotGroupByOptions{Host: true, Path: true}, [][]int{{1}, {0, 2}, {3}}},
+		{restic.SnapshotGroupByOptions{Tag: true}, [][]int{{0, 3}, {2}, {1}}},
+	}
+
+	for _, test := range tests {
+		t.Run("", func(t *testing.T) {
+			groups := restic.GroupSnapshots(list, test.opts)
+			rtest.Equals(t, len(test.groups), len(groups))
+
+			for i, group := range groups {
+				var want restic.Snapshots
+				for _, idx := range test.groups[i] {
+					want = append(want, list[idx])
+				}
+				rtest.Equals(t, want, group.Snapshots)
+			}
+		})
+	}
+
+	// paths must not be sorted in place
+	rtest.Equals(t, []string{"/home", "/etc"}, list[0].Paths)
+
+	key := restic.NewSnapshotGroupKey(list[0], restic.SnapshotGroupByOptions{Host: true, Path: true, Tag: true})
+	rtest.Equals(t, "tags [a], host [foo], paths [/etc, /home]",
+		key.String(restic.SnapshotGroupByOptions{Host: true, Path: true, Tag: true}))
+}
@@ -15,10 +15,18 @@ type ExpirePolicy struct {
 	Monthly int       // keep the last n monthly snapshots
 	Yearly  int       // keep the last n yearly snapshots
 	Tags    []TagList // keep all snapshots that include at least one of the tag lists.
+
+	Within        Duration // keep snapshots made within this duration
+	WithinHourly  Duration // keep hourly snapshots made within this duration
+	WithinDaily   Duration // keep daily snapshots made within this duration
+	WithinWeekly  Duration // keep weekly snapshots made within this duration
+	WithinMonthly Duration // keep monthly snapshots made within this duration
+	WithinYearly  Duration // keep yearly snapshots made within this duration
 }
 
-// Sum returns the maximum number of snapshots to be kept according to this
-// policy.
+// Sum returns the maximum number of snapshots to be kept according to the
+// counting options of this policy, the snapshots kept because of their tags
+// or their age are not included.
 func (e ExpirePolicy) Sum() int {
 	return e.Last + e.Hourly + e.Daily + e.Weekly + e.Monthly + e.Yearly
 }
@@ -65,7 +73,9 @@ func always(d time.Time, nr int) int {
 }
 
 // ApplyPolicy returns the snapshots from list that are to be kept and removed
-// according to the policy p. list is sorted in the process.
+// according to the policy p. list is sorted in the process. The durations of
+// the Within options are relative to the latest snapshot in list, not to the
+// current time.
 func ApplyPolicy(list Snapshots, p ExpirePolicy) (keep, remove Snapshots) {
 	sort.Sort(list)
 
@@ -90,6 +100,22 @@ func ApplyPolicy(list Snapshots, p ExpirePolicy) (keep, remove Snapshots) {
 		{p.Yearly, y, -1},
 	}
 
+	// the list is sorted newest first
+	latest := list[0].Time
+
+	var bucketsWithin = [6]struct {
+		Within Duration
+		bucker func(d time.Time, nr int) int
+		Last   int
+	}{
+		{p.Within, always, -1},
+		{p.WithinHourly, ymdh, -1},
+		{p.WithinDaily, ymd, -1},
+		{p.WithinWeekly, yw, -1},
+		{p.WithinMonthly, ym, -1},
+		{p.WithinYearly, y, -1},
+	}
+
 	for nr, cur := range list {
 		var keepSnap bool
 
@@ -112,6 +138,18 @@ func ApplyPolicy(list Snapshots, p ExpirePolicy) (keep, remove Snapshots) {
 			}
 		}
 
+		// The within buckets keep one snapshot per period, as long as the
+		// snapshot is not older than the duration.
+		for i, b := range bucketsWithin {
+			if !b.Within.Zero() && cur.Time.After(b.Within.Before(latest)) {
+				val := b.bucker(cur.Time, nr)
+				if val != b.Last {
+					keepSnap = true
+					bucketsWithin[i].Last = val
+				}
+			}
+		}
+
 		if keepSnap {
 			keep = append(keep, cur)
 		} else {
@@ -121,3 +159,48 @@ func ApplyPolicy(list Snapshots, p ExpirePolicy) (keep, remove Snapshots) {
 
 	return keep, remove
 }
+
+// ExpireTimes predicts when the snapshots in list will be removed if forget
+// is run with the policy p at now and after each future backup. New
+// snapshots (without tags) are assumed to be created every interval, the
+// simulation stops after until. The returned map contains the time at which
+// each snapshot is removed, snapshots which are removed right away get now.
+// Snapshots which are still kept at until are not contained in the map.
+func ExpireTimes(list Snapshots, p ExpirePolicy, now time.Time, interval time.Duration, until time.Time) map[*Snapshot]time.Time {
+	expires := make(map[*Snapshot]time.Time)
+	if p.Empty() || interval <= 0 {
+		return expires
+	}
+
+	// only the snapshots from list are tracked, the simulated ones are not
+	// returned
+	orig := make(map[*Snapshot]struct{}, len(list))
+	for _, sn := range list {
+		orig[sn] = struct{}{}
+	}
+
+	current := make(Snapshots, len(list))
+	copy(current, list)
+
+	for t := now; !t.After(until); t = t.Add(interval) {
+		if t.After(now) {
+			current = append(current, &Snapshot{Time: t})
+		}
+
+		keep, remove := ApplyPolicy(current, p)
+		for _, sn := range remove {
+			if _, ok := orig[sn]; ok {
+				expires[sn] = t
+				delete(orig, sn)
+			}
+		}
+
+		if len(orig) == 0 {
+			break
+		}
+
+		current = keep
+	}
+
+	return expires
+}
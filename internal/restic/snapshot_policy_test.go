@@ -229,3 +229,124 @@ func TestApplyPolicy(t *testing.T) {
 		}
 	}
 }
+
+func TestExpireTimes(t *testing.T) {
+	snapshot := func(s string, tags ...string) *restic.Snapshot {
+		return &restic.Snapshot{Time: parseTimeUTC(s), Tags: tags}
+	}
+
+	var (
+		day1   = snapshot("2016-01-01 12:00:00")
+		day2   = snapshot("2016-01-02 12:00:00")
+		day3   = snapshot("2016-01-03 12:00:00")
+		early3 = snapshot("2016-01-03 08:00:00")
+		tagged = snapshot("2015-12-01 12:00:00", "important")
+	)
+
+	list := restic.Snapshots{day1, day2, day3, early3, tagged}
+	policy := restic.ExpirePolicy{Daily: 3, Tags: []restic.TagList{{"important"}}}
+
+	now := parseTimeUTC("2016-01-03 13:00:00")
+	until := parseTimeUTC("2017-01-01 00:00:00")
+	expires := restic.ExpireTimes(list, policy, now, 24*time.Hour, until)
+
+	want := map[*restic.Snapshot]time.Time{
+		early3: now,
+		day1:   parseTimeUTC("2016-01-04 13:00:00"),
+		day2:   parseTimeUTC("2016-01-05 13:00:00"),
+		day3:   parseTimeUTC("2016-01-06 13:00:00"),
+	}
+
+	if len(expires) != len(want) {
+		t.Fatalf("wrong number of expiring snapshots, want %d, got %d: %v", len(want), len(expires), expires)
+	}
+
+	for sn, ts := range want {
+		got, ok := expires[sn]
+		if !ok {
+			t.Errorf("snapshot at %v does not expire", sn.Time)
+			continue
+		}
+
+		if !got.Equal(ts) {
+			t.Errorf("snapshot at %v: wrong expire time, want %v, got %v", sn.Time, ts, got)
+		}
+	}
+
+	// the original list is not modified
+	if len(list) != 5 {
+		t.Errorf("list was modified: %v", list)
+	}
+
+	expires = restic.ExpireTimes(list, restic.ExpirePolicy{}, now, 24*time.Hour, until)
+	if len(expires) != 0 {
+		t.Errorf("snapshots expire without a policy: %v", expires)
+	}
+}
+
+func TestApplyPolicyWithin(t *testing.T) {
+	list := restic.Snapshots{
+		{Time: parseTimeUTC("2015-06-01 12:00:00")},
+		{Time: parseTimeUTC("2015-12-31 12:00:00")},
+		{Time: parseTimeUTC("2016-01-01 12:00:00")},
+		{Time: parseTimeUTC("2016-01-12 12:00:00")},
+		{Time: parseTimeUTC("2016-01-17 12:00:00")},
+		{Time: parseTimeUTC("2016-01-18 08:00:00")},
+		{Time: parseTimeUTC("2016-01-18 12:00:00")},
+	}
+
+	var tests = []struct {
+		p    restic.ExpirePolicy
+		keep []string
+	}{
+		{
+			restic.ExpirePolicy{Within: restic.Duration{Days: 7}},
+			[]string{"2016-01-18 12:00:00", "2016-01-18 08:00:00", "2016-01-17 12:00:00", "2016-01-12 12:00:00"},
+		},
+		{
+			restic.ExpirePolicy{Within: restic.Duration{Hours: 4}},
+			[]string{"2016-01-18 12:00:00"},
+		},
+		{
+			restic.ExpirePolicy{WithinDaily: restic.Duration{Days: 7}},
+			[]string{"2016-01-18 12:00:00", "2016-01-17 12:00:00", "2016-01-12 12:00:00"},
+		},
+		{
+			restic.ExpirePolicy{WithinMonthly: restic.Duration{Years: 1}},
+			[]string{"2016-01-18 12:00:00", "2015-12-31 12:00:00", "2015-06-01 12:00:00"},
+		},
+		{
+			restic.ExpirePolicy{WithinYearly: restic.Duration{Years: 2}},
+			[]string{"2016-01-18 12:00:00", "2015-12-31 12:00:00"},
+		},
+		{
+			restic.ExpirePolicy{Last: 1, WithinWeekly: restic.Duration{Months: 1}},
+			[]string{"2016-01-18 12:00:00", "2016-01-17 12:00:00", "2016-01-01 12:00:00"},
+		},
+	}
+
+	for i, test := range tests {
+		if test.p.Empty() {
+			t.Errorf("test %d: policy %v is empty", i, test.p)
+			continue
+		}
+
+		// ApplyPolicy sorts the list, use a copy for each test
+		snapshots := make(restic.Snapshots, len(list))
+		copy(snapshots, list)
+
+		keep, remove := restic.ApplyPolicy(snapshots, test.p)
+		if len(keep)+len(remove) != len(list) {
+			t.Errorf("test %d: len(keep)+len(remove) = %d != %d", i, len(keep)+len(remove), len(list))
+		}
+
+		var got []string
+		for _, sn := range keep {
+			got = append(got, sn.Time.Format("2006-01-02 15:04:05"))
+		}
+
+		if !reflect.DeepEqual(got, test.keep) {
+			t.Errorf("test %d: wrong snapshots kept, want:\n  %v\ngot:\n  %v", i, test.keep, got)
+		}
+	}
+}
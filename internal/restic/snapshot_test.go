@@ -14,3 +14,38 @@ func TestNewSnapshot(t *testing.T) {
 	_, err := restic.NewSnapshot(paths, nil, "foo", time.Now())
 	rtest.OK(t, err)
 }
+
+func TestFilterSnapshots(t *testing.T) {
+	var (
+		foo   = &restic.Snapshot{Hostname: "foo", Paths: []string{"/home"}, Tags: []string{"a", "b"}}
+		bar   = &restic.Snapshot{Hostname: "bar", Paths: []string{"/home", "/srv"}, Tags: []string{"a"}}
+		other = &restic.Snapshot{Hostname: "foo", Paths: []string{"/srv"}}
+	)
+	list := restic.Snapshots{foo, bar, other}
+
+	rtest.Equals(t, list, restic.FilterSnapshots(list, "", nil, nil))
+	rtest.Equals(t, restic.Snapshots{foo, other}, restic.FilterSnapshots(list, "foo", nil, nil))
+	rtest.Equals(t, restic.Snapshots{foo, bar}, restic.FilterSnapshots(list, "", nil, []string{"/home"}))
+	rtest.Equals(t, restic.Snapshots{foo}, restic.FilterSnapshots(list, "", []restic.TagList{{"a", "b"}}, nil))
+	rtest.Equals(t, restic.Snapshots{bar, other}, restic.FilterSnapshots(list, "", nil, []string{"/srv"}))
+	rtest.Equals(t, restic.Snapshots(nil), restic.FilterSnapshots(list, "bar", []restic.TagList{{"b"}}, nil))
+}
+
+func TestSnapshotLabels(t *testing.T) {
+	var labels restic.Labels
+	rtest.OK(t, labels.Set("env=prod"))
+	rtest.OK(t, labels.Set("job=nightly=1"))
+	rtest.OK(t, labels.Set("env=test"))
+	rtest.Equals(t, restic.Labels{"env": "test", "job": "nightly=1"}, labels)
+	rtest.Equals(t, "[env=test, job=nightly=1]", labels.String())
+
+	for _, s := range []string{"env", "=prod", ""} {
+		rtest.Assert(t, labels.Set(s) != nil, "invalid label %q accepted", s)
+	}
+
+	sn := &restic.Snapshot{Labels: labels}
+	rtest.Assert(t, sn.HasLabels(nil), "snapshot does not match empty labels")
+	rtest.Assert(t, sn.HasLabels(restic.Labels{"env": "test"}), "snapshot does not match its label")
+	rtest.Assert(t, !sn.HasLabels(restic.Labels{"env": "prod"}), "snapshot matches a different value")
+	rtest.Assert(t, !sn.HasLabels(restic.Labels{"host": "foo"}), "snapshot matches a missing label")
+}